@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/credentials"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// submitRetryInterval is how long backfill waits for room in a full job queue
+const submitRetryInterval = 100 * time.Millisecond
+
+// runBackfill sends the files of a time window (or the given keys) regardless of the
+// checkpoint, waits until every line is delivered and exits. Progress goes to a private
+// state file, so a running streamer sharing the configuration is not affected. Failed files
+// are not retried; the command fails if any file did.
+func runBackfill(g *globals, args []string) error {
+	flags := g.flags("backfill", "--from time [--to time] [--prefix prefix] [--tag] [key...]")
+	from := flags.String("from", "", "Oldest file timestamp (Unix seconds or RFC 3339)")
+	to := flags.String("to", "", "Newest file timestamp (default: now minus the delay window)")
+	prefix := flags.String("prefix", "", "Key prefix to list (default: the day partitions of the window)")
+	tag := flags.Bool("tag", false, "Tag the lines with a replay ID so downstream can tell them from the originals")
+	stateFile := flags.String("state-file", "", "Keep the private state in this file (default: a temporary file removed on exit)")
+	flags.Parse(args)
+
+	req := scanner.ReplayRequest{Keys: flags.Args(), Prefix: *prefix, Tag: *tag, By: "backfill " + defaultOperator()}
+	var err error
+	if req.From, err = parseBound("from", *from); err != nil {
+		return err
+	}
+	if req.To, err = parseBound("to", *to); err != nil {
+		return err
+	}
+	switch {
+	case len(req.Keys) > 0 && (req.Prefix != "" || req.From != 0 || req.To != 0):
+		return errors.New("give either keys or a --from/--to window, not both")
+	case len(req.Keys) == 0 && req.Prefix == "" && req.From == 0:
+		return errors.New("--from, --prefix or at least one key is required")
+	case req.To != 0 && req.From > req.To:
+		return errors.New("--from must not be after --to")
+	}
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	logging.InitDefaultLogger(cfg.LoggerConfig(nil))
+	defer logging.GetDefaultLogger().Close()
+
+	dir := filepath.Dir(*stateFile)
+	if *stateFile == "" {
+		if dir, err = os.MkdirTemp("", "s3-streamer-backfill-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	resolved := cfg.ResolvePipelines()
+	clients, err := credentials.NewS3Clients(ctx, resolved)
+	if err != nil {
+		return err
+	}
+	m, err := metrics.InitMetricsWithExporters(ctx, metrics.Exporters{}, "", cfg.OTLP.ServiceName, buildVersion(), cfg.OTLP.ExportInterval, false)
+	if err != nil {
+		return err
+	}
+	defer m.Shutdown(context.Background())
+
+	pause := scanner.NewPauseGate()
+	var pipelines []*pipeline
+	defer func() {
+		for _, p := range pipelines {
+			p.pool.Stop()
+			p.sender.Stop()
+			p.state.Stop()
+		}
+	}()
+	for _, r := range resolved {
+		r.Config.State = backfillState(cfg.State, r.Name, dir, *stateFile)
+		r.Config.Processing.Retry.MaxAttempts = -1
+		p, err := newPipeline(r, clients.For(r.Config), m, pause)
+		if err != nil {
+			return err
+		}
+		if _, err := p.openState(ctx); err != nil {
+			return err
+		}
+		p.state.Start()
+		if err := p.newOutput(m, pause); err != nil {
+			p.state.Stop()
+			return err
+		}
+		p.sender.Start()
+		p.pool.Start()
+		pipelines = append(pipelines, p)
+	}
+
+	scanners := make([]*scanner.Scanner, 0, len(pipelines))
+	for _, p := range pipelines {
+		scanners = append(scanners, p.scanner)
+	}
+	submit := func(job scanner.FileJob) bool {
+		for _, p := range pipelines {
+			if p.scanner.StreamID() != job.StreamID {
+				continue
+			}
+			for !p.pool.Submit(job) {
+				select {
+				case <-ctx.Done():
+					return false
+				case <-time.After(submitRetryInterval):
+				}
+			}
+			return true
+		}
+		return false
+	}
+
+	result, err := scanner.NewReplayer(submit, scanners...).Replay(ctx, req)
+	if err != nil {
+		return err
+	}
+	for key, reason := range result.Skipped {
+		fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", key, reason)
+	}
+	fmt.Printf("Sending %d files", result.Files)
+	if result.ID != "" {
+		fmt.Printf(" (replay ID %s)", result.ID)
+	}
+	fmt.Println()
+
+	var files, bytes, failed int64
+	for _, p := range pipelines {
+		p.pool.WaitForIdle(0)
+		f, b, e := p.pool.GetMetrics()
+		files, bytes, failed = files+f, bytes+b, failed+e
+	}
+	if ctx.Err() != nil {
+		return errors.New("interrupted")
+	}
+	fmt.Printf("Sent %d files (%d bytes)", files, bytes)
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	if failed > 0 || result.Rejected > 0 {
+		return fmt.Errorf("%d files failed", failed+int64(result.Rejected))
+	}
+	return nil
+}
+
+// backfillState returns the private state of a backfilled pipeline: a state file in dir,
+// or the given file
+func backfillState(shared config.StateConfig, name, dir, file string) config.StateConfig {
+	if file == "" {
+		file = filepath.Join(dir, "state.json")
+	}
+	private := config.StateConfig{
+		FilePath:           file,
+		SaveInterval:       shared.SaveInterval,
+		Retention:          shared.Retention,
+		CompactionInterval: shared.CompactionInterval,
+	}
+	if name != "" {
+		private = private.Namespaced(name)
+	}
+	return private
+}
+
+// parseBound parses an optional --from or --to value
+func parseBound(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ts, err := state.ParseRewindTarget(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s %q: expected Unix seconds or RFC 3339", name, value)
+	}
+	return ts, nil
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/credentials"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+)
+
+// benchFormat is the log format of the generated files; the key holds the upload time
+var benchFormat = config.FormatConfig{
+	Name:            "s3-streamer-bench",
+	FilenamePattern: "*_bench_*.gz",
+	TimestampRegex:  `/(\d+)_bench_\d+\.gz$`,
+	TimestampFormat: "unix",
+	ContentType:     "application/x-ndjson",
+}
+
+// benchLinePattern finds the file and upload time a delivered line was generated with. It
+// matches inside an envelope too, since neither holds characters JSON escapes.
+var benchLinePattern = regexp.MustCompile(`s3-streamer bench file=(\d+) sent=(\d+)`)
+
+// benchWords pad the generated lines, so they compress about as well as real logs
+var benchWords = strings.Fields("GET POST allowed blocked user host request response bytes " +
+	"status category policy example.com cdn.example.net 10.0.0.1 192.168.1.20 Mozilla/5.0 " +
+	"application/json text/html 200 204 301 403 404 500 true false internal external")
+
+// runBench uploads gzipped files to the configured bucket at a fixed rate and streams them
+// with the configured settings to a mock endpoint served by the command itself, then reports
+// the throughput and the latency from each file's upload to the delivery of its last line.
+// Files are written under a prefix of their own and deleted on exit. The delay window is
+// ignored, since the files are complete when written; state is private, as for backfill.
+func runBench(g *globals, args []string) error {
+	flags := g.flags("bench", "[--rate 1] [--duration 1m] [--lines 6500] [--line-bytes 1500] [--prefix prefix]")
+	rate := flags.Float64("rate", 1, "Files uploaded per second")
+	duration := flags.Duration("duration", time.Minute, "How long files are uploaded; run for hours as a soak test")
+	lines := flags.Int("lines", 6500, "Lines per file")
+	lineBytes := flags.Int("line-bytes", 1500, "Approximate length of a line")
+	prefix := flags.String("prefix", "s3-streamer-bench/", "Key prefix of the generated files; each run writes below it")
+	drain := flags.Duration("drain", 2*time.Minute, "How long to wait for the last files to be delivered once uploads stop")
+	endpointDelay := flags.Duration("endpoint-delay", 0, "Time the mock endpoint takes to answer each request")
+	interval := flags.Duration("report-interval", 10*time.Second, "How often progress is printed")
+	pathStyle := flags.Bool("path-style", false, "Address the bucket in the URL path, as MinIO expects")
+	keep := flags.Bool("keep", false, "Keep the generated files instead of deleting them on exit")
+	flags.Parse(args)
+
+	switch {
+	case *rate <= 0:
+		return errors.New("--rate must be positive")
+	case *lines < 1:
+		return errors.New("--lines must be at least 1")
+	case *duration <= 0:
+		return errors.New("--duration must be positive")
+	}
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	if cfg.S3.Bucket == "" {
+		return errors.New("s3.bucket is required; bench does not use the pipelines")
+	}
+	logging.InitDefaultLogger(cfg.LoggerConfig(nil))
+	defer logging.GetDefaultLogger().Close()
+
+	dir, err := os.MkdirTemp("", "s3-streamer-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	endpoint := newBenchEndpoint(*lines, *endpointDelay)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: endpoint}
+	go server.Serve(listener)
+	defer server.Close()
+
+	runPrefix := strings.TrimPrefix(path.Join(*prefix, time.Now().UTC().Format("20060102T150405")), "/") + "/"
+	cfg.Pipelines = nil
+	cfg.S3.Prefix = runPrefix
+	cfg.Processing.DelayWindow = 0
+	cfg.Processing.LogFormats = append(cfg.Processing.LogFormats, benchFormat)
+	cfg.Processing.DefaultFormat, cfg.Processing.LogFormat = benchFormat.Name, ""
+	cfg.HTTP.Endpoints = []string{"http://" + listener.Addr().String()}
+	cfg.HTTP.EndpointHeaders = nil
+	cfg.State = backfillState(cfg.State, "", dir, "")
+
+	resolved := []config.ResolvedPipeline{{Config: *cfg}}
+	clients, err := credentials.NewS3Clients(ctx, resolved, func(o *s3.Options) { o.UsePathStyle = *pathStyle })
+	if err != nil {
+		return err
+	}
+	client := clients.For(*cfg)
+	m, err := metrics.InitMetricsWithExporters(ctx, metrics.Exporters{}, "", cfg.OTLP.ServiceName, buildVersion(), cfg.OTLP.ExportInterval, false)
+	if err != nil {
+		return err
+	}
+	defer m.Shutdown(context.Background())
+
+	pause := scanner.NewPauseGate()
+	p, err := newPipeline(resolved[0], client, m, pause)
+	if err != nil {
+		return err
+	}
+	if _, err := p.openState(ctx); err != nil {
+		return err
+	}
+	p.state.Start()
+	if err := p.newOutput(m, pause); err != nil {
+		p.state.Stop()
+		return err
+	}
+	p.sender.Start()
+	p.pool.Start()
+	stopped := false
+	stopPipeline := func() {
+		if !stopped {
+			p.pool.Stop()
+			p.sender.Stop()
+			p.state.Stop()
+			stopped = true
+		}
+	}
+	defer stopPipeline()
+	if !*keep {
+		defer func() {
+			if err := deleteBenchFiles(context.Background(), client, cfg.S3.Bucket, runPrefix); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to delete the generated files under s3://%s/%s: %v\n", cfg.S3.Bucket, runPrefix, err)
+			}
+		}()
+	}
+
+	gen := &benchGenerator{client: client, bucket: cfg.S3.Bucket, prefix: runPrefix, lines: *lines, lineBytes: *lineBytes}
+	fmt.Printf("Uploading %d-line files to s3://%s/%s at %g/s for %s\n", *lines, cfg.S3.Bucket, runPrefix, *rate, *duration)
+	start := time.Now()
+	generated := make(chan error, 1)
+	go func() { generated <- gen.run(ctx, *rate, *duration) }()
+
+	scan := time.NewTicker(cfg.Processing.ScanInterval)
+	defer scan.Stop()
+	report := time.NewTicker(*interval)
+	defer report.Stop()
+	poll := time.NewTicker(idlePollInterval)
+	defer poll.Stop()
+	var drained <-chan time.Time
+	var failure error
+
+	p.scan(ctx, nil)
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			failure = errors.New("interrupted")
+			break loop
+		case err := <-generated:
+			if err != nil {
+				failure = err
+				break loop
+			}
+			generated = nil
+			drained = time.After(*drain)
+		case <-scan.C:
+			if _, err := p.scan(ctx, nil); err != nil {
+				logging.Component("scanner").Error("Failed to scan for new files", "error", err)
+			}
+		case <-report.C:
+			fmt.Printf("%6s  uploaded %d files, delivered %s\n", time.Since(start).Round(time.Second), gen.files.Load(), endpoint.summary())
+		case <-poll.C:
+			if generated == nil && endpoint.completed() >= gen.files.Load() {
+				break loop
+			}
+		case <-drained:
+			failure = fmt.Errorf("%d files were not delivered within --drain", gen.files.Load()-endpoint.completed())
+			break loop
+		}
+	}
+	stopPipeline()
+
+	files, uploaded := gen.files.Load(), time.Since(start)
+	if generated == nil {
+		uploaded = *duration
+	}
+	fmt.Printf("\nUploaded   %d files (%.2f/s), %d lines, %.1f MB (%.1f MB gzipped)\n",
+		files, float64(files)/uploaded.Seconds(), files*int64(*lines), megabytes(gen.bytes.Load()), megabytes(gen.compressed.Load()))
+	endpoint.report(os.Stdout)
+	processed, _, failed := p.pool.GetMetrics()
+	fmt.Printf("Streamer   %d files processed, %d failed\n", processed, failed)
+	if failure == nil && failed > 0 {
+		failure = fmt.Errorf("%d files failed", failed)
+	}
+	return failure
+}
+
+// benchGenerator uploads the generated files
+type benchGenerator struct {
+	client    *s3.Client
+	bucket    string
+	prefix    string
+	lines     int
+	lineBytes int
+
+	files      atomic.Int64 // Uploaded so far
+	bytes      atomic.Int64 // Uncompressed
+	compressed atomic.Int64
+}
+
+// run uploads a file at rate per second for duration, or until ctx is done. Uploads are
+// sequential, so keys are written in order; a rate the bucket cannot sustain is reported by
+// the lower rate achieved.
+func (g *benchGenerator) run(ctx context.Context, rate float64, duration time.Duration) error {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	deadline := time.Now().Add(duration)
+	for seq := 0; time.Now().Before(deadline); seq++ {
+		if err := g.upload(ctx, seq); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// upload writes file seq, stamped with the time now
+func (g *benchGenerator) upload(ctx context.Context, seq int) error {
+	sent := time.Now()
+	var raw int64
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	line := make([]byte, 0, g.lineBytes+64)
+	for i := 0; i < g.lines; i++ {
+		line = fmt.Appendf(line[:0], `{"message":"s3-streamer bench file=%d sent=%d line=%d","data":"`, seq, sent.UnixNano(), i)
+		for len(line) < g.lineBytes-3 {
+			line = append(line, benchWords[rand.IntN(len(benchWords))]...)
+			line = append(line, ' ')
+		}
+		line = append(line, "\"}\n"...)
+		zw.Write(line)
+		raw += int64(len(line))
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	t := sent.UTC()
+	key := fmt.Sprintf("%syear=%d/month=%d/day=%d/%d_bench_%08d.gz", g.prefix, t.Year(), int(t.Month()), t.Day(), t.Unix(), seq)
+	compressed := int64(buf.Len())
+	_, err := g.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(g.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(buf.Bytes()),
+		ContentLength: aws.Int64(compressed),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	g.files.Add(1)
+	g.bytes.Add(raw)
+	g.compressed.Add(compressed)
+	return nil
+}
+
+// benchEndpoint is the mock HTTP input. It counts the lines delivered per file and records
+// each file's latency once all its lines have arrived.
+type benchEndpoint struct {
+	lines int
+	delay time.Duration
+
+	mu          sync.Mutex
+	received    map[int]int     // Lines delivered, by file
+	latencies   []time.Duration // Of the completed files
+	delivered   int64           // Lines of generated files
+	duplicates  int64           // Lines delivered more than once
+	unknown     int64           // Lines not generated by bench
+	bytes       int64
+	first, last time.Time
+}
+
+func newBenchEndpoint(lines int, delay time.Duration) *benchEndpoint {
+	return &benchEndpoint{lines: lines, delay: delay, received: make(map[int]int)}
+}
+
+func (e *benchEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if e.delay > 0 {
+		time.Sleep(e.delay)
+	}
+	now := time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.first.IsZero() {
+		e.first = now
+	}
+	e.last = now
+	e.bytes += int64(len(body))
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		match := benchLinePattern.FindSubmatch(line)
+		if match == nil {
+			e.unknown++
+			continue
+		}
+		file, _ := strconv.Atoi(string(match[1]))
+		sent, _ := strconv.ParseInt(string(match[2]), 10, 64)
+		e.delivered++
+		e.received[file]++
+		switch n := e.received[file]; {
+		case n == e.lines:
+			e.latencies = append(e.latencies, now.Sub(time.Unix(0, sent)))
+		case n > e.lines:
+			e.duplicates++
+		}
+	}
+}
+
+// completed returns the number of files whose lines have all been delivered
+func (e *benchEndpoint) completed() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return int64(len(e.latencies))
+}
+
+// summary describes the delivery so far on one line
+func (e *benchEndpoint) summary() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sorted := sortedDurations(e.latencies)
+	return fmt.Sprintf("%d files (%d lines), latency p50 %s p99 %s",
+		len(sorted), e.delivered, percentile(sorted, 0.50), percentile(sorted, 0.99))
+}
+
+// report writes the delivery totals and the latency distribution
+func (e *benchEndpoint) report(w io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	elapsed := e.last.Sub(e.first).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	fmt.Fprintf(w, "Delivered  %d files, %d lines (%.0f/s), %.1f MB (%.2f MB/s)",
+		len(e.latencies), e.delivered, float64(e.delivered)/elapsed, megabytes(e.bytes), megabytes(e.bytes)/elapsed)
+	if e.duplicates > 0 || e.unknown > 0 {
+		fmt.Fprintf(w, "; %d duplicate and %d unrecognized lines", e.duplicates, e.unknown)
+	}
+	fmt.Fprintln(w)
+	sorted := sortedDurations(e.latencies)
+	fmt.Fprintf(w, "Latency    p50 %s  p90 %s  p99 %s  max %s (upload to last line delivered)\n",
+		percentile(sorted, 0.50), percentile(sorted, 0.90), percentile(sorted, 0.99), percentile(sorted, 1))
+}
+
+// sortedDurations returns a sorted copy of d
+func sortedDurations(d []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), d...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// percentile returns the q quantile of sorted durations, rounded for display
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.999999) - 1
+	return sorted[max(0, min(i, len(sorted)-1))].Round(time.Millisecond)
+}
+
+// megabytes converts bytes to MB
+func megabytes(n int64) float64 {
+	return float64(n) / 1e6
+}
+
+// deleteBenchFiles deletes the objects under prefix
+func deleteBenchFiles(ctx context.Context, client *s3.Client, bucket, prefix string) error {
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+		objects := make([]types.ObjectIdentifier, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			objects = append(objects, types.ObjectIdentifier{Key: obj.Key})
+		}
+		if _, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
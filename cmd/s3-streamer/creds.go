@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/credentials"
+)
+
+// runCreds encrypts a credential (e.g. aws_access_key_id) read from stdin with this machine's
+// key, or with a KMS key (--kms-key) so the file works on any host allowed to decrypt with
+// it, or prints one, in any of the formats
+func runCreds(g *globals, args []string) error {
+	if len(args) == 0 {
+		return errors.New("creds needs a subcommand (encrypt or decrypt)")
+	}
+	flags := g.flags("creds "+args[0], "[--dir /etc/systemd/creds/s3-streamer] [--kms-key alias/name] <name>")
+	dir := flags.String("dir", credentials.Dir(), "Encrypted credentials directory")
+	kmsKey := flags.String("kms-key", "", "Encrypt with this AWS KMS key (ID, ARN or alias) instead of the machine key")
+	region := flags.String("region", "", "Region of the KMS key (default: AWS_REGION)")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		return fmt.Errorf("creds %s needs a credential name, e.g. aws_access_key_id", args[0])
+	}
+	name := flags.Arg(0)
+
+	switch args[0] {
+	case "encrypt":
+		value, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read the credential from stdin: %w", err)
+		}
+		if *kmsKey != "" {
+			return credentials.WriteCredentialKMS(context.Background(), *dir, name, strings.TrimSpace(string(value)), *kmsKey, *region)
+		}
+		return credentials.WriteCredential(*dir, name, strings.TrimSpace(string(value)))
+	case "decrypt":
+		value, err := credentials.ReadCredential(*dir, name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	default:
+		return fmt.Errorf("unknown creds subcommand %q (expected encrypt or decrypt)", args[0])
+	}
+}
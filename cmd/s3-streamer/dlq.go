@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/credentials"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+)
+
+// maxDLQLine is the longest line read from a spill file, as on replay at startup
+const maxDLQLine = 10 * 1024 * 1024
+
+// dlqFile is a spill file to replay: a local path, or an object when bucket is set
+type dlqFile struct {
+	bucket string
+	path   string
+}
+
+func (f dlqFile) String() string {
+	if f.bucket != "" {
+		return "s3://" + f.bucket + "/" + f.path
+	}
+	return f.path
+}
+
+// runReplayDLQ sends the lines of spill files, the lines a streamer could not deliver before
+// it stopped, through the configured HTTP output. Each file is deleted once all its lines are
+// accepted, unless --keep is given; a file with lines that failed is kept to be replayed
+// again. The files are read from the spill directories of the configuration, a local path,
+// or an S3 prefix they were copied to. Lines are sent as stored, without envelopes, since
+// they were wrapped before they were spilled.
+func runReplayDLQ(g *globals, args []string) error {
+	flags := g.flags("replay-dlq", "[--path dir|file | --s3-prefix [s3://bucket/]prefix] [--pipeline name] [--rate lines/s]")
+	dir := flags.String("path", "", "Spill directory or file (default: http.spill_dir of each pipeline)")
+	prefix := flags.String("s3-prefix", "", "Replay the objects under this prefix of s3.bucket, or of the bucket in an s3:// URL")
+	name := flags.String("pipeline", "", "Pipeline whose spill files to replay, and whose output --path or --s3-prefix is sent to")
+	rate := flags.Float64("rate", 0, "Lines sent per second at most (0 = unlimited)")
+	interval := flags.Duration("report-interval", 10*time.Second, "How often progress is printed")
+	keep := flags.Bool("keep", false, "Keep files and objects once their lines are delivered")
+	flags.Parse(args)
+	if *dir != "" && *prefix != "" {
+		return errors.New("give either --path or --s3-prefix, not both")
+	}
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	logging.InitDefaultLogger(cfg.LoggerConfig(nil))
+	defer logging.GetDefaultLogger().Close()
+
+	resolved := cfg.ResolvePipelines()
+	if *dir != "" || *prefix != "" || *name != "" {
+		p, err := choosePipeline(cfg, *name)
+		if err != nil {
+			return err
+		}
+		resolved = []config.ResolvedPipeline{p}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var clients *credentials.S3Clients
+	if *prefix != "" {
+		if clients, err = credentials.NewS3Clients(ctx, resolved); err != nil {
+			return err
+		}
+	}
+	m, err := metrics.InitMetricsWithExporters(ctx, metrics.Exporters{}, "", cfg.OTLP.ServiceName, buildVersion(), cfg.OTLP.ExportInterval, false)
+	if err != nil {
+		return err
+	}
+	defer m.Shutdown(context.Background())
+
+	r := &dlqReplayer{keep: *keep, pacer: newPacer(*rate)}
+	var failed error
+	for _, p := range resolved {
+		var files []dlqFile
+		var client *s3.Client
+		switch {
+		case *prefix != "":
+			client = clients.For(p.Config)
+			files, err = listDLQObjects(ctx, client, p.Config.S3.Bucket, *prefix)
+		case *dir != "":
+			files, err = listDLQFiles(*dir)
+		case p.Config.HTTP.SpillDir == "":
+			continue
+		default:
+			files, err = listDLQFiles(p.Config.HTTP.SpillDir)
+		}
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		fmt.Printf("Replaying %d spill files to %s\n", len(files), strings.Join(p.Config.HTTP.Endpoints, ", "))
+		if err := r.replay(ctx, &p.Config, m, client, files, *interval); err != nil {
+			failed = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	if r.total == 0 && failed == nil {
+		fmt.Println("No spill files to replay")
+		return nil
+	}
+	fmt.Printf("Replayed %d of %d files, %d lines\n", r.done.Load(), r.total, r.lines.Load())
+	return failed
+}
+
+// listDLQFiles returns the spill files of a directory, oldest first, or the given file
+func listDLQFiles(path string) ([]dlqFile, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []dlqFile{{path: path}}, nil
+	}
+	paths, err := output.ListSpillFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]dlqFile, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, dlqFile{path: p})
+	}
+	return files, nil
+}
+
+// listDLQObjects returns the objects under prefix, in key order. prefix may be an s3://
+// URL naming another bucket.
+func listDLQObjects(ctx context.Context, client *s3.Client, bucket, prefix string) ([]dlqFile, error) {
+	if rest, ok := strings.CutPrefix(prefix, "s3://"); ok {
+		bucket, prefix, _ = strings.Cut(rest, "/")
+	}
+	var files []dlqFile
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %w", bucket, prefix, err)
+		}
+		for _, obj := range page.Contents {
+			if !strings.HasSuffix(*obj.Key, "/") {
+				files = append(files, dlqFile{bucket: bucket, path: *obj.Key})
+			}
+		}
+	}
+	return files, nil
+}
+
+// dlqReplayer sends spill files and keeps the totals across pipelines
+type dlqReplayer struct {
+	keep  bool
+	pacer *pacer
+
+	total  int          // Files found
+	done   atomic.Int64 // Files delivered
+	failed atomic.Int64 // Files with lines that failed
+	lines  atomic.Int64 // Lines queued
+}
+
+// replay sends files through a sender for cfg and waits until every line is resolved
+func (r *dlqReplayer) replay(ctx context.Context, cfg *config.Config, m *metrics.Metrics, client *s3.Client, files []dlqFile, interval time.Duration) error {
+	plain := *cfg
+	plain.Processing.Envelopes = nil
+	sender, err := newSender(&plain, m, "")
+	if err != nil {
+		return err
+	}
+	sender.Start()
+	r.total += len(files)
+	failedBefore := r.failed.Load()
+
+	start := time.Now()
+	quit := make(chan struct{})
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		report := time.NewTicker(interval)
+		defer report.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-report.C:
+				sent, _, _, _ := sender.GetMetrics()
+				fmt.Printf("%6s  %d of %d files delivered, %d lines sent (%.0f/s)\n", time.Since(start).Round(time.Second),
+					r.done.Load(), r.total, sent, float64(sent)/time.Since(start).Seconds())
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	unread := 0
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		if err := r.send(ctx, sender, client, file, wg.Done); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to replay %s: %v\n", file, err)
+			unread++
+		}
+	}
+
+	// Wait for the lines still buffered or in flight; on interrupt, Stop fails them
+	idle := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		sender.Stop()
+	case <-ctx.Done():
+		sender.Stop()
+		<-idle
+	}
+	close(quit)
+	<-reported
+
+	switch {
+	case ctx.Err() != nil:
+		return errors.New("interrupted")
+	case r.failed.Load() > failedBefore:
+		return fmt.Errorf("%d files were not fully delivered and were kept", r.failed.Load()-failedBefore)
+	case unread > 0:
+		return fmt.Errorf("%d files could not be read", unread)
+	}
+	return nil
+}
+
+// send queues the lines of a file; done is called once they are all resolved, after the file
+// is deleted if they were delivered
+func (r *dlqReplayer) send(ctx context.Context, sender *output.HTTPSender, client *s3.Client, file dlqFile, done func()) error {
+	body, err := openDLQFile(ctx, client, file)
+	if err != nil {
+		done()
+		return err
+	}
+	defer body.Close()
+
+	ack := output.NewAck(func(err error) {
+		defer done()
+		if err != nil {
+			r.failed.Add(1)
+			logging.Component("http_sender").Warn("Spill file not fully delivered, keeping it", "path", file.String(), "error", err)
+			return
+		}
+		if !r.keep {
+			if err := deleteDLQFile(client, file); err != nil {
+				logging.Component("http_sender").Error("Failed to remove replayed spill file", "path", file.String(), "error", err)
+			}
+		}
+		r.done.Add(1)
+	})
+	src := &output.Source{S3Key: filepath.Base(file.path), Ack: ack}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDLQLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := r.pacer.wait(ctx); err != nil {
+			ack.Fail(err)
+			return nil
+		}
+		sender.SendLineCopy(ctx, src, scanner.Bytes())
+		r.lines.Add(1)
+	}
+	if err := scanner.Err(); err != nil {
+		ack.Fail(err)
+		return err
+	}
+	ack.Seal()
+	return nil
+}
+
+// openDLQFile opens a spill file or object, decompressing it if gzipped
+func openDLQFile(ctx context.Context, client *s3.Client, file dlqFile) (io.ReadCloser, error) {
+	var raw io.ReadCloser
+	if file.bucket == "" {
+		f, err := os.Open(file.path)
+		if err != nil {
+			return nil, err
+		}
+		raw = f
+	} else {
+		obj, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(file.bucket), Key: aws.String(file.path)})
+		if err != nil {
+			return nil, err
+		}
+		raw = obj.Body
+	}
+
+	br := bufio.NewReader(raw)
+	if magic, _ := br.Peek(2); len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, raw}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, raw}, nil
+}
+
+// deleteDLQFile removes a replayed spill file or object
+func deleteDLQFile(client *s3.Client, file dlqFile) error {
+	if file.bucket == "" {
+		return os.Remove(file.path)
+	}
+	_, err := client.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: aws.String(file.bucket), Key: aws.String(file.path)})
+	return err
+}
+
+// pacer limits how fast lines are sent
+type pacer struct {
+	interval time.Duration // Between lines; 0 for no limit
+	next     time.Time
+}
+
+func newPacer(perSecond float64) *pacer {
+	if perSecond <= 0 {
+		return &pacer{}
+	}
+	return &pacer{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait returns when the next line may be sent, or with ctx's error. It sleeps only once
+// the schedule is a few milliseconds ahead, so high rates are not held up by timer resolution.
+func (p *pacer) wait(ctx context.Context) error {
+	if p.interval == 0 {
+		return ctx.Err()
+	}
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	ahead := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	if ahead < 5*time.Millisecond {
+		return ctx.Err()
+	}
+	t := time.NewTimer(ahead)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,5 @@
+package main
+
+// Database drivers of the SQL state backend (state.sql). SQLite needs cgo and is registered
+// in drivers_cgo.go.
+import _ "github.com/jackc/pgx/v5/stdlib" // Registers "pgx" (driver: postgres or pgx)
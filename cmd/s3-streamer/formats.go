@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+)
+
+// sampleBytes is how much of a sample file format detection looks at
+const sampleBytes = 4096
+
+// logFormats builds the format registry and returns the configured default format, or nil
+// when formats are detected per file ("auto")
+func logFormats(cfg *config.Config) (formats.LogFormat, *formats.Registry, error) {
+	registry := formats.NewRegistryFromConfig(cfg.Processing.LogFormats)
+	name := cfg.Processing.DefaultFormat
+	if name == "" {
+		name = cfg.Processing.LogFormat
+	}
+	if name == "" || name == string(formats.FormatAuto) {
+		return nil, registry, nil
+	}
+	format, err := registry.GetFormat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return format, registry, nil
+}
+
+// poolFormat returns the format the worker pool processes lines with. With auto-detection
+// it is the registry's fallback, since content detection needs the object.
+func poolFormat(format formats.LogFormat, registry *formats.Registry) formats.LogFormat {
+	if format != nil {
+		return format
+	}
+	return registry.DetectFormat("", nil)
+}
+
+// runFormats dispatches the formats subcommands
+func runFormats(g *globals, args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		return errors.New("formats needs a subcommand (test)")
+	}
+	return runFormatsTest(g, args[1:])
+}
+
+// runFormatsTest shows, for each key, which formats match it and the timestamp each parses,
+// and the format the streamer would use. With --sample, a local copy of the object (plain or
+// gzipped) is also used for content detection and its first lines are shown as they would
+// be sent.
+func runFormatsTest(g *globals, args []string) error {
+	flags := g.flags("formats test", "[--sample file] [--lines 5] <key>...")
+	sample := flags.String("sample", "", "Local copy of the object, for content detection and a preview of the lines sent")
+	lines := flags.Int("lines", 5, "Lines of the sample to preview")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("formats test needs at least one object key")
+	}
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	configured, registry, err := logFormats(cfg)
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	if *sample != "" {
+		if content, err = readSample(*sample); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(registry.GetFormats()))
+	for name := range registry.GetFormats() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, key := range flags.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(key)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  FORMAT\tFILENAME MATCH\tTIMESTAMP")
+		for _, name := range names {
+			format := registry.GetFormats()[name]
+			match := "no"
+			if format.DetectFromFilename(key) {
+				match = "yes"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", name, match, parsedTimestamp(format, key))
+		}
+		w.Flush()
+
+		selected, how := configured, "processing.default_format"
+		if selected == nil {
+			selected, how = registry.DetectFormat(key, head(content, sampleBytes)), "detected"
+		}
+		fmt.Printf("Selected: %s (%s), timestamp %s, content type %s\n", selected.Name(), how, parsedTimestamp(selected, key), selected.GetContentType())
+
+		if content != nil {
+			if err := previewLines(selected, content, *lines); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parsedTimestamp describes the timestamp format parses from key
+func parsedTimestamp(format formats.LogFormat, key string) string {
+	ts, err := format.ParseTimestamp(key)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339) + fmt.Sprintf(" (%d)", ts)
+}
+
+// readSample reads a local file, decompressing it if gzipped
+func readSample(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sample: %w", err)
+	}
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress sample: %w", err)
+	}
+	defer gz.Close()
+	data, err = io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress sample: %w", err)
+	}
+	return data, nil
+}
+
+// previewLines prints the first n lines of content as format processes them
+func previewLines(format formats.LogFormat, content []byte, n int) error {
+	fmt.Println("Lines:")
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for i := 0; i < n && scanner.Scan(); i++ {
+		line, err := format.ProcessContent(scanner.Bytes(), i == 0)
+		switch {
+		case err != nil:
+			fmt.Printf("  %d: error: %v\n", i+1, err)
+		case line == nil:
+			fmt.Printf("  %d: (filtered)\n", i+1)
+		default:
+			fmt.Printf("  %d: %s\n", i+1, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// head returns up to n leading bytes of b
+func head(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
@@ -0,0 +1,140 @@
+// Command s3-streamer streams log files from S3 to EdgeDelta HTTP inputs, and bundles the
+// tools to check its configuration and inspect its state.
+//
+//	s3-streamer [--config config.yaml] [--<key> value] <command> [flags]
+//
+// run streams until SIGTERM. validate loads and validates the configuration; check also runs
+// the pre-flight checks. backfill sends the files of a time window and exits. replay asks a
+// running streamer to send files again, and replay-dlq sends the lines a streamer spilled to
+// disk. bench measures throughput and latency with generated files and a mock endpoint.
+// state shows, exports, imports or rewinds the stored state. formats test shows how the
+// configured log formats handle an object key. creds encrypts or decrypts a credential,
+// schema writes a JSON Schema of the configuration file and version prints the build.
+//
+// --version prints the build, as the version command does. Global flags may be given before
+// or after the command. Any config file setting can be overridden with --<key> (e.g.
+// --s3.bucket) or an S3_STREAMER_<KEY> environment variable.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// command is a subcommand of s3-streamer
+type command struct {
+	name    string
+	summary string
+	run     func(g *globals, args []string) error
+}
+
+// commands are listed by usage in this order
+var commands = []command{
+	{"run", "Stream files from S3 to the HTTP endpoints until stopped", runRun},
+	{"validate", "Load and validate the configuration, reporting unknown fields and invalid values", runValidate},
+	{"check", "Validate the configuration and check S3 access, endpoints, Redis and format patterns", runCheck},
+	{"backfill", "Send the files of a time window with a private state, then exit", runBackfill},
+	{"replay", "Ask a running streamer to send files again (admin API)", runReplay},
+	{"replay-dlq", "Send the lines a streamer spilled to disk through the configured output", runReplayDLQ},
+	{"bench", "Upload generated files at a fixed rate and measure throughput and latency to a mock endpoint", runBench},
+	{"state", "Show, export, import or rewind the stored state (state show|export|import|rewind)", runState},
+	{"formats", "Show how the log formats handle an object key (formats test <key>)", runFormats},
+	{"creds", "Encrypt a credential read from stdin, or print one (creds encrypt|decrypt <name>)", runCreds},
+	{"schema", "Write a JSON Schema of the configuration file", runSchema},
+	{"version", "Print the version and build information", runVersion},
+}
+
+// globals are the flags every command accepts
+type globals struct {
+	configPath string
+	overrides  *config.Overrides
+}
+
+// register adds the global flags to fs
+func (g *globals) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.configPath, "config", g.configPath, "Path to configuration file, or an s3://, ssm:// or secretsmanager:// location")
+	g.overrides.RegisterFlags(fs)
+}
+
+// load reads and validates the configuration with the overrides applied
+func (g *globals) load() (*config.Config, error) {
+	cfg, err := g.overrides.Load(g.configPath, os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// flags returns the flag set of a command, with the global flags. usage is the command's
+// synopsis after its name.
+func (g *globals) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	g.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n\nFlags:\n", os.Args[0], name, usage)
+		printFlags(fs)
+	}
+	return fs
+}
+
+func main() {
+	g := &globals{configPath: "config.yaml", overrides: config.NewOverrides()}
+	g.register(flag.CommandLine)
+	version := flag.Bool("version", false, "Print the version and build information and exit")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *version {
+		printVersion()
+		return
+	}
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(g, flag.Args()[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [--config path] <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> --help' for the flags of a command.\n\nGlobal flags:\n", os.Args[0])
+	printFlags(flag.CommandLine)
+}
+
+// printFlags prints the flags of fs, summarizing the config overrides instead of listing them
+func printFlags(fs *flag.FlagSet) {
+	own := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	own.SetOutput(os.Stderr)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !strings.Contains(f.Name, ".") {
+			own.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	own.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `  --<key> value
+    	Override a config file setting (e.g. --state.file_path); also %s<KEY> (e.g. %s)
+`, config.EnvPrefix, config.EnvName("state.file_path"))
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/health"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/reload"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/shard"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/worker"
+)
+
+// pipeline is one source, format and output (see config.ResolvePipelines) with its own state
+type pipeline struct {
+	name     string
+	cfg      config.Config
+	client   *s3.Client
+	state    state.StateManager
+	scanner  *scanner.Scanner
+	sender   *output.HTTPSender
+	pool     *worker.HTTPPool
+	reloader *reload.Reloader
+	checker  *health.PipelineHealthChecker // nil when health.enabled is false
+
+	// Files submitted by a scan whose stream checkpoint has not yet passed them, by S3 key.
+	// The scanner lists from the checkpoint, so without it a file still queued or in progress
+	// would be submitted again by the next scan. Only the scan loop uses it.
+	pending map[string]scanner.FileJob
+}
+
+// newPipeline creates the scanner of a pipeline
+func newPipeline(resolved config.ResolvedPipeline, client *s3.Client, m *metrics.Metrics, pause *scanner.PauseGate) (*pipeline, error) {
+	cfg := resolved.Config
+	format, registry, err := logFormats(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pipeline{
+		name:     resolved.Name,
+		cfg:      cfg,
+		client:   client,
+		scanner:  scanner.NewScanner(client, cfg.S3.Bucket, cfg.S3.Prefix, cfg.Processing.DelayWindow, format, registry),
+		reloader: reload.NewReloader(&cfg),
+		pending:  make(map[string]scanner.FileJob),
+	}
+	p.scanner.SetMetricsClient(m)
+	p.scanner.SetPauseGate(pause)
+	p.reloader.AddScanner(p.scanner)
+	return p, nil
+}
+
+// label names the pipeline in logs
+func (p *pipeline) label() string {
+	if p.name == "" {
+		return "default"
+	}
+	return p.name
+}
+
+// openState opens the state and, with state.snapshot enabled, restores the S3 snapshot into
+// an empty state
+func (p *pipeline) openState(ctx context.Context) (*state.S3Snapshot, error) {
+	manager, err := state.NewFromConfig(p.cfg.State)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline %s: failed to open state: %w", p.label(), err)
+	}
+	p.state = manager
+
+	if !p.cfg.State.Snapshot.Enabled {
+		return nil, nil
+	}
+	snapshot := state.NewS3Snapshot(p.client, p.cfg.State.Snapshot)
+	if _, err := state.Bootstrap(ctx, manager, snapshot); err != nil {
+		logging.Component("state").Warn("Failed to bootstrap state from S3 snapshot",
+			"pipeline", p.label(),
+			"error", err)
+	}
+	return snapshot, nil
+}
+
+// newOutput creates the HTTP sender and worker pool. Call after openState.
+func (p *pipeline) newOutput(m *metrics.Metrics, pause *scanner.PauseGate) error {
+	sender, err := newSender(&p.cfg, m, p.cfg.HTTP.SpillDir)
+	if err != nil {
+		return err
+	}
+	p.sender = sender
+
+	format, registry, err := logFormats(&p.cfg)
+	if err != nil {
+		return err
+	}
+	proc := p.cfg.Processing
+	p.pool = worker.NewHTTPPool(p.client, p.sender, p.state, p.cfg.S3.Bucket, proc.WorkerCount, proc.QueueSize, m, poolFormat(format, registry))
+	p.pool.SetFileTimeout(proc.FileTimeout)
+	p.pool.SetDecodeReadAhead(proc.DecodeReadAhead)
+	if proc.StrictOrdering {
+		p.pool.SetStrictOrdering()
+	}
+	p.pool.SetLineLimit(proc.MaxLineKB*1024, worker.LongLinePolicy(proc.LongLines))
+	p.pool.SetRetryPolicy(worker.RetryPolicy{
+		MaxAttempts:  proc.Retry.MaxAttempts,
+		Backoff:      proc.Retry.Backoff,
+		MaxBackoff:   proc.Retry.MaxBackoff,
+		RetryCorrupt: proc.Retry.RetryCorrupt,
+	})
+	p.pool.SetMultipartDownload(worker.MultipartPolicy{
+		Threshold:   int64(proc.Multipart.ThresholdMB) << 20,
+		PartSize:    int64(proc.Multipart.PartSizeMB) << 20,
+		Concurrency: proc.Multipart.Concurrency,
+	})
+	if proc.Autoscale.Enabled {
+		p.pool.SetAutoscalePolicy(worker.AutoscalePolicy{
+			MinWorkers:        proc.Autoscale.MinWorkers,
+			MaxWorkers:        proc.Autoscale.MaxWorkers,
+			Interval:          proc.Autoscale.Interval,
+			QueueHighWater:    proc.Autoscale.QueueHighWater,
+			LagHighWater:      proc.Autoscale.LagHighWater,
+			BufferHighWater:   proc.Autoscale.BufferHighWater,
+			ScaleDownCooldown: proc.Autoscale.ScaleDownCooldown,
+		})
+	}
+	if proc.Shed.Enabled {
+		p.pool.SetShedPolicy(worker.ShedPolicy{
+			HighWater: proc.Shed.HighWater,
+			For:       proc.Shed.For,
+			LowWater:  proc.Shed.LowWater,
+		}, pause)
+	}
+
+	p.reloader.SetSender(p.sender)
+	p.reloader.SetPool(p.pool)
+	return nil
+}
+
+// newSender creates the HTTP sender of a configuration, spilling to spillDir (none if empty)
+func newSender(cfg *config.Config, m *metrics.Metrics, spillDir string) (*output.HTTPSender, error) {
+	h := cfg.HTTP
+	envelopes, err := output.ParseEnvelopes(cfg.Processing.Envelopes)
+	if err != nil {
+		return nil, err
+	}
+	return output.NewHTTPSender(h.Endpoints, h.BatchLines, h.BatchBytes, h.FlushInterval, h.Workers, h.BufferSize,
+		h.Timeout, h.MaxIdleConns, h.IdleConnTimeout, h.TLSHandshakeTimeout, h.ResponseHeaderTimeout, h.ExpectContinueTimeout, m,
+		output.WithHeaders(h.Headers, h.EndpointHeaders),
+		output.WithBufferPolicy(output.BufferPolicy(h.BufferPolicy), h.BufferBlockTimeout),
+		output.WithRetry(h.MaxRetries, h.RetryBackoff, h.RetryMaxBackoff),
+		output.WithDrain(h.DrainTimeout, spillDir),
+		output.WithMaxInFlight(h.MaxInFlight),
+		output.WithEnvelopes(envelopes)), nil
+}
+
+// recoverInFlight re-enqueues the files a previous run left in flight. They are marked
+// pending first, since the scanner lists them again until the checkpoint passes them.
+func (p *pipeline) recoverInFlight() {
+	if journal, ok := p.state.(state.Journal); ok {
+		entries, err := journal.InFlight()
+		if err != nil {
+			logging.Component("worker").Error("Failed to read in-flight files", "pipeline", p.label(), "error", err)
+		}
+		for _, entry := range entries {
+			p.pending[entry.Key] = scanner.FileJob{S3Key: entry.Key, Timestamp: entry.Timestamp, StreamID: entry.StreamID}
+		}
+	}
+	if _, err := p.pool.RecoverInFlight(p.cfg.State.InFlightStaleAfter); err != nil {
+		logging.Component("worker").Error("Failed to recover in-flight files", "pipeline", p.label(), "error", err)
+	}
+}
+
+// stepDown stops processing once the leader lease is lost. The pool drops its queued and
+// in-flight files to the new leader, so none of them is pending here any more.
+func (p *pipeline) stepDown() {
+	p.pool.Suspend()
+	clear(p.pending)
+}
+
+// scan lists the files after the checkpoint and submits those not already pending, oldest
+// first, until the queue is full, and returns how many it submitted. With sharding, only the
+// files of owned shards are kept.
+func (p *pipeline) scan(ctx context.Context, coordinator *shard.Coordinator) (int, error) {
+	streamID := p.scanner.StreamID()
+	from := p.state.GetCheckpoint(streamID)
+	if coordinator != nil {
+		from = coordinator.ScanFrom(streamID, p.state)
+	}
+	jobs, err := p.scanner.Scan(ctx, from.Timestamp, from.LastFile)
+	if err != nil {
+		return 0, err
+	}
+	p.prunePending()
+
+	fresh := jobs[:0]
+	for _, job := range jobs {
+		if _, ok := p.pending[job.S3Key]; !ok {
+			fresh = append(fresh, job)
+		}
+	}
+	if coordinator != nil {
+		fresh = coordinator.Assign(ctx, fresh, p.state)
+	}
+	sortJobs(fresh)
+
+	for i, job := range fresh {
+		if !p.pool.Submit(job) {
+			logging.Component("scanner").Warn("Job queue full, deferring files to the next scan",
+				"pipeline", p.label(),
+				"submitted", i,
+				"deferred", len(fresh)-i)
+			return i, nil
+		}
+		p.pending[job.S3Key] = job
+	}
+	return len(fresh), nil
+}
+
+// scanRange submits the files of a ranged scan request regardless of the checkpoint
+func (p *pipeline) scanRange(ctx context.Context, req scanner.ScanRequest) (int, error) {
+	jobs, err := p.scanner.ScanRange(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	sortJobs(jobs)
+	for i, job := range jobs {
+		if !p.pool.Submit(job) {
+			return i, fmt.Errorf("job queue full after %d of %d files", i, len(jobs))
+		}
+	}
+	if len(jobs) > 0 {
+		logging.Component("scanner").Warn("Rescanning files regardless of the checkpoint",
+			"pipeline", p.label(),
+			"by", req.By,
+			"files", len(jobs))
+	}
+	return len(jobs), nil
+}
+
+// prunePending forgets the files their stream checkpoint has passed
+func (p *pipeline) prunePending() {
+	for key, job := range p.pending {
+		cp := p.state.GetCheckpoint(job.StreamID)
+		if job.Timestamp < cp.Timestamp || (job.Timestamp == cp.Timestamp && job.S3Key <= cp.LastFile) {
+			delete(p.pending, key)
+		}
+	}
+}
+
+// sortJobs orders jobs oldest first, by key within a timestamp
+func sortJobs(jobs []scanner.FileJob) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Timestamp != jobs[j].Timestamp {
+			return jobs[i].Timestamp < jobs[j].Timestamp
+		}
+		return jobs[i].S3Key < jobs[j].S3Key
+	})
+}
+
+// lag returns how far the pipeline's checkpoint is behind now, or false before the first file
+func (p *pipeline) lag(now time.Time) (time.Duration, bool) {
+	ts := p.state.GetLastTimestamp()
+	if ts == 0 {
+		return 0, false
+	}
+	return now.Sub(time.Unix(ts, 0)), true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/admin"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+)
+
+// replayTimeout bounds a replay request; listing a wide window can take a while
+const replayTimeout = 5 * time.Minute
+
+// runReplay asks a running streamer, through POST /api/replay, to send the given keys or
+// the files of a window again. The streamer's address and admin token are read from the
+// health settings of the configuration.
+func runReplay(g *globals, args []string) error {
+	flags := g.flags("replay", "[--from time] [--to time] [--prefix prefix] [--tag] [--url http://host:8080] [key...]")
+	from := flags.String("from", "", "Oldest file timestamp (Unix seconds or RFC 3339)")
+	to := flags.String("to", "", "Newest file timestamp (default: now minus the delay window)")
+	prefix := flags.String("prefix", "", "Key prefix to list (default: the day partitions of the window)")
+	tag := flags.Bool("tag", false, "Tag the lines with a replay ID so downstream can tell them from the originals")
+	by := flags.String("by", defaultOperator(), "Operator recorded with the replay")
+	url := flags.String("url", "", "Base URL of the streamer (default: from health.address)")
+	flags.Parse(args)
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	if cfg.Health.AdminToken == "" {
+		return errors.New("health.admin_token is not set, so the admin API is disabled")
+	}
+	if *url == "" {
+		*url = adminURL(cfg.Health)
+	}
+
+	body, err := json.Marshal(admin.ReplayRequest{Keys: flags.Args(), Prefix: *prefix, From: *from, To: *to, Tag: *tag, By: *by})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(*url, "/")+"/api/replay", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.Health.AdminToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: replayTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the streamer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("replay refused (HTTP %d): %s", resp.StatusCode, failure.Error)
+	}
+	var result scanner.ReplayResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid replay response: %w", err)
+	}
+
+	for key, reason := range result.Skipped {
+		fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", key, reason)
+	}
+	fmt.Printf("Enqueued %d files", result.Files)
+	if result.ID != "" {
+		fmt.Printf(" (replay ID %s)", result.ID)
+	}
+	fmt.Println()
+	if result.Rejected > 0 {
+		return fmt.Errorf("%d files rejected because the queue was full; replay them again later", result.Rejected)
+	}
+	return nil
+}
+
+// adminURL returns the URL of the health server on this host
+func adminURL(h config.HealthConfig) string {
+	host, port, err := net.SplitHostPort(h.Address)
+	if err != nil {
+		return "http://" + h.Address
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
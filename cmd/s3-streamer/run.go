@@ -0,0 +1,744 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/admin"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/audit"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/credentials"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/health"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/kube"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/leader"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/report"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/shard"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/systemd"
+)
+
+const (
+	// stateStatusInterval is how often the state persistence gauges are updated
+	stateStatusInterval = 15 * time.Second
+
+	// shutdownTimeout bounds the shutdown of the HTTP servers and the metrics exporters
+	shutdownTimeout = 10 * time.Second
+
+	// idlePollInterval is how often run --once checks for an interrupt while the pools work
+	idlePollInterval = time.Second
+)
+
+// Pod annotations set in Kubernetes mode with sharding
+const (
+	shardsAnnotation     = "s3-streamer.edgedelta.com/shards"       // Owned shards, e.g. "0-3,7"
+	shardCountAnnotation = "s3-streamer.edgedelta.com/shards-owned" // Owned of total, e.g. "5/64"
+)
+
+// errInterrupted is returned by run --once when it stops before catching up
+var errInterrupted = errors.New("interrupted before catching up")
+
+// streamer is a running s3-streamer: the pipelines and what they share
+type streamer struct {
+	cfg        *config.Config
+	version    string
+	metrics    *metrics.Metrics
+	health     *health.HealthServer // nil when health.enabled is false
+	startup    *health.Startup
+	prometheus *http.Server // Dedicated metrics listener (nil unless metrics.prometheus_address is set)
+	clients    *credentials.S3Clients
+	pipelines  []*pipeline
+
+	pause       *scanner.PauseGate
+	trigger     *scanner.ScanTrigger
+	coordinator *shard.Coordinator // nil unless sharding is enabled
+	annotator   *kube.PodAnnotator // nil unless sharding in Kubernetes mode
+	elector     *leader.Elector    // nil unless leader election is enabled
+	audit       *audit.Log         // nil when disabled
+	reporter    *report.Reporter   // nil when disabled
+	crash       *crash.Reporter    // nil without crash.dir
+
+	stop       chan struct{} // Closed at shutdown to end the background loops
+	background sync.WaitGroup
+}
+
+// runRun streams until SIGINT or SIGTERM, or with --once until caught up
+func runRun(g *globals, args []string) error {
+	flags := g.flags("run", "[--once]")
+	once := flags.Bool("once", false, "Process every file up to the delay window, deliver it, save the state and exit")
+	flags.Parse(args)
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.ValidateService(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s, err := start(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer s.shutdown()
+
+	if *once {
+		return s.runOnce(ctx)
+	}
+	go config.Watch(ctx, g.configPath, cfg.Reload.WatchInterval, g.overrides, s.reload)
+	return s.run(ctx)
+}
+
+// start initializes the streamer and starts its pipelines
+func start(ctx context.Context, cfg *config.Config) (*streamer, error) {
+	s := &streamer{
+		cfg:     cfg,
+		version: cfg.OTLP.ServiceVersion,
+		startup: health.NewStartup(),
+		pause:   scanner.NewPauseGate(),
+		trigger: scanner.NewScanTrigger(),
+		stop:    make(chan struct{}),
+	}
+	if s.version == "" {
+		s.version = buildVersion()
+	}
+
+	tlsConfig, err := metrics.LoadTLSConfig(cfg.OTLP.CAFile, cfg.OTLP.CertFile, cfg.OTLP.KeyFile, cfg.OTLP.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	logging.InitDefaultLogger(cfg.LoggerConfig(tlsConfig))
+	logging.ToggleDebugOnSignal(ctx)
+	logger := logging.GetDefaultLogger()
+	build := buildinfo.Get()
+	logger.Info("Starting S3 to EdgeDelta streamer",
+		"version", build.Version,
+		"commit", build.ShortCommit(),
+		"built", build.Date,
+		"go", build.GoVersion,
+		"pipelines", len(cfg.ResolvePipelines()))
+
+	if cfg.Crash.Dir != "" {
+		if s.crash, err = crash.NewReporter(cfg.Crash.Dir, s.version, cfg.Crash.MaxReports); err != nil {
+			return nil, err
+		}
+		if err := s.crash.Install(); err != nil {
+			return nil, err
+		}
+		s.crash.SetState(s.stateSnapshot)
+	}
+
+	if cfg.Health.Enabled {
+		s.health = health.NewHealthServer(cfg.Health.Address, cfg.Health.Path)
+		s.startup = s.health.Startup()
+		if err := s.health.Start(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.startup.Enter(health.PhaseLoadingCredentials)
+	resolved := cfg.ResolvePipelines()
+	if s.clients, err = credentials.NewS3Clients(ctx, resolved); err != nil {
+		return nil, err
+	}
+	go s.clients.Run(ctx)
+
+	if s.metrics, err = initMetrics(ctx, cfg, tlsConfig, s.version); err != nil {
+		return nil, err
+	}
+	if _, err := s.metrics.ObserveCredentials(s.clients.Age, s.clients.Expiry); err != nil {
+		logger.Warn("Failed to register credential gauges", "error", err)
+	}
+	s.servePrometheus()
+
+	s.startup.Enter(health.PhaseConnectingS3)
+	for _, r := range resolved {
+		p, err := newPipeline(r, s.clients.For(r.Config), s.metrics, s.pause)
+		if err != nil {
+			return nil, err
+		}
+		s.pipelines = append(s.pipelines, p)
+	}
+
+	s.startup.Enter(health.PhaseLoadingState)
+	for _, p := range s.pipelines {
+		snapshot, err := p.openState(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.instrumentState(p, snapshot)
+		if standby, ok := p.state.(state.Standby); ok && cfg.LeaderElection.Enabled {
+			standby.SetStandby(true) // Until this replica leads (see handoff)
+		}
+		if shared, ok := p.state.(state.SharedWriter); ok && cfg.Sharding.Enabled {
+			shared.SetSharedWriters() // Every instance saves the checkpoints of its shards
+		}
+		p.state.Start()
+	}
+
+	if cfg.Sharding.Enabled {
+		s.coordinator = shard.New(cfg.Sharding, cfg.State.Redis)
+		if cfg.Kubernetes.Enabled {
+			if err := s.annotateShards(); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.coordinator.Start(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Processing.Audit.Capacity > 0 {
+		if s.audit, err = audit.NewLog(cfg.Processing.Audit.Capacity, cfg.Processing.Audit.Path); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Processing.Report.Log || cfg.Processing.Report.Path != "" {
+		rc := cfg.Processing.Report
+		if s.reporter, err = report.NewReporter(report.Options{Log: rc.Log, Path: rc.Path, MaxSizeMB: rc.MaxSizeMB, MaxBackups: rc.MaxBackups}); err != nil {
+			return nil, err
+		}
+	}
+
+	s.startup.Enter(health.PhaseWarmingHTTPPool)
+	for _, p := range s.pipelines {
+		if err := p.newOutput(s.metrics, s.pause); err != nil {
+			return nil, err
+		}
+		if s.coordinator != nil {
+			p.pool.SetClaimReleaser(s.coordinator)
+		}
+		if s.audit != nil {
+			p.pool.SetAuditLog(s.audit)
+		}
+		if s.reporter != nil {
+			p.pool.SetReporter(s.reporter)
+		}
+		if cfg.LeaderElection.Enabled {
+			p.pool.Suspend() // Until this replica leads (see handoff)
+		}
+		p.sender.Start()
+		p.pool.Start()
+	}
+
+	s.registerHealth()
+	s.registerAdmin()
+	if s.health != nil {
+		s.health.SetReady(true, "")
+	} else {
+		s.startup.Enter(health.PhaseRunning)
+	}
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		logger.Warn("Failed to notify systemd of readiness", "error", err)
+	}
+	logger.Info("Streamer started", "pipelines", len(s.pipelines))
+	return s, nil
+}
+
+// annotateShards records the shards this pod owns in annotations on the pod, so the
+// assignment can be seen with kubectl
+func (s *streamer) annotateShards() error {
+	client, err := kube.InCluster(s.cfg.Kubernetes.Namespace)
+	if err != nil {
+		return err
+	}
+	s.annotator = kube.NewPodAnnotator(client, s.cfg.Kubernetes.PodName)
+	s.annotator.Start()
+	s.coordinator.SetAssignmentObserver(func(a shard.Assignment) {
+		s.annotator.Set(map[string]string{
+			shardsAnnotation:     a.Ranges(),
+			shardCountAnnotation: fmt.Sprintf("%d/%d", len(a.Owned), a.Shards),
+		})
+	})
+	return nil
+}
+
+// initMetrics starts the configured metrics exporters. Without any, metrics are still
+// recorded so the admin status and saturation gauges work.
+func initMetrics(ctx context.Context, cfg *config.Config, tlsConfig *tls.Config, version string) (*metrics.Metrics, error) {
+	otlp, prometheus := cfg.MetricsExporters()
+	exporters := metrics.Exporters{
+		OTLP:             otlp,
+		Prometheus:       prometheus,
+		OTLPProtocol:     cfg.OTLP.Protocol,
+		OTLPHeaders:      cfg.OTLP.Headers,
+		OTLPTLS:          tlsConfig,
+		OTLPTemporality:  cfg.OTLP.Temporality,
+		HistogramBuckets: cfg.OTLP.HistogramBuckets,
+		Exemplars:        cfg.OTLP.Exemplars,
+	}
+	if cw := cfg.Metrics.CloudWatch; cw.Enabled {
+		awsCfg, err := credentials.AWSConfig(ctx, cw.Region, cfg.AWS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS credentials for CloudWatch: %w", err)
+		}
+		exporters.CloudWatch = &metrics.CloudWatchOptions{
+			Namespace:   cw.Namespace,
+			Region:      cw.Region,
+			Credentials: awsCfg.Credentials,
+			Interval:    cw.Interval,
+			Dimensions:  cw.Dimensions,
+		}
+	}
+	if sd := cfg.Metrics.StatsD; sd.Enabled {
+		exporters.StatsD = &metrics.StatsDOptions{
+			Address:  sd.Address,
+			Prefix:   sd.Prefix,
+			Tags:     sd.Tags,
+			Plain:    sd.Flavor == "statsd",
+			Interval: sd.Interval,
+		}
+	}
+
+	m, err := metrics.InitMetricsWithExporters(ctx, exporters, cfg.OTLP.Endpoint, cfg.OTLP.ServiceName, version, cfg.OTLP.ExportInterval, cfg.OTLP.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize metrics: %w", err)
+	}
+	m.SetMaxDimensionValues(cfg.Metrics.MaxDimensionValues)
+	return m, nil
+}
+
+// servePrometheus serves the metrics for scraping on their own address, or on the health server
+func (s *streamer) servePrometheus() {
+	if _, enabled := s.cfg.MetricsExporters(); !enabled {
+		return
+	}
+	path := s.cfg.Metrics.PrometheusPath
+	switch {
+	case s.cfg.Metrics.PrometheusAddress != "":
+		s.prometheus = s.metrics.NewPrometheusServer(s.cfg.Metrics.PrometheusAddress, path)
+		go func() {
+			if err := s.prometheus.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logging.Component("metrics").Error("Prometheus metrics server failed", "error", err)
+			}
+		}()
+	case s.health != nil:
+		s.health.Handle(path, s.metrics.PrometheusHandler())
+	default:
+		logging.Component("metrics").Warn("Prometheus metrics are not served: set metrics.prometheus_address or enable the health server")
+	}
+}
+
+// instrumentState records the state persistence metrics and runs the compaction and the
+// S3 snapshots (snapshot may be nil) of a pipeline until shutdown
+func (s *streamer) instrumentState(p *pipeline, snapshot *state.S3Snapshot) {
+	ctx := context.Background()
+	backend := ""
+	if inst, ok := p.state.(state.Instrumented); ok {
+		backend = inst.Status().Backend
+		inst.SetSaveObserver(func(backend string, d time.Duration, err error) {
+			s.metrics.RecordStateSave(ctx, backend, d, err)
+		})
+		s.goBackground(func() {
+			state.ReportStatus(inst, stateStatusInterval, s.stop, func(st state.Status) {
+				now := time.Now()
+				s.metrics.UpdateStateStatus(ctx, st.Backend, st.CheckpointAge(now), st.DirtyFor(now))
+			})
+		})
+	}
+	if c, ok := p.state.(state.Compactor); ok {
+		s.goBackground(func() {
+			state.RunCompaction(c, p.cfg.State.Retention, p.cfg.State.CompactionInterval, s.stop, func(r state.CompactionResult) {
+				s.metrics.RecordStateCompaction(ctx, backend, r.Removed, r.Size, r.Duration)
+			})
+		})
+	}
+	if snapshot != nil {
+		if snapshotter, ok := p.state.(state.Snapshotter); ok {
+			s.goBackground(func() {
+				state.RunSnapshots(snapshotter, snapshot, p.cfg.State.Snapshot.Interval, s.stop)
+			})
+		}
+	}
+}
+
+// goBackground runs fn until shutdown, which waits for it
+func (s *streamer) goBackground(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer crash.Recover()
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// registerHealth adds the dependency and pipeline checks to the health server
+func (s *streamer) registerHealth() {
+	if s.health == nil {
+		return
+	}
+	cfg := s.cfg
+	s.health.AddChecker(health.NewCredentialsHealthChecker(cfg.Health.CredentialExpiry, s.clients.Credentials()...))
+
+	var endpoints []string
+	seen := make(map[string]bool)
+	for _, p := range s.pipelines {
+		if !seen[p.cfg.S3.Bucket] {
+			seen[p.cfg.S3.Bucket] = true
+			s.health.AddChecker(health.NewS3HealthChecker(p.client, p.cfg.S3.Bucket))
+		}
+		for _, endpoint := range p.cfg.HTTP.Endpoints {
+			if !seen[endpoint] {
+				seen[endpoint] = true
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+
+		checker := health.NewPipelineHealthChecker(cfg.Health, p.pool.HealthStats())
+		checker.Start()
+		p.checker = checker
+		s.health.AddChecker(checker)
+		s.health.AddReadinessChecker(health.NewReadinessChecker(cfg.Health, p.pool.ReadinessStats()))
+	}
+	s.health.AddChecker(health.NewHTTPEndpointsHealthChecker(endpoints))
+	if cfg.UsesRedis() {
+		s.health.AddChecker(health.NewRedisHealthChecker(cfg.State.Redis))
+	}
+}
+
+// registerAdmin mounts the admin API on the health server when an admin token is set. Its
+// state and status endpoints use the first pipeline; replays go to every pipeline.
+func (s *streamer) registerAdmin() {
+	if s.health == nil || s.cfg.Health.AdminToken == "" {
+		return
+	}
+	first := s.pipelines[0]
+	scanners := make([]*scanner.Scanner, 0, len(s.pipelines))
+	for _, p := range s.pipelines {
+		scanners = append(scanners, p.scanner)
+	}
+
+	api := admin.NewAPI(s.cfg.Health.AdminToken, first.state)
+	api.SetPauseGate(s.pause)
+	api.SetScanTrigger(s.trigger)
+	api.SetReplayer(scanner.NewReplayer(s.submit, scanners...))
+	if s.audit != nil {
+		api.SetAuditLog(s.audit)
+	}
+	api.SetStartup(s.startup)
+	api.SetStatusSources(first.pool, first.sender, s.version)
+	api.Register(s.health)
+	if s.cfg.Health.Debug {
+		api.RegisterDebug(s.health)
+	}
+}
+
+// submit hands a replayed file to the pipeline whose scanner found it
+func (s *streamer) submit(job scanner.FileJob) bool {
+	for _, p := range s.pipelines {
+		if p.scanner.StreamID() == job.StreamID {
+			return p.pool.Submit(job)
+		}
+	}
+	return false
+}
+
+// run scans until ctx is done. With leader election, only while this replica leads.
+func (s *streamer) run(ctx context.Context) error {
+	if err := s.newElector(); err != nil {
+		return err
+	}
+	s.keepAlive()
+
+	if s.elector == nil {
+		s.lead(ctx)
+		return nil
+	}
+	logging.Component("leader").Info("Waiting for leadership", "identity", s.cfg.LeaderElection.Identity)
+	return s.elector.Run(ctx, s.handoff(s.lead))
+}
+
+// runOnce catches up once and returns, for scheduled runs (run --once). With leader election
+// it waits for leadership, then steps down after catching up.
+func (s *streamer) runOnce(ctx context.Context) error {
+	if err := s.newElector(); err != nil {
+		return err
+	}
+	s.keepAlive()
+
+	if s.elector == nil {
+		return s.catchUp(ctx)
+	}
+	campaign, cancel := context.WithCancel(ctx)
+	defer cancel()
+	err := errInterrupted // Until leadership is acquired
+	catchUp := s.handoff(func(lead context.Context) {
+		if err = s.catchUp(lead); err == errInterrupted && ctx.Err() == nil {
+			err = errors.New("lost leadership before catching up")
+		}
+	})
+	logging.Component("leader").Info("Waiting for leadership", "identity", s.cfg.LeaderElection.Identity)
+	runErr := s.elector.Run(campaign, func(lead context.Context) {
+		catchUp(lead)
+		cancel()
+	})
+	if runErr != nil {
+		return fmt.Errorf("leader election failed: %w", runErr)
+	}
+	return err
+}
+
+// newElector creates the leader elector when leader election is enabled
+func (s *streamer) newElector() error {
+	if !s.cfg.LeaderElection.Enabled {
+		return nil
+	}
+	var err error
+	s.elector, err = leader.New(s.cfg.LeaderElection, s.cfg.State.Redis, s.cfg.Kubernetes)
+	return err
+}
+
+// handoff wraps lead so it resumes from, and saves to, the state every pipeline shares with
+// the other replicas. The pools process files only while this replica leads: once the lease
+// is lost they are suspended, before the states stop saving, leaving their files to the new
+// leader.
+func (s *streamer) handoff(lead func(ctx context.Context)) func(ctx context.Context) {
+	process := func(ctx context.Context) {
+		for _, p := range s.pipelines {
+			p.pool.Resume()
+		}
+		lead(ctx)
+		if !s.elector.IsLeader() {
+			for _, p := range s.pipelines {
+				p.stepDown()
+			}
+		}
+	}
+	for _, p := range s.pipelines {
+		process = s.elector.Handoff(p.state, process)
+	}
+	return process
+}
+
+// keepAlive sends systemd watchdog keep-alives (WatchdogSec=) while the scan loop beats, so a
+// hung scan loop gets the service restarted. A standby replica does not scan, so only the
+// leader's loop is watched. The sender's heartbeat is not: it stalls while the endpoints are
+// down, which a restart does not fix.
+func (s *streamer) keepAlive() {
+	interval := systemd.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	// A loop beats at least once per scan interval plus the duration of a scan
+	stale := s.cfg.Processing.ScanInterval + interval
+	since := time.Now() // Start of the current leadership
+	leading := true
+	keepAlive := systemd.NewKeepAlive(interval, func(now time.Time) error {
+		if s.elector != nil {
+			if !s.elector.IsLeader() {
+				leading = false
+				return nil
+			}
+			if !leading {
+				leading, since = true, now
+			}
+		}
+		last := s.metrics.LastHeartbeat("scanner")
+		if last.Before(since) {
+			last = since
+		}
+		if age := now.Sub(last); age > stale {
+			return fmt.Errorf("no scanner heartbeat for %s", age.Round(time.Second))
+		}
+		return nil
+	})
+	logging.Component("systemd").Info("Sending watchdog keep-alives", "watchdog", interval, "stale_after", stale)
+	s.goBackground(func() { keepAlive.Run(s.stop) })
+}
+
+// lead runs the scan loop: every scan_interval, and whenever the admin API asks for a scan
+func (s *streamer) lead(ctx context.Context) {
+	s.recoverInFlight()
+
+	ticker := time.NewTicker(s.cfg.Processing.ScanInterval)
+	defer ticker.Stop()
+
+	s.scan(ctx, scanner.ScanRequest{})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scan(ctx, scanner.ScanRequest{})
+		case req := <-s.trigger.C():
+			s.scan(ctx, req)
+		}
+	}
+}
+
+// catchUp scans and waits for the submitted files until a scan finds nothing new, so every
+// file up to the delay window has been processed. Files that fail are left to their retries
+// on a later run.
+func (s *streamer) catchUp(ctx context.Context) error {
+	s.recoverInFlight()
+	for {
+		submitted, err := s.scan(ctx, scanner.ScanRequest{})
+		if err != nil {
+			return err
+		}
+		for _, p := range s.pipelines {
+			for !p.pool.WaitForIdle(idlePollInterval) {
+				if ctx.Err() != nil {
+					return errInterrupted
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		if submitted == 0 {
+			break
+		}
+	}
+
+	var files, bytes, failed int64
+	for _, p := range s.pipelines {
+		f, b, e := p.pool.GetMetrics()
+		files, bytes, failed = files+f, bytes+b, failed+e
+	}
+	logging.GetDefaultLogger().Info("Caught up", "files", files, "bytes", bytes, "failed", failed)
+	return nil
+}
+
+// recoverInFlight re-enqueues the files a previous run or leader left in flight. It runs on
+// every lead: a replica that stepped down dropped its own files, so it recovers them from the
+// journal like any new leader.
+func (s *streamer) recoverInFlight() {
+	for _, p := range s.pipelines {
+		p.recoverInFlight()
+	}
+}
+
+// scan scans every pipeline once, updates the processing lag and returns how many files it
+// submitted. Failed pipelines are logged and their errors returned together.
+func (s *streamer) scan(ctx context.Context, req scanner.ScanRequest) (int, error) {
+	logger := logging.Component("scanner")
+	s.metrics.RecordHeartbeat(ctx, "scanner")
+
+	submitted := 0
+	var errs []error
+	for _, p := range s.pipelines {
+		var n int
+		var err error
+		if req.Ranged() {
+			n, err = p.scanRange(ctx, req)
+		} else {
+			n, err = p.scan(ctx, s.coordinator)
+		}
+		submitted += n
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Scan failed", "pipeline", p.label(), "error", err)
+			errs = append(errs, fmt.Errorf("pipeline %s: %w", p.label(), err))
+		}
+	}
+
+	now := time.Now()
+	var lag time.Duration
+	for _, p := range s.pipelines {
+		if l, ok := p.lag(now); ok {
+			lag = max(lag, l)
+		}
+	}
+	s.metrics.UpdateProcessingLag(ctx, lag.Seconds())
+	return submitted, errors.Join(errs...)
+}
+
+// reload applies a changed configuration to the pipelines
+func (s *streamer) reload(next *config.Config) {
+	resolved := make(map[string]config.Config)
+	for _, r := range next.ResolvePipelines() {
+		resolved[r.Name] = r.Config
+	}
+	for _, p := range s.pipelines {
+		cfg, ok := resolved[p.name]
+		if !ok {
+			logging.Component("config").Warn("Pipeline removed from the configuration; restart to stop it", "pipeline", p.label())
+			continue
+		}
+		p.reloader.Apply(&cfg)
+	}
+}
+
+// stateSnapshot returns the state of every pipeline, for crash reports
+func (s *streamer) stateSnapshot() any {
+	states := make(map[string]state.State, len(s.pipelines))
+	for _, p := range s.pipelines {
+		if snapshotter, ok := p.state.(state.Snapshotter); ok {
+			states[p.label()] = snapshotter.Snapshot()
+		}
+	}
+	return states
+}
+
+// shutdown stops the pipelines, saving their state and delivering the lines already read,
+// then the shared services
+func (s *streamer) shutdown() {
+	logger := logging.GetDefaultLogger()
+	logger.Info("Shutting down")
+	systemd.Notify(systemd.Stopping)
+	if s.health != nil {
+		s.health.SetReady(false, "Shutting down")
+	}
+
+	for _, p := range s.pipelines {
+		if p.pool != nil {
+			p.pool.Stop()
+		}
+		if p.sender != nil {
+			p.sender.Stop()
+		}
+		if p.checker != nil {
+			p.checker.Stop()
+		}
+		if p.state != nil {
+			p.state.Stop()
+		}
+	}
+	close(s.stop)
+	s.background.Wait()
+	if s.coordinator != nil {
+		s.coordinator.Stop()
+	}
+	if s.annotator != nil {
+		s.annotator.Stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if s.prometheus != nil {
+		s.prometheus.Shutdown(ctx)
+	}
+	if s.metrics != nil {
+		if err := s.metrics.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			logger.Warn("Failed to flush metrics", "error", err)
+		}
+	}
+	if s.health != nil {
+		s.health.Stop(ctx)
+	}
+	if s.audit != nil {
+		s.audit.Close()
+	}
+	if s.reporter != nil {
+		s.reporter.Close()
+	}
+	if s.crash != nil {
+		s.crash.Uninstall()
+	}
+	logger.Info("Shutdown complete")
+	logger.Close()
+}
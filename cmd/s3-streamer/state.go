@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// runState inspects, exports and imports the state in whichever backend the configuration
+// selects (file, Redis, SQL, Consul or etcd), or rewinds its checkpoint.
+//
+// Exports use the state file format, so they can be imported into a different backend.
+// Stop the streamer before importing or rewinding: a running instance either refuses to
+// save afterwards (file, Redis) or overwrites the change (other backends). Use the admin
+// API (POST /api/state/rewind) to rewind a running streamer.
+func runState(g *globals, args []string) error {
+	if len(args) == 0 {
+		return errors.New("state needs a subcommand (show, export, import or rewind)")
+	}
+	var run func(g *globals, flags *flag.FlagSet, pipeline *string, args []string) error
+	var usage string
+	switch args[0] {
+	case "show":
+		run, usage = runShow, "[--recent 20]"
+	case "export":
+		run, usage = runExport, "[--output state.json]"
+	case "import":
+		run, usage = runImport, "[--input state.json]"
+	case "rewind":
+		run, usage = runRewind, "--to <time> [--stream id] [--yes]"
+	default:
+		return fmt.Errorf("unknown state subcommand %q (expected show, export, import or rewind)", args[0])
+	}
+
+	flags := g.flags("state "+args[0], "[--pipeline name] "+usage)
+	pipeline := flags.String("pipeline", "", "Pipeline whose state to use (required when several are configured)")
+	return run(g, flags, pipeline, args[1:])
+}
+
+// openPipelineState opens the state of the chosen pipeline
+func openPipelineState(g *globals, pipeline string) (state.StateManager, string, error) {
+	cfg, err := g.load()
+	if err != nil {
+		return nil, "", err
+	}
+	stateConfig, err := selectPipeline(cfg, pipeline)
+	if err != nil {
+		return nil, "", err
+	}
+	return openState(stateConfig)
+}
+
+// selectPipeline returns the (namespaced) state configuration of the chosen pipeline
+func selectPipeline(cfg *config.Config, name string) (config.StateConfig, error) {
+	p, err := choosePipeline(cfg, name)
+	if err != nil {
+		return config.StateConfig{}, err
+	}
+	return p.Config.State, nil
+}
+
+// choosePipeline returns the pipeline named name, or the only one when name is empty
+func choosePipeline(cfg *config.Config, name string) (config.ResolvedPipeline, error) {
+	pipelines := cfg.ResolvePipelines()
+	if name == "" && len(pipelines) == 1 {
+		return pipelines[0], nil
+	}
+
+	var names []string
+	for _, p := range pipelines {
+		if p.Name == name {
+			return p, nil
+		}
+		names = append(names, p.Name)
+	}
+	if name == "" {
+		return config.ResolvedPipeline{}, fmt.Errorf("several pipelines are configured, choose one with --pipeline (%s)", strings.Join(names, ", "))
+	}
+	return config.ResolvedPipeline{}, fmt.Errorf("unknown pipeline %q (configured: %s)", name, strings.Join(names, ", "))
+}
+
+// openState opens the configured backend without the Redis-to-file fallback the streamer uses,
+// so an unreachable backend is reported instead of silently inspecting the state file
+func openState(cfg config.StateConfig) (state.StateManager, string, error) {
+	var manager state.StateManager
+	var err error
+	backend := "file " + cfg.FilePath
+	switch {
+	case cfg.SQL.Enabled:
+		backend = "sql " + cfg.SQL.Driver + " table " + cfg.SQL.Table
+		manager, err = state.NewSQLStateManager(cfg.SQL, cfg.SaveInterval)
+	case cfg.KV.Enabled:
+		backend = cfg.KV.Backend + " key " + cfg.KV.Key
+		manager, err = state.NewKVStateManager(cfg.KV, cfg.SaveInterval)
+	case cfg.Redis.Enabled:
+		backend = fmt.Sprintf("redis %s:%d prefix %s", cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.KeyPrefix)
+		manager, err = state.NewRedisStateManager(cfg.Redis, cfg.SaveInterval)
+	default:
+		manager, err = state.NewManager(cfg.FilePath, cfg.SaveInterval)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return manager, backend, nil
+}
+
+func snapshotter(manager state.StateManager) (state.Snapshotter, error) {
+	s, ok := manager.(state.Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("state backend %T does not support export", manager)
+	}
+	return s, nil
+}
+
+func runShow(g *globals, flags *flag.FlagSet, pipeline *string, args []string) error {
+	recent := flags.Int("recent", 20, "Number of recent file records to list (per-file backends only)")
+	flags.Parse(args)
+
+	manager, backend, err := openPipelineState(g, *pipeline)
+	if err != nil {
+		return err
+	}
+	s, err := snapshotter(manager)
+	if err != nil {
+		return err
+	}
+	snapshot := s.Snapshot()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Backend:\t%s\n", backend)
+	fmt.Fprintf(w, "Last processed:\t%s\n", formatTimestamp(snapshot.LastProcessedTimestamp))
+	fmt.Fprintf(w, "Last file:\t%s\n", snapshot.LastProcessedFile)
+	fmt.Fprintf(w, "Files processed:\t%d\n", snapshot.TotalFilesProcessed)
+	fmt.Fprintf(w, "Bytes processed:\t%d\n", snapshot.TotalBytesProcessed)
+	fmt.Fprintf(w, "Last updated:\t%s\n", formatTimestamp(snapshot.LastUpdated))
+	w.Flush()
+
+	if len(snapshot.Streams) > 0 {
+		fmt.Println("\nStreams:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  STREAM\tCHECKPOINT\tLAST FILE")
+		for _, id := range sortedKeys(snapshot.Streams) {
+			cp := snapshot.Streams[id]
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", id, formatTimestamp(cp.Timestamp), cp.LastFile)
+		}
+		w.Flush()
+	}
+
+	if tracker, ok := manager.(state.RetryTracker); ok {
+		files, err := state.Quarantined(tracker)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			fmt.Println("\nQuarantined files (requeue or dismiss via /api/quarantine):")
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  S3 KEY\tATTEMPTS\tFIRST FAILURE\tLAST FAILURE\tERROR")
+			for _, f := range files {
+				fmt.Fprintf(w, "  %s\t%d\t%s\t%s\t%s\n", f.Key, f.Attempts, formatTimestamp(f.FirstFailure), formatTimestamp(f.LastFailure), f.LastError)
+			}
+			w.Flush()
+		}
+	}
+
+	if journal, ok := manager.(state.Journal); ok {
+		jobs, err := journal.InFlight()
+		if err != nil {
+			return err
+		}
+		if len(jobs) > 0 {
+			fmt.Println("\nIn-flight files (re-enqueued on start):")
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  S3 KEY\tSTREAM\tTIMESTAMP\tSTARTED")
+			for _, job := range jobs {
+				started := formatTimestamp(job.StartedAt)
+				if job.Pending {
+					started = "pending since " + started
+				}
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", job.Key, job.StreamID, formatTimestamp(job.Timestamp), started)
+			}
+			w.Flush()
+		}
+	}
+
+	var partial []string
+	for _, key := range sortedKeys(snapshot.Offsets) {
+		if snapshot.Offsets[key].Sent > 0 {
+			partial = append(partial, key)
+		}
+	}
+	if len(partial) > 0 {
+		fmt.Println("\nPartially delivered files:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  S3 KEY\tLINES\tSENT\tBYTES")
+		for _, key := range partial {
+			offset := snapshot.Offsets[key]
+			fmt.Fprintf(w, "  %s\t%d\t%d\t%d\n", key, offset.Lines, offset.Sent, offset.Bytes)
+		}
+		w.Flush()
+	}
+
+	if lister, ok := manager.(state.FileLister); ok && *recent > 0 {
+		records, err := lister.RecentFiles(*recent)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\nRecent files:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  S3 KEY\tSTATUS\tATTEMPTS\tBYTES\tUPDATED")
+		for _, rec := range records {
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%s\n", rec.Key, rec.Status, rec.Attempts, rec.Bytes, formatTimestamp(rec.UpdatedAt))
+		}
+		w.Flush()
+	}
+	return nil
+}
+
+func runExport(g *globals, flags *flag.FlagSet, pipeline *string, args []string) error {
+	output := flags.String("output", "-", "File to write (- for stdout)")
+	flags.Parse(args)
+
+	manager, _, err := openPipelineState(g, *pipeline)
+	if err != nil {
+		return err
+	}
+	s, err := snapshotter(manager)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s.Snapshot(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	data = append(data, '\n')
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0644)
+}
+
+func runImport(g *globals, flags *flag.FlagSet, pipeline *string, args []string) error {
+	input := flags.String("input", "-", "File to read (- for stdin)")
+	flags.Parse(args)
+
+	var data []byte
+	var err error
+	if *input == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*input)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var imported state.State
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	manager, backend, err := openPipelineState(g, *pipeline)
+	if err != nil {
+		return err
+	}
+	s, err := snapshotter(manager)
+	if err != nil {
+		return err
+	}
+	if err := s.Restore(imported); err != nil {
+		return err
+	}
+	if err := manager.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported state into %s: checkpoint %s, %d streams, %d partially delivered files\n",
+		backend, formatTimestamp(imported.LastProcessedTimestamp), len(imported.Streams), len(imported.Offsets))
+	return nil
+}
+
+func runRewind(g *globals, flags *flag.FlagSet, pipeline *string, args []string) error {
+	to := flags.String("to", "", "New checkpoint (Unix seconds or RFC 3339); later files are processed again")
+	stream := flags.String("stream", "", "Stream to rewind (default: the global position and every stream)")
+	reason := flags.String("reason", "", "Reason recorded with the rewind")
+	by := flags.String("by", defaultOperator(), "Operator recorded with the rewind")
+	yes := flags.Bool("yes", false, "Apply the rewind (otherwise only the estimate is printed)")
+	flags.Parse(args)
+
+	if *to == "" {
+		return fmt.Errorf("--to is required")
+	}
+	target, err := state.ParseRewindTarget(*to)
+	if err != nil {
+		return err
+	}
+
+	manager, backend, err := openPipelineState(g, *pipeline)
+	if err != nil {
+		return err
+	}
+	rewinder, ok := manager.(state.Rewinder)
+	if !ok {
+		return fmt.Errorf("state backend %T does not support rewinds", manager)
+	}
+
+	estimate, err := rewinder.EstimateRewind(*stream, target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rewinding %s from %s to %s\n", backend, formatTimestamp(estimate.From), formatTimestamp(estimate.To))
+	fmt.Printf("Warning: %s\n", estimate.Warning())
+	if !*yes {
+		fmt.Println("Not applied; re-run with --yes to rewind (stop the streamer first, or use the admin API)")
+		return nil
+	}
+
+	record, err := rewinder.Rewind(state.RewindRequest{To: target, StreamID: *stream, By: *by, Reason: *reason})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rewound checkpoint to %s (recorded by %s at %s)\n", formatTimestamp(record.To), record.By, formatTimestamp(record.At))
+	return nil
+}
+
+// defaultOperator identifies the person running the tool as user@host
+func defaultOperator() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "unknown"
+	}
+	if host, err := os.Hostname(); err == nil {
+		return user + "@" + host
+	}
+	return user
+}
+
+func formatTimestamp(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%d)", time.Unix(ts, 0).UTC().Format(time.RFC3339), ts)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/credentials"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/health"
+)
+
+// runValidate loads the configuration as run does (environment variable references,
+// S3_STREAMER_ overrides, unknown-field detection, defaults and validation), reports every
+// problem and lists the configured log formats
+func runValidate(g *globals, args []string) error {
+	flags := g.flags("validate", "")
+	flags.Parse(args)
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: OK\n", g.configPath)
+	printFormats(cfg)
+	return nil
+}
+
+// runCheck validates the configuration, then runs the pre-flight checks and prints a
+// pass/fail table. It fails if any check fails, so it can gate a deployment.
+func runCheck(g *globals, args []string) error {
+	flags := g.flags("check", "")
+	flags.Parse(args)
+
+	cfg, err := g.load()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: OK\n", g.configPath)
+
+	ctx := context.Background()
+	clients, err := credentials.NewS3Clients(ctx, cfg.ResolvePipelines())
+	if err != nil {
+		return err
+	}
+	results := health.Preflight(ctx, cfg, clients.For)
+	fmt.Println()
+	if !health.WritePreflight(os.Stdout, results) {
+		return errors.New("pre-flight checks failed")
+	}
+	return nil
+}
+
+// printFormats lists the custom log formats and the default format
+func printFormats(cfg *config.Config) {
+	if len(cfg.Processing.LogFormats) == 0 {
+		fmt.Printf("Default format: %s\n", cfg.Processing.DefaultFormat)
+		return
+	}
+
+	fmt.Printf("\nLog formats:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  NAME\tFILENAME PATTERN\tTIMESTAMP FORMAT\tCONTENT TYPE\tSKIP HEADERS")
+	for _, format := range cfg.Processing.LogFormats {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%d\n", format.Name, format.FilenamePattern, format.TimestampFormat, format.ContentType, format.SkipHeaderLines)
+	}
+	w.Flush()
+	fmt.Printf("\nDefault format: %s\n", cfg.Processing.DefaultFormat)
+}
+
+func runSchema(g *globals, args []string) error {
+	flags := g.flags("schema", "[--output config.schema.json]")
+	output := flags.String("output", "-", "File to write (- for stdout)")
+	flags.Parse(args)
+
+	schema, err := config.JSONSchema()
+	if err != nil {
+		return err
+	}
+	schema = append(schema, '\n')
+	if *output == "-" {
+		_, err = os.Stdout.Write(schema)
+		return err
+	}
+	return os.WriteFile(*output, schema, 0o644)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo"
+)
+
+// buildVersion returns the version the binary was built as, or "dev" for builds from a
+// source tree
+func buildVersion() string {
+	return buildinfo.Get().Version
+}
+
+func runVersion(g *globals, args []string) error {
+	flags := g.flags("version", "")
+	flags.Parse(args)
+	printVersion()
+	return nil
+}
+
+// printVersion prints the build of the binary (version and --version)
+func printVersion() {
+	info := buildinfo.Get()
+	fmt.Printf("s3-streamer %s\n", info.Version)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = " (modified)"
+		}
+		fmt.Printf("  commit:   %s%s\n", info.Commit, modified)
+	}
+	if info.Date != "" {
+		fmt.Printf("  built:    %s\n", info.Date)
+	}
+	fmt.Printf("  go:       %s %s\n", info.GoVersion, info.Platform)
+}
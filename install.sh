@@ -90,11 +90,14 @@ check_prerequisites() {
     fi
 
     # Check required tools
-    for cmd in openssl systemctl aws; do
+    for cmd in systemctl aws; do
         if ! command -v "$cmd" &>/dev/null; then
             error "'$cmd' command not found"
         fi
     done
+    if [[ ! -x "$SCRIPT_DIR/s3-streamer" ]]; then
+        error "s3-streamer not found in $SCRIPT_DIR"
+    fi
     success "Required tools available"
 
     # Check for existing installation
@@ -256,13 +259,9 @@ interactive_configuration() {
 # Decrypt existing credential (helper for reinstallation)
 decrypt_existing_credential() {
     local name=$1
-    local machine_id=$(cat /etc/machine-id)
-    local salt="s3-edgedelta-streamer-v1"
-    local enc_key=$(echo -n "${machine_id}${salt}" | sha256sum | cut -d' ' -f1)
 
-    openssl enc -aes-256-cbc -d -pbkdf2 \
-        -pass pass:"$enc_key" \
-        -in "$CREDS_DIR/$name" 2>/dev/null || echo ""
+    # Reads both the current format and files written by earlier (openssl-based) installers
+    "$SCRIPT_DIR/s3-streamer" creds decrypt --dir "$CREDS_DIR" "$name" 2>/dev/null || echo ""
 }
 
 # Encrypt credentials
@@ -274,33 +273,19 @@ encrypt_credentials() {
     mkdir -p "$CREDS_DIR"
     chmod 700 "$CREDS_DIR"
 
-    # Generate machine-specific encryption key
-    local machine_id=$(cat /etc/machine-id)
-    local salt="s3-edgedelta-streamer-v1"
-    local enc_key=$(echo -n "${machine_id}${salt}" | sha256sum | cut -d' ' -f1)
-
-    # Encrypt each credential
+    # Encrypt each credential with the machine-specific key (AES-256-GCM)
     encrypt_value() {
         local name=$1
         local value=$2
-        local outfile="${CREDS_DIR}/${name}"
 
-        echo -n "$value" | openssl enc -aes-256-cbc -salt -pbkdf2 \
-            -pass pass:"$enc_key" -out "$outfile" 2>/dev/null
-
-        if [[ $? -eq 0 ]]; then
-            chmod 600 "$outfile"
-            return 0
-        else
-            return 1
-        fi
+        printf '%s' "$value" | "$SCRIPT_DIR/s3-streamer" creds encrypt --dir "$CREDS_DIR" "$name"
     }
 
     encrypt_value "aws_access_key_id" "$AWS_KEY" || error "Failed to encrypt access key"
     encrypt_value "aws_secret_access_key" "$AWS_SECRET" || error "Failed to encrypt secret key"
     encrypt_value "aws_region" "$AWS_REGION" || error "Failed to encrypt region"
 
-    success "Credentials encrypted (machine-specific AES-256)"
+    success "Credentials encrypted (machine-specific AES-256-GCM)"
 }
 
 # Install files
@@ -309,25 +294,17 @@ install_files() {
     info "Installing files..."
 
     # Stop any running instances
-    pkill -f s3-edgedelta-streamer-http || true
+    pkill -f "$INSTALL_DIR/bin/s3-streamer" || true
     pkill -f s3-edgedelta-streamer || true
 
     # Create directories
     mkdir -p "$INSTALL_DIR"/{bin,config,logs}
     mkdir -p "$STATE_DIR"
 
-    # Find and copy binary
-    BINARY_NAME=""
-    if [[ -f "$SCRIPT_DIR/s3-edgedelta-streamer-http" ]]; then
-        BINARY_NAME="s3-edgedelta-streamer-http"
-    elif [[ -f "$SCRIPT_DIR/s3-edgedelta-streamer" ]]; then
-        BINARY_NAME="s3-edgedelta-streamer"
-    else
-        error "Binary not found in current directory (s3-edgedelta-streamer-http or s3-edgedelta-streamer)"
-    fi
-
-    cp "$SCRIPT_DIR/$BINARY_NAME" "$INSTALL_DIR/bin/s3-edgedelta-streamer"
-    chmod 755 "$INSTALL_DIR/bin/s3-edgedelta-streamer"
+    # Copy binary (it also runs the state, creds and validate commands)
+    cp "$SCRIPT_DIR/s3-streamer" "$INSTALL_DIR/bin/s3-streamer"
+    chmod 755 "$INSTALL_DIR/bin/s3-streamer"
+    rm -f "$INSTALL_DIR/bin/s3-edgedelta-streamer" "$INSTALL_DIR/bin/s3-streamer-config"
     success "Binary installed"
 
     # Create config.yaml
@@ -403,11 +380,12 @@ BindsTo=edgedelta.service
 PartOf=edgedelta.service
 
 [Service]
-Type=simple
+Type=notify
+WatchdogSec=120
 User=edgedelta
 Group=edgedelta
 WorkingDirectory=/opt/edgedelta/s3-streamer
-ExecStart=/opt/edgedelta/s3-streamer/bin/s3-edgedelta-streamer --config config/config.yaml
+ExecStart=/opt/edgedelta/s3-streamer/bin/s3-streamer --config config/config.yaml run
 EnvironmentFile=/etc/sysconfig/s3-streamer
 Restart=on-failure
 RestartSec=10
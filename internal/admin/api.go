@@ -0,0 +1,559 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/audit"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/health"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/worker"
+)
+
+// API serves the authenticated /api/ admin endpoints
+type API struct {
+	token        string
+	stateManager state.StateManager
+	audit        *audit.Log
+	pause        *scanner.PauseGate
+	scanTrigger  *scanner.ScanTrigger
+	replayer     *scanner.Replayer
+	pool         *worker.HTTPPool
+	sender       *output.HTTPSender
+	version      string
+	startup      *health.Startup
+}
+
+// Mux is where the API registers its handlers (e.g. the health server)
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// NewAPI creates the admin API. Every request must carry "Authorization: Bearer <token>".
+func NewAPI(token string, stateManager state.StateManager) *API {
+	return &API{
+		token:        token,
+		stateManager: stateManager,
+	}
+}
+
+// Register mounts the admin endpoints
+func (a *API) Register(mux Mux) {
+	mux.Handle("/api/state/rewind", a.authorize(a.handleRewind))
+	mux.Handle("/api/quarantine", a.authorize(a.handleQuarantine))
+	mux.Handle("/api/quarantine/requeue", a.authorize(a.quarantineAction("requeued", state.Requeue)))
+	mux.Handle("/api/quarantine/dismiss", a.authorize(a.quarantineAction("dismissed", state.Dismiss)))
+	mux.Handle("/api/files/recent", a.authorize(a.handleRecentFiles))
+	mux.Handle("/api/pause", a.authorize(a.handlePause))
+	mux.Handle("/api/resume", a.authorize(a.handleResume))
+	mux.Handle("/api/scan-now", a.authorize(a.handleScanNow))
+	mux.Handle("/api/replay", a.authorize(a.handleReplay))
+	mux.Handle("/status", a.authorize(a.handleStatus))
+	mux.Handle("/api/loglevel", a.authorize(a.handleLogLevel))
+}
+
+// SetPauseGate lets /api/pause and /api/resume pause scanning. Call before Register.
+func (a *API) SetPauseGate(gate *scanner.PauseGate) {
+	a.pause = gate
+}
+
+// SetScanTrigger lets /api/scan-now queue out-of-cycle scans. Call before Register.
+func (a *API) SetScanTrigger(trigger *scanner.ScanTrigger) {
+	a.scanTrigger = trigger
+}
+
+// SetReplayer lets /api/replay enqueue files regardless of the checkpoint. Call before Register.
+func (a *API) SetReplayer(replayer *scanner.Replayer) {
+	a.replayer = replayer
+}
+
+// SetAuditLog serves log at /api/files/recent. Call before Register.
+func (a *API) SetAuditLog(log *audit.Log) {
+	a.audit = log
+}
+
+// authorize rejects requests without the admin bearer token
+func (a *API) authorize(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RewindRequest is the body of POST /api/state/rewind
+type RewindRequest struct {
+	To       string `json:"to"`        // Unix seconds or RFC 3339
+	StreamID string `json:"stream_id"` // Stream to rewind (empty for all streams)
+	By       string `json:"by"`        // Operator (default: the client address)
+	Reason   string `json:"reason"`
+	Confirm  bool   `json:"confirm"` // Apply the rewind; otherwise only the estimate is returned
+}
+
+// RewindResponse reports the estimate and, once confirmed, the applied rewind
+type RewindResponse struct {
+	Estimate state.RewindEstimate `json:"estimate"`
+	Warning  string               `json:"warning"`
+	Applied  bool                 `json:"applied"`
+	Rewind   *state.RewindRecord  `json:"rewind,omitempty"`
+}
+
+func (a *API) handleRewind(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	rewinder, ok := a.stateManager.(state.Rewinder)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "state backend does not support rewinds")
+		return
+	}
+
+	var req RewindRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	to, err := state.ParseRewindTarget(req.To)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.By == "" {
+		req.By = r.RemoteAddr
+	}
+
+	estimate, err := rewinder.EstimateRewind(req.StreamID, to)
+	if err != nil {
+		writeStateError(w, err)
+		return
+	}
+	resp := RewindResponse{Estimate: estimate, Warning: estimate.Warning()}
+	if !req.Confirm {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	record, err := rewinder.Rewind(state.RewindRequest{To: to, StreamID: req.StreamID, By: req.By, Reason: req.Reason})
+	if err != nil {
+		writeStateError(w, err)
+		return
+	}
+	resp.Applied = true
+	resp.Rewind = &record
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// QuarantineResponse is the body of GET /api/quarantine
+type QuarantineResponse struct {
+	Files []state.FailedFile `json:"files"`
+}
+
+// QuarantineActionRequest is the body of POST /api/quarantine/requeue and /api/quarantine/dismiss
+type QuarantineActionRequest struct {
+	Keys []string `json:"keys"`
+	By   string   `json:"by"` // Operator (default: the client address)
+}
+
+// QuarantineActionResponse lists the files the action applied to and the keys not in quarantine
+type QuarantineActionResponse struct {
+	Files    []state.FailedFile `json:"files"`
+	NotFound []string           `json:"not_found,omitempty"`
+}
+
+func (a *API) handleQuarantine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	tracker, ok := a.stateManager.(state.RetryTracker)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "state backend does not track failed files")
+		return
+	}
+
+	files, err := state.Quarantined(tracker)
+	if err != nil {
+		writeStateError(w, err)
+		return
+	}
+	if files == nil {
+		files = []state.FailedFile{}
+	}
+	writeJSON(w, http.StatusOK, QuarantineResponse{Files: files})
+}
+
+// quarantineAction applies a requeue or dismiss action to every requested key
+func (a *API) quarantineAction(done string, action func(state.RetryTracker, string) (state.FailedFile, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		tracker, ok := a.stateManager.(state.RetryTracker)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, "state backend does not track failed files")
+			return
+		}
+
+		var req QuarantineActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if len(req.Keys) == 0 {
+			writeError(w, http.StatusBadRequest, "keys is required")
+			return
+		}
+		if req.By == "" {
+			req.By = r.RemoteAddr
+		}
+
+		resp := QuarantineActionResponse{Files: []state.FailedFile{}}
+		for _, key := range req.Keys {
+			f, err := action(tracker, key)
+			if errors.Is(err, state.ErrNotQuarantined) {
+				resp.NotFound = append(resp.NotFound, key)
+				continue
+			}
+			if err != nil {
+				writeStateError(w, err)
+				return
+			}
+			logging.Component("admin").Warn("Quarantined file "+done,
+				"s3_key", key,
+				"processing_id", f.ProcessingID,
+				"attempts", f.Attempts,
+				"by", req.By)
+			resp.Files = append(resp.Files, f)
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// RecentFilesResponse is the body of GET /api/files/recent
+type RecentFilesResponse struct {
+	Files []audit.Record `json:"files"`
+}
+
+// defaultRecentFiles is how many files /api/files/recent returns without a limit
+const defaultRecentFiles = 100
+
+// handleRecentFiles lists recently processed files, newest first. Query parameters: key
+// (exact object key), result (delivered, failed, timed_out, interrupted) and limit.
+func (a *API) handleRecentFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	if a.audit == nil {
+		writeError(w, http.StatusNotImplemented, "the audit log is disabled")
+		return
+	}
+
+	q := audit.Query{
+		Key:    r.URL.Query().Get("key"),
+		Result: r.URL.Query().Get("result"),
+		Limit:  defaultRecentFiles,
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer (0 for all)")
+			return
+		}
+		q.Limit = limit
+	}
+	writeJSON(w, http.StatusOK, RecentFilesResponse{Files: a.audit.Recent(q)})
+}
+
+// PauseRequest is the body of POST /api/pause
+type PauseRequest struct {
+	By     string `json:"by"` // Operator (default: the client address)
+	Reason string `json:"reason"`
+}
+
+// handlePause reports the pause status (GET) or pauses scanning (POST). Files already
+// queued or buffered are still delivered.
+func (a *API) handlePause(w http.ResponseWriter, r *http.Request) {
+	if a.pause == nil {
+		writeError(w, http.StatusNotImplemented, "pausing is not supported")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, a.pause.Status())
+	case http.MethodPost:
+		var req PauseRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+				return
+			}
+		}
+		if req.By == "" {
+			req.By = r.RemoteAddr
+		}
+		if a.pause.Pause(req.By, req.Reason) {
+			logging.Component("admin").Warn("Processing paused; queued files will drain",
+				"by", req.By,
+				"reason", req.Reason)
+		}
+		writeJSON(w, http.StatusOK, a.pause.Status())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "use GET or POST")
+	}
+}
+
+func (a *API) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if a.pause == nil {
+		writeError(w, http.StatusNotImplemented, "pausing is not supported")
+		return
+	}
+	status := a.pause.Status()
+	if a.pause.Resume() {
+		logging.Component("admin").Warn("Processing resumed",
+			"paused_for", time.Since(status.Since).Round(time.Second),
+			"by", r.RemoteAddr)
+	}
+	writeJSON(w, http.StatusOK, a.pause.Status())
+}
+
+// ScanNowRequest is the body of POST /api/scan-now. Without a prefix or range the scan
+// starts from the checkpoint; otherwise the range is replayed.
+type ScanNowRequest struct {
+	Prefix string `json:"prefix"`
+	From   string `json:"from"` // Unix seconds or RFC 3339
+	To     string `json:"to"`   // Unix seconds or RFC 3339
+	By     string `json:"by"`   // Operator (default: the client address)
+}
+
+// handleScanNow queues a scan for the scan loop instead of waiting for scan_interval
+func (a *API) handleScanNow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if a.scanTrigger == nil {
+		writeError(w, http.StatusNotImplemented, "triggering scans is not supported")
+		return
+	}
+	if a.refusePaused(w) {
+		return
+	}
+
+	var req ScanNowRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	}
+	scan := scanner.ScanRequest{Prefix: strings.TrimPrefix(req.Prefix, "/"), By: req.By}
+	var err error
+	if scan.From, err = parseScanBound("from", req.From); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if scan.To, err = parseScanBound("to", req.To); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if scan.To != 0 && scan.From > scan.To {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+	if scan.By == "" {
+		scan.By = r.RemoteAddr
+	}
+
+	if !a.scanTrigger.Trigger(scan) {
+		writeError(w, http.StatusTooManyRequests, "too many scans already queued")
+		return
+	}
+	logging.Component("admin").Info("Scan triggered",
+		"by", scan.By,
+		"prefix", scan.Prefix,
+		"from", scan.From,
+		"to", scan.To)
+	writeJSON(w, http.StatusAccepted, scan)
+}
+
+// ReplayRequest is the body of POST /api/replay: either keys, or a prefix and/or from/to
+// window selected as for /api/scan-now
+type ReplayRequest struct {
+	Key    string   `json:"key"`
+	Keys   []string `json:"keys"`
+	Prefix string   `json:"prefix"`
+	From   string   `json:"from"` // Unix seconds or RFC 3339
+	To     string   `json:"to"`   // Unix seconds or RFC 3339
+	Tag    bool     `json:"tag"`  // Tag the replayed lines so downstream can tell them from the originals
+	By     string   `json:"by"`   // Operator (default: the client address)
+}
+
+// handleReplay enqueues the selected files regardless of the checkpoint
+func (a *API) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if a.replayer == nil {
+		writeError(w, http.StatusNotImplemented, "replays are not supported")
+		return
+	}
+	if a.refusePaused(w) {
+		return
+	}
+
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	replay := scanner.ReplayRequest{Keys: req.Keys, Prefix: strings.TrimPrefix(req.Prefix, "/"), Tag: req.Tag, By: req.By}
+	if req.Key != "" {
+		replay.Keys = append(replay.Keys, req.Key)
+	}
+	var err error
+	if replay.From, err = parseScanBound("from", req.From); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if replay.To, err = parseScanBound("to", req.To); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch {
+	case len(replay.Keys) > 0 && (replay.Prefix != "" || replay.From != 0 || replay.To != 0):
+		writeError(w, http.StatusBadRequest, "give either keys or a from/to window, not both")
+		return
+	case len(replay.Keys) == 0 && replay.Prefix == "" && replay.From == 0:
+		writeError(w, http.StatusBadRequest, "key, keys, prefix or from is required")
+		return
+	case replay.To != 0 && replay.From > replay.To:
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+	if replay.By == "" {
+		replay.By = r.RemoteAddr
+	}
+
+	result, err := a.replayer.Replay(r.Context(), replay)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	logging.Component("admin").Warn("Replaying files regardless of the checkpoint",
+		"by", replay.By,
+		"replay_id", result.ID,
+		"files", result.Files,
+		"rejected", result.Rejected,
+		"skipped", len(result.Skipped))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// LogLevel is the body of /api/loglevel requests and responses
+type LogLevel struct {
+	Level string `json:"level"` // debug, info, warn or error
+}
+
+// handleLogLevel reports (GET) or changes (POST) the log level without a restart
+func (a *API) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetDefaultLogger()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req LogLevel
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		previous := logger.Level()
+		if err := logger.SetLevel(req.Level); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Warn("Log level changed",
+			"from", previous,
+			"to", logger.Level(),
+			"by", r.RemoteAddr)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "use GET or POST")
+		return
+	}
+	writeJSON(w, http.StatusOK, LogLevel{Level: logger.Level()})
+}
+
+// refusePaused answers 409 and returns true while scanning is paused or shedding load
+func (a *API) refusePaused(w http.ResponseWriter) bool {
+	if a.pause == nil {
+		return false
+	}
+	switch status := a.pause.Status(); {
+	case status.Paused:
+		writeError(w, http.StatusConflict, "processing is paused")
+	case status.Shedding:
+		writeError(w, http.StatusConflict, "processing is shedding load; retry later")
+	default:
+		return false
+	}
+	return true
+}
+
+// parseScanBound parses one end of a scan range (0 if empty)
+func parseScanBound(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ts, err := state.ParseRewindTarget(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: expected Unix seconds or RFC 3339", name, value)
+	}
+	return ts, nil
+}
+
+// writeStateError maps state errors to HTTP statuses
+func writeStateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, state.ErrRewindForward) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.Component("admin").Error("Failed to encode admin API response", "error", err)
+	}
+}
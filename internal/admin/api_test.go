@@ -0,0 +1,433 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/audit"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/health"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *state.Manager) {
+	manager, err := state.NewManager(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	manager.UpdateStreamProgress("bucket/logs/", 1700003600, "logs/1700003600.gz", 10)
+
+	mux := http.NewServeMux()
+	NewAPI("secret", manager).Register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, manager
+}
+
+func post(t *testing.T, url, token, body string) *http.Response {
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+func TestAPI_RequiresToken(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for _, token := range []string{"", "wrong"} {
+		resp := post(t, server.URL+"/api/state/rewind", token, `{"to":"1700000000"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %d", token, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPI_Rewind(t *testing.T) {
+	server, manager := newTestServer(t)
+
+	// Without confirm only the estimate is returned
+	resp := post(t, server.URL+"/api/state/rewind", "secret", `{"to":"2023-11-14T22:13:20Z","stream_id":"bucket/logs/"}`)
+	var estimate RewindResponse
+	json.NewDecoder(resp.Body).Decode(&estimate)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || estimate.Applied || estimate.Estimate.To != 1700000000 {
+		t.Fatalf("Expected unapplied estimate, got %d %+v", resp.StatusCode, estimate)
+	}
+	if !strings.Contains(estimate.Warning, "1h0m0s window") {
+		t.Errorf("Expected warning to describe the window, got %q", estimate.Warning)
+	}
+	if cp := manager.GetCheckpoint("bucket/logs/"); cp.Timestamp != 1700003600 {
+		t.Errorf("Expected checkpoint unchanged before confirmation, got %d", cp.Timestamp)
+	}
+
+	resp = post(t, server.URL+"/api/state/rewind", "secret", `{"to":"1700000000","stream_id":"bucket/logs/","by":"alice","confirm":true}`)
+	var applied RewindResponse
+	json.NewDecoder(resp.Body).Decode(&applied)
+	resp.Body.Close()
+	if !applied.Applied || applied.Rewind == nil || applied.Rewind.By != "alice" {
+		t.Fatalf("Expected applied rewind by alice, got %+v", applied)
+	}
+	if cp := manager.GetCheckpoint("bucket/logs/"); cp.Timestamp != 1700000000 {
+		t.Errorf("Expected checkpoint rewound to 1700000000, got %d", cp.Timestamp)
+	}
+
+	// Moving forward is refused
+	resp = post(t, server.URL+"/api/state/rewind", "secret", `{"to":"1800000000","stream_id":"bucket/logs/","confirm":true}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 for a forward move, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPI_Quarantine(t *testing.T) {
+	server, manager := newTestServer(t)
+	manager.PutFailure(state.FailedFile{Key: "logs/1.gz", Timestamp: 1, Attempts: 5, LastError: "access denied", Quarantined: true})
+	manager.PutFailure(state.FailedFile{Key: "logs/2.gz", Timestamp: 2, Attempts: 5, Quarantined: true})
+	manager.PutFailure(state.FailedFile{Key: "logs/3.gz", Timestamp: 3, Attempts: 1, NextRetry: 100})
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/quarantine", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var list QuarantineResponse
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Files) != 2 || list.Files[0].Key != "logs/1.gz" || list.Files[0].LastError != "access denied" {
+		t.Fatalf("Expected the 2 quarantined files, got %+v", list.Files)
+	}
+
+	// Pending retries are not in quarantine
+	resp = post(t, server.URL+"/api/quarantine/requeue", "secret", `{"keys":["logs/1.gz","logs/3.gz"],"by":"alice"}`)
+	var requeued QuarantineActionResponse
+	json.NewDecoder(resp.Body).Decode(&requeued)
+	resp.Body.Close()
+	if len(requeued.Files) != 1 || len(requeued.NotFound) != 1 || requeued.NotFound[0] != "logs/3.gz" {
+		t.Fatalf("Expected logs/1.gz requeued and logs/3.gz not found, got %+v", requeued)
+	}
+	if f, _, _ := manager.GetFailure("logs/1.gz"); f.Quarantined || f.NextRetry == 0 || f.Attempts != 5 {
+		t.Errorf("Expected logs/1.gz due for retry with its attempts kept, got %+v", f)
+	}
+
+	resp = post(t, server.URL+"/api/quarantine/dismiss", "secret", `{"keys":["logs/2.gz"]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if _, found, _ := manager.GetFailure("logs/2.gz"); found {
+		t.Error("Expected logs/2.gz to be dismissed")
+	}
+
+	resp = post(t, server.URL+"/api/quarantine/dismiss", "secret", `{}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without keys, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPI_Debug(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI("secret", nil).RegisterDebug(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path, token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/api/debug/runtime"} {
+		resp := get(path, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %s without a token, got %d", path, resp.StatusCode)
+		}
+	}
+
+	resp := get("/debug/pprof/goroutine?debug=1", "secret")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "goroutine profile") {
+		t.Errorf("Expected a goroutine profile, got %d %q", resp.StatusCode, body)
+	}
+
+	resp = get("/api/debug/runtime", "secret")
+	var snapshot RuntimeSnapshot
+	json.NewDecoder(resp.Body).Decode(&snapshot)
+	resp.Body.Close()
+	if snapshot.Goroutines == 0 || snapshot.Memory.HeapAllocBytes == 0 || snapshot.GoVersion == "" {
+		t.Errorf("Expected a populated runtime snapshot, got %+v", snapshot)
+	}
+}
+
+func TestAPI_RecentFiles(t *testing.T) {
+	log, _ := audit.NewLog(10, "")
+	log.Add(audit.Record{Key: "logs/1.gz", Lines: 10, Result: audit.ResultDelivered})
+	log.Add(audit.Record{Key: "logs/2.gz", Result: audit.ResultFailed, Error: "HTTP 503"})
+
+	api := NewAPI("secret", nil)
+	api.SetAuditLog(log)
+	mux := http.NewServeMux()
+	api.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(query string) (*http.Response, RecentFilesResponse) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/files/recent"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body RecentFilesResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	if _, body := get(""); len(body.Files) != 2 || body.Files[0].Key != "logs/2.gz" {
+		t.Errorf("Expected both files newest first, got %+v", body.Files)
+	}
+	if _, body := get("?key=logs/1.gz"); len(body.Files) != 1 || body.Files[0].Lines != 10 {
+		t.Errorf("Expected logs/1.gz with 10 lines, got %+v", body.Files)
+	}
+	if _, body := get("?result=failed"); len(body.Files) != 1 || body.Files[0].Error != "HTTP 503" {
+		t.Errorf("Expected the failed file, got %+v", body.Files)
+	}
+	if resp, _ := get("?limit=x"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPI_PauseResume(t *testing.T) {
+	gate := scanner.NewPauseGate()
+	api := NewAPI("secret", nil)
+	api.SetPauseGate(gate)
+	mux := http.NewServeMux()
+	api.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp := post(t, server.URL+"/api/pause", "secret", `{"by":"alice","reason":"endpoint maintenance"}`)
+	var status scanner.PauseStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !status.Paused || status.By != "alice" {
+		t.Errorf("Expected paused by alice, got %d %+v", resp.StatusCode, status)
+	}
+	if !gate.Paused() {
+		t.Error("Expected the gate to be paused")
+	}
+
+	// Pausing again keeps the original status
+	resp = post(t, server.URL+"/api/pause", "secret", "")
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if status.By != "alice" || status.Reason != "endpoint maintenance" {
+		t.Errorf("Expected the original pause to be kept, got %+v", status)
+	}
+
+	resp = post(t, server.URL+"/api/resume", "secret", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || gate.Paused() {
+		t.Errorf("Expected resume to open the gate, got %d paused=%v", resp.StatusCode, gate.Paused())
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/pause", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPI_PauseNotSupported(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	resp := post(t, server.URL+"/api/pause", "secret", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Expected 501 without a pause gate, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPI_ScanNow(t *testing.T) {
+	trigger := scanner.NewScanTrigger()
+	gate := scanner.NewPauseGate()
+	api := NewAPI("secret", nil)
+	api.SetScanTrigger(trigger)
+	api.SetPauseGate(gate)
+	mux := http.NewServeMux()
+	api.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp := post(t, server.URL+"/api/scan-now", "secret", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	if req := <-trigger.C(); req.Ranged() {
+		t.Errorf("Expected a scan from the checkpoint, got %+v", req)
+	}
+
+	resp = post(t, server.URL+"/api/scan-now", "secret", `{"prefix":"/logs/year=2023/","from":"2023-11-14T22:13:20Z","to":"1700003600","by":"alice"}`)
+	resp.Body.Close()
+	req := <-trigger.C()
+	if req.Prefix != "logs/year=2023/" || req.From != 1700000000 || req.To != 1700003600 || req.By != "alice" {
+		t.Errorf("Unexpected scan request: %+v", req)
+	}
+
+	for _, body := range []string{`{"from":"yesterday"}`, `{"from":"1700003600","to":"1700000000"}`} {
+		resp = post(t, server.URL+"/api/scan-now", "secret", body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+
+	gate.Pause("alice", "")
+	resp = post(t, server.URL+"/api/scan-now", "secret", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 while paused, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPI_Replay(t *testing.T) {
+	var submitted []scanner.FileJob
+	replayer := scanner.NewReplayer(func(job scanner.FileJob) bool {
+		submitted = append(submitted, job)
+		return true
+	}, scanner.NewScanner(nil, "bucket", "logs/app/", 0, nil, nil))
+
+	api := NewAPI("secret", nil)
+	api.SetReplayer(replayer)
+	mux := http.NewServeMux()
+	api.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, body := range []string{
+		`{}`,
+		`{"key":"logs/app/1.gz","from":"1700000000"}`,
+		`{"from":"1700003600","to":"1700000000"}`,
+		`{"to":"tomorrow","from":"1700000000"}`,
+	} {
+		resp := post(t, server.URL+"/api/replay", "secret", body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+
+	// A key outside every stream is reported as skipped
+	resp := post(t, server.URL+"/api/replay", "secret", `{"key":"other/1.gz","tag":true}`)
+	var result scanner.ReplayResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || result.ID == "" || result.Files != 0 || result.Skipped["other/1.gz"] == "" {
+		t.Errorf("Expected a tagged replay skipping other/1.gz, got %d %+v", resp.StatusCode, result)
+	}
+	if len(submitted) != 0 {
+		t.Errorf("Expected nothing submitted, got %+v", submitted)
+	}
+}
+
+func TestAPI_Status(t *testing.T) {
+	manager, err := state.NewManager(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	manager.UpdateStreamProgress("bucket/logs/", 1700003600, "logs/1700003600.gz", 10)
+	sender := output.NewHTTPSender([]string{"http://localhost:1"}, 10, 1024, time.Second, 1, 10, time.Second, 1, time.Second, time.Second, time.Second, time.Second, nil)
+
+	api := NewAPI("secret", manager)
+	api.SetStatusSources(nil, sender, "1.2.3")
+	startup := health.NewStartup()
+	startup.Enter(health.PhaseRunning)
+	api.SetStartup(startup)
+	api.SetPauseGate(scanner.NewPauseGate())
+	mux := http.NewServeMux()
+	api.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var status StatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || status.Build.ServiceVersion != "1.2.3" || status.Build.Version == "" || status.Uptime == "" {
+		t.Errorf("Unexpected status: %d %+v", resp.StatusCode, status)
+	}
+	if status.State == nil || status.State.LastFile != "logs/1700003600.gz" || status.State.Streams["bucket/logs/"].Timestamp != 1700003600 {
+		t.Errorf("Expected the checkpoint in the state, got %+v", status.State)
+	}
+	if status.Startup == nil || !status.Startup.Started {
+		t.Errorf("Expected startup finished, got %+v", status.Startup)
+	}
+	if status.Pause == nil || status.Pause.Paused {
+		t.Errorf("Expected an unpaused status, got %+v", status.Pause)
+	}
+	if status.Pool != nil {
+		t.Errorf("Expected no pool section without a pool, got %+v", status.Pool)
+	}
+	if status.Sender == nil || len(status.Sender.Endpoints) != 1 || !status.Sender.Endpoints[0].Healthy {
+		t.Errorf("Expected one healthy endpoint, got %+v", status.Sender)
+	}
+}
+
+func TestAPI_LogLevel(t *testing.T) {
+	server, _ := newTestServer(t)
+	logger := logging.GetDefaultLogger()
+	previous := logger.Level()
+	defer logger.SetLevel(previous)
+
+	resp := post(t, server.URL+"/api/loglevel", "secret", `{"level":"debug"}`)
+	var level LogLevel
+	json.NewDecoder(resp.Body).Decode(&level)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || level.Level != "debug" || logger.Level() != "debug" {
+		t.Errorf("Expected debug, got %d %+v (logger %s)", resp.StatusCode, level, logger.Level())
+	}
+
+	resp = post(t, server.URL+"/api/loglevel", "secret", `{"level":"verbose"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || logger.Level() != "debug" {
+		t.Errorf("Expected 400 leaving the level unchanged, got %d (logger %s)", resp.StatusCode, logger.Level())
+	}
+}
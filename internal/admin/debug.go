@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// RegisterDebug mounts the profiling endpoints: the net/http/pprof handlers under
+// /debug/pprof/ and a runtime snapshot at /api/debug/runtime. Like the admin endpoints
+// they require the bearer token.
+func (a *API) RegisterDebug(mux Mux) {
+	mux.Handle("/debug/pprof/", a.authorize(pprof.Index))
+	mux.Handle("/debug/pprof/cmdline", a.authorize(pprof.Cmdline))
+	mux.Handle("/debug/pprof/profile", a.authorize(pprof.Profile))
+	mux.Handle("/debug/pprof/symbol", a.authorize(pprof.Symbol))
+	mux.Handle("/debug/pprof/trace", a.authorize(pprof.Trace))
+	mux.Handle("/api/debug/runtime", a.authorize(a.handleRuntime))
+}
+
+// RuntimeSnapshot is the body of GET /api/debug/runtime
+type RuntimeSnapshot struct {
+	Timestamp  string        `json:"timestamp"`
+	GoVersion  string        `json:"go_version"`
+	NumCPU     int           `json:"num_cpu"`
+	GOMAXPROCS int           `json:"gomaxprocs"`
+	Goroutines int           `json:"goroutines"`
+	Memory     MemorySummary `json:"memory"`
+}
+
+// MemorySummary is the subset of runtime.MemStats useful for spotting leaks and GC pressure
+type MemorySummary struct {
+	HeapAllocBytes  uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes  uint64 `json:"heap_inuse_bytes"`
+	HeapIdleBytes   uint64 `json:"heap_idle_bytes"`
+	HeapObjects     uint64 `json:"heap_objects"`
+	StackInuseBytes uint64 `json:"stack_inuse_bytes"`
+	SysBytes        uint64 `json:"sys_bytes"`
+	TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+	NumGC           uint32 `json:"num_gc"`
+	GCPauseTotalMs  int64  `json:"gc_pause_total_ms"`
+	LastGC          string `json:"last_gc,omitempty"`
+}
+
+func (a *API) handleRuntime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	snapshot := RuntimeSnapshot{
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		GoVersion:  runtime.Version(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemorySummary{
+			HeapAllocBytes:  ms.HeapAlloc,
+			HeapInuseBytes:  ms.HeapInuse,
+			HeapIdleBytes:   ms.HeapIdle,
+			HeapObjects:     ms.HeapObjects,
+			StackInuseBytes: ms.StackInuse,
+			SysBytes:        ms.Sys,
+			TotalAllocBytes: ms.TotalAlloc,
+			NumGC:           ms.NumGC,
+			GCPauseTotalMs:  time.Duration(ms.PauseTotalNs).Milliseconds(),
+		},
+	}
+	if ms.LastGC > 0 {
+		snapshot.Memory.LastGC = time.Unix(0, int64(ms.LastGC)).UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/health"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/worker"
+)
+
+// processStart approximates when the process started, for the uptime
+var processStart = time.Now()
+
+// StatusResponse is the body of GET /status: everything a support ticket needs in one call
+type StatusResponse struct {
+	Timestamp string                `json:"timestamp"`
+	StartedAt string                `json:"started_at"`
+	Uptime    string                `json:"uptime"`
+	Build     BuildInfo             `json:"build"`
+	Startup   *health.StartupStatus `json:"startup,omitempty"`
+	State     *StateStatus          `json:"state,omitempty"`
+	Pause     *scanner.PauseStatus  `json:"pause,omitempty"`
+	Pool      *PoolStatus           `json:"pool,omitempty"`
+	Sender    *SenderStatus         `json:"sender,omitempty"`
+}
+
+// BuildInfo identifies the running binary
+type BuildInfo struct {
+	Version        string `json:"version"`            // Release version, or "dev" (see buildinfo.Info)
+	Revision       string `json:"revision,omitempty"` // Commit the binary was built from
+	Date           string `json:"date,omitempty"`     // Build date, or the commit time
+	Modified       bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion      string `json:"go_version"`
+	Platform       string `json:"platform"`                  // GOOS/GOARCH
+	ServiceVersion string `json:"service_version,omitempty"` // otlp.service_version, when it differs from Version
+}
+
+// StateStatus is the processing position
+type StateStatus struct {
+	LastTimestamp  int64                       `json:"last_timestamp"`
+	LastFile       string                      `json:"last_file"`
+	FilesProcessed int64                       `json:"files_processed"`
+	BytesProcessed int64                       `json:"bytes_processed"`
+	Streams        map[string]state.Checkpoint `json:"streams,omitempty"`
+}
+
+// PoolStatus is the worker pool's load and counters since start
+type PoolStatus struct {
+	Workers    int   `json:"workers"`
+	QueueDepth int   `json:"queue_depth"`
+	Files      int64 `json:"files"`
+	Bytes      int64 `json:"bytes"`
+	Errors     int64 `json:"errors"`
+	Timeouts   int64 `json:"timeouts"`
+}
+
+// SenderStatus is the HTTP sender's counters since start and per-endpoint health
+type SenderStatus struct {
+	Lines             int64                   `json:"lines"`
+	Bytes             int64                   `json:"bytes"`
+	Batches           int64                   `json:"batches"`
+	Errors            int64                   `json:"errors"`
+	Retries           int64                   `json:"retries"`
+	Drops             int64                   `json:"drops"`
+	Spilled           int64                   `json:"spilled"`
+	BufferUtilization float64                 `json:"buffer_utilization"`
+	Responses         map[int]int64           `json:"responses,omitempty"` // By HTTP status code
+	Endpoints         []output.EndpointStatus `json:"endpoints"`
+}
+
+// SetStartup adds the startup phases to GET /status. Call before Register.
+func (a *API) SetStartup(startup *health.Startup) {
+	a.startup = startup
+}
+
+// SetStatusSources adds the pool, the sender and the service version to GET /status.
+// Either may be nil. Call before Register.
+func (a *API) SetStatusSources(pool *worker.HTTPPool, sender *output.HTTPSender, version string) {
+	a.pool = pool
+	a.sender = sender
+	a.version = version
+}
+
+func (a *API) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	now := time.Now()
+	resp := StatusResponse{
+		Timestamp: now.UTC().Format(time.RFC3339),
+		StartedAt: processStart.UTC().Format(time.RFC3339),
+		Uptime:    now.Sub(processStart).Round(time.Second).String(),
+		Build:     a.buildInfo(),
+	}
+
+	if a.startup != nil {
+		startup := a.startup.Status()
+		resp.Startup = &startup
+	}
+	if a.stateManager != nil {
+		files, bytes, _ := a.stateManager.GetStats()
+		resp.State = &StateStatus{
+			LastTimestamp:  a.stateManager.GetLastTimestamp(),
+			LastFile:       a.stateManager.GetLastFile(),
+			FilesProcessed: files,
+			BytesProcessed: bytes,
+		}
+		if snapshotter, ok := a.stateManager.(state.Snapshotter); ok {
+			resp.State.Streams = snapshotter.Snapshot().Streams
+		}
+	}
+	if a.pause != nil {
+		pause := a.pause.Status()
+		resp.Pause = &pause
+	}
+	if a.pool != nil {
+		files, bytes, errors := a.pool.GetMetrics()
+		resp.Pool = &PoolStatus{
+			Workers:    a.pool.GetWorkerCount(),
+			QueueDepth: a.pool.QueueDepth(),
+			Files:      files,
+			Bytes:      bytes,
+			Errors:     errors,
+			Timeouts:   a.pool.GetTimeouts(),
+		}
+	}
+	if a.sender != nil {
+		lines, bytes, batches, errors := a.sender.GetMetrics()
+		resp.Sender = &SenderStatus{
+			Lines:             lines,
+			Bytes:             bytes,
+			Batches:           batches,
+			Errors:            errors,
+			Retries:           a.sender.GetRetries(),
+			Drops:             a.sender.GetDrops(),
+			Spilled:           a.sender.GetSpilled(),
+			BufferUtilization: a.sender.BufferUtilization(),
+			Responses:         a.sender.GetStatusCounts(),
+			Endpoints:         a.sender.EndpointStatuses(),
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// buildInfo describes the running binary (see buildinfo.Get)
+func (a *API) buildInfo() BuildInfo {
+	build := buildinfo.Get()
+	info := BuildInfo{
+		Version:   build.Version,
+		Revision:  build.Commit,
+		Date:      build.Date,
+		Modified:  build.Modified,
+		GoVersion: build.GoVersion,
+		Platform:  build.Platform,
+	}
+	if a.version != build.Version {
+		info.ServiceVersion = a.version
+	}
+	return info
+}
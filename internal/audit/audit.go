@@ -0,0 +1,216 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// File results
+const (
+	ResultDelivered   = "delivered"
+	ResultFailed      = "failed"
+	ResultTimedOut    = "timed_out"
+	ResultInterrupted = "interrupted" // Stopped by shutdown; re-enqueued on the next start
+)
+
+// DefaultCapacity is how many files a Log keeps unless configured otherwise
+const DefaultCapacity = 10000
+
+// Record is the outcome of processing one file
+type Record struct {
+	Key         string    `json:"key"`
+	StreamID    string    `json:"stream_id,omitempty"`
+	Timestamp   int64     `json:"timestamp"` // The file's timestamp (Unix seconds)
+	Lines       int       `json:"lines"`
+	Bytes       int       `json:"bytes"`
+	DurationMs  int64     `json:"duration_ms"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+	CompletedAt time.Time `json:"completed_at"`
+
+	ProcessingID string `json:"processing_id,omitempty"` // Processing ID of the attempt, to find its log lines
+}
+
+// Log keeps the most recently processed files in a ring. With a path, records are also
+// appended to a JSON lines file, which is reloaded on start and rewritten when it reaches
+// twice the capacity so it stays bounded.
+type Log struct {
+	mu       sync.Mutex
+	records  []Record // Ring, oldest at next once full
+	next     int
+	full     bool
+	path     string
+	file     *os.File
+	appended int // Lines in file
+}
+
+// NewLog creates a log of the last capacity files, persisted to path unless it is empty
+func NewLog(capacity int, path string) (*Log, error) {
+	if capacity < 1 {
+		capacity = DefaultCapacity
+	}
+	l := &Log{records: make([]Record, capacity), path: path}
+	if path == "" {
+		return l, nil
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := l.rewrite(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load restores the records persisted by a previous run
+func (l *Log) load() error {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue // A line torn by a crash
+		}
+		l.push(r)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
+
+// Add records a processed file
+func (l *Log) Add(r Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.push(r)
+
+	if l.file == nil {
+		return
+	}
+	if l.appended >= 2*len(l.records) {
+		if err := l.rewrite(); err != nil {
+			logging.Component("audit").Warn("Failed to compact audit log", "path", l.path, "error", err)
+		}
+		return // The rewrite includes r
+	}
+	line, err := json.Marshal(r)
+	if err == nil {
+		_, err = l.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logging.Component("audit").Warn("Failed to append to audit log", "path", l.path, "error", err)
+		return
+	}
+	l.appended++
+}
+
+func (l *Log) push(r Record) {
+	l.records[l.next] = r
+	l.next = (l.next + 1) % len(l.records)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// rewrite replaces the file with the records in the ring and reopens it for appending
+func (l *Log) rewrite() error {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+
+	tmpPath := l.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	records := l.ordered()
+	for _, r := range records {
+		enc.Encode(r)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		return fmt.Errorf("failed to replace audit log: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.file = f
+	l.appended = len(records)
+	return nil
+}
+
+// ordered returns the records oldest first
+func (l *Log) ordered() []Record {
+	if !l.full {
+		return append([]Record(nil), l.records[:l.next]...)
+	}
+	return append(append([]Record(nil), l.records[l.next:]...), l.records[:l.next]...)
+}
+
+// Query selects records from the log. Empty fields match everything.
+type Query struct {
+	Key    string // Exact object key
+	Result string
+	Limit  int // Most records returned (0 for all)
+}
+
+// Recent returns the records matching q, newest first
+func (l *Log) Recent(q Query) []Record {
+	l.mu.Lock()
+	records := l.ordered()
+	l.mu.Unlock()
+
+	out := []Record{}
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if (q.Key != "" && r.Key != q.Key) || (q.Result != "" && r.Result != q.Result) {
+			continue
+		}
+		out = append(out, r)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// Close closes the persisted file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
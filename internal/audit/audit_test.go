@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog_RingAndQuery(t *testing.T) {
+	l, err := NewLog(3, "")
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	l.Add(Record{Key: "a", Result: ResultDelivered})
+	l.Add(Record{Key: "b", Result: ResultFailed})
+	l.Add(Record{Key: "c", Result: ResultDelivered})
+	l.Add(Record{Key: "d", Result: ResultDelivered})
+
+	recent := l.Recent(Query{})
+	if len(recent) != 3 || recent[0].Key != "d" || recent[2].Key != "b" {
+		t.Fatalf("Expected d, c, b newest first, got %+v", recent)
+	}
+	if got := l.Recent(Query{Result: ResultFailed}); len(got) != 1 || got[0].Key != "b" {
+		t.Errorf("Expected only b to have failed, got %+v", got)
+	}
+	if got := l.Recent(Query{Key: "a"}); len(got) != 0 {
+		t.Errorf("Expected a to have left the ring, got %+v", got)
+	}
+	if got := l.Recent(Query{Limit: 1}); len(got) != 1 || got[0].Key != "d" {
+		t.Errorf("Expected the newest record only, got %+v", got)
+	}
+}
+
+func TestLog_Persisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := NewLog(2, path)
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		l.Add(Record{Key: key, Result: ResultDelivered, Lines: 1})
+	}
+	l.Close()
+
+	// The file is compacted once it holds twice the capacity
+	if n := countLines(t, path); n > 4 {
+		t.Errorf("Expected at most 4 lines on disk, got %d", n)
+	}
+
+	reopened, err := NewLog(2, path)
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	defer reopened.Close()
+	recent := reopened.Recent(Query{})
+	if len(recent) != 2 || recent[0].Key != "e" || recent[1].Key != "d" {
+		t.Errorf("Expected e and d restored, got %+v", recent)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	n := 0
+	for s := bufio.NewScanner(f); s.Scan(); {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+// Package awsjson calls AWS JSON 1.1 APIs (SSM, Secrets Manager, KMS) with SigV4-signed
+// requests, without depending on each service's SDK module.
+package awsjson
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// callTimeout bounds one call, including retrieving credentials, so an unreachable
+// endpoint cannot block startup or a credential refresh
+const callTimeout = 30 * time.Second
+
+var client = &http.Client{Timeout: callTimeout}
+
+// Call invokes target (e.g. "TrentService.Decrypt") on service in awsCfg's region, marshaling
+// in as the request and unmarshaling the response into out. endpoint overrides
+// https://<service>.<region>.amazonaws.com/ when set. Without a deadline on ctx, the call
+// gives up after 30 seconds.
+func Call(ctx context.Context, awsCfg aws.Config, endpoint, service, target string, in, out any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, callTimeout)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com/", service, awsCfg.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), service, awsCfg.Region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign %s request: %w", target, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", target, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", target, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("%s failed: %s %s %s", target, resp.Status, apiErr.Type, apiErr.Message)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,144 @@
+package awsjson
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+var testCreds = aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session"}
+
+func testConfig() aws.Config {
+	return aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return testCreds, nil
+		}),
+	}
+}
+
+func TestCall_SignsRequest(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST, got %s", r.Method)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/x-amz-json-1.1" {
+			t.Errorf("Expected Content-Type application/x-amz-json-1.1, got %q", got)
+		}
+		if got := r.Header.Get("X-Amz-Target"); got != "AmazonSSM.GetParameter" {
+			t.Errorf("Expected X-Amz-Target AmazonSSM.GetParameter, got %q", got)
+		}
+		if got := r.Header.Get("X-Amz-Security-Token"); got != "session" {
+			t.Errorf("Expected the session token header, got %q", got)
+		}
+		var in map[string]any
+		if err := json.Unmarshal(body, &in); err != nil || in["Name"] != "/streamer/token" {
+			t.Errorf("Unexpected request body %s (%v)", body, err)
+		}
+
+		// Sign the received request again with the same time; the signatures must match
+		signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			t.Fatalf("Invalid X-Amz-Date %q: %v", r.Header.Get("X-Amz-Date"), err)
+		}
+		expected, _ := http.NewRequest(http.MethodPost, server.URL+r.URL.Path, bytes.NewReader(body))
+		expected.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		expected.Header.Set("X-Amz-Target", r.Header.Get("X-Amz-Target"))
+		hash := sha256.Sum256(body)
+		if err := v4.NewSigner().SignHTTP(context.Background(), testCreds, expected, hex.EncodeToString(hash[:]), "ssm", "eu-west-1", signedAt); err != nil {
+			t.Fatalf("SignHTTP failed: %v", err)
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"+signedAt.Format("20060102")+"/eu-west-1/ssm/aws4_request") {
+			t.Errorf("Unexpected credential scope in %q", auth)
+		}
+		if auth != expected.Header.Get("Authorization") {
+			t.Errorf("Expected signature %q, got %q", expected.Header.Get("Authorization"), auth)
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write([]byte(`{"Parameter":{"Name":"/streamer/token","Value":"s3cr3t"}}`))
+	}))
+	defer server.Close()
+
+	var out struct {
+		Parameter struct {
+			Value string
+		}
+	}
+	in := map[string]any{"Name": "/streamer/token", "WithDecryption": true}
+	if err := Call(context.Background(), testConfig(), server.URL+"/", "ssm", "AmazonSSM.GetParameter", in, &out); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if out.Parameter.Value != "s3cr3t" {
+		t.Errorf("Expected the decoded response, got %+v", out)
+	}
+}
+
+func TestCall_ErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"ResourceNotFoundException","Message":"Secrets Manager can't find the specified secret."}`))
+	}))
+	defer server.Close()
+
+	var out map[string]any
+	err := Call(context.Background(), testConfig(), server.URL, "secretsmanager", "secretsmanager.GetSecretValue", map[string]string{"SecretId": "missing"}, &out)
+	if err == nil {
+		t.Fatal("Expected an error for HTTP 400")
+	}
+	for _, want := range []string{"secretsmanager.GetSecretValue", "400", "ResourceNotFoundException", "can't find the specified secret"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestCall_InvalidResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`not json`))
+	}))
+	defer server.Close()
+
+	var out map[string]any
+	if err := Call(context.Background(), testConfig(), server.URL, "kms", "TrentService.Decrypt", map[string]string{}, &out); err == nil {
+		t.Error("Expected an error for a response that is not JSON")
+	}
+}
+
+func TestCall_CredentialsError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	awsCfg := aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{}, errors.New("no credentials")
+		}),
+	}
+	var out map[string]any
+	err := Call(context.Background(), awsCfg, server.URL, "kms", "TrentService.Decrypt", map[string]string{}, &out)
+	if err == nil || !strings.Contains(err.Error(), "failed to retrieve AWS credentials") {
+		t.Errorf("Expected a credentials error, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request without credentials, got %d", requests)
+	}
+}
@@ -0,0 +1,105 @@
+// Package buildinfo identifies the running binary, so support can tell which build a
+// deployment runs. Release builds set the version, commit and build date with the linker:
+//
+//	go build -ldflags "-X github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo.version=1.4.0
+//	  -X github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo.commit=$(git rev-parse HEAD)
+//	  -X github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/s3-streamer
+//
+// Values not set fall back to what go build stamps: the module version, and the VCS
+// revision and commit time of a build from a git checkout.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set with -ldflags "-X"
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info identifies a build
+type Info struct {
+	Version   string `json:"version"`            // Release version, or "dev" for builds without one
+	Commit    string `json:"commit,omitempty"`   // Commit the binary was built from
+	Date      string `json:"date,omitempty"`     // Build date, or the commit time of a VCS-stamped build
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+// Get returns the build of the running binary
+func Get() Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info.withDefaults()
+	}
+	if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	var revision, modified string
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = setting.Value
+			}
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = revision
+	}
+	// The working tree go build saw only describes the commit it stamped
+	info.Modified = revision != "" && info.Commit == revision && modified == "true"
+	return info.withDefaults()
+}
+
+func (i Info) withDefaults() Info {
+	if i.Version == "" {
+		i.Version = "dev"
+	}
+	return i
+}
+
+// ShortCommit returns the first 12 characters of the commit
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
+
+// String describes the build on one line, e.g. "1.4.0 (4947abd0c1e2, 2026-10-16T06:00:00Z)"
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		commit := i.ShortCommit()
+		if i.Modified {
+			commit += "-modified"
+		}
+		details = append(details, commit)
+	}
+	if i.Date != "" {
+		details = append(details, i.Date)
+	}
+	if len(details) == 0 {
+		return i.Version
+	}
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
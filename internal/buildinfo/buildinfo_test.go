@@ -0,0 +1,44 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet_LinkerValues(t *testing.T) {
+	defer func(v, c, d string) { version, commit, date = v, c, d }(version, commit, date)
+	version, commit, date = "1.4.0", "4947abd0c1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6", "2026-10-16T06:00:00Z"
+
+	info := Get()
+	if info.Version != "1.4.0" || info.Commit != commit || info.Date != date {
+		t.Errorf("Expected the linker values, got %+v", info)
+	}
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("Expected the Go version and platform, got %+v", info)
+	}
+	info.Modified = false
+	if got, want := info.String(), "1.4.0 (4947abd0c1e2, 2026-10-16T06:00:00Z)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestGet_Defaults(t *testing.T) {
+	defer func(v, c, d string) { version, commit, date = v, c, d }(version, commit, date)
+	version, commit, date = "", "", ""
+
+	// A test binary has no module version or VCS stamp
+	info := Get()
+	if info.Version != "dev" {
+		t.Errorf("Expected version dev, got %q", info.Version)
+	}
+	if info.Commit == "" && info.String() != "dev" {
+		t.Errorf("Expected just the version, got %q", info.String())
+	}
+}
+
+func TestInfo_String(t *testing.T) {
+	info := Info{Version: "dev", Commit: "abc123", Modified: true}
+	if got, want := info.String(), "dev (abc123-modified)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
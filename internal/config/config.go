@@ -1,13 +1,21 @@
 package config
 
 import (
+	"context"
+	"crypto/tls"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
 	"gopkg.in/yaml.v3"
 )
 
@@ -24,115 +32,500 @@ type FormatConfig struct {
 
 // RedisConfig holds Redis connection and state configuration
 type RedisConfig struct {
-	Enabled   bool   `yaml:"enabled"`    // Enable Redis state storage
-	Host      string `yaml:"host"`       // Redis host (default: "localhost")
-	Port      int    `yaml:"port"`       // Redis port (default: 6379)
-	Password  string `yaml:"password"`   // Redis password (optional)
-	Database  int    `yaml:"database"`   // Redis database number (default: 0)
-	KeyPrefix string `yaml:"key_prefix"` // Key prefix for state keys (default: "s3-streamer")
+	Enabled   bool   `yaml:"enabled"`                // Enable Redis state storage
+	Host      string `yaml:"host"`                   // Redis host (default: "localhost")
+	Port      int    `yaml:"port"`                   // Redis port (default: 6379)
+	Password  string `yaml:"password" secret:"true"` // Redis password (optional)
+	Database  int    `yaml:"database"`               // Redis database number (default: 0)
+	KeyPrefix string `yaml:"key_prefix"`             // Key prefix for state keys (default: "s3-streamer")
+
+	ProcessedTTL time.Duration `yaml:"processed_ttl"` // Expiry of the per-file "<key_prefix>:processed:<s3 key>" markers (default: state.retention)
+}
+
+// S3Config holds the source bucket settings
+type S3Config struct {
+	Bucket     string `yaml:"bucket"`
+	Prefix     string `yaml:"prefix"`
+	Region     string `yaml:"region"`
+	AWSProfile string `yaml:"aws_profile"` // Named profile from ~/.aws/config or ~/.aws/credentials, SSO included (same as aws.profile)
+}
+
+// HTTPConfig holds the HTTP sender settings
+type HTTPConfig struct {
+	Endpoints             []string                     `yaml:"endpoints"`                      // EdgeDelta HTTP input endpoints (load balanced across workers)
+	BatchLines            int                          `yaml:"batch_lines"`                    // Max lines per batch (default: 1000)
+	BatchBytes            int                          `yaml:"batch_bytes"`                    // Max bytes per batch (default: 1MB)
+	FlushInterval         time.Duration                `yaml:"flush_interval"`                 // Force flush after this duration (default: 1s)
+	Workers               int                          `yaml:"workers"`                        // Number of parallel HTTP senders (default: 10)
+	BufferSize            int                          `yaml:"buffer_size"`                    // Size of line buffer (default: 10000)
+	Timeout               time.Duration                `yaml:"timeout"`                        // HTTP request timeout (default: 30s)
+	MaxIdleConns          int                          `yaml:"max_idle_conns"`                 // HTTP connection pool size (default: 100)
+	IdleConnTimeout       time.Duration                `yaml:"idle_conn_timeout"`              // How long idle connections stay alive (default: 90s)
+	TLSHandshakeTimeout   time.Duration                `yaml:"tls_handshake_timeout"`          // TLS handshake timeout (default: 10s)
+	ResponseHeaderTimeout time.Duration                `yaml:"response_header_timeout"`        // Response header timeout (default: 10s)
+	ExpectContinueTimeout time.Duration                `yaml:"expect_continue_timeout"`        // Expect continue timeout (default: 1s)
+	Headers               map[string]string            `yaml:"headers" secret:"true"`          // Extra headers sent to every endpoint (values may use {format}, {bucket}, {s3_key}, {replay})
+	EndpointHeaders       map[string]map[string]string `yaml:"endpoint_headers" secret:"true"` // Extra headers keyed by endpoint URL (override http.headers)
+	BufferPolicy          string                       `yaml:"buffer_policy"`                  // Full-buffer behaviour: block, drop_newest, drop_oldest, block_with_timeout (default: block)
+	BufferBlockTimeout    time.Duration                `yaml:"buffer_block_timeout"`           // Max wait before dropping with block_with_timeout (default: 5s)
+	MaxRetries            int                          `yaml:"max_retries"`                    // Retries for 5xx/408/429/network errors (default: 3, -1 disables)
+	RetryBackoff          time.Duration                `yaml:"retry_backoff"`                  // Initial retry backoff, doubled per attempt (default: 500ms)
+	RetryMaxBackoff       time.Duration                `yaml:"retry_max_backoff"`              // Upper bound on retry backoff (default: 30s)
+	DrainTimeout          time.Duration                `yaml:"drain_timeout"`                  // Max time to flush buffered lines on shutdown (default: 30s)
+	SpillDir              string                       `yaml:"spill_dir"`                      // Directory for lines undelivered at shutdown, replayed on start (optional)
+	MaxInFlight           int                          `yaml:"max_in_flight"`                  // Max outstanding POSTs across all workers (default: 0, unlimited)
+}
+
+// ProcessingConfig holds the S3 worker and scan settings
+type ProcessingConfig struct {
+	WorkerCount     int               `yaml:"worker_count"`       // Parallel S3 file workers (default: 15)
+	QueueSize       int               `yaml:"queue_size"`         // Files waiting for a worker (default: 1000)
+	ScanInterval    time.Duration     `yaml:"scan_interval"`      // How often S3 is listed (default: 15s)
+	DelayWindow     time.Duration     `yaml:"delay_window"`       // Minimum file age before processing (default: 60s)
+	FileTimeout     time.Duration     `yaml:"file_timeout"`       // Time one file may take to download and queue (default: 5m)
+	StrictOrdering  bool              `yaml:"strict_ordering"`    // Process each stream's files one at a time, in timestamp order
+	DecodeReadAhead int               `yaml:"decode_read_ahead"`  // 1 MiB blocks pgzip decompresses ahead for gzipped files of 8 MiB+ (default: 4, 1 decodes inline with compress/gzip)
+	MaxLineKB       int               `yaml:"max_line_kb"`        // Longest line read from a file (default: 1024)
+	LongLines       string            `yaml:"long_lines"`         // Longer lines: fail (the file), truncate, split, skip (default: fail)
+	LogFormats      []FormatConfig    `yaml:"log_formats"`        // Custom format definitions
+	DefaultFormat   string            `yaml:"default_format"`     // Default format name or "auto"
+	LogFormat       string            `yaml:"log_format"`         // DEPRECATED: Legacy single format field
+	Envelopes       map[string]string `yaml:"envelopes"`          // Output envelope template per format name ("*" for all others)
+	Retry           RetryConfig       `yaml:"retry"`              // Retries of files whose processing failed
+	Autoscale       AutoscaleConfig   `yaml:"autoscale"`          // Vary the worker count with load (worker_count is the initial count)
+	Shed            ShedConfig        `yaml:"shed"`               // Pause scanning while the queue and buffer are saturated
+	Multipart       MultipartConfig   `yaml:"multipart_download"` // Concurrent ranged GETs for large objects
+	Audit           AuditConfig       `yaml:"audit"`              // Recently processed files, served at /api/files/recent
+	Report          ReportConfig      `yaml:"report"`             // Per-file processing report, for reconciliation against the source
+}
+
+// AuditConfig holds the recently processed files log
+type AuditConfig struct {
+	Capacity int    `yaml:"capacity"` // Files kept (default: 10000, -1 disables)
+	Path     string `yaml:"path"`     // JSON lines file the log persists to across restarts (optional)
+}
+
+// ReportConfig holds the per-file processing report: one file_complete record per processed
+// file with its line counts, skipped lines by reason, bytes, duration and destination results
+type ReportConfig struct {
+	Log        bool   `yaml:"log"`         // Log each record at info level
+	Path       string `yaml:"path"`        // JSON lines file the records are appended to (optional)
+	MaxSizeMB  int    `yaml:"max_size_mb"` // Size that triggers a rotation of the file (default: 100)
+	MaxBackups int    `yaml:"max_backups"` // Rotated files kept (0 = all)
+}
+
+// MultipartConfig holds the ranged multi-part download settings. Objects of at least
+// threshold_mb are fetched as concurrent ranged GETs and reassembled in order.
+type MultipartConfig struct {
+	ThresholdMB int `yaml:"threshold_mb"` // Smallest object downloaded in parts (default: 64, -1 disables)
+	PartSizeMB  int `yaml:"part_size_mb"` // Size of each ranged GET (default: 8)
+	Concurrency int `yaml:"concurrency"`  // Parts downloaded at once per file (default: 4)
+}
+
+// AutoscaleConfig holds the worker autoscaling settings. Workers are added while files
+// queue up or processing lags, and removed when the queue is empty or the HTTP buffer is
+// filling up (delivery, not downloading, is then the bottleneck).
+type AutoscaleConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	MinWorkers        int           `yaml:"min_workers"`         // Fewest workers (default: 1)
+	MaxWorkers        int           `yaml:"max_workers"`         // Most workers (default: 2 x worker_count)
+	Interval          time.Duration `yaml:"interval"`            // How often load is sampled (default: 30s)
+	QueueHighWater    float64       `yaml:"queue_high_water"`    // Queue fill (0-1) that adds a worker (default: 0.5)
+	LagHighWater      time.Duration `yaml:"lag_high_water"`      // Processing lag that adds a worker (default: 5m, -1s ignores lag)
+	BufferHighWater   float64       `yaml:"buffer_high_water"`   // HTTP buffer fill (0-1) that removes a worker (default: 0.8)
+	ScaleDownCooldown time.Duration `yaml:"scale_down_cooldown"` // Minimum time between removals (default: 2m)
+}
+
+// ShedConfig holds the load shedding settings. While the job queue and HTTP buffer both
+// stay at high_water for the for duration, scanning pauses until both drop below low_water.
+type ShedConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	HighWater float64       `yaml:"high_water"` // Queue and buffer fill (0-1) that starts shedding (default: 0.95)
+	LowWater  float64       `yaml:"low_water"`  // Queue and buffer fill (0-1) that stops shedding (default: 0.5)
+	For       time.Duration `yaml:"for"`        // Time both must stay at high_water before shedding (default: 30s)
+}
+
+// RetryConfig holds the failed-file retry settings. A file that still fails after
+// max_attempts is quarantined until an operator requeues or dismisses it.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"` // Attempts (including the first) before quarantine (default: 5, -1 disables retries)
+	Backoff     time.Duration `yaml:"backoff"`      // Delay before the first retry, doubled per attempt (default: 1m)
+	MaxBackoff  time.Duration `yaml:"max_backoff"`  // Upper bound on the retry delay (default: 1h)
+
+	RetryCorrupt bool `yaml:"retry_corrupt"` // Retry corrupt files instead of quarantining them on the first failure (default: false)
+}
+
+// StateConfig holds the state persistence settings
+type StateConfig struct {
+	FilePath           string         `yaml:"file_path"`             // State file (default: /var/lib/s3-streamer/state.json)
+	SaveInterval       time.Duration  `yaml:"save_interval"`         // How often the state is persisted (default: 30s)
+	Retention          time.Duration  `yaml:"retention"`             // How long per-file tracking (resume offsets, file records) is kept (default: 168h)
+	CompactionInterval time.Duration  `yaml:"compaction_interval"`   // How often expired per-file tracking is removed (default: 1h)
+	InFlightStaleAfter time.Duration  `yaml:"in_flight_stale_after"` // Files left in flight are re-enqueued on start once this old (default: 0, all of them)
+	Redis              RedisConfig    `yaml:"redis"`                 // Redis configuration for state storage
+	SQL                SQLConfig      `yaml:"sql"`                   // SQLite/PostgreSQL per-file state storage
+	KV                 KVConfig       `yaml:"kv"`                    // Consul/etcd state storage with CAS updates
+	Snapshot           SnapshotConfig `yaml:"snapshot"`              // Periodic copy of the state in S3
+}
+
+// SnapshotConfig holds the S3 state snapshot settings. The snapshot is uploaded periodically
+// and used to bootstrap the state when the configured backend holds none.
+type SnapshotConfig struct {
+	Enabled  bool          `yaml:"enabled"`  // Upload state snapshots and bootstrap from them
+	Bucket   string        `yaml:"bucket"`   // Snapshot bucket (default: s3.bucket)
+	Key      string        `yaml:"key"`      // Snapshot object key (default: "s3-streamer/state-snapshot.json")
+	Interval time.Duration `yaml:"interval"` // How often the snapshot is uploaded (default: 15m)
+}
+
+// KVConfig holds Consul KV or etcd state configuration
+type KVConfig struct {
+	Enabled  bool          `yaml:"enabled"`                // Enable KV state storage
+	Backend  string        `yaml:"backend"`                // consul or etcd
+	Address  string        `yaml:"address"`                // Agent URL (default: http://localhost:8500 for consul, http://localhost:2379 for etcd)
+	Key      string        `yaml:"key"`                    // Key holding the state (default: "s3-streamer/state")
+	Token    string        `yaml:"token" secret:"true"`    // ACL token (consul only), optional
+	Username string        `yaml:"username"`               // etcd user (etcd only), optional
+	Password string        `yaml:"password" secret:"true"` // etcd user's password
+	Timeout  time.Duration `yaml:"timeout"`                // Per-request timeout (default: 5s)
+}
+
+// SQLConfig holds SQL database state configuration
+type SQLConfig struct {
+	Enabled bool   `yaml:"enabled"`           // Enable SQL state storage (one record per S3 object)
+	Driver  string `yaml:"driver"`            // Database: sqlite (or sqlite3) or postgres (or pgx)
+	DSN     string `yaml:"dsn" secret:"true"` // Data source name (file path for SQLite, connection URL for PostgreSQL)
+	Table   string `yaml:"table"`             // Table name (default: "s3_streamer_files")
+}
+
+// DriverName returns the database/sql driver that opens Driver's database: the binary
+// registers "sqlite3" (github.com/mattn/go-sqlite3, cgo builds only) and "pgx"
+// (github.com/jackc/pgx/v5/stdlib)
+func (c SQLConfig) DriverName() string {
+	switch c.Driver {
+	case "sqlite":
+		return "sqlite3"
+	case "postgres":
+		return "pgx"
+	}
+	return c.Driver
+}
+
+// LeaderElectionConfig holds active-passive leader election settings.
+// The Redis lock uses the connection settings of state.redis; the kubernetes lock is a Lease
+// object in the namespace of kubernetes.namespace.
+type LeaderElectionConfig struct {
+	Enabled       bool          `yaml:"enabled"`        // Only the elected replica streams; others stand by
+	Backend       string        `yaml:"backend"`        // Lock backend: redis or kubernetes (default: "kubernetes" with kubernetes.enabled, otherwise "redis")
+	Key           string        `yaml:"key"`            // Lock key, or the Lease name (default: "<state.redis.key_prefix>:leader", or "s3-streamer-leader" for kubernetes)
+	Identity      string        `yaml:"identity"`       // Holder identity (default: kubernetes.pod_name with kubernetes.enabled, otherwise hostname)
+	LeaseDuration time.Duration `yaml:"lease_duration"` // How long the lock survives without renewal (default: 15s)
+	RenewInterval time.Duration `yaml:"renew_interval"` // How often the leader renews and standbys retry (default: 5s)
+}
+
+// ShardingConfig holds horizontal sharding settings. Instances register in Redis (using the
+// connection settings of state.redis) and split a fixed number of key shards between them.
+type ShardingConfig struct {
+	Enabled           bool          `yaml:"enabled"`            // Each instance processes only the shards it owns
+	Identity          string        `yaml:"identity"`           // Unique instance identity (default: kubernetes.pod_name with kubernetes.enabled, otherwise hostname)
+	KeyPrefix         string        `yaml:"key_prefix"`         // Redis key prefix for membership and claims (default: "<state.redis.key_prefix>:shard")
+	Shards            int           `yaml:"shards"`             // Number of key shards; the same on every instance (default: 64)
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"` // How often membership is refreshed (default: 5s)
+	MemberTTL         time.Duration `yaml:"member_ttl"`         // An instance without a heartbeat for this long leaves the ring (default: 15s)
+	ClaimTTL          time.Duration `yaml:"claim_ttl"`          // How long a file claim prevents other instances from sending it (default: 1h)
+}
+
+// KubernetesConfig holds the settings for running as the pods of a Deployment. The API server
+// is reached with the pod's service account, and the pod's name and namespace come from the
+// downward API (POD_NAME and POD_NAMESPACE).
+type KubernetesConfig struct {
+	Enabled   bool   `yaml:"enabled"`   // Use the pod name as identity, a Lease for leader election and annotate the pod with its shards
+	Namespace string `yaml:"namespace"` // Namespace of the pod and the Lease (default: $POD_NAMESPACE, then the service account's namespace)
+	PodName   string `yaml:"pod_name"`  // Name of this pod (default: $POD_NAME, then the hostname)
+}
+
+// LoggingConfig holds the logging settings
+type LoggingConfig struct {
+	Level    string                 `yaml:"level"`    // debug, info, warn or error (default: info)
+	Format   string                 `yaml:"format"`   // json or text (default: json)
+	Output   string                 `yaml:"output"`   // stdout, file or both (default: stdout)
+	File     logging.FileConfig     `yaml:"file"`     // Rotating log file, for file and both output
+	Sampling logging.SamplingConfig `yaml:"sampling"` // Suppression of repeated warnings and errors (default: 10 per message per 1m, window -1s = off)
+	Levels   map[string]string      `yaml:"levels"`   // Level by component, overriding level (e.g. {scanner: debug, http_sender: warn})
+
+	AddSource   bool `yaml:"add_source"`   // Add the file:line of the logging call to each record
+	StackTraces bool `yaml:"stack_traces"` // Add the caller's stack trace to error records
+}
+
+// logComponents are the component loggers logging.levels can set (see logging.Component)
+var logComponents = map[string]bool{
+	"admin":       true,
+	"audit":       true,
+	"config":      true,
+	"credentials": true,
+	"health":      true,
+	"http_sender": true,
+	"leader":      true,
+	"scanner":     true,
+	"shard":       true,
+	"state":       true,
+	"worker":      true,
+}
+
+// OTLPConfig holds the OTLP metrics exporter settings
+type OTLPConfig struct {
+	Enabled        bool          `yaml:"enabled"`         // Enable OTLP metrics export
+	Endpoint       string        `yaml:"endpoint"`        // OTLP gRPC endpoint (e.g., "localhost:4317")
+	ExportInterval time.Duration `yaml:"export_interval"` // How often to export metrics (default: 10s)
+	ServiceName    string        `yaml:"service_name"`    // Service name for metrics (default: "s3-edgedelta-streamer")
+	ServiceVersion string        `yaml:"service_version"` // Service version
+	Insecure       bool          `yaml:"insecure"`        // Use insecure connection (no TLS)
+
+	Protocol           string            `yaml:"protocol"`              // grpc or http (default: grpc)
+	Headers            map[string]string `yaml:"headers" secret:"true"` // Sent with every export (e.g. an API key)
+	CAFile             string            `yaml:"ca_file"`               // Extra CA to trust (PEM)
+	CertFile           string            `yaml:"cert_file"`             // Client certificate (PEM), with key_file
+	KeyFile            string            `yaml:"key_file"`              // Client certificate key (PEM)
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`  // Skip server certificate verification
+
+	Temporality      string               `yaml:"temporality"`       // cumulative or delta (default: cumulative)
+	HistogramBuckets map[string][]float64 `yaml:"histogram_buckets"` // Bucket boundaries by histogram name, or "default" for the rest (all exporters)
+	Exemplars        string               `yaml:"exemplars"`         // Latency measurements kept as exemplars: trace_based, always_on, always_off (default: trace_based)
+
+	Logs OTLPLogsConfig `yaml:"logs"` // Export of the streamer's own logs to the same collector
+}
+
+// OTLPLogsConfig holds the settings for exporting the streamer's own logs as OTLP log
+// records. The endpoint, protocol, headers and TLS settings are shared with the metrics.
+type OTLPLogsConfig struct {
+	Enabled bool   `yaml:"enabled"` // Export logs (independent of otlp.enabled)
+	Level   string `yaml:"level"`   // Minimum level exported: debug, info, warn or error (default: info)
+}
+
+// MetricsConfig selects the metrics exporters
+type MetricsConfig struct {
+	Exporter          string `yaml:"exporter"`           // otlp, prometheus, or both (default: otlp)
+	PrometheusAddress string `yaml:"prometheus_address"` // Dedicated /metrics listener (default: served by the health server)
+	PrometheusPath    string `yaml:"prometheus_path"`    // Scrape path (default: "/metrics")
+
+	MaxDimensionValues int `yaml:"max_dimension_values"` // Distinct bucket/prefix/format values reported each (default: 100, -1 = unlimited)
+
+	CloudWatch CloudWatchConfig `yaml:"cloudwatch"` // Also publish core metrics to CloudWatch (optional)
+	StatsD     StatsDConfig     `yaml:"statsd"`     // Also send metrics to a StatsD/DogStatsD agent (optional)
+}
+
+// CloudWatchConfig publishes the core metrics (files, bytes, errors, lag) as CloudWatch custom metrics
+type CloudWatchConfig struct {
+	Enabled    bool              `yaml:"enabled"`
+	Namespace  string            `yaml:"namespace"`  // Default: "S3EdgeDeltaStreamer"
+	Region     string            `yaml:"region"`     // Default: s3.region
+	Interval   time.Duration     `yaml:"interval"`   // How often to publish (default: 60s)
+	Dimensions map[string]string `yaml:"dimensions"` // Added to every metric, e.g. {Instance: streamer-1}
+}
+
+// StatsDConfig sends the metrics to a StatsD or DogStatsD agent (e.g. the Datadog agent) over UDP
+type StatsDConfig struct {
+	Enabled  bool              `yaml:"enabled"`
+	Address  string            `yaml:"address"`  // Agent address (default: "127.0.0.1:8125")
+	Prefix   string            `yaml:"prefix"`   // Metric name prefix (default: "s3_streamer")
+	Flavor   string            `yaml:"flavor"`   // dogstatsd (tags) or statsd (no tags) (default: dogstatsd)
+	Interval time.Duration     `yaml:"interval"` // How often to send (default: 10s)
+	Tags     map[string]string `yaml:"tags"`     // Added to every metric (dogstatsd only), e.g. {env: prod}
+}
+
+// HealthConfig holds the health check server settings
+type HealthConfig struct {
+	Enabled    bool   `yaml:"enabled"`                   // Enable health check server
+	Address    string `yaml:"address"`                   // Health check server address (default: ":8080")
+	Path       string `yaml:"path"`                      // Health check path (default: "/health")
+	AdminToken string `yaml:"admin_token" secret:"true"` // Bearer token for the /api/ admin endpoints (admin API disabled when empty)
+	Debug      bool   `yaml:"debug"`                     // Serve /debug/pprof/ and /api/debug/runtime (requires admin_token)
+
+	// Pipeline thresholds (0 disables each)
+	MaxLag           time.Duration `yaml:"max_lag"`           // Processing lag that reports degraded
+	UnhealthyLag     time.Duration `yaml:"unhealthy_lag"`     // Processing lag that reports unhealthy
+	MaxErrorRate     float64       `yaml:"max_error_rate"`    // Fraction (0-1) of files failing that reports degraded
+	ErrorRateWindow  time.Duration `yaml:"error_rate_window"` // Window the error rate is measured over (default: 5m)
+	BufferFullFor    time.Duration `yaml:"buffer_full_for"`   // Time the HTTP buffer may stay full before reporting unhealthy
+	SaturatedFor     time.Duration `yaml:"saturated_for"`     // Time the file queue or HTTP buffer may stay full before /ready fails
+	CredentialExpiry time.Duration `yaml:"credential_expiry"` // Time left on AWS session credentials that reports degraded
 }
 
 // Config holds the application configuration
 type Config struct {
-	S3 struct {
-		Bucket string `yaml:"bucket"`
-		Prefix string `yaml:"prefix"`
-		Region string `yaml:"region"`
-	} `yaml:"s3"`
-
-	HTTP struct {
-		Endpoints             []string      `yaml:"endpoints"`               // EdgeDelta HTTP input endpoints (load balanced across workers)
-		BatchLines            int           `yaml:"batch_lines"`             // Max lines per batch (default: 1000)
-		BatchBytes            int           `yaml:"batch_bytes"`             // Max bytes per batch (default: 1MB)
-		FlushInterval         time.Duration `yaml:"flush_interval"`          // Force flush after this duration (default: 1s)
-		Workers               int           `yaml:"workers"`                 // Number of parallel HTTP senders (default: 10)
-		BufferSize            int           `yaml:"buffer_size"`             // Size of line buffer (default: 10000)
-		Timeout               time.Duration `yaml:"timeout"`                 // HTTP request timeout (default: 30s)
-		MaxIdleConns          int           `yaml:"max_idle_conns"`          // HTTP connection pool size (default: 100)
-		IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`       // How long idle connections stay alive (default: 90s)
-		TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`   // TLS handshake timeout (default: 10s)
-		ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"` // Response header timeout (default: 10s)
-		ExpectContinueTimeout time.Duration `yaml:"expect_continue_timeout"` // Expect continue timeout (default: 1s)
-	} `yaml:"http"`
-
-	Processing struct {
-		WorkerCount   int            `yaml:"worker_count"`
-		QueueSize     int            `yaml:"queue_size"`
-		ScanInterval  time.Duration  `yaml:"scan_interval"`
-		DelayWindow   time.Duration  `yaml:"delay_window"`
-		LogFormats    []FormatConfig `yaml:"log_formats"`    // Custom format definitions
-		DefaultFormat string         `yaml:"default_format"` // Default format name or "auto"
-		LogFormat     string         `yaml:"log_format"`     // DEPRECATED: Legacy single format field
-	} `yaml:"processing"`
-
-	State struct {
-		FilePath     string        `yaml:"file_path"`
-		SaveInterval time.Duration `yaml:"save_interval"`
-		Redis        RedisConfig   `yaml:"redis"` // Redis configuration for state storage
-	} `yaml:"state"`
-
-	Logging struct {
-		Level  string `yaml:"level"`
-		Format string `yaml:"format"`
-	} `yaml:"logging"`
-
-	OTLP struct {
-		Enabled        bool          `yaml:"enabled"`         // Enable OTLP metrics export
-		Endpoint       string        `yaml:"endpoint"`        // OTLP gRPC endpoint (e.g., "localhost:4317")
-		ExportInterval time.Duration `yaml:"export_interval"` // How often to export metrics (default: 10s)
-		ServiceName    string        `yaml:"service_name"`    // Service name for metrics (default: "s3-edgedelta-streamer")
-		ServiceVersion string        `yaml:"service_version"` // Service version
-		Insecure       bool          `yaml:"insecure"`        // Use insecure connection (no TLS)
-	} `yaml:"otlp"`
-
-	Health struct {
-		Enabled bool   `yaml:"enabled"` // Enable health check server
-		Address string `yaml:"address"` // Health check server address (default: ":8080")
-		Path    string `yaml:"path"`    // Health check path (default: "/health")
-	} `yaml:"health"`
-}
-
-// Load reads and parses the configuration file
+	S3         S3Config         `yaml:"s3"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Processing ProcessingConfig `yaml:"processing"`
+	State      StateConfig      `yaml:"state"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	OTLP       OTLPConfig       `yaml:"otlp"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Health     HealthConfig     `yaml:"health"`
+
+	LeaderElection LeaderElectionConfig `yaml:"leader_election"` // Active-passive HA (optional)
+	Sharding       ShardingConfig       `yaml:"sharding"`        // Scale-out across instances (optional)
+	Kubernetes     KubernetesConfig     `yaml:"kubernetes"`      // Pod identity, Lease leader election and shard annotations (optional)
+	Pipelines      []PipelineConfig     `yaml:"pipelines"`       // Named pipelines run in one process (optional)
+	Reload         ReloadConfig         `yaml:"reload"`          // Hot reload of changed settings
+	AWS            AWSConfig            `yaml:"aws"`             // AWS credentials (default: the SDK credential chain)
+	Crash          CrashConfig          `yaml:"crash"`           // Crash reports of unrecovered panics (optional)
+}
+
+// CrashConfig holds where crash reports are written (see crash.Reporter)
+type CrashConfig struct {
+	Dir        string `yaml:"dir"`         // Report directory (empty = no reports)
+	MaxReports int    `yaml:"max_reports"` // Reports kept; older ones are removed (default: 10)
+}
+
+// AWSConfig holds how AWS credentials are obtained. The SDK credential chain (environment,
+// shared config, instance or task role) provides the base credentials, which may then assume a role.
+// The credential source is re-read every refresh_interval and on SIGHUP, so rotated keys are
+// picked up without a restart.
+type AWSConfig struct {
+	Profile           string           `yaml:"profile"`            // Shared config/credentials profile for the base credentials (default: the SDK chain or the encrypted credentials)
+	AssumeRole        AssumeRoleConfig `yaml:"assume_role"`        // Role assumed with the base credentials (optional)
+	RefreshInterval   time.Duration    `yaml:"refresh_interval"`   // How often the credential source is re-read (default: 5m, -1s = only on SIGHUP)
+	CredentialTimeout time.Duration    `yaml:"credential_timeout"` // Limit on each credential retrieval from IMDS, the ECS endpoint or STS (default: 30s)
+	IMDS              IMDSConfig       `yaml:"imds"`
+}
+
+// IMDSConfig tunes the EC2 instance metadata service lookup at the end of the SDK credential chain
+type IMDSConfig struct {
+	Disabled    bool          `yaml:"disabled"`     // Never query instance metadata (on-premises hosts, where the probe only delays startup)
+	Endpoint    string        `yaml:"endpoint"`     // Metadata endpoint (default: http://169.254.169.254)
+	Timeout     time.Duration `yaml:"timeout"`      // Per-request timeout (default: 1s)
+	MaxAttempts int           `yaml:"max_attempts"` // Attempts per metadata request (default: 3)
+	RequireV2   bool          `yaml:"require_v2"`   // Fail instead of falling back to IMDSv1 when the IMDSv2 token request fails
+}
+
+// AssumeRoleConfig holds the STS role assumed for S3 and the other AWS APIs (optional)
+type AssumeRoleConfig struct {
+	RoleARN     string        `yaml:"role_arn"`     // Role to assume (AssumeRole is skipped when empty)
+	SessionName string        `yaml:"session_name"` // Role session name, shown in CloudTrail (default: "s3-edgedelta-streamer")
+	ExternalID  string        `yaml:"external_id"`  // External ID required by the role's trust policy (optional)
+	Duration    time.Duration `yaml:"duration"`     // Session duration, 15m-12h (default: 1h); sessions renew before expiry
+	MFASerial   string        `yaml:"mfa_serial"`   // MFA device ARN; the token code is read from stdin (interactive tools only, rejected by run)
+}
+
+// ReloadConfig holds the configuration reload settings. A changed configuration is also
+// reloaded on SIGHUP.
+type ReloadConfig struct {
+	WatchInterval time.Duration `yaml:"watch_interval"` // How often the configuration is checked for changes (0 = only on SIGHUP)
+}
+
+// UsesRedis reports whether the streamer connects to Redis: for state, the Redis leader lock
+// or shard membership
+func (c *Config) UsesRedis() bool {
+	return c.State.Redis.Enabled || (c.LeaderElection.Enabled && c.LeaderElection.Backend == "redis") || c.Sharding.Enabled
+}
+
+// MetricsExporters reports which metrics exporters are enabled. OTLP also needs otlp.enabled.
+func (c *Config) MetricsExporters() (otlp, prometheus bool) {
+	otlp = c.OTLP.Enabled && (c.Metrics.Exporter == "" || c.Metrics.Exporter == "otlp" || c.Metrics.Exporter == "both")
+	prometheus = c.Metrics.Exporter == "prometheus" || c.Metrics.Exporter == "both"
+	return otlp, prometheus
+}
+
+// LoggerConfig returns the logger settings, with OTLP export when otlp.logs.enabled is set.
+// tlsConfig is the OTLP TLS configuration (nil for the system defaults).
+func (c *Config) LoggerConfig(tlsConfig *tls.Config) logging.Config {
+	cfg := logging.Config{
+		Level:    c.Logging.Level,
+		Format:   c.Logging.Format,
+		Output:   c.Logging.Output,
+		File:     c.Logging.File,
+		Sampling: c.Logging.Sampling,
+		Levels:   c.Logging.Levels,
+
+		AddSource:   c.Logging.AddSource,
+		StackTraces: c.Logging.StackTraces,
+	}
+	if c.OTLP.Logs.Enabled {
+		cfg.OTLP = &logging.OTLPOptions{
+			Endpoint:       c.OTLP.Endpoint,
+			Protocol:       c.OTLP.Protocol,
+			Insecure:       c.OTLP.Insecure,
+			Headers:        c.OTLP.Headers,
+			TLS:            tlsConfig,
+			ServiceName:    c.OTLP.ServiceName,
+			ServiceVersion: c.OTLP.ServiceVersion,
+			Level:          c.OTLP.Logs.Level,
+		}
+	}
+	return cfg
+}
+
+// Load reads and parses the configuration file, with the files it includes (see
+// readDocument), and applies the defaults. path may also be a remote location:
+// s3://bucket/key, ssm://parameter-name or secretsmanager://secret-id (see remoteSource).
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	ctx := context.Background()
+	doc, _, err := readDocument(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
+	return build(ctx, doc, nil, nil)
+}
 
+// build decodes a configuration document, applies overrides (optional) with environ, resolves
+// secret references (see secretResolver) and then applies the defaults, so defaults derived
+// from other settings follow their overridden values
+func build(ctx context.Context, doc *yaml.Node, overrides *Overrides, environ []string) (*Config, error) {
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := doc.Decode(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
-
+	if overrides != nil {
+		if err := overrides.Apply(&cfg, environ); err != nil {
+			return nil, err
+		}
+	}
+	if err := newSecretResolver().resolveSecrets(ctx, reflect.ValueOf(&cfg).Elem(), ""); err != nil {
+		return nil, fmt.Errorf("failed to resolve secret: %w", err)
+	}
+	cfg.ApplyDefaults()
 	return &cfg, nil
 }
 
-// Validate checks the configuration for required fields and valid values
+// Validate checks the configuration for required fields and valid values. It does not
+// modify the configuration; call ApplyDefaults first (Load does).
 func (c *Config) Validate() error {
 	var errs []string
 
-	// Validate S3 configuration
-	if c.S3.Bucket == "" {
+	// Validate S3 configuration (pipelines may each name their own bucket)
+	if c.S3.Bucket == "" && !c.allPipelines(func(p PipelineConfig) bool { return p.Bucket != "" }) {
 		errs = append(errs, "s3.bucket is required")
 	}
 	if c.S3.Region == "" {
 		errs = append(errs, "s3.region is required")
 	}
 
-	// Validate HTTP configuration
-	if len(c.HTTP.Endpoints) == 0 {
+	// Validate HTTP configuration (pipelines may each name their own endpoints)
+	if len(c.HTTP.Endpoints) == 0 && !c.allPipelines(func(p PipelineConfig) bool { return len(p.Endpoints) > 0 }) {
 		errs = append(errs, "http.endpoints must contain at least one endpoint")
 	}
 	for i, endpoint := range c.HTTP.Endpoints {
-		if endpoint == "" {
-			errs = append(errs, fmt.Sprintf("http.endpoints[%d] cannot be empty", i))
-			continue
+		if err := validateEndpointURL(endpoint); err != nil {
+			errs = append(errs, fmt.Sprintf("http.endpoints[%d] %v", i, err))
 		}
-		if parsed, err := url.Parse(endpoint); err != nil {
-			errs = append(errs, fmt.Sprintf("http.endpoints[%d] is not a valid URL: %v", i, err))
-		} else if parsed.Scheme != "http" && parsed.Scheme != "https" {
-			errs = append(errs, fmt.Sprintf("http.endpoints[%d] must use http or https scheme", i))
+	}
+
+	// Validate named pipelines
+	errs = append(errs, c.validatePipelines()...)
+
+	// Validate extra HTTP headers
+	errs = append(errs, validateHeaders("http.headers", c.HTTP.Headers)...)
+	for endpoint, headers := range c.HTTP.EndpointHeaders {
+		known := false
+		for _, e := range c.HTTP.Endpoints {
+			if e == endpoint {
+				known = true
+				break
+			}
+		}
+		if !known {
+			errs = append(errs, fmt.Sprintf("http.endpoint_headers[%q] does not match any configured endpoint", endpoint))
 		}
+		errs = append(errs, validateHeaders(fmt.Sprintf("http.endpoint_headers[%q]", endpoint), headers)...)
 	}
 
 	// Validate batch settings
@@ -154,13 +547,42 @@ func (c *Config) Validate() error {
 		errs = append(errs, "http.buffer_size cannot exceed 100,000")
 	}
 
+	// Validate buffer full policy
+	switch c.HTTP.BufferPolicy {
+	case "block", "drop_newest", "drop_oldest", "block_with_timeout":
+	default:
+		errs = append(errs, "http.buffer_policy must be one of: block, drop_newest, drop_oldest, block_with_timeout")
+	}
+	if c.HTTP.BufferBlockTimeout < 0 {
+		errs = append(errs, "http.buffer_block_timeout cannot be negative")
+	}
+
+	// Validate retry settings
+	if c.HTTP.MaxRetries < -1 {
+		errs = append(errs, "http.max_retries must be -1 (disabled) or greater")
+	}
+	if c.HTTP.RetryBackoff < 0 || c.HTTP.RetryMaxBackoff < c.HTTP.RetryBackoff {
+		errs = append(errs, "http.retry_backoff must be positive and not exceed http.retry_max_backoff")
+	}
+
+	// Validate shutdown drain settings
+	if c.HTTP.DrainTimeout < 0 {
+		errs = append(errs, "http.drain_timeout cannot be negative")
+	}
+
 	// Validate worker settings
 	if c.HTTP.Workers <= 0 {
 		errs = append(errs, "http.workers must be greater than 0")
 	}
+	if c.HTTP.MaxInFlight < 0 {
+		errs = append(errs, "http.max_in_flight cannot be negative")
+	}
 	if c.Processing.WorkerCount <= 0 {
 		errs = append(errs, "processing.worker_count must be greater than 0")
 	}
+	if c.Processing.QueueSize <= 0 {
+		errs = append(errs, "processing.queue_size must be greater than 0")
+	}
 
 	// Validate timing settings
 	if c.HTTP.FlushInterval <= 0 {
@@ -172,6 +594,80 @@ func (c *Config) Validate() error {
 	if c.Processing.ScanInterval <= 0 {
 		errs = append(errs, "processing.scan_interval must be greater than 0")
 	}
+	if c.Processing.FileTimeout < 0 {
+		errs = append(errs, "processing.file_timeout cannot be negative")
+	}
+
+	// Validate failed-file retries
+	retry := c.Processing.Retry
+	if retry.MaxAttempts == 0 || retry.MaxAttempts < -1 {
+		errs = append(errs, "processing.retry.max_attempts must be -1 (disabled) or greater than 0")
+	}
+	if retry.Backoff < 0 {
+		errs = append(errs, "processing.retry.backoff cannot be negative")
+	}
+	if retry.MaxBackoff < retry.Backoff {
+		errs = append(errs, "processing.retry.max_backoff cannot be less than processing.retry.backoff")
+	}
+
+	if c.Processing.Audit.Capacity == 0 || c.Processing.Audit.Capacity < -1 {
+		errs = append(errs, "processing.audit.capacity must be -1 (disabled) or greater than 0")
+	}
+
+	if c.Processing.Report.MaxSizeMB < 0 || c.Processing.Report.MaxBackups < 0 {
+		errs = append(errs, "processing.report.max_size_mb and max_backups cannot be negative")
+	}
+
+	mp := c.Processing.Multipart
+	if mp.ThresholdMB == 0 || mp.ThresholdMB < -1 {
+		errs = append(errs, "processing.multipart_download.threshold_mb must be -1 (disabled) or greater than 0")
+	}
+	if mp.PartSizeMB <= 0 {
+		errs = append(errs, "processing.multipart_download.part_size_mb must be greater than 0")
+	}
+	if mp.Concurrency <= 0 {
+		errs = append(errs, "processing.multipart_download.concurrency must be greater than 0")
+	}
+	if c.Processing.DecodeReadAhead < 0 {
+		errs = append(errs, "processing.decode_read_ahead cannot be negative")
+	}
+	if c.Processing.MaxLineKB < 0 {
+		errs = append(errs, "processing.max_line_kb cannot be negative")
+	}
+	switch c.Processing.LongLines {
+	case "fail", "truncate", "split", "skip":
+	default:
+		errs = append(errs, "processing.long_lines must be one of: fail, truncate, split, skip")
+	}
+	if c.Processing.StrictOrdering && c.Sharding.Enabled {
+		errs = append(errs, "processing.strict_ordering cannot be used with sharding (a stream's files are split across instances)")
+	}
+
+	// Validate worker autoscaling
+	if as := c.Processing.Autoscale; as.Enabled {
+		if as.MinWorkers <= 0 || as.MaxWorkers < as.MinWorkers {
+			errs = append(errs, "processing.autoscale requires 0 < min_workers <= max_workers")
+		}
+		if as.Interval <= 0 {
+			errs = append(errs, "processing.autoscale.interval must be greater than 0")
+		}
+		if as.QueueHighWater < 0 || as.QueueHighWater > 1 || as.BufferHighWater < 0 || as.BufferHighWater > 1 {
+			errs = append(errs, "processing.autoscale.queue_high_water and buffer_high_water must be between 0 and 1")
+		}
+		if as.ScaleDownCooldown < 0 {
+			errs = append(errs, "processing.autoscale.scale_down_cooldown cannot be negative")
+		}
+	}
+
+	// Validate load shedding
+	if sh := c.Processing.Shed; sh.Enabled {
+		if sh.LowWater <= 0 || sh.HighWater > 1 || sh.LowWater >= sh.HighWater {
+			errs = append(errs, "processing.shed requires 0 < low_water < high_water <= 1")
+		}
+		if sh.For < 0 {
+			errs = append(errs, "processing.shed.for cannot be negative")
+		}
+	}
 
 	// Validate log format configuration
 	if len(c.Processing.LogFormats) > 0 {
@@ -186,21 +682,7 @@ func (c *Config) Validate() error {
 			if format.TimestampRegex == "" {
 				errs = append(errs, fmt.Sprintf("processing.log_formats[%d].timestamp_regex is required", i))
 			}
-			if format.TimestampFormat == "" {
-				format.TimestampFormat = "unix" // Default
-			}
-			if format.ContentType == "" {
-				format.ContentType = "text/plain" // Default
-			}
-			// Update the format in the slice
-			c.Processing.LogFormats[i] = format
 		}
-
-		// Validate default_format
-		if c.Processing.DefaultFormat == "" {
-			c.Processing.DefaultFormat = "auto"
-		}
-
 	} else if c.Processing.LogFormat != "" {
 		// Legacy format: validate old single format field
 		validFormats := []string{"zscaler", "cisco_umbrella", "auto"}
@@ -214,19 +696,90 @@ func (c *Config) Validate() error {
 		if !valid {
 			errs = append(errs, "processing.log_format must be one of: zscaler, cisco_umbrella, auto")
 		}
+	}
 
-		// Set default format for backward compatibility
-		if c.Processing.DefaultFormat == "" {
-			c.Processing.DefaultFormat = c.Processing.LogFormat
+	// Validate output envelopes
+	for name, tmpl := range c.Processing.Envelopes {
+		known := name == "*" || name == "zscaler" || name == "cisco_umbrella"
+		for _, format := range c.Processing.LogFormats {
+			if format.Name == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			errs = append(errs, fmt.Sprintf("processing.envelopes[%q] does not match any log format", name))
 		}
+		if !strings.Contains(tmpl, "{line}") && !strings.Contains(tmpl, "{line_json}") {
+			errs = append(errs, fmt.Sprintf("processing.envelopes[%q] must contain {line} or {line_json}", name))
+		}
+	}
 
-	} else {
-		// No format specified: use defaults
-		c.Processing.DefaultFormat = "zscaler" // Backward compatibility
+	// Validate metrics exporters
+	switch c.Metrics.Exporter {
+	case "otlp", "prometheus", "both":
+	default:
+		errs = append(errs, fmt.Sprintf("metrics.exporter must be one of otlp, prometheus, both (got %q)", c.Metrics.Exporter))
+	}
+	if c.Metrics.MaxDimensionValues == 0 || c.Metrics.MaxDimensionValues < -1 {
+		errs = append(errs, "metrics.max_dimension_values must be positive or -1 (unlimited)")
+	}
+	if cw := c.Metrics.CloudWatch; cw.Enabled {
+		if cw.Namespace == "" {
+			errs = append(errs, "metrics.cloudwatch.namespace is required")
+		}
+		if cw.Region == "" {
+			errs = append(errs, "metrics.cloudwatch.region is required when s3.region is not set")
+		}
+		if cw.Interval < time.Second {
+			errs = append(errs, "metrics.cloudwatch.interval must be at least 1s")
+		}
+		if len(cw.Dimensions) > 29 {
+			errs = append(errs, "metrics.cloudwatch.dimensions allows at most 29 entries")
+		}
+	}
+	if sd := c.Metrics.StatsD; sd.Enabled {
+		if sd.Address == "" {
+			errs = append(errs, "metrics.statsd.address is required")
+		}
+		switch sd.Flavor {
+		case "dogstatsd":
+		case "statsd":
+			if len(sd.Tags) > 0 {
+				errs = append(errs, "metrics.statsd.tags requires flavor dogstatsd")
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("metrics.statsd.flavor must be one of dogstatsd, statsd (got %q)", sd.Flavor))
+		}
+		if sd.Interval < time.Second {
+			errs = append(errs, "metrics.statsd.interval must be at least 1s")
+		}
+	}
+	if c.Health.Debug && c.Health.AdminToken == "" {
+		errs = append(errs, "health.admin_token is required when health.debug is true")
+	}
+	if c.Health.MaxLag < 0 || c.Health.UnhealthyLag < 0 || c.Health.BufferFullFor < 0 || c.Health.ErrorRateWindow < 0 || c.Health.SaturatedFor < 0 || c.Health.CredentialExpiry < 0 {
+		errs = append(errs, "health.max_lag, unhealthy_lag, error_rate_window, buffer_full_for, saturated_for and credential_expiry must not be negative")
+	}
+	if c.Health.MaxLag > 0 && c.Health.UnhealthyLag > 0 && c.Health.UnhealthyLag < c.Health.MaxLag {
+		errs = append(errs, "health.unhealthy_lag must be at least health.max_lag")
+	}
+	errs = append(errs, validateAWS("aws", c.AWS)...)
+	if c.S3.AWSProfile != "" && c.AWS.Profile != c.S3.AWSProfile {
+		errs = append(errs, fmt.Sprintf("s3.aws_profile %q conflicts with aws.profile %q; set only one", c.S3.AWSProfile, c.AWS.Profile))
+	}
+	if c.Reload.WatchInterval < 0 {
+		errs = append(errs, "reload.watch_interval cannot be negative")
+	}
+	if c.Health.MaxErrorRate < 0 || c.Health.MaxErrorRate > 1 {
+		errs = append(errs, "health.max_error_rate must be between 0 and 1")
+	}
+	if _, prometheus := c.MetricsExporters(); prometheus && c.Metrics.PrometheusAddress == "" && !c.Health.Enabled {
+		errs = append(errs, "metrics.prometheus_address is required when the health server is disabled")
 	}
 
 	// Validate OTLP configuration if enabled
-	if c.OTLP.Enabled {
+	if otlp, _ := c.MetricsExporters(); otlp {
 		if c.OTLP.Endpoint == "" {
 			errs = append(errs, "otlp.endpoint is required when otlp.enabled is true")
 		}
@@ -236,22 +789,137 @@ func (c *Config) Validate() error {
 		if c.OTLP.ExportInterval <= 0 {
 			errs = append(errs, "otlp.export_interval must be greater than 0")
 		}
+		if c.OTLP.Protocol != "grpc" && c.OTLP.Protocol != "http" {
+			errs = append(errs, fmt.Sprintf("otlp.protocol must be one of grpc, http (got %q)", c.OTLP.Protocol))
+		}
+		for name := range c.OTLP.Headers {
+			if strings.TrimSpace(name) == "" {
+				errs = append(errs, "otlp.headers contains an empty header name")
+			}
+		}
+		if (c.OTLP.CertFile == "") != (c.OTLP.KeyFile == "") {
+			errs = append(errs, "otlp.cert_file and otlp.key_file must be set together")
+		}
+		if c.OTLP.Temporality != "cumulative" && c.OTLP.Temporality != "delta" {
+			errs = append(errs, fmt.Sprintf("otlp.temporality must be one of cumulative, delta (got %q)", c.OTLP.Temporality))
+		}
 	}
-
-	// Validate Redis configuration if enabled
-	if c.State.Redis.Enabled {
-		if c.State.Redis.Host == "" {
-			c.State.Redis.Host = "localhost" // Default
+	switch c.OTLP.Exemplars {
+	case "trace_based", "always_on", "always_off":
+	default:
+		errs = append(errs, fmt.Sprintf("otlp.exemplars must be one of trace_based, always_on, always_off (got %q)", c.OTLP.Exemplars))
+	}
+	for name, bounds := range c.OTLP.HistogramBuckets {
+		if len(bounds) == 0 {
+			errs = append(errs, fmt.Sprintf("otlp.histogram_buckets[%q] must list at least one boundary", name))
 		}
-		if c.State.Redis.Port == 0 {
-			c.State.Redis.Port = 6379 // Default Redis port
+		for i := 1; i < len(bounds); i++ {
+			if bounds[i] <= bounds[i-1] {
+				errs = append(errs, fmt.Sprintf("otlp.histogram_buckets[%q] must be in increasing order", name))
+				break
+			}
 		}
-		if c.State.Redis.KeyPrefix == "" {
-			c.State.Redis.KeyPrefix = "s3-streamer" // Default key prefix
+	}
+
+	// Validate state retention
+	if c.State.Retention < 0 {
+		errs = append(errs, "state.retention cannot be negative")
+	}
+	if c.State.InFlightStaleAfter < 0 {
+		errs = append(errs, "state.in_flight_stale_after cannot be negative")
+	}
+	if c.State.CompactionInterval < 0 {
+		errs = append(errs, "state.compaction_interval cannot be negative")
+	}
+
+	// Validate Redis configuration if enabled (leader election shares the connection settings)
+	if c.UsesRedis() {
+		if c.State.Redis.Host == "" || c.State.Redis.Port <= 0 {
+			errs = append(errs, "state.redis.host and state.redis.port are required")
 		}
 		if c.State.Redis.Database < 0 || c.State.Redis.Database > 15 {
 			errs = append(errs, "state.redis.database must be between 0 and 15")
 		}
+		if c.State.Redis.ProcessedTTL < 0 {
+			errs = append(errs, "state.redis.processed_ttl cannot be negative")
+		}
+	}
+
+	// Validate SQL configuration if enabled
+	if c.State.SQL.Enabled {
+		switch c.State.SQL.Driver {
+		case "sqlite", "sqlite3", "postgres", "pgx":
+			// database/sql fails on first use of a driver the binary does not register; the
+			// SQLite driver needs cgo, so CGO_ENABLED=0 builds leave it out
+			if !slices.Contains(sql.Drivers(), c.State.SQL.DriverName()) {
+				errs = append(errs, fmt.Sprintf("state.sql.driver %q is not built into this binary (built in: %s); SQLite needs a build with CGO_ENABLED=1", c.State.SQL.Driver, sqlDrivers()))
+			}
+		default:
+			errs = append(errs, "state.sql.driver must be one of: sqlite, sqlite3, postgres, pgx")
+		}
+		if c.State.SQL.DSN == "" {
+			errs = append(errs, "state.sql.dsn is required when state.sql.enabled is true")
+		}
+		if !sqlIdentifier.MatchString(c.State.SQL.Table) {
+			errs = append(errs, "state.sql.table must contain only letters, digits and underscores")
+		}
+		if c.State.Redis.Enabled {
+			errs = append(errs, "state.sql and state.redis cannot both be enabled")
+		}
+	}
+
+	// Validate KV configuration if enabled
+	if c.State.KV.Enabled {
+		switch c.State.KV.Backend {
+		case "consul", "etcd":
+		default:
+			errs = append(errs, "state.kv.backend must be one of: consul, etcd")
+		}
+		if c.State.KV.Key == "" {
+			errs = append(errs, "state.kv.key is required")
+		}
+		if c.State.KV.Timeout < 0 {
+			errs = append(errs, "state.kv.timeout cannot be negative")
+		}
+		if c.State.KV.Backend == "etcd" && c.State.KV.Token != "" {
+			errs = append(errs, "state.kv.token is only supported with consul; use state.kv.username and state.kv.password for etcd")
+		}
+		if c.State.KV.Backend != "etcd" && (c.State.KV.Username != "" || c.State.KV.Password != "") {
+			errs = append(errs, "state.kv.username and state.kv.password are only supported with etcd")
+		}
+		if (c.State.KV.Username == "") != (c.State.KV.Password == "") {
+			errs = append(errs, "state.kv.username and state.kv.password must be set together")
+		}
+		if c.State.Redis.Enabled || c.State.SQL.Enabled {
+			errs = append(errs, "only one of state.redis, state.sql and state.kv can be enabled")
+		}
+	}
+
+	if c.State.Snapshot.Enabled {
+		snap := c.State.Snapshot
+		if snap.Bucket == "" {
+			errs = append(errs, "state.snapshot.bucket is required when s3.bucket is not set")
+		}
+		if snap.Key == "" {
+			errs = append(errs, "state.snapshot.key is required")
+		}
+		if snap.Interval < 0 {
+			errs = append(errs, "state.snapshot.interval cannot be negative")
+		}
+	}
+
+	// Validate leader election
+	if c.LeaderElection.Enabled {
+		errs = append(errs, c.validateLeaderElection()...)
+	}
+
+	// Validate sharding
+	if c.Sharding.Enabled {
+		errs = append(errs, c.validateSharding()...)
+	}
+
+	if c.Kubernetes.Enabled && c.Kubernetes.PodName == "" {
+		errs = append(errs, "kubernetes.pod_name is required when POD_NAME and the hostname are unavailable")
 	}
 
 	// Validate logging configuration
@@ -263,6 +931,43 @@ func (c *Config) Validate() error {
 	if !validLogFormats[strings.ToLower(c.Logging.Format)] {
 		errs = append(errs, "logging.format must be one of: json, text")
 	}
+	switch strings.ToLower(c.Logging.Output) {
+	case "stdout":
+	case "file", "both":
+		if c.Logging.File.Path == "" {
+			errs = append(errs, fmt.Sprintf("logging.file.path is required for %s output", c.Logging.Output))
+		}
+	default:
+		errs = append(errs, "logging.output must be one of: stdout, file, both")
+	}
+	if c.Logging.File.MaxSizeMB < 0 || c.Logging.File.MaxBackups < 0 || c.Logging.File.MaxAgeDays < 0 {
+		errs = append(errs, "logging.file.max_size_mb, max_backups and max_age_days must not be negative")
+	}
+	if c.Logging.Sampling.Burst < 0 {
+		errs = append(errs, "logging.sampling.burst must not be negative")
+	}
+	for _, component := range sortedKeys(c.Logging.Levels) {
+		if !logComponents[component] {
+			errs = append(errs, fmt.Sprintf("logging.levels: unknown component %q (must be one of %s)", component, strings.Join(sortedKeys(logComponents), ", ")))
+		} else if !validLogLevels[strings.ToLower(c.Logging.Levels[component])] {
+			errs = append(errs, fmt.Sprintf("logging.levels.%s must be one of: debug, info, warn, error", component))
+		}
+	}
+	if c.Crash.MaxReports < 0 {
+		errs = append(errs, "crash.max_reports must not be negative")
+	}
+
+	if c.OTLP.Logs.Enabled {
+		if c.OTLP.Endpoint == "" {
+			errs = append(errs, "otlp.endpoint is required when otlp.logs.enabled is true")
+		}
+		if otlp, _ := c.MetricsExporters(); !otlp && c.OTLP.Protocol != "grpc" && c.OTLP.Protocol != "http" {
+			errs = append(errs, fmt.Sprintf("otlp.protocol must be one of grpc, http (got %q)", c.OTLP.Protocol))
+		}
+		if !validLogLevels[strings.ToLower(c.OTLP.Logs.Level)] {
+			errs = append(errs, "otlp.logs.level must be one of: debug, info, warn, error")
+		}
+	}
 
 	if len(errs) > 0 {
 		return errors.New("configuration validation failed:\n" + strings.Join(errs, "\n"))
@@ -270,3 +975,206 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// ValidateService checks the settings the long-running service (the run command) cannot
+// use on top of Validate: the MFA token code of assume_role.mfa_serial is read from stdin,
+// which a service does not have, and would be prompted for again on every role refresh.
+func (c *Config) ValidateService() error {
+	var errs []string
+	if c.AWS.AssumeRole.MFASerial != "" {
+		errs = append(errs, "aws.assume_role.mfa_serial reads a token code from stdin and cannot be used by run; use it with interactive commands such as check")
+	}
+	for i, p := range c.Pipelines {
+		if p.AWS != nil && p.AWS.AssumeRole.MFASerial != "" {
+			errs = append(errs, fmt.Sprintf("pipelines[%d].aws.assume_role.mfa_serial reads a token code from stdin and cannot be used by run", i))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("configuration validation failed:\n" + strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, for stable validation messages
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateLeaderElection checks the leader election settings
+func (c *Config) validateLeaderElection() []string {
+	var errs []string
+	le := c.LeaderElection
+	switch le.Backend {
+	case "redis":
+	case "kubernetes":
+		if !c.Kubernetes.Enabled {
+			errs = append(errs, "leader_election.backend kubernetes requires kubernetes.enabled")
+		}
+		if le.Key != "" && !validObjectName(le.Key) {
+			errs = append(errs, fmt.Sprintf("leader_election.key must be a valid Lease name (lower case letters, digits, '-' and '.'), got %q", le.Key))
+		}
+	default:
+		errs = append(errs, "leader_election.backend must be one of: redis, kubernetes")
+	}
+	if le.Key == "" {
+		errs = append(errs, "leader_election.key is required")
+	}
+	if le.Identity == "" {
+		errs = append(errs, "leader_election.identity is required when the hostname is unavailable")
+	}
+	if le.RenewInterval <= 0 || le.LeaseDuration < 2*le.RenewInterval {
+		errs = append(errs, "leader_election.renew_interval must be positive and at most half of leader_election.lease_duration")
+	}
+	// The standby can only resume where the leader stopped if both see the same checkpoint
+	if !c.State.Redis.Enabled && !c.State.SQL.Enabled && !c.State.KV.Enabled {
+		errs = append(errs, "leader_election requires a shared state backend (state.redis, state.sql or state.kv)")
+	}
+	return errs
+}
+
+// validateSharding checks the sharding settings
+func (c *Config) validateSharding() []string {
+	var errs []string
+	sh := c.Sharding
+	if sh.Identity == "" {
+		errs = append(errs, "sharding.identity is required when the hostname is unavailable")
+	}
+	if sh.KeyPrefix == "" {
+		errs = append(errs, "sharding.key_prefix is required")
+	}
+	if sh.Shards <= 0 || sh.Shards > 4096 {
+		errs = append(errs, "sharding.shards must be between 1 and 4096")
+	}
+	if sh.HeartbeatInterval <= 0 || sh.MemberTTL < 2*sh.HeartbeatInterval {
+		errs = append(errs, "sharding.heartbeat_interval must be positive and at most half of sharding.member_ttl")
+	}
+	if sh.ClaimTTL < 0 {
+		errs = append(errs, "sharding.claim_ttl cannot be negative")
+	}
+	// Shard checkpoints move between instances, so every instance must see and safely merge them
+	if !c.State.SQL.Enabled && !c.State.KV.Enabled && !c.State.Redis.Enabled {
+		errs = append(errs, "sharding requires a shared state backend (state.redis, state.sql or state.kv)")
+	}
+	if c.LeaderElection.Enabled {
+		errs = append(errs, "sharding and leader_election cannot both be enabled")
+	}
+	return errs
+}
+
+// validObjectName reports whether name is a valid Kubernetes object name (a DNS subdomain)
+func validObjectName(name string) bool {
+	return len(name) <= 253 && objectNamePattern.MatchString(name)
+}
+
+var objectNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// hostname returns the host name, or "" if it is unavailable
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// validateEndpointURL checks that an endpoint is a non-empty http(s) URL
+func validateEndpointURL(endpoint string) error {
+	if endpoint == "" {
+		return errors.New("cannot be empty")
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return errors.New("must use http or https scheme")
+	}
+	return nil
+}
+
+// allPipelines reports whether pipelines are defined and every one satisfies fn
+func (c *Config) allPipelines(fn func(PipelineConfig) bool) bool {
+	if len(c.Pipelines) == 0 {
+		return false
+	}
+	for _, p := range c.Pipelines {
+		if !fn(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// headerTemplateVar matches {name} placeholders in header values
+var headerTemplateVar = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// validateAWS checks a credential set's role assumption settings
+func validateAWS(field string, a AWSConfig) []string {
+	var errs []string
+	if role := a.AssumeRole; role.RoleARN != "" {
+		if !strings.HasPrefix(role.RoleARN, "arn:") || !strings.Contains(role.RoleARN, ":role/") {
+			errs = append(errs, fmt.Sprintf("%s.assume_role.role_arn must be an IAM role ARN (got %q)", field, role.RoleARN))
+		}
+		if role.Duration < 15*time.Minute || role.Duration > 12*time.Hour {
+			errs = append(errs, fmt.Sprintf("%s.assume_role.duration must be between 15m and 12h", field))
+		}
+	} else if role.ExternalID != "" || role.MFASerial != "" {
+		errs = append(errs, fmt.Sprintf("%s.assume_role.external_id and mfa_serial require %s.assume_role.role_arn", field, field))
+	}
+	if a.CredentialTimeout <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.credential_timeout must be positive", field))
+	}
+	if a.IMDS.Timeout <= 0 || a.IMDS.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.imds.timeout and max_attempts must be positive", field))
+	}
+	if a.IMDS.Endpoint != "" {
+		if u, err := url.Parse(a.IMDS.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("%s.imds.endpoint must be an http:// URL (got %q)", field, a.IMDS.Endpoint))
+		}
+	}
+	return errs
+}
+
+// sqlDrivers lists the database/sql drivers registered in the binary, for errors
+func sqlDrivers() string {
+	if drivers := sql.Drivers(); len(drivers) > 0 {
+		return strings.Join(drivers, ", ")
+	}
+	return "none"
+}
+
+// sqlIdentifier matches table names safe to interpolate into SQL statements
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// HeaderTemplateVars lists the placeholders that may appear in header values
+var HeaderTemplateVars = []string{"format", "bucket", "s3_key"}
+
+// validateHeaders checks header names and template placeholders
+func validateHeaders(field string, headers map[string]string) []string {
+	var errs []string
+	for name, value := range headers {
+		if strings.TrimSpace(name) == "" {
+			errs = append(errs, fmt.Sprintf("%s contains an empty header name", field))
+			continue
+		}
+		for _, match := range headerTemplateVar.FindAllStringSubmatch(value, -1) {
+			known := false
+			for _, v := range HeaderTemplateVars {
+				if match[1] == v {
+					known = true
+					break
+				}
+			}
+			if !known {
+				errs = append(errs, fmt.Sprintf("%s[%q] uses unknown template variable {%s} (allowed: %s)",
+					field, name, match[1], strings.Join(HeaderTemplateVars, ", ")))
+			}
+		}
+	}
+	return errs
+}
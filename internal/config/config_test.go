@@ -1,7 +1,12 @@
 package config
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -86,6 +91,50 @@ health:
 	}
 }
 
+func TestLoad_EnvSubstitution(t *testing.T) {
+	t.Setenv("TEST_S3_BUCKET", "prod-logs")
+	t.Setenv("TEST_REDIS_PASSWORD", "p#ss: word")
+	t.Setenv("TEST_REDIS_PORT", "6380")
+	t.Setenv("TEST_EMPTY", "")
+
+	configContent := `
+s3:
+  bucket: ${TEST_S3_BUCKET}
+  prefix: "${TEST_UNSET_PREFIX:-logs/}"
+  region: ${TEST_EMPTY:-us-east-1}
+http:
+  endpoints:
+    - "http://${TEST_UNSET_HOST:-localhost}:8080"
+  headers:
+    X-Literal: "$${TEST_S3_BUCKET}"
+state:
+  redis:
+    password: ${TEST_REDIS_PASSWORD}
+    port: ${TEST_REDIS_PORT}
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(configContent), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.S3.Bucket != "prod-logs" || cfg.S3.Prefix != "logs/" || cfg.S3.Region != "us-east-1" {
+		t.Errorf("Expected substituted S3 settings, got %+v", cfg.S3)
+	}
+	if len(cfg.HTTP.Endpoints) != 1 || cfg.HTTP.Endpoints[0] != "http://localhost:8080" {
+		t.Errorf("Expected the fallback host, got %v", cfg.HTTP.Endpoints)
+	}
+	if got := cfg.HTTP.Headers["X-Literal"]; got != "${TEST_S3_BUCKET}" {
+		t.Errorf("Expected an escaped reference to stay literal, got %q", got)
+	}
+	if cfg.State.Redis.Password != "p#ss: word" || cfg.State.Redis.Port != 6380 {
+		t.Errorf("Expected substituted Redis settings, got password %q, port %d", cfg.State.Redis.Password, cfg.State.Redis.Port)
+	}
+}
+
 func TestValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -95,28 +144,11 @@ func TestValidate(t *testing.T) {
 		{
 			name: "valid config",
 			config: Config{
-				S3: struct {
-					Bucket string `yaml:"bucket"`
-					Prefix string `yaml:"prefix"`
-					Region string `yaml:"region"`
-				}{
+				S3: S3Config{
 					Bucket: "test-bucket",
 					Region: "us-east-1",
 				},
-				HTTP: struct {
-					Endpoints             []string      `yaml:"endpoints"`
-					BatchLines            int           `yaml:"batch_lines"`
-					BatchBytes            int           `yaml:"batch_bytes"`
-					FlushInterval         time.Duration `yaml:"flush_interval"`
-					Workers               int           `yaml:"workers"`
-					BufferSize            int           `yaml:"buffer_size"`
-					Timeout               time.Duration `yaml:"timeout"`
-					MaxIdleConns          int           `yaml:"max_idle_conns"`
-					IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
-					TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
-					ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
-					ExpectContinueTimeout time.Duration `yaml:"expect_continue_timeout"`
-				}{
+				HTTP: HTTPConfig{
 					Endpoints:     []string{"http://localhost:8080"},
 					BatchLines:    1000,
 					BatchBytes:    1048576,
@@ -126,32 +158,17 @@ func TestValidate(t *testing.T) {
 					Timeout:       30 * time.Second,
 					MaxIdleConns:  100,
 				},
-				Processing: struct {
-					WorkerCount   int            `yaml:"worker_count"`
-					QueueSize     int            `yaml:"queue_size"`
-					ScanInterval  time.Duration  `yaml:"scan_interval"`
-					DelayWindow   time.Duration  `yaml:"delay_window"`
-					LogFormats    []FormatConfig `yaml:"log_formats"`
-					DefaultFormat string         `yaml:"default_format"`
-					LogFormat     string         `yaml:"log_format"`
-				}{
+				Processing: ProcessingConfig{
 					WorkerCount:  5,
 					QueueSize:    1000,
 					ScanInterval: 15 * time.Second,
 					DelayWindow:  60 * time.Second,
 				},
-				State: struct {
-					FilePath     string        `yaml:"file_path"`
-					SaveInterval time.Duration `yaml:"save_interval"`
-					Redis        RedisConfig   `yaml:"redis"`
-				}{
+				State: StateConfig{
 					FilePath:     "/tmp/state.json",
 					SaveInterval: 30 * time.Second,
 				},
-				Logging: struct {
-					Level  string `yaml:"level"`
-					Format string `yaml:"format"`
-				}{
+				Logging: LoggingConfig{
 					Level:  "info",
 					Format: "json",
 				},
@@ -161,21 +178,8 @@ func TestValidate(t *testing.T) {
 		{
 			name: "invalid buffer size - too small",
 			config: Config{
-				HTTP: struct {
-					Endpoints             []string      `yaml:"endpoints"`
-					BatchLines            int           `yaml:"batch_lines"`
-					BatchBytes            int           `yaml:"batch_bytes"`
-					FlushInterval         time.Duration `yaml:"flush_interval"`
-					Workers               int           `yaml:"workers"`
-					BufferSize            int           `yaml:"buffer_size"`
-					Timeout               time.Duration `yaml:"timeout"`
-					MaxIdleConns          int           `yaml:"max_idle_conns"`
-					IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
-					TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
-					ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
-					ExpectContinueTimeout time.Duration `yaml:"expect_continue_timeout"`
-				}{
-					BufferSize: 0,
+				HTTP: HTTPConfig{
+					BufferSize: -1,
 				},
 			},
 			wantErr: true,
@@ -183,20 +187,7 @@ func TestValidate(t *testing.T) {
 		{
 			name: "invalid buffer size - too large",
 			config: Config{
-				HTTP: struct {
-					Endpoints             []string      `yaml:"endpoints"`
-					BatchLines            int           `yaml:"batch_lines"`
-					BatchBytes            int           `yaml:"batch_bytes"`
-					FlushInterval         time.Duration `yaml:"flush_interval"`
-					Workers               int           `yaml:"workers"`
-					BufferSize            int           `yaml:"buffer_size"`
-					Timeout               time.Duration `yaml:"timeout"`
-					MaxIdleConns          int           `yaml:"max_idle_conns"`
-					IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
-					TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
-					ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
-					ExpectContinueTimeout time.Duration `yaml:"expect_continue_timeout"`
-				}{
+				HTTP: HTTPConfig{
 					BufferSize: 200000,
 				},
 			},
@@ -206,6 +197,7 @@ func TestValidate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			tt.config.ApplyDefaults()
 			err := tt.config.Validate()
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -213,3 +205,1199 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate_Headers(t *testing.T) {
+	base := func() Config {
+		return Config{
+			S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+			HTTP: HTTPConfig{
+				Endpoints:     []string{"http://localhost:8080"},
+				BatchLines:    1000,
+				BatchBytes:    1048576,
+				FlushInterval: time.Second,
+				Workers:       10,
+				BufferSize:    50000,
+			},
+			Processing: ProcessingConfig{
+				WorkerCount:  5,
+				ScanInterval: 15 * time.Second,
+				DelayWindow:  60 * time.Second,
+			},
+			Logging: LoggingConfig{Level: "info", Format: "json"},
+		}
+	}
+
+	cfg := base()
+	cfg.HTTP.Headers = map[string]string{"X-Log-Format": "{format}", "X-Key": "{bucket}/{s3_key}"}
+	cfg.HTTP.EndpointHeaders = map[string]map[string]string{"http://localhost:8080": {"X-Route": "primary"}}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid headers, got error: %v", err)
+	}
+
+	cfg = base()
+	cfg.HTTP.Headers = map[string]string{"X-Bad": "{region}"}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown template variable")
+	}
+
+	cfg = base()
+	cfg.HTTP.EndpointHeaders = map[string]map[string]string{"http://other:9000": {"X-Route": "x"}}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for headers on unknown endpoint")
+	}
+}
+
+func TestValidate_BufferPolicy(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.HTTP.BufferPolicy != "block" {
+		t.Errorf("Expected default buffer_policy 'block', got '%s'", cfg.HTTP.BufferPolicy)
+	}
+
+	cfg.HTTP.BufferPolicy = "block_with_timeout"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.HTTP.BufferBlockTimeout != 5*time.Second {
+		t.Errorf("Expected default buffer_block_timeout 5s, got %v", cfg.HTTP.BufferBlockTimeout)
+	}
+
+	cfg.HTTP.BufferPolicy = "spill"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for invalid buffer_policy")
+	}
+}
+
+func TestValidate_MaxInFlight(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+			MaxInFlight:   -1,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative max_in_flight")
+	}
+
+	cfg.HTTP.MaxInFlight = 2
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+}
+
+// sqlTestDriver stands in for the SQLite driver the binary registers; the config tests
+// build in no PostgreSQL driver
+type sqlTestDriver struct{}
+
+func (sqlTestDriver) Open(string) (driver.Conn, error) { return nil, errors.New("not a database") }
+
+func init() {
+	sql.Register("sqlite3", sqlTestDriver{})
+}
+
+func TestValidate_SQLState(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:   StateConfig{SQL: SQLConfig{Enabled: true, Driver: "sqlite", DSN: "/var/lib/s3-streamer/state.db"}},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.State.SQL.Table != "s3_streamer_files" {
+		t.Errorf("Expected default table 's3_streamer_files', got '%s'", cfg.State.SQL.Table)
+	}
+
+	cfg.State.SQL.Table = "files; DROP TABLE x"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unsafe table name")
+	}
+
+	cfg.State.SQL.Table = "files"
+	cfg.State.SQL.Driver = "mysql"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unsupported driver")
+	}
+
+	// A supported driver the binary does not register fails on start
+	cfg.State.SQL.Driver = "postgres"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `"postgres" is not built into this binary`) {
+		t.Errorf("Expected error for a driver not built in, got %v", err)
+	}
+
+	cfg.State.SQL.Driver = "sqlite3"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed for a registered driver: %v", err)
+	}
+	cfg.State.Redis.Enabled = true
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error when both SQL and Redis state are enabled")
+	}
+}
+
+func TestValidate_KVState(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:   StateConfig{KV: KVConfig{Enabled: true, Backend: "etcd"}},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.State.KV.Address != "http://localhost:2379" {
+		t.Errorf("Expected default etcd address, got '%s'", cfg.State.KV.Address)
+	}
+	if cfg.State.KV.Key != "s3-streamer/state" {
+		t.Errorf("Expected default key 's3-streamer/state', got '%s'", cfg.State.KV.Key)
+	}
+	if cfg.State.KV.Timeout != 5*time.Second {
+		t.Errorf("Expected default timeout 5s, got %v", cfg.State.KV.Timeout)
+	}
+
+	cfg.State.KV.Token = "static-token"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a static etcd token")
+	}
+	cfg.State.KV.Token = ""
+	cfg.State.KV.Username = "streamer"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an etcd username without a password")
+	}
+	cfg.State.KV.Password = "secret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed with etcd credentials: %v", err)
+	}
+
+	cfg.State.KV.Backend = "consul"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for credentials with consul")
+	}
+	cfg.State.KV.Username, cfg.State.KV.Password = "", ""
+
+	cfg.State.KV.Backend = "zookeeper"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unsupported backend")
+	}
+
+	cfg.State.KV.Backend = "consul"
+	cfg.State.Redis.Enabled = true
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error when both KV and Redis state are enabled")
+	}
+}
+
+func TestValidate_StateRetention(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:   StateConfig{Retention: 48 * time.Hour, Redis: RedisConfig{Enabled: true}},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.State.CompactionInterval != time.Hour {
+		t.Errorf("Expected default compaction interval 1h, got %v", cfg.State.CompactionInterval)
+	}
+	if cfg.State.Redis.ProcessedTTL != 48*time.Hour {
+		t.Errorf("Expected processed-key TTL to default to the retention, got %v", cfg.State.Redis.ProcessedTTL)
+	}
+
+	cfg.State.Retention = -time.Hour
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative retention")
+	}
+}
+
+func TestValidate_StateSnapshot(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "s3://test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:   StateConfig{Snapshot: SnapshotConfig{Enabled: true}},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	snap := cfg.State.Snapshot
+	if snap.Bucket != "test-bucket" || snap.Key != "s3-streamer/state-snapshot.json" || snap.Interval != 15*time.Minute {
+		t.Errorf("Expected snapshot defaults, got %+v", snap)
+	}
+
+	cfg.State.Snapshot.Interval = -time.Minute
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative snapshot interval")
+	}
+}
+
+func TestValidate_FileTimeout(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.Processing.FileTimeout != 5*time.Minute {
+		t.Errorf("Expected default file timeout 5m, got %v", cfg.Processing.FileTimeout)
+	}
+	if cfg.Processing.DecodeReadAhead != 4 {
+		t.Errorf("Expected default decode read-ahead 4, got %d", cfg.Processing.DecodeReadAhead)
+	}
+	if mp := cfg.Processing.Multipart; mp.ThresholdMB != 64 || mp.PartSizeMB != 8 || mp.Concurrency != 4 {
+		t.Errorf("Expected multipart download defaults, got %+v", mp)
+	}
+	if cfg.Processing.MaxLineKB != 1024 || cfg.Processing.LongLines != "fail" {
+		t.Errorf("Expected max line 1024 KB failing the file, got %d KB and %q", cfg.Processing.MaxLineKB, cfg.Processing.LongLines)
+	}
+
+	cfg.Processing.FileTimeout = -time.Second
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative file timeout")
+	}
+
+	cfg.Processing.FileTimeout = time.Minute
+	cfg.Processing.LongLines = "wrap"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown long line policy")
+	}
+}
+
+func TestValidate_Autoscale(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+			Autoscale:    AutoscaleConfig{Enabled: true},
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	as := cfg.Processing.Autoscale
+	if as.MinWorkers != 1 || as.MaxWorkers != 10 || as.Interval != 30*time.Second ||
+		as.QueueHighWater != 0.5 || as.LagHighWater != 5*time.Minute || as.BufferHighWater != 0.8 {
+		t.Errorf("Expected autoscale defaults, got %+v", as)
+	}
+
+	cfg.Processing.Autoscale.MinWorkers = 20
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for min_workers above max_workers")
+	}
+	cfg.Processing.Autoscale.MinWorkers = 1
+	cfg.Processing.Autoscale.BufferHighWater = 1.5
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for buffer_high_water above 1")
+	}
+}
+
+func TestValidate_Shed(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+			Shed:         ShedConfig{Enabled: true},
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if sh := cfg.Processing.Shed; sh.HighWater != 0.95 || sh.LowWater != 0.5 || sh.For != 30*time.Second {
+		t.Errorf("Expected shed defaults, got %+v", sh)
+	}
+
+	cfg.Processing.Shed.LowWater = 0.99
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for low_water above high_water")
+	}
+	cfg.Processing.Shed.LowWater = 0.5
+	cfg.Health.SaturatedFor = -time.Second
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative saturated_for")
+	}
+}
+
+func TestValidate_StrictOrdering(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:    5,
+			ScanInterval:   15 * time.Second,
+			DelayWindow:    60 * time.Second,
+			StrictOrdering: true,
+		},
+		State:   StateConfig{Redis: RedisConfig{Enabled: true}},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	cfg.Sharding.Enabled = true
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for strict ordering with sharding")
+	}
+}
+
+func TestValidate_LeaderElection(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:          StateConfig{KV: KVConfig{Enabled: true, Backend: "consul"}},
+		Logging:        LoggingConfig{Level: "info", Format: "json"},
+		LeaderElection: LeaderElectionConfig{Enabled: true, Identity: "replica-a"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.LeaderElection.Backend != "redis" {
+		t.Errorf("Expected default backend 'redis', got '%s'", cfg.LeaderElection.Backend)
+	}
+	if cfg.LeaderElection.Key != "s3-streamer:leader" {
+		t.Errorf("Expected default key 's3-streamer:leader', got '%s'", cfg.LeaderElection.Key)
+	}
+	if cfg.State.Redis.Host != "localhost" || cfg.State.Redis.Port != 6379 {
+		t.Errorf("Expected default Redis connection for the lock, got %s:%d", cfg.State.Redis.Host, cfg.State.Redis.Port)
+	}
+	if cfg.LeaderElection.LeaseDuration != 15*time.Second || cfg.LeaderElection.RenewInterval != 5*time.Second {
+		t.Errorf("Expected 15s lease and 5s renewal, got %v and %v", cfg.LeaderElection.LeaseDuration, cfg.LeaderElection.RenewInterval)
+	}
+
+	cfg.LeaderElection.RenewInterval = 10 * time.Second
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error when renewal interval exceeds half the lease")
+	}
+
+	cfg.LeaderElection.RenewInterval = 5 * time.Second
+	cfg.State.KV.Enabled = false
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error when state is not shared between replicas")
+	}
+}
+
+func TestValidate_LeaderElectionKubernetes(t *testing.T) {
+	t.Setenv("POD_NAME", "streamer-7d9f-abcde")
+	t.Setenv("POD_NAMESPACE", "logging")
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:          StateConfig{KV: KVConfig{Enabled: true, Backend: "consul"}},
+		Logging:        LoggingConfig{Level: "info", Format: "json"},
+		LeaderElection: LeaderElectionConfig{Enabled: true},
+		Kubernetes:     KubernetesConfig{Enabled: true},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.Kubernetes.PodName != "streamer-7d9f-abcde" || cfg.Kubernetes.Namespace != "logging" {
+		t.Errorf("Expected the downward API identity, got pod %q in %q", cfg.Kubernetes.PodName, cfg.Kubernetes.Namespace)
+	}
+	le := cfg.LeaderElection
+	if le.Backend != "kubernetes" || le.Key != "s3-streamer-leader" || le.Identity != "streamer-7d9f-abcde" {
+		t.Errorf("Expected a Lease named s3-streamer-leader held as the pod, got %s %q %q", le.Backend, le.Key, le.Identity)
+	}
+	if cfg.UsesRedis() {
+		t.Error("Expected no Redis for a Lease")
+	}
+
+	cfg.LeaderElection.Key = "s3-streamer:leader"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an invalid Lease name")
+	}
+
+	cfg.LeaderElection.Key = "s3-streamer-leader"
+	cfg.Kubernetes.Enabled = false
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for the kubernetes backend without kubernetes.enabled")
+	}
+}
+
+func TestValidate_Sharding(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:    StateConfig{SQL: SQLConfig{Enabled: true, Driver: "sqlite", DSN: "/var/lib/s3-streamer/state.db"}},
+		Logging:  LoggingConfig{Level: "info", Format: "json"},
+		Sharding: ShardingConfig{Enabled: true, Identity: "instance-a"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.Sharding.Shards != 64 {
+		t.Errorf("Expected default 64 shards, got %d", cfg.Sharding.Shards)
+	}
+	if cfg.Sharding.KeyPrefix != "s3-streamer:shard" {
+		t.Errorf("Expected default key prefix 's3-streamer:shard', got '%s'", cfg.Sharding.KeyPrefix)
+	}
+	if cfg.Sharding.ClaimTTL != time.Hour {
+		t.Errorf("Expected default claim TTL 1h, got %v", cfg.Sharding.ClaimTTL)
+	}
+
+	cfg.Sharding.Shards = 5000
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for too many shards")
+	}
+
+	cfg.Sharding.Shards = 64
+	cfg.State.SQL.Enabled = false
+	cfg.State.Redis.Enabled = true
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected shard checkpoints to be allowed in Redis, got %v", err)
+	}
+
+	cfg.State.Redis.Enabled = false
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error when shard checkpoints are kept in a local state file")
+	}
+}
+
+func TestValidate_MetricsExporter(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:   StateConfig{Redis: RedisConfig{Enabled: true}},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+		OTLP:    OTLPConfig{Enabled: true, Endpoint: "localhost:4317", ServiceName: "s3-edgedelta-streamer", ExportInterval: 10 * time.Second},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.Metrics.Exporter != "otlp" || cfg.Metrics.PrometheusPath != "/metrics" || cfg.Metrics.MaxDimensionValues != 100 {
+		t.Errorf("Expected defaults otlp, /metrics and 100, got %q, %q and %d",
+			cfg.Metrics.Exporter, cfg.Metrics.PrometheusPath, cfg.Metrics.MaxDimensionValues)
+	}
+	if otlp, prometheus := cfg.MetricsExporters(); !otlp || prometheus {
+		t.Errorf("Expected only OTLP, got otlp=%v prometheus=%v", otlp, prometheus)
+	}
+
+	// Prometheus needs a listener: the health server or a dedicated address
+	cfg.Metrics.Exporter = "both"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for prometheus without a listener")
+	}
+	cfg.Metrics.PrometheusAddress = ":9090"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+	if otlp, prometheus := cfg.MetricsExporters(); !otlp || !prometheus {
+		t.Errorf("Expected both exporters, got otlp=%v prometheus=%v", otlp, prometheus)
+	}
+
+	cfg.Metrics.Exporter = "statsd"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown exporter")
+	}
+	cfg.Metrics.Exporter = "otlp"
+
+	cfg.Metrics.CloudWatch.Enabled = true
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cw := cfg.Metrics.CloudWatch; cw.Namespace != "S3EdgeDeltaStreamer" || cw.Region != "us-east-1" || cw.Interval != time.Minute {
+		t.Errorf("Expected CloudWatch defaults, got %+v", cw)
+	}
+	cfg.Metrics.CloudWatch.Interval = time.Millisecond
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a CloudWatch interval under 1s")
+	}
+	cfg.Metrics.CloudWatch.Interval = time.Minute
+
+	cfg.Metrics.StatsD.Enabled = true
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if sd := cfg.Metrics.StatsD; sd.Address != "127.0.0.1:8125" || sd.Prefix != "s3_streamer" || sd.Flavor != "dogstatsd" || sd.Interval != 10*time.Second {
+		t.Errorf("Expected StatsD defaults, got %+v", sd)
+	}
+	cfg.Metrics.StatsD.Flavor = "statsd"
+	cfg.Metrics.StatsD.Tags = map[string]string{"env": "prod"}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for tags with plain StatsD")
+	}
+	cfg.Metrics.StatsD.Flavor = "graphite"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an unknown StatsD flavor")
+	}
+}
+
+func TestValidate_OTLPProtocol(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State:   StateConfig{Redis: RedisConfig{Enabled: true}},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+		OTLP:    OTLPConfig{Enabled: true, Endpoint: "localhost:4317", ServiceName: "s3-edgedelta-streamer", ExportInterval: 10 * time.Second},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.OTLP.Protocol != "grpc" {
+		t.Errorf("Expected default protocol grpc, got %q", cfg.OTLP.Protocol)
+	}
+
+	cfg.OTLP.Protocol = "http"
+	cfg.OTLP.Headers = map[string]string{"X-Api-Key": "secret"}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+
+	cfg.OTLP.CertFile = "client.pem"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for cert_file without key_file")
+	}
+
+	cfg.OTLP.CertFile = ""
+	cfg.OTLP.Protocol = "thrift"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown protocol")
+	}
+	cfg.OTLP.Protocol = "grpc"
+}
+
+func TestValidate_OTLPTemporalityAndBuckets(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+		OTLP:    OTLPConfig{Enabled: true, Endpoint: "localhost:4317", ServiceName: "s3-edgedelta-streamer", ExportInterval: 10 * time.Second},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.OTLP.Temporality != "cumulative" {
+		t.Errorf("Expected default temporality cumulative, got %q", cfg.OTLP.Temporality)
+	}
+	if cfg.OTLP.Exemplars != "trace_based" {
+		t.Errorf("Expected default exemplars trace_based, got %q", cfg.OTLP.Exemplars)
+	}
+	cfg.OTLP.Exemplars = "sometimes"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown exemplar filter")
+	}
+	cfg.OTLP.Exemplars = "always_on"
+
+	cfg.OTLP.Temporality = "delta"
+	cfg.OTLP.HistogramBuckets = map[string][]float64{"http_request_duration_seconds": {0.005, 0.01, 0.025, 0.05, 0.1}}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+
+	cfg.OTLP.Temporality = "lowmemory"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown temporality")
+	}
+	cfg.OTLP.Temporality = "delta"
+
+	cfg.OTLP.HistogramBuckets["default"] = []float64{1, 0.5}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for decreasing bucket boundaries")
+	}
+	cfg.OTLP.HistogramBuckets["default"] = nil
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for empty bucket boundaries")
+	}
+}
+
+func TestValidate_HealthDebug(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+		Health:  HealthConfig{Enabled: true, Debug: true},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for health.debug without admin_token")
+	}
+	cfg.Health.AdminToken = "secret"
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+}
+
+func TestValidate_HealthThresholds(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+		Health:  HealthConfig{Enabled: true, MaxLag: 15 * time.Minute, UnhealthyLag: time.Hour, MaxErrorRate: 0.1},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.Health.ErrorRateWindow != 5*time.Minute {
+		t.Errorf("Expected default error rate window 5m, got %v", cfg.Health.ErrorRateWindow)
+	}
+
+	cfg.Health.UnhealthyLag = 5 * time.Minute
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unhealthy_lag below max_lag")
+	}
+	cfg.Health.UnhealthyLag = time.Hour
+
+	cfg.Health.MaxErrorRate = 1.5
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for max_error_rate above 1")
+	}
+}
+
+func TestValidate_Audit(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.Processing.Audit.Capacity != 10000 {
+		t.Errorf("Expected default audit capacity 10000, got %d", cfg.Processing.Audit.Capacity)
+	}
+	cfg.Processing.Audit.Capacity = -2
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an audit capacity below -1")
+	}
+}
+
+func TestValidate_Report(t *testing.T) {
+	cfg := Config{
+		S3:         S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP:       HTTPConfig{Endpoints: []string{"http://localhost:8080"}},
+		Processing: ProcessingConfig{Report: ReportConfig{Log: true, Path: "/var/lib/s3-streamer/report.jsonl"}},
+		Logging:    LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.Processing.Report.MaxSizeMB != 100 {
+		t.Errorf("Expected default report max_size_mb 100, got %d", cfg.Processing.Report.MaxSizeMB)
+	}
+	cfg.Processing.Report.MaxBackups = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative report max_backups")
+	}
+}
+
+func TestValidate_AssumeRole(t *testing.T) {
+	base := func() Config {
+		return Config{
+			S3:   S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+			HTTP: HTTPConfig{Endpoints: []string{"http://localhost:8080"}},
+		}
+	}
+
+	cfg := base()
+	cfg.AWS.AssumeRole = AssumeRoleConfig{RoleARN: "arn:aws:iam::123456789012:role/streamer", ExternalID: "edgedelta"}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.AWS.AssumeRole.SessionName != "s3-edgedelta-streamer" || cfg.AWS.AssumeRole.Duration != time.Hour {
+		t.Errorf("Expected default session name and duration, got %+v", cfg.AWS.AssumeRole)
+	}
+
+	for name, role := range map[string]AssumeRoleConfig{
+		"user ARN":           {RoleARN: "arn:aws:iam::123456789012:user/streamer"},
+		"short duration":     {RoleARN: "arn:aws:iam::123456789012:role/streamer", Duration: time.Minute},
+		"external ID alone":  {ExternalID: "edgedelta"},
+		"MFA without a role": {MFASerial: "arn:aws:iam::123456789012:mfa/ops"},
+	} {
+		cfg := base()
+		cfg.AWS.AssumeRole = role
+		cfg.ApplyDefaults()
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "aws.assume_role") {
+			t.Errorf("%s: expected an aws.assume_role error, got %v", name, err)
+		}
+	}
+}
+
+func TestValidateService_MFA(t *testing.T) {
+	cfg := Config{
+		S3:   S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{Endpoints: []string{"http://localhost:8080"}},
+	}
+	cfg.ApplyDefaults()
+	if err := cfg.ValidateService(); err != nil {
+		t.Fatalf("ValidateService() failed: %v", err)
+	}
+
+	cfg.AWS.AssumeRole = AssumeRoleConfig{RoleARN: "arn:aws:iam::123456789012:role/streamer", MFASerial: "arn:aws:iam::123456789012:mfa/ops"}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err) // Interactive commands may use MFA
+	}
+	if err := cfg.ValidateService(); err == nil || !strings.Contains(err.Error(), "aws.assume_role.mfa_serial") {
+		t.Errorf("Expected an aws.assume_role.mfa_serial error, got %v", err)
+	}
+
+	cfg.AWS.AssumeRole = AssumeRoleConfig{}
+	cfg.Pipelines = []PipelineConfig{{Name: "audit", AWS: &AWSConfig{AssumeRole: AssumeRoleConfig{MFASerial: "arn:aws:iam::123456789012:mfa/ops"}}}}
+	if err := cfg.ValidateService(); err == nil || !strings.Contains(err.Error(), "pipelines[0].aws.assume_role.mfa_serial") {
+		t.Errorf("Expected a pipelines[0].aws.assume_role.mfa_serial error, got %v", err)
+	}
+}
+
+func TestValidate_AWSProfile(t *testing.T) {
+	cfg := Config{
+		S3:   S3Config{Bucket: "test-bucket", Region: "us-east-1", AWSProfile: "logs-sso"},
+		HTTP: HTTPConfig{Endpoints: []string{"http://localhost:8080"}},
+	}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.AWS.Profile != "logs-sso" {
+		t.Errorf("Expected s3.aws_profile to select the profile, got %q", cfg.AWS.Profile)
+	}
+
+	cfg.AWS.Profile = "other"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "conflicts with aws.profile") {
+		t.Errorf("Expected a conflicting profile error, got %v", err)
+	}
+}
+
+func TestValidate_IMDS(t *testing.T) {
+	cfg := Config{
+		S3:   S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{Endpoints: []string{"http://localhost:8080"}},
+	}
+	cfg.ApplyDefaults()
+	if cfg.AWS.CredentialTimeout != 30*time.Second || cfg.AWS.IMDS.Timeout != time.Second || cfg.AWS.IMDS.MaxAttempts != 3 {
+		t.Errorf("Expected default credential and metadata timeouts, got %+v", cfg.AWS)
+	}
+
+	for name, imds := range map[string]IMDSConfig{
+		"negative timeout": {Timeout: -time.Second},
+		"bad endpoint":     {Endpoint: "169.254.169.254"},
+	} {
+		cfg := cfg
+		cfg.AWS.IMDS = imds
+		cfg.ApplyDefaults()
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "aws.imds") {
+			t.Errorf("%s: expected an aws.imds error, got %v", name, err)
+		}
+	}
+}
+
+func TestValidate_LoggingOutput(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+
+	cfg.ApplyDefaults()
+	if cfg.Logging.Output != "stdout" || cfg.Logging.File.MaxSizeMB != 100 {
+		t.Errorf("Expected stdout output and 100 MB files by default, got %q, %d", cfg.Logging.Output, cfg.Logging.File.MaxSizeMB)
+	}
+	if cfg.Logging.Sampling.Window != time.Minute || cfg.Logging.Sampling.Burst != 10 {
+		t.Errorf("Expected 10 identical messages per minute by default, got %+v", cfg.Logging.Sampling)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid default logging, got %v", err)
+	}
+
+	cfg.Logging.Output = "both"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "logging.file.path") {
+		t.Errorf("Expected an error for file output without a path, got %v", err)
+	}
+	cfg.Logging.File.Path = "/var/log/s3-streamer/streamer.log"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid file output, got %v", err)
+	}
+
+	cfg.Logging.Output = "syslog"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an error for an unknown output")
+	}
+	cfg.Logging.Output = "both"
+
+	cfg.Logging.Levels = map[string]string{"scanner": "debug", "http_sender": "warn"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid component levels, got %v", err)
+	}
+	cfg.Logging.Levels = map[string]string{"scaner": "debug"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `unknown component "scaner"`) {
+		t.Errorf("Expected an error for an unknown component, got %v", err)
+	}
+	cfg.Logging.Levels = map[string]string{"scanner": "verbose"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "logging.levels.scanner") {
+		t.Errorf("Expected an error for an invalid component level, got %v", err)
+	}
+}
+
+func TestValidate_OTLPLogs(t *testing.T) {
+	cfg := Config{
+		S3: S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+		OTLP:    OTLPConfig{Logs: OTLPLogsConfig{Enabled: true}},
+	}
+
+	cfg.ApplyDefaults()
+	if cfg.OTLP.Logs.Level != "info" {
+		t.Errorf("Expected default OTLP log level info, got %q", cfg.OTLP.Logs.Level)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "otlp.logs.enabled") {
+		t.Errorf("Expected an error for log export without an endpoint, got %v", err)
+	}
+
+	cfg.OTLP.Endpoint = "localhost:4317"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected log export without metrics export to be valid, got %v", err)
+	}
+	logger := cfg.LoggerConfig(nil)
+	if logger.OTLP == nil || logger.OTLP.Endpoint != "localhost:4317" || logger.OTLP.ServiceName != "s3-edgedelta-streamer" {
+		t.Errorf("Expected OTLP options from the otlp settings, got %+v", logger.OTLP)
+	}
+
+	cfg.OTLP.Logs.Level = "trace"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an error for an unknown OTLP log level")
+	}
+
+	cfg.OTLP.Logs.Enabled = false
+	if logger := cfg.LoggerConfig(nil); logger.OTLP != nil {
+		t.Error("Expected no OTLP options when log export is disabled")
+	}
+}
@@ -0,0 +1,461 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// ApplyDefaults fills in every unset setting that has a default. Load calls it, so only
+// configurations built in code need to call it before Validate. Settings derived from others
+// (e.g. state.snapshot.bucket from s3.bucket) are only filled while unset, so apply overrides
+// first (see Overrides.Load).
+func (c *Config) ApplyDefaults() {
+	c.applyHTTPDefaults()
+	c.applyProcessingDefaults()
+	c.applyMetricsDefaults()
+	c.applyStateDefaults()
+	c.applyKubernetesDefaults()
+	c.applyLeaderElectionDefaults()
+	c.applyShardingDefaults()
+
+	if c.AWS.Profile == "" {
+		c.AWS.Profile = c.S3.AWSProfile // Default
+	}
+	applyAWSDefaults(&c.AWS)
+	for _, p := range c.Pipelines {
+		if p.AWS != nil {
+			inheritAWSDefaults(p.AWS, c.AWS)
+			applyAWSDefaults(p.AWS)
+		}
+	}
+
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info" // Default
+	}
+	if c.Logging.Format == "" {
+		c.Logging.Format = "json" // Default
+	}
+	if c.Logging.Output == "" {
+		c.Logging.Output = "stdout" // Default
+	}
+	if c.Logging.File.MaxSizeMB == 0 {
+		c.Logging.File.MaxSizeMB = 100 // Default
+	}
+	if c.Logging.Sampling.Window == 0 {
+		c.Logging.Sampling.Window = time.Minute // Default (negative = off)
+	}
+	if c.Logging.Sampling.Burst == 0 {
+		c.Logging.Sampling.Burst = 10 // Default
+	}
+	if c.Crash.MaxReports == 0 {
+		c.Crash.MaxReports = 10 // Default
+	}
+
+	if c.Health.Address == "" {
+		c.Health.Address = ":8080" // Default
+	}
+	if c.Health.Path == "" {
+		c.Health.Path = "/health" // Default
+	}
+	if c.Health.ErrorRateWindow == 0 {
+		c.Health.ErrorRateWindow = 5 * time.Minute // Default
+	}
+}
+
+// applyAWSDefaults fills in a credential set's defaults
+func applyAWSDefaults(a *AWSConfig) {
+	if a.AssumeRole.SessionName == "" {
+		a.AssumeRole.SessionName = "s3-edgedelta-streamer" // Default
+	}
+	if a.AssumeRole.Duration == 0 {
+		a.AssumeRole.Duration = time.Hour // Default
+	}
+	if a.RefreshInterval == 0 {
+		a.RefreshInterval = 5 * time.Minute // Default (negative = only on SIGHUP)
+	}
+	if a.CredentialTimeout == 0 {
+		a.CredentialTimeout = 30 * time.Second // Default
+	}
+	if a.IMDS.Timeout == 0 {
+		a.IMDS.Timeout = time.Second // Default
+	}
+	if a.IMDS.MaxAttempts == 0 {
+		a.IMDS.MaxAttempts = 3 // Default
+	}
+}
+
+// inheritAWSDefaults gives a pipeline's credential set the top-level host settings (refresh,
+// timeouts and instance metadata) it leaves unset
+func inheritAWSDefaults(a *AWSConfig, top AWSConfig) {
+	if a.RefreshInterval == 0 {
+		a.RefreshInterval = top.RefreshInterval
+	}
+	if a.CredentialTimeout == 0 {
+		a.CredentialTimeout = top.CredentialTimeout
+	}
+	if a.IMDS == (IMDSConfig{}) {
+		a.IMDS = top.IMDS
+	}
+}
+
+// applyHTTPDefaults fills in the HTTP sender defaults
+func (c *Config) applyHTTPDefaults() {
+	h := &c.HTTP
+	if h.BatchLines == 0 {
+		h.BatchLines = 1000 // Default
+	}
+	if h.BatchBytes == 0 {
+		h.BatchBytes = 1024 * 1024 // Default
+	}
+	if h.FlushInterval == 0 {
+		h.FlushInterval = time.Second // Default
+	}
+	if h.Workers == 0 {
+		h.Workers = 10 // Default
+	}
+	if h.BufferSize == 0 {
+		h.BufferSize = 10000 // Default
+	}
+	if h.Timeout == 0 {
+		h.Timeout = 30 * time.Second // Default
+	}
+	if h.MaxIdleConns == 0 {
+		h.MaxIdleConns = 100 // Default
+	}
+	if h.IdleConnTimeout == 0 {
+		h.IdleConnTimeout = 90 * time.Second // Default
+	}
+	if h.TLSHandshakeTimeout == 0 {
+		h.TLSHandshakeTimeout = 10 * time.Second // Default
+	}
+	if h.ResponseHeaderTimeout == 0 {
+		h.ResponseHeaderTimeout = 10 * time.Second // Default
+	}
+	if h.ExpectContinueTimeout == 0 {
+		h.ExpectContinueTimeout = time.Second // Default
+	}
+	if h.BufferPolicy == "" {
+		h.BufferPolicy = "block" // Default: never lose data
+	}
+	if h.BufferBlockTimeout == 0 {
+		h.BufferBlockTimeout = 5 * time.Second // Default
+	}
+	if h.MaxRetries == 0 {
+		h.MaxRetries = 3 // Default
+	}
+	if h.RetryBackoff == 0 {
+		h.RetryBackoff = 500 * time.Millisecond // Default
+	}
+	if h.RetryMaxBackoff == 0 {
+		h.RetryMaxBackoff = 30 * time.Second // Default
+	}
+	if h.DrainTimeout == 0 {
+		h.DrainTimeout = 30 * time.Second // Default
+	}
+}
+
+// applyProcessingDefaults fills in the S3 worker, scan and format defaults
+func (c *Config) applyProcessingDefaults() {
+	p := &c.Processing
+	if p.WorkerCount == 0 {
+		p.WorkerCount = 15 // Default
+	}
+	if p.QueueSize == 0 {
+		p.QueueSize = 1000 // Default
+	}
+	if p.ScanInterval == 0 {
+		p.ScanInterval = 15 * time.Second // Default
+	}
+	if p.DelayWindow == 0 {
+		p.DelayWindow = time.Minute // Default
+	}
+	if p.FileTimeout == 0 {
+		p.FileTimeout = 5 * time.Minute // Default
+	}
+	if p.DecodeReadAhead == 0 {
+		p.DecodeReadAhead = 4 // Default
+	}
+	if p.MaxLineKB == 0 {
+		p.MaxLineKB = 1024 // Default
+	}
+	if p.LongLines == "" {
+		p.LongLines = "fail" // Default
+	}
+
+	if p.Retry.MaxAttempts == 0 {
+		p.Retry.MaxAttempts = 5 // Default
+	}
+	if p.Retry.Backoff == 0 {
+		p.Retry.Backoff = time.Minute // Default
+	}
+	if p.Retry.MaxBackoff == 0 {
+		p.Retry.MaxBackoff = time.Hour // Default
+	}
+
+	if p.Audit.Capacity == 0 {
+		p.Audit.Capacity = 10000 // Default
+	}
+	if p.Report.Path != "" && p.Report.MaxSizeMB == 0 {
+		p.Report.MaxSizeMB = 100 // Default
+	}
+
+	if p.Multipart.ThresholdMB == 0 {
+		p.Multipart.ThresholdMB = 64 // Default
+	}
+	if p.Multipart.PartSizeMB == 0 {
+		p.Multipart.PartSizeMB = 8 // Default
+	}
+	if p.Multipart.Concurrency == 0 {
+		p.Multipart.Concurrency = 4 // Default
+	}
+
+	as := &p.Autoscale
+	if as.MinWorkers == 0 {
+		as.MinWorkers = 1 // Default
+	}
+	if as.MaxWorkers == 0 {
+		as.MaxWorkers = max(2*p.WorkerCount, as.MinWorkers) // Default
+	}
+	if as.Interval == 0 {
+		as.Interval = 30 * time.Second // Default
+	}
+	if as.QueueHighWater == 0 {
+		as.QueueHighWater = 0.5 // Default
+	}
+	if as.BufferHighWater == 0 {
+		as.BufferHighWater = 0.8 // Default
+	}
+	if as.LagHighWater == 0 {
+		as.LagHighWater = 5 * time.Minute // Default (negative ignores lag)
+	}
+	if as.ScaleDownCooldown == 0 {
+		as.ScaleDownCooldown = 2 * time.Minute // Default
+	}
+
+	sh := &p.Shed
+	if sh.HighWater == 0 {
+		sh.HighWater = 0.95 // Default
+	}
+	if sh.LowWater == 0 {
+		sh.LowWater = 0.5 // Default
+	}
+	if sh.For == 0 {
+		sh.For = 30 * time.Second // Default
+	}
+
+	for i := range p.LogFormats {
+		format := &p.LogFormats[i]
+		if format.TimestampFormat == "" {
+			format.TimestampFormat = "unix" // Default
+		}
+		if format.ContentType == "" {
+			format.ContentType = "text/plain" // Default
+		}
+	}
+	if p.DefaultFormat == "" {
+		switch {
+		case len(p.LogFormats) > 0:
+			p.DefaultFormat = "auto" // Default: detect among the custom formats
+		case p.LogFormat != "":
+			p.DefaultFormat = p.LogFormat // Legacy single format field
+		default:
+			p.DefaultFormat = "zscaler" // Backward compatibility
+		}
+	}
+}
+
+// applyMetricsDefaults fills in the metrics exporter defaults
+func (c *Config) applyMetricsDefaults() {
+	m := &c.Metrics
+	if m.Exporter == "" {
+		m.Exporter = "otlp" // Default
+	}
+	if m.PrometheusPath == "" {
+		m.PrometheusPath = "/metrics" // Default
+	}
+	if m.MaxDimensionValues == 0 {
+		m.MaxDimensionValues = 100 // Default
+	}
+
+	cw := &m.CloudWatch
+	if cw.Namespace == "" {
+		cw.Namespace = "S3EdgeDeltaStreamer" // Default
+	}
+	if cw.Region == "" {
+		cw.Region = c.S3.Region // Default
+	}
+	if cw.Interval == 0 {
+		cw.Interval = 60 * time.Second // Default
+	}
+
+	sd := &m.StatsD
+	if sd.Address == "" {
+		sd.Address = "127.0.0.1:8125" // Default
+	}
+	if sd.Prefix == "" {
+		sd.Prefix = "s3_streamer" // Default
+	}
+	if sd.Flavor == "" {
+		sd.Flavor = "dogstatsd" // Default
+	}
+	if sd.Interval == 0 {
+		sd.Interval = 10 * time.Second // Default
+	}
+
+	o := &c.OTLP
+	if o.ExportInterval == 0 {
+		o.ExportInterval = 10 * time.Second // Default
+	}
+	if o.ServiceName == "" {
+		o.ServiceName = "s3-edgedelta-streamer" // Default
+	}
+	if o.Protocol == "" {
+		o.Protocol = "grpc" // Default
+	}
+	if o.Temporality == "" {
+		o.Temporality = "cumulative" // Default
+	}
+	if o.Exemplars == "" {
+		o.Exemplars = "trace_based" // Default
+	}
+	if o.Logs.Level == "" {
+		o.Logs.Level = "info" // Default
+	}
+}
+
+// applyStateDefaults fills in the state persistence defaults
+func (c *Config) applyStateDefaults() {
+	s := &c.State
+	if s.FilePath == "" {
+		s.FilePath = "/var/lib/s3-streamer/state.json" // Default
+	}
+	if s.SaveInterval == 0 {
+		s.SaveInterval = 30 * time.Second // Default
+	}
+	if s.Retention == 0 {
+		s.Retention = 7 * 24 * time.Hour // Default
+	}
+	if s.CompactionInterval == 0 {
+		s.CompactionInterval = time.Hour // Default
+	}
+
+	if s.Redis.Host == "" {
+		s.Redis.Host = "localhost" // Default
+	}
+	if s.Redis.Port == 0 {
+		s.Redis.Port = 6379 // Default Redis port
+	}
+	if s.Redis.KeyPrefix == "" {
+		s.Redis.KeyPrefix = "s3-streamer" // Default key prefix
+	}
+	if s.Redis.ProcessedTTL == 0 {
+		s.Redis.ProcessedTTL = s.Retention // Default
+	}
+
+	if s.SQL.Table == "" {
+		s.SQL.Table = "s3_streamer_files" // Default table name
+	}
+
+	if s.KV.Address == "" {
+		switch s.KV.Backend {
+		case "consul":
+			s.KV.Address = "http://localhost:8500" // Default Consul agent
+		case "etcd":
+			s.KV.Address = "http://localhost:2379" // Default etcd client URL
+		}
+	}
+	if s.KV.Key == "" {
+		s.KV.Key = "s3-streamer/state" // Default key
+	}
+	if s.KV.Timeout == 0 {
+		s.KV.Timeout = 5 * time.Second // Default
+	}
+
+	snap := &s.Snapshot
+	if snap.Bucket == "" {
+		snap.Bucket = c.S3.Bucket // Default
+	}
+	snap.Bucket = strings.TrimPrefix(snap.Bucket, "s3://")
+	if snap.Key == "" {
+		snap.Key = "s3-streamer/state-snapshot.json" // Default
+	}
+	if snap.Interval == 0 {
+		snap.Interval = 15 * time.Minute // Default
+	}
+}
+
+// applyKubernetesDefaults fills in the pod identity from the downward API. The namespace is
+// left empty without POD_NAMESPACE; the service account's namespace is used then.
+func (c *Config) applyKubernetesDefaults() {
+	k := &c.Kubernetes
+	if !k.Enabled {
+		return
+	}
+	if k.Namespace == "" {
+		k.Namespace = os.Getenv("POD_NAMESPACE") // Default
+	}
+	if k.PodName == "" {
+		k.PodName = os.Getenv("POD_NAME") // Default
+	}
+	if k.PodName == "" {
+		k.PodName = hostname() // Default
+	}
+}
+
+// applyLeaderElectionDefaults fills in the leader election defaults
+func (c *Config) applyLeaderElectionDefaults() {
+	le := &c.LeaderElection
+	if le.Backend == "" {
+		le.Backend = "redis" // Default
+		if c.Kubernetes.Enabled {
+			le.Backend = "kubernetes"
+		}
+	}
+	if le.Key == "" {
+		le.Key = c.State.Redis.KeyPrefix + ":leader" // Default
+		if le.Backend == "kubernetes" {
+			le.Key = "s3-streamer-leader"
+		}
+	}
+	if le.Identity == "" && le.Enabled {
+		le.Identity = c.identity() // Default
+	}
+	if le.LeaseDuration == 0 {
+		le.LeaseDuration = 15 * time.Second // Default
+	}
+	if le.RenewInterval == 0 {
+		le.RenewInterval = 5 * time.Second // Default
+	}
+}
+
+// applyShardingDefaults fills in the sharding defaults
+func (c *Config) applyShardingDefaults() {
+	sh := &c.Sharding
+	if sh.Identity == "" && sh.Enabled {
+		sh.Identity = c.identity() // Default
+	}
+	if sh.KeyPrefix == "" {
+		sh.KeyPrefix = c.State.Redis.KeyPrefix + ":shard" // Default
+	}
+	if sh.Shards == 0 {
+		sh.Shards = 64 // Default
+	}
+	if sh.HeartbeatInterval == 0 {
+		sh.HeartbeatInterval = 5 * time.Second // Default
+	}
+	if sh.MemberTTL == 0 {
+		sh.MemberTTL = 15 * time.Second // Default
+	}
+	if sh.ClaimTTL == 0 {
+		sh.ClaimTTL = time.Hour // Default
+	}
+}
+
+// identity is the default instance identity: the pod name in Kubernetes, otherwise the hostname
+func (c *Config) identity() string {
+	if c.Kubernetes.Enabled {
+		return c.Kubernetes.PodName
+	}
+	return hostname()
+}
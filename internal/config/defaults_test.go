@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "s3:\n  bucket: test-bucket\n  region: us-east-1\nhttp:\n  endpoints: [\"http://localhost:8080\"]\n  timeout: 5s\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected a minimal config to validate, got %v", err)
+	}
+	if cfg.HTTP.Timeout != 5*time.Second {
+		t.Errorf("Expected the file value to be kept, got %v", cfg.HTTP.Timeout)
+	}
+	if cfg.HTTP.TLSHandshakeTimeout != 10*time.Second || cfg.HTTP.ResponseHeaderTimeout != 10*time.Second ||
+		cfg.HTTP.IdleConnTimeout != 90*time.Second || cfg.HTTP.ExpectContinueTimeout != time.Second {
+		t.Errorf("Expected default HTTP timeouts, got %+v", cfg.HTTP)
+	}
+	if cfg.HTTP.BatchLines != 1000 || cfg.Processing.QueueSize != 1000 || cfg.State.SaveInterval != 30*time.Second {
+		t.Errorf("Expected defaults, got batch_lines %d, queue_size %d, save_interval %v",
+			cfg.HTTP.BatchLines, cfg.Processing.QueueSize, cfg.State.SaveInterval)
+	}
+	if cfg.Logging.Level != "info" || cfg.Logging.Format != "json" {
+		t.Errorf("Expected default logging, got %+v", cfg.Logging)
+	}
+}
+
+func TestValidate_ReadOnly(t *testing.T) {
+	cfg := Config{
+		S3:   S3Config{Bucket: "test-bucket", Region: "us-east-1"},
+		HTTP: HTTPConfig{Endpoints: []string{"http://localhost:8080"}},
+	}
+	cfg.ApplyDefaults()
+	before := cfg
+	before.HTTP.Endpoints = append([]string(nil), cfg.HTTP.Endpoints...)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, before) {
+		t.Error("Expected Validate not to modify the configuration")
+	}
+
+	// Without defaults, unset settings are invalid
+	if err := (&Config{S3: cfg.S3, HTTP: HTTPConfig{Endpoints: cfg.HTTP.Endpoints}}).Validate(); err == nil {
+		t.Error("Expected error for a configuration without defaults")
+	}
+}
+
+func TestOverrides_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "s3:\n  bucket: file-bucket\n  region: us-east-1\nstate:\n  snapshot:\n    enabled: true\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := NewOverrides().Load(path, []string{"S3_STREAMER_S3_BUCKET=env-bucket"})
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.S3.Bucket != "env-bucket" || cfg.State.Snapshot.Bucket != "env-bucket" {
+		t.Errorf("Expected the snapshot bucket to follow the overridden bucket, got %q, %q",
+			cfg.S3.Bucket, cfg.State.Snapshot.Bucket)
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches ${VAR} and ${VAR:-fallback}; a leading $ ($${VAR}) escapes the reference
+var envReference = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces environment variable references in s. An unset or empty variable
+// expands to its fallback, or to "" without one.
+func expandEnv(s string) string {
+	return envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envReference.FindStringSubmatch(ref)
+		if m[1] != "" {
+			return ref[1:]
+		}
+		if value := os.Getenv(m[2]); value != "" {
+			return value
+		}
+		return m[3]
+	})
+}
+
+// expandEnvNodes expands environment variable references in every scalar value under n.
+// Substituting after parsing keeps values containing YAML syntax (such as passwords with
+// '#' or ': ') intact. Unquoted values are re-resolved, so "port: ${REDIS_PORT}" decodes
+// into an int.
+func expandEnvNodes(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode {
+		expanded := expandEnv(n.Value)
+		if expanded != n.Value {
+			n.Value = expanded
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+		}
+		return
+	}
+	for _, child := range n.Content {
+		expandEnvNodes(child)
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey lists, at the top level of a configuration, the files it is layered over
+// (e.g. include: [base.yaml]). Paths are relative to the including file.
+const includeKey = "include"
+
+// maxIncludeDepth bounds nested includes
+const maxIncludeDepth = 10
+
+// readDocument reads the configuration at location and merges in the files it includes.
+// Each included file is merged in order, and the including file over them: mappings merge
+// key by key, while lists and scalars replace the included value entirely. data holds
+// every file read, so a change to any of them can be detected.
+func readDocument(ctx context.Context, location string) (doc *yaml.Node, data []byte, err error) {
+	var all bytes.Buffer
+	root, err := readLayer(ctx, location, nil, &all)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, all.Bytes(), nil
+}
+
+// readLayer reads the file at location and its includes, merged. stack holds the
+// including files, to report include cycles.
+func readLayer(ctx context.Context, location string, stack []string, all *bytes.Buffer) (*yaml.Node, error) {
+	for _, parent := range stack {
+		if parent == location {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), location)
+		}
+	}
+	if len(stack) > maxIncludeDepth {
+		return nil, fmt.Errorf("includes nested more than %d deep at %s", maxIncludeDepth, location)
+	}
+
+	data, err := readLocation(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	all.WriteString(location + "\n")
+	all.Write(data)
+
+	root, includes, err := parseLayer(location, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(includes) == 0 {
+		return root, nil
+	}
+
+	base := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, include := range includes {
+		child, err := includeLocation(location, include)
+		if err != nil {
+			return nil, err
+		}
+		layer, err := readLayer(ctx, child, append(stack, location), all)
+		if err != nil {
+			return nil, err
+		}
+		mergeNodes(base, layer)
+	}
+	mergeNodes(base, root)
+	return base, nil
+}
+
+// parseLayer decodes one configuration file into its top-level mapping (with environment
+// variable references expanded) and the files it includes
+func parseLayer(location string, data []byte) (*yaml.Node, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: %w", location, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil, nil // Empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: line %d: expected a mapping of settings", location, root.Line)
+	}
+	expandEnvNodes(root)
+
+	var includes []string
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != includeKey {
+			continue
+		}
+		value := root.Content[i+1]
+		if err := value.Decode(&includes); err != nil {
+			var single string
+			if value.Decode(&single) != nil {
+				return nil, nil, fmt.Errorf("failed to parse config file %s: line %d: include must be a file or a list of files", location, value.Line)
+			}
+			includes = []string{single}
+		}
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		break
+	}
+
+	if errs := unknownFields(root, reflect.TypeOf(Config{}), ""); len(errs) > 0 {
+		return nil, nil, errors.New("failed to parse config file " + location + ":\n" + strings.Join(errs, "\n"))
+	}
+	return root, includes, nil
+}
+
+// includeLocation resolves an include relative to the file at parent. Relative includes
+// need a local or s3:// parent; use absolute locations from ssm:// or secretsmanager://.
+func includeLocation(parent, include string) (string, error) {
+	if include == "" {
+		return "", fmt.Errorf("empty include in %s", parent)
+	}
+	if filepath.IsAbs(include) || strings.Contains(include, "://") {
+		return include, nil
+	}
+	src, err := parseRemote(parent)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case src == nil:
+		return filepath.Join(filepath.Dir(parent), include), nil
+	case src.scheme == "s3":
+		location := "s3://" + src.bucket + "/" + path.Join(path.Dir(src.name), include)
+		if src.region != "" {
+			location += "?region=" + src.region
+		}
+		return location, nil
+	default:
+		return "", fmt.Errorf("include %q in %s must be an absolute location", include, parent)
+	}
+}
+
+// mergeNodes merges the mapping overlay into base: keys present in both merge when both
+// values are mappings, and otherwise take the overlay's value
+func mergeNodes(base, overlay *yaml.Node) {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		j := mappingIndex(base, key.Value)
+		if j < 0 {
+			base.Content = append(base.Content, key, value)
+			continue
+		}
+		existing := base.Content[j+1]
+		if existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeNodes(existing, value)
+			continue
+		}
+		base.Content[j+1] = value
+	}
+}
+
+// mappingIndex returns the index of key in mapping n, or -1
+func mappingIndex(n *yaml.Node, key string) int {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
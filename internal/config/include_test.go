@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFiles writes name -> content files into a temporary directory
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoad_Include(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": `
+s3:
+  bucket: base-bucket
+  region: us-east-1
+http:
+  endpoints: ["http://a:8080", "http://b:8080"]
+  headers:
+    X-Team: logs
+  timeout: 10s
+processing:
+  worker_count: 4
+`,
+		"prod.yaml": `
+include: base.yaml
+s3:
+  bucket: prod-bucket
+http:
+  endpoints: ["http://prod:8080"]
+  headers:
+    X-Env: prod
+processing:
+  worker_count: ~
+`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "prod.yaml"))
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.S3.Bucket != "prod-bucket" || cfg.S3.Region != "us-east-1" {
+		t.Errorf("Expected the overlay to override only the bucket, got %+v", cfg.S3)
+	}
+	if len(cfg.HTTP.Endpoints) != 1 || cfg.HTTP.Endpoints[0] != "http://prod:8080" {
+		t.Errorf("Expected the overlay list to replace the base list, got %v", cfg.HTTP.Endpoints)
+	}
+	if cfg.HTTP.Headers["X-Team"] != "logs" || cfg.HTTP.Headers["X-Env"] != "prod" {
+		t.Errorf("Expected maps to merge, got %v", cfg.HTTP.Headers)
+	}
+	if cfg.HTTP.Timeout != 10*time.Second {
+		t.Errorf("Expected base settings to be kept, got %v", cfg.HTTP.Timeout)
+	}
+	if cfg.Processing.WorkerCount != 15 {
+		t.Errorf("Expected a null overlay value to restore the default, got %d", cfg.Processing.WorkerCount)
+	}
+}
+
+func TestLoad_IncludeErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"a.yaml":       "include: [b.yaml]\n",
+		"b.yaml":       "include: [a.yaml]\n",
+		"typo.yaml":    "include: [base.yaml]\n",
+		"base.yaml":    "s3:\n  regoin: us-east-1\n",
+		"missing.yaml": "include: nowhere.yaml\n",
+	})
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"a.yaml", "include cycle"},
+		{"typo.yaml", "base.yaml:\nline 2: unknown field \"s3.regoin\""},
+		{"missing.yaml", "nowhere.yaml"},
+	}
+	for _, tt := range tests {
+		_, err := Load(filepath.Join(dir, tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load(%s): expected error containing %q, got %v", tt.file, tt.want, err)
+		}
+	}
+}
+
+func TestIncludeLocation(t *testing.T) {
+	tests := []struct {
+		parent, include, want string
+		wantErr               bool
+	}{
+		{"/etc/streamer/prod.yaml", "base.yaml", "/etc/streamer/base.yaml", false},
+		{"/etc/streamer/prod.yaml", "/shared/base.yaml", "/shared/base.yaml", false},
+		{"s3://configs/streamer/prod.yaml?region=eu-west-1", "../base.yaml", "s3://configs/base.yaml?region=eu-west-1", false},
+		{"ssm:///streamer/prod", "ssm:///streamer/base", "ssm:///streamer/base", false},
+		{"ssm:///streamer/prod", "base", "", true},
+	}
+	for _, tt := range tests {
+		got, err := includeLocation(tt.parent, tt.include)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("includeLocation(%q, %q) = %q, %v, expected %q", tt.parent, tt.include, got, err, tt.want)
+		}
+	}
+}
+
+func TestReadDocument_TracksIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": "s3:\n  region: us-east-1\n",
+		"prod.yaml": "include: base.yaml\n",
+	})
+	_, before, err := readDocument(context.Background(), filepath.Join(dir, "prod.yaml"))
+	if err != nil {
+		t.Fatalf("readDocument() failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "base.yaml"), []byte("s3:\n  region: eu-west-1\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write base.yaml: %v", err)
+	}
+	_, after, _ := readDocument(context.Background(), filepath.Join(dir, "prod.yaml"))
+	if string(before) == string(after) {
+		t.Error("Expected a change to an included file to change the document data")
+	}
+}
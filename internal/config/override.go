@@ -0,0 +1,205 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that override config file values:
+// S3_STREAMER_ followed by the key in upper case with dots replaced by underscores
+// (S3_STREAMER_HTTP_ENDPOINTS overrides http.endpoints)
+const EnvPrefix = "S3_STREAMER_"
+
+// serviceLink matches the variables Kubernetes sets for every Service in the namespace whose
+// name starts with s3-streamer (a Service s3-streamer gives S3_STREAMER_SERVICE_HOST,
+// S3_STREAMER_SERVICE_PORT, S3_STREAMER_PORT_8080_TCP_ADDR and so on)
+var serviceLink = regexp.MustCompile(`^S3_STREAMER_(\w+_)?(SERVICE_HOST|SERVICE_PORT(_\w+)?|PORT_\d+_(TCP|UDP|SCTP)(_PROTO|_PORT|_ADDR)?)$`)
+
+// serviceLinkPort matches the <SERVICE>_PORT variable of a Kubernetes service link, and
+// serviceLinkURL its value (e.g. tcp://10.0.0.11:8080)
+var (
+	serviceLinkPort = regexp.MustCompile(`^S3_STREAMER_(\w+_)?PORT$`)
+	serviceLinkURL  = regexp.MustCompile(`^(tcp|udp|sctp)://`)
+)
+
+// isServiceLink reports whether an environment variable was set by Kubernetes for a Service
+// rather than as an override
+func isServiceLink(name, value string) bool {
+	if serviceLink.MatchString(name) {
+		return true
+	}
+	return serviceLinkPort.MatchString(name) && serviceLinkURL.MatchString(value)
+}
+
+// Overrides layers command-line flags and environment variables over the config file.
+// Flags take precedence over environment variables, which take precedence over the file.
+// Every scalar and list setting can be overridden; lists are comma-separated. Maps
+// (such as http.headers) and lists of sections (log_formats, pipelines) cannot.
+type Overrides struct {
+	keys  map[string]reflect.Kind // Overridable keys (e.g. "s3.bucket") and their kinds
+	flags map[string]string       // Values set by flag, by key
+}
+
+// NewOverrides creates an override layer for every overridable setting
+func NewOverrides() *Overrides {
+	o := &Overrides{keys: make(map[string]reflect.Kind), flags: make(map[string]string)}
+	o.collect("", reflect.TypeOf(Config{}))
+	return o
+}
+
+// collect records the overridable keys of struct type t under prefix
+func (o *Overrides) collect(prefix string, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			o.collect(key+".", field.Type)
+		case reflect.Slice:
+			if field.Type.Elem().Kind() == reflect.String {
+				o.keys[key] = reflect.Slice
+			}
+		case reflect.Map, reflect.Pointer, reflect.Interface:
+		default:
+			o.keys[key] = field.Type.Kind()
+		}
+	}
+}
+
+// Keys returns the overridable keys, sorted
+func (o *Overrides) Keys() []string {
+	keys := make([]string, 0, len(o.keys))
+	for key := range o.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EnvName returns the environment variable that overrides key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// RegisterFlags adds a flag per overridable key (e.g. --s3.bucket) to fs
+func (o *Overrides) RegisterFlags(fs *flag.FlagSet) {
+	for _, key := range o.Keys() {
+		fs.Var(&overrideFlag{o: o, key: key}, key, "Override "+key+" (env "+EnvName(key)+")")
+	}
+}
+
+// overrideFlag records a flag value for Apply
+type overrideFlag struct {
+	o   *Overrides
+	key string
+}
+
+func (f *overrideFlag) String() string {
+	if f.o == nil {
+		return ""
+	}
+	return f.o.flags[f.key]
+}
+
+func (f *overrideFlag) Set(value string) error {
+	f.o.flags[f.key] = value
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be set with a bare flag (--health.enabled)
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.o.keys[f.key] == reflect.Bool
+}
+
+// Load reads the configuration at location like Load, applying the overrides (see Apply)
+// before the defaults so that defaults derived from an overridden setting (such as
+// state.snapshot.bucket from s3.bucket) follow it
+func (o *Overrides) Load(location string, environ []string) (*Config, error) {
+	ctx := context.Background()
+	doc, _, err := readDocument(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return build(ctx, doc, o, environ)
+}
+
+// Apply overrides cfg with the environment (as returned by os.Environ) and then with the
+// flags parsed since RegisterFlags. An unknown S3_STREAMER_ variable is an error, so a
+// misspelled override is not silently ignored, unless it is a Kubernetes service link (see
+// isServiceLink). Call before ApplyDefaults and Validate.
+func (o *Overrides) Apply(cfg *Config, environ []string) error {
+	byEnv := make(map[string]string, len(o.keys))
+	for key := range o.keys {
+		byEnv[EnvName(key)] = key
+	}
+
+	values := make(map[string]string)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key, ok := byEnv[name]
+		if !ok && isServiceLink(name, value) {
+			continue
+		}
+		if !ok {
+			return fmt.Errorf("unknown setting in environment variable %s", name)
+		}
+		values[key] = value
+	}
+	for key, value := range o.flags {
+		values[key] = value
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := o.decode(cfg, key, values[key]); err != nil {
+			return fmt.Errorf("invalid override for %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// decode sets key in cfg by decoding a single-key YAML document over it
+func (o *Overrides) decode(cfg *Config, key, value string) error {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	switch o.keys[key] {
+	case reflect.String:
+		node.Tag = "!!str"
+	case reflect.Slice:
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+	}
+
+	parts := strings.Split(key, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		node = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: parts[i]},
+			node,
+		}}
+	}
+	return node.Decode(cfg)
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOverrides_Apply(t *testing.T) {
+	cfg := Config{
+		S3:         S3Config{Bucket: "file-bucket", Region: "us-east-1"},
+		HTTP:       HTTPConfig{Endpoints: []string{"http://file:8080"}, Workers: 10},
+		Processing: ProcessingConfig{WorkerCount: 5, ScanInterval: 15 * time.Second},
+	}
+
+	overrides := NewOverrides()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	overrides.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--s3.bucket=flag-bucket", "--health.enabled", "--processing.scan_interval", "30s"}); err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	environ := []string{
+		"PATH=/usr/bin",
+		"S3_STREAMER_S3_BUCKET=env-bucket",
+		"S3_STREAMER_HTTP_ENDPOINTS=http://a:8080, http://b:8080",
+		"S3_STREAMER_PROCESSING_WORKER_COUNT=8",
+		"S3_STREAMER_STATE_REDIS_PASSWORD=123",
+	}
+	if err := overrides.Apply(&cfg, environ); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+
+	if cfg.S3.Bucket != "flag-bucket" {
+		t.Errorf("Expected the flag to win over the environment, got %q", cfg.S3.Bucket)
+	}
+	if cfg.S3.Region != "us-east-1" || cfg.HTTP.Workers != 10 {
+		t.Errorf("Expected settings without overrides to keep their file values, got %q, %d", cfg.S3.Region, cfg.HTTP.Workers)
+	}
+	if len(cfg.HTTP.Endpoints) != 2 || cfg.HTTP.Endpoints[1] != "http://b:8080" {
+		t.Errorf("Expected the endpoint list to be replaced, got %v", cfg.HTTP.Endpoints)
+	}
+	if cfg.Processing.WorkerCount != 8 || cfg.Processing.ScanInterval != 30*time.Second || !cfg.Health.Enabled {
+		t.Errorf("Expected typed overrides, got worker_count %d, scan_interval %v, health.enabled %v",
+			cfg.Processing.WorkerCount, cfg.Processing.ScanInterval, cfg.Health.Enabled)
+	}
+	if cfg.State.Redis.Password != "123" {
+		t.Errorf("Expected a numeric-looking string to stay a string, got %q", cfg.State.Redis.Password)
+	}
+
+	if err := NewOverrides().Apply(&cfg, []string{"S3_STREAMER_S3_BUCKIT=x"}); err == nil {
+		t.Error("Expected error for an unknown setting")
+	}
+	if err := NewOverrides().Apply(&cfg, []string{"S3_STREAMER_HELTH_PORT=8080"}); err == nil {
+		t.Error("Expected error for an unknown setting named like a service port")
+	}
+	err := NewOverrides().Apply(&cfg, []string{"S3_STREAMER_PROCESSING_WORKER_COUNT=many"})
+	if err == nil || !strings.Contains(err.Error(), "processing.worker_count") {
+		t.Errorf("Expected error naming the invalid setting, got %v", err)
+	}
+}
+
+func TestOverrides_ServiceLinks(t *testing.T) {
+	// Set by Kubernetes for Services named s3-streamer and s3-streamer-metrics
+	environ := []string{
+		"S3_STREAMER_SERVICE_HOST=10.0.0.11",
+		"S3_STREAMER_SERVICE_PORT=8080",
+		"S3_STREAMER_SERVICE_PORT_HEALTH=8080",
+		"S3_STREAMER_PORT=tcp://10.0.0.11:8080",
+		"S3_STREAMER_PORT_8080_TCP=tcp://10.0.0.11:8080",
+		"S3_STREAMER_PORT_8080_TCP_PROTO=tcp",
+		"S3_STREAMER_PORT_8080_TCP_PORT=8080",
+		"S3_STREAMER_PORT_8080_TCP_ADDR=10.0.0.11",
+		"S3_STREAMER_METRICS_SERVICE_HOST=10.0.0.12",
+		"S3_STREAMER_METRICS_PORT=tcp://10.0.0.12:9090",
+		"S3_STREAMER_STATE_REDIS_PORT=6380",
+	}
+	var cfg Config
+	if err := NewOverrides().Apply(&cfg, environ); err != nil {
+		t.Fatalf("Expected service links to be ignored, got %v", err)
+	}
+	if cfg.State.Redis.Port != 6380 {
+		t.Errorf("Expected state.redis.port to still be overridden, got %d", cfg.State.Redis.Port)
+	}
+}
+
+func TestOverrides_UniqueEnvNames(t *testing.T) {
+	seen := make(map[string]string)
+	for _, key := range NewOverrides().Keys() {
+		name := EnvName(key)
+		if other, ok := seen[name]; ok {
+			t.Errorf("Keys %s and %s share environment variable %s", other, key, name)
+		}
+		seen[name] = key
+	}
+	if _, ok := seen["S3_STREAMER_HTTP_ENDPOINTS"]; !ok {
+		t.Error("Expected http.endpoints to be overridable")
+	}
+	if _, ok := seen["S3_STREAMER_HTTP_HEADERS"]; ok {
+		t.Error("Expected maps not to be overridable")
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PipelineConfig defines a named pipeline (source + format + output) run alongside others in one process.
+// Unset fields inherit the top-level configuration. Each pipeline persists state under its own namespace.
+type PipelineConfig struct {
+	Name      string     `yaml:"name"`      // Unique name; used to derive the state file, key and table
+	Bucket    string     `yaml:"bucket"`    // Source bucket (default: s3.bucket)
+	Prefix    string     `yaml:"prefix"`    // Source prefix (default: s3.prefix)
+	Region    string     `yaml:"region"`    // Source bucket region (default: s3.region)
+	AWS       *AWSConfig `yaml:"aws"`       // Credentials for the source bucket, e.g. a role in the bucket's account (default: aws)
+	Format    string     `yaml:"format"`    // Log format name or "auto" (default: processing.default_format)
+	Endpoints []string   `yaml:"endpoints"` // HTTP endpoints (default: http.endpoints)
+}
+
+// ResolvedPipeline is a pipeline with its complete, namespaced configuration
+type ResolvedPipeline struct {
+	Name   string
+	Config Config
+}
+
+// pipelineName matches names that are safe to embed in file names, keys and SQL identifiers
+var pipelineName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// validatePipelines checks pipeline definitions
+func (c *Config) validatePipelines() []string {
+	var errs []string
+	seen := make(map[string]bool, len(c.Pipelines))
+	for i, p := range c.Pipelines {
+		switch {
+		case p.Name == "":
+			errs = append(errs, fmt.Sprintf("pipelines[%d].name is required", i))
+		case !pipelineName.MatchString(p.Name):
+			errs = append(errs, fmt.Sprintf("pipelines[%d].name must contain only letters, digits, '-' and '_'", i))
+		case seen[p.Name]:
+			errs = append(errs, fmt.Sprintf("pipelines[%d].name %q is used more than once", i, p.Name))
+		}
+		seen[p.Name] = true
+
+		if p.AWS != nil {
+			errs = append(errs, validateAWS(fmt.Sprintf("pipelines[%d].aws", i), *p.AWS)...)
+		}
+		for j, endpoint := range p.Endpoints {
+			if err := validateEndpointURL(endpoint); err != nil {
+				errs = append(errs, fmt.Sprintf("pipelines[%d].endpoints[%d] %v", i, j, err))
+			}
+		}
+	}
+	return errs
+}
+
+// ResolvePipelines returns the configuration of every pipeline. Without a pipelines section,
+// the top-level configuration is the single unnamed pipeline and keeps its state locations.
+// Call after ApplyDefaults (Load applies them) so the pipelines inherit the defaults.
+func (c *Config) ResolvePipelines() []ResolvedPipeline {
+	if len(c.Pipelines) == 0 {
+		return []ResolvedPipeline{{Config: *c}}
+	}
+
+	resolved := make([]ResolvedPipeline, 0, len(c.Pipelines))
+	for _, p := range c.Pipelines {
+		cfg := *c
+		cfg.Pipelines = nil
+		if p.Bucket != "" {
+			cfg.S3.Bucket = p.Bucket
+		}
+		if p.Prefix != "" {
+			cfg.S3.Prefix = p.Prefix
+		}
+		if p.Region != "" {
+			cfg.S3.Region = p.Region
+		}
+		if p.AWS != nil {
+			cfg.AWS = *p.AWS
+		}
+		if p.Format != "" {
+			cfg.Processing.DefaultFormat = p.Format
+		}
+		if len(p.Endpoints) > 0 {
+			cfg.HTTP.Endpoints = p.Endpoints
+		}
+		cfg.State = c.State.Namespaced(p.Name)
+		if cfg.HTTP.SpillDir != "" {
+			cfg.HTTP.SpillDir = filepath.Join(cfg.HTTP.SpillDir, p.Name)
+		}
+		resolved = append(resolved, ResolvedPipeline{Name: p.Name, Config: cfg})
+	}
+	return resolved
+}
+
+// Namespaced returns the state configuration for a named pipeline:
+// the state file gets a -<name> suffix, the Redis key prefix a :<name> suffix,
+// the Consul/etcd key a /<name> suffix, the SQL table a _<name> suffix and the
+// S3 snapshot key a -<name> suffix.
+func (s StateConfig) Namespaced(name string) StateConfig {
+	if s.FilePath != "" {
+		ext := filepath.Ext(s.FilePath)
+		s.FilePath = strings.TrimSuffix(s.FilePath, ext) + "-" + name + ext
+	}
+	if s.Redis.KeyPrefix != "" {
+		s.Redis.KeyPrefix += ":" + name
+	}
+	if s.KV.Key != "" {
+		s.KV.Key += "/" + name
+	}
+	if s.SQL.Table != "" {
+		s.SQL.Table += "_" + strings.ReplaceAll(name, "-", "_")
+	}
+	if s.Snapshot.Key != "" {
+		ext := path.Ext(s.Snapshot.Key)
+		s.Snapshot.Key = strings.TrimSuffix(s.Snapshot.Key, ext) + "-" + name + ext
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func newPipelineTestConfig() Config {
+	return Config{
+		S3: S3Config{Bucket: "shared-bucket", Prefix: "logs/", Region: "us-east-1"},
+		HTTP: HTTPConfig{
+			Endpoints:     []string{"http://localhost:8080"},
+			BatchLines:    1000,
+			BatchBytes:    1048576,
+			FlushInterval: time.Second,
+			Workers:       10,
+			BufferSize:    50000,
+			SpillDir:      "/var/lib/s3-streamer/spill",
+		},
+		Processing: ProcessingConfig{
+			WorkerCount:  5,
+			ScanInterval: 15 * time.Second,
+			DelayWindow:  60 * time.Second,
+		},
+		State: StateConfig{
+			FilePath:     "/var/lib/s3-streamer/state.json",
+			SaveInterval: 30 * time.Second,
+			Redis:        RedisConfig{KeyPrefix: "s3-streamer"},
+			KV:           KVConfig{Key: "s3-streamer/state"},
+			SQL:          SQLConfig{Table: "s3_streamer_files"},
+			Snapshot:     SnapshotConfig{Key: "s3-streamer/state-snapshot.json"},
+		},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+	}
+}
+
+func TestResolvePipelines_Single(t *testing.T) {
+	cfg := newPipelineTestConfig()
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	pipelines := cfg.ResolvePipelines()
+	if len(pipelines) != 1 {
+		t.Fatalf("Expected 1 pipeline, got %d", len(pipelines))
+	}
+	if pipelines[0].Config.State.FilePath != "/var/lib/s3-streamer/state.json" {
+		t.Errorf("Expected state file to be unchanged, got %s", pipelines[0].Config.State.FilePath)
+	}
+}
+
+func TestResolvePipelines_Named(t *testing.T) {
+	cfg := newPipelineTestConfig()
+	cfg.Pipelines = []PipelineConfig{
+		{Name: "zscaler", Prefix: "zscaler/", Format: "zscaler"},
+		{Name: "umbrella-dns", Bucket: "umbrella-bucket", Endpoints: []string{"http://localhost:8081"}},
+	}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	pipelines := cfg.ResolvePipelines()
+	if len(pipelines) != 2 {
+		t.Fatalf("Expected 2 pipelines, got %d", len(pipelines))
+	}
+
+	zscaler := pipelines[0].Config
+	if zscaler.S3.Bucket != "shared-bucket" || zscaler.S3.Prefix != "zscaler/" {
+		t.Errorf("Expected shared-bucket/zscaler/, got %s/%s", zscaler.S3.Bucket, zscaler.S3.Prefix)
+	}
+	if zscaler.Processing.DefaultFormat != "zscaler" {
+		t.Errorf("Expected format zscaler, got %s", zscaler.Processing.DefaultFormat)
+	}
+	if zscaler.State.FilePath != "/var/lib/s3-streamer/state-zscaler.json" {
+		t.Errorf("Unexpected state file %s", zscaler.State.FilePath)
+	}
+	if zscaler.State.Redis.KeyPrefix != "s3-streamer:zscaler" {
+		t.Errorf("Unexpected Redis key prefix %s", zscaler.State.Redis.KeyPrefix)
+	}
+	if zscaler.HTTP.SpillDir != "/var/lib/s3-streamer/spill/zscaler" {
+		t.Errorf("Unexpected spill dir %s", zscaler.HTTP.SpillDir)
+	}
+
+	umbrella := pipelines[1].Config
+	if umbrella.S3.Bucket != "umbrella-bucket" || umbrella.HTTP.Endpoints[0] != "http://localhost:8081" {
+		t.Errorf("Expected pipeline overrides, got bucket %s endpoints %v", umbrella.S3.Bucket, umbrella.HTTP.Endpoints)
+	}
+	if umbrella.State.KV.Key != "s3-streamer/state/umbrella-dns" {
+		t.Errorf("Unexpected KV key %s", umbrella.State.KV.Key)
+	}
+	if umbrella.State.SQL.Table != "s3_streamer_files_umbrella_dns" {
+		t.Errorf("Unexpected SQL table %s", umbrella.State.SQL.Table)
+	}
+	if umbrella.State.Snapshot.Key != "s3-streamer/state-snapshot-umbrella-dns.json" {
+		t.Errorf("Unexpected snapshot key %s", umbrella.State.Snapshot.Key)
+	}
+
+	// The shared configuration is not modified
+	if cfg.HTTP.Endpoints[0] != "http://localhost:8080" || cfg.State.FilePath != "/var/lib/s3-streamer/state.json" {
+		t.Error("Resolving pipelines modified the top-level configuration")
+	}
+}
+
+func TestResolvePipelines_Credentials(t *testing.T) {
+	cfg := newPipelineTestConfig()
+	cfg.AWS.RefreshInterval = 10 * time.Minute
+	cfg.AWS.IMDS.Disabled = true
+	cfg.Pipelines = []PipelineConfig{
+		{Name: "local"},
+		{Name: "partner", Bucket: "partner-logs", Region: "eu-west-1", AWS: &AWSConfig{
+			AssumeRole: AssumeRoleConfig{RoleARN: "arn:aws:iam::210987654321:role/logs-reader"},
+		}},
+	}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	pipelines := cfg.ResolvePipelines()
+	local, partner := pipelines[0].Config, pipelines[1].Config
+	if local.S3.Region != "us-east-1" || local.AWS.AssumeRole.RoleARN != "" {
+		t.Errorf("Expected the top-level region and credentials, got %s %+v", local.S3.Region, local.AWS)
+	}
+	if partner.S3.Region != "eu-west-1" || partner.AWS.AssumeRole.RoleARN != "arn:aws:iam::210987654321:role/logs-reader" {
+		t.Errorf("Expected the pipeline region and credentials, got %s %+v", partner.S3.Region, partner.AWS)
+	}
+	if partner.AWS.AssumeRole.Duration != time.Hour || partner.AWS.RefreshInterval != 10*time.Minute || !partner.AWS.IMDS.Disabled {
+		t.Errorf("Expected defaults and the top-level refresh and metadata settings, got %+v", partner.AWS)
+	}
+}
+
+func TestValidate_Pipelines(t *testing.T) {
+	tests := []struct {
+		name      string
+		pipelines []PipelineConfig
+	}{
+		{"missing name", []PipelineConfig{{Prefix: "a/"}}},
+		{"unsafe name", []PipelineConfig{{Name: "../etc"}}},
+		{"duplicate name", []PipelineConfig{{Name: "a"}, {Name: "a"}}},
+		{"bad endpoint", []PipelineConfig{{Name: "a", Endpoints: []string{"ftp://x"}}}},
+		{"bad role", []PipelineConfig{{Name: "a", AWS: &AWSConfig{AssumeRole: AssumeRoleConfig{RoleARN: "logs-reader"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newPipelineTestConfig()
+			cfg.Pipelines = tt.pipelines
+			cfg.ApplyDefaults()
+			if err := cfg.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+
+	// Top-level bucket and endpoints are optional when every pipeline sets them
+	cfg := newPipelineTestConfig()
+	cfg.S3.Bucket = ""
+	cfg.HTTP.Endpoints = nil
+	cfg.Pipelines = []PipelineConfig{{Name: "a", Bucket: "b", Endpoints: []string{"http://localhost:8080"}}}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+}
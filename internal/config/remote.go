@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/awsjson"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// remoteFetchTimeout bounds one fetch of a remote configuration
+const remoteFetchTimeout = 30 * time.Second
+
+// defaultConfigCacheDir holds the last fetched copy of each remote configuration
+// (override with CONFIG_CACHE_DIR)
+const defaultConfigCacheDir = "/var/lib/s3-streamer"
+
+// remoteSource is a configuration stored in AWS rather than on disk:
+//
+//	s3://bucket/key
+//	ssm://parameter-name (or ssm:///path/to/parameter)
+//	secretsmanager://secret-id (name or ARN)
+//
+// Each accepts ?region=<region>; otherwise the default AWS region is used.
+type remoteSource struct {
+	location string
+	scheme   string
+	bucket   string // s3 only
+	name     string // Object key, parameter name or secret ID
+	region   string
+
+	// Set by tests
+	endpoint string
+	creds    aws.CredentialsProvider
+}
+
+// parseRemote returns the remote source at location, or nil for a local path
+func parseRemote(location string) (*remoteSource, error) {
+	scheme, rest, ok := strings.Cut(location, "://")
+	if !ok {
+		return nil, nil
+	}
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config location %q: %w", location, err)
+	}
+	src := &remoteSource{location: location, scheme: scheme, name: rest, region: query.Get("region")}
+	switch scheme {
+	case "s3":
+		src.bucket, src.name, _ = strings.Cut(rest, "/")
+		if src.bucket == "" || src.name == "" {
+			return nil, fmt.Errorf("invalid config location %q: expected s3://bucket/key", location)
+		}
+	case "ssm", "secretsmanager":
+		if src.name == "" {
+			return nil, fmt.Errorf("invalid config location %q: missing name", location)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config location %q: use a file path, s3://, ssm:// or secretsmanager://", location)
+	}
+	return src, nil
+}
+
+// fetch reads the configuration document
+func (s *remoteSource) fetch(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteFetchTimeout)
+	defer cancel()
+
+	awsCfg := aws.Config{Region: s.region, Credentials: s.creds}
+	if s.creds == nil {
+		loaded, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+		}
+		awsCfg = loaded
+		if s.region != "" {
+			awsCfg.Region = s.region
+		}
+	}
+	if awsCfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region for %s: set AWS_REGION or add ?region=", s.location)
+	}
+
+	switch s.scheme {
+	case "s3":
+		client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			if s.endpoint != "" {
+				o.BaseEndpoint = aws.String(s.endpoint)
+				o.UsePathStyle = true
+			}
+		})
+		resp, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.name)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", s.location, err)
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	case "ssm":
+		var out struct {
+			Parameter struct {
+				Value string
+			}
+		}
+		in := map[string]any{"Name": s.name, "WithDecryption": true}
+		if err := s.call(ctx, awsCfg, "ssm", "AmazonSSM.GetParameter", in, &out); err != nil {
+			return nil, err
+		}
+		return []byte(out.Parameter.Value), nil
+	default:
+		var out struct {
+			SecretString string
+			SecretBinary []byte
+		}
+		in := map[string]any{"SecretId": s.name}
+		if err := s.call(ctx, awsCfg, "secretsmanager", "secretsmanager.GetSecretValue", in, &out); err != nil {
+			return nil, err
+		}
+		if out.SecretString != "" {
+			return []byte(out.SecretString), nil
+		}
+		return out.SecretBinary, nil
+	}
+}
+
+// call invokes an AWS JSON 1.1 API (SSM, Secrets Manager)
+func (s *remoteSource) call(ctx context.Context, awsCfg aws.Config, service, target string, in, out any) error {
+	if err := awsjson.Call(ctx, awsCfg, s.endpoint, service, target, in, out); err != nil {
+		return fmt.Errorf("%s: %w", s.location, err)
+	}
+	return nil
+}
+
+// cachePath is where the last fetched copy of the configuration is kept
+func (s *remoteSource) cachePath() string {
+	dir := os.Getenv("CONFIG_CACHE_DIR")
+	if dir == "" {
+		dir = defaultConfigCacheDir
+	}
+	sum := sha256.Sum256([]byte(s.location))
+	return filepath.Join(dir, "config-"+hex.EncodeToString(sum[:8])+".yaml")
+}
+
+// fetchCached fetches the configuration and caches it on disk. When the fetch fails, the
+// cached copy is used, so the streamer can restart while the remote store is unavailable.
+func (s *remoteSource) fetchCached(ctx context.Context) ([]byte, error) {
+	logger := logging.Component("config")
+	path := s.cachePath()
+
+	data, err := s.fetch(ctx)
+	if err != nil {
+		cached, cacheErr := os.ReadFile(path)
+		if cacheErr != nil {
+			return nil, err
+		}
+		logger.Warn("Failed to fetch configuration, using cached copy",
+			"location", s.location,
+			"cache", path,
+			"error", err)
+		return cached, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err == nil {
+		err = os.WriteFile(path, data, 0o600) // May contain secrets
+	}
+	if err != nil {
+		logger.Warn("Failed to cache configuration", "location", s.location, "cache", path, "error", err)
+	}
+	return data, nil
+}
+
+// readLocation reads the configuration document at a file path or remote location
+func readLocation(ctx context.Context, location string) ([]byte, error) {
+	src, err := parseRemote(location)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		data, err := os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		return data, nil
+	}
+	return src.fetchCached(ctx)
+}
+
+// Watch re-reads the configuration at location, with its includes, every interval (never if
+// interval is 0) and on every SIGHUP until ctx is done. It calls onChange with each changed
+// configuration that parses and validates after overrides (optional) are applied;
+// invalid changes are logged and skipped. The first read sets the baseline.
+func Watch(ctx context.Context, location string, interval time.Duration, overrides *Overrides, onChange func(*Config)) {
+	logger := logging.Component("config")
+	_, last, _ := readDocument(ctx, location)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	signals, stop := reloadSignals()
+	defer stop()
+
+	reload := func(signaled bool) {
+		doc, data, err := readDocument(ctx, location)
+		if err != nil {
+			logger.Warn("Failed to read configuration", "location", location, "error", err)
+			return
+		}
+		if bytes.Equal(data, last) {
+			if signaled {
+				logger.Info("Configuration unchanged", "location", location)
+			}
+			return
+		}
+		last = data
+		cfg, err := build(ctx, doc, overrides, os.Environ())
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			logger.Warn("Ignoring invalid configuration change", "location", location, "error", err)
+			return
+		}
+		logger.Info("Configuration changed", "location", location)
+		onChange(cfg)
+	}
+
+	for {
+		select {
+		case <-tick:
+			reload(false)
+		case <-signals:
+			logger.Info("Reloading configuration (SIGHUP)", "location", location)
+			reload(true)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
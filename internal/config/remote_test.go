@@ -0,0 +1,178 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const remoteTestConfig = "s3:\n  bucket: remote-bucket\n  region: us-east-1\n"
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		location string
+		want     *remoteSource
+		wantErr  bool
+	}{
+		{"config.yaml", nil, false},
+		{"s3://configs/streamer/prod.yaml", &remoteSource{scheme: "s3", bucket: "configs", name: "streamer/prod.yaml"}, false},
+		{"ssm:///streamer/prod?region=eu-west-1", &remoteSource{scheme: "ssm", name: "/streamer/prod", region: "eu-west-1"}, false},
+		{"secretsmanager://arn:aws:secretsmanager:us-east-1:123:secret:streamer", &remoteSource{scheme: "secretsmanager", name: "arn:aws:secretsmanager:us-east-1:123:secret:streamer"}, false},
+		{"s3://configs", nil, true},
+		{"ssm://", nil, true},
+		{"https://example.com/config.yaml", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			got, err := parseRemote(tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRemote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				if got != nil && !tt.wantErr {
+					t.Errorf("Expected a local path, got %+v", got)
+				}
+				return
+			}
+			if got.scheme != tt.want.scheme || got.bucket != tt.want.bucket || got.name != tt.want.name || got.region != tt.want.region {
+				t.Errorf("parseRemote() = %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteSource_Fetch(t *testing.T) {
+	var target, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, auth = r.Header.Get("X-Amz-Target"), r.Header.Get("Authorization")
+		var in map[string]any
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/configs/prod.yaml":
+			w.Write([]byte(remoteTestConfig))
+		case target == "AmazonSSM.GetParameter":
+			json.NewDecoder(r.Body).Decode(&in)
+			if in["Name"] != "/streamer/prod" || in["WithDecryption"] != true {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"Parameter": map[string]any{"Value": remoteTestConfig}})
+		case target == "secretsmanager.GetSecretValue":
+			json.NewDecoder(r.Body).Decode(&in)
+			if in["SecretId"] != "streamer" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"SecretString": remoteTestConfig})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	creds := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	for _, location := range []string{
+		"s3://configs/prod.yaml",
+		"ssm:///streamer/prod",
+		"secretsmanager://streamer",
+	} {
+		t.Run(location, func(t *testing.T) {
+			src, err := parseRemote(location + "?region=us-east-1")
+			if err != nil {
+				t.Fatalf("parseRemote() failed: %v", err)
+			}
+			src.endpoint, src.creds = server.URL, creds
+			data, err := src.fetch(context.Background())
+			if err != nil {
+				t.Fatalf("fetch() failed: %v", err)
+			}
+			if string(data) != remoteTestConfig {
+				t.Errorf("Expected the stored config, got %q", data)
+			}
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256") {
+				t.Errorf("Expected a SigV4-signed request, got %q", auth)
+			}
+		})
+	}
+
+	src, _ := parseRemote("secretsmanager://missing?region=us-east-1")
+	src.endpoint, src.creds = server.URL, creds
+	if _, err := src.fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("Expected the API error, got %v", err)
+	}
+}
+
+func TestRemoteSource_FetchCached(t *testing.T) {
+	t.Setenv("CONFIG_CACHE_DIR", t.TempDir())
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Parameter": map[string]any{"Value": remoteTestConfig}})
+	}))
+	defer server.Close()
+
+	src, _ := parseRemote("ssm://streamer?region=us-east-1")
+	src.endpoint = server.URL
+	src.creds = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	if _, err := src.fetchCached(context.Background()); err != nil {
+		t.Fatalf("fetchCached() failed: %v", err)
+	}
+
+	// Parameter Store is down: the cached copy is used
+	down.Store(true)
+	data, err := src.fetchCached(context.Background())
+	if err != nil || string(data) != remoteTestConfig {
+		t.Errorf("Expected the cached config, got %q, %v", data, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := t.TempDir() + "/config.yaml"
+	valid := `
+s3: {bucket: b, region: us-east-1}
+http: {endpoints: ["http://localhost:8080"], batch_lines: 1000, batch_bytes: 1048576, flush_interval: 1s, workers: 10, buffer_size: 50000}
+processing: {worker_count: 5, scan_interval: 15s, delay_window: 60s}
+logging: {level: info, format: json}
+`
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	writeConfig(valid)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan *Config, 1)
+	go Watch(ctx, path, 10*time.Millisecond, nil, func(cfg *Config) { changes <- cfg })
+
+	time.Sleep(50 * time.Millisecond)
+	writeConfig("s3: {bucket: b}\n") // Invalid: no region
+	time.Sleep(50 * time.Millisecond)
+	writeConfig(strings.Replace(valid, "bucket: b", "bucket: c", 1))
+
+	select {
+	case cfg := <-changes:
+		if cfg.S3.Bucket != "c" {
+			t.Errorf("Expected the valid change, got bucket %q", cfg.S3.Bucket)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a change notification")
+	}
+}
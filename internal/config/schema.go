@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// durationPattern matches the Go durations the configuration accepts (e.g. "30s", "1h30m")
+const durationPattern = `^(0|-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`
+
+// envReferencePattern matches a value that is a single environment variable reference
+// (see expandEnv), allowed in place of any scalar
+const envReferencePattern = `^\$\{[A-Za-z_][A-Za-z0-9_]*(:-[^}]*)?\}$`
+
+// JSONSchema returns a JSON Schema (draft 2020-12) of the configuration file, for editor
+// validation and completion. Like Load, it rejects unknown fields.
+func JSONSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["properties"].(map[string]any)[includeKey] = map[string]any{"anyOf": []any{
+		map[string]any{"type": "string"},
+		map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+	}}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "s3-edgedelta-streamer configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema of values decoded into t
+func typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return orEnvReference(map[string]any{"type": "string", "pattern": durationPattern})
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for name, field := range yamlFields(t) {
+			properties[name] = typeSchema(field.Type)
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Bool:
+		return orEnvReference(map[string]any{"type": "boolean"})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return orEnvReference(map[string]any{"type": "integer"})
+	case reflect.Float32, reflect.Float64:
+		return orEnvReference(map[string]any{"type": "number"})
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// orEnvReference also accepts an environment variable reference in place of a value
+func orEnvReference(schema map[string]any) map[string]any {
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "string", "pattern": envReferencePattern}}}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// secretResolver resolves references to secrets kept outside the configuration file.
+// Settings tagged secret:"true" (passwords, tokens, header values) may hold:
+//
+//	env:NAME       the value of environment variable NAME
+//	file:/path     the contents of a file, without trailing newlines (e.g. a mounted Kubernetes secret)
+//	aws-sm:name    a Secrets Manager secret (name or ARN, optionally ?region=<region>)
+//
+// Any other value is used as is. Each secret is fetched once per load.
+type secretResolver struct {
+	cache map[string]string
+
+	// Set by tests
+	endpoint string
+	creds    aws.CredentialsProvider
+}
+
+// newSecretResolver creates a resolver with an empty cache
+func newSecretResolver() *secretResolver {
+	return &secretResolver{cache: make(map[string]string)}
+}
+
+// resolve returns the secret value referenced by value, or value itself if it is not a reference
+func (r *secretResolver) resolve(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+	switch scheme {
+	case "env":
+		secret, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", ref)
+		}
+		return secret, nil
+	case "file":
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		if strings.HasPrefix(string(data), "SQLite format 3\x00") {
+			// A SQLite file: URI in state.sql.dsn rather than a secret
+			return "", fmt.Errorf("%s is a SQLite database, not a secret; give the database path without file:", ref)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "aws-sm":
+		if secret, ok := r.cache[value]; ok {
+			return secret, nil
+		}
+		name, rawQuery, _ := strings.Cut(ref, "?")
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil || name == "" {
+			return "", fmt.Errorf("invalid secret reference %q: expected aws-sm:name", value)
+		}
+		src := &remoteSource{location: value, scheme: "secretsmanager", name: name, region: query.Get("region"),
+			endpoint: r.endpoint, creds: r.creds}
+		data, err := src.fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		r.cache[value] = string(data)
+		return string(data), nil
+	default:
+		return value, nil
+	}
+}
+
+// resolveSecrets replaces the secret references in the settings of v tagged secret:"true".
+// path is the key of v ("" at the top level).
+func (r *secretResolver) resolveSecrets(ctx context.Context, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			key := joinKey(path, name)
+			if t.Field(i).Tag.Get("secret") == "true" {
+				if err := r.resolveValue(ctx, v.Field(i), key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := r.resolveSecrets(ctx, v.Field(i), key); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.resolveSecrets(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveValue resolves a secret setting: a string, or a map of them (such as headers)
+func (r *secretResolver) resolveValue(ctx context.Context, v reflect.Value, key string) error {
+	switch v.Kind() {
+	case reflect.String:
+		secret, err := r.resolve(ctx, v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetString(secret)
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := r.resolveValue(ctx, elem, fmt.Sprintf("%s[%q]", key, iter.Key())); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestSecretResolver(t *testing.T) {
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]any
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["SecretId"] != "streamer/admin" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fetches++
+		json.NewEncoder(w).Encode(map[string]any{"SecretString": "sm-token"})
+	}))
+	defer server.Close()
+
+	t.Setenv("STREAMER_REDIS_PASSWORD", "env-password")
+	t.Setenv("STREAMER_DSN", "postgres://streamer:pw@db/streamer")
+	keyFile := filepath.Join(t.TempDir(), "otlp-key")
+	if err := os.WriteFile(keyFile, []byte("file-key\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	cfg := Config{
+		HTTP: HTTPConfig{
+			Headers:         map[string]string{"Authorization": "aws-sm:streamer/admin?region=us-east-1", "X-Log-Format": "{format}"},
+			EndpointHeaders: map[string]map[string]string{"http://a:8080": {"X-Key": "env:STREAMER_REDIS_PASSWORD"}},
+		},
+		State: StateConfig{
+			Redis: RedisConfig{Host: "env:NOT_A_SECRET", Password: "env:STREAMER_REDIS_PASSWORD"},
+			SQL:   SQLConfig{DSN: "env:STREAMER_DSN"},
+		},
+		OTLP:   OTLPConfig{Headers: map[string]string{"X-Api-Key": "file:" + keyFile}},
+		Health: HealthConfig{AdminToken: "aws-sm:streamer/admin?region=us-east-1"},
+	}
+	r := newSecretResolver()
+	r.endpoint = server.URL
+	r.creds = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	if err := r.resolveSecrets(context.Background(), reflect.ValueOf(&cfg).Elem(), ""); err != nil {
+		t.Fatalf("resolveSecrets() failed: %v", err)
+	}
+
+	if cfg.State.Redis.Password != "env-password" {
+		t.Errorf("Expected the environment variable, got %q", cfg.State.Redis.Password)
+	}
+	if cfg.State.SQL.DSN != "postgres://streamer:pw@db/streamer" {
+		t.Errorf("Expected the DSN from the environment, got %q", cfg.State.SQL.DSN)
+	}
+	if cfg.State.Redis.Host != "env:NOT_A_SECRET" {
+		t.Errorf("Expected settings that are not secrets to be kept, got %q", cfg.State.Redis.Host)
+	}
+	if got := cfg.OTLP.Headers["X-Api-Key"]; got != "file-key" {
+		t.Errorf("Expected the file contents without the newline, got %q", got)
+	}
+	if cfg.Health.AdminToken != "sm-token" || cfg.HTTP.Headers["Authorization"] != "sm-token" {
+		t.Errorf("Expected the Secrets Manager secret, got %q, %q", cfg.Health.AdminToken, cfg.HTTP.Headers["Authorization"])
+	}
+	if fetches != 1 {
+		t.Errorf("Expected the secret to be fetched once, got %d fetches", fetches)
+	}
+	if got := cfg.HTTP.Headers["X-Log-Format"]; got != "{format}" {
+		t.Errorf("Expected plain values to be kept, got %q", got)
+	}
+	if got := cfg.HTTP.EndpointHeaders["http://a:8080"]["X-Key"]; got != "env-password" {
+		t.Errorf("Expected per-endpoint headers to be resolved, got %q", got)
+	}
+}
+
+func TestLoad_SecretErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "state:\n  redis:\n    password: env:STREAMER_MISSING_SECRET\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "state.redis.password") || !strings.Contains(err.Error(), "STREAMER_MISSING_SECRET") {
+		t.Errorf("Expected an error naming the setting and variable, got %v", err)
+	}
+}
+
+func TestLoad_SQLiteFileURI(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "state.db")
+	if err := os.WriteFile(db, []byte("SQLite format 3\x00"), 0o600); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	data := "state:\n  sql:\n    dsn: file:" + db + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "state.sql.dsn") || !strings.Contains(err.Error(), "SQLite database") {
+		t.Errorf("Expected an error pointing at the SQLite file: URI, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package config
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadSignals delivers SIGHUP until stop is called
+func reloadSignals() (signals <-chan os.Signal, stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	return ch, func() { signal.Stop(ch) }
+}
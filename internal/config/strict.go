@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unknownFields returns an error per mapping key in n that matches no field of t, so a
+// misspelled setting (bacth_lines) is rejected instead of silently ignored. path is the
+// key of n ("" at the top level).
+func unknownFields(n *yaml.Node, t reflect.Type, path string) []string {
+	for n.Kind == yaml.DocumentNode || n.Kind == yaml.AliasNode {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		} else if len(n.Content) > 0 {
+			n = n.Content[0]
+		} else {
+			return nil
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var errs []string
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return nil // Type mismatches are reported when decoding
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" { // Merge key: the merged mappings must match t too
+				errs = append(errs, unknownFields(value, t, path)...)
+				continue
+			}
+			field, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, unknownFieldError(key, path, fields))
+				continue
+			}
+			errs = append(errs, unknownFields(value, field.Type, joinKey(path, key.Value))...)
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			errs = append(errs, unknownFields(n.Content[i+1], t.Elem(), joinKey(path, n.Content[i].Value))...)
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range n.Content {
+			errs = append(errs, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return errs
+}
+
+// yamlFields returns the fields of struct type t by configuration key
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i)
+		}
+	}
+	return fields
+}
+
+// unknownFieldError describes an unknown key, suggesting the closest known one
+func unknownFieldError(key *yaml.Node, path string, fields map[string]reflect.StructField) string {
+	msg := fmt.Sprintf("line %d: unknown field %q", key.Line, joinKey(path, key.Value))
+	best, bestDistance := "", 3 // Suggest only names within two edits
+	for name := range fields {
+		if d := editDistance(key.Value, name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if best != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", joinKey(path, best))
+	}
+	return msg
+}
+
+// joinKey appends key to a dotted configuration path
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment) distance
+// between a and b, so a transposition (bacth/batch) counts as one edit
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
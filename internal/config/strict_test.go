@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUnknownFields(t *testing.T) {
+	doc := `
+defaults: &http_defaults
+  batch_lines: 1000
+s3:
+  bucket: b
+  regoin: us-east-1
+http:
+  <<: *http_defaults
+  bacth_bytes: 1048576
+  headers:
+    X-Anything: allowed
+processing:
+  log_formats:
+    - name: custom
+      timestamp_fromat: unix
+otlp:
+  histogram_buckets:
+    default: [0.1, 1]
+`
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &n); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	errs := unknownFields(&n, reflect.TypeOf(Config{}), "")
+	want := []string{
+		`line 2: unknown field "defaults"`,
+		`line 6: unknown field "s3.regoin" (did you mean "s3.region"?)`,
+		`line 9: unknown field "http.bacth_bytes" (did you mean "http.batch_bytes"?)`,
+		`line 15: unknown field "processing.log_formats[0].timestamp_fromat" (did you mean "processing.log_formats[0].timestamp_format"?)`,
+	}
+	if !slices.Equal(errs, want) {
+		t.Errorf("Expected %q, got %q", want, errs)
+	}
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("http:\n  bacth_lines: 500\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), `did you mean "http.batch_lines"?`) {
+		t.Errorf("Expected an unknown field error, got %v", err)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() failed: %v", err)
+	}
+	var schema struct {
+		AdditionalProperties bool `json:"additionalProperties"`
+		Properties           map[string]struct {
+			AdditionalProperties bool                       `json:"additionalProperties"`
+			Properties           map[string]json.RawMessage `json:"properties"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if schema.AdditionalProperties {
+		t.Error("Expected unknown top-level fields to be rejected")
+	}
+	http, ok := schema.Properties["http"]
+	if !ok || http.AdditionalProperties {
+		t.Fatal("Expected a closed http section")
+	}
+	if got := string(http.Properties["endpoints"]); !strings.Contains(got, `"type":"array"`) && !strings.Contains(got, `"type": "array"`) {
+		t.Errorf("Expected http.endpoints to be an array, got %s", got)
+	}
+	if got := string(http.Properties["flush_interval"]); !strings.Contains(got, "pattern") {
+		t.Errorf("Expected http.flush_interval to be a duration string, got %s", got)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"batch_lines", "batch_lines", 0},
+		{"bacth_lines", "batch_lines", 1},
+		{"batch_line", "batch_lines", 1},
+		{"abc", "xyz", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
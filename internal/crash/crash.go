@@ -0,0 +1,233 @@
+// Package crash writes a report of an unrecovered panic before the process exits, so rare
+// production crashes can be investigated afterwards.
+package crash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// crashOutputFile receives the runtime's own crash output (see Reporter.Install)
+const crashOutputFile = "crash-output.log"
+
+// Reporter writes crash reports to a directory. Each report holds the panic and its stack,
+// the build, the last state snapshot and the stacks of all goroutines.
+type Reporter struct {
+	dir        string
+	version    string
+	maxReports int
+
+	mu      sync.Mutex
+	state   func() any // Returns the state snapshot (optional)
+	written bool       // Whether a report was written; later panics are not reported
+	output  *os.File   // Crash output set by Install
+}
+
+// NewReporter creates a reporter writing to dir, which is created if missing. version is the
+// service version included in reports; maxReports is how many reports are kept (0 = all).
+func NewReporter(dir, version string, maxReports int) (*Reporter, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("crash report directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create crash report directory: %w", err)
+	}
+	return &Reporter{dir: dir, version: version, maxReports: maxReports}, nil
+}
+
+// SetState makes reports include the state returned by snapshot (e.g. a state.Snapshotter's
+// Snapshot), encoded as JSON
+func (r *Reporter) SetState(snapshot func() any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = snapshot
+}
+
+// current is the reporter used by Recover
+var current atomic.Pointer[Reporter]
+
+// Install makes r the reporter of Recover. It also has the runtime copy its output for
+// crashes Recover cannot see, such as fatal errors and panics in other goroutines, to
+// crash-output.log in the directory, with the stacks of all goroutines.
+func (r *Reporter) Install() error {
+	f, err := os.OpenFile(filepath.Join(r.dir, crashOutputFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open crash output file: %w", err)
+	}
+	if err := debug.SetCrashOutput(f, debug.CrashOptions{}); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to set crash output: %w", err)
+	}
+	debug.SetTraceback("all")
+
+	r.mu.Lock()
+	r.output = f
+	r.mu.Unlock()
+	current.Store(r)
+	return nil
+}
+
+// Uninstall stops reporting crashes through r, e.g. at shutdown
+func (r *Reporter) Uninstall() {
+	current.CompareAndSwap(r, nil)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.output != nil {
+		debug.SetCrashOutput(nil, debug.CrashOptions{})
+		r.output.Close()
+		r.output = nil
+	}
+}
+
+// Recover writes a crash report for a panic in the deferring goroutine and panics again, so
+// the process still exits. Defer it first in long-running goroutines; it does nothing
+// without a panic or an installed reporter.
+func Recover() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if r := current.Load(); r != nil {
+		if path, err := r.Write(v, debug.Stack()); err != nil {
+			logging.GetDefaultLogger().Error("Failed to write crash report", "panic", v, "error", err)
+		} else if path != "" {
+			logging.GetDefaultLogger().Error("Unrecovered panic, wrote crash report", "panic", v, "path", path)
+		}
+	}
+	panic(v)
+}
+
+// Write writes a report of the panic value v with the panicking goroutine's stack and returns
+// its path. Only the first report is written, since the process exits after it; later calls
+// return an empty path.
+func (r *Reporter) Write(v any, stack []byte) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.written {
+		return "", nil
+	}
+	r.written = true
+
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "s3-edgedelta-streamer crash report\n\n")
+	fmt.Fprintf(&buf, "time:       %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&buf, "panic:      %v\n", v)
+	fmt.Fprintf(&buf, "pid:        %d\n", os.Getpid())
+	writeBuild(&buf, r.version)
+
+	fmt.Fprintf(&buf, "\n== panicking goroutine ==\n\n%s\n", stack)
+
+	fmt.Fprintf(&buf, "\n== state ==\n\n")
+	r.writeState(&buf)
+
+	fmt.Fprintf(&buf, "\n== goroutines ==\n\n%s\n", allStacks())
+
+	name := fmt.Sprintf("crash-%s-%d.txt", now.Format("20060102T150405Z"), os.Getpid())
+	path := filepath.Join(r.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	r.prune()
+	return path, nil
+}
+
+// writeBuild writes the version, Go version, platform, commit and build date of the binary
+func writeBuild(buf *bytes.Buffer, version string) {
+	build := buildinfo.Get()
+	if version == "" {
+		version = build.Version
+	}
+	fmt.Fprintf(buf, "version:    %s\n", version)
+	if version != build.Version {
+		fmt.Fprintf(buf, "build:      %s\n", build.Version)
+	}
+	fmt.Fprintf(buf, "go:         %s %s\n", build.GoVersion, build.Platform)
+	if build.Commit != "" {
+		modified := ""
+		if build.Modified {
+			modified = " (modified)"
+		}
+		fmt.Fprintf(buf, "commit:     %s%s\n", build.Commit, modified)
+	}
+	if build.Date != "" {
+		fmt.Fprintf(buf, "built:      %s\n", build.Date)
+	}
+}
+
+// stateTimeout bounds the state snapshot, which waits for the state lock the panicking
+// goroutine may still hold (a variable for tests)
+var stateTimeout = 5 * time.Second
+
+// writeState writes the state snapshot as JSON, or why it could not be taken
+func (r *Reporter) writeState(buf *bytes.Buffer) {
+	if r.state == nil {
+		buf.WriteString("(no state source)\n")
+		return
+	}
+
+	done := make(chan []byte, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- []byte(fmt.Sprintf("(failed to take the state snapshot: %v)", v))
+			}
+		}()
+		data, err := json.MarshalIndent(r.state(), "", "  ")
+		if err != nil {
+			data = []byte(fmt.Sprintf("(failed to encode the state snapshot: %v)", err))
+		}
+		done <- data
+	}()
+	select {
+	case data := <-done:
+		buf.Write(data)
+	case <-time.After(stateTimeout):
+		fmt.Fprintf(buf, "(state snapshot timed out after %v; the state lock is likely held)", stateTimeout)
+	}
+	buf.WriteString("\n")
+}
+
+// allStacks returns the stacks of all goroutines, growing the buffer until they fit
+func allStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// prune removes the oldest reports beyond maxReports
+func (r *Reporter) prune() {
+	if r.maxReports <= 0 {
+		return
+	}
+	reports, err := filepath.Glob(filepath.Join(r.dir, "crash-*.txt"))
+	if err != nil || len(reports) <= r.maxReports {
+		return
+	}
+	sort.Strings(reports) // Named by time
+	for _, path := range reports[:len(reports)-r.maxReports] {
+		os.Remove(path)
+	}
+}
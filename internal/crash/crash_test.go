@@ -0,0 +1,147 @@
+package crash
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReporter_Write(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "crash")
+	r, err := NewReporter(dir, "1.2.3", 0)
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	r.SetState(func() any {
+		return map[string]any{"last_processed_file": "logs/2026/10/16/a.gz"}
+	})
+
+	path, err := r.Write("boom", debug.Stack())
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	report := string(data)
+	for _, want := range []string{
+		"panic:      boom",
+		"version:    1.2.3",
+		"== panicking goroutine ==",
+		"TestReporter_Write",
+		`"last_processed_file": "logs/2026/10/16/a.gz"`,
+		"== goroutines ==",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected %q in the report, got:\n%s", want, report)
+		}
+	}
+
+	// The process exits after the first report
+	if path, err := r.Write("again", nil); path != "" || err != nil {
+		t.Errorf("Expected no second report, got %q, %v", path, err)
+	}
+}
+
+func TestReporter_StateTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { stateTimeout = timeout }(stateTimeout)
+	stateTimeout = 100 * time.Millisecond
+
+	r, err := NewReporter(t.TempDir(), "", 0)
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	block := make(chan struct{})
+	defer close(block)
+	r.SetState(func() any {
+		<-block // The state lock is held by the panicking goroutine
+		return nil
+	})
+
+	start := time.Now()
+	path, err := r.Write("boom", nil)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if time.Since(start) > stateTimeout+time.Second {
+		t.Errorf("Expected the report within the state timeout, took %v", time.Since(start))
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "state snapshot timed out") {
+		t.Errorf("Expected the timeout in the report, got:\n%s", data)
+	}
+}
+
+func TestReporter_Prune(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"crash-20260101T000000Z-1.txt", "crash-20260102T000000Z-1.txt", "crash-20260103T000000Z-1.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewReporter(dir, "", 2)
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	if _, err := r.Write("boom", nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	reports, _ := filepath.Glob(filepath.Join(dir, "crash-*.txt"))
+	if len(reports) != 2 {
+		t.Fatalf("Expected 2 reports kept, got %v", reports)
+	}
+	if filepath.Base(reports[0]) != "crash-20260103T000000Z-1.txt" {
+		t.Errorf("Expected the oldest reports removed, got %v", reports)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewReporter(dir, "", 0)
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	if err := r.Install(); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	defer r.Uninstall()
+
+	var repanicked any
+	func() {
+		defer func() { repanicked = recover() }()
+		func() {
+			defer Recover()
+			panic("boom")
+		}()
+	}()
+
+	if repanicked != "boom" {
+		t.Errorf("Expected Recover to panic again with the value, got %v", repanicked)
+	}
+	reports, _ := filepath.Glob(filepath.Join(dir, "crash-*.txt"))
+	if len(reports) != 1 {
+		t.Errorf("Expected 1 crash report, got %v", reports)
+	}
+	if _, err := os.Stat(filepath.Join(dir, crashOutputFile)); err != nil {
+		t.Errorf("Expected the crash output file, got %v", err)
+	}
+}
+
+func TestRecover_NoReporter(t *testing.T) {
+	var repanicked any
+	func() {
+		defer func() { repanicked = recover() }()
+		func() {
+			defer Recover()
+			panic("boom")
+		}()
+	}()
+	if repanicked != "boom" {
+		t.Errorf("Expected the panic to continue without a reporter, got %v", repanicked)
+	}
+}
@@ -0,0 +1,189 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	awscreds "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// AWSConfig returns the AWS configuration for the streamer's clients. Base credentials come
+// from aws.profile when set, then the installer's encrypted credentials when present, and
+// otherwise from the SDK credential chain (environment, shared config, instance or task role). With
+// aws.assume_role.role_arn set, the base credentials assume that role; the temporary
+// credentials are cached and renewed before they expire. Nothing is exported to the
+// environment. region may be empty to use the default region.
+func AWSConfig(ctx context.Context, region string, awsCfg config.AWSConfig) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+
+	// An explicit profile takes precedence over the installer's credentials
+	var encrypted *decryptedCredentials
+	if awsCfg.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(awsCfg.Profile))
+	} else {
+		var err error
+		if encrypted, err = encryptedCredentials(); err != nil {
+			return aws.Config{}, err
+		}
+	}
+	if encrypted != nil {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			awscreds.NewStaticCredentialsProvider(encrypted.accessKey, encrypted.secretKey, "")))
+		if region == "" {
+			opts = append(opts, awsconfig.WithRegion(encrypted.region))
+		}
+	}
+
+	opts = append(opts, imdsOptions(awsCfg.IMDS)...)
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	var missingProfile awsconfig.SharedConfigProfileNotExistError
+	if errors.As(err, &missingProfile) {
+		return aws.Config{}, fmt.Errorf("AWS profile %q not found in ~/.aws/config or ~/.aws/credentials (AWS_CONFIG_FILE and AWS_SHARED_CREDENTIALS_FILE override the locations): %w",
+			missingProfile.Profile, err)
+	}
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if awsCfg.AssumeRole.RoleARN != "" {
+		cfg.Credentials = assumeRoleCredentials(cfg, awsCfg.AssumeRole)
+	}
+	if awsCfg.CredentialTimeout > 0 {
+		cfg.Credentials = retrieveWithTimeout(cfg.Credentials, awsCfg.CredentialTimeout)
+	}
+	return cfg, nil
+}
+
+// imdsOptions applies the instance metadata settings to the SDK's EC2 role provider
+func imdsOptions(imdsCfg config.IMDSConfig) []func(*awsconfig.LoadOptions) error {
+	if imdsCfg.Disabled {
+		return []func(*awsconfig.LoadOptions) error{awsconfig.WithEC2IMDSClientEnableState(imds.ClientDisabled)}
+	}
+
+	options := imds.Options{Endpoint: imdsCfg.Endpoint}
+	if imdsCfg.Timeout > 0 {
+		options.HTTPClient = awshttp.NewBuildableClient().WithTimeout(imdsCfg.Timeout)
+	}
+	if imdsCfg.MaxAttempts > 0 {
+		options.Retryer = retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = imdsCfg.MaxAttempts
+		})
+	}
+	if imdsCfg.RequireV2 {
+		options.EnableFallback = aws.FalseTernary
+	}
+	client := imds.New(options)
+	return []func(*awsconfig.LoadOptions) error{awsconfig.WithEC2RoleCredentialOptions(func(o *ec2rolecreds.Options) {
+		o.Client = client
+	})}
+}
+
+// retrieveWithTimeout bounds each retrieval from provider, so an unreachable credential
+// endpoint fails the request instead of stalling it
+func retrieveWithTimeout(provider aws.CredentialsProvider, timeout time.Duration) aws.CredentialsProvider {
+	return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		creds, err := provider.Retrieve(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return aws.Credentials{}, fmt.Errorf("timed out after %v retrieving AWS credentials: %w", timeout, err)
+		}
+		return creds, err
+	})
+}
+
+// assumeRoleCredentials returns cached credentials of role, assumed with the credentials of base
+func assumeRoleCredentials(base aws.Config, role config.AssumeRoleConfig, optFns ...func(*sts.Options)) aws.CredentialsProvider {
+	logging.Component("credentials").Debug("Assuming AWS role",
+		"role_arn", role.RoleARN,
+		"session_name", role.SessionName,
+		"duration", role.Duration)
+
+	client := sts.NewFromConfig(base, optFns...)
+	provider := stscreds.NewAssumeRoleProvider(client, role.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = role.SessionName
+		o.Duration = role.Duration
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+		if role.MFASerial != "" {
+			o.SerialNumber = aws.String(role.MFASerial)
+			o.TokenProvider = stscreds.StdinTokenProvider
+		}
+	})
+	return aws.NewCredentialsCache(provider)
+}
+
+// decryptedCredentials are the installer's encrypted AWS credentials
+type decryptedCredentials struct {
+	accessKey, secretKey, region string
+}
+
+// encryptedCredentials decrypts the installer's credentials, or returns nil if the
+// environment already holds credentials or there are none
+func encryptedCredentials() (*decryptedCredentials, error) {
+	logger := logging.Component("credentials")
+
+	// Check if credentials are already in environment
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" &&
+		os.Getenv("AWS_SECRET_ACCESS_KEY") != "" &&
+		os.Getenv("AWS_REGION") != "" {
+		logger.Debug("AWS credentials loaded from environment variables")
+		return nil, nil
+	}
+
+	// Get credentials directory from environment or use default
+	credsDir := Dir()
+
+	// Check if credentials directory exists
+	if _, err := os.Stat(credsDir); os.IsNotExist(err) {
+		// No encrypted credentials, rely on environment or AWS config
+		logger.Debug("No encrypted credentials found, relying on environment or AWS config",
+			"credentials_dir", credsDir)
+		return nil, nil
+	}
+
+	logger.Debug("Loading encrypted credentials",
+		"credentials_dir", credsDir)
+
+	// KMS-encrypted files need no machine key
+	encKey, err := machineKey()
+	if err != nil {
+		logger.Debug("No machine key; only KMS-encrypted credentials can be read", "error", err)
+	}
+
+	// Decrypt each credential
+	accessKey, err := decryptCredential(credsDir, "aws_access_key_id", encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt access key: %w", err)
+	}
+
+	secretKey, err := decryptCredential(credsDir, "aws_secret_access_key", encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret key: %w", err)
+	}
+
+	region, err := decryptCredential(credsDir, "aws_region", encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt region: %w", err)
+	}
+
+	logger.Debug("Successfully loaded encrypted AWS credentials")
+	return &decryptedCredentials{accessKey: accessKey, secretKey: secretKey, region: region}, nil
+}
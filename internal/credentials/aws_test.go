@@ -0,0 +1,221 @@
+package credentials
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	var form url.Values
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult>
+<Credentials><AccessKeyId>ASIAROLE</AccessKeyId><SecretAccessKey>role-secret</SecretAccessKey><SessionToken>role-token</SessionToken><Expiration>` +
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `</Expiration></Credentials>
+<AssumedRoleUser><Arn>arn:aws:sts::123456789012:assumed-role/streamer/s3-edgedelta-streamer</Arn><AssumedRoleId>AROA:s3-edgedelta-streamer</AssumedRoleId></AssumedRoleUser>
+</AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer server.Close()
+
+	base := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIABASE", SecretAccessKey: "base-secret"}, nil
+		}),
+	}
+	role := config.AssumeRoleConfig{
+		RoleARN:     "arn:aws:iam::123456789012:role/streamer",
+		SessionName: "s3-edgedelta-streamer",
+		ExternalID:  "edgedelta",
+		Duration:    30 * time.Minute,
+	}
+	provider := assumeRoleCredentials(base, role, func(o *sts.Options) {
+		o.BaseEndpoint = aws.String(server.URL)
+	})
+
+	for i := 0; i < 2; i++ {
+		creds, err := provider.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Retrieve() failed: %v", err)
+		}
+		if creds.AccessKeyID != "ASIAROLE" || creds.SessionToken != "role-token" {
+			t.Errorf("Expected the role's credentials, got %+v", creds)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the credentials to be cached, got %d AssumeRole calls", calls)
+	}
+	want := map[string]string{
+		"Action":          "AssumeRole",
+		"RoleArn":         role.RoleARN,
+		"RoleSessionName": "s3-edgedelta-streamer",
+		"ExternalId":      "edgedelta",
+		"DurationSeconds": "1800",
+	}
+	for key, value := range want {
+		if got := form.Get(key); got != value {
+			t.Errorf("Expected %s=%s, got %q", key, value, got)
+		}
+	}
+}
+
+func TestAWSConfig_Environment(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	cfg, err := AWSConfig(context.Background(), "us-east-1", config.AWSConfig{})
+	if err != nil {
+		t.Fatalf("AWSConfig() failed: %v", err)
+	}
+	if cfg.Region != "us-east-1" {
+		t.Errorf("Expected the configured region, got %q", cfg.Region)
+	}
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "AKIAENV" {
+		t.Errorf("Expected the credential chain's credentials, got %+v, %v", creds, err)
+	}
+}
+
+func TestAWSConfig_Profile(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	credentialsFile := filepath.Join(dir, "credentials")
+	os.WriteFile(configFile, []byte("[profile logs]\nregion = eu-central-1\n"), 0o600)
+	os.WriteFile(credentialsFile, []byte("[logs]\naws_access_key_id = AKIAPROFILE\naws_secret_access_key = profile-secret\n"), 0o600)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+
+	cfg, err := AWSConfig(context.Background(), "", config.AWSConfig{Profile: "logs"})
+	if err != nil {
+		t.Fatalf("AWSConfig() failed: %v", err)
+	}
+	if cfg.Region != "eu-central-1" {
+		t.Errorf("Expected the profile's region, got %q", cfg.Region)
+	}
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "AKIAPROFILE" {
+		t.Errorf("Expected the profile to take precedence over the environment, got %+v, %v", creds, err)
+	}
+
+	_, err = AWSConfig(context.Background(), "", config.AWSConfig{Profile: "missing"})
+	if err == nil || !strings.Contains(err.Error(), `AWS profile "missing" not found`) {
+		t.Errorf("Expected a missing profile error, got %v", err)
+	}
+}
+
+// newIMDSServer serves instance role credentials; the IMDSv2 token request hangs when
+// hopLimited, as it does from a container behind a hop limit of 1
+func newIMDSServer(t *testing.T, hopLimited bool) (*httptest.Server, *int) {
+	t.Helper()
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/latest/api/token":
+			if hopLimited {
+				<-r.Context().Done()
+				return
+			}
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			w.Write([]byte("token"))
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("streamer"))
+		case "/latest/meta-data/iam/security-credentials/streamer":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIAIMDS","SecretAccessKey":"imds-secret","Token":"imds-token","Expiration":"` +
+				time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// isolateCredentialChain leaves instance metadata as the only credential source
+func isolateCredentialChain(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("CREDENTIALS_DIR", filepath.Join(dir, "none"))
+}
+
+func TestAWSConfig_IMDS(t *testing.T) {
+	isolateCredentialChain(t)
+	ctx := context.Background()
+	imdsCfg := config.IMDSConfig{Timeout: 200 * time.Millisecond, MaxAttempts: 1}
+	retrieve := func(awsCfg config.AWSConfig) (aws.Credentials, error) {
+		t.Helper()
+		cfg, err := AWSConfig(ctx, "us-east-1", awsCfg)
+		if err != nil {
+			t.Fatalf("AWSConfig() failed: %v", err)
+		}
+		return cfg.Credentials.Retrieve(ctx)
+	}
+
+	server, _ := newIMDSServer(t, false)
+	imdsCfg.Endpoint = server.URL
+	creds, err := retrieve(config.AWSConfig{IMDS: imdsCfg})
+	if err != nil || creds.AccessKeyID != "ASIAIMDS" {
+		t.Errorf("Expected the instance role's credentials, got %+v, %v", creds, err)
+	}
+
+	// A hanging token request falls back to IMDSv1 after the timeout, unless IMDSv2 is required
+	server, _ = newIMDSServer(t, true)
+	imdsCfg.Endpoint = server.URL
+	start := time.Now()
+	creds, err = retrieve(config.AWSConfig{IMDS: imdsCfg})
+	if err != nil || creds.AccessKeyID != "ASIAIMDS" {
+		t.Errorf("Expected an IMDSv1 fallback, got %+v, %v", creds, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the token timeout to apply, took %v", elapsed)
+	}
+	imdsCfg.RequireV2 = true
+	if _, err := retrieve(config.AWSConfig{IMDS: imdsCfg}); err == nil {
+		t.Error("Expected require_v2 to fail without a token")
+	}
+
+	server, requests := newIMDSServer(t, false)
+	if _, err := retrieve(config.AWSConfig{IMDS: config.IMDSConfig{Disabled: true, Endpoint: server.URL}}); err == nil {
+		t.Error("Expected no credentials with instance metadata disabled")
+	}
+	if *requests != 0 {
+		t.Errorf("Expected no metadata requests when disabled, got %d", *requests)
+	}
+}
+
+func TestRetrieveWithTimeout(t *testing.T) {
+	slow := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		<-ctx.Done()
+		return aws.Credentials{}, ctx.Err()
+	})
+	_, err := retrieveWithTimeout(slow, 50*time.Millisecond).Retrieve(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+}
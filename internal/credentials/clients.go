@@ -0,0 +1,106 @@
+package credentials
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// S3Clients holds one S3 client per distinct source region and credential set, so pipelines
+// reading buckets owned by other accounts use their own credentials or roles. Pipelines that
+// share a region and credential set share a client.
+type S3Clients struct {
+	clients  map[clientKey]*s3.Client
+	rotators map[clientKey]*Rotator
+}
+
+// clientKey identifies a source's region and credential set
+type clientKey struct {
+	region string
+	aws    config.AWSConfig
+}
+
+// NewS3Clients builds the S3 clients for pipelines (see Config.ResolvePipelines). optFns are
+// applied to every client.
+func NewS3Clients(ctx context.Context, pipelines []config.ResolvedPipeline, optFns ...func(*s3.Options)) (*S3Clients, error) {
+	c := &S3Clients{
+		clients:  make(map[clientKey]*s3.Client),
+		rotators: make(map[clientKey]*Rotator),
+	}
+	for _, p := range pipelines {
+		key := keyFor(p.Config)
+		if _, ok := c.clients[key]; ok {
+			continue
+		}
+		awsCfg, rotator, err := NewRotator(ctx, key.region, key.aws)
+		if err != nil {
+			return nil, err
+		}
+		c.clients[key] = s3.NewFromConfig(awsCfg, optFns...)
+		c.rotators[key] = rotator
+	}
+	return c, nil
+}
+
+// keyFor returns the client key of a pipeline configuration
+func keyFor(cfg config.Config) clientKey {
+	return clientKey{region: cfg.S3.Region, aws: cfg.AWS}
+}
+
+// For returns the S3 client for a pipeline configuration passed to NewS3Clients, or nil
+func (c *S3Clients) For(cfg config.Config) *s3.Client {
+	return c.clients[keyFor(cfg)]
+}
+
+// Len returns the number of distinct clients
+func (c *S3Clients) Len() int {
+	return len(c.clients)
+}
+
+// Run refreshes every client's credentials (see Rotator.Run) until ctx is done
+func (c *S3Clients) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for key, rotator := range c.rotators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rotator.Run(ctx, key.aws.RefreshInterval)
+		}()
+	}
+	wg.Wait()
+}
+
+// Age returns the age of the oldest credentials in use (see Rotator.Age)
+func (c *S3Clients) Age() time.Duration {
+	var oldest time.Duration
+	for _, rotator := range c.rotators {
+		oldest = max(oldest, rotator.Age())
+	}
+	return oldest
+}
+
+// Expiry returns how long until the first session credentials in use expire (see
+// Rotator.Expiry), and false when none expire
+func (c *S3Clients) Expiry() (time.Duration, bool) {
+	var soonest time.Duration
+	var found bool
+	for _, rotator := range c.rotators {
+		if expiry, ok := rotator.Expiry(); ok && (!found || expiry < soonest) {
+			soonest, found = expiry, true
+		}
+	}
+	return soonest, found
+}
+
+// Credentials returns the provider of every credential set (see Rotator.Credentials)
+func (c *S3Clients) Credentials() []aws.CredentialsProvider {
+	providers := make([]aws.CredentialsProvider, 0, len(c.rotators))
+	for _, rotator := range c.rotators {
+		providers = append(providers, rotator.Credentials())
+	}
+	return providers
+}
@@ -0,0 +1,44 @@
+package credentials
+
+import (
+	"context"
+	"testing"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestNewS3Clients(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	cfg := config.Config{S3: config.S3Config{Bucket: "logs", Region: "us-east-1"}}
+	cfg.Pipelines = []config.PipelineConfig{
+		{Name: "a"},
+		{Name: "b", Prefix: "b/"},
+		{Name: "partner", Bucket: "partner-logs", Region: "eu-west-1"},
+		{Name: "role", AWS: &config.AWSConfig{
+			AssumeRole: config.AssumeRoleConfig{RoleARN: "arn:aws:iam::210987654321:role/logs-reader"},
+		}},
+	}
+	cfg.ApplyDefaults()
+	pipelines := cfg.ResolvePipelines()
+
+	clients, err := NewS3Clients(context.Background(), pipelines)
+	if err != nil {
+		t.Fatalf("NewS3Clients() failed: %v", err)
+	}
+	if clients.Len() != 3 {
+		t.Errorf("Expected 3 clients (shared, partner region, role), got %d", clients.Len())
+	}
+	if clients.For(pipelines[0].Config) != clients.For(pipelines[1].Config) {
+		t.Error("Expected pipelines with the same region and credentials to share a client")
+	}
+	partner := clients.For(pipelines[2].Config)
+	if partner == nil || partner.Options().Region != "eu-west-1" {
+		t.Errorf("Expected a client in the pipeline's region, got %v", partner)
+	}
+	if clients.For(pipelines[3].Config) == clients.For(pipelines[0].Config) {
+		t.Error("Expected a separate client for the pipeline's role")
+	}
+}
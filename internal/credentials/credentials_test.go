@@ -68,7 +68,7 @@ func TestDecryptCredential_EmptyValue(t *testing.T) {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
-	// Try to decrypt (will fail because openssl can't decrypt empty file, but that's ok for this test)
+	// Try to decrypt (will fail because an empty file has no format header)
 	_, err := decryptCredential(tmpDir, "empty_cred", "test_key")
 	if err == nil {
 		t.Error("Expected error for empty credential file")
@@ -0,0 +1,222 @@
+package credentials
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Encrypted credential files start with a header naming the format, so it can change
+// without breaking existing installations. Version 1 is encrypted with the machine key:
+//
+//	"S3SC" | version (1 byte) | nonce (12 bytes) | AES-256-GCM ciphertext and tag
+//
+// The header and the credential name are authenticated, so a file that was tampered with,
+// truncated or renamed to another credential fails to decrypt. Version 2 is encrypted with
+// AWS KMS (see WriteCredentialKMS).
+const (
+	fileMagic   = "S3SC"
+	fileVersion = 1
+)
+
+// Files written by earlier installers with `openssl enc -aes-256-cbc -pbkdf2`
+const (
+	legacyMagic      = "Salted__"
+	legacyIterations = 10000
+)
+
+// DefaultDir is where the installer keeps the encrypted credentials
+const DefaultDir = "/etc/systemd/creds/s3-streamer"
+
+// Dir returns the encrypted credentials directory: CREDENTIALS_DIR, or DefaultDir
+func Dir() string {
+	if dir := os.Getenv("CREDENTIALS_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultDir
+}
+
+// WriteCredential encrypts value with this machine's key and writes it to dir/name
+func WriteCredential(dir, name, value string) error {
+	if value == "" {
+		return errors.New("credential value is empty")
+	}
+	key, err := machineKey()
+	if err != nil {
+		return err
+	}
+	data, err := encrypt(name, value, key)
+	if err != nil {
+		return err
+	}
+	return writeCredentialFile(dir, name, data)
+}
+
+// writeCredentialFile writes an encrypted credential to dir/name
+func writeCredentialFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+
+	// Write atomically so a failed write never leaves a truncated credential behind
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write credential %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write credential %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write credential %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("failed to write credential %s: %w", name, err)
+	}
+	return nil
+}
+
+// ReadCredential decrypts dir/name with this machine's key or AWS KMS
+func ReadCredential(dir, name string) (string, error) {
+	key, _ := machineKey() // Not needed for KMS-encrypted files
+	return decryptCredential(dir, name, key)
+}
+
+// encrypt seals value in the current file format
+func encrypt(name, value, key string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(fileMagic), fileVersion)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data := append(header, nonce...)
+	return aead.Seal(data, nonce, []byte(value), additionalData(header, name)), nil
+}
+
+// decrypt opens a credential file in any of the versioned formats or the legacy OpenSSL format
+func decrypt(name string, data []byte, key string) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte(fileMagic)):
+		if len(data) <= len(fileMagic) {
+			return "", errors.New("truncated credential file")
+		}
+		switch version := data[len(fileMagic)]; version {
+		case fileVersion:
+			return decryptAEAD(name, data, key)
+		case fileVersionKMS:
+			return decryptKMS(name, data)
+		default:
+			return "", fmt.Errorf("unsupported credential file version %d", version)
+		}
+	case bytes.HasPrefix(data, []byte(legacyMagic)):
+		return decryptLegacy(data, key)
+	default:
+		return "", errors.New("not an encrypted credential file")
+	}
+}
+
+// decryptAEAD opens a file in the current format
+func decryptAEAD(name string, data []byte, key string) (string, error) {
+	header := data[:len(fileMagic)+1]
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	rest := data[len(header):]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return "", errors.New("truncated credential file")
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(header, name))
+	if err != nil {
+		return "", errors.New("authentication failed (wrong machine, or the file was modified)")
+	}
+	return string(plaintext), nil
+}
+
+// errNoMachineKey is returned for machine-key formats on hosts without /etc/machine-id
+var errNoMachineKey = errors.New("no machine key (/etc/machine-id is unreadable); use KMS-encrypted credentials on this host")
+
+// newAEAD returns AES-256-GCM keyed with the SHA-256 of the machine key
+func newAEAD(key string) (cipher.AEAD, error) {
+	if key == "" {
+		return nil, errNoMachineKey
+	}
+	aesKey := sha256.Sum256([]byte(fileMagic + key))
+	block, err := aes.NewCipher(aesKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds the header and the credential name to the ciphertext
+func additionalData(header []byte, name string) []byte {
+	return append(append([]byte{}, header...), name...)
+}
+
+// decryptLegacy opens a file written by `openssl enc -aes-256-cbc -salt -pbkdf2 -pass pass:key`:
+// "Salted__", an 8-byte salt, then AES-256-CBC with PKCS#7 padding, the key and IV derived
+// with PBKDF2-HMAC-SHA256. The format is unauthenticated; rewrite such files with
+// WriteCredential.
+func decryptLegacy(data []byte, key string) (string, error) {
+	const saltLen = 8
+	if key == "" {
+		return "", errNoMachineKey
+	}
+	if len(data) < len(legacyMagic)+saltLen+aes.BlockSize || (len(data)-len(legacyMagic)-saltLen)%aes.BlockSize != 0 {
+		return "", errors.New("truncated credential file")
+	}
+	salt := data[len(legacyMagic) : len(legacyMagic)+saltLen]
+	ciphertext := data[len(legacyMagic)+saltLen:]
+
+	derived := pbkdf2SHA256([]byte(key), salt, legacyIterations, 32+aes.BlockSize)
+	block, err := aes.NewCipher(derived[:32])
+	if err != nil {
+		return "", err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, derived[32:]).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return "", errors.New("bad decrypt (wrong machine key)")
+	}
+	return string(plaintext[:len(plaintext)-padding]), nil
+}
+
+// pbkdf2SHA256 derives keyLen bytes from password and salt (RFC 8018)
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var derived []byte
+	for block := uint32(1); len(derived) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		derived = append(derived, t...)
+	}
+	return derived[:keyLen]
+}
@@ -0,0 +1,52 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	data, err := encrypt("aws_access_key_id", "AKIDEXAMPLE", "machine-key")
+	if err != nil {
+		t.Fatalf("encrypt() failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), fileMagic+"\x01") {
+		t.Errorf("Expected a versioned header, got %q", data[:5])
+	}
+
+	value, err := decrypt("aws_access_key_id", data, "machine-key")
+	if err != nil || value != "AKIDEXAMPLE" {
+		t.Errorf("Expected AKIDEXAMPLE, got %q, %v", value, err)
+	}
+
+	if _, err := decrypt("aws_access_key_id", data, "other-machine"); err == nil {
+		t.Error("Expected the wrong key to fail")
+	}
+	if _, err := decrypt("aws_secret_access_key", data, "machine-key"); err == nil {
+		t.Error("Expected a file renamed to another credential to fail")
+	}
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := decrypt("aws_access_key_id", tampered, "machine-key"); err == nil {
+		t.Error("Expected a modified file to fail")
+	}
+	future := append([]byte{}, data...)
+	future[len(fileMagic)] = 9
+	if _, err := decrypt("aws_access_key_id", future, "machine-key"); err == nil || !strings.Contains(err.Error(), "version 9") {
+		t.Errorf("Expected an unsupported version error, got %v", err)
+	}
+}
+
+func TestDecrypt_Legacy(t *testing.T) {
+	// printf AKIDEXAMPLE | openssl enc -aes-256-cbc -salt -pbkdf2 -pass pass:test_key
+	data, _ := base64.StdEncoding.DecodeString("U2FsdGVkX1+JD9SrwXEy5ln4a0P/BGwVm84ovn2Y5Yo=")
+
+	value, err := decrypt("aws_access_key_id", data, "test_key")
+	if err != nil || value != "AKIDEXAMPLE" {
+		t.Errorf("Expected AKIDEXAMPLE, got %q, %v", value, err)
+	}
+	if _, err := decrypt("aws_access_key_id", data, "wrong_key"); err == nil {
+		t.Error("Expected the wrong key to fail")
+	}
+}
@@ -0,0 +1,103 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/awsjson"
+)
+
+// KMS-encrypted credential files do not depend on the machine: any host whose credentials
+// (typically the instance role) may call kms:Decrypt on the key can read them. After the
+// version byte they hold:
+//
+//	region length (1 byte) | region | KMS ciphertext blob
+//
+// The credential name is the KMS encryption context, so a file renamed to another credential
+// fails to decrypt.
+const (
+	fileVersionKMS = 2
+	kmsTimeout     = 10 * time.Second
+)
+
+// WriteCredentialKMS encrypts value with the KMS key keyID (ID, ARN or alias) in region and
+// writes it to dir/name
+func WriteCredentialKMS(ctx context.Context, dir, name, value, keyID, region string) error {
+	if value == "" {
+		return errors.New("credential value is empty")
+	}
+	awsCfg, err := kmsConfig(ctx, region)
+	if err != nil {
+		return err
+	}
+	var out struct {
+		CiphertextBlob []byte
+	}
+	in := map[string]any{
+		"KeyId":             keyID,
+		"Plaintext":         []byte(value),
+		"EncryptionContext": kmsContext(name),
+	}
+	if err := awsjson.Call(ctx, awsCfg, os.Getenv("AWS_ENDPOINT_URL_KMS"), "kms", "TrentService.Encrypt", in, &out); err != nil {
+		return err
+	}
+
+	data := append([]byte(fileMagic), fileVersionKMS, byte(len(awsCfg.Region)))
+	data = append(append(data, awsCfg.Region...), out.CiphertextBlob...)
+	return writeCredentialFile(dir, name, data)
+}
+
+// decryptKMS opens a KMS-encrypted credential file
+func decryptKMS(name string, data []byte) (string, error) {
+	rest := data[len(fileMagic)+1:]
+	if len(rest) == 0 || len(rest) <= 1+int(rest[0]) {
+		return "", errors.New("truncated credential file")
+	}
+	region, blob := string(rest[1:1+int(rest[0])]), rest[1+int(rest[0]):]
+
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+	awsCfg, err := kmsConfig(ctx, region)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Plaintext []byte
+	}
+	in := map[string]any{
+		"CiphertextBlob":    blob,
+		"EncryptionContext": kmsContext(name),
+	}
+	if err := awsjson.Call(ctx, awsCfg, os.Getenv("AWS_ENDPOINT_URL_KMS"), "kms", "TrentService.Decrypt", in, &out); err != nil {
+		return "", err
+	}
+	return string(out.Plaintext), nil
+}
+
+// kmsConfig returns the SDK credential chain's configuration for calling KMS in region
+// (default: AWS_REGION). The installer's encrypted credentials are not used, since they may
+// be the files being decrypted.
+func kmsConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if awsCfg.Region == "" {
+		return aws.Config{}, errors.New("no AWS region for KMS: set AWS_REGION or pass the key's region")
+	}
+	return awsCfg, nil
+}
+
+// kmsContext is the encryption context binding a ciphertext to its credential name
+func kmsContext(name string) map[string]string {
+	return map[string]string{"credential": name}
+}
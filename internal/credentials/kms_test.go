@@ -0,0 +1,82 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newKMSServer fakes KMS Encrypt and Decrypt; a ciphertext only decrypts with the encryption
+// context it was encrypted with
+func newKMSServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			KeyId             string
+			Plaintext         []byte
+			CiphertextBlob    []byte
+			EncryptionContext map[string]string
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+			t.Errorf("Expected a SigV4 signed request")
+		}
+		credential := in.EncryptionContext["credential"]
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			json.NewEncoder(w).Encode(map[string]any{"CiphertextBlob": []byte(in.KeyId + "|" + credential + "|" + string(in.Plaintext))})
+		case "TrentService.Decrypt":
+			parts := strings.SplitN(string(in.CiphertextBlob), "|", 3)
+			if len(parts) != 3 || parts[1] != credential {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"InvalidCiphertextException","message":""}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"KeyId": parts[0], "Plaintext": []byte(parts[2])})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWriteCredentialKMS(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL_KMS", newKMSServer(t).URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAROLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "role-secret")
+	dir := t.TempDir()
+
+	ctx := context.Background()
+	if err := WriteCredentialKMS(ctx, dir, "aws_secret_access_key", "rotated-secret", "alias/s3-streamer", "eu-west-1"); err != nil {
+		t.Fatalf("WriteCredentialKMS() failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "aws_secret_access_key"))
+	if !strings.HasPrefix(string(data), fileMagic+"\x02\x09eu-west-1") {
+		t.Errorf("Expected a KMS header with the key's region, got %q", data)
+	}
+
+	// No machine key is needed
+	value, err := decryptCredential(dir, "aws_secret_access_key", "")
+	if err != nil || value != "rotated-secret" {
+		t.Errorf("Expected rotated-secret, got %q, %v", value, err)
+	}
+
+	os.Rename(filepath.Join(dir, "aws_secret_access_key"), filepath.Join(dir, "aws_access_key_id"))
+	if _, err := decryptCredential(dir, "aws_access_key_id", ""); err == nil || !strings.Contains(err.Error(), "InvalidCiphertextException") {
+		t.Errorf("Expected a renamed file to fail, got %v", err)
+	}
+}
+
+func TestDecrypt_NoMachineKey(t *testing.T) {
+	data, err := encrypt("aws_region", "us-east-1", "machine-key")
+	if err != nil {
+		t.Fatalf("encrypt() failed: %v", err)
+	}
+	if _, err := decrypt("aws_region", data, ""); err != errNoMachineKey {
+		t.Errorf("Expected errNoMachineKey, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// Rotator re-reads the credential source (the encrypted credentials, the SDK chain and the
+// assumed role) so rotated keys are picked up without a restart. Clients built from the
+// configuration returned by NewRotator share its credentials cache, which Reload swaps and
+// invalidates: their next request signs with the new credentials, so they need not be rebuilt.
+type Rotator struct {
+	load  func(ctx context.Context) (aws.Config, error)
+	cache *aws.CredentialsCache
+
+	mu       sync.Mutex
+	source   aws.CredentialsProvider
+	keyID    string    // Access key ID of the credentials in use
+	loadedAt time.Time // When the credentials in use were loaded or renewed
+	expires  time.Time // When the credentials in use expire (zero for long-term credentials)
+}
+
+// NewRotator loads the AWS configuration as AWSConfig does, with credentials that Reload and
+// Run refresh
+func NewRotator(ctx context.Context, region string, awsCfg config.AWSConfig) (aws.Config, *Rotator, error) {
+	r := newRotator(func(ctx context.Context) (aws.Config, error) {
+		return AWSConfig(ctx, region, awsCfg)
+	})
+	cfg, err := r.load(ctx)
+	if err != nil {
+		return aws.Config{}, nil, err
+	}
+	r.source = cfg.Credentials
+	cfg.Credentials = r.cache
+	return cfg, r, nil
+}
+
+// newRotator returns a rotator whose credentials come from load
+func newRotator(load func(ctx context.Context) (aws.Config, error)) *Rotator {
+	r := &Rotator{load: load}
+	r.cache = aws.NewCredentialsCache(aws.CredentialsProviderFunc(r.retrieve))
+	return r
+}
+
+// retrieve fetches credentials from the current source when the cache misses
+func (r *Rotator) retrieve(ctx context.Context) (aws.Credentials, error) {
+	r.mu.Lock()
+	source := r.source
+	r.mu.Unlock()
+	if source == nil {
+		return aws.Credentials{}, fmt.Errorf("no AWS credentials loaded")
+	}
+
+	creds, err := source.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keyID == "" {
+		logging.Component("credentials").Info("AWS credentials loaded", "source", creds.Source)
+	}
+	r.keyID = creds.AccessKeyID
+	r.loadedAt = time.Now()
+	r.expires = expiryOf(creds)
+	return creds, nil
+}
+
+// Reload re-reads the credential source and switches to it. The new credentials are retrieved
+// first, so a source that fails (e.g. a credential file being rewritten) keeps the current ones.
+func (r *Rotator) Reload(ctx context.Context) error {
+	cfg, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve reloaded AWS credentials: %w", err)
+	}
+
+	r.mu.Lock()
+	rotated := creds.AccessKeyID != r.keyID
+	r.source = cfg.Credentials
+	r.keyID = creds.AccessKeyID
+	r.loadedAt = time.Now()
+	r.expires = expiryOf(creds)
+	r.mu.Unlock()
+	r.cache.Invalidate()
+
+	if rotated {
+		logging.Component("credentials").Info("AWS credentials rotated", "source", creds.Source)
+	}
+	return nil
+}
+
+// Age returns how long ago the credentials in use were loaded or renewed, or 0 before the
+// first load
+func (r *Rotator) Age() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loadedAt.IsZero() {
+		return 0
+	}
+	return time.Since(r.loadedAt)
+}
+
+// Expiry returns how long until the credentials in use expire (negative once they have), and
+// false for credentials that do not expire or before the first load
+func (r *Rotator) Expiry() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.expires.IsZero() {
+		return 0, false
+	}
+	return time.Until(r.expires), true
+}
+
+// Credentials returns the provider the rotator's clients sign with
+func (r *Rotator) Credentials() aws.CredentialsProvider {
+	return r.cache
+}
+
+// expiryOf returns when creds expire, or the zero time if they do not
+func expiryOf(creds aws.Credentials) time.Time {
+	if !creds.CanExpire {
+		return time.Time{}
+	}
+	return creds.Expires
+}
+
+// Run reloads the credentials every interval (never if interval is not positive) and on every
+// SIGHUP until ctx is done. Failed reloads are logged and keep the current credentials.
+func (r *Rotator) Run(ctx context.Context, interval time.Duration) {
+	logger := logging.Component("credentials")
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	signals, stop := reloadSignals()
+	defer stop()
+
+	reload := func() {
+		if err := r.Reload(ctx); err != nil {
+			logger.Warn("Failed to reload AWS credentials; keeping the current ones", "error", err)
+		}
+	}
+
+	for {
+		select {
+		case <-tick:
+			reload()
+		case <-signals:
+			logger.Info("Reloading AWS credentials (SIGHUP)")
+			reload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
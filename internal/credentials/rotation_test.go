@@ -0,0 +1,93 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscreds "github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestRotator_Reload(t *testing.T) {
+	ctx := context.Background()
+	keyID, loadErr := "AKID1", error(nil)
+	r := newRotator(func(ctx context.Context) (aws.Config, error) {
+		if loadErr != nil {
+			return aws.Config{}, loadErr
+		}
+		return aws.Config{Credentials: awscreds.NewStaticCredentialsProvider(keyID, "secret", "")}, nil
+	})
+	if err := r.Reload(ctx); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+
+	retrieve := func() string {
+		t.Helper()
+		creds, err := r.cache.Retrieve(ctx)
+		if err != nil {
+			t.Fatalf("Retrieve() failed: %v", err)
+		}
+		return creds.AccessKeyID
+	}
+	if got := retrieve(); got != "AKID1" {
+		t.Errorf("Expected AKID1, got %s", got)
+	}
+
+	keyID = "AKID2"
+	if got := retrieve(); got != "AKID1" {
+		t.Errorf("Expected cached credentials before a reload, got %s", got)
+	}
+	if err := r.Reload(ctx); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if got := retrieve(); got != "AKID2" {
+		t.Errorf("Expected rotated credentials after a reload, got %s", got)
+	}
+
+	loadErr = errors.New("credential file not found")
+	if err := r.Reload(ctx); err == nil {
+		t.Error("Expected a failing source to fail the reload")
+	}
+	if got := retrieve(); got != "AKID2" {
+		t.Errorf("Expected a failed reload to keep the current credentials, got %s", got)
+	}
+	if age := r.Age(); age <= 0 {
+		t.Errorf("Expected a credential age, got %v", age)
+	}
+}
+
+func TestRotator_Age(t *testing.T) {
+	r := newRotator(nil)
+	if age := r.Age(); age != 0 {
+		t.Errorf("Expected no age before the first load, got %v", age)
+	}
+}
+
+func TestRotator_Expiry(t *testing.T) {
+	ctx := context.Background()
+	creds := aws.Credentials{AccessKeyID: "AKID1", SecretAccessKey: "secret"}
+	r := newRotator(func(ctx context.Context) (aws.Config, error) {
+		return aws.Config{Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return creds, nil
+		})}, nil
+	})
+	if _, ok := r.Expiry(); ok {
+		t.Error("Expected no expiry before the first load")
+	}
+	if err := r.Reload(ctx); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if _, ok := r.Expiry(); ok {
+		t.Error("Expected no expiry for long-term credentials")
+	}
+
+	creds.CanExpire, creds.Expires = true, time.Now().Add(time.Hour)
+	if err := r.Reload(ctx); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if expiry, ok := r.Expiry(); !ok || expiry <= 59*time.Minute || expiry > time.Hour {
+		t.Errorf("Expected the session to expire in about 1h, got %v, %v", expiry, ok)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package credentials
+
+import "os"
+
+// reloadSignals delivers nothing where SIGHUP is unavailable; Run then only polls
+func reloadSignals() (signals <-chan os.Signal, stop func()) {
+	return nil, func() {}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -48,6 +49,54 @@ func (c *S3HealthChecker) Name() string {
 	return "s3"
 }
 
+// CredentialsHealthChecker checks that the AWS credentials in use can be retrieved and have
+// not expired. It is degraded while session credentials expire within the warning window, so
+// a role session that stops renewing surfaces before S3 requests start failing.
+type CredentialsHealthChecker struct {
+	providers []aws.CredentialsProvider
+	warning   time.Duration
+}
+
+// NewCredentialsHealthChecker creates a checker for the providers (e.g.
+// credentials.S3Clients.Credentials). warning is the time left that reports degraded (0 = off).
+func NewCredentialsHealthChecker(warning time.Duration, providers ...aws.CredentialsProvider) *CredentialsHealthChecker {
+	return &CredentialsHealthChecker{
+		providers: providers,
+		warning:   warning,
+	}
+}
+
+// Check retrieves every provider's credentials. It returns an ErrDegraded error when the only
+// problem is credentials close to expiry.
+func (c *CredentialsHealthChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var degraded error
+	for _, provider := range c.providers {
+		creds, err := provider.Retrieve(ctx)
+		if err != nil {
+			return fmt.Errorf("AWS credentials unavailable: %w", err)
+		}
+		if !creds.CanExpire {
+			continue
+		}
+		left := time.Until(creds.Expires).Truncate(time.Second)
+		switch {
+		case left <= 0:
+			return fmt.Errorf("AWS credentials expired at %s", creds.Expires.UTC().Format(time.RFC3339))
+		case c.warning > 0 && left < c.warning && degraded == nil:
+			degraded = fmt.Errorf("%w: AWS credentials expire in %v", ErrDegraded, left)
+		}
+	}
+	return degraded
+}
+
+// Name returns the checker name
+func (c *CredentialsHealthChecker) Name() string {
+	return "aws_credentials"
+}
+
 // HTTPHealthChecker checks HTTP endpoint connectivity
 type HTTPHealthChecker struct {
 	endpoint string
@@ -89,6 +138,63 @@ func (c *HTTPHealthChecker) Name() string {
 	return "http"
 }
 
+// HTTPEndpointsHealthChecker checks every configured HTTP endpoint. It is degraded while
+// some endpoints fail and unhealthy once all of them do, and reports each endpoint's result.
+type HTTPEndpointsHealthChecker struct {
+	checkers []*HTTPHealthChecker
+}
+
+// NewHTTPEndpointsHealthChecker creates a checker for the endpoints
+func NewHTTPEndpointsHealthChecker(endpoints []string) *HTTPEndpointsHealthChecker {
+	c := &HTTPEndpointsHealthChecker{}
+	for _, endpoint := range endpoints {
+		c.checkers = append(c.checkers, NewHTTPHealthChecker(endpoint))
+	}
+	return c
+}
+
+// Check checks the endpoints
+func (c *HTTPEndpointsHealthChecker) Check(ctx context.Context) error {
+	_, err := c.CheckParts(ctx)
+	return err
+}
+
+// CheckParts checks the endpoints concurrently and returns each one's result by URL
+func (c *HTTPEndpointsHealthChecker) CheckParts(ctx context.Context) (map[string]error, error) {
+	errs := make([]error, len(c.checkers))
+	var wg sync.WaitGroup
+	for i, checker := range c.checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = checker.Check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	parts := make(map[string]error, len(c.checkers))
+	failing := 0
+	for i, checker := range c.checkers {
+		parts[checker.endpoint] = errs[i]
+		if errs[i] != nil {
+			failing++
+		}
+	}
+	switch {
+	case failing == 0:
+		return parts, nil
+	case failing == len(c.checkers):
+		return parts, fmt.Errorf("all %d endpoints failing", failing)
+	default:
+		return parts, fmt.Errorf("%w: %d of %d endpoints failing", ErrDegraded, failing, len(c.checkers))
+	}
+}
+
+// Name returns the checker name
+func (c *HTTPEndpointsHealthChecker) Name() string {
+	return "http"
+}
+
 // RedisHealthChecker checks Redis connectivity
 type RedisHealthChecker struct {
 	client *redis.Client
@@ -2,12 +2,23 @@ package health
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
+// failingChecker always fails
+type failingChecker struct{}
+
+func (c *failingChecker) Check(ctx context.Context) error { return errors.New("down") }
+func (c *failingChecker) Name() string                    { return "failing" }
+
 func TestBasicHealthChecker(t *testing.T) {
 	checker := NewBasicHealthChecker()
 
@@ -110,13 +121,106 @@ func TestHealthServer_ReadyHandler(t *testing.T) {
 		}
 	}()
 
-	// Create a test request
-	req := httptest.NewRequest("GET", "/ready", nil)
+	ready := func() int {
+		w := httptest.NewRecorder()
+		server.readyHandler(w, httptest.NewRequest("GET", "/ready", nil))
+		return w.Code
+	}
+
+	// Not ready until initialized
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while starting, got %d", code)
+	}
+
+	server.SetReady(true, "")
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+
+	// A failing dependency check does not affect readiness, a failing readiness check does
+	server.AddChecker(&failingChecker{})
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected status 200 with a failing dependency, got %d", code)
+	}
+	server.AddReadinessChecker(&failingChecker{})
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 with a failing readiness check, got %d", code)
+	}
+
+	server.SetReady(false, "Shutting down")
 	w := httptest.NewRecorder()
+	server.readyHandler(w, httptest.NewRequest("GET", "/ready", nil))
+	var status HealthStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	if w.Code != http.StatusServiceUnavailable || status.Message != "Shutting down" {
+		t.Errorf("Expected 503 shutting down, got %d %+v", w.Code, status)
+	}
+}
 
-	server.readyHandler(w, req)
+func TestHealthServer_LiveHandler(t *testing.T) {
+	server := NewHealthServer(":0", "/health", &failingChecker{})
 
+	w := httptest.NewRecorder()
+	server.liveHandler(w, httptest.NewRequest("GET", "/live", nil))
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Errorf("Expected status 200 despite failing checks, got %d", w.Code)
+	}
+}
+
+func TestHTTPEndpointsHealthChecker(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	// One endpoint down degrades the service and is named in the details
+	status := runChecks(context.Background(), []HealthChecker{NewHTTPEndpointsHealthChecker([]string{up.URL, down.URL})})
+	if status.Status != "degraded" {
+		t.Errorf("Expected degraded, got %s (%v)", status.Status, status.Checks)
+	}
+	details := status.Details["http"]
+	if details[up.URL] != "OK" || details[down.URL] != "ERROR: HTTP status 502" {
+		t.Errorf("Unexpected endpoint details: %v", details)
+	}
+
+	// All endpoints down is unhealthy
+	status = runChecks(context.Background(), []HealthChecker{NewHTTPEndpointsHealthChecker([]string{down.URL})})
+	if status.Status != "unhealthy" {
+		t.Errorf("Expected unhealthy, got %s (%v)", status.Status, status.Checks)
+	}
+}
+
+func TestCredentialsHealthChecker(t *testing.T) {
+	ctx := context.Background()
+	session := func(left time.Duration) aws.CredentialsProvider {
+		return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "ASIA", CanExpire: true, Expires: time.Now().Add(left)}, nil
+		})
+	}
+	static := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID"}, nil
+	})
+
+	if err := NewCredentialsHealthChecker(15*time.Minute, static, session(time.Hour)).Check(ctx); err != nil {
+		t.Errorf("Expected healthy credentials, got %v", err)
+	}
+	if err := NewCredentialsHealthChecker(15*time.Minute, static, session(5*time.Minute)).Check(ctx); !errors.Is(err, ErrDegraded) {
+		t.Errorf("Expected degraded close to expiry, got %v", err)
+	}
+	if err := NewCredentialsHealthChecker(0, session(5*time.Minute)).Check(ctx); err != nil {
+		t.Errorf("Expected no warning when disabled, got %v", err)
+	}
+	err := NewCredentialsHealthChecker(15*time.Minute, session(5*time.Minute), session(-time.Minute)).Check(ctx)
+	if err == nil || errors.Is(err, ErrDegraded) || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Expected expired credentials to be unhealthy, got %v", err)
+	}
+
+	failing := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{}, errors.New("ExpiredToken")
+	})
+	if err := NewCredentialsHealthChecker(0, failing).Check(ctx); err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Errorf("Expected unavailable credentials to be unhealthy, got %v", err)
 	}
 }
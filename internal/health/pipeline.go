@@ -0,0 +1,161 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// ErrDegraded marks a check failure that degrades the service without making it unhealthy:
+// /health reports "degraded" and still answers 200. Wrap it as "%w: <details>".
+var ErrDegraded = errors.New("DEGRADED")
+
+// minErrorRateFiles is how many files the error rate window needs before the rate counts
+const minErrorRateFiles = 10
+
+// bufferFullFill is the HTTP buffer (or file queue) fill counted as full
+const bufferFullFill = 0.95
+
+// PipelineStats are read from the pipeline on every sample
+type PipelineStats struct {
+	Lag        func() time.Duration         // Age of the newest processed file (0 if unknown)
+	Counters   func() (files, errors int64) // Files processed and failed since start
+	BufferFill func() float64               // HTTP buffer fill (0-1)
+}
+
+// PipelineHealthChecker reports the pipeline degraded or unhealthy when processing lag,
+// the file error rate or a full HTTP buffer cross the health thresholds
+type PipelineHealthChecker struct {
+	cfg      config.HealthConfig
+	stats    PipelineStats
+	interval time.Duration
+
+	mu        sync.Mutex
+	samples   []counterSample // Within the error rate window, oldest first
+	fullSince time.Time       // When the buffer became full (zero if not full)
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// counterSample is one reading of the file counters
+type counterSample struct {
+	at            time.Time
+	files, errors int64
+}
+
+// NewPipelineHealthChecker creates a checker for the thresholds in cfg (max_lag,
+// unhealthy_lag, max_error_rate, error_rate_window, buffer_full_for). Nil stats are skipped.
+func NewPipelineHealthChecker(cfg config.HealthConfig, stats PipelineStats) *PipelineHealthChecker {
+	return &PipelineHealthChecker{
+		cfg:      cfg,
+		stats:    stats,
+		interval: 10 * time.Second,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start samples the pipeline in the background so the error rate and buffer state are
+// tracked between health checks
+func (c *PipelineHealthChecker) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.sample(time.Now())
+			case <-c.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops background sampling
+func (c *PipelineHealthChecker) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+// sample records the counters and buffer state
+func (c *PipelineHealthChecker) sample(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats.Counters != nil {
+		files, errs := c.stats.Counters()
+		c.samples = append(c.samples, counterSample{at: now, files: files, errors: errs})
+		// Keep one sample at or before the window start to measure the whole window
+		for len(c.samples) > 2 && !c.samples[1].at.After(now.Add(-c.cfg.ErrorRateWindow)) {
+			c.samples = c.samples[1:]
+		}
+	}
+	if c.stats.BufferFill != nil {
+		if c.stats.BufferFill() < bufferFullFill {
+			c.fullSince = time.Time{}
+		} else if c.fullSince.IsZero() {
+			c.fullSince = now
+		}
+	}
+}
+
+// Check samples the pipeline and compares it against the thresholds. It returns an
+// ErrDegraded error when only degraded thresholds are crossed.
+func (c *PipelineHealthChecker) Check(ctx context.Context) error {
+	return c.check(time.Now())
+}
+
+func (c *PipelineHealthChecker) check(now time.Time) error {
+	c.sample(now)
+
+	var unhealthy, degraded []string
+	if c.stats.Lag != nil {
+		lag := c.stats.Lag()
+		switch {
+		case c.cfg.UnhealthyLag > 0 && lag >= c.cfg.UnhealthyLag:
+			unhealthy = append(unhealthy, fmt.Sprintf("processing lag %s exceeds %s", lag.Round(time.Second), c.cfg.UnhealthyLag))
+		case c.cfg.MaxLag > 0 && lag >= c.cfg.MaxLag:
+			degraded = append(degraded, fmt.Sprintf("processing lag %s exceeds %s", lag.Round(time.Second), c.cfg.MaxLag))
+		}
+	}
+
+	c.mu.Lock()
+	if c.cfg.MaxErrorRate > 0 && len(c.samples) > 1 {
+		first, last := c.samples[0], c.samples[len(c.samples)-1]
+		failed := last.errors - first.errors
+		total := last.files - first.files + failed
+		if total >= minErrorRateFiles {
+			if rate := float64(failed) / float64(total); rate > c.cfg.MaxErrorRate {
+				degraded = append(degraded, fmt.Sprintf("%d of %d files failed in the last %s (%.0f%%)",
+					failed, total, last.at.Sub(first.at).Round(time.Second), rate*100))
+			}
+		}
+	}
+	if c.cfg.BufferFullFor > 0 && !c.fullSince.IsZero() {
+		if full := now.Sub(c.fullSince); full >= c.cfg.BufferFullFor {
+			unhealthy = append(unhealthy, fmt.Sprintf("HTTP buffer full for %s", full.Round(time.Second)))
+		}
+	}
+	c.mu.Unlock()
+
+	if len(unhealthy) > 0 {
+		return errors.New(strings.Join(append(unhealthy, degraded...), "; "))
+	}
+	if len(degraded) > 0 {
+		return fmt.Errorf("%w: %s", ErrDegraded, strings.Join(degraded, "; "))
+	}
+	return nil
+}
+
+// Name returns the checker name
+func (c *PipelineHealthChecker) Name() string {
+	return "pipeline"
+}
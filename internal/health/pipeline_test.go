@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestPipelineHealthChecker_Lag(t *testing.T) {
+	lag := time.Minute
+	checker := NewPipelineHealthChecker(config.HealthConfig{MaxLag: 10 * time.Minute, UnhealthyLag: time.Hour},
+		PipelineStats{Lag: func() time.Duration { return lag }})
+
+	if err := checker.Check(context.Background()); err != nil {
+		t.Errorf("Expected healthy at 1m lag, got %v", err)
+	}
+	lag = 20 * time.Minute
+	if err := checker.Check(context.Background()); !errors.Is(err, ErrDegraded) {
+		t.Errorf("Expected degraded at 20m lag, got %v", err)
+	}
+	lag = 2 * time.Hour
+	if err := checker.Check(context.Background()); err == nil || errors.Is(err, ErrDegraded) {
+		t.Errorf("Expected unhealthy at 2h lag, got %v", err)
+	}
+}
+
+func TestPipelineHealthChecker_ErrorRate(t *testing.T) {
+	var files, failed int64
+	checker := NewPipelineHealthChecker(config.HealthConfig{MaxErrorRate: 0.2, ErrorRateWindow: 5 * time.Minute},
+		PipelineStats{Counters: func() (int64, int64) { return files, failed }})
+
+	start := time.Now()
+	checker.sample(start)
+	files, failed = 90, 10
+	if err := checker.check(start.Add(time.Minute)); err != nil {
+		t.Errorf("Expected healthy at 10%% errors, got %v", err)
+	}
+	files, failed = 100, 40
+	err := checker.check(start.Add(2 * time.Minute))
+	if !errors.Is(err, ErrDegraded) || !strings.Contains(err.Error(), "40 of 140 files failed") {
+		t.Errorf("Expected degraded at 28%% errors, got %v", err)
+	}
+
+	// Once the failures leave the window the rate recovers
+	files = 1000
+	checker.sample(start.Add(8 * time.Minute))
+	if err := checker.check(start.Add(10 * time.Minute)); err != nil {
+		t.Errorf("Expected healthy after the failures left the window, got %v", err)
+	}
+}
+
+func TestPipelineHealthChecker_BufferFull(t *testing.T) {
+	fill := 1.0
+	checker := NewPipelineHealthChecker(config.HealthConfig{BufferFullFor: 5 * time.Minute},
+		PipelineStats{BufferFill: func() float64 { return fill }})
+
+	start := time.Now()
+	if err := checker.check(start); err != nil {
+		t.Errorf("Expected healthy when the buffer just filled, got %v", err)
+	}
+	if err := checker.check(start.Add(6 * time.Minute)); err == nil || errors.Is(err, ErrDegraded) {
+		t.Errorf("Expected unhealthy after 6m full, got %v", err)
+	}
+	fill = 0.5
+	if err := checker.check(start.Add(7 * time.Minute)); err != nil {
+		t.Errorf("Expected healthy once the buffer drained, got %v", err)
+	}
+}
+
+func TestHealthServer_Degraded(t *testing.T) {
+	checker := NewPipelineHealthChecker(config.HealthConfig{MaxLag: time.Minute},
+		PipelineStats{Lag: func() time.Duration { return time.Hour }})
+	server := NewHealthServer(":0", "/health", NewBasicHealthChecker(), checker)
+
+	w := httptest.NewRecorder()
+	server.healthHandler(w, httptest.NewRequest("GET", "/health", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 when degraded, got %d", w.Code)
+	}
+	var status HealthStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	if status.Status != "degraded" || !strings.HasPrefix(status.Checks["pipeline"], "DEGRADED: processing lag") {
+		t.Errorf("Expected degraded pipeline status, got %+v", status)
+	}
+}
@@ -0,0 +1,159 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// preflightTimeout bounds each pre-flight check
+const preflightTimeout = 10 * time.Second
+
+// PreflightResult is the outcome of one pre-flight check
+type PreflightResult struct {
+	Check  string // e.g. "s3.head_bucket"
+	Target string // Bucket, endpoint, address or format name
+	Detail string // What was found, when the check passed
+	Err    error
+}
+
+// Preflight checks, before the streamer starts, that everything the configuration points at
+// is usable: S3 access (HeadBucket and a one-key listing per bucket and prefix), endpoint
+// reachability, Redis connectivity and the custom formats' patterns. Every check runs, so a
+// single report lists all problems. cfg must have its defaults applied and be valid. clientFor
+// returns the S3 client of a pipeline's configuration (e.g. credentials.S3Clients.For), so
+// each bucket is checked with the credentials that will read it.
+func Preflight(ctx context.Context, cfg *config.Config, clientFor func(config.Config) *s3.Client) []PreflightResult {
+	var results []PreflightResult
+	run := func(check, target string, fn func(ctx context.Context) (string, error)) {
+		ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		defer cancel()
+		detail, err := fn(ctx)
+		results = append(results, PreflightResult{Check: check, Target: target, Detail: detail, Err: err})
+	}
+
+	buckets := make(map[string]*s3.Client)
+	sources := make(map[string]*s3.Client)
+	endpoints := make(map[string]bool)
+	var bucketOrder, sourceOrder, endpointOrder []string
+	for _, p := range cfg.ResolvePipelines() {
+		client := clientFor(p.Config)
+		bucket := strings.TrimPrefix(p.Config.S3.Bucket, "s3://")
+		if buckets[bucket] == nil {
+			buckets[bucket] = client
+			bucketOrder = append(bucketOrder, bucket)
+		}
+		if source := bucket + "/" + p.Config.S3.Prefix; sources[source] == nil {
+			sources[source] = client
+			sourceOrder = append(sourceOrder, source)
+		}
+		for _, endpoint := range p.Config.HTTP.Endpoints {
+			if !endpoints[endpoint] {
+				endpoints[endpoint] = true
+				endpointOrder = append(endpointOrder, endpoint)
+			}
+		}
+	}
+
+	for _, bucket := range bucketOrder {
+		client := buckets[bucket]
+		run("s3.head_bucket", bucket, func(ctx context.Context) (string, error) {
+			_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+			return "accessible", err
+		})
+	}
+	for _, source := range sourceOrder {
+		client := sources[source]
+		bucket, prefix, _ := strings.Cut(source, "/")
+		run("s3.list", source, func(ctx context.Context) (string, error) {
+			out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+				Bucket:  aws.String(bucket),
+				Prefix:  aws.String(prefix),
+				MaxKeys: aws.Int32(1),
+			})
+			if err != nil {
+				return "", err
+			}
+			if len(out.Contents) == 0 {
+				return "listable, no objects under the prefix yet", nil
+			}
+			return "listable, e.g. " + aws.ToString(out.Contents[0].Key), nil
+		})
+	}
+	httpClient := &http.Client{Timeout: preflightTimeout}
+	for _, endpoint := range endpointOrder {
+		run("http.endpoint", endpoint, func(ctx context.Context) (string, error) {
+			return checkEndpointReachable(ctx, httpClient, endpoint)
+		})
+	}
+	if cfg.UsesRedis() {
+		redisConfig := cfg.State.Redis
+		run("redis", fmt.Sprintf("%s:%d", redisConfig.Host, redisConfig.Port), func(ctx context.Context) (string, error) {
+			checker := NewRedisHealthChecker(redisConfig)
+			defer checker.client.Close()
+			return "PONG", checker.Check(ctx)
+		})
+	}
+	results = append(results, CheckFormats(cfg.Processing.LogFormats)...)
+	return results
+}
+
+// checkEndpointReachable sends a HEAD request to endpoint. Any HTTP response counts: an
+// input that only accepts POST still proves the endpoint is listening.
+func checkEndpointReachable(ctx context.Context, client *http.Client, endpoint string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return "reachable (HTTP " + resp.Status + ")", nil
+}
+
+// CheckFormats checks that each custom format's filename pattern and timestamp regex compile,
+// and that the regex has the capture group the timestamp is taken from
+func CheckFormats(formats []config.FormatConfig) []PreflightResult {
+	results := make([]PreflightResult, 0, len(formats))
+	for _, format := range formats {
+		result := PreflightResult{Check: "format", Target: format.Name, Detail: "patterns compile"}
+		if _, err := filepath.Match(format.FilenamePattern, ""); err != nil {
+			result.Err = fmt.Errorf("filename_pattern %q: %w", format.FilenamePattern, err)
+		} else if re, err := regexp.Compile(format.TimestampRegex); err != nil {
+			result.Err = fmt.Errorf("timestamp_regex: %w", err)
+		} else if re.NumSubexp() == 0 {
+			result.Err = errors.New("timestamp_regex needs a capture group for the timestamp")
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// WritePreflight writes the results as a table and reports whether every check passed
+func WritePreflight(w io.Writer, results []PreflightResult) bool {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tTARGET\tRESULT\tDETAIL")
+	passed := true
+	for _, r := range results {
+		status, detail := "PASS", r.Detail
+		if r.Err != nil {
+			status, detail, passed = "FAIL", r.Err.Error(), false
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Check, r.Target, status, detail)
+	}
+	tw.Flush()
+	return passed
+}
@@ -0,0 +1,102 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestPreflight(t *testing.T) {
+	s3Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/logs":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodHead:
+		default:
+			w.Write([]byte(`<ListBucketResult><Contents><Key>app/1.log.gz</Key></Contents></ListBucketResult>`))
+		}
+	}))
+	defer s3Server.Close()
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed) // Inputs may only accept POST
+	}))
+	defer endpoint.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(s3Server.URL),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+	})
+	cfg := &config.Config{
+		S3:   config.S3Config{Bucket: "logs", Prefix: "app/", Region: "us-east-1"},
+		HTTP: config.HTTPConfig{Endpoints: []string{endpoint.URL, down.URL}},
+		Processing: config.ProcessingConfig{LogFormats: []config.FormatConfig{
+			{Name: "app", FilenamePattern: "*.log.gz", TimestampRegex: `(\d+)`},
+		}},
+	}
+
+	results := Preflight(context.Background(), cfg, func(config.Config) *s3.Client { return client })
+	failed := make(map[string]bool)
+	for _, r := range results {
+		failed[r.Check+" "+r.Target] = r.Err != nil
+	}
+	want := map[string]bool{
+		"s3.head_bucket logs":           false,
+		"s3.list logs/app/":             false,
+		"http.endpoint " + endpoint.URL: false,
+		"http.endpoint " + down.URL:     true,
+		"format app":                    false,
+	}
+	for check, wantFailed := range want {
+		got, ok := failed[check]
+		if !ok {
+			t.Errorf("Expected a %s check, got %+v", check, results)
+		} else if got != wantFailed {
+			t.Errorf("Expected %s failed = %v, got %v", check, wantFailed, got)
+		}
+	}
+	if len(results) != len(want) {
+		t.Errorf("Expected %d checks, got %d", len(want), len(results))
+	}
+}
+
+func TestCheckFormats(t *testing.T) {
+	results := CheckFormats([]config.FormatConfig{
+		{Name: "ok", FilenamePattern: "*.gz", TimestampRegex: `(\d{10})`},
+		{Name: "bad_glob", FilenamePattern: "[*.gz", TimestampRegex: `(\d{10})`},
+		{Name: "bad_regex", FilenamePattern: "*.gz", TimestampRegex: `(\d{10}`},
+		{Name: "no_group", FilenamePattern: "*.gz", TimestampRegex: `\d{10}`},
+	})
+	for i, wantErr := range []bool{false, true, true, true} {
+		if (results[i].Err != nil) != wantErr {
+			t.Errorf("%s: expected error %v, got %v", results[i].Target, wantErr, results[i].Err)
+		}
+	}
+}
+
+func TestWritePreflight(t *testing.T) {
+	var buf bytes.Buffer
+	passed := WritePreflight(&buf, []PreflightResult{
+		{Check: "s3.head_bucket", Target: "logs", Detail: "accessible"},
+		{Check: "redis", Target: "localhost:6379", Err: context.DeadlineExceeded},
+	})
+	if passed {
+		t.Error("Expected a failing check to fail the pre-flight")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "PASS") || !strings.Contains(out, "FAIL") || !strings.Contains(out, "context deadline exceeded") {
+		t.Errorf("Expected a pass/fail table, got:\n%s", out)
+	}
+}
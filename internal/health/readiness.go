@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// ReadinessStats are read from the pipeline on every readiness check
+type ReadinessStats struct {
+	Endpoints  func() (healthy, total int) // Endpoints accepting deliveries
+	QueueFill  func() float64              // File queue fill (0-1)
+	BufferFill func() float64              // HTTP buffer fill (0-1)
+	Shedding   func() bool                 // Scanning is paused to shed load
+}
+
+// ReadinessChecker reports the streamer not ready to take work when no endpoint is
+// accepting deliveries, while it sheds load, or once the file queue or HTTP buffer has
+// been saturated for health.saturated_for
+type ReadinessChecker struct {
+	stats        ReadinessStats
+	saturatedFor time.Duration
+
+	mu             sync.Mutex
+	saturatedSince time.Time // When the queue or buffer became saturated (zero if not)
+}
+
+// NewReadinessChecker creates a readiness checker. Nil stats are skipped.
+func NewReadinessChecker(cfg config.HealthConfig, stats ReadinessStats) *ReadinessChecker {
+	return &ReadinessChecker{stats: stats, saturatedFor: cfg.SaturatedFor}
+}
+
+// Check compares the pipeline against the readiness conditions
+func (c *ReadinessChecker) Check(ctx context.Context) error {
+	return c.check(time.Now())
+}
+
+func (c *ReadinessChecker) check(now time.Time) error {
+	var problems []string
+	if c.stats.Endpoints != nil {
+		if healthy, total := c.stats.Endpoints(); total > 0 && healthy == 0 {
+			problems = append(problems, fmt.Sprintf("none of %d endpoints is accepting deliveries", total))
+		}
+	}
+	if c.stats.Shedding != nil && c.stats.Shedding() {
+		problems = append(problems, "shedding load")
+	}
+
+	var saturated []string
+	if c.stats.QueueFill != nil {
+		if fill := c.stats.QueueFill(); fill >= bufferFullFill {
+			saturated = append(saturated, fmt.Sprintf("file queue saturated (%.0f%%)", fill*100))
+		}
+	}
+	if c.stats.BufferFill != nil {
+		if fill := c.stats.BufferFill(); fill >= bufferFullFill {
+			saturated = append(saturated, fmt.Sprintf("HTTP buffer saturated (%.0f%%)", fill*100))
+		}
+	}
+	c.mu.Lock()
+	if len(saturated) == 0 {
+		c.saturatedSince = time.Time{}
+	} else if c.saturatedSince.IsZero() {
+		c.saturatedSince = now
+	}
+	if len(saturated) > 0 && now.Sub(c.saturatedSince) >= c.saturatedFor {
+		problems = append(problems, saturated...)
+	}
+	c.mu.Unlock()
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Name returns the checker name
+func (c *ReadinessChecker) Name() string {
+	return "pipeline"
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestReadinessChecker(t *testing.T) {
+	healthy, fill := 2, 0.5
+	checker := NewReadinessChecker(config.HealthConfig{}, ReadinessStats{
+		Endpoints: func() (int, int) { return healthy, 2 },
+		QueueFill: func() float64 { return fill },
+	})
+
+	if err := checker.Check(context.Background()); err != nil {
+		t.Errorf("Expected ready, got %v", err)
+	}
+
+	// One healthy endpoint is enough
+	healthy = 1
+	if err := checker.Check(context.Background()); err != nil {
+		t.Errorf("Expected ready with one healthy endpoint, got %v", err)
+	}
+
+	healthy, fill = 0, 1
+	err := checker.Check(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "none of 2 endpoints") || !strings.Contains(err.Error(), "file queue saturated") {
+		t.Errorf("Expected endpoint and queue problems, got %v", err)
+	}
+}
+
+func TestReadinessChecker_SaturatedFor(t *testing.T) {
+	fill, shedding := 1.0, false
+	checker := NewReadinessChecker(config.HealthConfig{SaturatedFor: time.Minute}, ReadinessStats{
+		QueueFill: func() float64 { return fill },
+		Shedding:  func() bool { return shedding },
+	})
+
+	start := time.Now()
+	if err := checker.check(start); err != nil {
+		t.Errorf("Expected ready while briefly saturated, got %v", err)
+	}
+	if err := checker.check(start.Add(time.Minute)); err == nil {
+		t.Error("Expected not ready once saturated for a minute")
+	}
+
+	// Draining resets the window
+	fill = 0.5
+	checker.check(start.Add(2 * time.Minute))
+	fill = 1
+	if err := checker.check(start.Add(3 * time.Minute)); err != nil {
+		t.Errorf("Expected ready after the queue drained, got %v", err)
+	}
+
+	shedding = true
+	if err := checker.check(start.Add(3 * time.Minute)); err == nil || !strings.Contains(err.Error(), "shedding load") {
+		t.Errorf("Expected not ready while shedding, got %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package health
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
@@ -17,30 +19,51 @@ type HealthChecker interface {
 	Name() string
 }
 
-// HealthServer provides HTTP health check endpoints
+// HealthServer provides HTTP health check endpoints: /health runs every dependency check,
+// /ready reports whether the streamer can take work, /live only that the process is up and
+// /startup whether initialization has finished
 type HealthServer struct {
-	server   *http.Server
-	checkers []HealthChecker
-	mu       sync.RWMutex
+	server          *http.Server
+	mux             *http.ServeMux
+	checkers        []HealthChecker
+	readyCheckers   []HealthChecker
+	ready           atomic.Bool
+	notReadyMessage atomic.Value // Why the streamer is not ready (string)
+	startup         *Startup
+	mu              sync.RWMutex
+}
+
+// DetailedChecker is a checker made of parts (e.g. one per endpoint) whose results are
+// reported separately under "details"
+type DetailedChecker interface {
+	HealthChecker
+	CheckParts(ctx context.Context) (parts map[string]error, err error)
 }
 
 // HealthStatus represents the health check response
 type HealthStatus struct {
-	Status    string            `json:"status"`
-	Checks    map[string]string `json:"checks,omitempty"`
-	Message   string            `json:"message,omitempty"`
-	Timestamp string            `json:"timestamp"`
+	Status    string                       `json:"status"`
+	Checks    map[string]string            `json:"checks,omitempty"`
+	Details   map[string]map[string]string `json:"details,omitempty"` // Part results of detailed checks, by check name
+	Message   string                       `json:"message,omitempty"`
+	Timestamp string                       `json:"timestamp"`
 }
 
 // NewHealthServer creates a new health check server
 func NewHealthServer(address, path string, checkers ...HealthChecker) *HealthServer {
+	mux := http.NewServeMux()
 	hs := &HealthServer{
 		checkers: checkers,
+		mux:      mux,
+		startup:  NewStartup(),
 	}
 
-	mux := http.NewServeMux()
+	hs.notReadyMessage.Store("Starting")
+
 	mux.HandleFunc(path, hs.healthHandler)
 	mux.HandleFunc("/ready", hs.readyHandler)
+	mux.HandleFunc("/live", hs.liveHandler)
+	mux.HandleFunc("/startup", hs.startupHandler)
 
 	hs.server = &http.Server{
 		Addr:    address,
@@ -52,7 +75,7 @@ func NewHealthServer(address, path string, checkers ...HealthChecker) *HealthSer
 
 // Start starts the health check server
 func (hs *HealthServer) Start() error {
-	logger := logging.GetDefaultLogger()
+	logger := logging.Component("health")
 	logger.Info("Starting health check server", "address", hs.server.Addr)
 
 	go func() {
@@ -74,33 +97,91 @@ func (hs *HealthServer) healthHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	status := hs.performHealthChecks(ctx)
+	hs.mu.RLock()
+	checkers := make([]HealthChecker, len(hs.checkers))
+	copy(checkers, hs.checkers)
+	hs.mu.RUnlock()
+
+	writeStatus(w, runChecks(ctx, checkers))
+}
+
+// readyHandler handles /ready requests: 503 until SetReady(true), and while a readiness
+// check fails. Dependency checks are left to /health, so a slow S3 does not pull every
+// replica out of rotation.
+func (hs *HealthServer) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if !hs.ready.Load() {
+		message := hs.notReadyMessage.Load().(string)
+		if startup := hs.startup.Status(); !startup.Started {
+			message = "Starting: " + startup.Phase
+		}
+		writeStatus(w, HealthStatus{
+			Status:    "unhealthy",
+			Message:   message,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	hs.mu.RLock()
+	checkers := make([]HealthChecker, len(hs.readyCheckers))
+	copy(checkers, hs.readyCheckers)
+	hs.mu.RUnlock()
+
+	status := runChecks(ctx, checkers)
+	if status.Status == "unhealthy" {
+		status.Message = "Not ready: one or more readiness checks failed"
+	}
+	writeStatus(w, status)
+}
+
+// liveHandler handles /live requests. It only shows the process is serving, so liveness
+// probes never restart the streamer over a dependency outage.
+func (hs *HealthServer) liveHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, HealthStatus{Status: "alive", Timestamp: time.Now().UTC().Format(time.RFC3339)})
+}
+
+// startupHandler handles /startup requests: 503 with the current phase until startup has
+// finished, then 200. Point a Kubernetes startup probe at it so slow starts are not killed.
+func (hs *HealthServer) startupHandler(w http.ResponseWriter, r *http.Request) {
+	status := hs.startup.Status()
+	w.Header().Set("Content-Type", "application/json")
+	if status.Started {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logging.Component("health").Error("Failed to encode startup status", "error", err)
+	}
+}
+
+// Startup returns the startup phase tracker; call Enter as initialization progresses
+func (hs *HealthServer) Startup() *Startup {
+	return hs.startup
+}
 
+// writeStatus writes status as JSON, answering 503 when it is unhealthy
+func writeStatus(w http.ResponseWriter, status HealthStatus) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if status.Status == "healthy" {
+	if status.Status != "unhealthy" {
 		w.WriteHeader(http.StatusOK)
 	} else {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 
 	if err := json.NewEncoder(w).Encode(status); err != nil {
-		logger := logging.GetDefaultLogger()
+		logger := logging.Component("health")
 		logger.Error("Failed to encode health status", "error", err)
 	}
 }
 
-// readyHandler handles /ready requests (same as health for now)
-func (hs *HealthServer) readyHandler(w http.ResponseWriter, r *http.Request) {
-	hs.healthHandler(w, r)
-}
-
-// performHealthChecks runs all health checks
-func (hs *HealthServer) performHealthChecks(ctx context.Context) HealthStatus {
-	hs.mu.RLock()
-	checkers := make([]HealthChecker, len(hs.checkers))
-	copy(checkers, hs.checkers)
-	hs.mu.RUnlock()
+// runChecks runs the checkers. Checks failing with ErrDegraded report "degraded" unless
+// another check is unhealthy.
+func runChecks(ctx context.Context, checkers []HealthChecker) HealthStatus {
 
 	status := HealthStatus{
 		Status:    "healthy",
@@ -109,21 +190,72 @@ func (hs *HealthServer) performHealthChecks(ctx context.Context) HealthStatus {
 	}
 
 	for _, checker := range checkers {
-		if err := checker.Check(ctx); err != nil {
-			status.Status = "unhealthy"
-			status.Checks[checker.Name()] = fmt.Sprintf("ERROR: %v", err)
+		var err error
+		if detailed, ok := checker.(DetailedChecker); ok {
+			var parts map[string]error
+			parts, err = detailed.CheckParts(ctx)
+			if status.Details == nil {
+				status.Details = make(map[string]map[string]string)
+			}
+			details := make(map[string]string, len(parts))
+			for part, partErr := range parts {
+				details[part] = "OK"
+				if partErr != nil {
+					details[part] = fmt.Sprintf("ERROR: %v", partErr)
+				}
+			}
+			status.Details[checker.Name()] = details
 		} else {
+			err = checker.Check(ctx)
+		}
+		switch {
+		case err == nil:
 			status.Checks[checker.Name()] = "OK"
+		case errors.Is(err, ErrDegraded):
+			if status.Status == "healthy" {
+				status.Status = "degraded"
+			}
+			status.Checks[checker.Name()] = err.Error()
+		default:
+			status.Status = "unhealthy"
+			status.Checks[checker.Name()] = fmt.Sprintf("ERROR: %v", err)
 		}
 	}
 
-	if status.Status == "unhealthy" {
+	switch status.Status {
+	case "unhealthy":
 		status.Message = "One or more health checks failed"
+	case "degraded":
+		status.Message = "One or more health checks are degraded"
 	}
 
 	return status
 }
 
+// Handle registers an additional handler (e.g. the admin API) on the health server
+func (hs *HealthServer) Handle(pattern string, handler http.Handler) {
+	hs.mux.Handle(pattern, handler)
+}
+
+// SetReady marks the streamer initialized (state loaded, pools started), entering
+// PhaseRunning if startup has not finished yet, or with false, not ready for the given
+// reason, e.g. while shutting down
+func (hs *HealthServer) SetReady(ready bool, reason string) {
+	if !ready {
+		hs.notReadyMessage.Store(reason)
+	} else if !hs.startup.Status().Started {
+		hs.startup.Enter(PhaseRunning)
+	}
+	hs.ready.Store(ready)
+}
+
+// AddReadinessChecker adds a check that must pass for /ready once the streamer is ready
+func (hs *HealthServer) AddReadinessChecker(checker HealthChecker) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.readyCheckers = append(hs.readyCheckers, checker)
+}
+
 // AddChecker adds a health checker dynamically
 func (hs *HealthServer) AddChecker(checker HealthChecker) {
 	hs.mu.Lock()
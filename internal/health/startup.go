@@ -0,0 +1,71 @@
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// Startup phases, in the order the streamer enters them
+const (
+	PhaseStarting           = "starting"
+	PhaseLoadingCredentials = "loading_credentials"
+	PhaseConnectingS3       = "connecting_s3"
+	PhaseLoadingState       = "loading_state"
+	PhaseWarmingHTTPPool    = "warming_http_pool"
+	PhaseRunning            = "running"
+)
+
+// PhaseTiming is how long a finished startup phase took
+type PhaseTiming struct {
+	Phase      string `json:"phase"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// StartupStatus is the body of /startup and part of /status
+type StartupStatus struct {
+	Phase    string        `json:"phase"`
+	Since    time.Time     `json:"since"` // When the current phase was entered
+	Started  bool          `json:"started"`
+	Finished []PhaseTiming `json:"finished,omitempty"`
+}
+
+// Startup tracks the initialization phases, so slow starts (e.g. loading a large state)
+// can be told apart from hung ones
+type Startup struct {
+	mu     sync.Mutex
+	status StartupStatus
+}
+
+// NewStartup creates a tracker in the starting phase
+func NewStartup() *Startup {
+	return &Startup{status: StartupStatus{Phase: PhaseStarting, Since: time.Now().UTC()}}
+}
+
+// Enter finishes the current phase and enters phase. Entering PhaseRunning completes startup.
+func (s *Startup) Enter(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	took := now.Sub(s.status.Since)
+	s.status.Finished = append(s.status.Finished, PhaseTiming{Phase: s.status.Phase, DurationMs: took.Milliseconds()})
+	logging.Component("health").Info("Startup phase finished",
+		"phase", s.status.Phase,
+		"duration", took.Round(time.Millisecond),
+		"next", phase)
+	s.status.Phase = phase
+	s.status.Since = now
+	if phase == PhaseRunning {
+		s.status.Started = true
+	}
+}
+
+// Status returns the current phase and the finished ones
+func (s *Startup) Status() StartupStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Finished = append([]PhaseTiming(nil), s.status.Finished...)
+	return status
+}
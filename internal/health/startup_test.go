@@ -0,0 +1,44 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartup_Phases(t *testing.T) {
+	server := NewHealthServer(":0", "/health")
+	startup := server.Startup()
+
+	probe := func() (int, StartupStatus) {
+		w := httptest.NewRecorder()
+		server.startupHandler(w, httptest.NewRequest("GET", "/startup", nil))
+		var status StartupStatus
+		json.NewDecoder(w.Body).Decode(&status)
+		return w.Code, status
+	}
+
+	startup.Enter(PhaseLoadingState)
+	if code, status := probe(); code != http.StatusServiceUnavailable || status.Phase != PhaseLoadingState || status.Started {
+		t.Errorf("Expected 503 while loading state, got %d %+v", code, status)
+	}
+
+	// Readiness reports the phase while starting
+	w := httptest.NewRecorder()
+	server.readyHandler(w, httptest.NewRequest("GET", "/ready", nil))
+	var ready HealthStatus
+	json.NewDecoder(w.Body).Decode(&ready)
+	if ready.Message != "Starting: loading_state" {
+		t.Errorf("Expected the phase in the readiness message, got %q", ready.Message)
+	}
+
+	startup.Enter(PhaseRunning)
+	code, status := probe()
+	if code != http.StatusOK || !status.Started {
+		t.Errorf("Expected 200 once running, got %d %+v", code, status)
+	}
+	if len(status.Finished) != 2 || status.Finished[0].Phase != PhaseStarting || status.Finished[1].Phase != PhaseLoadingState {
+		t.Errorf("Expected starting and loading_state finished, got %+v", status.Finished)
+	}
+}
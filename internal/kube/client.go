@@ -0,0 +1,165 @@
+// Package kube talks to the Kubernetes API server from inside a pod, using the pod's service
+// account. It covers what the streamer needs and nothing more: Lease objects for leader
+// election and annotations on the streamer's own pod.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account credentials
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// requestTimeout bounds a request without a deadline of its own
+const requestTimeout = 10 * time.Second
+
+// Client is an API server client authenticated with a bearer token
+type Client struct {
+	baseURL   string
+	tokenFile string // Re-read per request, since projected tokens are rotated
+	namespace string
+	http      *http.Client
+}
+
+// InCluster creates a client from the environment of a pod: KUBERNETES_SERVICE_HOST and
+// KUBERNETES_SERVICE_PORT, and the mounted service account. namespace is where objects are
+// read and written; when empty, the service account's namespace is used.
+func InCluster(namespace string) (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod (KUBERNETES_SERVICE_HOST is not set)")
+	}
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the service account namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid cluster CA certificate")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	return NewClient("https://"+net.JoinHostPort(host, port), filepath.Join(serviceAccountDir, "token"), namespace, &http.Client{Transport: transport}), nil
+}
+
+// NewClient creates a client for the API server at baseURL. tokenFile holds the bearer token
+// (empty for none).
+func NewClient(baseURL, tokenFile, namespace string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		tokenFile: tokenFile,
+		namespace: namespace,
+		http:      httpClient,
+	}
+}
+
+// Namespace returns the namespace the client works in
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// StatusError is an error response of the API server
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes API returned %d: %s", e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.Code == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a 409 response: the object exists already, or changed
+// since it was read
+func IsConflict(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.Code == http.StatusConflict
+}
+
+// do sends in (if not nil) as JSON, or as contentType when set, and decodes the response into
+// out (if not nil)
+func (c *Client) do(ctx context.Context, method, path, contentType string, in, out any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		return &StatusError{Code: resp.StatusCode, Message: status.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid kubernetes API response: %w", err)
+	}
+	return nil
+}
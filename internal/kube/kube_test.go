@@ -0,0 +1,181 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPIServer serves Leases and pod patches in namespace "ns"
+type fakeAPIServer struct {
+	mu          sync.Mutex
+	leases      map[string]Lease
+	version     int
+	annotations map[string]string
+	failPatch   bool
+	auth        string // Authorization header of the last request
+}
+
+func newFakeAPIServer(t *testing.T) (*fakeAPIServer, *Client) {
+	f := &fakeAPIServer{leases: make(map[string]Lease), annotations: make(map[string]string)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	token := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(token, []byte("secret\n"), 0o600)
+	return f, NewClient(srv.URL, token, "ns", srv.Client())
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = r.Header.Get("Authorization")
+
+	const leases = "/apis/coordination.k8s.io/v1/namespaces/ns/leases"
+	switch {
+	case r.URL.Path == "/api/v1/namespaces/ns/pods/pod-a" && r.Method == http.MethodPatch:
+		if f.failPatch {
+			writeStatus(w, http.StatusServiceUnavailable, "unavailable")
+			return
+		}
+		var patch struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		json.NewDecoder(r.Body).Decode(&patch)
+		for k, v := range patch.Metadata.Annotations {
+			f.annotations[k] = v
+		}
+		w.Write([]byte("{}"))
+
+	case r.URL.Path == leases && r.Method == http.MethodPost:
+		var lease Lease
+		json.NewDecoder(r.Body).Decode(&lease)
+		if _, ok := f.leases[lease.Metadata.Name]; ok {
+			writeStatus(w, http.StatusConflict, "already exists")
+			return
+		}
+		f.store(w, lease)
+
+	case strings.HasPrefix(r.URL.Path, leases+"/"):
+		name := strings.TrimPrefix(r.URL.Path, leases+"/")
+		current, ok := f.leases[name]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, "not found")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(current)
+		case http.MethodPut:
+			var lease Lease
+			json.NewDecoder(r.Body).Decode(&lease)
+			if lease.Metadata.ResourceVersion != current.Metadata.ResourceVersion {
+				writeStatus(w, http.StatusConflict, "the object has been modified")
+				return
+			}
+			f.store(w, lease)
+		}
+
+	default:
+		writeStatus(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (f *fakeAPIServer) store(w http.ResponseWriter, lease Lease) {
+	f.version++
+	lease.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	f.leases[lease.Metadata.Name] = lease
+	json.NewEncoder(w).Encode(lease)
+}
+
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	io.WriteString(w, `{"kind":"Status","message":"`+message+`"}`)
+}
+
+func TestClient_Lease(t *testing.T) {
+	f, client := newFakeAPIServer(t)
+	ctx := context.Background()
+
+	if _, err := client.GetLease(ctx, "leader"); !IsNotFound(err) {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+	created, err := client.CreateLease(ctx, &Lease{Metadata: ObjectMeta{Name: "leader"}, Spec: LeaseSpec{HolderIdentity: "pod-a"}})
+	if err != nil {
+		t.Fatalf("CreateLease failed: %v", err)
+	}
+	if f.auth != "Bearer secret" {
+		t.Errorf("Expected the service account token, got %q", f.auth)
+	}
+	if _, err := client.CreateLease(ctx, &Lease{Metadata: ObjectMeta{Name: "leader"}}); !IsConflict(err) {
+		t.Errorf("Expected a conflict creating an existing lease, got %v", err)
+	}
+
+	lease, err := client.GetLease(ctx, "leader")
+	if err != nil || lease.Spec.HolderIdentity != "pod-a" || lease.Metadata.ResourceVersion != created.Metadata.ResourceVersion {
+		t.Fatalf("Expected the created lease, got %+v, %v", lease, err)
+	}
+	lease.Spec.HolderIdentity = "pod-b"
+	if _, err := client.UpdateLease(ctx, lease); err != nil {
+		t.Fatalf("UpdateLease failed: %v", err)
+	}
+	// The resource version read first is stale now
+	if _, err := client.UpdateLease(ctx, lease); !IsConflict(err) {
+		t.Errorf("Expected a conflict updating a stale lease, got %v", err)
+	}
+}
+
+func TestPodAnnotator_RetriesAndKeepsLatest(t *testing.T) {
+	f, client := newFakeAPIServer(t)
+	f.failPatch = true
+
+	a := NewPodAnnotator(client, "pod-a")
+	a.Set(map[string]string{"shards": "0-3"})
+	if a.flush() {
+		t.Fatal("Expected the update to fail")
+	}
+	a.Set(map[string]string{"shards": "4-7"}) // Newer than the failed value
+
+	f.mu.Lock()
+	f.failPatch = false
+	f.mu.Unlock()
+	a.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		f.mu.Lock()
+		got := f.annotations["shards"]
+		f.mu.Unlock()
+		if got == "4-7" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the latest annotation to be written, got %q", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	a.Set(map[string]string{"shards": ""})
+	a.Stop() // Writes what is pending
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got, ok := f.annotations["shards"]; !ok || got != "" {
+		t.Errorf("Expected the pending annotation written on Stop, got %q", got)
+	}
+}
+
+func TestInCluster_RequiresPod(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := InCluster("ns"); err == nil {
+		t.Error("Expected an error outside a pod")
+	}
+}
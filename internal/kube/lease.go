@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MicroTimeFormat is the wire format of the Lease timestamps
+const MicroTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Lease is a coordination.k8s.io/v1 Lease
+type Lease struct {
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Kind       string     `json:"kind,omitempty"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       LeaseSpec  `json:"spec"`
+}
+
+// ObjectMeta holds the object metadata the streamer uses
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// LeaseSpec is the holder of a Lease and how long it is held for
+type LeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"` // MicroTimeFormat
+	RenewTime            string `json:"renewTime,omitempty"`   // MicroTimeFormat
+	LeaseTransitions     int32  `json:"leaseTransitions,omitempty"`
+}
+
+// MicroTime formats t for a Lease timestamp
+func MicroTime(t time.Time) string {
+	return t.UTC().Format(MicroTimeFormat)
+}
+
+// GetLease reads a Lease; IsNotFound reports a missing one
+func (c *Client) GetLease(ctx context.Context, name string) (*Lease, error) {
+	var lease Lease
+	if err := c.do(ctx, http.MethodGet, c.leasePath(name), "", nil, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// CreateLease creates a Lease; IsConflict reports that it exists already
+func (c *Client) CreateLease(ctx context.Context, lease *Lease) (*Lease, error) {
+	lease.APIVersion, lease.Kind = "coordination.k8s.io/v1", "Lease"
+	lease.Metadata.Namespace = c.namespace
+	var created Lease
+	if err := c.do(ctx, http.MethodPost, c.leasePath(""), "", lease, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateLease replaces a Lease read earlier. IsConflict reports that it changed since, as
+// its resource version no longer matches.
+func (c *Client) UpdateLease(ctx context.Context, lease *Lease) (*Lease, error) {
+	lease.APIVersion, lease.Kind = "coordination.k8s.io/v1", "Lease"
+	var updated Lease
+	if err := c.do(ctx, http.MethodPut, c.leasePath(lease.Metadata.Name), "", lease, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// leasePath is the API path of the namespace's Leases, or of one Lease
+func (c *Client) leasePath(name string) string {
+	path := "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(c.namespace) + "/leases"
+	if name != "" {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
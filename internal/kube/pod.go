@@ -0,0 +1,123 @@
+package kube
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// annotateRetryInterval is how long a failed annotation update waits before it is retried
+const annotateRetryInterval = 5 * time.Second
+
+// AnnotatePod merges annotations into the metadata of a pod
+func (c *Client) AnnotatePod(ctx context.Context, pod string, annotations map[string]string) error {
+	patch := map[string]any{"metadata": map[string]any{"annotations": annotations}}
+	path := "/api/v1/namespaces/" + url.PathEscape(c.namespace) + "/pods/" + url.PathEscape(pod)
+	return c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+}
+
+// PodAnnotator keeps annotations on a pod up to date in the background, so callers are not
+// held up by the API server. Only the latest annotations are written; failed updates are
+// retried.
+type PodAnnotator struct {
+	client *Client
+	pod    string
+
+	mu      sync.Mutex
+	pending map[string]string // Not yet written; nil when up to date
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewPodAnnotator creates an annotator for pod. Call Start to begin writing.
+func NewPodAnnotator(client *Client, pod string) *PodAnnotator {
+	return &PodAnnotator{
+		client: client,
+		pod:    pod,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Set schedules annotations to be merged into the pod's, replacing those not written yet
+// under the same keys
+func (a *PodAnnotator) Set(annotations map[string]string) {
+	a.mu.Lock()
+	if a.pending == nil {
+		a.pending = make(map[string]string, len(annotations))
+	}
+	maps.Copy(a.pending, annotations)
+	a.mu.Unlock()
+
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start writes annotations until Stop
+func (a *PodAnnotator) Start() {
+	go a.run()
+}
+
+// Stop writes the annotations still pending, then stops
+func (a *PodAnnotator) Stop() {
+	close(a.stop)
+	<-a.done
+	a.flush()
+}
+
+func (a *PodAnnotator) run() {
+	defer crash.Recover()
+	defer close(a.done)
+	retry := time.NewTimer(0)
+	retry.Stop()
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-a.wake:
+		case <-retry.C:
+		}
+		if !a.flush() {
+			retry.Reset(annotateRetryInterval)
+		}
+	}
+}
+
+// flush writes the pending annotations and reports whether none are left
+func (a *PodAnnotator) flush() bool {
+	a.mu.Lock()
+	annotations := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+	if annotations == nil {
+		return true
+	}
+
+	if err := a.client.AnnotatePod(context.Background(), a.pod, annotations); err != nil {
+		logging.Component("kubernetes").Warn("Failed to annotate pod", "pod", a.pod, "error", err)
+		a.mu.Lock()
+		for key, value := range annotations {
+			if _, newer := a.pending[key]; !newer {
+				if a.pending == nil {
+					a.pending = make(map[string]string)
+				}
+				a.pending[key] = value
+			}
+		}
+		a.mu.Unlock()
+		return false
+	}
+	return true
+}
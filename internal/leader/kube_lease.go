@@ -0,0 +1,136 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/kube"
+)
+
+// kubeLease is a lease stored as a Kubernetes Lease object. Updates carry the resource version
+// they read, so two replicas never both take it. Expiry is judged by when this replica last
+// saw the Lease change, not by its renew time, so clock skew between nodes does not matter.
+type kubeLease struct {
+	client   *kube.Client
+	name     string
+	identity string
+	ttl      time.Duration
+
+	observedVersion string    // Resource version last read
+	observedAt      time.Time // When it was first seen
+}
+
+func newKubeLease(client *kube.Client, name, identity string, ttl time.Duration) *kubeLease {
+	return &kubeLease{client: client, name: name, identity: identity, ttl: ttl}
+}
+
+func (l *kubeLease) acquire(ctx context.Context) (bool, error) {
+	lease, err := l.client.GetLease(ctx, l.name)
+	if kube.IsNotFound(err) {
+		now := time.Now()
+		_, err = l.client.CreateLease(ctx, &kube.Lease{
+			Metadata: kube.ObjectMeta{Name: l.name},
+			Spec: kube.LeaseSpec{
+				HolderIdentity:       l.identity,
+				LeaseDurationSeconds: l.durationSeconds(),
+				AcquireTime:          kube.MicroTime(now),
+				RenewTime:            kube.MicroTime(now),
+			},
+		})
+		if kube.IsConflict(err) {
+			return false, nil // Created by another replica first
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	l.observe(lease, now)
+	holder := lease.Spec.HolderIdentity
+	if holder != "" && holder != l.identity && now.Before(l.observedAt.Add(l.expiry(lease))) {
+		return false, nil
+	}
+
+	// Free, expired or still ours after a restart
+	if holder != l.identity {
+		lease.Spec.HolderIdentity = l.identity
+		lease.Spec.AcquireTime = kube.MicroTime(now)
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.LeaseDurationSeconds = l.durationSeconds()
+	lease.Spec.RenewTime = kube.MicroTime(now)
+	updated, err := l.client.UpdateLease(ctx, lease)
+	if kube.IsConflict(err) {
+		return false, nil // Taken or renewed by another replica since it was read
+	}
+	if err != nil {
+		return false, err
+	}
+	l.observe(updated, now)
+	return true, nil
+}
+
+func (l *kubeLease) renew(ctx context.Context) (bool, error) {
+	lease, err := l.client.GetLease(ctx, l.name)
+	if kube.IsNotFound(err) {
+		return false, nil // Deleted, so no longer ours
+	}
+	if err != nil {
+		return false, err
+	}
+	if lease.Spec.HolderIdentity != l.identity {
+		return false, nil
+	}
+
+	now := time.Now()
+	lease.Spec.RenewTime = kube.MicroTime(now)
+	updated, err := l.client.UpdateLease(ctx, lease)
+	if err != nil {
+		// A conflict is reported as an error: the next renewal reads who holds it now
+		return false, err
+	}
+	l.observe(updated, now)
+	return true, nil
+}
+
+func (l *kubeLease) release(ctx context.Context) error {
+	lease, err := l.client.GetLease(ctx, l.name)
+	if kube.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity != l.identity {
+		return nil
+	}
+	// An empty holder is free to take at once; the short duration covers older clients
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.LeaseDurationSeconds = 1
+	lease.Spec.RenewTime = kube.MicroTime(time.Now())
+	_, err = l.client.UpdateLease(ctx, lease)
+	return err
+}
+
+// observe records when the Lease's resource version was first seen
+func (l *kubeLease) observe(lease *kube.Lease, now time.Time) {
+	if lease.Metadata.ResourceVersion != l.observedVersion {
+		l.observedVersion = lease.Metadata.ResourceVersion
+		l.observedAt = now
+	}
+}
+
+// expiry is how long the Lease lasts without renewal, as its holder recorded it
+func (l *kubeLease) expiry(lease *kube.Lease) time.Duration {
+	if lease.Spec.LeaseDurationSeconds > 0 {
+		return time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	return l.ttl
+}
+
+// durationSeconds is the lease duration in whole seconds, at least one
+func (l *kubeLease) durationSeconds() int32 {
+	return int32(max(1, (l.ttl+time.Second-1)/time.Second))
+}
@@ -0,0 +1,172 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/kube"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// locker is a lease held by at most one replica at a time
+type locker interface {
+	acquire(ctx context.Context) (bool, error) // Take the lease if it is free or already ours
+	renew(ctx context.Context) (bool, error)   // Extend the lease; false if another replica holds it
+	release(ctx context.Context) error         // Give up the lease if we hold it
+}
+
+// Elector runs work only while this replica holds the leader lease.
+// Standby replicas retry every renew interval and take over once the lease expires or is released.
+type Elector struct {
+	lock          locker
+	identity      string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	leading       atomic.Bool
+}
+
+// New creates an elector for the configured backend. The Redis lock connects with the
+// state.redis settings; the Kubernetes Lease is kept with the pod's service account.
+func New(cfg config.LeaderElectionConfig, redisConfig config.RedisConfig, kubeConfig config.KubernetesConfig) (*Elector, error) {
+	var lock locker
+	switch cfg.Backend {
+	case "redis":
+		lock = newRedisLock(redisConfig, cfg.Key, cfg.Identity, cfg.LeaseDuration)
+	case "kubernetes":
+		client, err := kube.InCluster(kubeConfig.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		lock = newKubeLease(client, cfg.Key, cfg.Identity, cfg.LeaseDuration)
+	default:
+		return nil, fmt.Errorf("unsupported leader election backend: %s", cfg.Backend)
+	}
+	return newElector(lock, cfg.Identity, cfg.LeaseDuration, cfg.RenewInterval), nil
+}
+
+func newElector(lock locker, identity string, leaseDuration, renewInterval time.Duration) *Elector {
+	return &Elector{
+		lock:          lock,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		renewInterval: renewInterval,
+	}
+}
+
+// IsLeader reports whether this replica currently holds the lease
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Run campaigns for leadership until ctx is cancelled. Each time the lease is acquired, lead is
+// called with a context that is cancelled when the lease is lost or ctx ends; the lease is
+// released once lead returns.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) error {
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := e.lock.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.Component("leader").Warn("Failed to acquire leader lease", "identity", e.identity, "error", err)
+		}
+		if acquired {
+			e.lead(ctx, ticker, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead runs the work while renewing the lease, then releases it
+func (e *Elector) lead(ctx context.Context, ticker *time.Ticker, lead func(ctx context.Context)) {
+	logger := logging.Component("leader")
+	logger.Info("Acquired leadership", "identity", e.identity)
+	e.leading.Store(true)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer crash.Recover()
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	// Transient errors are retried until the lease could expire before the next attempt
+	renewed := time.Now()
+	for stepDown := false; !stepDown; {
+		select {
+		case <-done:
+			stepDown = true
+		case <-ticker.C:
+			ok, err := e.lock.renew(leadCtx)
+			switch {
+			case ok:
+				renewed = time.Now()
+			case err == nil:
+				logger.Warn("Leader lease taken by another replica", "identity", e.identity)
+				stepDown = true
+			case time.Since(renewed)+e.renewInterval >= e.leaseDuration:
+				logger.Warn("Failed to renew leader lease, stepping down", "identity", e.identity, "error", err)
+				stepDown = true
+			default:
+				logger.Warn("Failed to renew leader lease", "identity", e.identity, "error", err)
+			}
+		}
+	}
+
+	e.leading.Store(false)
+	cancel()
+	<-done
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), e.renewInterval)
+	defer cancelRelease()
+	if err := e.lock.release(releaseCtx); err != nil {
+		logger.Warn("Failed to release leader lease", "identity", e.identity, "error", err)
+	}
+	logger.Info("Released leadership", "identity", e.identity)
+}
+
+// Handoff wraps lead so a new leader resumes from the checkpoint its predecessor saved
+// and saves its own progress before the lease is released. Progress is not saved once the
+// lease was lost: another replica may already lead and save its own, which a backend
+// without revision checks would let this save overwrite. A manager that supports it is
+// put back on standby then (see state.Standby), so its periodic saves stop too; it should
+// start on standby so a replica saves nothing before it first leads.
+func (e *Elector) Handoff(manager state.StateManager, lead func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		logger := logging.Component("leader")
+		if reloader, ok := manager.(state.Reloader); ok {
+			if err := reloader.Reload(); err != nil {
+				logger.Error("Failed to load checkpoint on takeover", "error", err)
+				return
+			}
+		}
+		standby, _ := manager.(state.Standby)
+		if standby != nil {
+			standby.SetStandby(false)
+		}
+
+		lead(ctx)
+
+		if !e.IsLeader() {
+			logger.Warn("Leader lease lost, not saving checkpoint", "identity", e.identity)
+			if standby != nil {
+				standby.SetStandby(true)
+			}
+			return
+		}
+		if err := manager.Save(); err != nil {
+			logger.Error("Failed to save checkpoint on handoff", "error", err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// fakeLease is a lease shared by the fake locks of several replicas
+type fakeLease struct {
+	mu     sync.Mutex
+	holder string
+	fail   bool // Simulate an unreachable backend
+}
+
+type fakeLock struct {
+	lease    *fakeLease
+	identity string
+}
+
+func (l *fakeLock) acquire(ctx context.Context) (bool, error) {
+	l.lease.mu.Lock()
+	defer l.lease.mu.Unlock()
+	if l.lease.fail {
+		return false, errors.New("backend unavailable")
+	}
+	if l.lease.holder == "" {
+		l.lease.holder = l.identity
+	}
+	return l.lease.holder == l.identity, nil
+}
+
+func (l *fakeLock) renew(ctx context.Context) (bool, error) {
+	l.lease.mu.Lock()
+	defer l.lease.mu.Unlock()
+	if l.lease.fail {
+		return false, errors.New("backend unavailable")
+	}
+	return l.lease.holder == l.identity, nil
+}
+
+func (l *fakeLock) release(ctx context.Context) error {
+	l.lease.mu.Lock()
+	defer l.lease.mu.Unlock()
+	if l.lease.holder == l.identity {
+		l.lease.holder = ""
+	}
+	return nil
+}
+
+func newTestElector(lease *fakeLease, identity string) *Elector {
+	return newElector(&fakeLock{lease: lease, identity: identity}, identity, 50*time.Millisecond, 10*time.Millisecond)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElector_Failover(t *testing.T) {
+	lease := &fakeLease{}
+	primary := newTestElector(lease, "replica-a")
+	standby := newTestElector(lease, "replica-b")
+
+	var mu sync.Mutex
+	var leaders []string
+	work := func(identity string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			mu.Lock()
+			leaders = append(leaders, identity)
+			mu.Unlock()
+			<-ctx.Done()
+		}
+	}
+
+	primaryCtx, stopPrimary := context.WithCancel(context.Background())
+	primaryDone := make(chan struct{})
+	go func() {
+		defer close(primaryDone)
+		primary.Run(primaryCtx, work("replica-a"))
+	}()
+	waitFor(t, "primary to lead", primary.IsLeader)
+
+	standbyCtx, stopStandby := context.WithCancel(context.Background())
+	defer stopStandby()
+	go standby.Run(standbyCtx, work("replica-b"))
+
+	time.Sleep(50 * time.Millisecond)
+	if standby.IsLeader() {
+		t.Fatal("Expected standby not to lead while primary holds the lease")
+	}
+
+	// Primary shuts down and releases the lease; the standby takes over
+	stopPrimary()
+	<-primaryDone
+	if primary.IsLeader() {
+		t.Error("Expected primary to step down after shutdown")
+	}
+	waitFor(t, "standby to take over", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(leaders) == 2
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !standby.IsLeader() || leaders[0] != "replica-a" || leaders[1] != "replica-b" {
+		t.Errorf("Expected replica-a then replica-b to lead, got %v", leaders)
+	}
+}
+
+func TestElector_StepsDownWhenLeaseLost(t *testing.T) {
+	lease := &fakeLease{}
+	elector := newTestElector(lease, "replica-a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go elector.Run(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	waitFor(t, "elector to lead", elector.IsLeader)
+
+	// Another replica took the lease (e.g. after a network partition outlasted the TTL)
+	lease.mu.Lock()
+	lease.holder = "replica-b"
+	lease.mu.Unlock()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected work to be cancelled after losing the lease")
+	}
+	waitFor(t, "elector to step down", func() bool { return !elector.IsLeader() })
+}
+
+func TestElector_StepsDownWhenRenewalKeepsFailing(t *testing.T) {
+	lease := &fakeLease{}
+	elector := newTestElector(lease, "replica-a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go elector.Run(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	waitFor(t, "elector to lead", elector.IsLeader)
+
+	lease.mu.Lock()
+	lease.fail = true
+	lease.mu.Unlock()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected work to be cancelled when the lease cannot be renewed")
+	}
+	if elector.IsLeader() {
+		t.Error("Expected elector to step down")
+	}
+}
+
+// reloadingState records Reload, Save and SetStandby calls
+type reloadingState struct {
+	state.StateManager
+	calls []string
+}
+
+func (s *reloadingState) Reload() error {
+	s.calls = append(s.calls, "reload")
+	return nil
+}
+
+func (s *reloadingState) Save() error {
+	s.calls = append(s.calls, "save")
+	return nil
+}
+
+func (s *reloadingState) SetStandby(standby bool) {
+	if standby {
+		s.calls = append(s.calls, "standby")
+	} else {
+		s.calls = append(s.calls, "active")
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	manager := &reloadingState{}
+	e := newTestElector(&fakeLease{}, "replica-a")
+	e.leading.Store(true)
+	lead := e.Handoff(manager, func(ctx context.Context) {
+		manager.calls = append(manager.calls, "lead")
+	})
+	lead(context.Background())
+
+	if strings.Join(manager.calls, ",") != "reload,active,lead,save" {
+		t.Errorf("Expected reload, active, lead, save, got %v", manager.calls)
+	}
+}
+
+func TestHandoff_LeaseLost(t *testing.T) {
+	lease := &fakeLease{}
+	a := newTestElector(lease, "replica-a")
+	manager := &reloadingState{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Run(ctx, a.Handoff(manager, func(lead context.Context) {
+			// Another replica takes the lease while this one leads
+			lease.mu.Lock()
+			lease.holder = "replica-b"
+			lease.mu.Unlock()
+			<-lead.Done()
+			cancel()
+		}))
+	}()
+	<-done
+
+	if strings.Join(manager.calls, ",") != "reload,active,standby" {
+		t.Errorf("Expected standby without a save after losing the lease, got %v", manager.calls)
+	}
+}
@@ -0,0 +1,67 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Scripts compare the holder before touching the key so a replica never extends or deletes another's lease
+var (
+	renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// redisLock is a lease stored as a Redis key with a TTL whose value is the holder identity
+type redisLock struct {
+	client   *redis.Client
+	key      string
+	identity string
+	ttl      time.Duration
+}
+
+func newRedisLock(redisConfig config.RedisConfig, key, identity string, ttl time.Duration) *redisLock {
+	return &redisLock{
+		client: redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", redisConfig.Host, redisConfig.Port),
+			Password: redisConfig.Password,
+			DB:       redisConfig.Database,
+		}),
+		key:      key,
+		identity: identity,
+		ttl:      ttl,
+	}
+}
+
+func (l *redisLock) acquire(ctx context.Context) (bool, error) {
+	ok, err := l.client.SetNX(ctx, l.key, l.identity, l.ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	// Still ours after a restart within the TTL
+	return l.renew(ctx)
+}
+
+func (l *redisLock) renew(ctx context.Context) (bool, error) {
+	n, err := renewScript.Run(ctx, l.client, []string{l.key}, l.identity, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (l *redisLock) release(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.client, []string{l.key}, l.identity).Err()
+}
@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// componentLevel is the level of a component logger: its own level if configured, or else
+// the level of the logger it was derived from
+type componentLevel struct {
+	root  *slog.LevelVar
+	level slog.LevelVar
+	set   atomic.Bool
+}
+
+// Level returns the component's level
+func (c *componentLevel) Level() slog.Level {
+	if c.set.Load() {
+		return c.level.Level()
+	}
+	return c.root.Level()
+}
+
+// components holds the per-component levels shared by a logger and the loggers derived
+// from it
+type components struct {
+	mu      sync.Mutex
+	levels  map[string]*componentLevel
+	loggers map[string]*Logger // Cached by Component
+}
+
+// newComponents returns an empty registry
+func newComponents() *components {
+	return &components{
+		levels:  make(map[string]*componentLevel),
+		loggers: make(map[string]*Logger),
+	}
+}
+
+// level returns the level of a component, creating it if needed
+func (c *components) level(name string, root *slog.LevelVar) *componentLevel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl := c.levels[name]
+	if cl == nil {
+		cl = &componentLevel{root: root}
+		c.levels[name] = cl
+	}
+	return cl
+}
+
+// Component returns a child logger for a subsystem (e.g. "scanner" or "http_sender"). Its
+// records carry a component attribute, and it logs at the component's level from
+// SetComponentLevels, or at this logger's level if the component has none.
+func (l *Logger) Component(name string) *Logger {
+	level := l.components.level(name, l.level)
+	handler := l.Handler().WithAttrs([]slog.Attr{slog.String("component", name)})
+	return &Logger{
+		Logger:     slog.New(withLevel(handler, level)),
+		level:      l.level,
+		configured: l.configured,
+		out:        l.out,
+		sampler:    l.sampler,
+		otlp:       l.otlp,
+		components: l.components,
+	}
+}
+
+// SetComponentLevels sets the level of each named component (debug, info, warn or error), for
+// the component loggers of this logger and every logger derived from it. Components not
+// listed follow the logger's level again.
+func (l *Logger) SetComponentLevels(levels map[string]string) error {
+	parsed := make(map[string]slog.Level, len(levels))
+	for name, levelName := range levels {
+		level, ok := parseLevel(levelName)
+		if !ok {
+			return fmt.Errorf("invalid log level %q for component %s: must be one of debug, info, warn, error", levelName, name)
+		}
+		parsed[name] = level
+	}
+
+	for name := range parsed {
+		l.components.level(name, l.level)
+	}
+	l.components.mu.Lock()
+	defer l.components.mu.Unlock()
+	for name, cl := range l.components.levels {
+		level, ok := parsed[name]
+		if ok {
+			cl.level.Set(level)
+		}
+		cl.set.Store(ok)
+	}
+	return nil
+}
+
+// Component returns the global logger's child logger for a subsystem (see Logger.Component)
+func Component(name string) *Logger {
+	logger := GetDefaultLogger()
+	logger.components.mu.Lock()
+	child := logger.components.loggers[name]
+	logger.components.mu.Unlock()
+	if child != nil {
+		return child
+	}
+
+	child = logger.Component(name)
+	logger.components.mu.Lock()
+	defer logger.components.mu.Unlock()
+	if cached := logger.components.loggers[name]; cached != nil {
+		return cached
+	}
+	logger.components.loggers[name] = child
+	return child
+}
+
+// leveler is implemented by the handlers of a logger, which pass a component's level down to
+// the leveledHandler
+type leveler interface {
+	withLevel(level slog.Leveler) slog.Handler
+}
+
+// withLevel returns h filtering records by level instead of the logger's level
+func withLevel(h slog.Handler, level slog.Leveler) slog.Handler {
+	if l, ok := h.(leveler); ok {
+		return l.withLevel(level)
+	}
+	return h
+}
+
+// leveledHandler drops records below level. It replaces the level of the console or file
+// handler so that component loggers can log below or above the logger's level.
+type leveledHandler struct {
+	next  slog.Handler
+	level slog.Leveler
+}
+
+// Enabled reports whether level is at or above the handler's level
+func (h *leveledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle passes r on
+func (h *leveledHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler with attrs and the same level
+func (h *leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &leveledHandler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+// WithGroup returns a handler with the group and the same level
+func (h *leveledHandler) WithGroup(name string) slog.Handler {
+	return &leveledHandler{next: h.next.WithGroup(name), level: h.level}
+}
+
+// withLevel returns a handler with another level
+func (h *leveledHandler) withLevel(level slog.Leveler) slog.Handler {
+	return &leveledHandler{next: h.next, level: level}
+}
+
+// withLevel changes the level of the console or file output only; the OTLP level is fixed
+func (h *teeHandler) withLevel(level slog.Leveler) slog.Handler {
+	return &teeHandler{primary: withLevel(h.primary, level), otlp: h.otlp}
+}
+
+// withLevel returns a handler sharing the sampler
+func (h *samplingHandler) withLevel(level slog.Leveler) slog.Handler {
+	return &samplingHandler{next: withLevel(h.next, level), sampler: h.sampler}
+}
@@ -1,54 +1,210 @@
 package logging
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // Logger wraps slog.Logger with convenience methods
 type Logger struct {
 	*slog.Logger
+	level      *slog.LevelVar // Shared with loggers derived by With and WithGroup
+	configured slog.Level     // Level from the configuration, restored by ToggleDebug
+	out        *output        // Shared with loggers derived by With and WithGroup
+	sampler    *sampler       // nil unless sampling repeated messages
+	otlp       *otlpExporter  // nil unless exporting over OTLP
+	components *components    // Per-component levels, shared with derived loggers
 }
 
 // Config holds logging configuration
 type Config struct {
-	Level  string `yaml:"level"`  // debug, info, warn, error
-	Format string `yaml:"format"` // json, text
+	Level       string            `yaml:"level"`        // debug, info, warn, error
+	Format      string            `yaml:"format"`       // json, text
+	Output      string            `yaml:"output"`       // stdout, file or both (default: stdout)
+	File        FileConfig        `yaml:"file"`         // Log file, for file and both output
+	Sampling    SamplingConfig    `yaml:"sampling"`     // Suppression of repeated warnings and errors (off when unset)
+	Levels      map[string]string `yaml:"levels"`       // Level by component, e.g. {scanner: debug} (see Logger.Component)
+	AddSource   bool              `yaml:"add_source"`   // Add the file:line of the logging call to each record
+	StackTraces bool              `yaml:"stack_traces"` // Add the caller's stack trace to error records
+
+	Writer io.Writer    `yaml:"-"` // Used instead of stdout, e.g. a buffer in tests (optional)
+	OTLP   *OTLPOptions `yaml:"-"` // Also export records to an OTLP collector (optional)
+}
+
+// FileConfig holds the log file settings. The file is rotated by size.
+type FileConfig struct {
+	Path       string `yaml:"path"`         // Log file path (required for file output)
+	MaxSizeMB  int    `yaml:"max_size_mb"`  // Size that triggers a rotation (default: 100)
+	MaxBackups int    `yaml:"max_backups"`  // Rotated files kept (0 = all)
+	MaxAgeDays int    `yaml:"max_age_days"` // Days rotated files are kept (0 = no limit)
+	Compress   bool   `yaml:"compress"`     // Gzip rotated files
+}
+
+// output is the destination of a logger and the loggers derived from it, which SetOutput
+// swaps
+type output struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *lumberjack.Logger // nil unless logging to a file
+}
+
+// Write writes a log record to the current destination
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Write(p)
 }
 
-// NewLogger creates a new configured logger
+// NewLogger creates a new configured logger. If the log file or the OTLP exporter cannot be
+// opened, or a component level is invalid, it logs the error and writes to stdout only at the
+// configured level instead (see OpenLogger).
 func NewLogger(config Config) *Logger {
-	var level slog.Level
-	switch strings.ToLower(config.Level) {
-	case "debug":
-		level = slog.LevelDebug
-	case "info":
-		level = slog.LevelInfo
-	case "warn", "warning":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
+	logger, err := OpenLogger(config)
+	if err != nil {
+		config.Output = "stdout"
+		config.OTLP = nil
+		config.Levels = nil
+		logger, _ = OpenLogger(config)
+		logger.Error("Failed to configure logging; logging to stdout", "path", config.File.Path, "error", err)
+	}
+	return logger
+}
+
+// OpenLogger creates a new configured logger, opening the log file for file and both output
+// and connecting the OTLP exporter if configured
+func OpenLogger(config Config) (*Logger, error) {
+	level, ok := parseLevel(config.Level)
+	if !ok {
 		level = slog.LevelInfo
 	}
+	levelVar := &slog.LevelVar{}
+	levelVar.Set(level)
+
+	out, err := openOutput(config)
+	if err != nil {
+		return nil, err
+	}
 
+	// The level is checked by leveledHandler, which component loggers replace
 	var handler slog.Handler
 	opts := &slog.HandlerOptions{
-		Level: level,
+		Level:     slog.Level(math.MinInt),
+		AddSource: config.AddSource,
 	}
 
 	switch strings.ToLower(config.Format) {
 	case "json":
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	default:
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(out, opts)
 	}
+	handler = &leveledHandler{next: handler, level: levelVar}
 
-	return &Logger{
-		Logger: slog.New(handler),
+	var exporter *otlpExporter
+	if config.OTLP != nil {
+		exporter, err = newOTLPExporter(*config.OTLP, handler)
+		if err != nil {
+			if out.file != nil {
+				out.file.Close()
+			}
+			return nil, err
+		}
+		handler = &teeHandler{primary: handler, otlp: &otlpHandler{exporter: exporter, addSource: config.AddSource}}
+	}
+
+	sampler := newSampler(config.Sampling)
+	if sampler != nil {
+		handler = &samplingHandler{next: handler, sampler: sampler}
+	}
+	if config.StackTraces {
+		handler = &stackHandler{next: handler}
+	}
+
+	logger := &Logger{
+		Logger:     slog.New(handler),
+		level:      levelVar,
+		configured: level,
+		out:        out,
+		sampler:    sampler,
+		otlp:       exporter,
+		components: newComponents(),
+	}
+	if err := logger.SetComponentLevels(config.Levels); err != nil {
+		logger.Close()
+		return nil, err
 	}
+	return logger, nil
+}
+
+// openOutput opens the configured destination: stdout, the rotating log file, or both
+func openOutput(config Config) (*output, error) {
+	switch strings.ToLower(config.Output) {
+	case "", "stdout":
+		return &output{w: console(config)}, nil
+	case "file", "both":
+	default:
+		return nil, fmt.Errorf("invalid log output %q: must be one of stdout, file, both", config.Output)
+	}
+
+	if config.File.Path == "" {
+		return nil, errors.New("log file path is required for file output")
+	}
+	if err := os.MkdirAll(filepath.Dir(config.File.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file := &lumberjack.Logger{
+		Filename:   config.File.Path,
+		MaxSize:    config.File.MaxSizeMB,  // megabytes
+		MaxBackups: config.File.MaxBackups, // keep N old files
+		MaxAge:     config.File.MaxAgeDays, // days
+		Compress:   config.File.Compress,   // compress rotated files
+		LocalTime:  true,                   // use local time for filenames
+	}
+	// lumberjack opens the file on the first write; open it now so a bad path fails here
+	if _, err := file.Write(nil); err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	out := &output{w: file, file: file}
+	if strings.EqualFold(config.Output, "both") {
+		out.w = io.MultiWriter(console(config), file)
+	}
+	return out, nil
+}
+
+// console returns the stdout destination: Config.Writer, or os.Stdout
+func console(config Config) io.Writer {
+	if config.Writer != nil {
+		return config.Writer
+	}
+	return os.Stdout
+}
+
+// parseLevel parses a configured level name
+func parseLevel(name string) (slog.Level, bool) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
 }
 
 // NewDefaultLogger creates a logger with default settings
@@ -62,21 +218,83 @@ func NewDefaultLogger() *Logger {
 // With creates a new logger with additional context
 func (l *Logger) With(args ...any) *Logger {
 	return &Logger{
-		Logger: l.Logger.With(args...),
+		Logger:     l.Logger.With(args...),
+		level:      l.level,
+		configured: l.configured,
+		out:        l.out,
+		sampler:    l.sampler,
+		otlp:       l.otlp,
+		components: l.components,
 	}
 }
 
 // WithGroup creates a new logger with a group
 func (l *Logger) WithGroup(name string) *Logger {
 	return &Logger{
-		Logger: l.Logger.WithGroup(name),
+		Logger:     l.Logger.WithGroup(name),
+		level:      l.level,
+		configured: l.configured,
+		out:        l.out,
+		sampler:    l.sampler,
+		otlp:       l.otlp,
+		components: l.components,
 	}
 }
 
-// SetOutput changes the output destination
+// SetLevel changes the level at runtime (debug, info, warn or error), for this logger and
+// every logger derived from it, except components with their own level
+func (l *Logger) SetLevel(name string) error {
+	level, ok := parseLevel(name)
+	if !ok {
+		return fmt.Errorf("invalid log level %q: must be one of debug, info, warn, error", name)
+	}
+	l.level.Set(level)
+	return nil
+}
+
+// Level returns the current level name in lower case (e.g. "info")
+func (l *Logger) Level() string {
+	return strings.ToLower(l.level.Level().String())
+}
+
+// ToggleDebug switches to debug or, if already at debug, back to the configured level
+// (info when debug is configured). It returns the new level name.
+func (l *Logger) ToggleDebug() string {
+	if l.level.Level() != slog.LevelDebug {
+		l.level.Set(slog.LevelDebug)
+	} else if l.configured != slog.LevelDebug {
+		l.level.Set(l.configured)
+	} else {
+		l.level.Set(slog.LevelInfo)
+	}
+	return l.Level()
+}
+
+// SetOutput changes the output destination, for this logger and every logger derived from
+// it, e.g. to capture logs in a test. Records keep the configured format. A log file in use is
+// no longer written but is left open; see Close.
 func (l *Logger) SetOutput(w io.Writer) {
-	// This is a simplified implementation - in a real scenario,
-	// you'd need to recreate the handler with the new writer
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w = w
+}
+
+// Close reports the repeated messages suppressed so far, exports the records queued for OTLP
+// and closes the log file, if any. Call it at shutdown, after the last log record.
+func (l *Logger) Close() error {
+	if l.sampler != nil {
+		l.sampler.flush()
+	}
+	var err error
+	if l.otlp != nil {
+		err = l.otlp.Shutdown()
+	}
+	if l.out.file == nil {
+		return err
+	}
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return errors.Join(err, l.out.file.Close())
 }
 
 // Global logger instance
@@ -97,17 +315,31 @@ func GetDefaultLogger() *Logger {
 
 // Convenience functions for global logger
 func Debug(msg string, args ...any) {
-	GetDefaultLogger().Debug(msg, args...)
+	log(slog.LevelDebug, msg, args...)
 }
 
 func Info(msg string, args ...any) {
-	GetDefaultLogger().Info(msg, args...)
+	log(slog.LevelInfo, msg, args...)
 }
 
 func Warn(msg string, args ...any) {
-	GetDefaultLogger().Warn(msg, args...)
+	log(slog.LevelWarn, msg, args...)
 }
 
 func Error(msg string, args ...any) {
-	GetDefaultLogger().Error(msg, args...)
+	log(slog.LevelError, msg, args...)
+}
+
+// log logs through the global logger with the source of the convenience function's caller
+func log(level slog.Level, msg string, args ...any) {
+	logger := GetDefaultLogger()
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // Skip Callers, log and the convenience function
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	logger.Handler().Handle(ctx, r)
 }
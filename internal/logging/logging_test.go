@@ -2,7 +2,11 @@ package logging
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewLogger_TextFormat(t *testing.T) {
@@ -131,10 +135,267 @@ func TestConvenienceFunctions(t *testing.T) {
 
 func TestSetOutput(t *testing.T) {
 	logger := NewDefaultLogger()
+	derived := logger.With("component", "test")
 
-	// Create a buffer to capture output
 	var buf bytes.Buffer
-
-	// This is a no-op in the current implementation, but should not panic
 	logger.SetOutput(&buf)
+	derived.Info("redirected")
+	if !strings.Contains(buf.String(), "redirected") || !strings.Contains(buf.String(), "component=test") {
+		t.Errorf("Expected derived loggers to follow SetOutput, got %q", buf.String())
+	}
+}
+
+func TestNewLogger_Writer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(Config{Level: "info", Format: "json", Writer: &buf})
+	logger.Info("captured", "key", "value")
+	if !strings.Contains(buf.String(), `"msg":"captured","key":"value"`) {
+		t.Errorf("Expected a JSON record in the writer, got %q", buf.String())
+	}
+}
+
+func TestOpenLogger_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "streamer.log")
+	logger, err := OpenLogger(Config{Level: "info", Format: "json", Output: "file", File: FileConfig{Path: path, MaxSizeMB: 1}})
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+	logger.Info("to file", "key", "value")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(data), `"msg":"to file"`) {
+		t.Errorf("Expected the record in the log file, got %q", data)
+	}
+}
+
+func TestOpenLogger_Both(t *testing.T) {
+	var buf bytes.Buffer
+	path := filepath.Join(t.TempDir(), "streamer.log")
+	logger, err := OpenLogger(Config{Format: "text", Output: "both", File: FileConfig{Path: path}, Writer: &buf})
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+	defer logger.Close()
+	logger.Info("to both")
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(buf.String(), "to both") || !strings.Contains(string(data), "to both") {
+		t.Errorf("Expected the record in the writer and the file, got %q and %q", buf.String(), data)
+	}
+}
+
+func TestOpenLogger_Errors(t *testing.T) {
+	if _, err := OpenLogger(Config{Output: "file"}); err == nil {
+		t.Error("Expected an error for file output without a path")
+	}
+	if _, err := OpenLogger(Config{Output: "syslog"}); err == nil {
+		t.Error("Expected an error for an unknown output")
+	}
+
+	// NewLogger falls back to stdout
+	blocked := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocked, nil, 0o644)
+	if logger := NewLogger(Config{Output: "both", File: FileConfig{Path: filepath.Join(blocked, "streamer.log")}}); logger.out.file != nil {
+		t.Error("Expected NewLogger to fall back to stdout when the log file cannot be opened")
+	}
+}
+
+func TestLogger_SetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(Config{Level: "info", Format: "text", Writer: &buf})
+	derived := logger.With("component", "test")
+
+	derived.Debug("hidden")
+	if err := logger.SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	derived.Debug("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Expected only the debug line after SetLevel, got %q", buf.String())
+	}
+
+	if err := logger.SetLevel("verbose"); err == nil {
+		t.Error("Expected an error for an invalid level")
+	}
+	if logger.Level() != "debug" {
+		t.Errorf("Expected debug, got %s", logger.Level())
+	}
+}
+
+func TestLogger_ToggleDebug(t *testing.T) {
+	logger := NewLogger(Config{Level: "warn"})
+	if level := logger.ToggleDebug(); level != "debug" {
+		t.Errorf("Expected debug, got %s", level)
+	}
+	if level := logger.ToggleDebug(); level != "warn" {
+		t.Errorf("Expected the configured warn level back, got %s", level)
+	}
+
+	logger = NewLogger(Config{Level: "debug"})
+	if level := logger.ToggleDebug(); level != "info" {
+		t.Errorf("Expected info when debug is configured, got %s", level)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(Config{Format: "text", Writer: &buf, Sampling: SamplingConfig{Window: 200 * time.Millisecond, Burst: 2}})
+	derived := logger.With("component", "sender")
+	for i := 0; i < 10; i++ {
+		derived.Error("HTTP worker failed to send batch", "attempt", i)
+		logger.Info("Processed file")
+	}
+	logger.Warn("Retrying HTTP batch")
+
+	// Summaries are written by a timer
+	read := func() string {
+		logger.out.mu.Lock()
+		defer logger.out.mu.Unlock()
+		return buf.String()
+	}
+	out := read()
+	if n := strings.Count(out, `msg="HTTP worker failed to send batch"`); n != 2 {
+		t.Errorf("Expected 2 of the repeated errors, got %d:\n%s", n, out)
+	}
+	if n := strings.Count(out, "Processed file"); n != 10 {
+		t.Errorf("Expected info messages not to be sampled, got %d", n)
+	}
+	if !strings.Contains(out, "Retrying HTTP batch") {
+		t.Error("Expected a different message to be logged")
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	out = read()
+	if !strings.Contains(out, `msg="Suppressed 8 similar messages" component=sender message="HTTP worker failed to send batch" suppressed=8 window=200ms`) {
+		t.Errorf("Expected a summary of the suppressed messages, got:\n%s", out)
+	}
+
+	derived.Error("HTTP worker failed to send batch")
+	if n := strings.Count(read(), `msg="HTTP worker failed to send batch"`); n != 3 {
+		t.Errorf("Expected a new window to log again, got:\n%s", read())
+	}
+}
+
+func TestSampling_FlushOnClose(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(Config{Format: "text", Writer: &buf, Sampling: SamplingConfig{Window: time.Hour, Burst: 1}})
+	logger.Error("Endpoint down")
+	logger.Error("Endpoint down")
+	logger.Close()
+	if !strings.Contains(buf.String(), "Suppressed 1 similar messages") {
+		t.Errorf("Expected Close to report suppressed messages, got:\n%s", buf.String())
+	}
+}
+
+func TestLogger_Component(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := OpenLogger(Config{
+		Level:  "info",
+		Format: "json",
+		Writer: &buf,
+		Levels: map[string]string{"scanner": "debug", "http_sender": "warn"},
+	})
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+
+	logger.Debug("root debug")
+	logger.Component("scanner").Debug("scanner debug")
+	logger.Component("http_sender").Info("sender info")
+	logger.Component("http_sender").Warn("sender warn")
+	logger.Component("worker").Info("worker info")
+	logger.Component("worker").Debug("worker debug")
+
+	output := buf.String()
+	for _, msg := range []string{"scanner debug", "sender warn", "worker info"} {
+		if !strings.Contains(output, msg) {
+			t.Errorf("Expected %q in the output, got %s", msg, output)
+		}
+	}
+	for _, msg := range []string{"root debug", "sender info", "worker debug"} {
+		if strings.Contains(output, msg) {
+			t.Errorf("Expected %q to be filtered, got %s", msg, output)
+		}
+	}
+	if !strings.Contains(output, `"component":"scanner"`) {
+		t.Errorf("Expected the component attribute, got %s", output)
+	}
+
+	// Components without their own level follow the logger's level
+	buf.Reset()
+	logger.SetLevel("debug")
+	logger.Component("worker").Debug("worker debug")
+	logger.Component("http_sender").Info("sender info")
+	if !strings.Contains(buf.String(), "worker debug") || strings.Contains(buf.String(), "sender info") {
+		t.Errorf("Expected worker to follow the logger and http_sender to keep warn, got %s", buf.String())
+	}
+
+	// Removing a component's level makes it follow the logger again
+	buf.Reset()
+	if err := logger.SetComponentLevels(nil); err != nil {
+		t.Fatalf("SetComponentLevels failed: %v", err)
+	}
+	logger.Component("http_sender").Info("sender info")
+	if !strings.Contains(buf.String(), "sender info") {
+		t.Errorf("Expected http_sender to follow the logger, got %s", buf.String())
+	}
+
+	if err := logger.SetComponentLevels(map[string]string{"scanner": "trace"}); err == nil {
+		t.Error("Expected an error for an invalid component level")
+	}
+}
+
+func TestLogger_AddSource(t *testing.T) {
+	var buf bytes.Buffer
+	InitDefaultLogger(Config{Level: "info", Format: "json", Writer: &buf, AddSource: true})
+	defer InitDefaultLogger(Config{Level: "info", Format: "text"})
+
+	GetDefaultLogger().Info("from the logger")
+	Info("from the convenience function")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %s", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"source":{`) || !strings.Contains(line, "logging_test.go") {
+			t.Errorf("Expected the test file as the source, got %s", line)
+		}
+	}
+}
+
+func TestLogger_StackTraces(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := OpenLogger(Config{Level: "info", Format: "json", Writer: &buf, StackTraces: true})
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+
+	logger.Warn("warning")
+	if strings.Contains(buf.String(), `"stack"`) {
+		t.Errorf("Expected no stack on warnings, got %s", buf.String())
+	}
+
+	buf.Reset()
+	logger.Component("worker").Error("failure")
+	stack := buf.String()
+	if !strings.Contains(stack, `"stack":"`) || !strings.Contains(stack, "TestLogger_StackTraces") {
+		t.Errorf("Expected the caller's stack, got %s", stack)
+	}
+	if strings.Contains(stack, "log/slog.") || strings.Contains(stack, "stackHandler") {
+		t.Errorf("Expected the logging frames to be left out, got %s", stack)
+	}
+
+	// A stack already attached, e.g. by panic recovery, is kept
+	buf.Reset()
+	logger.Error("recovered", "stack", "goroutine 1")
+	if n := strings.Count(buf.String(), `"stack"`); n != 1 || !strings.Contains(buf.String(), `"stack":"goroutine 1"`) {
+		t.Errorf("Expected the given stack only, got %s", buf.String())
+	}
 }
@@ -0,0 +1,470 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo"
+)
+
+// otlpLogsPath is where OTLP/HTTP collectors receive logs
+const otlpLogsPath = "/v1/logs"
+
+// OTLPOptions exports the streamer's own log records to an OTLP collector, next to the
+// console or file output
+type OTLPOptions struct {
+	Endpoint string            // host:port, or a URL for the http protocol (path defaults to /v1/logs)
+	Protocol string            // grpc (default) or http (protobuf over HTTP)
+	Insecure bool              // Plain-text connection
+	Headers  map[string]string // Sent with every export, e.g. an API key
+	TLS      *tls.Config       // TLS settings (nil for the system defaults)
+
+	ServiceName    string // service.name resource attribute
+	ServiceVersion string // service.version resource attribute (default: the build version)
+	Level          string // Minimum level exported: debug, info, warn or error (default: info)
+
+	BatchSize     int           // Records per export (default: 512)
+	FlushInterval time.Duration // Longest a record waits for its batch (default: 5s)
+	QueueSize     int           // Records waiting for export; newer ones are dropped when full (default: 4096)
+}
+
+// otlpExporter batches log records and sends them to the collector in the background.
+// Failures are reported through report, the console or file handler, and never exported.
+type otlpExporter struct {
+	opts   OTLPOptions
+	level  slog.Level
+	send   func(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error
+	close  func() error
+	report slog.Handler
+
+	resource *resourcepb.Resource
+	queue    chan *logspb.LogRecord
+	dropped  atomic.Int64
+	flush    chan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	failing  bool // Whether the last export failed (exporter goroutine only)
+}
+
+// newOTLPExporter connects to the collector and starts exporting
+func newOTLPExporter(opts OTLPOptions, report slog.Handler) (*otlpExporter, error) {
+	if opts.Endpoint == "" {
+		return nil, fmt.Errorf("OTLP log export requires an endpoint")
+	}
+	level, ok := parseLevel(opts.Level)
+	if !ok && opts.Level != "" {
+		return nil, fmt.Errorf("invalid OTLP log level %q: must be one of debug, info, warn, error", opts.Level)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4096
+	}
+
+	build := buildinfo.Get()
+	if opts.ServiceVersion == "" {
+		opts.ServiceVersion = build.Version
+	}
+	resource := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		stringAttr("service.name", opts.ServiceName),
+		stringAttr("service.version", opts.ServiceVersion),
+		stringAttr("build.version", build.Version),
+	}}
+	if build.Commit != "" {
+		resource.Attributes = append(resource.Attributes, stringAttr("build.commit", build.Commit))
+	}
+	if build.Date != "" {
+		resource.Attributes = append(resource.Attributes, stringAttr("build.date", build.Date))
+	}
+
+	e := &otlpExporter{
+		opts:     opts,
+		level:    level,
+		report:   report,
+		resource: resource,
+		queue:    make(chan *logspb.LogRecord, opts.QueueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	switch opts.Protocol {
+	case "", "grpc":
+		creds := credentials.NewTLS(opts.TLS)
+		if opts.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.NewClient(opts.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP log exporter: %w", err)
+		}
+		client := collogspb.NewLogsServiceClient(conn)
+		e.send = func(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+			if len(opts.Headers) > 0 {
+				ctx = metadata.NewOutgoingContext(ctx, metadata.New(opts.Headers))
+			}
+			_, err := client.Export(ctx, req)
+			return err
+		}
+		e.close = conn.Close
+	case "http":
+		target, err := otlpLogsURL(opts.Endpoint, opts.Insecure)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if opts.TLS != nil {
+			transport.TLSClientConfig = opts.TLS
+		}
+		client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+		e.send = func(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+			return postLogs(ctx, client, target, opts.Headers, req)
+		}
+		e.close = func() error {
+			client.CloseIdleConnections()
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", opts.Protocol)
+	}
+
+	go e.run()
+	return e, nil
+}
+
+// otlpLogsURL returns the URL logs are posted to
+func otlpLogsURL(endpoint string, useInsecure bool) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		scheme := "https"
+		if useInsecure {
+			scheme = "http"
+		}
+		u, err = url.Parse(scheme + "://" + endpoint)
+		if err != nil {
+			return "", fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+		}
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpLogsPath
+	}
+	return u.String(), nil
+}
+
+// postLogs sends an export request as OTLP protobuf over HTTP
+func postLogs(ctx context.Context, client *http.Client, target string, headers map[string]string, export *collogspb.ExportLogsServiceRequest) error {
+	body, err := proto.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("failed to encode logs: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// enqueue queues a record for export, dropping it if the queue is full so logging never
+// blocks on the collector
+func (e *otlpExporter) enqueue(record *logspb.LogRecord) {
+	select {
+	case e.queue <- record:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// run exports batches until shutdown
+func (e *otlpExporter) run() {
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []*logspb.LogRecord
+	export := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = nil
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case record := <-e.queue:
+				batch = append(batch, record)
+				if len(batch) >= e.opts.BatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case record := <-e.queue:
+			batch = append(batch, record)
+			if len(batch) >= e.opts.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case flushed := <-e.flush:
+			drain()
+			close(flushed)
+		case <-e.done:
+			drain()
+			return
+		}
+	}
+}
+
+// export sends one batch, reporting the first failure of a streak and the recovery
+func (e *otlpExporter) export(batch []*logspb.LogRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := e.send(ctx, &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: "s3-edgedelta-streamer"},
+				LogRecords: batch,
+			}},
+		}},
+	})
+
+	switch {
+	case err != nil && !e.failing:
+		e.failing = true
+		e.reportf(slog.LevelWarn, "Failed to export logs over OTLP; retrying with the next batch",
+			"endpoint", e.opts.Endpoint, "records", len(batch), "error", err)
+	case err == nil && e.failing:
+		e.failing = false
+		e.reportf(slog.LevelInfo, "OTLP log export recovered", "endpoint", e.opts.Endpoint)
+	}
+	if dropped := e.dropped.Swap(0); dropped > 0 {
+		e.reportf(slog.LevelWarn, "Dropped log records; the OTLP export queue was full", "records", dropped)
+	}
+}
+
+// reportf logs a problem of the exporter itself to the console or file output only
+func (e *otlpExporter) reportf(level slog.Level, msg string, args ...any) {
+	if e.report == nil || !e.report.Enabled(context.Background(), level) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	r.Add(args...)
+	e.report.Handle(context.Background(), r)
+}
+
+// Flush exports the queued records
+func (e *otlpExporter) Flush() {
+	flushed := make(chan struct{})
+	select {
+	case e.flush <- flushed:
+		<-flushed
+	case <-e.done:
+	}
+}
+
+// Shutdown exports the queued records and closes the connection
+func (e *otlpExporter) Shutdown() error {
+	var err error
+	e.stopOnce.Do(func() {
+		e.Flush()
+		close(e.done)
+		err = e.close()
+	})
+	return err
+}
+
+// otlpHandler converts records to OTLP log records for the exporter. Groups become dotted
+// attribute names (e.g. "request.method").
+type otlpHandler struct {
+	exporter  *otlpExporter
+	attrs     []*commonpb.KeyValue
+	prefix    string // Open groups, each followed by a dot
+	addSource bool   // Add the code.* attributes of the logging call
+}
+
+// Enabled reports whether level is exported
+func (h *otlpHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.exporter.level
+}
+
+// Handle queues r for export
+func (h *otlpHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(r.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severity(r.Level),
+		SeverityText:         r.Level.String(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: r.Message}},
+		Attributes:           append([]*commonpb.KeyValue{}, h.attrs...),
+	}
+	if h.addSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		record.Attributes = append(record.Attributes,
+			stringAttr("code.function", frame.Function),
+			stringAttr("code.filepath", frame.File),
+			&commonpb.KeyValue{Key: "code.lineno", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(frame.Line)}}})
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		record.Attributes = appendAttr(record.Attributes, h.prefix, a)
+		return true
+	})
+	h.exporter.enqueue(record)
+	return nil
+}
+
+// WithAttrs returns a handler adding attrs to every record
+func (h *otlpHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]*commonpb.KeyValue{}, h.attrs...)
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, h.prefix, a)
+	}
+	return &c
+}
+
+// WithGroup returns a handler nesting later attributes under name
+func (h *otlpHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// severity maps a slog level to an OTLP severity number (Info is INFO, Error is ERROR, and
+// levels in between keep their offset)
+func severity(level slog.Level) logspb.SeverityNumber {
+	n := int(level) + int(logspb.SeverityNumber_SEVERITY_NUMBER_INFO)
+	return logspb.SeverityNumber(min(max(n, 1), 24))
+}
+
+// appendAttr appends a as OTLP attributes, flattening groups
+func appendAttr(kvs []*commonpb.KeyValue, prefix string, a slog.Attr) []*commonpb.KeyValue {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return kvs
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = prefix + a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			kvs = appendAttr(kvs, groupPrefix, ga)
+		}
+		return kvs
+	}
+	return append(kvs, &commonpb.KeyValue{Key: prefix + a.Key, Value: anyValue(a.Value)})
+}
+
+// anyValue converts a resolved slog value
+func anyValue(v slog.Value) *commonpb.AnyValue {
+	switch v.Kind() {
+	case slog.KindString:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.String()}}
+	case slog.KindInt64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.Int64()}}
+	case slog.KindUint64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.Uint64())}}
+	case slog.KindFloat64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.Float64()}}
+	case slog.KindBool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.Bool()}}
+	case slog.KindDuration:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Duration().String()}}
+	case slog.KindTime:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Time().Format(time.RFC3339Nano)}}
+	}
+	if strs, ok := v.Any().([]string); ok {
+		values := make([]*commonpb.AnyValue, len(strs))
+		for i, s := range strs {
+			values[i] = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v.Any())}}
+}
+
+// stringAttr returns a string attribute
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// teeHandler sends records to the console or file handler and to the OTLP handler, each
+// only if it is enabled for the record's level
+type teeHandler struct {
+	primary slog.Handler
+	otlp    slog.Handler
+}
+
+// Enabled reports whether either handler takes level
+func (h *teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.primary.Enabled(ctx, level) || h.otlp.Enabled(ctx, level)
+}
+
+// Handle passes r to the handlers enabled for its level
+func (h *teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.primary.Enabled(ctx, r.Level) {
+		err = h.primary.Handle(ctx, r.Clone())
+	}
+	if h.otlp.Enabled(ctx, r.Level) {
+		h.otlp.Handle(ctx, r)
+	}
+	return err
+}
+
+// WithAttrs returns a tee of both handlers with attrs
+func (h *teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &teeHandler{primary: h.primary.WithAttrs(attrs), otlp: h.otlp.WithAttrs(attrs)}
+}
+
+// WithGroup returns a tee of both handlers with the group
+func (h *teeHandler) WithGroup(name string) slog.Handler {
+	return &teeHandler{primary: h.primary.WithGroup(name), otlp: h.otlp.WithGroup(name)}
+}
@@ -0,0 +1,208 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// attribute returns the value of an OTLP attribute, or nil
+func attribute(kvs []*commonpb.KeyValue, key string) *commonpb.AnyValue {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return nil
+}
+
+func TestOTLPExport_HTTP(t *testing.T) {
+	requests := make(chan *collogspb.ExportLogsServiceRequest, 10)
+	var apiKey, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, path = r.Header.Get("X-Api-Key"), r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		var req collogspb.ExportLogsServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("Failed to decode export: %v", err)
+		}
+		requests <- &req
+	}))
+	defer server.Close()
+
+	var console bytes.Buffer
+	logger, err := OpenLogger(Config{
+		Level:     "debug",
+		Format:    "json",
+		Writer:    &console,
+		AddSource: true,
+		OTLP: &OTLPOptions{
+			Endpoint:    server.URL,
+			Protocol:    "http",
+			Headers:     map[string]string{"X-Api-Key": "secret"},
+			ServiceName: "test-service",
+			Level:       "info",
+		},
+	})
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+	logger.Debug("Not exported")
+	logger.With("worker", 3).WithGroup("file").Warn("Delivery failed", "bytes", 512, "key", "logs/a.gz")
+	if err := logger.Close(); err != nil { // Exports what was queued
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	var req *collogspb.ExportLogsServiceRequest
+	select {
+	case req = <-requests:
+	default:
+		t.Fatal("Expected an export on close")
+	}
+	if apiKey != "secret" || path != "/v1/logs" {
+		t.Errorf("Expected the header and /v1/logs, got %q, %q", apiKey, path)
+	}
+	if v := attribute(req.ResourceLogs[0].Resource.Attributes, "service.name"); v.GetStringValue() != "test-service" {
+		t.Errorf("Expected service.name test-service, got %v", v)
+	}
+	if v := attribute(req.ResourceLogs[0].Resource.Attributes, "build.version"); v.GetStringValue() == "" {
+		t.Error("Expected the build.version resource attribute")
+	}
+
+	records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record above the OTLP level, got %d", len(records))
+	}
+	r := records[0]
+	if r.Body.GetStringValue() != "Delivery failed" || r.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_WARN {
+		t.Errorf("Expected a WARN record \"Delivery failed\", got %v %q", r.SeverityNumber, r.Body.GetStringValue())
+	}
+	if v := attribute(r.Attributes, "worker"); v.GetIntValue() != 3 {
+		t.Errorf("Expected worker 3, got %v", v)
+	}
+	if v := attribute(r.Attributes, "file.key"); v.GetStringValue() != "logs/a.gz" {
+		t.Errorf("Expected the grouped attribute file.key, got %v", v)
+	}
+	if v := attribute(r.Attributes, "code.filepath"); !strings.HasSuffix(v.GetStringValue(), "otlp_test.go") {
+		t.Errorf("Expected the source in code.filepath, got %v", v)
+	}
+	if !strings.Contains(console.String(), "Not exported") || !strings.Contains(console.String(), "Delivery failed") {
+		t.Errorf("Expected both records on the console, got %s", console.String())
+	}
+}
+
+// logsServer records the exports it receives
+type logsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	requests chan *collogspb.ExportLogsServiceRequest
+	apiKeys  chan []string
+}
+
+// Export records req
+func (s *logsServer) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.apiKeys <- md.Get("x-api-key")
+	s.requests <- req
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestOTLPExport_GRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	collector := &logsServer{
+		requests: make(chan *collogspb.ExportLogsServiceRequest, 10),
+		apiKeys:  make(chan []string, 10),
+	}
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, collector)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	logger, err := OpenLogger(Config{
+		Level:  "info",
+		Writer: io.Discard,
+		OTLP: &OTLPOptions{
+			Endpoint: listener.Addr().String(),
+			Insecure: true,
+			Headers:  map[string]string{"X-Api-Key": "secret"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+	logger.Error("Upload failed", "retryable", true)
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	select {
+	case req := <-collector.requests:
+		r := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+		if r.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_ERROR || r.SeverityText != "ERROR" {
+			t.Errorf("Expected an ERROR record, got %v %q", r.SeverityNumber, r.SeverityText)
+		}
+		if v := attribute(r.Attributes, "retryable"); !v.GetBoolValue() {
+			t.Errorf("Expected retryable true, got %v", v)
+		}
+	default:
+		t.Fatal("Expected an export on close")
+	}
+	if keys := <-collector.apiKeys; len(keys) != 1 || keys[0] != "secret" {
+		t.Errorf("Expected the header as metadata, got %v", keys)
+	}
+}
+
+func TestOTLPExport_FailureReported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	var console bytes.Buffer
+	logger, err := OpenLogger(Config{
+		Level:  "info",
+		Writer: &console,
+		OTLP:   &OTLPOptions{Endpoint: server.URL, Protocol: "http"},
+	})
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+	logger.Info("Started")
+	logger.otlp.Flush()
+	logger.Info("Still running")
+	logger.Close()
+
+	output := console.String()
+	if n := strings.Count(output, "Failed to export logs over OTLP"); n != 1 {
+		t.Errorf("Expected the failure reported once per streak, got %d in %s", n, output)
+	}
+	if !strings.Contains(output, "401 Unauthorized") {
+		t.Errorf("Expected the collector's status in the report, got %s", output)
+	}
+}
+
+func TestOpenLogger_OTLPErrors(t *testing.T) {
+	if _, err := OpenLogger(Config{OTLP: &OTLPOptions{}}); err == nil {
+		t.Error("Expected an error without an endpoint")
+	}
+	if _, err := OpenLogger(Config{OTLP: &OTLPOptions{Endpoint: "localhost:4317", Protocol: "thrift"}}); err == nil {
+		t.Error("Expected an error for an unknown protocol")
+	}
+	if _, err := OpenLogger(Config{OTLP: &OTLPOptions{Endpoint: "localhost:4317", Level: "trace"}}); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SamplingConfig limits repeated warnings and errors, e.g. the same delivery error logged by
+// every HTTP worker while an endpoint is down
+type SamplingConfig struct {
+	Window time.Duration `yaml:"window"` // Period identical messages are counted over (0 or negative = off)
+	Burst  int           `yaml:"burst"`  // Identical messages logged per window; the rest are suppressed (minimum 1)
+}
+
+// sampleKey identifies identical messages
+type sampleKey struct {
+	level slog.Level
+	msg   string
+}
+
+// sampleCount counts a message within its window
+type sampleCount struct {
+	start      time.Time
+	logged     int
+	suppressed int
+	handler    slog.Handler // Handler of the first suppressed record, which reports the summary
+	timer      *time.Timer  // Reports the summary when the window ends
+}
+
+// sampler holds the counts shared by a logger and the loggers derived from it
+type sampler struct {
+	window time.Duration
+	burst  int
+
+	mu     sync.Mutex
+	counts map[sampleKey]*sampleCount
+}
+
+// newSampler returns a sampler for config, or nil if sampling is off
+func newSampler(config SamplingConfig) *sampler {
+	if config.Window <= 0 {
+		return nil
+	}
+	return &sampler{
+		window: config.Window,
+		burst:  max(config.Burst, 1),
+		counts: make(map[sampleKey]*sampleCount),
+	}
+}
+
+// allow reports whether a record may be logged. Suppressed records are counted and reported
+// through handler when their window ends.
+func (s *sampler) allow(r slog.Record, handler slog.Handler) bool {
+	if r.Level < slog.LevelWarn {
+		return true
+	}
+	key := sampleKey{level: r.Level, msg: r.Message}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counts[key]
+	if c == nil || time.Since(c.start) >= s.window {
+		c = &sampleCount{start: time.Now()}
+		s.counts[key] = c
+	}
+	if c.logged < s.burst {
+		c.logged++
+		return true
+	}
+	c.suppressed++
+	if c.timer == nil {
+		c.handler = handler
+		c.timer = time.AfterFunc(s.window-time.Since(c.start), func() { s.report(key, c) })
+	}
+	return false
+}
+
+// report logs how many records of a window were suppressed and starts a new window
+func (s *sampler) report(key sampleKey, c *sampleCount) {
+	s.mu.Lock()
+	if s.counts[key] == c {
+		delete(s.counts, key)
+	}
+	suppressed := c.suppressed
+	c.suppressed = 0
+	s.mu.Unlock()
+	if suppressed == 0 {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), key.level, fmt.Sprintf("Suppressed %d similar messages", suppressed), 0)
+	r.AddAttrs(slog.String("message", key.msg), slog.Int("suppressed", suppressed), slog.Duration("window", s.window))
+	c.handler.Handle(context.Background(), r)
+}
+
+// flush reports every pending summary, e.g. before the log file is closed
+func (s *sampler) flush() {
+	s.mu.Lock()
+	pending := make(map[sampleKey]*sampleCount)
+	for key, c := range s.counts {
+		if c.timer != nil && c.timer.Stop() {
+			pending[key] = c
+		}
+	}
+	s.mu.Unlock()
+	for key, c := range pending {
+		s.report(key, c)
+	}
+}
+
+// samplingHandler drops repeated warnings and errors (see SamplingConfig)
+type samplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+// Enabled reports whether the wrapped handler handles level
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle logs r unless it is a suppressed repeat
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.sampler.allow(r, h.next) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler sharing the sampler
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+// WithGroup returns a handler sharing the sampler
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
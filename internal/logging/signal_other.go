@@ -0,0 +1,8 @@
+//go:build !unix
+
+package logging
+
+import "context"
+
+// ToggleDebugOnSignal is a no-op where SIGUSR2 is unavailable; use /api/loglevel instead
+func ToggleDebugOnSignal(ctx context.Context) {}
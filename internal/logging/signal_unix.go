@@ -0,0 +1,29 @@
+//go:build unix
+
+package logging
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ToggleDebugOnSignal toggles the default logger between debug and its configured level on
+// every SIGUSR2 until ctx is done
+func ToggleDebugOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				logger := GetDefaultLogger()
+				logger.Warn("Log level changed by SIGUSR2", "level", logger.ToggleDebug())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+)
+
+// maxStackFrames limits the frames of a stack trace
+const maxStackFrames = 64
+
+// stackHandler adds a "stack" attribute with the caller's stack trace to error records that
+// do not already have one (e.g. a recovered panic's stack)
+type stackHandler struct {
+	next slog.Handler
+}
+
+// Enabled reports whether the wrapped handler handles level
+func (h *stackHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the stack trace to error records. It runs on the logging goroutine, so the
+// stack is the caller's.
+func (h *stackHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError && !hasAttr(r, "stack") {
+		r = r.Clone()
+		r.AddAttrs(slog.String("stack", callerStack()))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler adding stack traces
+func (h *stackHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &stackHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup returns a handler adding stack traces
+func (h *stackHandler) WithGroup(name string) slog.Handler {
+	return &stackHandler{next: h.next.WithGroup(name)}
+}
+
+// withLevel returns a handler adding stack traces
+func (h *stackHandler) withLevel(level slog.Leveler) slog.Handler {
+	return &stackHandler{next: withLevel(h.next, level)}
+}
+
+// hasAttr reports whether r has a top-level attribute named key
+func hasAttr(r slog.Record, key string) bool {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		found = a.Key == key
+		return !found
+	})
+	return found
+}
+
+// callerStack formats the stack of the logging call, without the frames of slog and this
+// package, one "function\n\tfile:line" entry per frame
+func callerStack() string {
+	pcs := make([]uintptr, maxStackFrames)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if !isLoggingFrame(frame.Function) {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// isLoggingFrame reports whether function belongs to slog or this package (its tests excluded)
+func isLoggingFrame(function string) bool {
+	if strings.HasPrefix(function, "log/slog.") {
+		return true
+	}
+	const pkg = "github.com/edgedelta/s3-edgedelta-streamer/internal/logging."
+	rest, ok := strings.CutPrefix(function, pkg)
+	return ok && !strings.HasPrefix(rest, "Test")
+}
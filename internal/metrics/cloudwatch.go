@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// CloudWatchOptions configures publishing the core metrics as CloudWatch custom metrics
+type CloudWatchOptions struct {
+	Namespace   string
+	Region      string
+	Credentials aws.CredentialsProvider // Usually the S3 client's aws.Config.Credentials
+	Interval    time.Duration           // How often to publish (one datum per metric each time)
+	Dimensions  map[string]string       // Added to every datum, e.g. {"Instance": "streamer-1"}
+	Endpoint    string                  // Overrides https://monitoring.<region>.amazonaws.com
+}
+
+// cloudWatchTimeout bounds one publish, including retrieving credentials
+const cloudWatchTimeout = 10 * time.Second
+
+// timeout returns how long one publish may take: at most cloudWatchTimeout, and never
+// longer than the interval, so a hung request cannot overlap the next publish
+func (o CloudWatchOptions) timeout() time.Duration {
+	if o.Interval > 0 {
+		return min(o.Interval, cloudWatchTimeout)
+	}
+	return cloudWatchTimeout
+}
+
+// cloudWatchMetric is a metric published to CloudWatch
+type cloudWatchMetric struct {
+	name string
+	unit string
+}
+
+// cloudWatchMetrics are the metrics published to CloudWatch, by instrument name. Counters
+// are published as the increase since the last publish, summed across attributes; gauges
+// as their highest value.
+var cloudWatchMetrics = map[string]cloudWatchMetric{
+	"s3_files_processed_total": {"FilesProcessed", "Count"},
+	"s3_bytes_processed_total": {"BytesProcessed", "Bytes"},
+	"s3_files_errored_total":   {"FilesErrored", "Count"},
+	"processing_lag_seconds":   {"ProcessingLag", "Seconds"},
+}
+
+// cloudWatchExporter publishes metrics with the CloudWatch PutMetricData API
+type cloudWatchExporter struct {
+	opts     CloudWatchOptions
+	endpoint string
+	client   *http.Client
+	signer   *v4.Signer
+}
+
+func newCloudWatchExporter(opts CloudWatchOptions) *cloudWatchExporter {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://monitoring.%s.amazonaws.com/", opts.Region)
+	}
+	return &cloudWatchExporter{
+		opts:     opts,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: opts.timeout()},
+		signer:   v4.NewSigner(),
+	}
+}
+
+// Temporality implements sdkmetric.Exporter: counters are exported as deltas
+func (e *cloudWatchExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+		return metricdata.CumulativeTemporality
+	}
+	return metricdata.DeltaTemporality
+}
+
+// Aggregation implements sdkmetric.Exporter
+func (e *cloudWatchExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+// Export publishes the core metrics
+func (e *cloudWatchExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	form := url.Values{
+		"Action":    {"PutMetricData"},
+		"Version":   {"2010-08-01"},
+		"Namespace": {e.opts.Namespace},
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, md := range sm.Metrics {
+			cw, ok := cloudWatchMetrics[md.Name]
+			if !ok {
+				continue
+			}
+			value, ok := cloudWatchValue(md.Data)
+			if !ok {
+				continue
+			}
+			n++
+			member := fmt.Sprintf("MetricData.member.%d.", n)
+			form.Set(member+"MetricName", cw.name)
+			form.Set(member+"Unit", cw.unit)
+			form.Set(member+"Value", strconv.FormatFloat(value, 'f', -1, 64))
+			form.Set(member+"Timestamp", now)
+			e.addDimensions(form, member)
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return e.put(ctx, form)
+}
+
+// cloudWatchValue returns the value published for a metric's data points
+func cloudWatchValue(data metricdata.Aggregation) (float64, bool) {
+	switch data := data.(type) {
+	case metricdata.Sum[int64]:
+		var sum int64
+		for _, dp := range data.DataPoints {
+			sum += dp.Value
+		}
+		return float64(sum), true
+	case metricdata.Sum[float64]:
+		var sum float64
+		for _, dp := range data.DataPoints {
+			sum += dp.Value
+		}
+		return sum, true
+	case metricdata.Gauge[float64]:
+		if len(data.DataPoints) == 0 {
+			return 0, false
+		}
+		highest := data.DataPoints[0].Value
+		for _, dp := range data.DataPoints[1:] {
+			highest = max(highest, dp.Value)
+		}
+		return highest, true
+	}
+	return 0, false
+}
+
+// addDimensions adds the configured dimensions to a datum, in name order
+func (e *cloudWatchExporter) addDimensions(form url.Values, member string) {
+	names := make([]string, 0, len(e.opts.Dimensions))
+	for name := range e.opts.Dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		dim := fmt.Sprintf("%sDimensions.member.%d.", member, i+1)
+		form.Set(dim+"Name", name)
+		form.Set(dim+"Value", e.opts.Dimensions[name])
+	}
+}
+
+// put sends a signed PutMetricData request
+func (e *cloudWatchExporter) put(ctx context.Context, form url.Values) error {
+	body := []byte(form.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	creds, err := e.opts.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := e.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "monitoring", e.opts.Region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign CloudWatch request: %w", err)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish CloudWatch metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to publish CloudWatch metrics: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// ForceFlush implements sdkmetric.Exporter; nothing is buffered
+func (e *cloudWatchExporter) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// Shutdown implements sdkmetric.Exporter
+func (e *cloudWatchExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestCloudWatchExporter(t *testing.T) {
+	forms := make(chan url.Values, 10)
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		r.ParseForm()
+		forms <- r.PostForm
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	creds := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	m, err := InitMetricsWithExporters(ctx, Exporters{CloudWatch: &CloudWatchOptions{
+		Namespace:   "Streamer",
+		Region:      "us-east-1",
+		Credentials: creds,
+		Interval:    time.Hour,
+		Dimensions:  map[string]string{"Instance": "streamer-1"},
+		Endpoint:    server.URL,
+	}}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	m.RecordFileProcessed(ctx, Dimensions{Bucket: "a"}, 100, time.Second)
+	m.RecordFileProcessed(ctx, Dimensions{Bucket: "b"}, 50, time.Second)
+	m.UpdateProcessingLag(ctx, 42)
+	if err := m.Shutdown(ctx); err != nil { // Publishes what was collected
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	var form url.Values
+	select {
+	case form = <-forms:
+	default:
+		t.Fatal("Expected a PutMetricData request on shutdown")
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/monitoring/") {
+		t.Errorf("Expected a SigV4 signature for monitoring, got %q", auth)
+	}
+	if form.Get("Action") != "PutMetricData" || form.Get("Namespace") != "Streamer" {
+		t.Errorf("Expected PutMetricData to Streamer, got %v", form)
+	}
+
+	values := make(map[string]string)
+	for i := 1; form.Get("MetricData.member."+strconv.Itoa(i)+".MetricName") != ""; i++ {
+		member := "MetricData.member." + strconv.Itoa(i) + "."
+		values[form.Get(member+"MetricName")] = form.Get(member + "Value")
+		if form.Get(member+"Dimensions.member.1.Value") != "streamer-1" {
+			t.Errorf("Expected the Instance dimension on %s", form.Get(member+"MetricName"))
+		}
+	}
+	for name, want := range map[string]string{"FilesProcessed": "2", "BytesProcessed": "150", "ProcessingLag": "42"} {
+		if values[name] != want {
+			t.Errorf("Expected %s %s, got %q", name, want, values[name])
+		}
+	}
+	if _, ok := values["FilesErrored"]; ok {
+		t.Error("Expected no datum for a counter never recorded")
+	}
+}
+
+func TestCloudWatchExporter_TimeoutBoundedByInterval(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	exporter := newCloudWatchExporter(CloudWatchOptions{
+		Namespace: "Streamer",
+		Region:    "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+		Interval: 100 * time.Millisecond,
+		Endpoint: server.URL,
+	})
+	start := time.Now()
+	if err := exporter.put(context.Background(), url.Values{"Action": {"PutMetricData"}}); err == nil {
+		t.Fatal("Expected a hung request to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the request to give up after the interval, took %v", elapsed)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultMaxDimensionValues bounds how many distinct values each dimension reports unless
+// SetMaxDimensionValues is called
+const DefaultMaxDimensionValues = 100
+
+// OverflowValue is reported in place of dimension values beyond the limit
+const OverflowValue = "other"
+
+// Dimensions identify the feed a file or batch belongs to. Empty values are reported as
+// "unknown"; a batch spanning several feeds reports "mixed".
+type Dimensions struct {
+	Bucket string
+	Prefix string
+	Format string
+}
+
+// SetMaxDimensionValues bounds how many distinct values each dimension (bucket, prefix,
+// format) reports; later values are reported as "other". -1 disables the limit.
+func (m *Metrics) SetMaxDimensionValues(n int) {
+	m.dimensions = newDimensionGuard(n)
+}
+
+// dimensionAttributes returns the attributes of d, applying the cardinality guard
+func (m *Metrics) dimensionAttributes(d Dimensions) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("bucket", m.dimensions.value("bucket", d.Bucket)),
+		attribute.String("prefix", m.dimensions.value("prefix", d.Prefix)),
+		attribute.String("format", m.dimensions.value("format", d.Format)),
+	}
+}
+
+// dimensionGuard caps the distinct values reported per dimension
+type dimensionGuard struct {
+	mu    sync.Mutex
+	limit int // -1 for no limit
+	seen  map[string]map[string]struct{}
+}
+
+func newDimensionGuard(limit int) *dimensionGuard {
+	return &dimensionGuard{limit: limit, seen: make(map[string]map[string]struct{})}
+}
+
+// value returns v, or OverflowValue if the dimension already has limit other values.
+// A nil guard applies no limit.
+func (g *dimensionGuard) value(key, v string) string {
+	if v == "" {
+		v = "unknown"
+	}
+	if g == nil || g.limit < 0 {
+		return v
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	values := g.seen[key]
+	if _, ok := values[v]; ok {
+		return v
+	}
+	if len(values) >= g.limit {
+		return OverflowValue
+	}
+	if values == nil {
+		values = make(map[string]struct{})
+		g.seen[key] = values
+	}
+	values[v] = struct{}{}
+	return v
+}
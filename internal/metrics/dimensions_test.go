@@ -0,0 +1,28 @@
+package metrics
+
+import "testing"
+
+func TestDimensionGuard(t *testing.T) {
+	g := newDimensionGuard(2)
+	for _, v := range []string{"a", "b", "a"} {
+		if got := g.value("prefix", v); got != v {
+			t.Errorf("Expected %s, got %s", v, got)
+		}
+	}
+	if got := g.value("prefix", "c"); got != OverflowValue {
+		t.Errorf("Expected %s beyond the limit, got %s", OverflowValue, got)
+	}
+	if got := g.value("bucket", "c"); got != "c" {
+		t.Errorf("Expected each dimension to have its own limit, got %s", got)
+	}
+	if got := g.value("format", ""); got != "unknown" {
+		t.Errorf("Expected unknown for an empty value, got %s", got)
+	}
+
+	unlimited := newDimensionGuard(-1)
+	for _, v := range []string{"a", "b", "c"} {
+		if got := unlimited.value("prefix", v); got != v {
+			t.Errorf("Expected %s without a limit, got %s", v, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+)
+
+// Attributes recorded on latency measurements for exemplars only. The latency histograms
+// drop them from their series (see histogramView), so they add no cardinality; exemplars
+// keep them as filtered attributes.
+const (
+	exemplarKeyS3Key   = attribute.Key("s3_key")
+	exemplarKeyBatchID = attribute.Key("batch_id")
+)
+
+type fileKeyContextKey struct{}
+
+type batchIDContextKey struct{}
+
+// WithFileKey returns a context whose latency measurements carry the S3 key on their exemplars
+func WithFileKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, fileKeyContextKey{}, key)
+}
+
+// WithBatchID returns a context whose latency measurements carry the batch ID on their exemplars
+func WithBatchID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, batchIDContextKey{}, id)
+}
+
+// exemplarAttributes returns the exemplar-only attributes carried by ctx
+func exemplarAttributes(ctx context.Context) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if key, _ := ctx.Value(fileKeyContextKey{}).(string); key != "" {
+		attrs = append(attrs, exemplarKeyS3Key.String(key))
+	}
+	if id, _ := ctx.Value(batchIDContextKey{}).(string); id != "" {
+		attrs = append(attrs, exemplarKeyBatchID.String(id))
+	}
+	return attrs
+}
+
+// isExemplarOnly reports whether an attribute is kept on exemplars but not on series
+func isExemplarOnly(kv attribute.KeyValue) bool {
+	return kv.Key == exemplarKeyS3Key || kv.Key == exemplarKeyBatchID
+}
+
+// exemplarFilter returns the filter deciding which measurements become exemplars:
+// "trace_based" (default, measurements made in a sampled span), "always_on" or "always_off"
+func exemplarFilter(name string) (exemplar.Filter, error) {
+	switch name {
+	case "", "trace_based":
+		return exemplar.TraceBasedFilter, nil
+	case "always_on":
+		return exemplar.AlwaysOnFilter, nil
+	case "always_off":
+		return exemplar.AlwaysOffFilter, nil
+	}
+	return nil, fmt.Errorf("unknown exemplar filter %q", name)
+}
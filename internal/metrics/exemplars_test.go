@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collectHistogram(t *testing.T, m *Metrics, name string) metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := m.prometheusReader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, md := range sm.Metrics {
+			if h, ok := md.Data.(metricdata.Histogram[float64]); ok && md.Name == name && len(h.DataPoints) == 1 {
+				return h.DataPoints[0]
+			}
+		}
+	}
+	t.Fatalf("Expected one %s data point", name)
+	return metricdata.HistogramDataPoint[float64]{}
+}
+
+func TestExemplars_CarryFileKey(t *testing.T) {
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{Prometheus: true, Exemplars: "always_on"}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	defer m.Shutdown(ctx)
+
+	m.RecordFileProcessed(WithFileKey(ctx, "logs/a.gz"), Dimensions{Bucket: "logs"}, 10, 30*time.Second)
+	m.RecordFileProcessed(WithFileKey(ctx, "logs/b.gz"), Dimensions{Bucket: "logs"}, 10, time.Second)
+
+	// Both files share one series; the keys only appear on exemplars (one per bucket)
+	dp := collectHistogram(t, m, "s3_processing_latency_seconds")
+	if _, ok := dp.Attributes.Value(exemplarKeyS3Key); ok {
+		t.Error("Expected s3_key to be dropped from the series attributes")
+	}
+	keys := make(map[string]bool)
+	for _, e := range dp.Exemplars {
+		for _, kv := range e.FilteredAttributes {
+			if kv.Key == exemplarKeyS3Key {
+				keys[kv.Value.AsString()] = true
+			}
+		}
+	}
+	if !keys["logs/a.gz"] || !keys["logs/b.gz"] {
+		t.Errorf("Expected exemplars for both keys, got %+v", dp.Exemplars)
+	}
+
+	if proto := exemplarsProto(dp.Exemplars); len(proto) != len(dp.Exemplars) || len(proto[0].FilteredAttributes) == 0 {
+		t.Errorf("Expected exemplars converted to OTLP with their attributes, got %v", proto)
+	}
+}
+
+func TestExemplars_TraceBasedByDefault(t *testing.T) {
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{Prometheus: true}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	defer m.Shutdown(ctx)
+
+	// Without a sampled span there is nothing to link to
+	m.RecordFileProcessed(WithFileKey(ctx, "logs/a.gz"), Dimensions{}, 10, time.Second)
+	if dp := collectHistogram(t, m, "s3_processing_latency_seconds"); len(dp.Exemplars) != 0 {
+		t.Errorf("Expected no exemplars outside a span, got %+v", dp.Exemplars)
+	}
+
+	if _, err := InitMetricsWithExporters(ctx, Exporters{Exemplars: "sometimes"}, "", "test-service", "1.0.0", 0, false); err == nil {
+		t.Error("Expected error for an unknown exemplar filter")
+	}
+}
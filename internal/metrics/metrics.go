@@ -2,7 +2,9 @@ package metrics
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -12,7 +14,10 @@ import (
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/buildinfo"
 )
 
 // Metrics holds all application metrics
@@ -21,7 +26,13 @@ type Metrics struct {
 	FilesProcessed    metric.Int64Counter
 	BytesProcessed    metric.Int64Counter
 	FilesErrored      metric.Int64Counter
+	FilesTimedOut     metric.Int64Counter
+	FilesCorrupt      metric.Int64Counter
+	LongLines         metric.Int64Counter
 	ProcessingLatency metric.Float64Histogram
+	ActiveWorkers     metric.Int64ObservableGauge // See ObserveWorkerPool
+	BusyWorkers       metric.Int64ObservableGauge
+	QueueDepth        metric.Int64ObservableGauge
 
 	// HTTP Sender metrics
 	HTTPBatchesSent       metric.Int64Counter
@@ -31,53 +42,165 @@ type Metrics struct {
 	HTTPNetworkErrors     metric.Int64Counter
 	HTTPTimeoutErrors     metric.Int64Counter
 	HTTPServerErrors      metric.Int64Counter
+	HTTPClientErrors      metric.Int64Counter
+	HTTPResponses         metric.Int64Counter
+	HTTPRetries           metric.Int64Counter
 	HTTPBufferDrops       metric.Int64Counter
 	HTTPBufferUtilization metric.Float64Gauge
 	HTTPActiveConnections metric.Int64Gauge
 	HTTPIdleConnections   metric.Int64Gauge
 	HTTPRequestLatency    metric.Float64Histogram
+	DeliveryLatency       metric.Float64Histogram
+	HTTPBatchQueue        metric.Int64ObservableGauge // See ObserveHTTPSender
+	HTTPInFlight          metric.Int64ObservableGauge
 
 	// Processing lag metrics
 	ProcessingLag metric.Float64Gauge
 
-	meterProvider *sdkmetric.MeterProvider
+	// Watchdog metrics: stale values mean a loop has stalled
+	Heartbeat metric.Int64Counter
+	LastScan  metric.Float64Gauge
+	LastSend  metric.Float64Gauge
+
+	// State compaction metrics
+	StateSize               metric.Int64Gauge
+	StateCompactedEntries   metric.Int64Counter
+	StateCompactionDuration metric.Float64Histogram
+
+	// State persistence metrics
+	StateSaveLatency   metric.Float64Histogram
+	StateSaveFailures  metric.Int64Counter
+	StateCheckpointAge metric.Float64Gauge
+	StateDirtyDuration metric.Float64Gauge
+
+	// AWS credential metrics
+	CredentialAge    metric.Float64ObservableGauge // See ObserveCredentials
+	CredentialExpiry metric.Float64ObservableGauge // See ObserveCredentials
+
+	meterProvider    *sdkmetric.MeterProvider
+	meter            metric.Meter
+	prometheusReader *sdkmetric.ManualReader // nil unless Prometheus is enabled
+	dimensions       *dimensionGuard
+	heartbeats       sync.Map // Component name -> time.Time of its last heartbeat
+}
+
+// Exporters selects how metrics leave the process
+type Exporters struct {
+	OTLP       bool // Push to an OTLP collector
+	Prometheus bool // Serve for scraping (see PrometheusHandler)
+
+	OTLPProtocol    string            // "grpc" (default) or "http" (protobuf over HTTP)
+	OTLPHeaders     map[string]string // Sent with every export, e.g. an API key
+	OTLPTLS         *tls.Config       // TLS settings (nil for the system defaults; see LoadTLSConfig)
+	OTLPTemporality string            // "cumulative" (default) or "delta"
+
+	HistogramBuckets map[string][]float64 // Bucket boundaries by histogram name or DefaultHistogramBuckets (all exporters)
+	Exemplars        string               // Measurements sampled as exemplars: "trace_based" (default), "always_on" or "always_off"
+
+	CloudWatch *CloudWatchOptions // Also publish the core metrics to CloudWatch (nil to disable)
+	StatsD     *StatsDOptions     // Also send the metrics to a StatsD/DogStatsD agent (nil to disable)
 }
 
 // InitMetrics initializes OpenTelemetry metrics with OTLP exporter
 func InitMetrics(ctx context.Context, endpoint string, serviceName string, serviceVersion string, exportInterval time.Duration, useInsecure bool) (*Metrics, error) {
-	// Create resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion(serviceVersion),
-		),
-	)
+	return InitMetricsWithExporters(ctx, Exporters{OTLP: true}, endpoint, serviceName, serviceVersion, exportInterval, useInsecure)
+}
+
+// InitMetricsWithExporters initializes OpenTelemetry metrics with the selected exporters.
+// endpoint, exportInterval and useInsecure only apply to OTLP.
+func InitMetricsWithExporters(ctx context.Context, exporters Exporters, endpoint string, serviceName string, serviceVersion string, exportInterval time.Duration, useInsecure bool) (*Metrics, error) {
+	// Create resource with service information and the build (see buildinfo)
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serviceVersion),
+	}
+	build := buildinfo.Get()
+	attrs = append(attrs, attribute.String("build.version", build.Version))
+	if build.Commit != "" {
+		attrs = append(attrs, attribute.String("build.commit", build.Commit))
+	}
+	if build.Date != "" {
+		attrs = append(attrs, attribute.String("build.date", build.Date))
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(attrs...))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	// Create OTLP gRPC exporter
-	var opts []otlpmetricgrpc.Option
-	opts = append(opts, otlpmetricgrpc.WithEndpoint(endpoint))
-
-	if useInsecure {
-		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(insecure.NewCredentials()))
-	}
-
-	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	filter, err := exemplarFilter(exporters.Exemplars)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		return nil, err
 	}
-
-	// Create meter provider with periodic reader
-	meterProvider := sdkmetric.NewMeterProvider(
+	providerOpts := []sdkmetric.Option{
 		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(
+		sdkmetric.WithExemplarFilter(filter),
+		sdkmetric.WithView(histogramView(exporters.HistogramBuckets)),
+	}
+
+	if exporters.OTLP {
+		var exporter sdkmetric.Exporter
+		switch exporters.OTLPProtocol {
+		case "http":
+			exporter, err = newOTLPHTTPExporter(endpoint, useInsecure, exporters.OTLPHeaders, exporters.OTLPTLS, temporalitySelector(exporters.OTLPTemporality))
+		case "", "grpc":
+			// Create OTLP gRPC exporter
+			var opts []otlpmetricgrpc.Option
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(endpoint))
+			opts = append(opts, otlpmetricgrpc.WithTemporalitySelector(temporalitySelector(exporters.OTLPTemporality)))
+
+			if useInsecure {
+				opts = append(opts, otlpmetricgrpc.WithTLSCredentials(insecure.NewCredentials()))
+			} else if exporters.OTLPTLS != nil {
+				opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(exporters.OTLPTLS)))
+			}
+			if len(exporters.OTLPHeaders) > 0 {
+				opts = append(opts, otlpmetricgrpc.WithHeaders(exporters.OTLPHeaders))
+			}
+
+			exporter, err = otlpmetricgrpc.New(ctx, opts...)
+		default:
+			err = fmt.Errorf("unknown protocol %q", exporters.OTLPProtocol)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+
+		// Export on an interval with a periodic reader
+		providerOpts = append(providerOpts, sdkmetric.WithReader(
 			sdkmetric.NewPeriodicReader(exporter,
 				sdkmetric.WithInterval(exportInterval),
 			),
-		),
-	)
+		))
+	}
+
+	if exporters.CloudWatch != nil {
+		if exporters.CloudWatch.Credentials == nil {
+			return nil, fmt.Errorf("CloudWatch exporter requires AWS credentials")
+		}
+		providerOpts = append(providerOpts, sdkmetric.WithReader(
+			sdkmetric.NewPeriodicReader(newCloudWatchExporter(*exporters.CloudWatch),
+				sdkmetric.WithInterval(exporters.CloudWatch.Interval),
+				sdkmetric.WithTimeout(exporters.CloudWatch.timeout()),
+			),
+		))
+	}
+
+	if exporters.StatsD != nil {
+		providerOpts = append(providerOpts, sdkmetric.WithReader(
+			sdkmetric.NewPeriodicReader(newStatsDExporter(*exporters.StatsD),
+				sdkmetric.WithInterval(exporters.StatsD.Interval),
+			),
+		))
+	}
+
+	// Collect on each scrape with a manual reader
+	var prometheusReader *sdkmetric.ManualReader
+	if exporters.Prometheus {
+		prometheusReader = sdkmetric.NewManualReader()
+		providerOpts = append(providerOpts, sdkmetric.WithReader(prometheusReader))
+	}
+
+	meterProvider := sdkmetric.NewMeterProvider(providerOpts...)
 
 	// Set global meter provider
 	otel.SetMeterProvider(meterProvider)
@@ -87,7 +210,10 @@ func InitMetrics(ctx context.Context, endpoint string, serviceName string, servi
 
 	// Create metrics
 	m := &Metrics{
-		meterProvider: meterProvider,
+		meterProvider:    meterProvider,
+		meter:            meter,
+		prometheusReader: prometheusReader,
+		dimensions:       newDimensionGuard(DefaultMaxDimensionValues),
 	}
 
 	// S3 Worker metrics
@@ -118,6 +244,33 @@ func InitMetrics(ctx context.Context, endpoint string, serviceName string, servi
 		return nil, err
 	}
 
+	m.FilesTimedOut, err = meter.Int64Counter(
+		"s3_files_timed_out_total",
+		metric.WithDescription("Total number of S3 files that exceeded the per-file processing timeout"),
+		metric.WithUnit("{file}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.FilesCorrupt, err = meter.Int64Counter(
+		"s3_files_corrupt_total",
+		metric.WithDescription("Total number of S3 files that failed because their content is corrupt"),
+		metric.WithUnit("{file}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.LongLines, err = meter.Int64Counter(
+		"s3_long_lines_total",
+		metric.WithDescription("Total number of lines longer than the maximum line size, by the action taken"),
+		metric.WithUnit("{line}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	m.ProcessingLatency, err = meter.Float64Histogram(
 		"s3_processing_latency_seconds",
 		metric.WithDescription("Time to process each S3 file"),
@@ -127,6 +280,33 @@ func InitMetrics(ctx context.Context, endpoint string, serviceName string, servi
 		return nil, err
 	}
 
+	m.ActiveWorkers, err = meter.Int64ObservableGauge(
+		"s3_active_workers",
+		metric.WithDescription("Number of S3 processing workers currently running"),
+		metric.WithUnit("{worker}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.BusyWorkers, err = meter.Int64ObservableGauge(
+		"s3_busy_workers",
+		metric.WithDescription("Number of S3 processing workers currently processing a file"),
+		metric.WithUnit("{worker}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.QueueDepth, err = meter.Int64ObservableGauge(
+		"s3_queue_depth",
+		metric.WithDescription("Files waiting in the job queue"),
+		metric.WithUnit("{file}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	// HTTP Sender metrics
 	m.HTTPBatchesSent, err = meter.Int64Counter(
 		"http_batches_sent_total",
@@ -191,6 +371,33 @@ func InitMetrics(ctx context.Context, endpoint string, serviceName string, servi
 		return nil, err
 	}
 
+	m.HTTPClientErrors, err = meter.Int64Counter(
+		"http_client_errors_total",
+		metric.WithDescription("Total HTTP client errors (4xx)"),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.HTTPResponses, err = meter.Int64Counter(
+		"http_responses_total",
+		metric.WithDescription("Total HTTP responses received, by status code"),
+		metric.WithUnit("{response}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.HTTPRetries, err = meter.Int64Counter(
+		"http_retries_total",
+		metric.WithDescription("Total HTTP batch send retries"),
+		metric.WithUnit("{retry}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	m.HTTPBufferDrops, err = meter.Int64Counter(
 		"http_buffer_drops_total",
 		metric.WithDescription("Total lines dropped due to buffer overflow"),
@@ -236,6 +443,52 @@ func InitMetrics(ctx context.Context, endpoint string, serviceName string, servi
 		return nil, err
 	}
 
+	m.DeliveryLatency, err = meter.Float64Histogram(
+		"http_delivery_latency_seconds",
+		metric.WithDescription("Time from the timestamp of the oldest file in a batch until the batch was delivered"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(1, 5, 15, 30, 60, 120, 300, 600, 900, 1800, 3600, 7200, 21600, 86400),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.HTTPBatchQueue, err = meter.Int64ObservableGauge(
+		"http_batch_queue_depth",
+		metric.WithDescription("Batches waiting for an HTTP worker"),
+		metric.WithUnit("{batch}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.HTTPInFlight, err = meter.Int64ObservableGauge(
+		"http_requests_in_flight",
+		metric.WithDescription("HTTP requests in progress"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.CredentialAge, err = meter.Float64ObservableGauge(
+		"aws_credentials_age_seconds",
+		metric.WithDescription("Time since the AWS credentials in use were loaded or renewed"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.CredentialExpiry, err = meter.Float64ObservableGauge(
+		"aws_credentials_expiry_seconds",
+		metric.WithDescription("Time until the AWS session credentials in use expire (negative once expired)"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	// Processing lag gauge
 	m.ProcessingLag, err = meter.Float64Gauge(
 		"processing_lag_seconds",
@@ -246,6 +499,97 @@ func InitMetrics(ctx context.Context, endpoint string, serviceName string, servi
 		return nil, err
 	}
 
+	m.Heartbeat, err = meter.Int64Counter(
+		"streamer_heartbeat_total",
+		metric.WithDescription("Iterations of the scan and batching loops; stops increasing if a loop stalls"),
+		metric.WithUnit("{beat}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.LastScan, err = meter.Float64Gauge(
+		"last_successful_scan_timestamp_seconds",
+		metric.WithDescription("Unix time of the last S3 scan that completed without error"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.LastSend, err = meter.Float64Gauge(
+		"last_successful_send_timestamp_seconds",
+		metric.WithDescription("Unix time of the last batch accepted by an endpoint"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// State compaction metrics
+	m.StateSize, err = meter.Int64Gauge(
+		"state_tracked_entries",
+		metric.WithDescription("Per-file entries (resume offsets, file records) kept in the state after compaction"),
+		metric.WithUnit("{entry}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.StateCompactedEntries, err = meter.Int64Counter(
+		"state_compacted_entries_total",
+		metric.WithDescription("Total per-file state entries removed by compaction"),
+		metric.WithUnit("{entry}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.StateCompactionDuration, err = meter.Float64Histogram(
+		"state_compaction_duration_seconds",
+		metric.WithDescription("Time taken by each state compaction run"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// State persistence metrics
+	m.StateSaveLatency, err = meter.Float64Histogram(
+		"state_save_duration_seconds",
+		metric.WithDescription("Time taken to write pending state changes to the backend"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.StateSaveFailures, err = meter.Int64Counter(
+		"state_save_failures_total",
+		metric.WithDescription("Total state saves that failed"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.StateCheckpointAge, err = meter.Float64Gauge(
+		"state_checkpoint_age_seconds",
+		metric.WithDescription("Time since the checkpoint last advanced"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.StateDirtyDuration, err = meter.Float64Gauge(
+		"state_unsaved_duration_seconds",
+		metric.WithDescription("Time the oldest unsaved state change has been waiting to be saved"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	return m, nil
 }
 
@@ -257,51 +601,98 @@ func (m *Metrics) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-// RecordFileProcessed records a successfully processed file
-func (m *Metrics) RecordFileProcessed(ctx context.Context, bytes int64, latency time.Duration) {
-	m.FilesProcessed.Add(ctx, 1)
-	m.BytesProcessed.Add(ctx, bytes)
-	m.ProcessingLatency.Record(ctx, latency.Seconds())
+// RecordFileProcessed records a successfully processed file. The latency exemplar carries
+// the S3 key set with WithFileKey.
+func (m *Metrics) RecordFileProcessed(ctx context.Context, dims Dimensions, bytes int64, latency time.Duration) {
+	dimAttrs := m.dimensionAttributes(dims)
+	attrs := metric.WithAttributes(dimAttrs...)
+	m.FilesProcessed.Add(ctx, 1, attrs)
+	m.BytesProcessed.Add(ctx, bytes, attrs)
+	m.ProcessingLatency.Record(ctx, latency.Seconds(), metric.WithAttributes(append(dimAttrs, exemplarAttributes(ctx)...)...))
 }
 
 // RecordFileError records a file processing error
-func (m *Metrics) RecordFileError(ctx context.Context) {
-	m.FilesErrored.Add(ctx, 1)
+func (m *Metrics) RecordFileError(ctx context.Context, dims Dimensions) {
+	m.FilesErrored.Add(ctx, 1, metric.WithAttributes(m.dimensionAttributes(dims)...))
+}
+
+// RecordFileTimeout records a file whose processing exceeded the per-file timeout
+func (m *Metrics) RecordFileTimeout(ctx context.Context, dims Dimensions) {
+	m.FilesTimedOut.Add(ctx, 1, metric.WithAttributes(m.dimensionAttributes(dims)...))
+}
+
+// RecordCorruptFile records a file that failed because its content is corrupt (also counted as an error)
+func (m *Metrics) RecordCorruptFile(ctx context.Context, dims Dimensions) {
+	m.FilesCorrupt.Add(ctx, 1, metric.WithAttributes(m.dimensionAttributes(dims)...))
+}
+
+// RecordLongLines records lines longer than the maximum line size and the policy applied to them
+func (m *Metrics) RecordLongLines(ctx context.Context, dims Dimensions, lines int64, policy string) {
+	attrs := append(m.dimensionAttributes(dims), attribute.String("policy", policy))
+	m.LongLines.Add(ctx, lines, metric.WithAttributes(attrs...))
 }
 
 // RecordHTTPBatch records an HTTP batch sent
-func (m *Metrics) RecordHTTPBatch(ctx context.Context, lines, bytes int64) {
-	m.HTTPBatchesSent.Add(ctx, 1)
-	m.HTTPLinesSent.Add(ctx, lines)
-	m.HTTPBytesSent.Add(ctx, bytes)
+func (m *Metrics) RecordHTTPBatch(ctx context.Context, endpoint string, dims Dimensions, lines, bytes int64) {
+	attrs := m.endpointAttributes(endpoint, dims)
+	m.HTTPBatchesSent.Add(ctx, 1, attrs)
+	m.HTTPLinesSent.Add(ctx, lines, attrs)
+	m.HTTPBytesSent.Add(ctx, bytes, attrs)
 }
 
 // RecordHTTPError records an HTTP error
-func (m *Metrics) RecordHTTPError(ctx context.Context) {
-	m.HTTPErrors.Add(ctx, 1)
+func (m *Metrics) RecordHTTPError(ctx context.Context, endpoint string, dims Dimensions) {
+	m.HTTPErrors.Add(ctx, 1, m.endpointAttributes(endpoint, dims))
 }
 
 // RecordHTTPNetworkError records an HTTP network error
-func (m *Metrics) RecordHTTPNetworkError(ctx context.Context) {
-	m.HTTPErrors.Add(ctx, 1)
-	m.HTTPNetworkErrors.Add(ctx, 1)
+func (m *Metrics) RecordHTTPNetworkError(ctx context.Context, endpoint string, dims Dimensions) {
+	attrs := m.endpointAttributes(endpoint, dims)
+	m.HTTPErrors.Add(ctx, 1, attrs)
+	m.HTTPNetworkErrors.Add(ctx, 1, attrs)
 }
 
 // RecordHTTPTimeoutError records an HTTP timeout error
-func (m *Metrics) RecordHTTPTimeoutError(ctx context.Context) {
-	m.HTTPErrors.Add(ctx, 1)
-	m.HTTPTimeoutErrors.Add(ctx, 1)
+func (m *Metrics) RecordHTTPTimeoutError(ctx context.Context, endpoint string, dims Dimensions) {
+	attrs := m.endpointAttributes(endpoint, dims)
+	m.HTTPErrors.Add(ctx, 1, attrs)
+	m.HTTPTimeoutErrors.Add(ctx, 1, attrs)
 }
 
 // RecordHTTPServerError records an HTTP server error (5xx)
-func (m *Metrics) RecordHTTPServerError(ctx context.Context) {
-	m.HTTPErrors.Add(ctx, 1)
-	m.HTTPServerErrors.Add(ctx, 1)
+func (m *Metrics) RecordHTTPServerError(ctx context.Context, endpoint string, dims Dimensions) {
+	attrs := m.endpointAttributes(endpoint, dims)
+	m.HTTPErrors.Add(ctx, 1, attrs)
+	m.HTTPServerErrors.Add(ctx, 1, attrs)
 }
 
-// RecordBufferDrop records lines dropped due to buffer overflow
-func (m *Metrics) RecordBufferDrop(ctx context.Context, lines int64) {
-	m.HTTPBufferDrops.Add(ctx, lines)
+// RecordHTTPClientError records an HTTP client error (4xx)
+func (m *Metrics) RecordHTTPClientError(ctx context.Context, endpoint string, dims Dimensions) {
+	attrs := m.endpointAttributes(endpoint, dims)
+	m.HTTPErrors.Add(ctx, 1, attrs)
+	m.HTTPClientErrors.Add(ctx, 1, attrs)
+}
+
+// RecordHTTPResponse records an HTTP response by status code
+func (m *Metrics) RecordHTTPResponse(ctx context.Context, endpoint string, statusCode int) {
+	m.HTTPResponses.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("component", "http_sender"),
+		attribute.String("endpoint", endpoint),
+		attribute.Int("status_code", statusCode),
+	))
+}
+
+// RecordHTTPRetry records a retried HTTP batch send
+func (m *Metrics) RecordHTTPRetry(ctx context.Context, endpoint string, dims Dimensions) {
+	m.HTTPRetries.Add(ctx, 1, m.endpointAttributes(endpoint, dims))
+}
+
+// RecordBufferDrop records lines dropped due to buffer overflow under the given policy
+func (m *Metrics) RecordBufferDrop(ctx context.Context, lines int64, policy string) {
+	m.HTTPBufferDrops.Add(ctx, lines, metric.WithAttributes(
+		attribute.String("component", "http_sender"),
+		attribute.String("policy", policy),
+	))
 }
 
 // UpdateBufferUtilization updates the buffer utilization gauge
@@ -322,10 +713,13 @@ func (m *Metrics) UpdateHTTPConnections(ctx context.Context, active, idle int64)
 }
 
 // RecordHTTPRequestLatency records HTTP request latency
-func (m *Metrics) RecordHTTPRequestLatency(ctx context.Context, durationSeconds float64) {
-	m.HTTPRequestLatency.Record(ctx, durationSeconds, metric.WithAttributes(
-		attribute.String("component", "http_sender"),
-	))
+func (m *Metrics) RecordHTTPRequestLatency(ctx context.Context, endpoint string, dims Dimensions, durationSeconds float64) {
+	m.HTTPRequestLatency.Record(ctx, durationSeconds, m.endpointAttributes(endpoint, dims, exemplarAttributes(ctx)...))
+}
+
+// RecordDeliveryLatency records how long after its oldest file's timestamp a batch was delivered
+func (m *Metrics) RecordDeliveryLatency(ctx context.Context, endpoint string, dims Dimensions, latency time.Duration) {
+	m.DeliveryLatency.Record(ctx, latency.Seconds(), m.endpointAttributes(endpoint, dims, exemplarAttributes(ctx)...))
 }
 
 // UpdateProcessingLag updates the processing lag gauge
@@ -334,3 +728,75 @@ func (m *Metrics) UpdateProcessingLag(ctx context.Context, lagSeconds float64) {
 		attribute.String("component", "scanner"),
 	))
 }
+
+// RecordHeartbeat counts one iteration of a component's loop (scanner, http_sender)
+func (m *Metrics) RecordHeartbeat(ctx context.Context, component string) {
+	m.Heartbeat.Add(ctx, 1, metric.WithAttributes(attribute.String("component", component)))
+	m.heartbeats.Store(component, time.Now())
+}
+
+// LastHeartbeat returns when component last recorded a heartbeat, or the zero time
+func (m *Metrics) LastHeartbeat(component string) time.Time {
+	if t, ok := m.heartbeats.Load(component); ok {
+		return t.(time.Time)
+	}
+	return time.Time{}
+}
+
+// RecordScan records a scan of bucket that completed without error, and counts it as a
+// scanner heartbeat
+func (m *Metrics) RecordScan(ctx context.Context, bucket string, at time.Time) {
+	m.LastScan.Record(ctx, float64(at.Unix()), metric.WithAttributes(
+		attribute.String("bucket", m.dimensions.value("bucket", bucket)),
+	))
+	m.RecordHeartbeat(ctx, "scanner")
+}
+
+// RecordSend records a batch accepted by endpoint
+func (m *Metrics) RecordSend(ctx context.Context, endpoint string, at time.Time) {
+	m.LastSend.Record(ctx, float64(at.Unix()), metric.WithAttributes(
+		attribute.String("component", "http_sender"),
+		attribute.String("endpoint", endpoint),
+	))
+}
+
+// RecordStateCompaction records a compaction run of the given state backend
+func (m *Metrics) RecordStateCompaction(ctx context.Context, backend string, removed, size int64, duration time.Duration) {
+	attrs := stateAttributes(backend)
+	m.StateSize.Record(ctx, size, attrs)
+	m.StateCompactedEntries.Add(ctx, removed, attrs)
+	m.StateCompactionDuration.Record(ctx, duration.Seconds(), attrs)
+}
+
+// RecordStateSave records a save of the given state backend
+func (m *Metrics) RecordStateSave(ctx context.Context, backend string, duration time.Duration, err error) {
+	attrs := stateAttributes(backend)
+	m.StateSaveLatency.Record(ctx, duration.Seconds(), attrs)
+	if err != nil {
+		m.StateSaveFailures.Add(ctx, 1, attrs)
+	}
+}
+
+// UpdateStateStatus records the checkpoint age and unsaved-change duration of the given state backend
+func (m *Metrics) UpdateStateStatus(ctx context.Context, backend string, checkpointAge, dirtyFor time.Duration) {
+	attrs := stateAttributes(backend)
+	m.StateCheckpointAge.Record(ctx, checkpointAge.Seconds(), attrs)
+	m.StateDirtyDuration.Record(ctx, dirtyFor.Seconds(), attrs)
+}
+
+// stateAttributes labels state measurements with the backend type
+func stateAttributes(backend string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("component", "state"),
+		attribute.String("backend", backend),
+	)
+}
+
+// endpointAttributes labels HTTP sender measurements with destination and feed
+func (m *Metrics) endpointAttributes(endpoint string, dims Dimensions, extra ...attribute.KeyValue) metric.MeasurementOption {
+	attrs := append(m.dimensionAttributes(dims),
+		attribute.String("component", "http_sender"),
+		attribute.String("endpoint", endpoint),
+	)
+	return metric.WithAttributes(append(attrs, extra...)...)
+}
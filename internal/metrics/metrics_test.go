@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 )
@@ -53,3 +54,36 @@ func TestMetrics_ShutdownWithNilProvider(t *testing.T) {
 		t.Errorf("Shutdown with nil provider returned error: %v", err)
 	}
 }
+
+func TestMetrics_Watchdog(t *testing.T) {
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{Prometheus: true}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	defer m.Shutdown(ctx)
+
+	m.RecordScan(ctx, "logs", time.Unix(1700000000, 0))
+	m.RecordScan(ctx, "logs", time.Unix(1700000060, 0))
+	m.RecordHeartbeat(ctx, "http_sender")
+	m.RecordSend(ctx, "http://a", time.Unix(1700000100, 0))
+	out := scrape(t, m)
+
+	if last := m.LastHeartbeat("scanner"); time.Since(last) > time.Minute {
+		t.Errorf("Expected a recent scanner heartbeat, got %v", last)
+	}
+	if last := m.LastHeartbeat("unknown"); !last.IsZero() {
+		t.Errorf("Expected no heartbeat for an unknown component, got %v", last)
+	}
+
+	for _, want := range []string{
+		`streamer_heartbeat_total{component="scanner"} 2`,
+		`streamer_heartbeat_total{component="http_sender"} 1`,
+		`last_successful_scan_timestamp_seconds{bucket="logs"} 1.70000006e+09`,
+		`last_successful_send_timestamp_seconds{component="http_sender",endpoint="http://a"} 1.7000001e+09`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+}
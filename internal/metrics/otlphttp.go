@@ -0,0 +1,297 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpHTTPPath is where OTLP/HTTP collectors receive metrics
+const otlpHTTPPath = "/v1/metrics"
+
+// LoadTLSConfig builds the TLS settings of an exporter: caFile adds a CA to trust, certFile
+// and keyFile set a client certificate. Empty files keep the system defaults.
+func LoadTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// otlpHTTPExporter exports metrics as OTLP protobuf over HTTP(S). It honors the
+// HTTPS_PROXY/NO_PROXY environment variables.
+type otlpHTTPExporter struct {
+	client      *http.Client
+	url         string
+	headers     map[string]string
+	temporality sdkmetric.TemporalitySelector
+}
+
+// newOTLPHTTPExporter creates an exporter for endpoint: a URL ("https://host/v1/metrics"; the
+// path defaults to /v1/metrics) or host:port, which uses https unless useInsecure is set
+func newOTLPHTTPExporter(endpoint string, useInsecure bool, headers map[string]string, tlsConfig *tls.Config, temporality sdkmetric.TemporalitySelector) (*otlpHTTPExporter, error) {
+	target, err := otlpHTTPURL(endpoint, useInsecure)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &otlpHTTPExporter{
+		client:      &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		url:         target,
+		headers:     headers,
+		temporality: temporality,
+	}, nil
+}
+
+// otlpHTTPURL returns the URL metrics are posted to
+func otlpHTTPURL(endpoint string, useInsecure bool) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		scheme := "https"
+		if useInsecure {
+			scheme = "http"
+		}
+		u, err = url.Parse(scheme + "://" + endpoint)
+		if err != nil {
+			return "", fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+		}
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpHTTPPath
+	}
+	return u.String(), nil
+}
+
+// Temporality implements sdkmetric.Exporter
+func (e *otlpHTTPExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return e.temporality(kind)
+}
+
+// Aggregation implements sdkmetric.Exporter
+func (e *otlpHTTPExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+// Export posts the metrics to the collector. Failed exports are not retried: cumulative
+// sums are complete again at the next interval.
+func (e *otlpHTTPExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	body, err := proto.Marshal(&colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{resourceMetricsProto(rm)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to export metrics: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// ForceFlush implements sdkmetric.Exporter; nothing is buffered
+func (e *otlpHTTPExporter) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// Shutdown implements sdkmetric.Exporter
+func (e *otlpHTTPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// resourceMetricsProto converts collected metrics to their OTLP form
+func resourceMetricsProto(rm *metricdata.ResourceMetrics) *metricpb.ResourceMetrics {
+	out := &metricpb.ResourceMetrics{Resource: &resourcepb.Resource{}}
+	if rm.Resource != nil {
+		out.Resource.Attributes = keyValuesProto(rm.Resource.Attributes())
+		out.SchemaUrl = rm.Resource.SchemaURL()
+	}
+	for _, sm := range rm.ScopeMetrics {
+		scope := &metricpb.ScopeMetrics{
+			Scope: &commonpb.InstrumentationScope{
+				Name:    sm.Scope.Name,
+				Version: sm.Scope.Version,
+			},
+			SchemaUrl: sm.Scope.SchemaURL,
+		}
+		for _, md := range sm.Metrics {
+			if m := metricProto(md); m != nil {
+				scope.Metrics = append(scope.Metrics, m)
+			}
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, scope)
+	}
+	return out
+}
+
+// metricProto converts one metric, or returns nil for an aggregation the streamer does not use
+func metricProto(md metricdata.Metrics) *metricpb.Metric {
+	m := &metricpb.Metric{Name: md.Name, Description: md.Description, Unit: md.Unit}
+	switch data := md.Data.(type) {
+	case metricdata.Sum[int64]:
+		m.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			DataPoints:             numberPointsProto(data.DataPoints),
+			AggregationTemporality: temporalityProto(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Sum[float64]:
+		m.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			DataPoints:             numberPointsProto(data.DataPoints),
+			AggregationTemporality: temporalityProto(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Gauge[int64]:
+		m.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberPointsProto(data.DataPoints)}}
+	case metricdata.Gauge[float64]:
+		m.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberPointsProto(data.DataPoints)}}
+	case metricdata.Histogram[float64]:
+		h := &metricpb.Histogram{AggregationTemporality: temporalityProto(data.Temporality)}
+		for _, dp := range data.DataPoints {
+			sum := dp.Sum
+			point := &metricpb.HistogramDataPoint{
+				Attributes:        keyValuesProto(dp.Attributes.ToSlice()),
+				StartTimeUnixNano: uint64(dp.StartTime.UnixNano()),
+				TimeUnixNano:      uint64(dp.Time.UnixNano()),
+				Count:             dp.Count,
+				Sum:               &sum,
+				BucketCounts:      dp.BucketCounts,
+				ExplicitBounds:    dp.Bounds,
+			}
+			if v, ok := dp.Min.Value(); ok {
+				point.Min = &v
+			}
+			if v, ok := dp.Max.Value(); ok {
+				point.Max = &v
+			}
+			point.Exemplars = exemplarsProto(dp.Exemplars)
+			h.DataPoints = append(h.DataPoints, point)
+		}
+		m.Data = &metricpb.Metric_Histogram{Histogram: h}
+	default:
+		return nil
+	}
+	return m
+}
+
+func numberPointsProto[N int64 | float64](points []metricdata.DataPoint[N]) []*metricpb.NumberDataPoint {
+	out := make([]*metricpb.NumberDataPoint, 0, len(points))
+	for _, dp := range points {
+		point := &metricpb.NumberDataPoint{
+			Attributes:        keyValuesProto(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: uint64(dp.StartTime.UnixNano()),
+			TimeUnixNano:      uint64(dp.Time.UnixNano()),
+			Exemplars:         exemplarsProto(dp.Exemplars),
+		}
+		switch v := any(dp.Value).(type) {
+		case int64:
+			point.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			point.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, point)
+	}
+	return out
+}
+
+func exemplarsProto[N int64 | float64](exemplars []metricdata.Exemplar[N]) []*metricpb.Exemplar {
+	if len(exemplars) == 0 {
+		return nil
+	}
+	out := make([]*metricpb.Exemplar, 0, len(exemplars))
+	for _, e := range exemplars {
+		ex := &metricpb.Exemplar{
+			FilteredAttributes: keyValuesProto(e.FilteredAttributes),
+			TimeUnixNano:       uint64(e.Time.UnixNano()),
+			SpanId:             e.SpanID,
+			TraceId:            e.TraceID,
+		}
+		switch v := any(e.Value).(type) {
+		case int64:
+			ex.Value = &metricpb.Exemplar_AsInt{AsInt: v}
+		case float64:
+			ex.Value = &metricpb.Exemplar_AsDouble{AsDouble: v}
+		}
+		out = append(out, ex)
+	}
+	return out
+}
+
+func temporalityProto(t metricdata.Temporality) metricpb.AggregationTemporality {
+	switch t {
+	case metricdata.DeltaTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	case metricdata.CumulativeTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	}
+	return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+}
+
+func keyValuesProto(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		value := &commonpb.AnyValue{}
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			value.Value = &commonpb.AnyValue_BoolValue{BoolValue: kv.Value.AsBool()}
+		case attribute.INT64:
+			value.Value = &commonpb.AnyValue_IntValue{IntValue: kv.Value.AsInt64()}
+		case attribute.FLOAT64:
+			value.Value = &commonpb.AnyValue_DoubleValue{DoubleValue: kv.Value.AsFloat64()}
+		default:
+			value.Value = &commonpb.AnyValue_StringValue{StringValue: kv.Value.Emit()}
+		}
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: value})
+	}
+	return out
+}
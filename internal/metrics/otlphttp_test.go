@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	requests := make(chan *colmetricpb.ExportMetricsServiceRequest, 10)
+	var apiKey, contentType, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, contentType, path = r.Header.Get("X-Api-Key"), r.Header.Get("Content-Type"), r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		var req colmetricpb.ExportMetricsServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("Failed to decode export: %v", err)
+		}
+		requests <- &req
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	exporters := Exporters{OTLP: true, OTLPProtocol: "http", OTLPHeaders: map[string]string{"X-Api-Key": "secret"}}
+	m, err := InitMetricsWithExporters(ctx, exporters, server.URL, "test-service", "1.0.0", time.Hour, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	m.RecordFileProcessed(ctx, Dimensions{Bucket: "logs", Prefix: "zscaler/", Format: "zscaler"}, 100, time.Second)
+	if err := m.Shutdown(ctx); err != nil { // Exports what was collected
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	var req *colmetricpb.ExportMetricsServiceRequest
+	select {
+	case req = <-requests:
+	default:
+		t.Fatal("Expected an export on shutdown")
+	}
+	if apiKey != "secret" || contentType != "application/x-protobuf" || path != "/v1/metrics" {
+		t.Errorf("Expected the header, protobuf and /v1/metrics, got %q, %q, %q", apiKey, contentType, path)
+	}
+
+	found := false
+	for _, sm := range req.ResourceMetrics[0].ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			if metric.Name == "s3_bytes_processed_total" {
+				found = true
+				if v := metric.GetSum().DataPoints[0].GetAsInt(); v != 100 {
+					t.Errorf("Expected 100 bytes, got %d", v)
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected s3_bytes_processed_total in the export")
+	}
+}
+
+func TestOTLPHTTPExporter_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	exporter, err := newOTLPHTTPExporter(server.URL, false, nil, nil, sdkmetric.DefaultTemporalitySelector)
+	if err != nil {
+		t.Fatalf("newOTLPHTTPExporter failed: %v", err)
+	}
+	if err := exporter.Export(context.Background(), &metricdata.ResourceMetrics{}); err == nil {
+		t.Error("Expected an error for a 401 response")
+	}
+}
+
+func TestOTLPHTTPURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		insecure bool
+		want     string
+	}{
+		{"collector:4318", false, "https://collector:4318/v1/metrics"},
+		{"collector:4318", true, "http://collector:4318/v1/metrics"},
+		{"https://otel.example.com", false, "https://otel.example.com/v1/metrics"},
+		{"https://otel.example.com/otlp/v1/metrics", false, "https://otel.example.com/otlp/v1/metrics"},
+	}
+	for _, tt := range tests {
+		got, err := otlpHTTPURL(tt.endpoint, tt.insecure)
+		if err != nil || got != tt.want {
+			t.Errorf("otlpHTTPURL(%q, %v): expected %s, got %s (%v)", tt.endpoint, tt.insecure, tt.want, got, err)
+		}
+	}
+}
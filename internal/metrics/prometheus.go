@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// prometheusContentType is the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusHandler serves the metrics in the Prometheus text format, or returns nil if
+// the Prometheus exporter is not enabled
+func (m *Metrics) PrometheusHandler() http.Handler {
+	if m.prometheusReader == nil {
+		return nil
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rm metricdata.ResourceMetrics
+		if err := m.prometheusReader.Collect(r.Context(), &rm); err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", prometheusContentType)
+		writePrometheus(w, &rm)
+	})
+}
+
+// NewPrometheusServer returns a server for scraping the metrics at path on a dedicated
+// address, for when the health server does not serve them. The caller runs ListenAndServe
+// and Shutdown.
+func (m *Metrics) NewPrometheusServer(address, path string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(path, m.PrometheusHandler())
+	return &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+}
+
+// writePrometheus writes collected metrics in the Prometheus text format. Names keep their
+// OTLP form (invalid characters become "_"); counters get a "_total" suffix if they lack one.
+func writePrometheus(w io.Writer, rm *metricdata.ResourceMetrics) error {
+	bw := bufio.NewWriter(w)
+	for _, sm := range rm.ScopeMetrics {
+		for _, md := range sm.Metrics {
+			name := prometheusName(md.Name)
+			switch data := md.Data.(type) {
+			case metricdata.Sum[int64]:
+				writeSum(bw, name, md.Description, data.IsMonotonic, data.DataPoints)
+			case metricdata.Sum[float64]:
+				writeSum(bw, name, md.Description, data.IsMonotonic, data.DataPoints)
+			case metricdata.Gauge[int64]:
+				writeHeader(bw, name, md.Description, "gauge")
+				writeSamples(bw, name, data.DataPoints)
+			case metricdata.Gauge[float64]:
+				writeHeader(bw, name, md.Description, "gauge")
+				writeSamples(bw, name, data.DataPoints)
+			case metricdata.Histogram[float64]:
+				writeHeader(bw, name, md.Description, "histogram")
+				for _, dp := range data.DataPoints {
+					writeHistogram(bw, name, dp)
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// writeSum writes a monotonic sum as a counter and any other sum as a gauge
+func writeSum[N int64 | float64](w *bufio.Writer, name, description string, monotonic bool, points []metricdata.DataPoint[N]) {
+	if !monotonic {
+		writeHeader(w, name, description, "gauge")
+		writeSamples(w, name, points)
+		return
+	}
+	if !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	writeHeader(w, name, description, "counter")
+	writeSamples(w, name, points)
+}
+
+func writeHeader(w *bufio.Writer, name, description, kind string) {
+	if description != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(description))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeSamples[N int64 | float64](w *bufio.Writer, name string, points []metricdata.DataPoint[N]) {
+	for _, dp := range points {
+		writeSample(w, name, labels(dp.Attributes, ""), float64(dp.Value))
+	}
+}
+
+// writeHistogram writes one histogram's cumulative buckets, sum and count
+func writeHistogram(w *bufio.Writer, name string, dp metricdata.HistogramDataPoint[float64]) {
+	var cumulative uint64
+	for i, bound := range dp.Bounds {
+		if i < len(dp.BucketCounts) {
+			cumulative += dp.BucketCounts[i]
+		}
+		writeSample(w, name+"_bucket", labels(dp.Attributes, formatFloat(bound)), float64(cumulative))
+	}
+	writeSample(w, name+"_bucket", labels(dp.Attributes, "+Inf"), float64(dp.Count))
+	writeSample(w, name+"_sum", labels(dp.Attributes, ""), dp.Sum)
+	writeSample(w, name+"_count", labels(dp.Attributes, ""), float64(dp.Count))
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(value))
+}
+
+// labels formats an attribute set as a label list, adding an "le" label if le is set
+func labels(attrs attribute.Set, le string) string {
+	if attrs.Len() == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	iter := attrs.Iter()
+	for iter.Next() {
+		kv := iter.Attribute()
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", prometheusName(string(kv.Key)), escapeLabel(kv.Value.Emit()))
+	}
+	if le != "" {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "le=%q", le)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// prometheusName replaces the characters Prometheus does not allow in names with "_"
+func prometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
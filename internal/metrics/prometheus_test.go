@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{Prometheus: true}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	defer m.Shutdown(ctx)
+
+	m.RecordFileProcessed(ctx, Dimensions{Bucket: "logs", Prefix: "zscaler/", Format: "zscaler"}, 100, 250*time.Millisecond)
+	m.RecordLongLines(ctx, Dimensions{}, 2, "split")
+	m.RecordDeliveryLatency(ctx, "http://ed:8080", Dimensions{Bucket: "logs"}, 90*time.Second)
+
+	rec := httptest.NewRecorder()
+	m.PrometheusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	out := string(body)
+
+	for _, want := range []string{
+		"# TYPE s3_files_processed_total counter\n" + `s3_files_processed_total{bucket="logs",format="zscaler",prefix="zscaler/"} 1` + "\n",
+		`s3_bytes_processed_total{bucket="logs",format="zscaler",prefix="zscaler/"} 100`,
+		`s3_long_lines_total{bucket="unknown",format="unknown",policy="split",prefix="unknown"} 2`,
+		"# TYPE s3_processing_latency_seconds histogram\n",
+		`s3_processing_latency_seconds_bucket{bucket="logs",format="zscaler",prefix="zscaler/",le="+Inf"} 1`,
+		`s3_processing_latency_seconds_count{bucket="logs",format="zscaler",prefix="zscaler/"} 1`,
+		`http_delivery_latency_seconds_bucket{bucket="logs",component="http_sender",endpoint="http://ed:8080",format="unknown",prefix="unknown",le="60"} 0`,
+		`http_delivery_latency_seconds_bucket{bucket="logs",component="http_sender",endpoint="http://ed:8080",format="unknown",prefix="unknown",le="120"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != prometheusContentType {
+		t.Errorf("Expected content type %q, got %q", prometheusContentType, ct)
+	}
+}
+
+func TestPrometheusHandler_Disabled(t *testing.T) {
+	if (&Metrics{}).PrometheusHandler() != nil {
+		t.Error("Expected no handler without the Prometheus exporter")
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	if got := prometheusName("http.status-code"); got != "http_status_code" {
+		t.Errorf("Expected http_status_code, got %s", got)
+	}
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("Expected escaped label, got %s", got)
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// WorkerPoolStats are read from a worker pool each time metrics are collected
+type WorkerPoolStats struct {
+	QueueDepth    func() int64 // Files waiting in the job queue
+	ActiveWorkers func() int64 // Workers running
+	BusyWorkers   func() int64 // Workers processing a file
+}
+
+// SenderStats are read from an HTTP sender each time metrics are collected
+type SenderStats struct {
+	BatchQueue func() int64 // Batches waiting for an HTTP worker
+	InFlight   func() int64 // HTTP requests in progress
+}
+
+// ObserveWorkerPool reports a pool's saturation gauges, labelled with its bucket, until the
+// registration is unregistered. It returns a nil registration if metrics are not initialized.
+func (m *Metrics) ObserveWorkerPool(bucket string, stats WorkerPoolStats) (metric.Registration, error) {
+	if m.meter == nil {
+		return nil, nil
+	}
+	attrs := metric.WithAttributes(attribute.String("bucket", m.dimensions.value("bucket", bucket)))
+	return m.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(m.QueueDepth, stats.QueueDepth(), attrs)
+		o.ObserveInt64(m.ActiveWorkers, stats.ActiveWorkers(), attrs)
+		o.ObserveInt64(m.BusyWorkers, stats.BusyWorkers(), attrs)
+		return nil
+	}, m.QueueDepth, m.ActiveWorkers, m.BusyWorkers)
+}
+
+// ObserveHTTPSender reports a sender's saturation gauges until the registration is
+// unregistered. It returns a nil registration if metrics are not initialized.
+func (m *Metrics) ObserveHTTPSender(stats SenderStats) (metric.Registration, error) {
+	if m.meter == nil {
+		return nil, nil
+	}
+	attrs := metric.WithAttributes(attribute.String("component", "http_sender"))
+	return m.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(m.HTTPBatchQueue, stats.BatchQueue(), attrs)
+		o.ObserveInt64(m.HTTPInFlight, stats.InFlight(), attrs)
+		return nil
+	}, m.HTTPBatchQueue, m.HTTPInFlight)
+}
+
+// ObserveCredentials reports the age of the AWS credentials in use and the time until they
+// expire (see credentials.Rotator.Age and Expiry; no expiry is reported for credentials that
+// do not expire) until the registration is unregistered. It returns a nil registration if
+// metrics are not initialized.
+func (m *Metrics) ObserveCredentials(age func() time.Duration, expiry func() (time.Duration, bool)) (metric.Registration, error) {
+	if m.meter == nil {
+		return nil, nil
+	}
+	return m.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveFloat64(m.CredentialAge, age().Seconds())
+		if left, ok := expiry(); ok {
+			o.ObserveFloat64(m.CredentialExpiry, left.Seconds())
+		}
+		return nil
+	}, m.CredentialAge, m.CredentialExpiry)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserveWorkerPoolAndSender(t *testing.T) {
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{Prometheus: true}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	defer m.Shutdown(ctx)
+
+	pool, err := m.ObserveWorkerPool("logs", WorkerPoolStats{
+		QueueDepth:    func() int64 { return 7 },
+		ActiveWorkers: func() int64 { return 4 },
+		BusyWorkers:   func() int64 { return 3 },
+	})
+	if err != nil {
+		t.Fatalf("ObserveWorkerPool failed: %v", err)
+	}
+	sender, err := m.ObserveHTTPSender(SenderStats{
+		BatchQueue: func() int64 { return 2 },
+		InFlight:   func() int64 { return 1 },
+	})
+	if err != nil {
+		t.Fatalf("ObserveHTTPSender failed: %v", err)
+	}
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`s3_queue_depth{bucket="logs"} 7`,
+		`s3_active_workers{bucket="logs"} 4`,
+		`s3_busy_workers{bucket="logs"} 3`,
+		`http_batch_queue_depth{component="http_sender"} 2`,
+		`http_requests_in_flight{component="http_sender"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	pool.Unregister()
+	sender.Unregister()
+	if out := scrape(t, m); strings.Contains(out, "s3_queue_depth{") || strings.Contains(out, "http_requests_in_flight{") {
+		t.Errorf("Expected no gauges after unregistering, got:\n%s", out)
+	}
+}
+
+func TestObserveWorkerPool_Uninitialized(t *testing.T) {
+	reg, err := (&Metrics{}).ObserveWorkerPool("logs", WorkerPoolStats{})
+	if reg != nil || err != nil {
+		t.Errorf("Expected no registration without a meter, got %v, %v", reg, err)
+	}
+}
+
+func TestObserveCredentials(t *testing.T) {
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{Prometheus: true}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	defer m.Shutdown(ctx)
+
+	expiry, expires := time.Duration(0), false
+	reg, err := m.ObserveCredentials(
+		func() time.Duration { return 90 * time.Second },
+		func() (time.Duration, bool) { return expiry, expires },
+	)
+	if err != nil {
+		t.Fatalf("ObserveCredentials failed: %v", err)
+	}
+	defer reg.Unregister()
+	out := scrape(t, m)
+	if !strings.Contains(out, "aws_credentials_age_seconds 90") {
+		t.Errorf("Expected the credential age gauge, got:\n%s", out)
+	}
+	if strings.Contains(out, "aws_credentials_expiry_seconds ") {
+		t.Errorf("Expected no expiry gauge for long-term credentials, got:\n%s", out)
+	}
+
+	expiry, expires = 10*time.Minute, true
+	if out := scrape(t, m); !strings.Contains(out, "aws_credentials_expiry_seconds 600") {
+		t.Errorf("Expected the credential expiry gauge, got:\n%s", out)
+	}
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.PrometheusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
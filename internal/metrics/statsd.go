@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// statsDMaxPacket keeps each UDP packet under a typical 1500 byte MTU
+const statsDMaxPacket = 1432
+
+// StatsDOptions configures sending the metrics to a StatsD or DogStatsD agent over UDP
+type StatsDOptions struct {
+	Address  string            // Agent address, e.g. "127.0.0.1:8125"
+	Prefix   string            // Prepended to every metric name with a ".", e.g. "s3_streamer"
+	Tags     map[string]string // Added to every metric (DogStatsD only), e.g. {"env": "prod"}
+	Plain    bool              // Plain StatsD: no tags, so attributes are dropped
+	Interval time.Duration     // How often to send
+}
+
+// statsDExporter sends metrics as StatsD lines. Counters are sent as the increase since the
+// last send ("|c"), gauges and up-down counters as their value ("|g"), and histograms as
+// ".count" and ".sum" counters. Attributes become DogStatsD tags.
+type statsDExporter struct {
+	opts StatsDOptions
+	tags []string // Configured tags, sorted
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newStatsDExporter(opts StatsDOptions) *statsDExporter {
+	e := &statsDExporter{opts: opts}
+	for name, value := range opts.Tags {
+		e.tags = append(e.tags, statsDTag(name)+":"+statsDTag(value))
+	}
+	sort.Strings(e.tags)
+	return e
+}
+
+// Temporality implements sdkmetric.Exporter: counters and histograms are exported as deltas
+func (e *statsDExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+		return metricdata.CumulativeTemporality
+	}
+	return metricdata.DeltaTemporality
+}
+
+// Aggregation implements sdkmetric.Exporter
+func (e *statsDExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+// Export sends the metrics, packing as many lines into each packet as fit
+func (e *statsDExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	var lines []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, md := range sm.Metrics {
+			lines = e.appendLines(lines, md)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		conn, err := net.Dial("udp", e.opts.Address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to StatsD agent: %w", err)
+		}
+		e.conn = conn
+	}
+
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsDMaxPacket {
+			if _, err := e.conn.Write(packet.Bytes()); err != nil {
+				return fmt.Errorf("failed to send StatsD metrics: %w", err)
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if _, err := e.conn.Write(packet.Bytes()); err != nil {
+		return fmt.Errorf("failed to send StatsD metrics: %w", err)
+	}
+	return nil
+}
+
+// appendLines appends the StatsD lines of one metric
+func (e *statsDExporter) appendLines(lines []string, md metricdata.Metrics) []string {
+	name := statsDName(md.Name)
+	if e.opts.Prefix != "" {
+		name = statsDName(e.opts.Prefix) + "." + name
+	}
+	switch data := md.Data.(type) {
+	case metricdata.Sum[int64]:
+		kind := sumKind(data.IsMonotonic)
+		for _, dp := range data.DataPoints {
+			lines = append(lines, e.line(name, strconv.FormatInt(dp.Value, 10), kind, dp.Attributes))
+		}
+	case metricdata.Sum[float64]:
+		kind := sumKind(data.IsMonotonic)
+		for _, dp := range data.DataPoints {
+			lines = append(lines, e.line(name, statsDFloat(dp.Value), kind, dp.Attributes))
+		}
+	case metricdata.Gauge[int64]:
+		for _, dp := range data.DataPoints {
+			lines = append(lines, e.line(name, strconv.FormatInt(dp.Value, 10), "g", dp.Attributes))
+		}
+	case metricdata.Gauge[float64]:
+		for _, dp := range data.DataPoints {
+			lines = append(lines, e.line(name, statsDFloat(dp.Value), "g", dp.Attributes))
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range data.DataPoints {
+			if dp.Count == 0 {
+				continue
+			}
+			lines = append(lines,
+				e.line(name+".count", strconv.FormatUint(dp.Count, 10), "c", dp.Attributes),
+				e.line(name+".sum", statsDFloat(dp.Sum), "c", dp.Attributes),
+			)
+		}
+	}
+	return lines
+}
+
+// sumKind returns the StatsD type of a sum: monotonic sums are exported as deltas
+func sumKind(monotonic bool) string {
+	if monotonic {
+		return "c"
+	}
+	return "g"
+}
+
+// line formats one StatsD line, with the configured tags and attrs unless Plain is set
+func (e *statsDExporter) line(name, value, kind string, attrs attribute.Set) string {
+	line := name + ":" + value + "|" + kind
+	if e.opts.Plain {
+		return line
+	}
+	tags := append([]string(nil), e.tags...)
+	iter := attrs.Iter()
+	for iter.Next() {
+		kv := iter.Attribute()
+		tags = append(tags, statsDTag(string(kv.Key))+":"+statsDTag(kv.Value.Emit()))
+	}
+	if len(tags) == 0 {
+		return line
+	}
+	return line + "|#" + strings.Join(tags, ",")
+}
+
+// ForceFlush implements sdkmetric.Exporter; nothing is buffered
+func (e *statsDExporter) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// Shutdown implements sdkmetric.Exporter
+func (e *statsDExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// statsDName replaces the characters that delimit StatsD lines with "_"
+func statsDName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// statsDTag replaces the characters that delimit DogStatsD tags with "_"
+func statsDTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func statsDFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestStatsDExporter(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer agent.Close()
+
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{StatsD: &StatsDOptions{
+		Address:  agent.LocalAddr().String(),
+		Prefix:   "s3_streamer",
+		Tags:     map[string]string{"env": "prod"},
+		Interval: time.Hour,
+	}}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	m.RecordFileProcessed(ctx, Dimensions{Bucket: "logs", Prefix: "app/", Format: "json"}, 100, 2*time.Second)
+	m.UpdateProcessingLag(ctx, 42)
+	if err := m.Shutdown(ctx); err != nil { // Sends what was collected
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	var received []string
+	buf := make([]byte, statsDMaxPacket)
+	agent.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := agent.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > statsDMaxPacket {
+			t.Errorf("Expected packets of at most %d bytes, got %d", statsDMaxPacket, n)
+		}
+		received = append(received, strings.Split(string(buf[:n]), "\n")...)
+		agent.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	}
+	all := strings.Join(received, "\n")
+
+	for _, want := range []string{
+		"s3_streamer.s3_files_processed_total:1|c|#env:prod,bucket:logs,format:json,prefix:app/",
+		"s3_streamer.s3_bytes_processed_total:100|c|#env:prod,bucket:logs,format:json,prefix:app/",
+		"s3_streamer.processing_lag_seconds:42|g|#env:prod",
+		"s3_streamer.s3_processing_latency_seconds.count:1|c|",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Expected a line containing %q, got:\n%s", want, all)
+		}
+	}
+}
+
+func TestStatsDExporter_Plain(t *testing.T) {
+	e := newStatsDExporter(StatsDOptions{Plain: true, Tags: map[string]string{"env": "prod"}})
+	if got := e.line("files", "1", "c", attribute.NewSet(attribute.String("bucket", "logs"))); got != "files:1|c" {
+		t.Errorf("Expected no tags, got %q", got)
+	}
+	if got := statsDName("a:b|c@d"); got != "a_b_c_d" {
+		t.Errorf("Expected delimiters replaced, got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// DefaultHistogramBuckets is the key of HistogramBuckets that applies to histograms not
+// listed by name
+const DefaultHistogramBuckets = "default"
+
+// histogramView drops the exemplar-only attributes from every histogram's series and
+// overrides the bucket boundaries of histograms listed in buckets by instrument name, then
+// of every other histogram if buckets has a "default" entry
+func histogramView(buckets map[string][]float64) sdkmetric.View {
+	return func(i sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		if i.Kind != sdkmetric.InstrumentKindHistogram {
+			return sdkmetric.Stream{}, false
+		}
+		stream := sdkmetric.Stream{
+			Name:        i.Name,
+			Description: i.Description,
+			Unit:        i.Unit,
+			AttributeFilter: func(kv attribute.KeyValue) bool {
+				return !isExemplarOnly(kv)
+			},
+		}
+		bounds, ok := buckets[i.Name]
+		if !ok {
+			bounds, ok = buckets[DefaultHistogramBuckets]
+		}
+		if ok {
+			stream.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: bounds}
+		}
+		return stream, true
+	}
+}
+
+// temporalitySelector returns the OTLP temporality preference: "delta" exports counters and
+// histograms as deltas (up-down counters stay cumulative); anything else is cumulative
+func temporalitySelector(temporality string) sdkmetric.TemporalitySelector {
+	if temporality != "delta" {
+		return sdkmetric.DefaultTemporalitySelector
+	}
+	return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+		switch kind {
+		case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+			return metricdata.CumulativeTemporality
+		}
+		return metricdata.DeltaTemporality
+	}
+}
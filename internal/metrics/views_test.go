@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	ctx := context.Background()
+	m, err := InitMetricsWithExporters(ctx, Exporters{
+		Prometheus: true,
+		HistogramBuckets: map[string][]float64{
+			"http_request_duration_seconds": {0.005, 0.01, 0.025},
+			DefaultHistogramBuckets:         {1, 10},
+		},
+	}, "", "test-service", "1.0.0", 0, false)
+	if err != nil {
+		t.Fatalf("InitMetricsWithExporters failed: %v", err)
+	}
+	defer m.Shutdown(ctx)
+
+	m.RecordHTTPRequestLatency(ctx, "http://a", Dimensions{}, 0.007)
+	m.RecordFileProcessed(ctx, Dimensions{}, 10, 2*time.Second)
+	out := scrape(t, m)
+
+	for _, want := range []string{
+		`http_request_duration_seconds_bucket{bucket="unknown",component="http_sender",endpoint="http://a",format="unknown",prefix="unknown",le="0.005"} 0`,
+		`http_request_duration_seconds_bucket{bucket="unknown",component="http_sender",endpoint="http://a",format="unknown",prefix="unknown",le="0.01"} 1`,
+		`s3_processing_latency_seconds_bucket{bucket="unknown",format="unknown",prefix="unknown",le="10"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `s3_processing_latency_seconds_bucket{bucket="unknown",format="unknown",prefix="unknown",le="5"}`) {
+		t.Error("Expected the default buckets to replace the SDK defaults")
+	}
+}
+
+func TestTemporalitySelector(t *testing.T) {
+	delta := temporalitySelector("delta")
+	if delta(sdkmetric.InstrumentKindCounter) != metricdata.DeltaTemporality || delta(sdkmetric.InstrumentKindHistogram) != metricdata.DeltaTemporality {
+		t.Error("Expected counters and histograms as deltas")
+	}
+	if delta(sdkmetric.InstrumentKindUpDownCounter) != metricdata.CumulativeTemporality {
+		t.Error("Expected up-down counters to stay cumulative")
+	}
+	if temporalitySelector("cumulative")(sdkmetric.InstrumentKindCounter) != metricdata.CumulativeTemporality {
+		t.Error("Expected cumulative counters by default")
+	}
+}
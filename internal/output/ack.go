@@ -0,0 +1,175 @@
+package output
+
+import "sync"
+
+// Ack tracks delivery of every line queued for a single file.
+// The completion callback fires exactly once, after the producer has sealed
+// the ack and every queued line has either been delivered or failed.
+type Ack struct {
+	mu      sync.Mutex
+	pending int
+	sealed  bool
+	fired   bool
+	err     error
+	onDone  func(err error)
+
+	// Contiguous delivery watermark, reported through onProgress
+	delivered  int64
+	ranges     map[int64]int64 // Delivered line ranges (first -> last) beyond the watermark
+	onProgress func(delivered int64)
+
+	destinations map[string]*DestinationResult
+}
+
+// Destinations of lines that did not reach an endpoint (see DestinationResult)
+const (
+	DestinationSpill   = "spill"   // Spilled to disk, sent again on the next start
+	DestinationDropped = "dropped" // Discarded by a drop buffer policy; counted as done
+	DestinationUnsent  = "unsent"  // Abandoned or discarded before reaching an endpoint
+)
+
+// DestinationResult counts a file's lines resolved by one destination: an endpoint URL,
+// DestinationSpill, DestinationDropped or DestinationUnsent
+type DestinationResult struct {
+	Lines  int    `json:"lines"`            // Lines accepted
+	Failed int    `json:"failed,omitempty"` // Lines that failed
+	Error  string `json:"error,omitempty"`  // First failure
+}
+
+// NewAck creates an ack that calls onDone when all lines are resolved.
+// onDone receives nil only if every line was accepted by an endpoint.
+func NewAck(onDone func(err error)) *Ack {
+	return &Ack{onDone: onDone}
+}
+
+// Seal marks that no more lines will be queued for this file
+func (a *Ack) Seal() {
+	a.mu.Lock()
+	a.sealed = true
+	a.mu.Unlock()
+	a.maybeFire()
+}
+
+// Fail seals the ack with an error (e.g. the file could not be fully read).
+// Lines already queued are still sent, but the callback reports the failure.
+func (a *Ack) Fail(err error) {
+	a.mu.Lock()
+	if a.err == nil {
+		a.err = err
+	}
+	a.sealed = true
+	a.mu.Unlock()
+	a.maybeFire()
+}
+
+// OnProgress registers fn to be called whenever every line offset in [start, delivered)
+// has been accepted by an endpoint. start is the offset of the first line queued
+// (see Source.ResumeAt). Calls are serialized and delivered only increases.
+// It must be set before any line is queued.
+func (a *Ack) OnProgress(start int64, fn func(delivered int64)) {
+	a.mu.Lock()
+	a.delivered = start
+	a.onProgress = fn
+	a.mu.Unlock()
+}
+
+// deliver records that lines first..last were accepted and advances the watermark
+func (a *Ack) deliver(first, last int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.onProgress == nil {
+		return
+	}
+	if first != a.delivered {
+		if a.ranges == nil {
+			a.ranges = make(map[int64]int64)
+		}
+		a.ranges[first] = last
+		return
+	}
+
+	a.delivered = last + 1
+	for {
+		next, ok := a.ranges[a.delivered]
+		if !ok {
+			break
+		}
+		delete(a.ranges, a.delivered)
+		a.delivered = next + 1
+	}
+	a.onProgress(a.delivered)
+}
+
+// Pending returns the number of queued lines not yet resolved
+func (a *Ack) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pending
+}
+
+// add registers n lines as queued
+func (a *Ack) add(n int) {
+	a.mu.Lock()
+	a.pending += n
+	a.mu.Unlock()
+}
+
+// resolve marks n lines that never reached an endpoint as delivered (err == nil) or failed
+func (a *Ack) resolve(n int, err error) {
+	a.resolveAt(n, DestinationUnsent, err)
+}
+
+// resolveAt marks n lines as delivered (err == nil) or failed by destination
+func (a *Ack) resolveAt(n int, destination string, err error) {
+	a.mu.Lock()
+	a.pending -= n
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	if a.destinations == nil {
+		a.destinations = make(map[string]*DestinationResult)
+	}
+	result := a.destinations[destination]
+	if result == nil {
+		result = &DestinationResult{}
+		a.destinations[destination] = result
+	}
+	if err == nil {
+		result.Lines += n
+	} else {
+		result.Failed += n
+		if result.Error == "" {
+			result.Error = err.Error()
+		}
+	}
+	a.mu.Unlock()
+	a.maybeFire()
+}
+
+// Destinations returns the lines resolved so far by destination
+func (a *Ack) Destinations() map[string]DestinationResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	results := make(map[string]DestinationResult, len(a.destinations))
+	for destination, result := range a.destinations {
+		results[destination] = *result
+	}
+	return results
+}
+
+// maybeFire invokes the callback once the ack is sealed and drained
+func (a *Ack) maybeFire() {
+	a.mu.Lock()
+	if a.fired || !a.sealed || a.pending > 0 {
+		a.mu.Unlock()
+		return
+	}
+	a.fired = true
+	err := a.err
+	a.mu.Unlock()
+
+	if a.onDone != nil {
+		a.onDone(err)
+	}
+}
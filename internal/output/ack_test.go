@@ -0,0 +1,133 @@
+package output
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAck_FiresAfterSealAndDrain(t *testing.T) {
+	fired := 0
+	var result error
+	ack := NewAck(func(err error) {
+		fired++
+		result = err
+	})
+
+	ack.add(2)
+	ack.resolve(1, nil)
+	ack.Seal()
+	if fired != 0 {
+		t.Fatal("Ack fired before all lines were resolved")
+	}
+
+	ack.resolve(1, nil)
+	if fired != 1 {
+		t.Fatalf("Expected ack to fire once, fired %d times", fired)
+	}
+	if result != nil {
+		t.Errorf("Expected nil error, got %v", result)
+	}
+
+	ack.Seal()
+	if fired != 1 {
+		t.Errorf("Ack fired again after completion")
+	}
+}
+
+func TestAck_ReportsFailure(t *testing.T) {
+	var result error
+	ack := NewAck(func(err error) { result = err })
+
+	ack.add(2)
+	ack.resolve(1, errors.New("HTTP 500"))
+	ack.resolve(1, nil)
+	ack.Seal()
+
+	if result == nil || result.Error() != "HTTP 500" {
+		t.Errorf("Expected HTTP 500 error, got %v", result)
+	}
+}
+
+func TestAck_ProgressWatermark(t *testing.T) {
+	var progress []int64
+	ack := NewAck(nil)
+	ack.OnProgress(10, func(delivered int64) { progress = append(progress, delivered) })
+
+	// Batches complete out of order; the watermark only moves over contiguous ranges
+	ack.deliver(15, 19)
+	if len(progress) != 0 {
+		t.Fatalf("Expected no progress past a gap, got %v", progress)
+	}
+	ack.deliver(10, 14)
+	ack.deliver(20, 24)
+
+	if len(progress) != 2 || progress[0] != 20 || progress[1] != 25 {
+		t.Errorf("Expected progress [20 25], got %v", progress)
+	}
+}
+
+func TestAck_SealWithoutLines(t *testing.T) {
+	fired := false
+	ack := NewAck(func(err error) { fired = true })
+	ack.Seal()
+	if !fired {
+		t.Error("Expected ack with no lines to fire on Seal")
+	}
+}
+
+func TestHTTPSender_AcksAfterDelivery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		2, 1024*1024, 50*time.Millisecond, 1, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+	)
+	sender.Start()
+	defer sender.Stop()
+
+	done := make(chan error, 1)
+	ack := NewAck(func(err error) { done <- err })
+	src := &Source{S3Key: "ok", Ack: ack}
+	for i := 0; i < 5; i++ {
+		sender.SendLineFrom(src, []byte("line"))
+	}
+	ack.Seal()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected successful delivery, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for delivery acknowledgement")
+	}
+}
+
+func TestAck_Destinations(t *testing.T) {
+	ack := NewAck(nil)
+	ack.add(6)
+	ack.resolveAt(3, "http://a", nil)
+	ack.resolveAt(1, "http://a", errors.New("HTTP 500"))
+	ack.resolveAt(1, DestinationSpill, ErrSpilled)
+	ack.resolve(1, errors.New("dropped"))
+
+	got := ack.Destinations()
+	if d := got["http://a"]; d.Lines != 3 || d.Failed != 1 || d.Error != "HTTP 500" {
+		t.Errorf("Expected 3 lines accepted and 1 failed by http://a, got %+v", d)
+	}
+	if d := got[DestinationSpill]; d.Failed != 1 {
+		t.Errorf("Expected 1 spilled line, got %+v", d)
+	}
+	if d := got[DestinationUnsent]; d.Failed != 1 || d.Error != "dropped" {
+		t.Errorf("Expected 1 unsent line, got %+v", d)
+	}
+}
@@ -0,0 +1,87 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+)
+
+// BatchIDHeader carries the batch's idempotency key so receivers can de-duplicate retried batches
+const BatchIDHeader = "X-Batch-Id"
+
+// batchSegment is a run of consecutive lines from one source
+type batchSegment struct {
+	src   *Source
+	first int64 // Line offset within the source of the first line
+	last  int64 // Line offset within the source of the last line
+}
+
+// track records the line's position for the batch ID
+func (b *Batch) track(line queuedLine) {
+	if line.src == nil {
+		// No position to identify the line by; fall back to its content
+		if b.unsourced == nil {
+			b.unsourced = sha256.New()
+		}
+		b.unsourced.Write(line.data)
+		b.unsourced.Write([]byte{'\n'})
+		return
+	}
+
+	if n := len(b.segments); n > 0 {
+		seg := &b.segments[n-1]
+		if seg.src == line.src && seg.last+1 == line.offset {
+			seg.last = line.offset
+			return
+		}
+	}
+	b.segments = append(b.segments, batchSegment{src: line.src, first: line.offset, last: line.offset})
+}
+
+// ID returns a deterministic identifier for the batch derived from the S3 keys and
+// line offsets it contains. The batcher cuts batches at fixed windows of each source's
+// offsets, so re-sending the same lines yields the same ID whatever else is sent alongside.
+// Only a batch flushed part-way through its window by the flush interval, because its
+// producer fell behind, may be cut differently when resent; its ID then differs too, so no
+// two different sets of lines share an ID. Lines of a tagged replay also include the
+// replay ID, so receivers do not discard them as duplicates.
+func (b *Batch) ID() string {
+	if b.id != "" {
+		return b.id
+	}
+
+	h := sha256.New()
+	for _, seg := range b.segments {
+		h.Write([]byte(seg.src.Bucket))
+		h.Write([]byte{'/'})
+		h.Write([]byte(seg.src.S3Key))
+		h.Write([]byte{':'})
+		h.Write(strconv.AppendInt(nil, seg.first, 10))
+		h.Write([]byte{'-'})
+		h.Write(strconv.AppendInt(nil, seg.last, 10))
+		if seg.src.Replay != "" {
+			h.Write([]byte{'@'})
+			h.Write([]byte(seg.src.Replay))
+		}
+		h.Write([]byte{'\n'})
+	}
+	if b.unsourced != nil {
+		h.Write(b.unsourced.Sum(nil))
+	}
+
+	b.id = hex.EncodeToString(h.Sum(nil)[:16])
+	return b.id
+}
+
+// processingIDs returns the processing IDs of the files with lines in the batch, so its
+// log lines can be found by the IDs of its files
+func (b *Batch) processingIDs() []string {
+	var ids []string
+	for _, seg := range b.segments {
+		if id := seg.src.ProcessingID; id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
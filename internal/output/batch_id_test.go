@@ -0,0 +1,205 @@
+package output
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBatch(src *Source, first, count int64) *Batch {
+	batch := &Batch{}
+	for i := first; i < first+count; i++ {
+		batch.add(queuedLine{data: []byte("line"), src: src, offset: i})
+	}
+	return batch
+}
+
+func TestBatch_IDDeterministic(t *testing.T) {
+	src := &Source{Bucket: "logs", S3Key: "a.gz"}
+	again := &Source{Bucket: "logs", S3Key: "a.gz", ProcessingID: "2f1c9e0a7b3d4e5f"} // Same file read again after a restart
+
+	id := newTestBatch(src, 0, 10).ID()
+	if id == "" {
+		t.Fatal("Expected non-empty batch ID")
+	}
+	if other := newTestBatch(again, 0, 10).ID(); other != id {
+		t.Errorf("Expected same ID for same lines, got %s and %s", id, other)
+	}
+	if other := newTestBatch(src, 10, 10).ID(); other == id {
+		t.Error("Expected different ID for different offsets")
+	}
+	if other := newTestBatch(&Source{Bucket: "logs", S3Key: "b.gz"}, 0, 10).ID(); other == id {
+		t.Error("Expected different ID for different S3 key")
+	}
+	if other := newTestBatch(&Source{Bucket: "logs", S3Key: "a.gz", Replay: "replay-1"}, 0, 10).ID(); other == id {
+		t.Error("Expected different ID for a tagged replay")
+	}
+}
+
+func TestBatch_ProcessingIDs(t *testing.T) {
+	a := &Source{S3Key: "a.gz", ProcessingID: "aaaa"}
+	b := &Source{S3Key: "b.gz", ProcessingID: "bbbb"}
+	batch := &Batch{}
+	for _, src := range []*Source{a, a, b, a, {S3Key: "c.gz"}} {
+		batch.add(queuedLine{data: []byte("line"), src: src, offset: src.nextOffset})
+		src.nextOffset++
+	}
+	if ids := batch.processingIDs(); len(ids) != 2 || ids[0] != "aaaa" || ids[1] != "bbbb" {
+		t.Errorf("Expected each file's processing ID once, got %v", ids)
+	}
+}
+
+func TestBatch_IDSegments(t *testing.T) {
+	a := &Source{Bucket: "logs", S3Key: "a.gz"}
+	b := &Source{Bucket: "logs", S3Key: "b.gz"}
+
+	batch := &Batch{}
+	batch.add(queuedLine{data: []byte("1"), src: a, offset: 0})
+	batch.add(queuedLine{data: []byte("2"), src: a, offset: 1})
+	batch.add(queuedLine{data: []byte("3"), src: b, offset: 0})
+	batch.add(queuedLine{data: []byte("4"), src: a, offset: 2})
+
+	if len(batch.segments) != 3 {
+		t.Errorf("Expected 3 segments, got %d", len(batch.segments))
+	}
+	if seg := batch.segments[0]; seg.first != 0 || seg.last != 1 {
+		t.Errorf("Expected first segment 0-1, got %d-%d", seg.first, seg.last)
+	}
+}
+
+func TestBatch_IDUnsourced(t *testing.T) {
+	newBatch := func(lines ...string) *Batch {
+		batch := &Batch{}
+		for _, line := range lines {
+			batch.add(queuedLine{data: []byte(line)})
+		}
+		return batch
+	}
+
+	if newBatch("a", "b").ID() != newBatch("a", "b").ID() {
+		t.Error("Expected same ID for same content")
+	}
+	if newBatch("a", "b").ID() == newBatch("a", "c").ID() {
+		t.Error("Expected different ID for different content")
+	}
+}
+
+func TestHTTPSender_BatchIDHeader(t *testing.T) {
+	received := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(BatchIDHeader)
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		1000, 1024*1024, time.Second, 1, 10,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithRetry(1, time.Millisecond, time.Millisecond),
+	)
+
+	batch := newTestBatch(&Source{Bucket: "logs", S3Key: "a.gz"}, 0, 3)
+	if err := sender.sendWithRetry(batch, server.URL, 0); err != nil {
+		t.Fatalf("sendWithRetry failed: %v", err)
+	}
+
+	first, second := <-received, <-received
+	if first != batch.ID() || second != batch.ID() {
+		t.Errorf("Expected header %s on both attempts, got %s and %s", batch.ID(), first, second)
+	}
+}
+
+func TestHTTPSender_SendLineFromAssignsOffsets(t *testing.T) {
+	sender := NewHTTPSender(
+		[]string{"http://localhost:8080"},
+		1000, 1024*1024, time.Second, 1, 10,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+	)
+
+	src := &Source{S3Key: "a.gz"}
+	sender.SendLineFrom(src, []byte("first"))
+	sender.SendLineFrom(src, []byte("second"))
+
+	for want := int64(0); want < 2; want++ {
+		line := <-sender.lineChan
+		if line.offset != want {
+			t.Errorf("Expected offset %d, got %d", want, line.offset)
+		}
+	}
+}
+
+func TestHTTPSender_BatchIDsReproducible(t *testing.T) {
+	var mu sync.Mutex
+	ids := make(map[string][]string) // Batch IDs received, by line content
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		key := string(body[:1])
+		ids[key] = append(ids[key], r.Header.Get(BatchIDHeader))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// send streams lines [resume, 25) of a.gz, with other lines before and between them
+	send := func(resume int64, other int) []string {
+		mu.Lock()
+		clear(ids)
+		mu.Unlock()
+		sender := NewHTTPSender(
+			[]string{server.URL},
+			10, 1024*1024, time.Minute, 1, 100,
+			5*time.Second, 10, 90*time.Second,
+			10*time.Second, 10*time.Second, time.Second,
+			nil,
+		)
+		sender.Start()
+		a, b := &Source{Bucket: "logs", S3Key: "a.gz"}, &Source{Bucket: "logs", S3Key: "b.gz"}
+		a.ResumeAt(resume)
+		for i := 0; i < other; i++ {
+			sender.SendLineFrom(b, []byte("b"))
+		}
+		for i := resume; i < 25; i++ {
+			sender.SendLineFrom(a, []byte("a"))
+			for j := 0; j < other; j++ {
+				sender.SendLineFrom(b, []byte("b"))
+			}
+		}
+		sender.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		got := slices.Clone(ids["a"])
+		slices.Sort(got)
+		return got
+	}
+
+	first := send(0, 0)
+	if len(first) != 3 {
+		t.Fatalf("Expected 3 batches for 25 lines, got %d", len(first))
+	}
+	if again := send(0, 3); !slices.Equal(again, first) {
+		t.Errorf("Expected the same batch IDs with interleaved lines, got %v and %v", first, again)
+	}
+
+	// Resumed part-way through a window, the later windows are cut as before
+	resumed := send(15, 1)
+	if len(resumed) != 2 {
+		t.Fatalf("Expected 2 batches after resuming at line 15, got %d", len(resumed))
+	}
+	if n := len(slices.DeleteFunc(resumed, func(id string) bool { return !slices.Contains(first, id) })); n != 1 {
+		t.Errorf("Expected the batch of lines 20-24 to keep its ID, %d of %v did", n, first)
+	}
+}
@@ -0,0 +1,84 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer caps the size of buffers returned to the pool so a single
+// oversized batch does not pin memory for the lifetime of the process
+const maxPooledBuffer = 16 * 1024 * 1024
+
+// bufferPool reuses request body buffers across batches and workers
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// payload is the encoded body of a batch, shared by every send attempt
+type payload struct {
+	buf    *bytes.Buffer
+	bodies []*requestBody
+}
+
+// encodeBatch renders the batch as newline-delimited lines into a pooled, pre-sized buffer
+func encodeBatch(batch *Batch) *payload {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.Grow(batch.Size)
+	for _, line := range batch.Lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return &payload{buf: buf}
+}
+
+// Len returns the encoded size in bytes
+func (p *payload) Len() int {
+	return p.buf.Len()
+}
+
+// body returns a fresh reader over the payload for one request attempt
+func (p *payload) body() *requestBody {
+	b := &requestBody{
+		Reader: bytes.NewReader(p.buf.Bytes()),
+		closed: make(chan struct{}),
+	}
+	p.bodies = append(p.bodies, b)
+	return b
+}
+
+// getBody adapts body for http.Request.GetBody (used on redirects)
+func (p *payload) getBody() (io.ReadCloser, error) {
+	return p.body(), nil
+}
+
+// release returns the buffer to the pool once no transport can still be reading it.
+// The transport closes a request body when it is done writing it; if any body is
+// still open the buffer is left to the garbage collector instead.
+func (p *payload) release() {
+	for _, b := range p.bodies {
+		select {
+		case <-b.closed:
+		default:
+			return
+		}
+	}
+	if p.buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(p.buf)
+}
+
+// requestBody is a request body over a pooled buffer that records when the transport closes it
+type requestBody struct {
+	*bytes.Reader
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Close implements io.Closer
+func (b *requestBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
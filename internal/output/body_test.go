@@ -0,0 +1,78 @@
+package output
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEncodeBatch(t *testing.T) {
+	batch := &Batch{
+		Lines: [][]byte{[]byte("line 1"), []byte("line 2")},
+		Size:  14,
+	}
+
+	p := encodeBatch(batch)
+	if got := p.buf.String(); got != "line 1\nline 2\n" {
+		t.Errorf("Unexpected payload %q", got)
+	}
+
+	// Each attempt gets an independent reader over the same bytes
+	for i := 0; i < 2; i++ {
+		body := p.body()
+		data, _ := io.ReadAll(body)
+		if string(data) != "line 1\nline 2\n" {
+			t.Errorf("Attempt %d read %q", i, data)
+		}
+		body.Close()
+	}
+	p.release()
+}
+
+func TestPayload_ReleaseKeepsOpenBodies(t *testing.T) {
+	p := encodeBatch(&Batch{Lines: [][]byte{[]byte("x")}, Size: 2})
+	p.body() // Never closed, as if a transport were still writing it
+
+	// Must not hand the buffer back while it may still be read
+	p.release()
+	if p.buf.Len() != 2 {
+		t.Error("Buffer was modified after release with an open body")
+	}
+}
+
+func TestHTTPSender_SetsContentLength(t *testing.T) {
+	type request struct {
+		length int64
+		body   string
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{length: r.ContentLength, body: string(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		1000, 1024*1024, time.Second, 1, 10,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+	)
+
+	batch := &Batch{Lines: [][]byte{[]byte("abc"), []byte("de")}, Size: 7}
+	if err := sender.sendWithRetry(batch, server.URL, 0); err != nil {
+		t.Fatalf("sendWithRetry failed: %v", err)
+	}
+
+	req := <-received
+	if req.length != 7 {
+		t.Errorf("Expected Content-Length 7, got %d", req.length)
+	}
+	if req.body != "abc\nde\n" {
+		t.Errorf("Unexpected body %q", req.body)
+	}
+}
@@ -0,0 +1,128 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Envelope wraps each outgoing line in a template such as
+// `{"sourcetype": "zscalernss-web", "event": {line}}`.
+//
+// Supported placeholders:
+//   - {line}: the line as-is (use when the line is already JSON)
+//   - {line_json}: the line encoded as a JSON string
+//   - {format}, {bucket}, {s3_key}: the line's source, JSON-escaped without quotes
+//   - {replay}: the replay ID of a tagged replay, empty otherwise
+type Envelope struct {
+	parts []envelopePart
+}
+
+// envelopePart is either a literal or a placeholder
+type envelopePart struct {
+	literal     string
+	placeholder string
+}
+
+// EnvelopeVars lists the placeholders that may appear in an envelope template
+var EnvelopeVars = []string{"line", "line_json", "format", "bucket", "s3_key", "replay"}
+
+// ParseEnvelope compiles an envelope template
+func ParseEnvelope(tmpl string) (*Envelope, error) {
+	env := &Envelope{}
+	hasLine := false
+
+	rest := tmpl
+	for rest != "" {
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			env.parts = append(env.parts, envelopePart{literal: rest})
+			break
+		}
+		closeIdx := strings.Index(rest[open:], "}")
+		if closeIdx < 0 {
+			env.parts = append(env.parts, envelopePart{literal: rest})
+			break
+		}
+		name := rest[open+1 : open+closeIdx]
+		if !isEnvelopeVar(name) {
+			// Not a placeholder (e.g. a JSON object brace); keep the brace and continue after it
+			env.parts = append(env.parts, envelopePart{literal: rest[:open+1]})
+			rest = rest[open+1:]
+			continue
+		}
+		if open > 0 {
+			env.parts = append(env.parts, envelopePart{literal: rest[:open]})
+		}
+		env.parts = append(env.parts, envelopePart{placeholder: name})
+		if name == "line" || name == "line_json" {
+			hasLine = true
+		}
+		rest = rest[open+closeIdx+1:]
+	}
+
+	if !hasLine {
+		return nil, fmt.Errorf("envelope template must contain {line} or {line_json}")
+	}
+	return env, nil
+}
+
+// ParseEnvelopes compiles envelope templates keyed by format name
+func ParseEnvelopes(templates map[string]string) (map[string]*Envelope, error) {
+	envelopes := make(map[string]*Envelope, len(templates))
+	for format, tmpl := range templates {
+		env, err := ParseEnvelope(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("envelope for format %q: %w", format, err)
+		}
+		envelopes[format] = env
+	}
+	return envelopes, nil
+}
+
+// Wrap returns the line wrapped in the envelope
+func (e *Envelope) Wrap(line []byte, src *Source) []byte {
+	if src == nil {
+		src = &Source{}
+	}
+
+	out := make([]byte, 0, len(line)+64)
+	for _, part := range e.parts {
+		switch part.placeholder {
+		case "":
+			out = append(out, part.literal...)
+		case "line":
+			out = append(out, line...)
+		case "line_json":
+			out = appendJSONString(out, string(line), true)
+		case "format":
+			out = appendJSONString(out, src.Format, false)
+		case "bucket":
+			out = appendJSONString(out, src.Bucket, false)
+		case "s3_key":
+			out = appendJSONString(out, src.S3Key, false)
+		case "replay":
+			out = appendJSONString(out, src.Replay, false)
+		}
+	}
+	return out
+}
+
+// appendJSONString appends s JSON-escaped, with or without surrounding quotes
+func appendJSONString(dst []byte, s string, quoted bool) []byte {
+	encoded, _ := json.Marshal(s) // Marshalling a string cannot fail
+	if !quoted {
+		encoded = encoded[1 : len(encoded)-1]
+	}
+	return append(dst, encoded...)
+}
+
+// isEnvelopeVar reports whether name is a supported placeholder
+func isEnvelopeVar(name string) bool {
+	for _, v := range EnvelopeVars {
+		if name == v {
+			return true
+		}
+	}
+	return false
+}
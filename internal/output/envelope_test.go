@@ -0,0 +1,87 @@
+package output
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEnvelope_Wrap(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		line string
+		want string
+	}{
+		{
+			name: "raw json line",
+			tmpl: `{"sourcetype": "zscalernss-web", "event": {line}}`,
+			line: `{"user":"alice"}`,
+			want: `{"sourcetype": "zscalernss-web", "event": {"user":"alice"}}`,
+		},
+		{
+			name: "line as json string with source fields",
+			tmpl: `{"format":"{format}","key":"{s3_key}","message":{line_json}}`,
+			line: `a "quoted" line`,
+			want: `{"format":"zscaler","key":"logs/\"x\".gz","message":"a \"quoted\" line"}`,
+		},
+		{
+			name: "replay tag",
+			tmpl: `{"replay":"{replay}","event":{line}}`,
+			line: `{"user":"alice"}`,
+			want: `{"replay":"replay-1","event":{"user":"alice"}}`,
+		},
+	}
+
+	src := &Source{Bucket: "bucket", S3Key: `logs/"x".gz`, Format: "zscaler", Replay: "replay-1"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := ParseEnvelope(tt.tmpl)
+			if err != nil {
+				t.Fatalf("ParseEnvelope failed: %v", err)
+			}
+			got := string(env.Wrap([]byte(tt.line), src))
+			if got != tt.want {
+				t.Errorf("Wrap() = %s, want %s", got, tt.want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("Wrapped line is not valid JSON: %s", got)
+			}
+		})
+	}
+}
+
+func TestParseEnvelope_RequiresLine(t *testing.T) {
+	if _, err := ParseEnvelope(`{"event": "{format}"}`); err == nil {
+		t.Error("Expected error for template without {line}")
+	}
+}
+
+func TestHTTPSender_AppliesEnvelopePerFormat(t *testing.T) {
+	envelopes, err := ParseEnvelopes(map[string]string{
+		"zscaler": `{"sourcetype": "zscalernss-web", "event": {line}}`,
+		"*":       `{"event": {line_json}}`,
+	})
+	if err != nil {
+		t.Fatalf("ParseEnvelopes failed: %v", err)
+	}
+
+	sender := NewHTTPSender(
+		[]string{"http://localhost:8080"},
+		1000, 1024*1024, time.Second, 1, 10,
+		30*time.Second, 100, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithEnvelopes(envelopes),
+	)
+
+	sender.SendLineFrom(&Source{Format: "zscaler"}, []byte(`{"a":1}`))
+	sender.SendLineFrom(&Source{Format: "cisco_umbrella"}, []byte(`x,y`))
+
+	if got := string((<-sender.lineChan).data); got != `{"sourcetype": "zscalernss-web", "event": {"a":1}}` {
+		t.Errorf("Unexpected zscaler envelope: %s", got)
+	}
+	if got := string((<-sender.lineChan).data); got != `{"event": "x,y"}` {
+		t.Errorf("Unexpected fallback envelope: %s", got)
+	}
+}
@@ -0,0 +1,97 @@
+package output
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Source identifies the S3 object a line was read from
+type Source struct {
+	Bucket string
+	Prefix string // Stream prefix the file was listed under (a metric dimension)
+	S3Key  string
+	Format string
+	Ack    *Ack // Optional delivery tracker notified as the line's batch is sent
+
+	Timestamp int64  // File timestamp (Unix seconds, 0 if unknown), for the delivery latency metric
+	Replay    string // Replay ID of a tagged replay ("" otherwise); part of the batch ID
+
+	ProcessingID string // Processing ID of the file's attempt, for logs; not part of the batch ID
+
+	nextOffset int64 // Offset assigned to the next line sent from this source
+	wrapped    bool  // Lines were wrapped in their envelope before they were spilled
+}
+
+// sourceKey is the identity of a source: the fields headers and batch IDs are derived from
+type sourceKey struct {
+	bucket, prefix, s3Key, format, replay string
+}
+
+func (s *Source) key() sourceKey {
+	return sourceKey{bucket: s.Bucket, prefix: s.Prefix, s3Key: s.S3Key, format: s.Format, replay: s.Replay}
+}
+
+// ResumeAt sets the offset of the next line sent from this source, so a file resumed
+// part-way through keeps the line offsets (and batch IDs) of its first attempt
+func (s *Source) ResumeAt(offset int64) {
+	s.nextOffset = offset
+}
+
+// headerTemplate is a single configured header, possibly containing placeholders
+type headerTemplate struct {
+	name      string
+	value     string
+	templated bool
+}
+
+// headerSet holds the extra headers configured for one endpoint
+type headerSet []headerTemplate
+
+// newHeaderSet merges global and endpoint-specific headers (endpoint values win)
+func newHeaderSet(global, endpoint map[string]string) headerSet {
+	merged := make(map[string]string, len(global)+len(endpoint))
+	for name, value := range global {
+		merged[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, value := range endpoint {
+		merged[http.CanonicalHeaderKey(name)] = value
+	}
+
+	set := make(headerSet, 0, len(merged))
+	for name, value := range merged {
+		set = append(set, headerTemplate{
+			name:      name,
+			value:     value,
+			templated: strings.Contains(value, "{"),
+		})
+	}
+	return set
+}
+
+// apply sets the headers on the request, resolving placeholders from src
+func (hs headerSet) apply(header http.Header, src *Source) {
+	var replacer *strings.Replacer
+	for _, h := range hs {
+		value := h.value
+		if h.templated {
+			if replacer == nil {
+				replacer = templateReplacer(src)
+			}
+			value = replacer.Replace(value)
+		}
+		header.Set(h.name, value)
+	}
+}
+
+// templateReplacer builds the placeholder replacer for a source (nil source resolves to empty strings)
+func templateReplacer(src *Source) *strings.Replacer {
+	if src == nil {
+		src = &Source{}
+	}
+	return strings.NewReplacer(
+		"{format}", src.Format,
+		"{bucket}", src.Bucket,
+		"{s3_key}", src.S3Key,
+		"{replay}", src.Replay,
+	)
+}
@@ -1,23 +1,28 @@
 package output
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
-	"strings"
+	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // HTTPSender batches log lines and sends them via HTTP to EdgeDelta
 type HTTPSender struct {
-	endpoints     []string
+	routes        atomic.Pointer[endpointRoutes] // Endpoints and their headers (see SetEndpoints)
 	client        *http.Client
 	batchLines    int
 	batchBytes    int
@@ -25,11 +30,16 @@ type HTTPSender struct {
 	workers       int
 	bufferSize    int
 
-	lineChan  chan []byte
+	lineChan  chan queuedLine
 	batchChan chan *Batch
-	doneChan  chan struct{}
 	wg        sync.WaitGroup
 
+	// Shutdown coordination: stopping unblocks producers, sendMu guards closing lineChan
+	stopping chan struct{}
+	sendMu   sync.RWMutex
+	closed   bool
+	stopOnce sync.Once
+
 	ctx    context.Context
 	cancel context.CancelFunc
 
@@ -38,19 +48,223 @@ type HTTPSender struct {
 	sentBytes   atomic.Int64
 	sentBatches atomic.Int64
 	errors      atomic.Int64
+	drops       atomic.Int64
+	retries     atomic.Int64
+	spilled     atomic.Int64
+	inFlightReq atomic.Int64 // HTTP requests in progress
+
+	// Responses received per HTTP status code
+	statusMu     sync.Mutex
+	statusCounts map[int]int64
+
+	// Outcome of the last delivery per endpoint (see EndpointStatuses)
+	endpointMu     sync.Mutex
+	endpointStatus map[string]*EndpointStatus
 
 	// OTLP metrics client
 	metricsClient *metrics.Metrics
+	gauges        metric.Registration // Saturation gauges while started (see observe)
+
+	// Extra headers configured with WithHeaders
+	globalHeaders   map[string]string
+	endpointHeaders map[string]map[string]string
+
+	// Behaviour when the line buffer is full
+	bufferPolicy BufferPolicy
+	blockTimeout time.Duration
+
+	// Retry behaviour for transient failures
+	maxRetries      int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+
+	// Shutdown drain deadline and spill destination for undelivered lines
+	drainTimeout time.Duration
+	spillDir     string
+	spill        *spiller
+
+	// Per-format output envelopes ("*" applies to formats without their own)
+	envelopes map[string]*Envelope
+
+	// Semaphore bounding outstanding POSTs across all senders (nil = unlimited)
+	inFlight chan struct{}
+}
+
+// BufferPolicy controls what SendLine does when the line buffer is full
+type BufferPolicy string
+
+const (
+	// BufferPolicyBlock waits for space (no data loss, unbounded latency)
+	BufferPolicyBlock BufferPolicy = "block"
+	// BufferPolicyDropNewest discards the line being queued
+	BufferPolicyDropNewest BufferPolicy = "drop_newest"
+	// BufferPolicyDropOldest discards the oldest buffered line to make room
+	BufferPolicyDropOldest BufferPolicy = "drop_oldest"
+	// BufferPolicyBlockWithTimeout waits up to the block timeout, then discards the line
+	BufferPolicyBlockWithTimeout BufferPolicy = "block_with_timeout"
+)
+
+// Option configures optional HTTPSender behaviour
+type Option func(*HTTPSender)
+
+// WithHeaders adds static or templated headers to every request.
+// Endpoint-specific headers override global ones with the same name.
+// Values may reference {format}, {bucket}, {s3_key} and {replay}, which are resolved per batch.
+func WithHeaders(global map[string]string, perEndpoint map[string]map[string]string) Option {
+	return func(hs *HTTPSender) {
+		hs.globalHeaders = global
+		hs.endpointHeaders = perEndpoint
+	}
+}
+
+// WithBufferPolicy sets the full-buffer behaviour of SendLine.
+// blockTimeout only applies to BufferPolicyBlockWithTimeout.
+func WithBufferPolicy(policy BufferPolicy, blockTimeout time.Duration) Option {
+	return func(hs *HTTPSender) {
+		hs.bufferPolicy = policy
+		hs.blockTimeout = blockTimeout
+	}
+}
+
+// WithRetry retries batches that fail with a retryable error (network errors,
+// timeouts, 5xx, 408 and 429) up to maxRetries times with exponential backoff
+func WithRetry(maxRetries int, backoff, maxBackoff time.Duration) Option {
+	return func(hs *HTTPSender) {
+		hs.maxRetries = maxRetries
+		hs.retryBackoff = backoff
+		hs.retryMaxBackoff = maxBackoff
+	}
+}
+
+// WithDrain bounds how long Stop waits for buffered lines to be delivered.
+// When the deadline expires, in-flight requests are cancelled and the remaining
+// lines are written to spillDir (if set) and replayed on the next Start.
+// A zero timeout waits indefinitely.
+func WithDrain(timeout time.Duration, spillDir string) Option {
+	return func(hs *HTTPSender) {
+		hs.drainTimeout = timeout
+		hs.spillDir = spillDir
+	}
+}
+
+// WithMaxInFlight caps the number of outstanding POSTs across all sender workers.
+// Workers beyond the cap wait for a slot before sending. Zero means unlimited.
+func WithMaxInFlight(max int) Option {
+	return func(hs *HTTPSender) {
+		if max > 0 {
+			hs.inFlight = make(chan struct{}, max)
+		}
+	}
+}
+
+// WithEnvelopes wraps outgoing lines in a per-format envelope.
+// The "*" key applies to any format without its own envelope.
+func WithEnvelopes(envelopes map[string]*Envelope) Option {
+	return func(hs *HTTPSender) {
+		hs.envelopes = envelopes
+	}
+}
+
+// queuedLine is a line waiting in the buffer together with its origin
+type queuedLine struct {
+	data   []byte
+	src    *Source
+	offset int64   // Position of the line within its source
+	buf    *[]byte // Pooled buffer holding data (nil if the line is not pooled)
 }
 
 // Batch represents a batch of log lines ready to send
 type Batch struct {
-	Lines [][]byte
-	Size  int
+	Lines  [][]byte
+	Size   int
+	Source *Source // Origin of the lines (nil for lines sent without a source)
+
+	acks   map[*Ack]int // Lines per file awaiting delivery acknowledgement
+	format string       // Log format of the lines ("mixed" if more than one)
+	bucket string       // Bucket of the lines ("mixed" if more than one)
+	prefix string       // Stream prefix of the lines ("mixed" if more than one)
+	oldest int64        // Timestamp of the oldest file with lines in the batch (0 if unknown)
+	bufs   []*[]byte    // Pooled line buffers, released once the batch is done
+
+	segments  []batchSegment // Source line ranges, for the batch ID
+	unsourced hash.Hash      // Content hash of lines without a source, for the batch ID
+	id        string
+}
+
+// add appends a line to the batch, tracking its ack and format
+func (b *Batch) add(line queuedLine) {
+	b.Lines = append(b.Lines, line.data)
+	b.Size += len(line.data) + 1 // +1 for newline
+	if line.buf != nil {
+		b.bufs = append(b.bufs, line.buf)
+	}
+	b.track(line)
+
+	format, bucket, prefix := "unknown", "unknown", "unknown"
+	if line.src != nil {
+		if line.src.Format != "" {
+			format = line.src.Format
+		}
+		if line.src.Bucket != "" {
+			bucket = line.src.Bucket
+		}
+		if line.src.Prefix != "" {
+			prefix = line.src.Prefix
+		}
+		if ts := line.src.Timestamp; ts > 0 && (b.oldest == 0 || ts < b.oldest) {
+			b.oldest = ts
+		}
+		if line.src.Ack != nil {
+			if b.acks == nil {
+				b.acks = make(map[*Ack]int)
+			}
+			b.acks[line.src.Ack]++
+		}
+	}
+	b.format = mergeLabel(b.format, format)
+	b.bucket = mergeLabel(b.bucket, bucket)
+	b.prefix = mergeLabel(b.prefix, prefix)
+}
+
+// mergeLabel returns the label of a batch holding lines labelled current and v
+func mergeLabel(current, v string) string {
+	switch current {
+	case "", v:
+		return v
+	default:
+		return "mixed"
+	}
+}
+
+// formatLabel returns the metric label for the batch's log format
+func (b *Batch) formatLabel() string {
+	if b.format == "" {
+		return "unknown"
+	}
+	return b.format
+}
+
+// dimensions returns the metric dimensions of the batch's lines
+func (b *Batch) dimensions() metrics.Dimensions {
+	return metrics.Dimensions{Bucket: b.bucket, Prefix: b.prefix, Format: b.formatLabel()}
+}
+
+// resolve reports the outcome of sending the batch to destination to every file it contains
+func (b *Batch) resolve(destination string, err error) {
+	if err == nil {
+		for _, seg := range b.segments {
+			if seg.src.Ack != nil {
+				seg.src.Ack.deliver(seg.first, seg.last)
+			}
+		}
+	}
+	for ack, n := range b.acks {
+		ack.resolveAt(n, destination, err)
+	}
 }
 
 // NewHTTPSender creates a new HTTP sender
-func NewHTTPSender(endpoints []string, batchLines, batchBytes int, flushInterval time.Duration, workers int, bufferSize int, timeout time.Duration, maxIdleConns int, idleConnTimeout time.Duration, tlsHandshakeTimeout, responseHeaderTimeout, expectContinueTimeout time.Duration, metricsClient *metrics.Metrics) *HTTPSender {
+func NewHTTPSender(endpoints []string, batchLines, batchBytes int, flushInterval time.Duration, workers int, bufferSize int, timeout time.Duration, maxIdleConns int, idleConnTimeout time.Duration, tlsHandshakeTimeout, responseHeaderTimeout, expectContinueTimeout time.Duration, metricsClient *metrics.Metrics, opts ...Option) *HTTPSender {
 	transport := &http.Transport{
 		MaxIdleConns:          maxIdleConns,
 		MaxIdleConnsPerHost:   maxIdleConns,
@@ -68,27 +282,37 @@ func NewHTTPSender(endpoints []string, batchLines, batchBytes int, flushInterval
 	// Create cancellable context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &HTTPSender{
-		endpoints:     endpoints,
-		client:        client,
-		batchLines:    batchLines,
-		batchBytes:    batchBytes,
-		flushInterval: flushInterval,
-		workers:       workers,
-		bufferSize:    bufferSize,
-		lineChan:      make(chan []byte, bufferSize), // Configurable buffer for incoming lines
-		batchChan:     make(chan *Batch, workers*2),
-		doneChan:      make(chan struct{}),
-		metricsClient: metricsClient,
-		ctx:           ctx,
-		cancel:        cancel,
+	hs := &HTTPSender{
+		client:         client,
+		batchLines:     batchLines,
+		batchBytes:     batchBytes,
+		flushInterval:  flushInterval,
+		workers:        workers,
+		bufferSize:     bufferSize,
+		lineChan:       make(chan queuedLine, bufferSize), // Configurable buffer for incoming lines
+		batchChan:      make(chan *Batch, workers*2),
+		stopping:       make(chan struct{}),
+		metricsClient:  metricsClient,
+		ctx:            ctx,
+		cancel:         cancel,
+		bufferPolicy:   BufferPolicyBlock,
+		statusCounts:   make(map[int]int64),
+		endpointStatus: make(map[string]*EndpointStatus),
 	}
+
+	for _, opt := range opts {
+		opt(hs)
+	}
+	hs.spill = newSpiller(hs.spillDir)
+
+	hs.routes.Store(newEndpointRoutes(endpoints, hs.globalHeaders, hs.endpointHeaders))
+
+	return hs
 }
 
-// Start starts the HTTP sender (batcher + workers)
+// Start starts the HTTP sender (batcher + workers) and replays any spilled lines
 func (hs *HTTPSender) Start() {
 	// Start batcher
-	hs.wg.Add(1)
 	go hs.batcher()
 
 	// Start HTTP sender workers
@@ -96,33 +320,351 @@ func (hs *HTTPSender) Start() {
 		hs.wg.Add(1)
 		go hs.sender(i)
 	}
+
+	if hs.spillDir != "" {
+		go hs.replaySpill()
+	}
+	hs.observe()
 }
 
-// Stop gracefully stops the HTTP sender
+// observe reports the batch queue depth and in-flight request gauges until Stop
+func (hs *HTTPSender) observe() {
+	if hs.metricsClient == nil {
+		return
+	}
+	reg, err := hs.metricsClient.ObserveHTTPSender(metrics.SenderStats{
+		BatchQueue: func() int64 { return int64(len(hs.batchChan)) },
+		InFlight:   hs.inFlightReq.Load,
+	})
+	if err != nil {
+		logging.Component("http_sender").Warn("Failed to register HTTP sender gauges", "error", err)
+		return
+	}
+	hs.gauges = reg
+}
+
+// Stop drains buffered lines and stops the HTTP sender.
+// Producers blocked in SendLine are released and their lines rejected. If the
+// drain deadline expires, in-flight requests are cancelled and the remaining
+// lines are spilled to disk. Stop is safe to call more than once.
 func (hs *HTTPSender) Stop() {
-	// Cancel context to signal shutdown
-	hs.cancel()
+	hs.stopOnce.Do(func() {
+		logger := logging.Component("http_sender")
+
+		// Release blocked producers, then close the buffer once no send is in progress
+		close(hs.stopping)
+		hs.sendMu.Lock()
+		hs.closed = true
+		close(hs.lineChan)
+		hs.sendMu.Unlock()
+
+		drained := make(chan struct{})
+		go func() {
+			hs.wg.Wait()
+			close(drained)
+		}()
+
+		var deadline <-chan time.Time
+		if hs.drainTimeout > 0 {
+			timer := time.NewTimer(hs.drainTimeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		select {
+		case <-drained:
+		case <-deadline:
+			logger.Warn("HTTP sender drain deadline exceeded, cancelling in-flight requests",
+				"drain_timeout", hs.drainTimeout,
+				"buffered_lines", len(hs.lineChan))
+			hs.cancel()
+			<-drained
+		}
+		hs.cancel()
 
-	// Close channels
-	close(hs.lineChan)
-	hs.wg.Wait()
-	close(hs.batchChan)
-	close(hs.doneChan)
+		if hs.spill != nil {
+			if err := hs.spill.close(); err != nil {
+				logger.Error("Failed to close spill file", "error", err)
+			}
+			if n := hs.spilled.Load(); n > 0 {
+				logger.Warn("Spilled undelivered lines to disk for replay",
+					"lines", n,
+					"spill_dir", hs.spillDir)
+			}
+		}
+		if hs.gauges != nil {
+			hs.gauges.Unregister()
+		}
+	})
 }
 
-// SendLine queues a log line for sending, blocking if buffer is full
+// SendLine queues a log line for sending; a full buffer is handled per the buffer policy.
+// Lines sent after Stop are rejected.
 func (hs *HTTPSender) SendLine(line []byte) {
-	hs.lineChan <- line
+	if env := hs.envelopeFor(nil); env != nil {
+		line = env.Wrap(line, nil)
+	}
+	hs.enqueue(context.Background(), queuedLine{data: line})
 }
 
-// batcher accumulates lines into batches and flushes periodically
-func (hs *HTTPSender) batcher() {
-	defer hs.wg.Done()
+// SendLineFrom queues a log line read from src; a full buffer is handled per the buffer policy.
+// The sender takes ownership of line: the caller must not modify it afterwards.
+// If src carries an Ack, it is resolved once the line's batch has been sent or the line is dropped.
+// Lines from one src must be sent in file order from a single goroutine: their offsets form the batch ID.
+func (hs *HTTPSender) SendLineFrom(src *Source, line []byte) {
+	hs.sendFrom(context.Background(), src, line, false)
+}
+
+// SendLineCopy is SendLineFrom for a line the caller keeps ownership of, such as a
+// bufio.Scanner token. The line is copied into a pooled buffer that the sender recycles
+// once the line's batch has been sent, spilled or dropped, so the caller may reuse line
+// as soon as SendLineCopy returns. If ctx is cancelled while waiting for buffer space,
+// the line is discarded and src's Ack fails with ctx's error.
+func (hs *HTTPSender) SendLineCopy(ctx context.Context, src *Source, line []byte) {
+	hs.sendFrom(ctx, src, line, true)
+}
+
+// sendFrom queues a line from src, copying it into a pooled buffer if the caller keeps it
+func (hs *HTTPSender) sendFrom(ctx context.Context, src *Source, line []byte, borrowed bool) {
+	if src != nil && src.Ack != nil {
+		src.Ack.add(1)
+	}
+	var offset int64
+	if src != nil {
+		offset = src.nextOffset
+		src.nextOffset++
+	}
+	queued := queuedLine{data: line, src: src, offset: offset}
+	if env := hs.envelopeFor(src); env != nil {
+		queued.data = env.Wrap(line, src) // Wrap copies the line
+	} else if borrowed {
+		queued.buf = copyLine(line)
+		queued.data = *queued.buf
+	}
+	hs.enqueue(ctx, queued)
+}
+
+// envelopeFor returns the envelope configured for the source's format, if any. Replayed
+// spill files get none, since their lines were wrapped before they were spilled.
+func (hs *HTTPSender) envelopeFor(src *Source) *Envelope {
+	if len(hs.envelopes) == 0 || (src != nil && src.wrapped) {
+		return nil
+	}
+	if src != nil {
+		if env, ok := hs.envelopes[src.Format]; ok {
+			return env
+		}
+	}
+	return hs.envelopes["*"]
+}
+
+// enqueue places a line in the buffer according to the buffer policy.
+// A producer blocked on a full buffer gives up when ctx is cancelled.
+func (hs *HTTPSender) enqueue(ctx context.Context, line queuedLine) {
+	hs.sendMu.RLock()
+	defer hs.sendMu.RUnlock()
+	if hs.closed {
+		hs.reject(line)
+		return
+	}
+
+	switch hs.bufferPolicy {
+	case BufferPolicyDropNewest:
+		select {
+		case hs.lineChan <- line:
+		default:
+			hs.drop(line)
+		}
+
+	case BufferPolicyDropOldest:
+		for {
+			select {
+			case hs.lineChan <- line:
+				return
+			default:
+			}
+			// Evict the oldest line; the batcher may win the race, in which case just retry
+			select {
+			case oldest := <-hs.lineChan:
+				hs.drop(oldest)
+			default:
+			}
+		}
+
+	case BufferPolicyBlockWithTimeout:
+		select {
+		case hs.lineChan <- line:
+			return
+		default:
+		}
+		timer := time.NewTimer(hs.blockTimeout)
+		defer timer.Stop()
+		select {
+		case hs.lineChan <- line:
+		case <-timer.C:
+			hs.drop(line)
+		case <-hs.stopping:
+			hs.reject(line)
+		case <-ctx.Done():
+			hs.abandon(line, ctx.Err())
+		}
+
+	default:
+		select {
+		case hs.lineChan <- line:
+		case <-hs.stopping:
+			hs.reject(line)
+		case <-ctx.Done():
+			hs.abandon(line, ctx.Err())
+		}
+	}
+}
+
+// abandon discards a line whose producer stopped waiting for buffer space
+func (hs *HTTPSender) abandon(line queuedLine, err error) {
+	defer line.release()
+	if line.src != nil && line.src.Ack != nil {
+		line.src.Ack.resolve(1, err)
+	}
+}
+
+// reject handles a line offered while the sender is stopping
+func (hs *HTTPSender) reject(line queuedLine) {
+	defer line.release()
+	if hs.spill != nil && hs.spillLines([][]byte{line.data}) == nil {
+		if line.src != nil && line.src.Ack != nil {
+			line.src.Ack.resolveAt(1, DestinationSpill, ErrSpilled)
+		}
+		return
+	}
+	if line.src != nil && line.src.Ack != nil {
+		line.src.Ack.resolve(1, ErrSenderStopped)
+	}
+}
+
+// spillLines writes lines to the spill file
+func (hs *HTTPSender) spillLines(lines [][]byte) error {
+	if err := hs.spill.write(lines); err != nil {
+		logging.Component("http_sender").Error("Failed to spill lines", "lines", len(lines), "error", err)
+		return err
+	}
+	hs.spilled.Add(int64(len(lines)))
+	return nil
+}
+
+// spillBatch writes an undelivered batch to disk, or reports it lost if spilling is unavailable
+func (hs *HTTPSender) spillBatch(batch *Batch, cause error) {
+	if hs.spill != nil && hs.spillLines(batch.Lines) == nil {
+		batch.resolve(DestinationSpill, ErrSpilled)
+		return
+	}
+	batch.resolve(DestinationUnsent, cause)
+	hs.errors.Add(1)
+	logging.Component("http_sender").Error("Discarded undelivered batch during shutdown",
+		"batch_id", batch.ID(),
+		"processing_ids", batch.processingIDs(),
+		"batch_lines", len(batch.Lines),
+		"error", cause)
+}
+
+// replaySpill re-queues lines spilled by a previous run, removing each file once delivered
+func (hs *HTTPSender) replaySpill() {
+	defer crash.Recover()
+	logger := logging.Component("http_sender")
+
+	files, err := ListSpillFiles(hs.spillDir)
+	if err != nil {
+		logger.Error("Failed to list spill files", "spill_dir", hs.spillDir, "error", err)
+		return
+	}
+
+	for _, path := range files {
+		if err := hs.replaySpillFile(path); err != nil {
+			logger.Error("Failed to replay spill file", "path", path, "error", err)
+		}
+	}
+}
+
+// replaySpillFile queues every line of a spill file
+func (hs *HTTPSender) replaySpillFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	logger := logging.Component("http_sender")
+	ack := NewAck(func(err error) {
+		if err != nil {
+			logger.Warn("Spill file not fully delivered, keeping for next start", "path", path, "error", err)
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			logger.Error("Failed to remove replayed spill file", "path", path, "error", err)
+			return
+		}
+		logger.Info("Replayed spill file", "path", path)
+	})
+	src := &Source{S3Key: filepath.Base(path), Ack: ack, wrapped: true}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		// Leave the rest of the file for the next start rather than re-spilling it
+		select {
+		case <-hs.stopping:
+			ack.Fail(ErrSenderStopped)
+			return nil
+		default:
+		}
 
-	currentBatch := &Batch{
-		Lines: make([][]byte, 0, hs.batchLines),
-		Size:  0,
+		hs.SendLineCopy(context.Background(), src, scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		ack.Fail(err)
+		return err
 	}
+	ack.Seal()
+	return nil
+}
+
+// drop discards a line under a drop policy. The line counts as done for its file's Ack:
+// failing it would retry the file and send every other line of it again.
+func (hs *HTTPSender) drop(line queuedLine) {
+	line.release()
+	hs.drops.Add(1)
+	logger := logging.Component("http_sender")
+	if line.src != nil {
+		logger.Warn("Dropped line, buffer full", "policy", hs.bufferPolicy, "s3_key", line.src.S3Key, "offset", line.offset)
+		if line.src.Ack != nil {
+			line.src.Ack.deliver(line.offset, line.offset)
+			line.src.Ack.resolveAt(1, DestinationDropped, nil)
+		}
+	} else {
+		logger.Warn("Dropped line, buffer full", "policy", hs.bufferPolicy)
+	}
+	if hs.metricsClient != nil {
+		hs.metricsClient.RecordBufferDrop(context.Background(), 1, string(hs.bufferPolicy))
+	}
+}
+
+// batchKey identifies the open batch a line joins: its source, and the window of batchLines
+// consecutive line offsets of that source it falls in
+type batchKey struct {
+	source sourceKey
+	window int64
+}
+
+// batcher accumulates lines into batches and flushes periodically. Each batch holds lines of
+// one source and one window of it, so a batch is cut at the same offsets however the lines of
+// several producers interleave, and a file read again yields the same batches and IDs. It
+// exits once lineChan is closed and drained, closing batchChan behind it.
+func (hs *HTTPSender) batcher() {
+	defer crash.Recover()
+	defer close(hs.batchChan)
+
+	batches := make(map[batchKey]*Batch)
+	var open []batchKey // Keys of the open batches, oldest first
 
 	flushTicker := time.NewTicker(hs.flushInterval)
 	defer flushTicker.Stop()
@@ -131,20 +673,17 @@ func (hs *HTTPSender) batcher() {
 	bufferMonitorTicker := time.NewTicker(5 * time.Second)
 	defer bufferMonitorTicker.Stop()
 
-	flushBatch := func() {
-		if len(currentBatch.Lines) > 0 {
-			// Send batch to senders
-			select {
-			case hs.batchChan <- currentBatch:
-				// Create new batch
-				currentBatch = &Batch{
-					Lines: make([][]byte, 0, hs.batchLines),
-					Size:  0,
-				}
-			case <-hs.doneChan:
-				return
-			}
+	flushBatch := func(key batchKey) {
+		hs.batchChan <- batches[key]
+		delete(batches, key)
+		open = slices.DeleteFunc(open, func(k batchKey) bool { return k == key })
+	}
+	flushAll := func() {
+		for _, key := range open {
+			hs.batchChan <- batches[key]
 		}
+		clear(batches)
+		open = open[:0]
 	}
 
 	for {
@@ -152,112 +691,271 @@ func (hs *HTTPSender) batcher() {
 		case line, ok := <-hs.lineChan:
 			if !ok {
 				// Channel closed, flush and exit
-				flushBatch()
+				flushAll()
 				return
 			}
 
+			var key batchKey
+			if line.src != nil {
+				key = batchKey{source: line.src.key(), window: line.offset / int64(hs.batchLines)}
+			}
+			batch := batches[key]
+			if batch == nil {
+				batch = &Batch{Lines: newBatchLines(hs.batchLines), Source: line.src}
+				batches[key] = batch
+				open = append(open, key)
+			}
+
 			// Add line to batch
-			currentBatch.Lines = append(currentBatch.Lines, line)
-			currentBatch.Size += len(line) + 1 // +1 for newline
+			batch.add(line)
 
-			// Flush if batch is full
-			if len(currentBatch.Lines) >= hs.batchLines || currentBatch.Size >= hs.batchBytes {
-				flushBatch()
+			// Flush if batch is full or its window complete
+			if len(batch.Lines) >= hs.batchLines || batch.Size >= hs.batchBytes ||
+				(line.src != nil && (line.offset+1)%int64(hs.batchLines) == 0) {
+				flushBatch(key)
 			}
 
 		case <-flushTicker.C:
-			// Periodic flush (even if batch not full)
-			flushBatch()
+			// Periodic flush (even if batches are not full)
+			flushAll()
 
 		case <-bufferMonitorTicker.C:
-			// Update buffer utilization metric
+			// Update buffer utilization metric, and beat: a batcher blocked on stalled senders stops here
 			if hs.metricsClient != nil {
-				utilization := float64(len(hs.lineChan)) / float64(hs.bufferSize)
-				hs.metricsClient.UpdateBufferUtilization(context.Background(), utilization)
+				hs.metricsClient.UpdateBufferUtilization(context.Background(), hs.BufferUtilization())
+				hs.metricsClient.RecordHeartbeat(context.Background(), "http_sender")
 			}
-
-		case <-hs.doneChan:
-			flushBatch()
-			return
 		}
 	}
 }
 
 // sender reads batches and sends them via HTTP POST
 func (hs *HTTPSender) sender(workerID int) {
+	defer crash.Recover()
 	defer hs.wg.Done()
 
-	// Select endpoint for this worker (round-robin distribution)
-	endpoint := hs.endpoints[workerID%len(hs.endpoints)]
-
 	for batch := range hs.batchChan {
-		if err := hs.sendBatch(batch, endpoint); err != nil {
-			logging.GetDefaultLogger().Error("HTTP worker failed to send batch",
-				"worker_id", workerID,
-				"endpoint", endpoint,
-				"batch_lines", len(batch.Lines),
-				"error", err)
-			hs.errors.Add(1)
-			if hs.metricsClient != nil {
-				// Categorize error type
-				errStr := err.Error()
-				if strings.Contains(errStr, "timeout") || strings.Contains(errStr, "deadline exceeded") {
-					hs.metricsClient.RecordHTTPTimeoutError(context.Background())
-				} else if strings.Contains(errStr, "connection refused") || strings.Contains(errStr, "network") || strings.Contains(errStr, "dial") {
-					hs.metricsClient.RecordHTTPNetworkError(context.Background())
-				} else if strings.Contains(errStr, "HTTP 5") {
-					hs.metricsClient.RecordHTTPServerError(context.Background())
-				} else {
-					hs.metricsClient.RecordHTTPError(context.Background())
-				}
+		// Select endpoint for this worker (round-robin distribution), per batch so that
+		// SetEndpoints takes effect without restarting the workers
+		endpoint := hs.routes.Load().endpoint(workerID)
+		hs.deliver(batch, endpoint, workerID)
+		batch.release()
+	}
+}
+
+// deliver sends a batch and reports the outcome, spilling it if the drain deadline expired
+func (hs *HTTPSender) deliver(batch *Batch, endpoint string, workerID int) {
+	// Drain deadline expired: spill what is left instead of sending
+	if hs.ctx.Err() != nil {
+		hs.spillBatch(batch, hs.ctx.Err())
+		return
+	}
+
+	err := hs.sendWithRetry(batch, endpoint, workerID)
+	if err != nil && hs.ctx.Err() != nil {
+		hs.spillBatch(batch, err)
+		return
+	}
+	batch.resolve(endpoint, err)
+	hs.recordEndpoint(endpoint, err)
+	if err != nil {
+		logging.Component("http_sender").Error("HTTP worker failed to send batch",
+			"worker_id", workerID,
+			"endpoint", endpoint,
+			"batch_id", batch.ID(),
+			"processing_ids", batch.processingIDs(),
+			"batch_lines", len(batch.Lines),
+			"retryable", isRetryable(err),
+			"error", err)
+		hs.errors.Add(1)
+		hs.recordError(err, endpoint, batch.dimensions())
+	} else {
+		hs.sentBatches.Add(1)
+		hs.sentLines.Add(int64(len(batch.Lines)))
+		hs.sentBytes.Add(int64(batch.Size))
+		if hs.metricsClient != nil {
+			hs.metricsClient.RecordHTTPBatch(context.Background(), endpoint, batch.dimensions(), int64(len(batch.Lines)), int64(batch.Size))
+			hs.metricsClient.RecordSend(context.Background(), endpoint, time.Now())
+			if batch.oldest > 0 {
+				hs.metricsClient.RecordDeliveryLatency(metrics.WithBatchID(context.Background(), batch.ID()), endpoint, batch.dimensions(), time.Since(time.Unix(batch.oldest, 0)))
 			}
+		}
+	}
+}
+
+// sendWithRetry sends a batch, retrying retryable failures with backoff
+func (hs *HTTPSender) sendWithRetry(batch *Batch, endpoint string, workerID int) error {
+	// Encode once and reuse the body across attempts
+	p := encodeBatch(batch)
+	defer p.release()
+
+	for attempt := 1; ; attempt++ {
+		err := hs.sendBatch(batch, endpoint, p)
+		if err == nil || attempt > hs.maxRetries || !isRetryable(err) {
+			return err
+		}
+
+		delay := retryDelay(err, attempt, hs.retryBackoff, hs.retryMaxBackoff)
+		logging.Component("http_sender").Warn("Retrying HTTP batch",
+			"worker_id", workerID,
+			"endpoint", endpoint,
+			"batch_id", batch.ID(),
+			"processing_ids", batch.processingIDs(),
+			"attempt", attempt,
+			"delay", delay,
+			"error", err)
+		hs.retries.Add(1)
+		if hs.metricsClient != nil {
+			hs.metricsClient.RecordHTTPRetry(context.Background(), endpoint, batch.dimensions())
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-hs.ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// recordError reports a failed batch under its error category
+func (hs *HTTPSender) recordError(err error, endpoint string, dims metrics.Dimensions) {
+	if hs.metricsClient == nil {
+		return
+	}
+	ctx := context.Background()
+	switch classifyError(err) {
+	case errorClassTimeout:
+		hs.metricsClient.RecordHTTPTimeoutError(ctx, endpoint, dims)
+	case errorClassNetwork:
+		hs.metricsClient.RecordHTTPNetworkError(ctx, endpoint, dims)
+	case errorClassServer:
+		hs.metricsClient.RecordHTTPServerError(ctx, endpoint, dims)
+	case errorClassClient:
+		hs.metricsClient.RecordHTTPClientError(ctx, endpoint, dims)
+	default:
+		hs.metricsClient.RecordHTTPError(ctx, endpoint, dims)
+	}
+}
+
+// EndpointStatus is the delivery health of one endpoint
+type EndpointStatus struct {
+	Endpoint    string    `json:"endpoint"`
+	Healthy     bool      `json:"healthy"` // The last delivery reached it (true before any)
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// recordEndpoint tracks whether the endpoint is reachable after a delivery. Client errors
+// (4xx) reject the batch, not the endpoint, so they leave it healthy.
+func (hs *HTTPSender) recordEndpoint(endpoint string, err error) {
+	hs.endpointMu.Lock()
+	defer hs.endpointMu.Unlock()
+	status := hs.endpointStatus[endpoint]
+	if status == nil {
+		status = &EndpointStatus{Endpoint: endpoint}
+		hs.endpointStatus[endpoint] = status
+	}
+	if err == nil {
+		status.Healthy = true
+		status.LastSuccess = time.Now().UTC()
+		return
+	}
+	status.Healthy = classifyError(err) == errorClassClient
+	status.LastFailure = time.Now().UTC()
+	status.LastError = err.Error()
+}
+
+// EndpointStatuses returns the delivery health of every configured endpoint
+func (hs *HTTPSender) EndpointStatuses() []EndpointStatus {
+	hs.endpointMu.Lock()
+	defer hs.endpointMu.Unlock()
+	endpoints := hs.routes.Load().endpoints
+	statuses := make([]EndpointStatus, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if status := hs.endpointStatus[endpoint]; status != nil {
+			statuses = append(statuses, *status)
 		} else {
-			hs.sentBatches.Add(1)
-			hs.sentLines.Add(int64(len(batch.Lines)))
-			hs.sentBytes.Add(int64(batch.Size))
-			if hs.metricsClient != nil {
-				hs.metricsClient.RecordHTTPBatch(context.Background(), int64(len(batch.Lines)), int64(batch.Size))
-			}
+			statuses = append(statuses, EndpointStatus{Endpoint: endpoint, Healthy: true})
+		}
+	}
+	return statuses
+}
+
+// HealthyEndpoints returns how many endpoints accepted their last delivery (or have not
+// been sent to yet), out of all configured endpoints
+func (hs *HTTPSender) HealthyEndpoints() (healthy, total int) {
+	statuses := hs.EndpointStatuses()
+	for _, status := range statuses {
+		if status.Healthy {
+			healthy++
 		}
 	}
+	return healthy, len(statuses)
 }
 
-// sendBatch sends a batch via HTTP POST
-func (hs *HTTPSender) sendBatch(batch *Batch, endpoint string) error {
-	// Build request body (newline-delimited JSON)
-	var buf bytes.Buffer
-	for _, line := range batch.Lines {
-		buf.Write(line)
-		buf.WriteByte('\n')
+// recordStatus counts a response by status code
+func (hs *HTTPSender) recordStatus(endpoint string, statusCode int) {
+	hs.statusMu.Lock()
+	hs.statusCounts[statusCode]++
+	hs.statusMu.Unlock()
+	if hs.metricsClient != nil {
+		hs.metricsClient.RecordHTTPResponse(context.Background(), endpoint, statusCode)
 	}
+}
 
+// sendBatch sends an encoded batch via HTTP POST
+func (hs *HTTPSender) sendBatch(batch *Batch, endpoint string, p *payload) error {
 	// Create request with context for cancellation
-	req, err := http.NewRequestWithContext(hs.ctx, "POST", endpoint, &buf)
+	req, err := http.NewRequestWithContext(hs.ctx, "POST", endpoint, p.body())
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = int64(p.Len())
+	req.GetBody = p.getBody
 
 	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set(BatchIDHeader, batch.ID())
+	hs.routes.Load().headers[endpoint].apply(req.Header, batch.Source)
+
+	// Wait for an in-flight slot, if capped
+	if hs.inFlight != nil {
+		select {
+		case hs.inFlight <- struct{}{}:
+			defer func() { <-hs.inFlight }()
+		case <-hs.ctx.Done():
+			return fmt.Errorf("failed to send request: %w", hs.ctx.Err())
+		}
+	}
 
 	// Send request with timing
 	start := time.Now()
+	hs.inFlightReq.Add(1)
 	resp, err := hs.client.Do(req)
+	hs.inFlightReq.Add(-1)
 	duration := time.Since(start).Seconds()
 
 	// Record latency metric
 	if hs.metricsClient != nil {
-		hs.metricsClient.RecordHTTPRequestLatency(context.Background(), duration)
+		hs.metricsClient.RecordHTTPRequestLatency(metrics.WithBatchID(context.Background(), batch.ID()), endpoint, batch.dimensions(), duration)
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	hs.recordStatus(endpoint, resp.StatusCode)
 
 	// Check response
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
 	// Drain response body
@@ -270,3 +968,37 @@ func (hs *HTTPSender) sendBatch(batch *Batch, endpoint string) error {
 func (hs *HTTPSender) GetMetrics() (lines, bytes, batches, errors int64) {
 	return hs.sentLines.Load(), hs.sentBytes.Load(), hs.sentBatches.Load(), hs.errors.Load()
 }
+
+// GetRetries returns the number of retried send attempts
+func (hs *HTTPSender) GetRetries() int64 {
+	return hs.retries.Load()
+}
+
+// GetStatusCounts returns the number of responses received per HTTP status code
+func (hs *HTTPSender) GetStatusCounts() map[int]int64 {
+	hs.statusMu.Lock()
+	defer hs.statusMu.Unlock()
+	counts := make(map[int]int64, len(hs.statusCounts))
+	for code, n := range hs.statusCounts {
+		counts[code] = n
+	}
+	return counts
+}
+
+// GetSpilled returns the number of lines written to the spill directory
+func (hs *HTTPSender) GetSpilled() int64 {
+	return hs.spilled.Load()
+}
+
+// BufferUtilization returns the fraction of the line buffer currently in use
+func (hs *HTTPSender) BufferUtilization() float64 {
+	if hs.bufferSize == 0 {
+		return 0
+	}
+	return float64(len(hs.lineChan)) / float64(hs.bufferSize)
+}
+
+// GetDrops returns the number of lines discarded by the buffer policy
+func (hs *HTTPSender) GetDrops() int64 {
+	return hs.drops.Load()
+}
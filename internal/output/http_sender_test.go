@@ -1,6 +1,13 @@
 package output
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -39,8 +46,8 @@ func TestNewHTTPSender(t *testing.T) {
 		t.Fatal("NewHTTPSender returned nil")
 	}
 
-	if len(sender.endpoints) != 1 {
-		t.Errorf("Expected 1 endpoint, got %d", len(sender.endpoints))
+	if len(sender.Endpoints()) != 1 {
+		t.Errorf("Expected 1 endpoint, got %d", len(sender.Endpoints()))
 	}
 
 	if sender.batchLines != batchLines {
@@ -90,8 +97,8 @@ func TestHTTPSender_SendLine(t *testing.T) {
 	// Check that the line was queued
 	select {
 	case line := <-sender.lineChan:
-		if string(line) != string(testLine) {
-			t.Errorf("Expected line %q, got %q", testLine, line)
+		if string(line.data) != string(testLine) {
+			t.Errorf("Expected line %q, got %q", testLine, line.data)
 		}
 	default:
 		t.Error("Line was not queued")
@@ -173,13 +180,13 @@ func TestHTTPSender_MultipleEndpoints(t *testing.T) {
 		nil,
 	)
 
-	if len(sender.endpoints) != 3 {
-		t.Errorf("Expected 3 endpoints, got %d", len(sender.endpoints))
+	if len(sender.Endpoints()) != 3 {
+		t.Errorf("Expected 3 endpoints, got %d", len(sender.Endpoints()))
 	}
 
 	for i, expected := range endpoints {
-		if sender.endpoints[i] != expected {
-			t.Errorf("Expected endpoint[%d] %s, got %s", i, expected, sender.endpoints[i])
+		if sender.Endpoints()[i] != expected {
+			t.Errorf("Expected endpoint[%d] %s, got %s", i, expected, sender.Endpoints()[i])
 		}
 	}
 }
@@ -202,3 +209,394 @@ func TestBatch_NewBatch(t *testing.T) {
 		t.Errorf("Expected size 17, got %d", batch.Size)
 	}
 }
+
+func TestHTTPSender_TemplatedHeaders(t *testing.T) {
+	received := make(chan http.Header, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		1000, 1024*1024, 50*time.Millisecond, 1, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithHeaders(
+			map[string]string{"X-Static": "streamer", "X-Log-Format": "{format}"},
+			map[string]map[string]string{server.URL: {"X-S3-Key": "{bucket}/{s3_key}"}},
+		),
+	)
+	sender.Start()
+	defer sender.Stop()
+
+	sender.SendLineFrom(&Source{Bucket: "b", S3Key: "k1", Format: "zscaler"}, []byte("line 1"))
+	sender.SendLineFrom(&Source{Bucket: "b", S3Key: "k2", Format: "zscaler"}, []byte("line 2"))
+
+	for _, wantKey := range []string{"b/k1", "b/k2"} {
+		select {
+		case h := <-received:
+			if h.Get("X-Static") != "streamer" {
+				t.Errorf("Expected X-Static 'streamer', got %q", h.Get("X-Static"))
+			}
+			if h.Get("X-Log-Format") != "zscaler" {
+				t.Errorf("Expected X-Log-Format 'zscaler', got %q", h.Get("X-Log-Format"))
+			}
+			if h.Get("X-S3-Key") != wantKey {
+				t.Errorf("Expected X-S3-Key %q, got %q", wantKey, h.Get("X-S3-Key"))
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for batch with key %s", wantKey)
+		}
+	}
+}
+
+func TestHTTPSender_BufferPolicies(t *testing.T) {
+	newSender := func(policy BufferPolicy, timeout time.Duration) *HTTPSender {
+		return NewHTTPSender(
+			[]string{"http://localhost:8080"},
+			1000, 1024*1024, time.Second, 1, 1, // bufferSize = 1
+			30*time.Second, 100, 90*time.Second,
+			10*time.Second, 10*time.Second, time.Second,
+			nil,
+			WithBufferPolicy(policy, timeout),
+		)
+	}
+
+	t.Run("drop_newest", func(t *testing.T) {
+		sender := newSender(BufferPolicyDropNewest, 0)
+		sender.SendLine([]byte("line 1"))
+		sender.SendLine([]byte("line 2"))
+
+		if drops := sender.GetDrops(); drops != 1 {
+			t.Errorf("Expected 1 drop, got %d", drops)
+		}
+		if line := <-sender.lineChan; string(line.data) != "line 1" {
+			t.Errorf("Expected oldest line to be kept, got %q", line.data)
+		}
+	})
+
+	t.Run("drop_oldest", func(t *testing.T) {
+		sender := newSender(BufferPolicyDropOldest, 0)
+		sender.SendLine([]byte("line 1"))
+		sender.SendLine([]byte("line 2"))
+
+		if drops := sender.GetDrops(); drops != 1 {
+			t.Errorf("Expected 1 drop, got %d", drops)
+		}
+		if line := <-sender.lineChan; string(line.data) != "line 2" {
+			t.Errorf("Expected newest line to be kept, got %q", line.data)
+		}
+	})
+
+	t.Run("block_with_timeout", func(t *testing.T) {
+		sender := newSender(BufferPolicyBlockWithTimeout, 50*time.Millisecond)
+		sender.SendLine([]byte("line 1"))
+
+		start := time.Now()
+		sender.SendLine([]byte("line 2"))
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Expected SendLine to wait for the timeout, returned after %v", elapsed)
+		}
+		if drops := sender.GetDrops(); drops != 1 {
+			t.Errorf("Expected 1 drop, got %d", drops)
+		}
+	})
+
+	t.Run("dropped line resolves ack", func(t *testing.T) {
+		sender := newSender(BufferPolicyDropNewest, 0)
+		fired := false
+		var result error
+		ack := NewAck(func(err error) { fired, result = true, err })
+		var delivered int64
+		ack.OnProgress(0, func(n int64) { delivered = n })
+		src := &Source{S3Key: "key", Ack: ack}
+
+		sender.SendLineFrom(src, []byte("line 1"))
+		sender.SendLineFrom(src, []byte("line 2"))
+		line := <-sender.lineChan
+		ack.deliver(line.offset, line.offset)
+		ack.resolveAt(1, "http://localhost:8080", nil)
+		ack.Seal()
+
+		// A retry would send line 1 again
+		if !fired || result != nil {
+			t.Errorf("Expected the ack to succeed, got fired=%v err=%v", fired, result)
+		}
+		if delivered != 2 {
+			t.Errorf("Expected progress past the dropped line, got %d", delivered)
+		}
+		if d := ack.Destinations()[DestinationDropped]; d.Lines != 1 {
+			t.Errorf("Expected 1 dropped line, got %+v", d)
+		}
+	})
+}
+
+func TestHTTPSender_RetryClassification(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "bad request is not retried", status: http.StatusBadRequest, wantAttempts: 1, wantErr: true},
+		{name: "request timeout is retried", status: http.StatusRequestTimeout, wantAttempts: 3, wantErr: true},
+		{name: "too many requests is retried", status: http.StatusTooManyRequests, wantAttempts: 3, wantErr: true},
+		{name: "server error is retried", status: http.StatusServiceUnavailable, wantAttempts: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			sender := NewHTTPSender(
+				[]string{server.URL},
+				1000, 1024*1024, time.Second, 1, 10,
+				5*time.Second, 10, 90*time.Second,
+				10*time.Second, 10*time.Second, time.Second,
+				nil,
+				WithRetry(2, time.Millisecond, 5*time.Millisecond),
+			)
+
+			err := sender.sendWithRetry(&Batch{Lines: [][]byte{[]byte("line")}, Size: 5}, server.URL, 0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sendWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, got)
+			}
+			if got := sender.GetStatusCounts()[tt.status]; got != int64(tt.wantAttempts) {
+				t.Errorf("Expected %d responses with status %d, got %d", tt.wantAttempts, tt.status, got)
+			}
+		})
+	}
+}
+
+func TestHTTPSender_RetryThenSucceed(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		1000, 1024*1024, time.Second, 1, 10,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithRetry(3, time.Millisecond, 5*time.Millisecond),
+	)
+
+	if err := sender.sendWithRetry(&Batch{Lines: [][]byte{[]byte("line")}, Size: 5}, server.URL, 0); err != nil {
+		t.Fatalf("Expected retry to succeed, got %v", err)
+	}
+	if retries := sender.GetRetries(); retries != 1 {
+		t.Errorf("Expected 1 retry, got %d", retries)
+	}
+	counts := sender.GetStatusCounts()
+	if counts[http.StatusBadGateway] != 1 || counts[http.StatusOK] != 1 {
+		t.Errorf("Unexpected status counts: %v", counts)
+	}
+}
+
+func TestHTTPSender_MaxInFlight(t *testing.T) {
+	var current, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		current.Add(-1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		1000, 1024*1024, time.Second, 8, 10,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithMaxInFlight(2),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			batch := &Batch{Lines: [][]byte{[]byte(fmt.Sprintf("line %d", i))}, Size: 7}
+			if err := sender.sendWithRetry(batch, server.URL, i); err != nil {
+				t.Errorf("sendWithRetry failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > 2 {
+		t.Errorf("Expected at most 2 concurrent requests, got %d", p)
+	}
+}
+
+func TestBatch_Dimensions(t *testing.T) {
+	batch := &Batch{}
+	batch.add(queuedLine{data: []byte("a"), src: &Source{Bucket: "logs", Prefix: "zscaler/", Format: "zscaler"}})
+	batch.add(queuedLine{data: []byte("b"), src: &Source{Bucket: "logs", Prefix: "umbrella/", Format: "zscaler"}})
+
+	dims := batch.dimensions()
+	if dims.Bucket != "logs" || dims.Prefix != "mixed" || dims.Format != "zscaler" {
+		t.Errorf("Expected logs/mixed/zscaler, got %+v", dims)
+	}
+}
+
+func TestBatch_OldestTimestamp(t *testing.T) {
+	batch := &Batch{}
+	batch.add(queuedLine{data: []byte("a"), src: &Source{Timestamp: 200}})
+	batch.add(queuedLine{data: []byte("b"), src: &Source{Timestamp: 100}})
+	batch.add(queuedLine{data: []byte("c"), src: &Source{}}) // Unknown timestamp
+	batch.add(queuedLine{data: []byte("d")})
+	if batch.oldest != 100 {
+		t.Errorf("Expected oldest timestamp 100, got %d", batch.oldest)
+	}
+}
+
+func TestBatch_FormatLabel(t *testing.T) {
+	batch := &Batch{}
+	if got := batch.formatLabel(); got != "unknown" {
+		t.Errorf("Expected empty batch label 'unknown', got %q", got)
+	}
+
+	batch.add(queuedLine{data: []byte("a"), src: &Source{Format: "zscaler"}})
+	batch.add(queuedLine{data: []byte("b"), src: &Source{Format: "zscaler"}})
+	if got := batch.formatLabel(); got != "zscaler" {
+		t.Errorf("Expected label 'zscaler', got %q", got)
+	}
+
+	batch.add(queuedLine{data: []byte("c"), src: &Source{Format: "cisco_umbrella"}})
+	if got := batch.formatLabel(); got != "mixed" {
+		t.Errorf("Expected label 'mixed', got %q", got)
+	}
+	if batch.Size != 6 {
+		t.Errorf("Expected size 6, got %d", batch.Size)
+	}
+}
+
+func TestHTTPSender_HealthyEndpoints(t *testing.T) {
+	sender := NewHTTPSender([]string{"http://a", "http://b"}, 10, 1024, time.Second, 1, 10, time.Second, 1, time.Second, time.Second, time.Second, time.Second, nil)
+
+	if healthy, total := sender.HealthyEndpoints(); healthy != 2 || total != 2 {
+		t.Errorf("Expected 2 of 2 healthy before any delivery, got %d of %d", healthy, total)
+	}
+	sender.recordEndpoint("http://a", &StatusError{StatusCode: 503})
+	sender.recordEndpoint("http://b", &StatusError{StatusCode: 400}) // Rejected batch, reachable endpoint
+	if healthy, _ := sender.HealthyEndpoints(); healthy != 1 {
+		t.Errorf("Expected 1 healthy endpoint, got %d", healthy)
+	}
+	sender.recordEndpoint("http://a", nil)
+	if healthy, _ := sender.HealthyEndpoints(); healthy != 2 {
+		t.Errorf("Expected a successful delivery to restore the endpoint, got %d healthy", healthy)
+	}
+}
+
+func TestSource_Key(t *testing.T) {
+	a := &Source{Bucket: "b", S3Key: "k1", Format: "zscaler"}
+	b := &Source{Bucket: "b", S3Key: "k1", Format: "zscaler", ProcessingID: "2f1c9e0a"}
+	b.ResumeAt(10)
+	if a.key() != b.key() {
+		t.Error("Expected sources of the same object at different offsets to share a key")
+	}
+	if a.key() == (&Source{Bucket: "b", S3Key: "k2", Format: "zscaler"}).key() {
+		t.Error("Expected sources of different objects to have different keys")
+	}
+}
+
+func TestHTTPSender_TemplatedHeadersInterleaved(t *testing.T) {
+	var mu sync.Mutex
+	batches := make(map[string][]int) // Lines per request, by X-S3-Key
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		key := r.Header.Get("X-S3-Key")
+		batches[key] = append(batches[key], bytes.Count(body, []byte("\n")))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		10, 1024*1024, time.Minute, 1, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithHeaders(map[string]string{"X-S3-Key": "{s3_key}"}, nil),
+	)
+	sender.Start()
+
+	// Lines of two files arrive interleaved, as from two workers
+	a, b := &Source{Bucket: "b", S3Key: "a.gz"}, &Source{Bucket: "b", S3Key: "b.gz"}
+	for i := 0; i < 20; i++ {
+		sender.SendLineFrom(a, []byte("a"))
+		sender.SendLineFrom(b, []byte("b"))
+	}
+	sender.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range []string{"a.gz", "b.gz"} {
+		if got := batches[key]; len(got) != 2 || got[0] != 10 || got[1] != 10 {
+			t.Errorf("Expected two full batches for %s, got %v", key, got)
+		}
+	}
+}
+
+func TestHTTPSender_TemplatedHeadersConcurrentSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		10, 1024*1024, 10*time.Millisecond, 2, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithHeaders(map[string]string{"X-S3-Key": "{s3_key}"}, nil),
+	)
+	sender.Start()
+
+	// The batcher compares sources while their producers keep sending (run with -race)
+	var wg sync.WaitGroup
+	for _, key := range []string{"k1", "k2"} {
+		wg.Add(1)
+		go func(src *Source) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				sender.SendLineFrom(src, []byte("line"))
+			}
+		}(&Source{Bucket: "b", S3Key: key})
+	}
+	wg.Wait()
+	sender.Stop()
+
+	if lines, _, _, _ := sender.GetMetrics(); lines != 400 {
+		t.Errorf("Expected 400 lines sent, got %d", lines)
+	}
+}
@@ -0,0 +1,61 @@
+package output
+
+import "sync"
+
+// maxPooledLine caps the size of line buffers returned to the pool; longer lines are left
+// to the garbage collector so a few huge lines do not pin memory
+const maxPooledLine = 64 * 1024
+
+// linePool reuses the buffers holding queued lines (see SendLineCopy)
+var linePool = sync.Pool{
+	New: func() any { return new([]byte) },
+}
+
+// batchLinesPool reuses the line slices of batches
+var batchLinesPool = sync.Pool{
+	New: func() any { return new([][]byte) },
+}
+
+// copyLine copies line into a pooled buffer
+func copyLine(line []byte) *[]byte {
+	buf := linePool.Get().(*[]byte)
+	*buf = append((*buf)[:0], line...)
+	return buf
+}
+
+// releaseLine returns a line buffer to the pool. The line must no longer be referenced.
+func releaseLine(buf *[]byte) {
+	if buf == nil || cap(*buf) > maxPooledLine {
+		return
+	}
+	linePool.Put(buf)
+}
+
+// newBatchLines returns an empty line slice for a batch of up to n lines
+func newBatchLines(n int) [][]byte {
+	lines := *batchLinesPool.Get().(*[][]byte)
+	if cap(lines) < n {
+		return make([][]byte, 0, n)
+	}
+	return lines[:0]
+}
+
+// release returns the batch's pooled line buffers and line slice once it has been sent,
+// spilled or discarded. The batch must not be used afterwards.
+func (b *Batch) release() {
+	for _, buf := range b.bufs {
+		releaseLine(buf)
+	}
+	b.bufs = nil
+	if b.Lines != nil {
+		clear(b.Lines) // Drop references to released buffers
+		lines := b.Lines[:0]
+		batchLinesPool.Put(&lines)
+		b.Lines = nil
+	}
+}
+
+// release returns the line's buffer to the pool if it was pooled
+func (l queuedLine) release() {
+	releaseLine(l.buf)
+}
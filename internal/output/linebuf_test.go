@@ -0,0 +1,114 @@
+package output
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSender_SendLineCopy(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(data))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		2, 1024*1024, 50*time.Millisecond, 2, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+	)
+	sender.Start()
+
+	// The caller reuses one buffer for every line, like a bufio.Scanner token
+	src := &Source{Bucket: "b", S3Key: "k"}
+	buf := make([]byte, 0, 16)
+	for i := 0; i < 10; i++ {
+		buf = append(buf[:0], "line "...)
+		buf = append(buf, byte('0'+i))
+		sender.SendLineCopy(context.Background(), src, buf)
+	}
+	sender.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	got := strings.Split(strings.TrimSpace(strings.Join(bodies, "")), "\n")
+	seen := make(map[string]bool)
+	for _, line := range got {
+		seen[line] = true
+	}
+	for i := 0; i < 10; i++ {
+		if want := "line " + string(rune('0'+i)); !seen[want] {
+			t.Errorf("Expected %q to be delivered intact, got %q", want, got)
+		}
+	}
+}
+
+func TestHTTPSender_SendLineCopyCancelled(t *testing.T) {
+	// Not started, so the one-line buffer stays full
+	sender := NewHTTPSender(
+		[]string{"http://localhost:8080"},
+		1000, 1024*1024, time.Second, 1, 1,
+		30*time.Second, 100, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+	)
+	defer sender.Stop()
+	sender.SendLine([]byte("line 1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var result error
+	ack := NewAck(func(err error) { result = err })
+	go func() {
+		sender.SendLineCopy(ctx, &Source{Ack: ack}, []byte("line 2"))
+		ack.Seal()
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Blocked producer was not released by cancellation")
+	}
+	if result != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", result)
+	}
+}
+
+func TestBatch_Release(t *testing.T) {
+	batch := &Batch{Lines: newBatchLines(4)}
+	batch.add(queuedLine{data: []byte("plain")})
+	pooled := copyLine([]byte("pooled"))
+	batch.add(queuedLine{data: *pooled, buf: pooled})
+
+	if len(batch.bufs) != 1 {
+		t.Fatalf("Expected 1 pooled buffer, got %d", len(batch.bufs))
+	}
+	batch.release()
+	if batch.Lines != nil || batch.bufs != nil {
+		t.Error("Expected released batch to drop its lines and buffers")
+	}
+
+	// Oversized lines are not kept by the pool
+	big := copyLine(make([]byte, maxPooledLine+1))
+	releaseLine(big)
+	if got := copyLine([]byte("x")); cap(*got) > maxPooledLine {
+		t.Errorf("Expected an oversized buffer not to be pooled, got cap %d", cap(*got))
+	}
+}
@@ -0,0 +1,130 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError is returned when an endpoint answers with a non-2xx status
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Parsed Retry-After header (0 if absent)
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the status code indicates a transient failure.
+// 5xx, 408 (Request Timeout) and 429 (Too Many Requests) are retryable; other 4xx are not.
+func (e *StatusError) Retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// errorClass is the category an error is reported under in metrics
+type errorClass int
+
+const (
+	errorClassOther errorClass = iota
+	errorClassTimeout
+	errorClassNetwork
+	errorClassServer
+	errorClassClient
+)
+
+// classifyError determines the error category using typed errors rather than message text
+func classifyError(err error) errorClass {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode >= 500 {
+			return errorClassServer
+		}
+		return errorClassClient
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorClassTimeout
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) || errors.As(err, &netErr) {
+		return errorClassNetwork
+	}
+
+	return errorClassOther
+}
+
+// isRetryable reports whether a failed send should be attempted again
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false // Shutting down
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+
+	switch classifyError(err) {
+	case errorClassTimeout, errorClassNetwork:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay returns the wait before the given retry attempt (1-based),
+// doubling from base up to max and honouring any Retry-After from the server
+func retryDelay(err error, attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+		if delay > max {
+			delay = max
+		}
+	}
+	return delay
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{"server error", &StatusError{StatusCode: 502}, errorClassServer},
+		{"client error", &StatusError{StatusCode: 404}, errorClassClient},
+		{"deadline", fmt.Errorf("failed to send request: %w", context.DeadlineExceeded), errorClassTimeout},
+		{"dial error", fmt.Errorf("failed to send request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), errorClassNetwork},
+		{"other", errors.New("failed to create request"), errorClassOther},
+		// Message text alone must not drive classification
+		{"misleading message", errors.New("HTTP 500 network timeout"), errorClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if isRetryable(&StatusError{StatusCode: 400}) {
+		t.Error("400 should not be retryable")
+	}
+	if !isRetryable(&StatusError{StatusCode: 429}) {
+		t.Error("429 should be retryable")
+	}
+	if !isRetryable(&StatusError{StatusCode: 408}) {
+		t.Error("408 should be retryable")
+	}
+	if !isRetryable(&StatusError{StatusCode: 500}) {
+		t.Error("500 should be retryable")
+	}
+	if isRetryable(fmt.Errorf("failed to send request: %w", context.Canceled)) {
+		t.Error("Cancelled requests should not be retried")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+
+	if d := retryDelay(errors.New("x"), 1, base, max); d != base {
+		t.Errorf("Expected first delay %v, got %v", base, d)
+	}
+	if d := retryDelay(errors.New("x"), 3, base, max); d != 400*time.Millisecond {
+		t.Errorf("Expected third delay 400ms, got %v", d)
+	}
+	if d := retryDelay(errors.New("x"), 10, base, max); d != max {
+		t.Errorf("Expected delay capped at %v, got %v", max, d)
+	}
+	if d := retryDelay(&StatusError{StatusCode: 429, RetryAfter: 500 * time.Millisecond}, 1, base, max); d != 500*time.Millisecond {
+		t.Errorf("Expected Retry-After to be honoured, got %v", d)
+	}
+}
@@ -0,0 +1,49 @@
+package output
+
+import "github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+
+// endpointRoutes are the endpoints batches are sent to and the extra headers of each.
+// They are replaced as a whole, so a batch is always sent with a consistent set.
+type endpointRoutes struct {
+	endpoints []string
+	headers   map[string]headerSet
+}
+
+func newEndpointRoutes(endpoints []string, global map[string]string, perEndpoint map[string]map[string]string) *endpointRoutes {
+	r := &endpointRoutes{endpoints: endpoints, headers: make(map[string]headerSet, len(endpoints))}
+	for _, endpoint := range endpoints {
+		r.headers[endpoint] = newHeaderSet(global, perEndpoint[endpoint])
+	}
+	return r
+}
+
+// endpoint returns the endpoint a sender worker delivers to
+func (r *endpointRoutes) endpoint(workerID int) string {
+	return r.endpoints[workerID%len(r.endpoints)]
+}
+
+// Endpoints returns the endpoints batches are sent to
+func (hs *HTTPSender) Endpoints() []string {
+	return hs.routes.Load().endpoints
+}
+
+// SetEndpoints replaces the endpoints and their extra headers (see WithHeaders) while the
+// sender runs. Batches already being sent finish on their endpoint; later batches use the
+// new ones. Endpoints must not be empty.
+func (hs *HTTPSender) SetEndpoints(endpoints []string, global map[string]string, perEndpoint map[string]map[string]string) {
+	next := newEndpointRoutes(endpoints, global, perEndpoint)
+	old := hs.routes.Swap(next)
+
+	// Forget the delivery health of removed endpoints
+	hs.endpointMu.Lock()
+	for endpoint := range hs.endpointStatus {
+		if _, ok := next.headers[endpoint]; !ok {
+			delete(hs.endpointStatus, endpoint)
+		}
+	}
+	hs.endpointMu.Unlock()
+
+	logging.Component("http_sender").Info("HTTP endpoints updated",
+		"from", old.endpoints,
+		"to", endpoints)
+}
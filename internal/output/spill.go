@@ -0,0 +1,100 @@
+package output
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSpilled is reported to a file's Ack when its lines were written to the spill directory
+// instead of being delivered (e.g. the drain deadline expired during shutdown)
+var ErrSpilled = errors.New("lines spilled to disk for replay")
+
+// ErrSenderStopped is reported to a file's Ack when a line was rejected because the sender is stopping
+var ErrSenderStopped = errors.New("sender stopped")
+
+const (
+	spillFilePrefix = "spill-"
+	spillFileSuffix = ".ndjson"
+)
+
+// spiller appends undeliverable lines to a newline-delimited file for replay on next start
+type spiller struct {
+	dir   string
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	lines int64
+}
+
+// newSpiller creates a spiller writing into dir (nil if dir is empty)
+func newSpiller(dir string) *spiller {
+	if dir == "" {
+		return nil
+	}
+	return &spiller{dir: dir}
+}
+
+// write appends lines to the current spill file, creating it on first use
+func (s *spiller) write(lines [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			return fmt.Errorf("failed to create spill directory: %w", err)
+		}
+		name := fmt.Sprintf("%s%d%s", spillFilePrefix, time.Now().UnixNano(), spillFileSuffix)
+		file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create spill file: %w", err)
+		}
+		s.file = file
+		s.w = bufio.NewWriter(file)
+	}
+
+	for _, line := range lines {
+		if _, err := s.w.Write(line); err != nil {
+			return fmt.Errorf("failed to write spill file: %w", err)
+		}
+		if err := s.w.WriteByte('\n'); err != nil {
+			return fmt.Errorf("failed to write spill file: %w", err)
+		}
+		s.lines++
+	}
+	return nil
+}
+
+// close flushes and syncs the spill file
+func (s *spiller) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("failed to flush spill file: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("failed to sync spill file: %w", err)
+	}
+	return s.file.Close()
+}
+
+// ListSpillFiles returns the spill files in dir, oldest first
+func ListSpillFiles(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, spillFilePrefix+"*"+spillFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches) // Names embed a nanosecond timestamp
+	return matches, nil
+}
@@ -0,0 +1,215 @@
+package output
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSender_StopDrainsBufferedLines(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(
+		[]string{server.URL},
+		10, 1024*1024, time.Hour, 2, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithDrain(5*time.Second, ""),
+	)
+	sender.Start()
+	for i := 0; i < 25; i++ {
+		sender.SendLine([]byte("line"))
+	}
+	sender.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 25 {
+		t.Errorf("Expected all 25 lines delivered on Stop, got %d", len(received))
+	}
+
+	// Sending after Stop must not panic
+	sender.SendLine([]byte("late line"))
+	sender.Stop()
+}
+
+func TestHTTPSender_StopReleasesBlockedProducer(t *testing.T) {
+	sender := NewHTTPSender(
+		[]string{"http://localhost:8080"},
+		1000, 1024*1024, time.Second, 1, 1,
+		30*time.Second, 100, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+	)
+	sender.SendLine([]byte("line 1"))
+
+	done := make(chan struct{})
+	var result error
+	ack := NewAck(func(err error) { result = err })
+	go func() {
+		sender.SendLineFrom(&Source{Ack: ack}, []byte("line 2"))
+		ack.Seal()
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	sender.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Blocked producer was not released by Stop")
+	}
+	if result != ErrSenderStopped {
+		t.Errorf("Expected ErrSenderStopped, got %v", result)
+	}
+}
+
+func TestHTTPSender_SpillOnDeadlineAndReplay(t *testing.T) {
+	spillDir := t.TempDir()
+
+	// Endpoint that never answers within the drain deadline
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	sender := NewHTTPSender(
+		[]string{slow.URL},
+		5, 1024*1024, time.Hour, 1, 100,
+		30*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithDrain(100*time.Millisecond, spillDir),
+	)
+	sender.Start()
+	for i := 0; i < 12; i++ {
+		sender.SendLine([]byte("spilled line"))
+	}
+	sender.Stop()
+
+	if spilled := sender.GetSpilled(); spilled != 12 {
+		t.Fatalf("Expected 12 spilled lines, got %d", spilled)
+	}
+	files, err := ListSpillFiles(spillDir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected 1 spill file, got %v (err: %v)", files, err)
+	}
+
+	// A new sender replays the spill file and removes it once delivered
+	received := make(chan int, 10)
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- strings.Count(string(body), "\n")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ok.Close()
+
+	replay := NewHTTPSender(
+		[]string{ok.URL},
+		100, 1024*1024, 20*time.Millisecond, 1, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithDrain(5*time.Second, spillDir),
+	)
+	replay.Start()
+	defer replay.Stop()
+
+	total := 0
+	for total < 12 {
+		select {
+		case n := <-received:
+			total += n
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for replay, got %d lines", total)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(files[0]); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Spill file was not removed after replay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPSender_ReplaySkipsEnvelope(t *testing.T) {
+	spillDir := t.TempDir()
+	env, err := ParseEnvelope(`{"event": {line}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelopes := map[string]*Envelope{"*": env}
+
+	// Nothing listens here, so the line is spilled once the drain deadline expires
+	sender := NewHTTPSender(
+		[]string{"http://127.0.0.1:1"},
+		5, 1024*1024, time.Hour, 1, 100,
+		30*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithDrain(time.Millisecond, spillDir),
+		WithRetry(100, time.Second, time.Second),
+		WithEnvelopes(envelopes),
+	)
+	sender.Start()
+	sender.SendLineFrom(&Source{S3Key: "a.gz", Format: "zscaler"}, []byte(`{"user":"a"}`))
+	sender.Stop()
+	if spilled := sender.GetSpilled(); spilled != 1 {
+		t.Fatalf("Expected 1 spilled line, got %d", spilled)
+	}
+
+	received := make(chan string, 1)
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ok.Close()
+
+	replay := NewHTTPSender(
+		[]string{ok.URL},
+		100, 1024*1024, 20*time.Millisecond, 1, 100,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+		WithDrain(5*time.Second, spillDir),
+		WithEnvelopes(envelopes),
+	)
+	replay.Start()
+	defer replay.Stop()
+
+	select {
+	case body := <-received:
+		if want := "{\"event\": {\"user\":\"a\"}}\n"; body != want {
+			t.Errorf("Expected the line wrapped once, %q, got %q", want, body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for replay")
+	}
+}
@@ -0,0 +1,177 @@
+// Package reload applies a changed configuration to a running streamer without a restart.
+package reload
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/worker"
+)
+
+// Reloadable settings, by the key reported in Apply's results
+const (
+	keyEndpoints       = "http.endpoints"
+	keyHeaders         = "http.headers"
+	keyEndpointHeaders = "http.endpoint_headers"
+	keyWorkerCount     = "processing.worker_count"
+	keyLogFormats      = "processing.log_formats"
+	keyDefaultFormat   = "processing.default_format"
+	keyLogFormat       = "processing.log_format"
+	keyLogLevel        = "logging.level"
+	keyLogLevels       = "logging.levels"
+)
+
+// Reloader applies the reloadable settings of a changed configuration to the running
+// components: the HTTP endpoints and headers, the worker count, the log formats and the
+// log levels. Each change takes effect gracefully: batches and files in progress finish
+// with the settings they started with. Other changes, including all state storage
+// settings, are logged as requiring a restart and not applied, so state persistence is
+// never interrupted.
+type Reloader struct {
+	mu       sync.Mutex
+	current  *config.Config
+	sender   *output.HTTPSender
+	pool     *worker.HTTPPool
+	scanners []*scanner.Scanner
+}
+
+// NewReloader creates a reloader for the running configuration cfg
+func NewReloader(cfg *config.Config) *Reloader {
+	return &Reloader{current: cfg}
+}
+
+// SetSender makes endpoint and header changes apply to sender. Call before Apply.
+func (r *Reloader) SetSender(sender *output.HTTPSender) {
+	r.sender = sender
+}
+
+// SetPool makes worker count and format changes apply to pool. Call before Apply.
+func (r *Reloader) SetPool(pool *worker.HTTPPool) {
+	r.pool = pool
+}
+
+// AddScanner makes format changes apply to s. Call before Apply.
+func (r *Reloader) AddScanner(s *scanner.Scanner) {
+	r.scanners = append(r.scanners, s)
+}
+
+// Apply applies next, a validated configuration, and returns the changed keys it applied
+// and those that require a restart
+func (r *Reloader) Apply(next *config.Config) (applied, restart []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	logger := logging.GetDefaultLogger()
+
+	var endpoints, workers, formatsChanged, level, levels bool
+	for _, key := range changedKeys(r.current, next) {
+		switch {
+		case (key == keyEndpoints || key == keyHeaders || key == keyEndpointHeaders) && r.sender != nil:
+			endpoints = true
+		case key == keyWorkerCount && r.pool != nil:
+			workers = true
+		case (key == keyLogFormats || key == keyDefaultFormat || key == keyLogFormat) && (r.pool != nil || len(r.scanners) > 0):
+			formatsChanged = true
+		case key == keyLogLevel:
+			level = true
+		case key == keyLogLevels:
+			levels = true
+		default:
+			restart = append(restart, key)
+			continue
+		}
+		applied = append(applied, key)
+	}
+
+	if endpoints {
+		r.sender.SetEndpoints(next.HTTP.Endpoints, next.HTTP.Headers, next.HTTP.EndpointHeaders)
+	}
+	if workers {
+		r.pool.SetWorkerCount(next.Processing.WorkerCount)
+	}
+	if formatsChanged {
+		if err := r.applyFormats(next); err != nil {
+			logger.Error("Failed to apply log format change", "error", err)
+		}
+	}
+	if level {
+		if err := logger.SetLevel(next.Logging.Level); err != nil {
+			logger.Error("Failed to apply log level change", "error", err)
+		}
+	}
+	if levels {
+		if err := logger.SetComponentLevels(next.Logging.Levels); err != nil {
+			logger.Error("Failed to apply component log level change", "error", err)
+		}
+	}
+	r.current = next
+
+	if len(applied) > 0 {
+		logger.Info("Configuration reloaded", "applied", applied)
+	}
+	if len(restart) > 0 {
+		logger.Warn("Configuration changes require a restart to take effect", "keys", restart)
+	}
+	return applied, restart
+}
+
+// applyFormats rebuilds the format registry and switches the scanners and pool to the
+// configured default format (the scanners auto-detect when it is "auto")
+func (r *Reloader) applyFormats(next *config.Config) error {
+	registry := formats.NewRegistryFromConfig(next.Processing.LogFormats)
+	name := next.Processing.DefaultFormat
+	if name == "" {
+		name = next.Processing.LogFormat
+	}
+
+	var format formats.LogFormat
+	if name != "" && name != "auto" {
+		var err error
+		if format, err = registry.GetFormat(name); err != nil {
+			return err
+		}
+	}
+	for _, s := range r.scanners {
+		s.SetFormat(format, registry)
+	}
+	if r.pool != nil && format != nil {
+		r.pool.SetLogFormat(format)
+	}
+	return nil
+}
+
+// changedKeys returns the settings that differ between old and next, as "section.key"
+// (or just "section" for top-level settings)
+func changedKeys(old, next *config.Config) []string {
+	var keys []string
+	oldValue, nextValue := reflect.ValueOf(*old), reflect.ValueOf(*next)
+	t := oldValue.Type()
+	for i := 0; i < t.NumField(); i++ {
+		section := yamlName(t.Field(i))
+		a, b := oldValue.Field(i), nextValue.Field(i)
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			continue
+		}
+		if a.Kind() != reflect.Struct {
+			keys = append(keys, section)
+			continue
+		}
+		for j := 0; j < a.NumField(); j++ {
+			if !reflect.DeepEqual(a.Field(j).Interface(), b.Field(j).Interface()) {
+				keys = append(keys, section+"."+yamlName(a.Type().Field(j)))
+			}
+		}
+	}
+	return keys
+}
+
+// yamlName returns the configuration key of a struct field
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
@@ -0,0 +1,84 @@
+package reload
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/worker"
+)
+
+func TestReloader_Apply(t *testing.T) {
+	current := &config.Config{
+		HTTP:       config.HTTPConfig{Endpoints: []string{"http://a:8080"}},
+		Processing: config.ProcessingConfig{WorkerCount: 2, DefaultFormat: "zscaler"},
+		State:      config.StateConfig{FilePath: "/var/lib/s3-streamer/state.json"},
+		Logging:    config.LoggingConfig{Level: "info"},
+	}
+
+	sender := output.NewHTTPSender(current.HTTP.Endpoints, 10, 1000, time.Second, 1, 10,
+		time.Second, 1, time.Second, time.Second, time.Second, time.Second, nil)
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	pool := worker.NewHTTPPool(&s3.Client{}, sender, stateManager, "test-bucket", 2, 10, nil, formats.NewZscalerFormat())
+	pool.Start()
+	defer pool.Stop()
+
+	reloader := NewReloader(current)
+	reloader.SetSender(sender)
+	reloader.SetPool(pool)
+
+	next := *current
+	next.HTTP.Endpoints = []string{"http://b:8080", "http://c:8080"}
+	next.Processing.WorkerCount = 4
+	next.Processing.DefaultFormat = "cisco_umbrella"
+	next.State.FilePath = "/data/state.json"
+	next.Logging.Levels = map[string]string{"scanner": "debug"}
+	defer logging.GetDefaultLogger().SetComponentLevels(nil)
+	applied, restart := reloader.Apply(&next)
+
+	for _, key := range []string{"http.endpoints", "processing.worker_count", "processing.default_format", "logging.levels"} {
+		if !slices.Contains(applied, key) {
+			t.Errorf("Expected %s to be applied, got %v", key, applied)
+		}
+	}
+	if !slices.Equal(restart, []string{"state.file_path"}) {
+		t.Errorf("Expected state.file_path to require a restart, got %v", restart)
+	}
+	if got := sender.Endpoints(); !slices.Equal(got, next.HTTP.Endpoints) {
+		t.Errorf("Expected the new endpoints, got %v", got)
+	}
+	if n := pool.GetWorkerCount(); n != 4 {
+		t.Errorf("Expected 4 workers, got %d", n)
+	}
+	if !logging.Component("scanner").Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Expected scanner debug logging after the reload")
+	}
+
+	// Applying the same configuration again changes nothing
+	if applied, restart := reloader.Apply(&next); len(applied) != 0 || len(restart) != 0 {
+		t.Errorf("Expected no changes, got %v, %v", applied, restart)
+	}
+}
+
+func TestReloader_MissingComponent(t *testing.T) {
+	current := &config.Config{HTTP: config.HTTPConfig{Endpoints: []string{"http://a:8080"}}}
+	next := *current
+	next.HTTP.Endpoints = []string{"http://b:8080"}
+
+	// Without a sender to update, an endpoint change needs a restart
+	applied, restart := NewReloader(current).Apply(&next)
+	if len(applied) != 0 || !slices.Equal(restart, []string{"http.endpoints"}) {
+		t.Errorf("Expected http.endpoints to require a restart, got %v, %v", applied, restart)
+	}
+}
@@ -0,0 +1,127 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Message is the message of logged records
+const Message = "file_complete"
+
+// Reasons lines of a file were not queued for delivery (see Record.Skipped)
+const (
+	SkipResumed  = "resumed"   // Delivered by an earlier attempt, before its checkpoint
+	SkipFiltered = "filtered"  // Dropped by the log format (e.g. header lines)
+	SkipLongLine = "long_line" // Longer than the maximum line size, with the skip policy
+)
+
+// Record is the processing report of one file, for reconciliation against the source.
+// LinesIn equals LinesOut plus the skipped lines, except that a long line split into
+// pieces counts once in LinesIn and once per piece in LinesOut.
+type Record struct {
+	Key          string                              `json:"key"`
+	StreamID     string                              `json:"stream_id,omitempty"`
+	Format       string                              `json:"format"`
+	Timestamp    int64                               `json:"timestamp"` // The file's timestamp (Unix seconds)
+	LinesIn      int64                               `json:"lines_in"`  // Lines in the object
+	LinesOut     int64                               `json:"lines_out"` // Lines queued for delivery
+	Skipped      map[string]int64                    `json:"skipped,omitempty"`
+	BytesIn      int64                               `json:"bytes_in"`  // Object bytes downloaded
+	BytesOut     int64                               `json:"bytes_out"` // Bytes of the lines queued
+	DurationMs   int64                               `json:"duration_ms"`
+	Result       string                              `json:"result"` // As audit.Record.Result
+	Error        string                              `json:"error,omitempty"`
+	Destinations map[string]output.DestinationResult `json:"destinations,omitempty"` // By endpoint, "spill" or "unsent"
+	CompletedAt  time.Time                           `json:"completed_at"`
+
+	ProcessingID string `json:"processing_id,omitempty"`
+}
+
+// Options configures a Reporter
+type Options struct {
+	Log        bool   // Log each record at info level
+	Path       string // JSON lines file the records are appended to (optional)
+	MaxSizeMB  int    // Size that triggers a rotation of the file (default: 100)
+	MaxBackups int    // Rotated files kept (0 = all)
+}
+
+// Reporter logs the processing report of each file and appends it to a report file
+type Reporter struct {
+	log  bool
+	mu   sync.Mutex
+	file *lumberjack.Logger // nil without a path
+}
+
+// NewReporter creates a reporter, opening the report file if opts has a path
+func NewReporter(opts Options) (*Reporter, error) {
+	r := &Reporter{log: opts.Log}
+	if opts.Path == "" {
+		return r, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+	r.file = &lumberjack.Logger{
+		Filename:   opts.Path,
+		MaxSize:    opts.MaxSizeMB,
+		MaxBackups: opts.MaxBackups,
+		LocalTime:  true,
+	}
+	// lumberjack opens the file on the first write; open it now so a bad path fails here
+	if _, err := r.file.Write(nil); err != nil {
+		return nil, fmt.Errorf("failed to open report file: %w", err)
+	}
+	return r, nil
+}
+
+// Report records a processed file
+func (r *Reporter) Report(rec Record) {
+	if r.log {
+		logging.Component("worker").Info(Message,
+			"s3_key", rec.Key,
+			"processing_id", rec.ProcessingID,
+			"format", rec.Format,
+			"lines_in", rec.LinesIn,
+			"lines_out", rec.LinesOut,
+			slog.Any("skipped", rec.Skipped),
+			"bytes_in", rec.BytesIn,
+			"bytes_out", rec.BytesOut,
+			"duration_ms", rec.DurationMs,
+			"result", rec.Result,
+			"error", rec.Error,
+			slog.Any("destinations", rec.Destinations))
+	}
+	if r.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(rec)
+	if err == nil {
+		r.mu.Lock()
+		_, err = r.file.Write(append(line, '\n'))
+		r.mu.Unlock()
+	}
+	if err != nil {
+		logging.Component("worker").Warn("Failed to write processing report", "path", r.file.Filename, "error", err)
+	}
+}
+
+// Close closes the report file
+func (r *Reporter) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,90 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+)
+
+func TestReporter_LogsAndWritesRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logging.InitDefaultLogger(logging.Config{Level: "info", Format: "json", Writer: &buf})
+	defer logging.InitDefaultLogger(logging.Config{Level: "info", Format: "text"})
+
+	path := filepath.Join(t.TempDir(), "reports", "files.jsonl")
+	reporter, err := NewReporter(Options{Log: true, Path: path})
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	reporter.Report(Record{
+		Key:      "logs/a.gz",
+		Format:   "zscaler",
+		LinesIn:  10,
+		LinesOut: 7,
+		Skipped:  map[string]int64{SkipFiltered: 1, SkipResumed: 2},
+		Result:   "delivered",
+		Destinations: map[string]output.DestinationResult{
+			"http://localhost:8080": {Lines: 5},
+			output.DestinationSpill: {Failed: 2, Error: "spilled to disk"},
+		},
+	})
+	reporter.Report(Record{Key: "logs/b.gz", Result: "failed", Error: "HTTP 503"})
+	if err := reporter.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	logged := buf.String()
+	if strings.Count(logged, `"msg":"file_complete"`) != 2 || !strings.Contains(logged, `"lines_in":10`) ||
+		!strings.Contains(logged, `"skipped":{"filtered":1,"resumed":2}`) {
+		t.Errorf("Expected two file_complete records with their counts, got %s", logged)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open report file: %v", err)
+	}
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Invalid report line %s: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records in the report file, got %d", len(records))
+	}
+	if d := records[0].Destinations["http://localhost:8080"]; d.Lines != 5 {
+		t.Errorf("Expected 5 lines accepted by the endpoint, got %+v", records[0].Destinations)
+	}
+	if records[1].Key != "logs/b.gz" || records[1].Error != "HTTP 503" {
+		t.Errorf("Expected logs/b.gz failed with its error, got %+v", records[1])
+	}
+}
+
+func TestReporter_Disabled(t *testing.T) {
+	var buf bytes.Buffer
+	logging.InitDefaultLogger(logging.Config{Level: "info", Format: "json", Writer: &buf})
+	defer logging.InitDefaultLogger(logging.Config{Level: "info", Format: "text"})
+
+	reporter, err := NewReporter(Options{})
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	reporter.Report(Record{Key: "logs/a.gz"})
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing logged without Log, got %s", buf.String())
+	}
+	if err := reporter.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+)
+
+// PauseGate stops scanners from returning new files while paused by an operator or while
+// the pool sheds load, so work already queued drains without more being added. One gate is
+// shared by every scanner of a process.
+type PauseGate struct {
+	mu     sync.Mutex
+	status PauseStatus
+}
+
+// PauseStatus describes whether processing is paused, and by whom
+type PauseStatus struct {
+	Paused   bool      `json:"paused"`
+	Since    time.Time `json:"since,omitempty"`
+	By       string    `json:"by,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Shedding bool      `json:"shedding,omitempty"` // Paused by load shedding, independently of the operator
+}
+
+// NewPauseGate creates an open gate
+func NewPauseGate() *PauseGate {
+	return &PauseGate{}
+}
+
+// Pause stops new files from being scanned. It returns false if already paused, keeping
+// the original status.
+func (g *PauseGate) Pause(by, reason string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.status.Paused {
+		return false
+	}
+	g.status = PauseStatus{Paused: true, Since: time.Now().UTC(), By: by, Reason: reason, Shedding: g.status.Shedding}
+	return true
+}
+
+// Resume lets scanning continue. It returns false if not paused.
+func (g *PauseGate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.status.Paused {
+		return false
+	}
+	g.status = PauseStatus{Shedding: g.status.Shedding}
+	return true
+}
+
+// SetShedding pauses or resumes scanning for load shedding. It is independent of Pause and
+// Resume, so neither undoes the other. It returns false if shedding was already in that state.
+func (g *PauseGate) SetShedding(shedding bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.status.Shedding == shedding {
+		return false
+	}
+	g.status.Shedding = shedding
+	return true
+}
+
+// Status returns the current pause status
+func (g *PauseGate) Status() PauseStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
+
+// Paused reports whether scanning is paused by an operator or shedding. A nil gate is
+// never paused.
+func (g *PauseGate) Paused() bool {
+	if g == nil {
+		return false
+	}
+	status := g.Status()
+	return status.Paused || status.Shedding
+}
@@ -0,0 +1,61 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPauseGate(t *testing.T) {
+	var nilGate *PauseGate
+	if nilGate.Paused() {
+		t.Error("Expected a nil gate to be open")
+	}
+
+	gate := NewPauseGate()
+	if !gate.Pause("alice", "maintenance") {
+		t.Error("Expected the first pause to succeed")
+	}
+	if gate.Pause("bob", "") {
+		t.Error("Expected a second pause to be a no-op")
+	}
+	if status := gate.Status(); !status.Paused || status.By != "alice" || status.Since.IsZero() {
+		t.Errorf("Expected paused by alice, got %+v", status)
+	}
+
+	// A paused scanner returns no files without listing S3
+	s := &Scanner{}
+	s.SetPauseGate(gate)
+	jobs, err := s.Scan(context.Background(), 0, "")
+	if err != nil || len(jobs) != 0 {
+		t.Errorf("Expected no files while paused, got %d, %v", len(jobs), err)
+	}
+
+	if !gate.Resume() || gate.Resume() {
+		t.Error("Expected only the first resume to succeed")
+	}
+	if gate.Paused() {
+		t.Error("Expected the gate to be open after resume")
+	}
+}
+
+func TestPauseGate_Shedding(t *testing.T) {
+	gate := NewPauseGate()
+	if !gate.SetShedding(true) || gate.SetShedding(true) {
+		t.Error("Expected only the first change to report true")
+	}
+	if !gate.Paused() {
+		t.Error("Expected the gate to be closed while shedding")
+	}
+
+	// An operator pause and resume leave shedding alone
+	gate.Pause("alice", "")
+	gate.Resume()
+	if status := gate.Status(); !status.Shedding || !gate.Paused() {
+		t.Errorf("Expected shedding to survive a resume, got %+v", status)
+	}
+
+	gate.SetShedding(false)
+	if gate.Paused() {
+		t.Error("Expected the gate to be open once shedding stops")
+	}
+}
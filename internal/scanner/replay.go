@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrNoScanner is returned for a replayed key outside every scanner's prefix
+var ErrNoScanner = errors.New("key is not under any stream prefix")
+
+// ReplayRequest selects files to send again regardless of the checkpoint: listed keys,
+// or the files of a time window (optionally under a prefix) as for a ranged ScanRequest
+type ReplayRequest struct {
+	Keys   []string
+	Prefix string
+	From   int64 // Unix seconds
+	To     int64 // Unix seconds (default: now minus the delay window)
+	Tag    bool  // Give the replay an ID that tags its lines and batch IDs
+	By     string
+}
+
+// ReplayResult reports what a replay enqueued
+type ReplayResult struct {
+	ID       string            `json:"id,omitempty"`      // Set when tagged
+	Files    int               `json:"files"`             // Enqueued
+	Rejected int               `json:"rejected"`          // Not enqueued because the queue was full
+	Skipped  map[string]string `json:"skipped,omitempty"` // Keys that could not be replayed, with the reason
+}
+
+// Replayer finds the files of a replay with the scanners and submits them for processing
+type Replayer struct {
+	scanners []*Scanner
+	submit   func(FileJob) bool
+}
+
+// NewReplayer creates a replayer that hands files to submit (usually HTTPPool.Submit)
+func NewReplayer(submit func(FileJob) bool, scanners ...*Scanner) *Replayer {
+	return &Replayer{scanners: scanners, submit: submit}
+}
+
+// Replay enqueues the files selected by req
+func (r *Replayer) Replay(ctx context.Context, req ReplayRequest) (ReplayResult, error) {
+	var result ReplayResult
+	if req.Tag {
+		result.ID = "replay-" + time.Now().UTC().Format("20060102T150405.000Z")
+	}
+
+	var jobs []FileJob
+	if len(req.Keys) > 0 {
+		for _, key := range req.Keys {
+			job, err := r.lookup(ctx, strings.TrimPrefix(key, "/"))
+			if err != nil {
+				if result.Skipped == nil {
+					result.Skipped = make(map[string]string)
+				}
+				result.Skipped[key] = err.Error()
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+	} else {
+		scan := ScanRequest{Prefix: req.Prefix, From: req.From, To: req.To, By: req.By}
+		for _, s := range r.scanners {
+			found, err := s.ScanRange(ctx, scan)
+			if err != nil {
+				return result, err
+			}
+			jobs = append(jobs, found...)
+		}
+	}
+
+	for _, job := range jobs {
+		job.Replay = result.ID
+		if r.submit(job) {
+			result.Files++
+		} else {
+			result.Rejected++
+		}
+	}
+	return result, nil
+}
+
+// lookup builds the job of one key with the scanner whose prefix is the longest match
+func (r *Replayer) lookup(ctx context.Context, key string) (FileJob, error) {
+	var owner *Scanner
+	for _, s := range r.scanners {
+		if strings.HasPrefix(key, s.prefix) && (owner == nil || len(s.prefix) > len(owner.prefix)) {
+			owner = s
+		}
+	}
+	if owner == nil {
+		return FileJob{}, ErrNoScanner
+	}
+	return owner.Lookup(ctx, key)
+}
+
+// Lookup builds the job of one object, whatever its timestamp. A key whose timestamp
+// cannot be parsed is still returned, with a zero timestamp.
+func (s *Scanner) Lookup(ctx context.Context, key string) (FileJob, error) {
+	head, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return FileJob{}, fmt.Errorf("failed to look up object: %w", err)
+	}
+
+	timestamp, err := s.parseTimestamp(key)
+	if err != nil {
+		timestamp = 0
+	}
+
+	return FileJob{
+		S3Key:        key,
+		Timestamp:    timestamp,
+		Size:         aws.ToInt64(head.ContentLength),
+		StreamID:     s.StreamID(),
+		ProcessingID: NewProcessingID(),
+	}, nil
+}
@@ -0,0 +1,64 @@
+package scanner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestReplayer_Keys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "1234")
+	}))
+	defer server.Close()
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	var submitted []FileJob
+	submit := func(job FileJob) bool {
+		submitted = append(submitted, job)
+		return len(submitted) < 2 // The queue fills after one file
+	}
+	replayer := NewReplayer(submit,
+		NewScanner(client, "bucket", "logs/", 0, nil, nil),
+		NewScanner(client, "bucket", "logs/db/", 0, nil, nil),
+	)
+
+	result, err := replayer.Replay(context.Background(), ReplayRequest{
+		Keys: []string{"logs/db/1.log", "logs/app.log", "logs/missing.log", "other/1.log"},
+		Tag:  true,
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if result.ID == "" || result.Files != 1 || result.Rejected != 1 || len(result.Skipped) != 2 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.Skipped["other/1.log"] != ErrNoScanner.Error() {
+		t.Errorf("Expected other/1.log to have no scanner, got %q", result.Skipped["other/1.log"])
+	}
+
+	job := submitted[0]
+	if job.StreamID != "bucket/logs/db/" || job.Size != 1234 || job.Replay != result.ID {
+		t.Errorf("Expected the key on the longest matching prefix, got %+v", job)
+	}
+	if job.Timestamp != 0 {
+		t.Errorf("Expected a key without a parseable timestamp to be replayed with 0, got %d", job.Timestamp)
+	}
+	if submitted[1].StreamID != "bucket/logs/" {
+		t.Errorf("Expected logs/app.log on the logs/ stream, got %s", submitted[1].StreamID)
+	}
+}
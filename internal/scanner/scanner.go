@@ -2,15 +2,20 @@ package scanner
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
 )
 
 // FileJob represents a file to be processed
@@ -18,6 +23,19 @@ type FileJob struct {
 	S3Key     string
 	Timestamp int64
 	Size      int64
+	StreamID  string // Checkpoint the file advances once processed (see Scanner.StreamID)
+	Replay    string // Replay ID when the file is replayed with tagging (see Replayer)
+
+	// ProcessingID identifies this attempt at the file in the logs of every stage, its
+	// failure entry and its audit record (see NewProcessingID)
+	ProcessingID string
+}
+
+// NewProcessingID returns a random ID for a file's processing attempt
+func NewProcessingID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
 }
 
 // Scanner scans S3 for files to process
@@ -26,8 +44,11 @@ type Scanner struct {
 	bucket         string
 	prefix         string
 	delayWindow    time.Duration
+	formatMu       sync.RWMutex      // Guards logFormat and formatRegistry (see SetFormat)
 	logFormat      formats.LogFormat // Configured format (nil for auto-detection)
 	formatRegistry *formats.Registry // Registry for auto-detection
+	metricsClient  *metrics.Metrics  // Records successful scans (optional)
+	pause          *PauseGate        // Scans return no files while paused (optional)
 }
 
 // NewScanner creates a new S3 scanner
@@ -48,8 +69,38 @@ func NewScanner(s3Client *s3.Client, bucket, prefix string, delayWindow time.Dur
 	}
 }
 
-// Scan scans S3 for files in the given time range
+// SetMetricsClient records each successful scan (the scanner heartbeat and last scan time)
+func (s *Scanner) SetMetricsClient(m *metrics.Metrics) {
+	s.metricsClient = m
+}
+
+// SetFormat changes the format timestamps are parsed with (nil for auto-detection with
+// formatRegistry) from the next scan on
+func (s *Scanner) SetFormat(logFormat formats.LogFormat, formatRegistry *formats.Registry) {
+	s.formatMu.Lock()
+	defer s.formatMu.Unlock()
+	s.logFormat = logFormat
+	s.formatRegistry = formatRegistry
+}
+
+// SetPauseGate makes Scan return no files while gate is paused
+func (s *Scanner) SetPauseGate(gate *PauseGate) {
+	s.pause = gate
+}
+
+// StreamID identifies this scanner's bucket and prefix in state, so each
+// bucket/prefix pair keeps an independent checkpoint
+func (s *Scanner) StreamID() string {
+	return s.bucket + "/" + s.prefix
+}
+
+// Scan scans S3 for files in the given time range. It returns no files while the pause
+// gate is paused.
 func (s *Scanner) Scan(ctx context.Context, fromTimestamp int64, lastProcessedFile string) ([]FileJob, error) {
+	if s.pause.Paused() {
+		return nil, nil
+	}
+
 	// Calculate the time range
 	now := time.Now()
 	endTime := now.Add(-s.delayWindow)
@@ -74,7 +125,16 @@ func (s *Scanner) Scan(ctx context.Context, fromTimestamp int64, lastProcessedFi
 		}
 		jobs = append(jobs, files...)
 	}
-
+	logging.Component("scanner").Debug("Scanned for new files",
+		"bucket", s.bucket,
+		"prefixes", len(prefixesToScan),
+		"from", time.Unix(fromTimestamp, 0).UTC(),
+		"to", endTime.UTC(),
+		"files", len(jobs))
+
+	if s.metricsClient != nil {
+		s.metricsClient.RecordScan(ctx, s.bucket, now)
+	}
 	return jobs, nil
 }
 
@@ -103,19 +163,10 @@ func (s *Scanner) listFiles(ctx context.Context, prefix string, lastProcessedFil
 
 		for _, obj := range page.Contents {
 			// Parse timestamp from filename using format-specific parser
-			var timestamp int64
-			var err error
-
-			if s.logFormat != nil {
-				// Use configured format
-				timestamp, err = s.logFormat.ParseTimestamp(*obj.Key)
-			} else {
-				// Auto-detection mode - try all formats
-				timestamp, err = s.detectAndParseTimestamp(*obj.Key)
-			}
-
+			timestamp, err := s.parseTimestamp(*obj.Key)
 			if err != nil {
 				// Skip files we can't parse
+				logging.Component("scanner").Debug("Skipping file without a timestamp", "s3_key", *obj.Key, "error", err)
 				continue
 			}
 
@@ -125,9 +176,11 @@ func (s *Scanner) listFiles(ctx context.Context, prefix string, lastProcessedFil
 			}
 
 			jobs = append(jobs, FileJob{
-				S3Key:     *obj.Key,
-				Timestamp: timestamp,
-				Size:      *obj.Size,
+				S3Key:        *obj.Key,
+				Timestamp:    timestamp,
+				Size:         *obj.Size,
+				StreamID:     s.StreamID(),
+				ProcessingID: NewProcessingID(),
 			})
 		}
 	}
@@ -160,14 +213,27 @@ func (s *Scanner) generatePrefixes(fromTimestamp, toTimestamp int64) []string {
 	return prefixes
 }
 
+// parseTimestamp parses the timestamp from a key with the configured format, or with the
+// format detected from the key in auto-detection mode
+func (s *Scanner) parseTimestamp(key string) (int64, error) {
+	s.formatMu.RLock()
+	logFormat, formatRegistry := s.logFormat, s.formatRegistry
+	s.formatMu.RUnlock()
+
+	if logFormat != nil {
+		return logFormat.ParseTimestamp(key)
+	}
+	return detectAndParseTimestamp(formatRegistry, key)
+}
+
 // detectAndParseTimestamp attempts to detect the format and parse timestamp
-func (s *Scanner) detectAndParseTimestamp(key string) (int64, error) {
-	if s.formatRegistry == nil {
+func detectAndParseTimestamp(formatRegistry *formats.Registry, key string) (int64, error) {
+	if formatRegistry == nil {
 		return 0, fmt.Errorf("format registry not available for auto-detection")
 	}
 
 	// Use registry's detection logic
-	detectedFormat := s.formatRegistry.DetectFormat(key, nil) // No content sample available
+	detectedFormat := formatRegistry.DetectFormat(key, nil) // No content sample available
 	if detectedFormat == nil {
 		return 0, fmt.Errorf("could not detect format for key: %s", key)
 	}
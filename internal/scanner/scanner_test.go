@@ -40,6 +40,10 @@ func TestNewScanner(t *testing.T) {
 	if scanner.s3Client != s3Client {
 		t.Error("s3Client not set correctly")
 	}
+
+	if id := scanner.StreamID(); id != "test-bucket/logs/" {
+		t.Errorf("Expected stream ID 'test-bucket/logs/', got '%s'", id)
+	}
 }
 
 func TestParseTimestampFromKey(t *testing.T) {
@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// scanTriggerQueue is how many out-of-cycle scans can wait for the scan loop
+const scanTriggerQueue = 16
+
+// ScanRequest asks for an out-of-cycle scan. Without a prefix or range it is a regular
+// scan from the checkpoint; otherwise the range is listed regardless of the checkpoint, so
+// files already processed in it are sent again.
+type ScanRequest struct {
+	Prefix string `json:"prefix,omitempty"` // Key prefix to list (default: the day partitions of the range)
+	From   int64  `json:"from,omitempty"`   // Oldest file timestamp (Unix seconds)
+	To     int64  `json:"to,omitempty"`     // Newest file timestamp (default: now minus the delay window)
+	By     string `json:"by,omitempty"`
+}
+
+// Ranged reports whether the request replays a prefix or time range instead of
+// scanning from the checkpoint
+func (r ScanRequest) Ranged() bool {
+	return r.Prefix != "" || r.From != 0 || r.To != 0
+}
+
+// ScanTrigger queues out-of-cycle scans for the scan loop, which receives them from C
+// alongside its scan_interval ticker
+type ScanTrigger struct {
+	ch chan ScanRequest
+}
+
+// NewScanTrigger creates an empty trigger
+func NewScanTrigger() *ScanTrigger {
+	return &ScanTrigger{ch: make(chan ScanRequest, scanTriggerQueue)}
+}
+
+// Trigger queues req. It returns false if too many scans are already waiting.
+func (t *ScanTrigger) Trigger(req ScanRequest) bool {
+	select {
+	case t.ch <- req:
+		return true
+	default:
+		return false
+	}
+}
+
+// C delivers the queued scans
+func (t *ScanTrigger) C() <-chan ScanRequest {
+	return t.ch
+}
+
+// ScanRange lists the files of a ranged scan request. A prefix outside this scanner's
+// prefix returns no files, so one request can be offered to every scanner. Like Scan, it
+// returns no files while the pause gate is paused.
+func (s *Scanner) ScanRange(ctx context.Context, req ScanRequest) ([]FileJob, error) {
+	if s.pause.Paused() {
+		return nil, nil
+	}
+	if req.Prefix != "" && !strings.HasPrefix(req.Prefix, s.prefix) && !strings.HasPrefix(s.prefix, req.Prefix) {
+		return nil, nil
+	}
+
+	now := time.Now()
+	to := req.To
+	if to == 0 {
+		to = now.Add(-s.delayWindow).Unix()
+	}
+
+	from := req.From
+	var prefixes []string
+	if len(req.Prefix) > len(s.prefix) {
+		// Narrower than this scanner's prefix: list it directly, from its oldest file by default
+		prefixes = []string{req.Prefix}
+	} else {
+		if from == 0 {
+			from = time.Unix(to, 0).Add(-1 * time.Minute).Unix()
+		}
+		prefixes = s.generatePrefixes(from, to)
+	}
+
+	var jobs []FileJob
+	for _, prefix := range prefixes {
+		files, err := s.listFiles(ctx, prefix, "", from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files for prefix %s: %w", prefix, err)
+		}
+		jobs = append(jobs, files...)
+	}
+
+	if s.metricsClient != nil {
+		s.metricsClient.RecordScan(ctx, s.bucket, now)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScanTrigger(t *testing.T) {
+	trigger := NewScanTrigger()
+	for i := 0; i < scanTriggerQueue; i++ {
+		if !trigger.Trigger(ScanRequest{}) {
+			t.Fatalf("Expected scan %d to be queued", i)
+		}
+	}
+	if trigger.Trigger(ScanRequest{}) {
+		t.Error("Expected a full queue to reject the scan")
+	}
+	if req := <-trigger.C(); req.Ranged() {
+		t.Errorf("Expected an unranged scan, got %+v", req)
+	}
+	if !(ScanRequest{From: 1700000000}).Ranged() || !(ScanRequest{Prefix: "logs/"}).Ranged() {
+		t.Error("Expected a range or prefix to make the scan ranged")
+	}
+}
+
+func TestScanRange_OtherPrefix(t *testing.T) {
+	// Requests for another scanner's prefix return no files without listing S3
+	s := NewScanner(nil, "bucket", "logs/app/", 0, nil, nil)
+	jobs, err := s.ScanRange(context.Background(), ScanRequest{Prefix: "logs/db/year=2023/"})
+	if err != nil || len(jobs) != 0 {
+		t.Errorf("Expected no files for another prefix, got %d, %v", len(jobs), err)
+	}
+}
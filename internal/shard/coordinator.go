@@ -0,0 +1,284 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// registry tracks live instances and per-file claims shared by all instances
+type registry interface {
+	heartbeat(ctx context.Context, identity string, ttl time.Duration) ([]string, error) // Register and return live members
+	leave(ctx context.Context, identity string) error
+	claim(ctx context.Context, key, identity string, ttl time.Duration) (bool, error) // Claim a file unless another instance holds it
+	release(ctx context.Context, key, identity string) error
+}
+
+// Coordinator splits S3 keys between instances. Keys hash to a fixed number of shards,
+// shards are assigned to live instances by rendezvous hashing, and each shard keeps its own
+// checkpoint (stream ID "<bucket>/<prefix>#<shard>") in the shared state, so a shard resumes
+// where its previous owner stopped. A file is claimed before it is sent, so an instance
+// still finishing a shard that just moved and the shard's new owner never both send it.
+type Coordinator struct {
+	registry          registry
+	identity          string
+	shards            int
+	heartbeatInterval time.Duration
+	memberTTL         time.Duration
+	claimTTL          time.Duration
+
+	mu         sync.RWMutex
+	owned      []bool
+	renewed    time.Time // Last successful heartbeat
+	generation uint64    // Incremented whenever the owned shards change
+	reloaded   uint64    // Generation whose checkpoints were last reloaded
+
+	observe func(Assignment) // Optional, see SetAssignmentObserver
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// New creates a coordinator using Redis for membership and claims
+func New(cfg config.ShardingConfig, redisConfig config.RedisConfig) *Coordinator {
+	return newCoordinator(newRedisRegistry(redisConfig, cfg.KeyPrefix), cfg)
+}
+
+func newCoordinator(reg registry, cfg config.ShardingConfig) *Coordinator {
+	return &Coordinator{
+		registry:          reg,
+		identity:          cfg.Identity,
+		shards:            cfg.Shards,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		memberTTL:         cfg.MemberTTL,
+		claimTTL:          cfg.ClaimTTL,
+		stopCh:            make(chan struct{}),
+		doneCh:            make(chan struct{}),
+	}
+}
+
+// Assignment is the set of shards an instance owns
+type Assignment struct {
+	Owned   []int // Owned shards, ascending
+	Members int   // Live instances in the ring
+	Shards  int   // Total number of shards
+}
+
+// Ranges formats the owned shards compactly, e.g. "0-3,7,9-10" ("" when none are owned)
+func (a Assignment) Ranges() string {
+	var b strings.Builder
+	for i := 0; i < len(a.Owned); {
+		j := i
+		for j+1 < len(a.Owned) && a.Owned[j+1] == a.Owned[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(a.Owned[i]))
+		if j > i {
+			b.WriteString("-" + strconv.Itoa(a.Owned[j]))
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// SetAssignmentObserver has observe called with the new assignment whenever the owned shards
+// change, and with none once this instance leaves the ring. Call before Start.
+func (c *Coordinator) SetAssignmentObserver(observe func(Assignment)) {
+	c.observe = observe
+}
+
+// Start joins the ring and keeps the membership fresh until Stop
+func (c *Coordinator) Start(ctx context.Context) error {
+	if err := c.refresh(ctx); err != nil {
+		return fmt.Errorf("failed to join shard ring: %w", err)
+	}
+	go c.heartbeatLoop()
+	return nil
+}
+
+// Stop leaves the ring so the remaining instances take over this instance's shards
+func (c *Coordinator) Stop() {
+	close(c.stopCh)
+	<-c.doneCh
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.heartbeatInterval)
+	defer cancel()
+	if err := c.registry.leave(ctx, c.identity); err != nil {
+		logging.Component("shard").Warn("Failed to leave shard ring", "identity", c.identity, "error", err)
+	}
+	if c.observe != nil {
+		c.observe(Assignment{Shards: c.shards})
+	}
+}
+
+// Owns reports whether the key's shard is currently assigned to this instance.
+// Nothing is owned once heartbeats have failed for longer than the member TTL,
+// since the other instances have taken over this instance's shards by then.
+func (c *Coordinator) Owns(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.owned == nil || time.Since(c.renewed) > c.memberTTL {
+		return false
+	}
+	return c.owned[shardOf(key, c.shards)]
+}
+
+// ScanFrom returns where a stream must be listed from so that every owned shard is covered:
+// the oldest checkpoint among them. No LastFile is returned because the shards interleave.
+func (c *Coordinator) ScanFrom(streamID string, manager state.StateManager) state.Checkpoint {
+	c.reload(manager)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var from state.Checkpoint
+	first := true
+	for shard, owned := range c.owned {
+		if !owned {
+			continue
+		}
+		cp := c.checkpoint(manager, streamID, shard)
+		if first || cp.Timestamp < from.Timestamp {
+			from.Timestamp = cp.Timestamp
+			first = false
+		}
+	}
+	return from
+}
+
+// Assign keeps the jobs this instance owns, has not yet passed in the shard's checkpoint and
+// could claim. Kept jobs advance their shard's checkpoint when processed.
+func (c *Coordinator) Assign(ctx context.Context, jobs []scanner.FileJob, manager state.StateManager) []scanner.FileJob {
+	c.reload(manager)
+
+	assigned := jobs[:0]
+	for _, job := range jobs {
+		if !c.Owns(job.S3Key) {
+			continue
+		}
+		shard := shardOf(job.S3Key, c.shards)
+		cp := c.checkpoint(manager, job.StreamID, shard)
+		job.StreamID = shardStreamID(job.StreamID, shard)
+		if job.Timestamp < cp.Timestamp || (job.Timestamp == cp.Timestamp && job.S3Key <= cp.LastFile) {
+			continue
+		}
+
+		claimed, err := c.registry.claim(ctx, job.S3Key, c.identity, c.claimTTL)
+		if err != nil {
+			logging.Component("shard").Warn("Failed to claim file, skipping until next scan", "s3_key", job.S3Key, "error", err)
+			continue
+		}
+		if !claimed {
+			continue // Another instance is sending or has sent it
+		}
+		assigned = append(assigned, job)
+	}
+	return assigned
+}
+
+// Release gives up the claim on a file that failed so it can be retried
+func (c *Coordinator) Release(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.heartbeatInterval)
+	defer cancel()
+	if err := c.registry.release(ctx, key, c.identity); err != nil {
+		logging.Component("shard").Warn("Failed to release file claim", "s3_key", key, "error", err)
+	}
+}
+
+// checkpoint returns a shard's position. A shard without one starts from the unsharded
+// stream's position, so enabling sharding continues where the single instance stopped.
+func (c *Coordinator) checkpoint(manager state.StateManager, streamID string, shard int) state.Checkpoint {
+	if cp := manager.GetCheckpoint(shardStreamID(streamID, shard)); cp.Timestamp != 0 {
+		return cp
+	}
+	return state.Checkpoint{Timestamp: manager.GetCheckpoint(streamID).Timestamp}
+}
+
+// reload picks up checkpoints saved by previous owners after the owned shards changed
+func (c *Coordinator) reload(manager state.StateManager) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reloaded == c.generation {
+		return
+	}
+	if reloader, ok := manager.(state.Reloader); ok {
+		if err := reloader.Reload(); err != nil {
+			logging.Component("shard").Error("Failed to reload shard checkpoints", "error", err)
+			return // Retried on the next scan
+		}
+	}
+	c.reloaded = c.generation
+}
+
+// refresh renews this instance's membership and recomputes the owned shards
+func (c *Coordinator) refresh(ctx context.Context) error {
+	members, err := c.registry.heartbeat(ctx, c.identity, c.memberTTL)
+	if err != nil {
+		return err
+	}
+	owned := assign(members, c.identity, c.shards)
+
+	c.mu.Lock()
+	c.renewed = time.Now()
+	if c.owned != nil && slices.Equal(owned, c.owned) {
+		c.mu.Unlock()
+		return nil
+	}
+	c.owned = owned
+	c.generation++
+	c.mu.Unlock()
+
+	assignment := Assignment{Members: len(members), Shards: c.shards}
+	for shard, o := range owned {
+		if o {
+			assignment.Owned = append(assignment.Owned, shard)
+		}
+	}
+	logging.Component("shard").Info("Shard assignment changed",
+		"identity", c.identity,
+		"members", len(members),
+		"owned_shards", len(assignment.Owned),
+		"total_shards", c.shards)
+	if c.observe != nil {
+		c.observe(assignment)
+	}
+	return nil
+}
+
+// heartbeatLoop refreshes membership every heartbeat interval
+func (c *Coordinator) heartbeatLoop() {
+	defer crash.Recover()
+	defer close(c.doneCh)
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.heartbeatInterval)
+			if err := c.refresh(ctx); err != nil {
+				logging.Component("shard").Warn("Shard heartbeat failed", "identity", c.identity, "error", err)
+			}
+			cancel()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// shardStreamID is the checkpoint stream of one shard of a bucket/prefix stream
+func shardStreamID(streamID string, shard int) string {
+	return streamID + "#" + strconv.Itoa(shard)
+}
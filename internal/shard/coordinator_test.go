@@ -0,0 +1,254 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// fakeRegistry is an in-memory registry shared by several coordinators
+type fakeRegistry struct {
+	mu      sync.Mutex
+	members map[string]bool
+	claims  map[string]string
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{members: map[string]bool{}, claims: map[string]string{}}
+}
+
+func (r *fakeRegistry) heartbeat(ctx context.Context, identity string, ttl time.Duration) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.members[identity] = true
+	var members []string
+	for m := range r.members {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (r *fakeRegistry) leave(ctx context.Context, identity string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.members, identity)
+	return nil
+}
+
+func (r *fakeRegistry) claim(ctx context.Context, key, identity string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if holder, ok := r.claims[key]; ok {
+		return holder == identity, nil
+	}
+	r.claims[key] = identity
+	return true, nil
+}
+
+func (r *fakeRegistry) release(ctx context.Context, key, identity string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.claims[key] == identity {
+		delete(r.claims, key)
+	}
+	return nil
+}
+
+func newTestCoordinator(t *testing.T, reg *fakeRegistry, identity string) *Coordinator {
+	c := newCoordinator(reg, config.ShardingConfig{
+		Identity:          identity,
+		Shards:            64,
+		HeartbeatInterval: time.Hour, // Refreshed explicitly by the tests
+		MemberTTL:         2 * time.Hour,
+		ClaimTTL:          time.Hour,
+	})
+	if err := c.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	return c
+}
+
+func newTestState(t *testing.T) *state.Manager {
+	manager, err := state.NewManager(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return manager
+}
+
+func testJobs(n int) []scanner.FileJob {
+	jobs := make([]scanner.FileJob, n)
+	for i := range jobs {
+		jobs[i] = scanner.FileJob{S3Key: fmt.Sprintf("logs/%d_a_b_%d.gz", 1000+i, i), Timestamp: int64(1000 + i), StreamID: "bucket/logs/"}
+	}
+	return jobs
+}
+
+func TestAssign_RendezvousStability(t *testing.T) {
+	members := []string{"a", "b", "c"}
+	before := make([]string, 256)
+	for shard := range before {
+		before[shard] = owner(members, shard)
+	}
+
+	// Adding a member only moves shards to the new member
+	moved := 0
+	for shard := range before {
+		after := owner(append(members, "d"), shard)
+		if after != before[shard] {
+			if after != "d" {
+				t.Fatalf("Shard %d moved from %s to %s instead of the new member", shard, before[shard], after)
+			}
+			moved++
+		}
+	}
+	if moved < 32 || moved > 96 {
+		t.Errorf("Expected about a quarter of 256 shards to move, got %d", moved)
+	}
+
+	counts := map[string]int{}
+	for _, o := range before {
+		counts[o]++
+	}
+	for _, m := range members {
+		if counts[m] < 50 {
+			t.Errorf("Expected an even spread, member %s owns %d of 256 shards", m, counts[m])
+		}
+	}
+}
+
+func TestCoordinator_EachFileSentOnce(t *testing.T) {
+	reg := newFakeRegistry()
+	a := newTestCoordinator(t, reg, "instance-a")
+	b := newTestCoordinator(t, reg, "instance-b")
+	if err := a.refresh(context.Background()); err != nil { // a sees b join
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	manager := newTestState(t)
+	assignedA := a.Assign(context.Background(), testJobs(200), manager)
+	assignedB := b.Assign(context.Background(), testJobs(200), manager)
+
+	if len(assignedA) == 0 || len(assignedB) == 0 {
+		t.Fatalf("Expected both instances to get work, got %d and %d", len(assignedA), len(assignedB))
+	}
+	if total := len(assignedA) + len(assignedB); total != 200 {
+		t.Errorf("Expected every file assigned exactly once, got %d assignments", total)
+	}
+	for _, job := range assignedA {
+		if !a.Owns(job.S3Key) || b.Owns(job.S3Key) {
+			t.Errorf("File %s assigned to a non-owner", job.S3Key)
+		}
+		if expected := shardStreamID("bucket/logs/", shardOf(job.S3Key, 64)); job.StreamID != expected {
+			t.Errorf("Expected stream %s, got %s", expected, job.StreamID)
+		}
+	}
+}
+
+func TestCoordinator_Rebalance(t *testing.T) {
+	reg := newFakeRegistry()
+	a := newTestCoordinator(t, reg, "instance-a")
+	b := newTestCoordinator(t, reg, "instance-b")
+	a.refresh(context.Background())
+
+	manager := newTestState(t)
+	jobs := b.Assign(context.Background(), testJobs(200), manager)
+
+	// b finishes half of its files, then fails one and leaves
+	for _, job := range jobs[:len(jobs)/2] {
+		manager.UpdateStreamProgress(job.StreamID, job.Timestamp, job.S3Key, 1)
+	}
+	failed := jobs[len(jobs)/2]
+	b.Release(failed.S3Key)
+	reg.leave(context.Background(), "instance-b")
+	a.refresh(context.Background())
+
+	// a takes over b's shards; files b delivered are behind the shard checkpoints and
+	// files b still holds claims on are skipped, but the released file is retried
+	taken := a.Assign(context.Background(), testJobs(200), manager)
+	sent := map[string]bool{}
+	for _, job := range jobs[:len(jobs)/2] {
+		sent[job.S3Key] = true
+	}
+	foundFailed := false
+	for _, job := range taken {
+		if sent[job.S3Key] {
+			t.Errorf("File %s delivered by instance-b was assigned again", job.S3Key)
+		}
+		if job.S3Key == failed.S3Key {
+			foundFailed = true
+		}
+	}
+	if !foundFailed {
+		t.Error("Expected the released file to be retried by the new owner")
+	}
+}
+
+func TestCoordinator_ScanFrom(t *testing.T) {
+	reg := newFakeRegistry()
+	c := newTestCoordinator(t, reg, "instance-a")
+	manager := newTestState(t)
+
+	// Sharding enabled on an existing deployment: shards start from the stream checkpoint
+	manager.UpdateStreamProgress("bucket/logs/", 500, "logs/500.gz", 1)
+	if from := c.ScanFrom("bucket/logs/", manager); from.Timestamp != 500 || from.LastFile != "" {
+		t.Errorf("Expected scan from 500 without a last file, got %+v", from)
+	}
+
+	manager.UpdateStreamProgress(shardStreamID("bucket/logs/", 3), 800, "logs/800.gz", 1)
+	manager.UpdateStreamProgress(shardStreamID("bucket/logs/", 7), 300, "logs/300.gz", 1)
+	if from := c.ScanFrom("bucket/logs/", manager); from.Timestamp != 300 {
+		t.Errorf("Expected scan from the oldest shard checkpoint 300, got %d", from.Timestamp)
+	}
+}
+
+func TestCoordinator_AssignmentObserver(t *testing.T) {
+	reg := newFakeRegistry()
+	a := newTestCoordinator(t, reg, "instance-a")
+	var got []Assignment
+	a.SetAssignmentObserver(func(assignment Assignment) {
+		got = append(got, assignment)
+	})
+
+	newTestCoordinator(t, reg, "instance-b")
+	a.refresh(context.Background())
+	a.refresh(context.Background()) // Unchanged, not reported again
+	if len(got) != 1 {
+		t.Fatalf("Expected one assignment change, got %d", len(got))
+	}
+	if got[0].Members != 2 || got[0].Shards != 64 || len(got[0].Owned) == 0 || len(got[0].Owned) == 64 {
+		t.Errorf("Expected part of the 64 shards with 2 members, got %+v", got[0])
+	}
+
+	go a.heartbeatLoop() // Stop waits for it
+	a.Stop()
+	if last := got[len(got)-1]; len(last.Owned) != 0 {
+		t.Errorf("Expected no shards after leaving, got %v", last.Owned)
+	}
+}
+
+func TestAssignment_Ranges(t *testing.T) {
+	tests := []struct {
+		owned []int
+		want  string
+	}{
+		{nil, ""},
+		{[]int{5}, "5"},
+		{[]int{0, 1, 2, 3, 7, 9, 10}, "0-3,7,9-10"},
+		{[]int{1, 3, 5}, "1,3,5"},
+	}
+	for _, tt := range tests {
+		if got := (Assignment{Owned: tt.owned}).Ranges(); got != tt.want {
+			t.Errorf("Ranges(%v) = %q, want %q", tt.owned, got, tt.want)
+		}
+	}
+}
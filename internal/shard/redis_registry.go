@@ -0,0 +1,80 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseScript deletes a claim only if this instance holds it
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// redisRegistry keeps members in a sorted set scored by heartbeat expiry (Unix ms)
+// and claims as keys holding the claiming instance's identity
+type redisRegistry struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+func newRedisRegistry(redisConfig config.RedisConfig, keyPrefix string) *redisRegistry {
+	return &redisRegistry{
+		client: redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", redisConfig.Host, redisConfig.Port),
+			Password: redisConfig.Password,
+			DB:       redisConfig.Database,
+		}),
+		keyPrefix: keyPrefix,
+	}
+}
+
+func (r *redisRegistry) membersKey() string {
+	return r.keyPrefix + ":members"
+}
+
+func (r *redisRegistry) claimKey(key string) string {
+	return r.keyPrefix + ":claim:" + key
+}
+
+func (r *redisRegistry) heartbeat(ctx context.Context, identity string, ttl time.Duration) ([]string, error) {
+	now := time.Now()
+	var members *redis.StringSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, r.membersKey(), redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: identity})
+		pipe.ZRemRangeByScore(ctx, r.membersKey(), "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		members = pipe.ZRange(ctx, r.membersKey(), 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members.Val(), nil
+}
+
+func (r *redisRegistry) leave(ctx context.Context, identity string) error {
+	return r.client.ZRem(ctx, r.membersKey(), identity).Err()
+}
+
+func (r *redisRegistry) claim(ctx context.Context, key, identity string, ttl time.Duration) (bool, error) {
+	ok, err := r.client.SetNX(ctx, r.claimKey(key), identity, ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	// A file this instance claimed earlier (e.g. re-listed while still in flight) stays ours
+	holder, err := r.client.Get(ctx, r.claimKey(key)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return holder == identity, err
+}
+
+func (r *redisRegistry) release(ctx context.Context, key, identity string) error {
+	return releaseScript.Run(ctx, r.client, []string{r.claimKey(key)}, identity).Err()
+}
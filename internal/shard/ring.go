@@ -0,0 +1,49 @@
+package shard
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// shardOf maps an S3 key to one of n shards
+func shardOf(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// assign returns the shards owned by identity among members, using rendezvous hashing:
+// each shard goes to the member with the highest score, so a membership change only
+// moves the shards of the members that joined or left.
+func assign(members []string, identity string, n int) []bool {
+	owned := make([]bool, n)
+	for shard := 0; shard < n; shard++ {
+		owned[shard] = owner(members, shard) == identity
+	}
+	return owned
+}
+
+// owner returns the member with the highest rendezvous score for a shard
+func owner(members []string, shard int) string {
+	var best string
+	var bestScore uint64
+	suffix := "#" + strconv.Itoa(shard)
+	for _, member := range members {
+		h := fnv.New64a()
+		h.Write([]byte(member + suffix))
+		if score := mix(h.Sum64()); best == "" || score > bestScore || (score == bestScore && member < best) {
+			best, bestScore = member, score
+		}
+	}
+	return best
+}
+
+// mix spreads FNV output, whose high bits vary little for inputs sharing a prefix (splitmix64 finalizer)
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,197 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// compactedKey is the s3_key of the summary record (S3 keys are never empty)
+const compactedKey = ""
+
+// CompactionResult describes one compaction run
+type CompactionResult struct {
+	Removed  int64         // Per-key entries removed
+	Size     int64         // Per-key entries kept
+	Duration time.Duration // Time the run took
+}
+
+// Compactor is implemented by state managers whose per-key tracking (resume offsets,
+// file records) grows with the number of objects and must be pruned
+type Compactor interface {
+	// Compact removes per-key entries not updated within retention. Checkpoints and totals are kept.
+	Compact(retention time.Duration) (CompactionResult, error)
+}
+
+// RunCompaction compacts every interval until stop is closed, passing each result to observe
+// (e.g. to record metrics). observe may be nil.
+func RunCompaction(c Compactor, retention, interval time.Duration, stop <-chan struct{}, observe func(CompactionResult)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			result, err := c.Compact(retention)
+			if err != nil {
+				// Log error but don't crash; the next run retries
+				logging.Component("state").Error("State compaction failed", "error", err)
+				continue
+			}
+			if result.Removed > 0 {
+				logging.Component("state").Info("State compacted",
+					"removed", result.Removed,
+					"size", result.Size,
+					"duration", result.Duration)
+			}
+			if observe != nil {
+				observe(result)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// compactOffsets drops resume offsets not updated since cutoff. Offsets written before
+// updates were timestamped are stamped now, so they expire one retention period later.
+func (s *State) compactOffsets(cutoff, now int64) (removed []string) {
+	for key, offset := range s.Offsets {
+		switch {
+		case offset.UpdatedAt == 0:
+			offset.UpdatedAt = now
+			s.Offsets[key] = offset
+		case offset.UpdatedAt < cutoff:
+			delete(s.Offsets, key)
+			removed = append(removed, key)
+		}
+	}
+	return removed
+}
+
+// Compact drops expired resume offsets; the state file is written on the next save
+func (m *Manager) Compact(retention time.Duration) (CompactionResult, error) {
+	start := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := m.state.compactOffsets(start.Add(-retention).Unix(), start.Unix())
+	if len(removed) > 0 {
+		m.markDirty()
+	}
+	return CompactionResult{Removed: int64(len(removed)), Size: int64(len(m.state.Offsets)), Duration: time.Since(start)}, nil
+}
+
+// Compact drops expired resume offsets from the state. Processed-key markers expire through their Redis TTL.
+func (m *RedisStateManager) Compact(retention time.Duration) (CompactionResult, error) {
+	start := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := m.state.compactOffsets(start.Add(-retention).Unix(), start.Unix())
+	for _, key := range removed {
+		m.editOffset(key, nil)
+	}
+	if len(removed) > 0 {
+		m.markDirty()
+	}
+	return CompactionResult{Removed: int64(len(removed)), Size: int64(len(m.state.Offsets)), Duration: time.Since(start)}, nil
+}
+
+// Compact drops expired resume offsets. Removals are replayed onto the stored state like
+// other offset edits, so they survive a CAS merge with another replica's save.
+func (m *KVStateManager) Compact(retention time.Duration) (CompactionResult, error) {
+	start := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := m.state.compactOffsets(start.Add(-retention).Unix(), start.Unix())
+	for _, key := range removed {
+		m.editOffset(key, nil)
+	}
+	if len(removed) > 0 {
+		m.markDirty()
+	}
+	return CompactionResult{Removed: int64(len(removed)), Size: int64(len(m.state.Offsets)), Duration: time.Since(start)}, nil
+}
+
+// Compact deletes file records not updated within retention, except the latest processed file
+// of each checkpoint. The totals of deleted processed records are added to a summary record,
+// so totals loaded after a restart still count them.
+func (m *SQLStateManager) Compact(retention time.Duration) (CompactionResult, error) {
+	start := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.standby {
+		return CompactionResult{}, nil // The leader compacts the shared table
+	}
+
+	// Pending records must reach the table before old ones are deleted
+	if err := m.saveLocked(); err != nil {
+		return CompactionResult{}, err
+	}
+
+	// Records backing a checkpoint are kept, otherwise load would move the checkpoint back
+	keep := []any{compactedKey}
+	if m.state.LastProcessedFile != "" {
+		keep = append(keep, m.state.LastProcessedFile)
+	}
+	for _, cp := range m.state.Streams {
+		if cp.LastFile != "" {
+			keep = append(keep, cp.LastFile)
+		}
+	}
+	notIn := "s3_key NOT IN (?" + strings.Repeat(", ?", len(keep)-1) + ")"
+	cutoff := start.Add(-retention).Unix()
+
+	tx, err := m.db.BeginTx(m.ctx, nil)
+	if err != nil {
+		return CompactionResult{}, fmt.Errorf("failed to begin compaction transaction: %w", err)
+	}
+
+	var files, bytes, size int64
+	query := m.rebind(fmt.Sprintf("SELECT COUNT(*), COALESCE(SUM(bytes), 0) FROM %s WHERE updated_at < ? AND status = ? AND %s", m.table, notIn))
+	if err := tx.QueryRowContext(m.ctx, query, append([]any{cutoff, FileStatusProcessed}, keep...)...).Scan(&files, &bytes); err != nil {
+		_ = tx.Rollback()
+		return CompactionResult{}, fmt.Errorf("failed to count expired file records: %w", err)
+	}
+
+	query = m.rebind(fmt.Sprintf("DELETE FROM %s WHERE updated_at < ? AND %s", m.table, notIn))
+	res, err := tx.ExecContext(m.ctx, query, append([]any{cutoff}, keep...)...)
+	if err != nil {
+		_ = tx.Rollback()
+		return CompactionResult{}, fmt.Errorf("failed to delete expired file records: %w", err)
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return CompactionResult{}, fmt.Errorf("failed to delete expired file records: %w", err)
+	}
+
+	if files > 0 {
+		// The summary record keeps the file count in attempts
+		query = m.rebind(fmt.Sprintf(`INSERT INTO %[1]s (s3_key, stream_id, timestamp, bytes, status, attempts, updated_at)
+VALUES (?, '', 0, ?, ?, ?, ?)
+ON CONFLICT (s3_key) DO UPDATE SET
+	bytes = %[1]s.bytes + excluded.bytes,
+	attempts = %[1]s.attempts + excluded.attempts,
+	updated_at = excluded.updated_at`, m.table))
+		if _, err := tx.ExecContext(m.ctx, query, compactedKey, bytes, FileStatusCompacted, files, start.Unix()); err != nil {
+			_ = tx.Rollback()
+			return CompactionResult{}, fmt.Errorf("failed to update compacted totals: %w", err)
+		}
+	}
+
+	query = m.rebind(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE status <> ?", m.table))
+	if err := tx.QueryRowContext(m.ctx, query, FileStatusCompacted).Scan(&size); err != nil {
+		_ = tx.Rollback()
+		return CompactionResult{}, fmt.Errorf("failed to count file records: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CompactionResult{}, fmt.Errorf("failed to commit compaction transaction: %w", err)
+	}
+	return CompactionResult{Removed: removed, Size: size, Duration: time.Since(start)}, nil
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestManager_Compact(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	manager, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	now := time.Now().Unix()
+	manager.UpdateOffset("stale.gz", FileOffset{Sent: 1000, UpdatedAt: now - 3*3600})
+	manager.UpdateOffset("fresh.gz", FileOffset{Sent: 1000, UpdatedAt: now})
+	manager.UpdateOffset("legacy.gz", FileOffset{Sent: 1000}) // Written before offsets were timestamped
+
+	result, err := manager.Compact(time.Hour)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if result.Removed != 1 || result.Size != 2 {
+		t.Errorf("Expected 1 removed and 2 kept, got %+v", result)
+	}
+	if _, ok := manager.GetOffset("stale.gz"); ok {
+		t.Error("Expected stale offset to be removed")
+	}
+	if offset, ok := manager.GetOffset("legacy.gz"); !ok || offset.UpdatedAt == 0 {
+		t.Errorf("Expected legacy offset to be kept and stamped, got %+v", offset)
+	}
+
+	// The removal is persisted
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	reloaded, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if _, ok := reloaded.GetOffset("stale.gz"); ok {
+		t.Error("Expected stale offset to stay removed after reload")
+	}
+}
+
+func TestSQLStateManager_Compact(t *testing.T) {
+	db := newFakeDB("compact")
+	cfg := config.SQLConfig{Driver: "statetest", DSN: "compact", Table: "s3_streamer_files"}
+
+	manager, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	manager.UpdateStreamProgress("bucket/a/", 100, "a/100.gz", 10)
+	manager.UpdateStreamProgress("bucket/a/", 200, "a/200.gz", 20)
+	manager.UpdateStreamProgress("bucket/b/", 150, "b/150.gz", 40)
+	manager.UpdateStreamProgress("bucket/a/", 300, "a/300.gz", 30)
+	manager.RecordFailure(250, "a/250.gz")
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Everything but a/300.gz was last updated long ago
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	for key, rec := range db.records {
+		if key != "a/300.gz" {
+			rec.updated = old
+			db.records[key] = rec
+		}
+	}
+
+	result, err := manager.Compact(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	// a/100.gz, a/200.gz and the failed a/250.gz are removed; b/150.gz backs the b checkpoint
+	if result.Removed != 3 || result.Size != 2 {
+		t.Errorf("Expected 3 removed and 2 kept, got %+v", result)
+	}
+	if _, ok := db.records["b/150.gz"]; !ok {
+		t.Error("Expected the record backing a checkpoint to be kept")
+	}
+
+	// Totals and checkpoints survive a restart
+	restarted, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	files, bytes, ts := restarted.GetStats()
+	if files != 4 || bytes != 100 || ts != 300 {
+		t.Errorf("Expected 4 files, 100 bytes, timestamp 300, got %d, %d, %d", files, bytes, ts)
+	}
+	if cp := restarted.GetCheckpoint("bucket/b/"); cp.Timestamp != 150 || cp.LastFile != "b/150.gz" {
+		t.Errorf("Expected b checkpoint 150/b/150.gz, got %+v", cp)
+	}
+
+	// A second run adds to the summary
+	restarted.UpdateStreamProgress("bucket/a/", 400, "a/400.gz", 5)
+	if err := restarted.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	rec := db.records["a/300.gz"]
+	rec.updated = old
+	db.records["a/300.gz"] = rec
+	if _, err := restarted.Compact(24 * time.Hour); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if summary := db.records[compactedKey]; summary.attempts != 3 || summary.bytes != 60 {
+		t.Errorf("Expected summary of 3 files and 60 bytes, got %+v", summary)
+	}
+	records, err := restarted.RecentFiles(10)
+	if err != nil {
+		t.Fatalf("RecentFiles failed: %v", err)
+	}
+	for _, r := range records {
+		if r.Status == FileStatusCompacted {
+			t.Error("Expected the summary record not to be listed")
+		}
+	}
+}
+
+type fixedCompactor struct{}
+
+func (c *fixedCompactor) Compact(retention time.Duration) (CompactionResult, error) {
+	return CompactionResult{Removed: 1}, nil
+}
+
+func TestRunCompaction(t *testing.T) {
+	stop := make(chan struct{})
+	results := make(chan CompactionResult, 10)
+	done := make(chan struct{})
+	go func() {
+		RunCompaction(&fixedCompactor{}, time.Hour, 10*time.Millisecond, stop, func(r CompactionResult) {
+			select {
+			case results <- r:
+			default:
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case r := <-results:
+		if r.Removed != 1 {
+			t.Errorf("Expected observed result, got %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a compaction run")
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected RunCompaction to return once stopped")
+	}
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// consulStore implements kvStore with the Consul KV HTTP API
+type consulStore struct {
+	client  *http.Client
+	address string // e.g. http://localhost:8500
+	key     string
+	token   string
+}
+
+// consulKVPair is the subset of a Consul KV entry used for state
+type consulKVPair struct {
+	ModifyIndex int64
+	Value       []byte // Base64 in JSON, decoded by encoding/json
+}
+
+// get reads the key and its ModifyIndex
+func (s *consulStore) get(ctx context.Context) ([]byte, int64, error) {
+	resp, err := s.do(ctx, http.MethodGet, "/v1/kv/"+s.key, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, consulError(resp)
+	}
+
+	var pairs []consulKVPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode Consul response: %w", err)
+	}
+	if len(pairs) == 0 {
+		return nil, 0, nil
+	}
+	return pairs[0].Value, pairs[0].ModifyIndex, nil
+}
+
+// put performs a CAS write through a transaction, which reports the new ModifyIndex
+func (s *consulStore) put(ctx context.Context, data []byte, version int64) (int64, bool, error) {
+	ops := []map[string]any{{
+		"KV": map[string]any{
+			"Verb":  "cas",
+			"Key":   s.key,
+			"Value": data, // Marshalled as base64
+			"Index": version,
+		},
+	}}
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to encode Consul transaction: %w", err)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, "/v1/txn", body)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return 0, false, nil // Index check failed
+	default:
+		return 0, false, consulError(resp)
+	}
+
+	var result struct {
+		Results []struct {
+			KV consulKVPair
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, false, fmt.Errorf("failed to decode Consul response: %w", err)
+	}
+	if len(result.Results) == 0 {
+		return 0, false, fmt.Errorf("Consul transaction returned no results")
+	}
+	return result.Results[0].KV.ModifyIndex, true, nil
+}
+
+// do sends a request to the Consul agent
+func (s *consulStore) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(s.address, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Consul request: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Consul: %w", err)
+	}
+	return resp, nil
+}
+
+// consulError describes an unexpected Consul response
+func consulError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("Consul returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,170 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errEtcdUnauthenticated is returned by post when etcd rejects the auth token
+var errEtcdUnauthenticated = errors.New("etcd rejected the auth token")
+
+// etcdStore implements kvStore with the etcd v3 JSON gateway
+type etcdStore struct {
+	client   *http.Client
+	address  string // e.g. http://localhost:2379
+	key      string
+	username string // User for /v3/auth/authenticate (optional)
+	password string
+	mu       sync.Mutex
+	token    string // Auth token from the last authentication, guarded by mu
+}
+
+// etcdKeyValue is the subset of an etcd key/value used for state.
+// The gateway encodes int64 fields as strings and bytes as base64.
+type etcdKeyValue struct {
+	Value       []byte `json:"value"`
+	ModRevision string `json:"mod_revision"`
+}
+
+// get reads the key and its mod revision
+func (s *etcdStore) get(ctx context.Context) ([]byte, int64, error) {
+	var result struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	if err := s.call(ctx, "/v3/kv/range", map[string]any{"key": []byte(s.key)}, &result); err != nil {
+		return nil, 0, err
+	}
+	if len(result.Kvs) == 0 {
+		return nil, 0, nil
+	}
+
+	revision, err := strconv.ParseInt(result.Kvs[0].ModRevision, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid etcd mod_revision %q: %w", result.Kvs[0].ModRevision, err)
+	}
+	return result.Kvs[0].Value, revision, nil
+}
+
+// put writes the key in a transaction guarded by its mod revision (0 for a new key)
+func (s *etcdStore) put(ctx context.Context, data []byte, version int64) (int64, bool, error) {
+	txn := map[string]any{
+		"compare": []map[string]any{{
+			"key":          []byte(s.key),
+			"target":       "MOD",
+			"result":       "EQUAL",
+			"mod_revision": strconv.FormatInt(version, 10),
+		}},
+		"success": []map[string]any{{
+			"request_put": map[string]any{"key": []byte(s.key), "value": data},
+		}},
+	}
+
+	var result struct {
+		Header struct {
+			Revision string `json:"revision"`
+		} `json:"header"`
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := s.call(ctx, "/v3/kv/txn", txn, &result); err != nil {
+		return 0, false, err
+	}
+	if !result.Succeeded {
+		return 0, false, nil
+	}
+
+	revision, err := strconv.ParseInt(result.Header.Revision, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid etcd revision %q: %w", result.Header.Revision, err)
+	}
+	return revision, true, nil
+}
+
+// call posts a JSON request to the gateway and decodes the response into out. With
+// credentials, the request carries the cached auth token; when etcd rejects it (simple
+// tokens expire after --auth-token-ttl and do not survive an etcd restart), the store
+// authenticates again and retries once.
+func (s *etcdStore) call(ctx context.Context, path string, in, out any) error {
+	if s.username == "" {
+		return s.post(ctx, path, "", in, out)
+	}
+
+	token, err := s.authToken(ctx, "")
+	if err != nil {
+		return err
+	}
+	err = s.post(ctx, path, token, in, out)
+	if !errors.Is(err, errEtcdUnauthenticated) {
+		return err
+	}
+	if token, err = s.authToken(ctx, token); err != nil {
+		return err
+	}
+	return s.post(ctx, path, token, in, out)
+}
+
+// authToken returns the cached auth token, authenticating if there is none or it is
+// still the rejected one (another request may have replaced it already)
+func (s *etcdStore) authToken(ctx context.Context, rejected string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.token != rejected {
+		return s.token, nil
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	credentials := map[string]string{"name": s.username, "password": s.password}
+	if err := s.post(ctx, "/v3/auth/authenticate", "", credentials, &result); err != nil {
+		return "", fmt.Errorf("failed to authenticate to etcd as %q: %w", s.username, err)
+	}
+	if result.Token == "" {
+		return "", fmt.Errorf("failed to authenticate to etcd as %q: no token returned (is auth enabled?)", s.username)
+	}
+	s.token = result.Token
+	return s.token, nil
+}
+
+// post sends one JSON request to the gateway and decodes the response into out
+func (s *etcdStore) post(ctx context.Context, path, token string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode etcd request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.address, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create etcd request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach etcd: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		text := strings.TrimSpace(string(msg))
+		if token != "" && (resp.StatusCode == http.StatusUnauthorized || strings.Contains(text, "invalid auth token")) {
+			return fmt.Errorf("%w: HTTP %d: %s", errEtcdUnauthenticated, resp.StatusCode, text)
+		}
+		return fmt.Errorf("etcd returned HTTP %d: %s", resp.StatusCode, text)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode etcd response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package state
+
+import (
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// NewFromConfig creates the state manager selected by the configuration.
+// If Redis is enabled but unreachable, it falls back to the local state file.
+func NewFromConfig(cfg config.StateConfig) (StateManager, error) {
+	switch {
+	case cfg.SQL.Enabled:
+		return NewSQLStateManager(cfg.SQL, cfg.SaveInterval)
+	case cfg.KV.Enabled:
+		return NewKVStateManager(cfg.KV, cfg.SaveInterval)
+	case cfg.Redis.Enabled:
+		manager, err := NewRedisStateManager(cfg.Redis, cfg.SaveInterval)
+		if err == nil {
+			return manager, nil
+		}
+		logging.Component("state").Warn("Redis state storage unavailable, falling back to state file",
+			"error", err,
+			"file_path", cfg.FilePath)
+	}
+	return NewManager(cfg.FilePath, cfg.SaveInterval)
+}
@@ -0,0 +1,37 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestNewFromConfig_FileDefault(t *testing.T) {
+	cfg := config.StateConfig{FilePath: filepath.Join(t.TempDir(), "state.json"), SaveInterval: time.Minute}
+
+	manager, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig failed: %v", err)
+	}
+	if _, ok := manager.(*Manager); !ok {
+		t.Errorf("Expected file state manager, got %T", manager)
+	}
+}
+
+func TestNewFromConfig_RedisFallback(t *testing.T) {
+	cfg := config.StateConfig{
+		FilePath:     filepath.Join(t.TempDir(), "state.json"),
+		SaveInterval: time.Minute,
+		Redis:        config.RedisConfig{Enabled: true, Host: "127.0.0.1", Port: 1, KeyPrefix: "s3-streamer"},
+	}
+
+	manager, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig failed: %v", err)
+	}
+	if _, ok := manager.(*Manager); !ok {
+		t.Errorf("Expected fallback to file state manager, got %T", manager)
+	}
+}
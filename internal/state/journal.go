@@ -0,0 +1,241 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// InFlightJob is a file a worker started processing but has not finished
+type InFlightJob struct {
+	Key       string
+	StreamID  string
+	Timestamp int64
+	Size      int64
+	StartedAt int64 // Unix time processing started, or the file was saved as pending
+	Pending   bool  // Queued but not started when the previous run stopped (see InFlight)
+}
+
+// Journal is implemented by state managers that record in-flight files. A file that was
+// started but never finished (e.g. the process crashed) is listed by InFlight, so it can be
+// processed again even though the checkpoint may have moved past its timestamp.
+type Journal interface {
+	// BeginFile records that processing of a file started, or with job.Pending that the file
+	// is queued for the next start. UpdateStreamProgress removes the entry.
+	BeginFile(job InFlightJob)
+	// EndFile removes the entry of a file whose processing failed
+	EndFile(key string)
+	// InFlight lists the files started but not finished, oldest first
+	InFlight() ([]InFlightJob, error)
+}
+
+// beginFile records a file as in flight, keeping any resume point it already has
+func (s *State) beginFile(job InFlightJob) FileOffset {
+	if s.Offsets == nil {
+		s.Offsets = make(map[string]FileOffset)
+	}
+	offset := s.Offsets[job.Key]
+	offset.StreamID = job.StreamID
+	offset.Timestamp = job.Timestamp
+	offset.Size = job.Size
+	offset.StartedAt = job.StartedAt
+	offset.Pending = job.Pending
+	offset.UpdatedAt = job.StartedAt
+	s.Offsets[job.Key] = offset
+	return offset
+}
+
+// endFile clears the in-flight mark of a file. Its resume point is kept if any lines were
+// delivered; otherwise the entry is removed. It returns the kept offset (nil if removed).
+func (s *State) endFile(key string) (*FileOffset, bool) {
+	offset, ok := s.Offsets[key]
+	if !ok || offset.StartedAt == 0 {
+		return nil, false
+	}
+	if offset.Sent == 0 {
+		delete(s.Offsets, key)
+		return nil, true
+	}
+	offset.StartedAt = 0
+	offset.Pending = false
+	s.Offsets[key] = offset
+	return &offset, true
+}
+
+// setOffset stores a resume point, carrying over the in-flight fields of the existing entry
+func (s *State) setOffset(key string, offset FileOffset) FileOffset {
+	if s.Offsets == nil {
+		s.Offsets = make(map[string]FileOffset)
+	}
+	if existing, ok := s.Offsets[key]; ok && offset.StartedAt == 0 {
+		offset.StreamID = existing.StreamID
+		offset.Timestamp = existing.Timestamp
+		offset.Size = existing.Size
+		offset.StartedAt = existing.StartedAt
+		offset.Pending = existing.Pending
+	}
+	s.Offsets[key] = offset
+	return offset
+}
+
+// inFlight lists the offsets marked in flight, oldest file first
+func (s *State) inFlight() []InFlightJob {
+	var jobs []InFlightJob
+	for key, offset := range s.Offsets {
+		if offset.StartedAt == 0 {
+			continue
+		}
+		jobs = append(jobs, InFlightJob{
+			Key:       key,
+			StreamID:  offset.StreamID,
+			Timestamp: offset.Timestamp,
+			Size:      offset.Size,
+			StartedAt: offset.StartedAt,
+			Pending:   offset.Pending,
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Timestamp != jobs[j].Timestamp {
+			return jobs[i].Timestamp < jobs[j].Timestamp
+		}
+		return jobs[i].Key < jobs[j].Key
+	})
+	return jobs
+}
+
+// BeginFile records a file as in flight
+func (m *Manager) BeginFile(job InFlightJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.beginFile(job)
+	m.markDirty()
+}
+
+// EndFile clears the in-flight mark of a failed file
+func (m *Manager) EndFile(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, changed := m.state.endFile(key); changed {
+		m.markDirty()
+	}
+}
+
+// InFlight lists the files started but not finished
+func (m *Manager) InFlight() ([]InFlightJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.inFlight(), nil
+}
+
+// BeginFile records a file as in flight
+func (m *RedisStateManager) BeginFile(job InFlightJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	offset := m.state.beginFile(job)
+	m.editOffset(job.Key, &offset)
+	m.markDirty()
+}
+
+// EndFile clears the in-flight mark of a failed file
+func (m *RedisStateManager) EndFile(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if offset, changed := m.state.endFile(key); changed {
+		m.editOffset(key, offset)
+		m.markDirty()
+	}
+}
+
+// InFlight lists the files started but not finished
+func (m *RedisStateManager) InFlight() ([]InFlightJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.inFlight(), nil
+}
+
+// BeginFile records a file as in flight
+func (m *KVStateManager) BeginFile(job InFlightJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	offset := m.state.beginFile(job)
+	m.editOffset(job.Key, &offset)
+	m.markDirty()
+}
+
+// EndFile clears the in-flight mark of a failed file
+func (m *KVStateManager) EndFile(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if offset, changed := m.state.endFile(key); changed {
+		m.editOffset(key, offset)
+		m.markDirty()
+	}
+}
+
+// InFlight lists the files started but not finished
+func (m *KVStateManager) InFlight() ([]InFlightJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.inFlight(), nil
+}
+
+// BeginFile records the file with status in_flight, or pending (a processed record keeps
+// its status)
+func (m *SQLStateManager) BeginFile(job InFlightJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.record(job.Key)
+	rec.streamID = job.StreamID
+	rec.timestamp = job.Timestamp
+	switch {
+	case rec.status == FileStatusProcessed:
+	case job.Pending:
+		rec.status = FileStatusPending
+	default:
+		rec.status = FileStatusInFlight
+	}
+	rec.updated = job.StartedAt
+}
+
+// EndFile records the file as failed (a processed record keeps its status)
+func (m *SQLStateManager) EndFile(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.record(key)
+	if rec.status == FileStatusProcessed {
+		return
+	}
+	rec.status = FileStatusFailed
+	rec.updated = time.Now().Unix()
+}
+
+// InFlight lists the records with status in_flight or pending, including unsaved ones
+func (m *SQLStateManager) InFlight() ([]InFlightJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.saveLocked(); err != nil {
+		return nil, err
+	}
+
+	query := m.rebind(fmt.Sprintf("SELECT s3_key, stream_id, timestamp, updated_at, status FROM %s WHERE status IN (?, ?) ORDER BY timestamp, s3_key", m.table))
+	rows, err := m.db.QueryContext(m.ctx, query, FileStatusInFlight, FileStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query in-flight file records: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []InFlightJob
+	for rows.Next() {
+		var job InFlightJob
+		var status string
+		if err := rows.Scan(&job.Key, &job.StreamID, &job.Timestamp, &job.StartedAt, &status); err != nil {
+			return nil, fmt.Errorf("failed to read file record: %w", err)
+		}
+		job.Pending = status == FileStatusPending
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
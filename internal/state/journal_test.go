@@ -0,0 +1,105 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestManager_Journal(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	manager, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	manager.BeginFile(InFlightJob{Key: "logs/300.gz", StreamID: "bucket/logs/", Timestamp: 300, Size: 10, StartedAt: 1000})
+	manager.BeginFile(InFlightJob{Key: "logs/200.gz", StreamID: "bucket/logs/", Timestamp: 200, StartedAt: 1000})
+	manager.BeginFile(InFlightJob{Key: "logs/100.gz", StreamID: "bucket/logs/", Timestamp: 100, StartedAt: 1000})
+	manager.BeginFile(InFlightJob{Key: "logs/400.gz", StreamID: "bucket/logs/", Timestamp: 400, StartedAt: 1000, Pending: true})
+	manager.UpdateOffset("logs/200.gz", FileOffset{Lines: 1000, Sent: 1000})
+	manager.UpdateStreamProgress("bucket/logs/", 300, "logs/300.gz", 10)
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A restart sees the unfinished files, oldest first; resume points keep the journal fields
+	restarted, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	jobs, err := restarted.InFlight()
+	if err != nil {
+		t.Fatalf("InFlight failed: %v", err)
+	}
+	if len(jobs) != 3 || jobs[0].Key != "logs/100.gz" || jobs[1].Key != "logs/200.gz" || jobs[2].Key != "logs/400.gz" {
+		t.Fatalf("Expected logs/100.gz, logs/200.gz and logs/400.gz in flight, got %+v", jobs)
+	}
+	if jobs[1].StreamID != "bucket/logs/" || jobs[1].Timestamp != 200 {
+		t.Errorf("Expected journal fields to survive an offset update, got %+v", jobs[1])
+	}
+	if jobs[1].Pending || !jobs[2].Pending {
+		t.Errorf("Expected only logs/400.gz pending, got %+v", jobs)
+	}
+
+	// Starting a pending file makes it in flight
+	restarted.BeginFile(InFlightJob{Key: "logs/400.gz", StreamID: "bucket/logs/", Timestamp: 400, StartedAt: 2000})
+	if jobs, _ := restarted.InFlight(); len(jobs) != 3 || jobs[2].Pending {
+		t.Errorf("Expected logs/400.gz in flight, got %+v", jobs)
+	}
+	restarted.EndFile("logs/400.gz")
+
+	// A failed file leaves the journal; its resume point is kept if lines were delivered
+	restarted.EndFile("logs/100.gz")
+	restarted.EndFile("logs/200.gz")
+	if jobs, _ := restarted.InFlight(); len(jobs) != 0 {
+		t.Errorf("Expected no files in flight, got %+v", jobs)
+	}
+	if _, ok := restarted.GetOffset("logs/100.gz"); ok {
+		t.Error("Expected the entry of a file without progress to be removed")
+	}
+	if offset, ok := restarted.GetOffset("logs/200.gz"); !ok || offset.Sent != 1000 {
+		t.Errorf("Expected the resume point of logs/200.gz to be kept, got %+v", offset)
+	}
+}
+
+func TestSQLStateManager_Journal(t *testing.T) {
+	db := newFakeDB("journal")
+	cfg := config.SQLConfig{Driver: "statetest", DSN: "journal", Table: "s3_streamer_files"}
+
+	manager, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	manager.BeginFile(InFlightJob{Key: "logs/100.gz", StreamID: "bucket/logs/", Timestamp: 100, StartedAt: 1000})
+	manager.BeginFile(InFlightJob{Key: "logs/200.gz", StreamID: "bucket/logs/", Timestamp: 200, StartedAt: 1000})
+	manager.BeginFile(InFlightJob{Key: "logs/300.gz", StreamID: "bucket/logs/", Timestamp: 300, StartedAt: 1000})
+	manager.BeginFile(InFlightJob{Key: "logs/400.gz", StreamID: "bucket/logs/", Timestamp: 400, StartedAt: 1000, Pending: true})
+	manager.UpdateStreamProgress("bucket/logs/", 300, "logs/300.gz", 10)
+
+	jobs, err := manager.InFlight()
+	if err != nil {
+		t.Fatalf("InFlight failed: %v", err)
+	}
+	if len(jobs) != 3 || jobs[0].Key != "logs/100.gz" || jobs[0].StartedAt != 1000 {
+		t.Fatalf("Expected logs/100.gz, logs/200.gz and logs/400.gz in flight, got %+v", jobs)
+	}
+	if jobs[0].Pending || !jobs[2].Pending {
+		t.Errorf("Expected only logs/400.gz pending, got %+v", jobs)
+	}
+	manager.EndFile("logs/400.gz")
+
+	// A saved in-flight record becomes failed, keeping its timestamp
+	manager.EndFile("logs/200.gz")
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if rec := db.records["logs/200.gz"]; rec.status != FileStatusFailed || rec.timestamp != 200 {
+		t.Errorf("Expected failed record at timestamp 200, got %+v", rec)
+	}
+	if files, _, _ := manager.GetStats(); files != 1 {
+		t.Errorf("Expected in-flight records not to count as processed, got %d", files)
+	}
+}
@@ -0,0 +1,311 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// maxCASAttempts bounds how often a save re-reads and merges after losing a CAS race
+const maxCASAttempts = 5
+
+// errCASConflict is returned when every CAS attempt of a merging write lost to another replica
+var errCASConflict = errors.New("state was modified concurrently by another replica")
+
+// kvStore is a versioned key/value store supporting compare-and-swap writes
+type kvStore interface {
+	// get returns the stored value and its version (nil and 0 if the key does not exist)
+	get(ctx context.Context) ([]byte, int64, error)
+	// put writes the value only if the stored version still equals version (0 = key must not exist).
+	// It returns the new version and false without error if the CAS check failed.
+	put(ctx context.Context, data []byte, version int64) (int64, bool, error)
+}
+
+// KVStateManager handles state persistence in Consul KV or etcd using CAS updates, so a
+// replica cannot overwrite state another replica saved since it last read it
+type KVStateManager struct {
+	store        kvStore
+	shared       bool // Merge with other instances' saves (see SetSharedWriters)
+	saveInterval time.Duration
+	timeout      time.Duration
+	state        State
+	version      int64 // Version of the stored state that state was last synced with
+	mu           sync.RWMutex
+	saveTracker  // Guarded by mu
+	stateEdits   // Guarded by mu
+	stopCh       chan struct{}
+	doneCh       chan struct{}
+}
+
+// NewKVStateManager creates a state manager backed by Consul KV or etcd
+func NewKVStateManager(kvConfig config.KVConfig, saveInterval time.Duration) (*KVStateManager, error) {
+	client := &http.Client{Timeout: kvConfig.Timeout}
+
+	var store kvStore
+	switch kvConfig.Backend {
+	case "consul":
+		store = &consulStore{client: client, address: kvConfig.Address, key: kvConfig.Key, token: kvConfig.Token}
+	case "etcd":
+		store = &etcdStore{client: client, address: kvConfig.Address, key: kvConfig.Key, username: kvConfig.Username, password: kvConfig.Password}
+	default:
+		return nil, fmt.Errorf("unsupported KV backend: %s", kvConfig.Backend)
+	}
+
+	m, err := newKVStateManager(store, saveInterval, kvConfig.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	m.backend = kvConfig.Backend
+	return m, nil
+}
+
+// newKVStateManager loads existing state from the store
+func newKVStateManager(store kvStore, saveInterval, timeout time.Duration) (*KVStateManager, error) {
+	m := &KVStateManager{
+		store:        store,
+		saveInterval: saveInterval,
+		timeout:      timeout,
+		saveTracker:  saveTracker{backend: "kv"},
+		stopCh:       make(chan struct{}),
+		doneCh:       make(chan struct{}),
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+	data, version, err := store.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state from KV store: %w", err)
+	}
+	if data == nil {
+		// Initialize with zero state
+		m.state = State{LastUpdated: time.Now().Unix()}
+		return m, nil
+	}
+	if err := json.Unmarshal(data, &m.state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state: %w", err)
+	}
+	m.version = version
+
+	return m, nil
+}
+
+// Start begins the periodic state persistence
+func (m *KVStateManager) Start() {
+	go m.periodicSave()
+}
+
+// Stop stops the periodic persistence and saves final state
+func (m *KVStateManager) Stop() {
+	close(m.stopCh)
+	<-m.doneCh
+	if err := m.Save(); err != nil {
+		logging.Component("state").Error("Failed to save state to KV store on shutdown", "error", err)
+	}
+}
+
+// GetLastTimestamp returns the last processed timestamp
+func (m *KVStateManager) GetLastTimestamp() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.LastProcessedTimestamp
+}
+
+// GetLastFile returns the last processed file path
+func (m *KVStateManager) GetLastFile() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.LastProcessedFile
+}
+
+// UpdateProgress updates the global processing progress
+func (m *KVStateManager) UpdateProgress(timestamp int64, filePath string, bytesProcessed int64) {
+	m.UpdateStreamProgress("", timestamp, filePath, bytesProcessed)
+}
+
+// UpdateStreamProgress updates the processing progress of one stream
+func (m *KVStateManager) UpdateStreamProgress(streamID string, timestamp int64, filePath string, bytesProcessed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.state.Offsets[filePath]; ok {
+		m.editOffset(filePath, nil)
+	}
+	m.state.advance(streamID, timestamp, filePath, bytesProcessed)
+	m.editProgress(bytesProcessed)
+	m.markDirty()
+}
+
+// GetCheckpoint returns the scan position of one stream
+func (m *KVStateManager) GetCheckpoint(streamID string) Checkpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.checkpoint(streamID)
+}
+
+// GetOffset returns the resume point recorded for a partially delivered file
+func (m *KVStateManager) GetOffset(filePath string) (FileOffset, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	offset, ok := m.state.Offsets[filePath]
+	return offset, ok
+}
+
+// UpdateOffset records how far delivery of a file has progressed
+func (m *KVStateManager) UpdateOffset(filePath string, offset FileOffset) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	offset = m.state.setOffset(filePath, offset)
+	m.editOffset(filePath, &offset)
+	m.markDirty()
+}
+
+// GetStats returns current statistics
+func (m *KVStateManager) GetStats() (filesProcessed, bytesProcessed int64, lastTimestamp int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.TotalFilesProcessed, m.state.TotalBytesProcessed, m.state.LastProcessedTimestamp
+}
+
+// SetSharedWriters lets several instances save the state at once, as with sharding. A save
+// that loses the CAS race re-reads the stored state and merges this instance's changes into
+// it (checkpoints = later of the two per stream, totals summed) before retrying, instead of
+// failing with ErrConflictingWriter. Reload merges the same way. Call before Start.
+func (m *KVStateManager) SetSharedWriters() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shared = true
+}
+
+// Save writes the state with a CAS update. It fails with ErrConflictingWriter if another
+// replica wrote since the state was last read, unless writers are shared (see SetSharedWriters).
+func (m *KVStateManager) Save() (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dirty {
+		return nil // No changes to save, or on standby
+	}
+	start := time.Now()
+	defer func() { m.observeSave(start, err) }()
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	for attempt := 1; attempt <= maxCASAttempts; attempt++ {
+		data, err := json.Marshal(m.state)
+		if err != nil {
+			return fmt.Errorf("failed to marshal state: %w", err)
+		}
+
+		version, ok, err := m.store.put(ctx, data, m.version)
+		if err != nil {
+			return fmt.Errorf("failed to save state to KV store: %w", err)
+		}
+		if ok {
+			m.version = version
+			m.resetEdits()
+			m.markClean()
+			return nil
+		}
+		if !m.shared {
+			return fmt.Errorf("failed to save state to KV store: %w (key modified since it was last read)", ErrConflictingWriter)
+		}
+
+		logging.Component("state").Debug("State CAS conflict, merging with stored state", "attempt", attempt)
+		if err := m.merge(ctx); err != nil {
+			return err
+		}
+	}
+
+	return errCASConflict
+}
+
+// merge replaces the local state with the stored one plus progress not yet saved (caller holds mu)
+func (m *KVStateManager) merge(ctx context.Context) error {
+	stored, version, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.state = m.replay(m.state, stored)
+	m.version = version
+	return nil
+}
+
+// load reads the stored state and its version (zero state if the key does not exist)
+func (m *KVStateManager) load(ctx context.Context) (State, int64, error) {
+	data, version, err := m.store.get(ctx)
+	if err != nil {
+		return State{}, 0, fmt.Errorf("failed to reload state from KV store: %w", err)
+	}
+
+	var stored State
+	if data != nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return State{}, 0, fmt.Errorf("failed to unmarshal state: %w", err)
+		}
+	}
+	return stored, version, nil
+}
+
+// Reload replaces the in-memory state with the stored one, discarding unsaved changes.
+// With shared writers, the changes are kept and merged into the stored state instead.
+func (m *KVStateManager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := m.context()
+	defer cancel()
+	if m.shared {
+		return m.merge(ctx)
+	}
+
+	stored, version, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	if version != 0 {
+		m.state = stored
+		m.version = version
+	}
+	m.resetEdits()
+	m.markClean()
+	return nil
+}
+
+// context returns a context bounded by the configured request timeout
+func (m *KVStateManager) context() (context.Context, context.CancelFunc) {
+	if m.timeout > 0 {
+		return context.WithTimeout(context.Background(), m.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// periodicSave saves state at regular intervals
+func (m *KVStateManager) periodicSave() {
+	defer crash.Recover()
+	ticker := time.NewTicker(m.saveInterval)
+	defer ticker.Stop()
+	defer close(m.doneCh)
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Save(); err != nil {
+				// Log error but don't crash
+				logging.Component("state").Error("Failed to save state to KV store periodically", "error", err)
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// fakeKV is a single versioned value shared by the fake Consul and etcd servers
+type fakeKV struct {
+	mu      sync.Mutex
+	value   []byte
+	version int64
+	writes  int
+}
+
+// cas applies a write if version matches, returning the new version
+func (kv *fakeKV) cas(value []byte, version int64) (int64, bool) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if version != kv.version {
+		return 0, false
+	}
+	kv.version += 10
+	kv.value = value
+	kv.writes++
+	return kv.version, true
+}
+
+func (kv *fakeKV) read() ([]byte, int64) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.value, kv.version
+}
+
+// newFakeConsul serves the subset of the Consul HTTP API used by consulStore
+func newFakeConsul(t *testing.T, kv *fakeKV) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/kv/s3-streamer/state":
+			value, version := kv.read()
+			if value == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode([]consulKVPair{{ModifyIndex: version, Value: value}})
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/txn":
+			var ops []struct {
+				KV struct {
+					Verb  string
+					Value []byte
+					Index int64
+				}
+			}
+			if err := json.NewDecoder(r.Body).Decode(&ops); err != nil || ops[0].KV.Verb != "cas" {
+				t.Errorf("Unexpected transaction: %v", err)
+			}
+			version, ok := kv.cas(ops[0].KV.Value, ops[0].KV.Index)
+			if !ok {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"Results": []map[string]any{{"KV": consulKVPair{ModifyIndex: version}}},
+			})
+		default:
+			t.Errorf("Unexpected Consul request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+}
+
+// newFakeEtcd serves the subset of the etcd v3 JSON gateway used by etcdStore
+func newFakeEtcd(t *testing.T, kv *fakeKV) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			value, version := kv.read()
+			if value == nil {
+				json.NewEncoder(w).Encode(map[string]any{})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"kvs": []etcdKeyValue{{Value: value, ModRevision: strconv.FormatInt(version, 10)}},
+			})
+		case "/v3/kv/txn":
+			var txn struct {
+				Compare []struct {
+					ModRevision string `json:"mod_revision"`
+				} `json:"compare"`
+				Success []struct {
+					RequestPut struct {
+						Value []byte `json:"value"`
+					} `json:"request_put"`
+				} `json:"success"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&txn); err != nil {
+				t.Errorf("Unexpected transaction: %v", err)
+			}
+			expected, _ := strconv.ParseInt(txn.Compare[0].ModRevision, 10, 64)
+			version, ok := kv.cas(txn.Success[0].RequestPut.Value, expected)
+			json.NewEncoder(w).Encode(map[string]any{
+				"header":    map[string]string{"revision": strconv.FormatInt(version, 10)},
+				"succeeded": ok,
+			})
+		default:
+			t.Errorf("Unexpected etcd request %s", r.URL.Path)
+		}
+	}))
+}
+
+func TestKVStateManager_Backends(t *testing.T) {
+	backends := map[string]func(*testing.T, *fakeKV) *httptest.Server{
+		"consul": newFakeConsul,
+		"etcd":   newFakeEtcd,
+	}
+
+	for backend, newServer := range backends {
+		t.Run(backend, func(t *testing.T) {
+			kv := &fakeKV{}
+			server := newServer(t, kv)
+			defer server.Close()
+
+			cfg := config.KVConfig{Backend: backend, Address: server.URL, Key: "s3-streamer/state", Timeout: 5 * time.Second}
+			replicaA, err := NewKVStateManager(cfg, time.Hour)
+			if err != nil {
+				t.Fatalf("NewKVStateManager failed: %v", err)
+			}
+			replicaB, err := NewKVStateManager(cfg, time.Hour)
+			if err != nil {
+				t.Fatalf("NewKVStateManager failed: %v", err)
+			}
+
+			replicaA.SetSharedWriters()
+			replicaB.SetSharedWriters()
+
+			// Both replicas start from the empty key and advance concurrently
+			replicaA.UpdateStreamProgress("bucket/a/", 200, "logs/200.gz", 1000)
+			replicaB.UpdateStreamProgress("bucket/b/", 100, "logs/100.gz", 500)
+
+			if err := replicaA.Save(); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			if err := replicaB.Save(); err != nil {
+				t.Fatalf("Save after conflict failed: %v", err)
+			}
+
+			// B lost the CAS race, merged A's progress and must not move the checkpoint back
+			value, _ := kv.read()
+			var stored State
+			if err := json.Unmarshal(value, &stored); err != nil {
+				t.Fatalf("Stored state is not valid JSON: %v", err)
+			}
+			if stored.LastProcessedTimestamp != 200 || stored.LastProcessedFile != "logs/200.gz" {
+				t.Errorf("Expected checkpoint 200/logs/200.gz, got %d/%s", stored.LastProcessedTimestamp, stored.LastProcessedFile)
+			}
+			if stored.TotalFilesProcessed != 2 || stored.TotalBytesProcessed != 1500 {
+				t.Errorf("Expected 2 files and 1500 bytes, got %d and %d", stored.TotalFilesProcessed, stored.TotalBytesProcessed)
+			}
+			if len(stored.Streams) != 2 || stored.Streams["bucket/b/"].Timestamp != 100 {
+				t.Errorf("Expected both stream checkpoints to be kept, got %+v", stored.Streams)
+			}
+			if kv.writes != 2 {
+				t.Errorf("Expected 2 successful writes, got %d", kv.writes)
+			}
+
+			// A new replica resumes from the stored checkpoint
+			restarted, err := NewKVStateManager(cfg, time.Hour)
+			if err != nil {
+				t.Fatalf("NewKVStateManager failed: %v", err)
+			}
+			if ts := restarted.GetLastTimestamp(); ts != 200 {
+				t.Errorf("Expected timestamp 200 after restart, got %d", ts)
+			}
+		})
+	}
+}
+
+func TestEtcdStore_Reauthenticates(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		logins int
+		valid  string // Token etcd currently accepts
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			var credentials struct {
+				Name     string `json:"name"`
+				Password string `json:"password"`
+			}
+			json.NewDecoder(r.Body).Decode(&credentials)
+			if credentials.Name != "streamer" || credentials.Password != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			logins++
+			valid = "token-" + strconv.Itoa(logins)
+			json.NewEncoder(w).Encode(map[string]string{"token": valid})
+		case "/v3/kv/range":
+			if r.Header.Get("Authorization") != valid {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]any{"error": "etcdserver: invalid auth token", "code": 16})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{})
+		default:
+			t.Errorf("Unexpected etcd request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	store := &etcdStore{client: server.Client(), address: server.URL, key: "s3-streamer/state", username: "streamer", password: "secret"}
+	for i := 0; i < 2; i++ {
+		if _, _, err := store.get(context.Background()); err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+	}
+	if logins != 1 {
+		t.Errorf("Expected the token to be reused, got %d logins", logins)
+	}
+
+	// The token expires (or etcd restarts); the next request authenticates again
+	mu.Lock()
+	valid = ""
+	mu.Unlock()
+	if _, _, err := store.get(context.Background()); err != nil {
+		t.Fatalf("get after token expiry failed: %v", err)
+	}
+	if logins != 2 {
+		t.Errorf("Expected a second login after the token expired, got %d", logins)
+	}
+
+	store.password = "wrong"
+	store.token = ""
+	if _, _, err := store.get(context.Background()); err == nil {
+		t.Error("Expected an error with wrong credentials")
+	}
+}
+
+func TestKVStateManager_ConflictingWriters(t *testing.T) {
+	kv := &fakeKV{}
+	server := newFakeConsul(t, kv)
+	defer server.Close()
+	cfg := config.KVConfig{Backend: "consul", Address: server.URL, Key: "s3-streamer/state"}
+
+	first, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	second, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+
+	first.UpdateStreamProgress("logs/", 100, "logs/a.gz", 10)
+	if err := first.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	second.UpdateStreamProgress("logs/", 50, "logs/old.gz", 10)
+	if err := second.Save(); !errors.Is(err, ErrConflictingWriter) {
+		t.Fatalf("Expected ErrConflictingWriter, got %v", err)
+	}
+	if kv.writes != 1 {
+		t.Errorf("Expected only the first save to be written, got %d writes", kv.writes)
+	}
+
+	// A reload discards the refused changes and continues from the stored state
+	if err := second.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if cp := second.GetCheckpoint("logs/"); cp.Timestamp != 100 {
+		t.Errorf("Expected the first instance's checkpoint after reload, got %+v", cp)
+	}
+	if files, _, _ := second.GetStats(); files != 1 {
+		t.Errorf("Expected the refused progress to be discarded, got %d files", files)
+	}
+	second.UpdateStreamProgress("logs/", 200, "logs/b.gz", 10)
+	if err := second.Save(); err != nil {
+		t.Fatalf("Save after reload failed: %v", err)
+	}
+}
+
+func TestKVStateManager_SaveWithoutChanges(t *testing.T) {
+	kv := &fakeKV{}
+	server := newFakeConsul(t, kv)
+	defer server.Close()
+
+	manager, err := NewKVStateManager(config.KVConfig{Backend: "consul", Address: server.URL, Key: "s3-streamer/state"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if kv.writes != 0 {
+		t.Errorf("Expected no writes for clean state, got %d", kv.writes)
+	}
+}
+
+func TestNewKVStateManager_UnknownBackend(t *testing.T) {
+	if _, err := NewKVStateManager(config.KVConfig{Backend: "zookeeper"}, time.Hour); err == nil {
+		t.Error("Expected error for unsupported backend")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package state
+
+// lockFile is a no-op where flock is unavailable; Save still compares revisions
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
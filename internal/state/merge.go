@@ -0,0 +1,91 @@
+package state
+
+import (
+	"time"
+)
+
+// stateEdits records what a state manager changed since its last save, so the changes can
+// be replayed onto a state another instance saved in the meantime (see replay). It is
+// embedded in the managers that merge and guarded by their mutex.
+type stateEdits struct {
+	pendingFiles int64 // Progress recorded since the last successful save
+	pendingBytes int64
+	offsetEdits  map[string]*FileOffset // Offsets changed since the last save (nil = cleared)
+	failureEdits map[string]*FailedFile // Failure entries changed since the last save (nil = cleared)
+}
+
+// editProgress records a processed file
+func (e *stateEdits) editProgress(bytesProcessed int64) {
+	e.pendingFiles++
+	e.pendingBytes += bytesProcessed
+}
+
+// editOffset records an offset change (nil = cleared)
+func (e *stateEdits) editOffset(filePath string, offset *FileOffset) {
+	if e.offsetEdits == nil {
+		e.offsetEdits = make(map[string]*FileOffset)
+	}
+	e.offsetEdits[filePath] = offset
+}
+
+// editFailure records a failure entry change (nil = removed)
+func (e *stateEdits) editFailure(key string, f *FailedFile) {
+	if e.failureEdits == nil {
+		e.failureEdits = make(map[string]*FailedFile)
+	}
+	e.failureEdits[key] = f
+}
+
+// resetEdits forgets the edits once they are saved or discarded
+func (e *stateEdits) resetEdits() {
+	e.pendingFiles = 0
+	e.pendingBytes = 0
+	e.offsetEdits = nil
+	e.failureEdits = nil
+}
+
+// replay returns stored with the edits replayed onto it and the later of the two positions
+// of every stream taken from local. If stored was rewound after local, its checkpoints are
+// adopted instead of being moved forward again.
+func (e *stateEdits) replay(local, stored State) State {
+	merged := stored
+	if stored.lastRewind() > local.lastRewind() {
+		merged.TotalFilesProcessed += e.pendingFiles
+		merged.TotalBytesProcessed += e.pendingBytes
+		merged.LastUpdated = time.Now().Unix()
+		return merged
+	}
+	if local.LastProcessedTimestamp > stored.LastProcessedTimestamp {
+		merged.LastProcessedTimestamp = local.LastProcessedTimestamp
+		merged.LastProcessedFile = local.LastProcessedFile
+	}
+	for streamID, cp := range local.Streams {
+		if cp.Timestamp > merged.Streams[streamID].Timestamp {
+			if merged.Streams == nil {
+				merged.Streams = make(map[string]Checkpoint)
+			}
+			merged.Streams[streamID] = cp
+		}
+	}
+	merged.TotalFilesProcessed += e.pendingFiles
+	merged.TotalBytesProcessed += e.pendingBytes
+	for filePath, offset := range e.offsetEdits {
+		if offset == nil {
+			delete(merged.Offsets, filePath)
+			continue
+		}
+		if merged.Offsets == nil {
+			merged.Offsets = make(map[string]FileOffset)
+		}
+		merged.Offsets[filePath] = *offset
+	}
+	for key, f := range e.failureEdits {
+		if f == nil {
+			delete(merged.Failed, key)
+			continue
+		}
+		merged.putFailure(*f)
+	}
+	merged.LastUpdated = time.Now().Unix()
+	return merged
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
 	"github.com/redis/go-redis/v9"
 )
@@ -17,9 +18,14 @@ type RedisStateManager struct {
 	client       *redis.Client
 	keyPrefix    string
 	saveInterval time.Duration
+	processedTTL time.Duration // Expiry of processed-key markers (0 = no markers)
 	state        State
+	revision     int64            // Revision of the stored state last loaded or written
+	processed    map[string]int64 // Processed-key markers not yet written, by S3 key
+	shared       bool             // Merge with other instances' saves (see SetSharedWriters)
 	mu           sync.RWMutex
-	dirty        bool
+	saveTracker  // Guarded by mu
+	stateEdits   // Guarded by mu
 	stopCh       chan struct{}
 	doneCh       chan struct{}
 	ctx          context.Context
@@ -44,6 +50,8 @@ func NewRedisStateManager(redisConfig config.RedisConfig, saveInterval time.Dura
 		client:       client,
 		keyPrefix:    redisConfig.KeyPrefix,
 		saveInterval: saveInterval,
+		processedTTL: redisConfig.ProcessedTTL,
+		saveTracker:  saveTracker{backend: "redis"},
 		stopCh:       make(chan struct{}),
 		doneCh:       make(chan struct{}),
 		ctx:          ctx,
@@ -94,19 +102,74 @@ func (m *RedisStateManager) GetLastFile() string {
 	return m.state.LastProcessedFile
 }
 
-// UpdateProgress updates the processing progress
+// UpdateProgress updates the global processing progress
 func (m *RedisStateManager) UpdateProgress(timestamp int64, filePath string, bytesProcessed int64) {
+	m.UpdateStreamProgress("", timestamp, filePath, bytesProcessed)
+}
+
+// UpdateStreamProgress updates the processing progress of one stream
+func (m *RedisStateManager) UpdateStreamProgress(streamID string, timestamp int64, filePath string, bytesProcessed int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if timestamp > m.state.LastProcessedTimestamp {
-		m.state.LastProcessedTimestamp = timestamp
+	if _, ok := m.state.Offsets[filePath]; ok {
+		m.editOffset(filePath, nil)
+	}
+	m.state.advance(streamID, timestamp, filePath, bytesProcessed)
+	m.editProgress(bytesProcessed)
+	if m.processedTTL > 0 {
+		if m.processed == nil {
+			m.processed = make(map[string]int64)
+		}
+		m.processed[filePath] = timestamp
 	}
-	m.state.LastProcessedFile = filePath
-	m.state.TotalFilesProcessed++
-	m.state.TotalBytesProcessed += bytesProcessed
-	m.state.LastUpdated = time.Now().Unix()
-	m.dirty = true
+	m.markDirty()
+}
+
+// IsProcessed reports whether the file has an unexpired processed-key marker (including unsaved ones)
+func (m *RedisStateManager) IsProcessed(filePath string) (bool, error) {
+	m.mu.RLock()
+	_, ok := m.processed[filePath]
+	m.mu.RUnlock()
+	if ok {
+		return true, nil
+	}
+
+	n, err := m.client.Exists(m.ctx, m.processedKey(filePath)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to query processed-key marker: %w", err)
+	}
+	return n > 0, nil
+}
+
+// processedKey is the Redis key of a file's processed-key marker
+func (m *RedisStateManager) processedKey(filePath string) string {
+	return fmt.Sprintf("%s:processed:%s", m.keyPrefix, filePath)
+}
+
+// GetCheckpoint returns the scan position of one stream
+func (m *RedisStateManager) GetCheckpoint(streamID string) Checkpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.checkpoint(streamID)
+}
+
+// GetOffset returns the resume point recorded for a partially delivered file
+func (m *RedisStateManager) GetOffset(filePath string) (FileOffset, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	offset, ok := m.state.Offsets[filePath]
+	return offset, ok
+}
+
+// UpdateOffset records how far delivery of a file has progressed
+func (m *RedisStateManager) UpdateOffset(filePath string, offset FileOffset) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	offset = m.state.setOffset(filePath, offset)
+	m.editOffset(filePath, &offset)
+	m.markDirty()
 }
 
 // GetStats returns current statistics
@@ -116,27 +179,100 @@ func (m *RedisStateManager) GetStats() (filesProcessed, bytesProcessed int64, la
 	return m.state.TotalFilesProcessed, m.state.TotalBytesProcessed, m.state.LastProcessedTimestamp
 }
 
+// SetSharedWriters lets several instances save the state at once, as with sharding, where
+// each advances the checkpoints of the shards it owns. A save that finds another instance's
+// save in between re-reads the stored state and merges this instance's changes into it (the
+// later position of each stream, totals summed, offset and failure changes replayed)
+// instead of failing with ErrConflictingWriter. Reload merges the same way. Call before Start.
+func (m *RedisStateManager) SetSharedWriters() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shared = true
+}
+
 // Save persists the current state to Redis
-func (m *RedisStateManager) Save() error {
+func (m *RedisStateManager) Save() (err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if !m.dirty {
-		return nil // No changes to save
+		return nil // No changes to save, or on standby
 	}
+	start := time.Now()
+	defer func() { m.observeSave(start, err) }()
 
-	data, err := json.Marshal(m.state)
-	if err != nil {
-		return fmt.Errorf("failed to marshal state: %w", err)
+	// The state is only written if the stored revision is unchanged since it was last loaded
+	// or written, or with shared writers merged with the stored one (see toSave). WATCH
+	// aborts the transaction if another client writes in between. The processed-key markers
+	// (which expire on their own) are written in the same transaction.
+	key := fmt.Sprintf("%s:state", m.keyPrefix)
+	for attempt := 1; ; attempt++ {
+		var saved State
+		err = m.client.Watch(m.ctx, func(tx *redis.Tx) error {
+			stored, err := tx.Get(m.ctx, key).Bytes()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if saved, err = m.toSave(stored); err != nil {
+				return err
+			}
+			data, err := json.Marshal(saved)
+			if err != nil {
+				return fmt.Errorf("failed to marshal state: %w", err)
+			}
+			_, err = tx.TxPipelined(m.ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(m.ctx, key, data, 0)
+				for filePath, timestamp := range m.processed {
+					pipe.Set(m.ctx, m.processedKey(filePath), timestamp, m.processedTTL)
+				}
+				return nil
+			})
+			return err
+		}, key)
+		if err == redis.TxFailedErr && m.shared && attempt < maxCASAttempts {
+			continue // Another instance saved in between; merge with its state
+		}
+		if err == redis.TxFailedErr {
+			err = fmt.Errorf("%w (state key modified during save)", ErrConflictingWriter)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save state to Redis: %w", err)
+		}
+
+		m.state = saved
+		m.revision = saved.Revision
+		m.processed = nil
+		m.resetEdits()
+		m.markClean()
+		return nil
 	}
+}
 
-	key := fmt.Sprintf("%s:state", m.keyPrefix)
-	if err := m.client.Set(m.ctx, key, data, 0).Err(); err != nil {
-		return fmt.Errorf("failed to save state to Redis: %w", err)
+// toSave returns the state to write over the stored one (caller holds mu). It fails with
+// ErrConflictingWriter if another instance saved since the state was last loaded or
+// written, unless writers are shared: then the stored state is merged with this
+// instance's changes.
+func (m *RedisStateManager) toSave(data []byte) (State, error) {
+	saved := m.state
+	if !m.shared {
+		if err := checkRevision(data, m.revision); err != nil {
+			return State{}, err
+		}
+		saved.Revision = m.revision + 1
+		return saved, nil
 	}
 
-	m.dirty = false
-	return nil
+	var stored State
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return State{}, fmt.Errorf("failed to unmarshal stored state: %w", err)
+		}
+	}
+	if stored.Revision != m.revision {
+		saved = m.replay(m.state, stored)
+	}
+	saved.Revision = stored.Revision + 1
+	return saved, nil
 }
 
 // load reads state from Redis
@@ -147,15 +283,43 @@ func (m *RedisStateManager) load() error {
 		return err
 	}
 
-	if err := json.Unmarshal([]byte(data), &m.state); err != nil {
+	var loaded State
+	if err := json.Unmarshal([]byte(data), &loaded); err != nil {
 		return fmt.Errorf("failed to unmarshal state: %w", err)
 	}
+	m.state = loaded
+	m.revision = loaded.Revision
+
+	return nil
+}
+
+// Reload replaces the in-memory state with the one stored in Redis, discarding unsaved
+// changes. With shared writers, the changes are kept and merged into the stored state instead.
+func (m *RedisStateManager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	local := m.state
+	if err := m.load(); err != nil {
+		if err != redis.Nil {
+			return fmt.Errorf("failed to reload state from Redis: %w", err)
+		}
+		if m.shared {
+			return nil // Nothing stored yet; the changes are saved as they are
+		}
+	}
+	if m.shared && m.dirty {
+		m.state = m.replay(local, m.state)
+		return nil
+	}
+	m.resetEdits()
+	m.markClean()
 	return nil
 }
 
 // periodicSave saves state at regular intervals
 func (m *RedisStateManager) periodicSave() {
+	defer crash.Recover()
 	ticker := time.NewTicker(m.saveInterval)
 	defer ticker.Stop()
 	defer close(m.doneCh)
@@ -165,7 +329,7 @@ func (m *RedisStateManager) periodicSave() {
 		case <-ticker.C:
 			if err := m.Save(); err != nil {
 				// Log error but don't crash
-				logging.GetDefaultLogger().Error("Failed to save state to Redis periodically", "error", err)
+				logging.Component("state").Error("Failed to save state to Redis periodically", "error", err)
 			}
 		case <-m.stopCh:
 			return
@@ -188,7 +352,8 @@ func (m *RedisStateManager) MigrateFromFile(fileManager *Manager) error {
 		TotalBytesProcessed:    bytes,
 		LastUpdated:            time.Now().Unix(),
 	}
-	m.dirty = true
+	m.resetEdits()
+	m.markDirty()
 	m.mu.Unlock()
 
 	// Save to Redis
@@ -0,0 +1,93 @@
+package state
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// newTestRedisStateManager opens a Redis state manager on server
+func newTestRedisStateManager(t *testing.T, server *miniredis.Miniredis) *RedisStateManager {
+	t.Helper()
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatalf("Invalid port: %v", err)
+	}
+	cfg := config.RedisConfig{Host: server.Host(), Port: port, KeyPrefix: "s3-streamer", ProcessedTTL: time.Hour}
+	m, err := NewRedisStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewRedisStateManager failed: %v", err)
+	}
+	return m
+}
+
+func TestRedisStateManager_ConflictingWriters(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := newTestRedisStateManager(t, server)
+	second := newTestRedisStateManager(t, server)
+
+	first.UpdateStreamProgress("logs/", 100, "logs/a.gz", 10)
+	if err := first.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	second.UpdateStreamProgress("logs/", 50, "logs/old.gz", 10)
+	if err := second.Save(); !errors.Is(err, ErrConflictingWriter) {
+		t.Fatalf("Expected ErrConflictingWriter, got %v", err)
+	}
+	if cp := newTestRedisStateManager(t, server).GetCheckpoint("logs/"); cp.Timestamp != 100 {
+		t.Errorf("Expected the first instance's checkpoint to be kept, got %+v", cp)
+	}
+}
+
+func TestRedisStateManager_SharedWriters(t *testing.T) {
+	server := miniredis.RunT(t)
+	a := newTestRedisStateManager(t, server)
+	b := newTestRedisStateManager(t, server)
+	a.SetSharedWriters()
+	b.SetSharedWriters()
+
+	// Each instance advances the checkpoint of its own shard
+	a.UpdateStreamProgress("logs/#0", 100, "logs/a.gz", 10)
+	a.UpdateOffset("logs/c.gz", FileOffset{Lines: 5})
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	b.UpdateStreamProgress("logs/#1", 200, "logs/b.gz", 20)
+	b.PutFailure(FailedFile{Key: "logs/d.gz", Attempts: 1})
+	if err := b.Save(); err != nil {
+		t.Fatalf("Expected the second instance's save to merge, got %v", err)
+	}
+
+	// A reload keeps unsaved changes and picks up the other instance's
+	a.UpdateStreamProgress("logs/#0", 300, "logs/e.gz", 30)
+	if err := a.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if cp := a.GetCheckpoint("logs/#1"); cp.Timestamp != 200 {
+		t.Errorf("Expected the other shard's checkpoint after reload, got %+v", cp)
+	}
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	stored := newTestRedisStateManager(t, server)
+	if cp := stored.GetCheckpoint("logs/#0"); cp.Timestamp != 300 || cp.LastFile != "logs/e.gz" {
+		t.Errorf("Expected shard 0 at 300/logs/e.gz, got %+v", cp)
+	}
+	if cp := stored.GetCheckpoint("logs/#1"); cp.Timestamp != 200 || cp.LastFile != "logs/b.gz" {
+		t.Errorf("Expected shard 1 at 200/logs/b.gz, got %+v", cp)
+	}
+	if files, bytes, _ := stored.GetStats(); files != 3 || bytes != 60 {
+		t.Errorf("Expected 3 files and 60 bytes, got %d and %d", files, bytes)
+	}
+	if _, ok := stored.GetOffset("logs/c.gz"); !ok {
+		t.Error("Expected the first instance's offset to be kept")
+	}
+	if _, ok, _ := stored.GetFailure("logs/d.gz"); !ok {
+		t.Error("Expected the second instance's failure entry to be kept")
+	}
+}
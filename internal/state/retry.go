@@ -0,0 +1,305 @@
+package state
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FailedFile is a file whose processing failed. It waits for a retry until its attempts
+// are used up and is then quarantined until an operator requeues or dismisses it.
+type FailedFile struct {
+	Key          string `json:"key"`
+	StreamID     string `json:"stream_id,omitempty"`
+	Timestamp    int64  `json:"timestamp"`
+	Size         int64  `json:"size,omitempty"`
+	Attempts     int    `json:"attempts"`
+	LastError    string `json:"last_error,omitempty"`
+	FirstFailure int64  `json:"first_failure"`        // Unix time of the first failed attempt
+	LastFailure  int64  `json:"last_failure"`         // Unix time of the latest failed attempt
+	NextRetry    int64  `json:"next_retry,omitempty"` // Unix time the next attempt is due (0 when quarantined)
+	Quarantined  bool   `json:"quarantined,omitempty"`
+	ProcessingID string `json:"processing_id,omitempty"` // Processing ID of the latest failed attempt, to find its log lines
+}
+
+// RetryTracker is implemented by state managers that keep failed files for retry and quarantine
+type RetryTracker interface {
+	// GetFailure returns the failure entry of a file
+	GetFailure(key string) (FailedFile, bool, error)
+	// PutFailure stores the failure entry of a file, replacing any previous one
+	PutFailure(f FailedFile) error
+	// ClearFailure removes the failure entry of a file (processed, or dismissed by an operator)
+	ClearFailure(key string) error
+	// Failures lists every failure entry, oldest file first
+	Failures() ([]FailedFile, error)
+}
+
+// ErrNotQuarantined is returned when requeueing or dismissing a file that is not quarantined
+var ErrNotQuarantined = errors.New("file is not quarantined")
+
+// Quarantined lists the quarantined files, oldest file first
+func Quarantined(t RetryTracker) ([]FailedFile, error) {
+	files, err := t.Failures()
+	if err != nil {
+		return nil, err
+	}
+	quarantined := files[:0]
+	for _, f := range files {
+		if f.Quarantined {
+			quarantined = append(quarantined, f)
+		}
+	}
+	return quarantined, nil
+}
+
+// Requeue releases a quarantined file for one more attempt, due immediately. Its attempt
+// count is kept, so the file is quarantined again if that attempt fails too.
+func Requeue(t RetryTracker, key string) (FailedFile, error) {
+	f, found, err := t.GetFailure(key)
+	if err != nil {
+		return FailedFile{}, err
+	}
+	if !found || !f.Quarantined {
+		return FailedFile{}, fmt.Errorf("%w: %s", ErrNotQuarantined, key)
+	}
+	f.Quarantined = false
+	f.NextRetry = time.Now().Unix()
+	return f, t.PutFailure(f)
+}
+
+// Dismiss removes a quarantined file without processing it
+func Dismiss(t RetryTracker, key string) (FailedFile, error) {
+	f, found, err := t.GetFailure(key)
+	if err != nil {
+		return FailedFile{}, err
+	}
+	if !found || !f.Quarantined {
+		return FailedFile{}, fmt.Errorf("%w: %s", ErrNotQuarantined, key)
+	}
+	return f, t.ClearFailure(key)
+}
+
+// putFailure stores a failure entry
+func (s *State) putFailure(f FailedFile) {
+	if s.Failed == nil {
+		s.Failed = make(map[string]FailedFile)
+	}
+	s.Failed[f.Key] = f
+}
+
+// clearFailure removes a failure entry, reporting whether there was one
+func (s *State) clearFailure(key string) bool {
+	if _, ok := s.Failed[key]; !ok {
+		return false
+	}
+	delete(s.Failed, key)
+	return true
+}
+
+// failures lists the failure entries, oldest file first
+func (s *State) failures() []FailedFile {
+	files := make([]FailedFile, 0, len(s.Failed))
+	for _, f := range s.Failed {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Timestamp != files[j].Timestamp {
+			return files[i].Timestamp < files[j].Timestamp
+		}
+		return files[i].Key < files[j].Key
+	})
+	return files
+}
+
+// GetFailure returns the failure entry of a file
+func (m *Manager) GetFailure(key string) (FailedFile, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.state.Failed[key]
+	return f, ok, nil
+}
+
+// PutFailure stores the failure entry of a file
+func (m *Manager) PutFailure(f FailedFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.putFailure(f)
+	m.markDirty()
+	return nil
+}
+
+// ClearFailure removes the failure entry of a file
+func (m *Manager) ClearFailure(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state.clearFailure(key) {
+		m.markDirty()
+	}
+	return nil
+}
+
+// Failures lists every failure entry
+func (m *Manager) Failures() ([]FailedFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.failures(), nil
+}
+
+// GetFailure returns the failure entry of a file
+func (m *RedisStateManager) GetFailure(key string) (FailedFile, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.state.Failed[key]
+	return f, ok, nil
+}
+
+// PutFailure stores the failure entry of a file
+func (m *RedisStateManager) PutFailure(f FailedFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.putFailure(f)
+	m.editFailure(f.Key, &f)
+	m.markDirty()
+	return nil
+}
+
+// ClearFailure removes the failure entry of a file
+func (m *RedisStateManager) ClearFailure(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state.clearFailure(key) {
+		m.editFailure(key, nil)
+		m.markDirty()
+	}
+	return nil
+}
+
+// Failures lists every failure entry
+func (m *RedisStateManager) Failures() ([]FailedFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.failures(), nil
+}
+
+// GetFailure returns the failure entry of a file
+func (m *KVStateManager) GetFailure(key string) (FailedFile, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.state.Failed[key]
+	return f, ok, nil
+}
+
+// PutFailure stores the failure entry of a file. Like offsets, the edit is replayed onto
+// the stored state if another replica saved first.
+func (m *KVStateManager) PutFailure(f FailedFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.putFailure(f)
+	m.editFailure(f.Key, &f)
+	m.markDirty()
+	return nil
+}
+
+// ClearFailure removes the failure entry of a file
+func (m *KVStateManager) ClearFailure(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state.clearFailure(key) {
+		m.editFailure(key, nil)
+		m.markDirty()
+	}
+	return nil
+}
+
+// Failures lists every failure entry
+func (m *KVStateManager) Failures() ([]FailedFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.failures(), nil
+}
+
+// failuresTable is the table holding the failure entries next to the file records
+func (m *SQLStateManager) failuresTable() string {
+	return m.table + "_failures"
+}
+
+// GetFailure returns the failure entry of a file
+func (m *SQLStateManager) GetFailure(key string) (FailedFile, bool, error) {
+	query := m.rebind(fmt.Sprintf(
+		"SELECT s3_key, stream_id, timestamp, size, attempts, last_error, first_failure, last_failure, next_retry, quarantined, processing_id FROM %s WHERE s3_key = ?",
+		m.failuresTable()))
+	f, err := scanFailure(m.db.QueryRowContext(m.ctx, query, key))
+	if err == sql.ErrNoRows {
+		return FailedFile{}, false, nil
+	}
+	if err != nil {
+		return FailedFile{}, false, fmt.Errorf("failed to query failure entry: %w", err)
+	}
+	return f, true, nil
+}
+
+// PutFailure writes the failure entry of a file immediately (failures are rare, so they are not batched)
+func (m *SQLStateManager) PutFailure(f FailedFile) error {
+	query := m.rebind(fmt.Sprintf(`INSERT INTO %s (s3_key, stream_id, timestamp, size, attempts, last_error, first_failure, last_failure, next_retry, quarantined, processing_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (s3_key) DO UPDATE SET
+	stream_id = excluded.stream_id,
+	timestamp = excluded.timestamp,
+	size = excluded.size,
+	attempts = excluded.attempts,
+	last_error = excluded.last_error,
+	first_failure = excluded.first_failure,
+	last_failure = excluded.last_failure,
+	next_retry = excluded.next_retry,
+	quarantined = excluded.quarantined,
+	processing_id = excluded.processing_id`, m.failuresTable()))
+	_, err := m.db.ExecContext(m.ctx, query, f.Key, f.StreamID, f.Timestamp, f.Size, int64(f.Attempts),
+		f.LastError, f.FirstFailure, f.LastFailure, f.NextRetry, f.Quarantined, f.ProcessingID)
+	if err != nil {
+		return fmt.Errorf("failed to save failure entry: %w", err)
+	}
+	return nil
+}
+
+// ClearFailure deletes the failure entry of a file
+func (m *SQLStateManager) ClearFailure(key string) error {
+	query := m.rebind(fmt.Sprintf("DELETE FROM %s WHERE s3_key = ?", m.failuresTable()))
+	if _, err := m.db.ExecContext(m.ctx, query, key); err != nil {
+		return fmt.Errorf("failed to delete failure entry: %w", err)
+	}
+	return nil
+}
+
+// Failures lists every failure entry
+func (m *SQLStateManager) Failures() ([]FailedFile, error) {
+	query := fmt.Sprintf(
+		"SELECT s3_key, stream_id, timestamp, size, attempts, last_error, first_failure, last_failure, next_retry, quarantined, processing_id FROM %s ORDER BY timestamp, s3_key",
+		m.failuresTable())
+	rows, err := m.db.QueryContext(m.ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failure entries: %w", err)
+	}
+	defer rows.Close()
+
+	var files []FailedFile
+	for rows.Next() {
+		f, err := scanFailure(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read failure entry: %w", err)
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// scanFailure reads a failure entry from a row of the failures table
+func scanFailure(row interface{ Scan(dest ...any) error }) (FailedFile, error) {
+	var f FailedFile
+	var attempts int64
+	err := row.Scan(&f.Key, &f.StreamID, &f.Timestamp, &f.Size, &attempts, &f.LastError,
+		&f.FirstFailure, &f.LastFailure, &f.NextRetry, &f.Quarantined, &f.ProcessingID)
+	f.Attempts = int(attempts)
+	return f, err
+}
@@ -0,0 +1,103 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestManager_Failures(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	manager, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	manager.PutFailure(FailedFile{Key: "logs/200.gz", Timestamp: 200, Attempts: 1, NextRetry: 1000})
+	manager.PutFailure(FailedFile{Key: "logs/100.gz", Timestamp: 100, Attempts: 5, Quarantined: true})
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	failures, _ := reloaded.Failures()
+	if len(failures) != 2 || failures[0].Key != "logs/100.gz" || !failures[0].Quarantined {
+		t.Fatalf("Expected 2 failures oldest first, got %+v", failures)
+	}
+
+	reloaded.ClearFailure("logs/100.gz")
+	if _, found, _ := reloaded.GetFailure("logs/100.gz"); found {
+		t.Error("Expected the failure entry to be cleared")
+	}
+}
+
+func TestKVStateManager_MergesFailures(t *testing.T) {
+	kv := &fakeKV{}
+	server := newFakeConsul(t, kv)
+	defer server.Close()
+	cfg := config.KVConfig{Backend: "consul", Address: server.URL, Key: "s3-streamer/state"}
+
+	replicaA, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	replicaB, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+
+	replicaA.SetSharedWriters()
+	replicaB.SetSharedWriters()
+
+	replicaA.PutFailure(FailedFile{Key: "logs/a.gz", Attempts: 1})
+	replicaB.PutFailure(FailedFile{Key: "logs/b.gz", Attempts: 2})
+	if err := replicaA.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := replicaB.Save(); err != nil {
+		t.Fatalf("Save after conflict failed: %v", err)
+	}
+
+	restarted, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	if failures, _ := restarted.Failures(); len(failures) != 2 {
+		t.Errorf("Expected the failures of both replicas, got %+v", failures)
+	}
+}
+
+func TestSQLStateManager_Failures(t *testing.T) {
+	db := newFakeDB("failures")
+	manager, err := NewSQLStateManager(config.SQLConfig{Driver: "statetest", DSN: "failures", Table: "s3_streamer_files"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+
+	if _, found, err := manager.GetFailure("logs/100.gz"); err != nil || found {
+		t.Fatalf("Expected no failure entry, got %v, %v", found, err)
+	}
+
+	entry := FailedFile{Key: "logs/100.gz", StreamID: "bucket/logs/", Timestamp: 100, Attempts: 3, LastError: "access denied", FirstFailure: 10, LastFailure: 20, Quarantined: true, ProcessingID: "9f86d081884c7d65"}
+	if err := manager.PutFailure(entry); err != nil {
+		t.Fatalf("PutFailure failed: %v", err)
+	}
+	if got, found, err := manager.GetFailure("logs/100.gz"); err != nil || !found || got != entry {
+		t.Errorf("Expected %+v, got %+v (%v, %v)", entry, got, found, err)
+	}
+	if failures, err := manager.Failures(); err != nil || len(failures) != 1 {
+		t.Errorf("Expected 1 failure entry, got %+v (%v)", failures, err)
+	}
+
+	if err := manager.ClearFailure("logs/100.gz"); err != nil {
+		t.Fatalf("ClearFailure failed: %v", err)
+	}
+	if len(db.failures) != 0 {
+		t.Errorf("Expected the failure entry to be deleted, got %+v", db.failures)
+	}
+}
@@ -0,0 +1,38 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrConflictingWriter is returned by Save when the stored state was written by another
+// instance since it was loaded, e.g. two streamers accidentally sharing one state key.
+// The write is refused instead of overwriting the other instance's checkpoint.
+var ErrConflictingWriter = errors.New("state was written by another instance; refusing to overwrite it")
+
+// storedRevision returns the revision of a stored state document (0 if there is none)
+func storedRevision(data []byte) (int64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var stored struct {
+		Revision int64 `json:"revision"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal stored state: %w", err)
+	}
+	return stored.Revision, nil
+}
+
+// checkRevision fails with ErrConflictingWriter unless the stored revision is the one last loaded or written
+func checkRevision(data []byte, expected int64) error {
+	revision, err := storedRevision(data)
+	if err != nil {
+		return err
+	}
+	if revision != expected {
+		return fmt.Errorf("%w (stored revision %d, expected %d)", ErrConflictingWriter, revision, expected)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package state
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// maxRewindHistory is how many rewind records are kept in the state
+const maxRewindHistory = 20
+
+// ErrRewindForward is returned when the target is not before the current checkpoint
+var ErrRewindForward = errors.New("rewind target must be before the current checkpoint")
+
+// RewindRequest moves a checkpoint back so a time window is processed again
+type RewindRequest struct {
+	To       int64  // New checkpoint timestamp; files with later timestamps are processed again
+	StreamID string // Stream to rewind ("" rewinds the global position and every stream)
+	By       string // Who requested the rewind
+	Reason   string
+}
+
+// RewindRecord is an applied rewind, kept in the state for auditing
+type RewindRecord struct {
+	At       int64  `json:"at"`
+	By       string `json:"by"`
+	StreamID string `json:"stream_id,omitempty"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// RewindEstimate describes what a rewind would send again
+type RewindEstimate struct {
+	From  int64 `json:"from"`            // Current checkpoint
+	To    int64 `json:"to"`              // Rewind target
+	Files int64 `json:"files,omitempty"` // Files processed in the window (per-file backends only)
+	Bytes int64 `json:"bytes,omitempty"`
+	Exact bool  `json:"exact"` // Files and Bytes are counted from per-file records
+}
+
+// Warning describes the duplicate volume the rewind will cause
+func (e RewindEstimate) Warning() string {
+	window := time.Duration(e.From-e.To) * time.Second
+	msg := fmt.Sprintf("files with timestamps in the %s window after %s will be sent again",
+		window, time.Unix(e.To, 0).UTC().Format(time.RFC3339))
+	if e.Exact {
+		msg += fmt.Sprintf(" (%d files, %d bytes already delivered)", e.Files, e.Bytes)
+	}
+	return msg
+}
+
+// ParseRewindTarget accepts a Unix timestamp in seconds or an RFC 3339 time
+func ParseRewindTarget(value string) (int64, error) {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rewind target %q: expected Unix seconds or RFC 3339", value)
+	}
+	return t.Unix(), nil
+}
+
+// Rewinder is implemented by state managers that can move checkpoints back
+type Rewinder interface {
+	EstimateRewind(streamID string, to int64) (RewindEstimate, error)
+	// Rewind applies and persists the rewind before returning
+	Rewind(req RewindRequest) (RewindRecord, error)
+}
+
+// rewind moves checkpoints after req.To back to it, clears resume points within files
+// (rewound files are sent from the start) and appends the rewind to the history
+func (s *State) rewind(req RewindRequest) (RewindRecord, error) {
+	from := s.checkpoint(req.StreamID).Timestamp
+	if req.To >= from {
+		return RewindRecord{}, fmt.Errorf("%w (checkpoint %d, target %d)", ErrRewindForward, from, req.To)
+	}
+
+	if req.StreamID == "" {
+		s.LastProcessedTimestamp = req.To
+		s.LastProcessedFile = ""
+		for id, cp := range s.Streams {
+			if cp.Timestamp > req.To {
+				s.Streams[id] = Checkpoint{Timestamp: req.To}
+			}
+		}
+	} else {
+		if s.Streams == nil {
+			s.Streams = make(map[string]Checkpoint)
+		}
+		s.Streams[req.StreamID] = Checkpoint{Timestamp: req.To}
+	}
+	s.Offsets = nil
+
+	record := RewindRecord{
+		At:       time.Now().Unix(),
+		By:       req.By,
+		StreamID: req.StreamID,
+		From:     from,
+		To:       req.To,
+		Reason:   req.Reason,
+	}
+	s.Rewinds = append(s.Rewinds, record)
+	if len(s.Rewinds) > maxRewindHistory {
+		s.Rewinds = s.Rewinds[len(s.Rewinds)-maxRewindHistory:]
+	}
+	s.LastUpdated = record.At
+	return record, nil
+}
+
+// lastRewind returns the time of the latest rewind in the history (0 if none)
+func (s *State) lastRewind() int64 {
+	if len(s.Rewinds) == 0 {
+		return 0
+	}
+	return s.Rewinds[len(s.Rewinds)-1].At
+}
+
+func logRewind(record RewindRecord) {
+	logging.Component("state").Warn("State checkpoint rewound",
+		"stream_id", record.StreamID,
+		"from", record.From,
+		"to", record.To,
+		"by", record.By,
+		"reason", record.Reason)
+}
+
+// EstimateRewind reports the window a rewind would send again
+func (m *Manager) EstimateRewind(streamID string, to int64) (RewindEstimate, error) {
+	return m.Snapshot().estimateRewind(streamID, to)
+}
+
+// Rewind moves the checkpoint back and saves the state file
+func (m *Manager) Rewind(req RewindRequest) (RewindRecord, error) {
+	m.mu.Lock()
+	record, err := m.state.rewind(req)
+	if err == nil {
+		m.markDirty()
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return record, err
+	}
+
+	logRewind(record)
+	return record, m.Save()
+}
+
+// EstimateRewind reports the window a rewind would send again
+func (m *RedisStateManager) EstimateRewind(streamID string, to int64) (RewindEstimate, error) {
+	return m.Snapshot().estimateRewind(streamID, to)
+}
+
+// Rewind moves the checkpoint back and saves the state to Redis
+func (m *RedisStateManager) Rewind(req RewindRequest) (RewindRecord, error) {
+	m.mu.Lock()
+	record, err := m.state.rewind(req)
+	if err == nil {
+		m.markDirty()
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return record, err
+	}
+
+	logRewind(record)
+	return record, m.Save()
+}
+
+// EstimateRewind reports the window a rewind would send again
+func (m *KVStateManager) EstimateRewind(streamID string, to int64) (RewindEstimate, error) {
+	return m.Snapshot().estimateRewind(streamID, to)
+}
+
+// Rewind applies the rewind to the stored state with a CAS write. A running replica's next
+// save then fails with ErrConflictingWriter, or with shared writers adopts the rewound
+// checkpoints when it merges (see merge).
+func (m *KVStateManager) Rewind(req RewindRequest) (RewindRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	for attempt := 1; attempt <= maxCASAttempts; attempt++ {
+		if err := m.merge(ctx); err != nil {
+			return RewindRecord{}, err
+		}
+		rewound := m.state.clone()
+		record, err := rewound.rewind(req)
+		if err != nil {
+			return record, err
+		}
+
+		data, err := json.Marshal(rewound)
+		if err != nil {
+			return record, fmt.Errorf("failed to marshal state: %w", err)
+		}
+		version, ok, err := m.store.put(ctx, data, m.version)
+		if err != nil {
+			return record, fmt.Errorf("failed to save state to KV store: %w", err)
+		}
+		if ok {
+			m.state = rewound
+			m.version = version
+			m.resetEdits()
+			m.markClean()
+			logRewind(record)
+			return record, nil
+		}
+	}
+	return RewindRecord{}, errCASConflict
+}
+
+// estimateRewind validates the target and returns the window without per-file counts
+func (s State) estimateRewind(streamID string, to int64) (RewindEstimate, error) {
+	from := s.checkpoint(streamID).Timestamp
+	if to >= from {
+		return RewindEstimate{}, fmt.Errorf("%w (checkpoint %d, target %d)", ErrRewindForward, from, to)
+	}
+	return RewindEstimate{From: from, To: to}, nil
+}
+
+// EstimateRewind counts the processed files and bytes in the window from the file records
+func (m *SQLStateManager) EstimateRewind(streamID string, to int64) (RewindEstimate, error) {
+	estimate, err := m.Snapshot().estimateRewind(streamID, to)
+	if err != nil {
+		return estimate, err
+	}
+
+	query, args := fmt.Sprintf("SELECT COUNT(*), SUM(bytes) FROM %s WHERE status = ? AND timestamp > ?", m.table), []any{FileStatusProcessed, to}
+	if streamID != "" {
+		query += " AND stream_id = ?"
+		args = append(args, streamID)
+	}
+	var files, bytes sql.NullInt64
+	if err := m.db.QueryRowContext(m.ctx, m.rebind(query), args...).Scan(&files, &bytes); err != nil {
+		return estimate, fmt.Errorf("failed to count file records: %w", err)
+	}
+	estimate.Files = files.Int64
+	estimate.Bytes = bytes.Int64
+	estimate.Exact = true
+	return estimate, nil
+}
+
+// Rewind marks processed records after the target as rewound, so they are no longer
+// reported as processed and no longer count towards totals and checkpoints
+func (m *SQLStateManager) Rewind(req RewindRequest) (RewindRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Pending records must not be written as processed after the rewind
+	if err := m.saveLocked(); err != nil {
+		return RewindRecord{}, err
+	}
+
+	rewound := m.state.clone()
+	record, err := rewound.rewind(req)
+	if err != nil {
+		return record, err
+	}
+
+	query, args := fmt.Sprintf("UPDATE %s SET status = ?, updated_at = ? WHERE status = ? AND timestamp > ?", m.table),
+		[]any{FileStatusRewound, record.At, FileStatusProcessed, req.To}
+	if req.StreamID != "" {
+		query += " AND stream_id = ?"
+		args = append(args, req.StreamID)
+	}
+	if _, err := m.db.ExecContext(m.ctx, m.rebind(query), args...); err != nil {
+		return record, fmt.Errorf("failed to rewind file records: %w", err)
+	}
+
+	// Totals are recounted from the records; positions are the rewound ones, since records
+	// at or before the target would otherwise put the checkpoint earlier than requested
+	if err := m.load(); err != nil {
+		return record, fmt.Errorf("failed to reload state from database: %w", err)
+	}
+	m.state.LastProcessedTimestamp = rewound.LastProcessedTimestamp
+	m.state.LastProcessedFile = rewound.LastProcessedFile
+	m.state.Streams = rewound.Streams
+	m.state.Rewinds = rewound.Rewinds // The history is not stored in the table
+	logRewind(record)
+	return record, nil
+}
@@ -0,0 +1,134 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestManager_Rewind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	manager, err := NewManager(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	manager.UpdateStreamProgress("bucket/a/", 500, "a/500.gz", 10)
+	manager.UpdateStreamProgress("bucket/b/", 300, "b/300.gz", 10)
+	manager.UpdateOffset("a/600.gz", FileOffset{Sent: 1000})
+
+	if _, err := manager.Rewind(RewindRequest{To: 600}); !errors.Is(err, ErrRewindForward) {
+		t.Errorf("Expected ErrRewindForward for a forward move, got %v", err)
+	}
+
+	estimate, err := manager.EstimateRewind("", 400)
+	if err != nil || estimate.From != 500 || estimate.To != 400 || estimate.Exact {
+		t.Errorf("Unexpected estimate %+v (error %v)", estimate, err)
+	}
+
+	record, err := manager.Rewind(RewindRequest{To: 400, By: "alice", Reason: "endpoint outage"})
+	if err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	if record.From != 500 || record.To != 400 || record.By != "alice" || record.At == 0 {
+		t.Errorf("Unexpected rewind record %+v", record)
+	}
+
+	// The rewind is saved immediately
+	reloaded, err := NewManager(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if cp := reloaded.GetCheckpoint("bucket/a/"); cp.Timestamp != 400 || cp.LastFile != "" {
+		t.Errorf("Expected stream a rewound to 400, got %+v", cp)
+	}
+	if cp := reloaded.GetCheckpoint("bucket/b/"); cp.Timestamp != 300 {
+		t.Errorf("Expected stream b before the target to stay at 300, got %+v", cp)
+	}
+	if _, ok := reloaded.GetOffset("a/600.gz"); ok {
+		t.Error("Expected resume points to be cleared by the rewind")
+	}
+	if history := reloaded.Snapshot().Rewinds; len(history) != 1 || history[0].Reason != "endpoint outage" {
+		t.Errorf("Expected rewind recorded in the state, got %+v", history)
+	}
+}
+
+func TestKVStateManager_RewindSticksAcrossReplicas(t *testing.T) {
+	kv := &fakeKV{}
+	server := newFakeConsul(t, kv)
+	defer server.Close()
+	cfg := config.KVConfig{Backend: "consul", Address: server.URL, Key: "s3-streamer/state"}
+
+	running, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	running.SetSharedWriters()
+	running.UpdateStreamProgress("bucket/a/", 500, "a/500.gz", 10)
+	if err := running.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	operator, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	if _, err := operator.Rewind(RewindRequest{StreamID: "bucket/a/", To: 200, By: "ops"}); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+
+	// The running replica still has the later checkpoint in memory; its next save must not undo the rewind
+	running.UpdateStreamProgress("bucket/b/", 100, "b/100.gz", 10)
+	if err := running.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if cp := running.GetCheckpoint("bucket/a/"); cp.Timestamp != 200 {
+		t.Errorf("Expected running replica to adopt the rewound checkpoint 200, got %d", cp.Timestamp)
+	}
+	if files, _, _ := running.GetStats(); files != 2 {
+		t.Errorf("Expected progress made before the merge to be kept, got %d files", files)
+	}
+}
+
+func TestSQLStateManager_Rewind(t *testing.T) {
+	db := newFakeDB("rewind")
+	manager, err := NewSQLStateManager(config.SQLConfig{Driver: "statetest", DSN: "rewind", Table: "files"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	manager.UpdateStreamProgress("bucket/a/", 100, "a/100.gz", 10)
+	manager.UpdateStreamProgress("bucket/a/", 200, "a/200.gz", 20)
+	manager.UpdateStreamProgress("bucket/a/", 300, "a/300.gz", 30) // Unsaved when the rewind starts
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	manager.UpdateStreamProgress("bucket/a/", 400, "a/400.gz", 40)
+
+	estimate, err := manager.EstimateRewind("bucket/a/", 150)
+	if err != nil {
+		t.Fatalf("EstimateRewind failed: %v", err)
+	}
+	if !estimate.Exact || estimate.Files != 2 || estimate.Bytes != 50 {
+		t.Errorf("Expected exact estimate of the 2 saved files (50 bytes), got %+v", estimate)
+	}
+
+	if _, err := manager.Rewind(RewindRequest{StreamID: "bucket/a/", To: 150}); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	for _, key := range []string{"a/200.gz", "a/300.gz", "a/400.gz"} {
+		if rec := db.records[key]; rec.status != FileStatusRewound {
+			t.Errorf("Expected %s to be rewound, got %q", key, rec.status)
+		}
+		if processed, _ := manager.IsProcessed(key); processed {
+			t.Errorf("Expected %s not to be reported as processed", key)
+		}
+	}
+	if cp := manager.GetCheckpoint("bucket/a/"); cp.Timestamp != 150 {
+		t.Errorf("Expected checkpoint 150, got %d", cp.Timestamp)
+	}
+	if files, _, _ := manager.GetStats(); files != 1 {
+		t.Errorf("Expected totals recounted to 1 file, got %d", files)
+	}
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// snapshotTimeout bounds one snapshot upload or download
+const snapshotTimeout = 30 * time.Second
+
+// SnapshotObjectAPI is the subset of the S3 client used for state snapshots
+type SnapshotObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// S3Snapshot keeps a copy of the state in an S3 object, in the format of the state file,
+// so the checkpoint survives losing the state file or Redis
+type S3Snapshot struct {
+	client SnapshotObjectAPI
+	bucket string
+	key    string
+}
+
+// NewS3Snapshot creates an S3 snapshot store
+func NewS3Snapshot(client SnapshotObjectAPI, cfg config.SnapshotConfig) *S3Snapshot {
+	return &S3Snapshot{client: client, bucket: cfg.Bucket, key: cfg.Key}
+}
+
+// Upload writes the state to the snapshot object
+func (s *S3Snapshot) Upload(ctx context.Context, st State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	return s.put(ctx, data)
+}
+
+func (s *S3Snapshot) put(ctx context.Context, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload state snapshot to s3://%s/%s: %w", s.bucket, s.key, err)
+	}
+	return nil
+}
+
+// Download reads the snapshot object. found is false if no snapshot was uploaded yet.
+func (s *S3Snapshot) Download(ctx context.Context) (st State, found bool, err error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return State{}, false, nil
+		}
+		return State{}, false, fmt.Errorf("failed to download state snapshot from s3://%s/%s: %w", s.bucket, s.key, err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return State{}, false, fmt.Errorf("failed to read state snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return State{}, false, fmt.Errorf("failed to parse state snapshot: %w", err)
+	}
+	return st, true, nil
+}
+
+// empty reports whether the state holds no checkpoint or totals, i.e. the backend has no stored state
+func (s State) empty() bool {
+	return s.LastProcessedTimestamp == 0 && s.LastProcessedFile == "" &&
+		s.TotalFilesProcessed == 0 && len(s.Streams) == 0
+}
+
+// Bootstrap restores the snapshot into a state manager that holds no state and saves it.
+// It reports whether the snapshot was restored; state already present is never replaced.
+func Bootstrap(ctx context.Context, manager StateManager, snapshot *S3Snapshot) (bool, error) {
+	s, ok := manager.(Snapshotter)
+	if !ok {
+		return false, fmt.Errorf("state backend %T does not support snapshots", manager)
+	}
+	if !s.Snapshot().empty() {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+	st, found, err := snapshot.Download(ctx)
+	if err != nil || !found {
+		return false, err
+	}
+
+	if err := s.Restore(st); err != nil {
+		return false, fmt.Errorf("failed to restore state snapshot: %w", err)
+	}
+	if err := manager.Save(); err != nil {
+		return false, fmt.Errorf("failed to save restored state: %w", err)
+	}
+	logging.Component("state").Warn("State missing, bootstrapped from S3 snapshot",
+		"bucket", snapshot.bucket,
+		"key", snapshot.key,
+		"last_timestamp", st.LastProcessedTimestamp,
+		"last_file", st.LastProcessedFile)
+	return true, nil
+}
+
+// RunSnapshots uploads the state every interval, and once more when stop is closed.
+// Unchanged state is not uploaded again.
+func RunSnapshots(s Snapshotter, snapshot *S3Snapshot, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []byte
+	upload := func() {
+		data, err := json.MarshalIndent(s.Snapshot(), "", "  ")
+		if err != nil {
+			logging.Component("state").Error("Failed to marshal state snapshot", "error", err)
+			return
+		}
+		if bytes.Equal(data, last) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+		defer cancel()
+		if err := snapshot.put(ctx, data); err != nil {
+			// Log error but don't crash; the next run retries
+			logging.Component("state").Error("State snapshot failed", "error", err)
+			return
+		}
+		last = data
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			upload()
+		case <-stop:
+			upload()
+			return
+		}
+	}
+}
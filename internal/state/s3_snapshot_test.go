@@ -0,0 +1,135 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// fakeObjects is an in-memory SnapshotObjectAPI
+type fakeObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func (f *fakeObjects) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.objects == nil {
+		f.objects = make(map[string][]byte)
+	}
+	f.objects[*params.Bucket+"/"+*params.Key] = data
+	f.puts++
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeObjects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[*params.Bucket+"/"+*params.Key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeObjects) putCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.puts
+}
+
+func TestBootstrap(t *testing.T) {
+	objects := &fakeObjects{}
+	snapshot := NewS3Snapshot(objects, config.SnapshotConfig{Bucket: "state-bucket", Key: "s3-streamer/state-snapshot.json"})
+
+	// Nothing uploaded yet: the state starts empty
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	manager, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if restored, err := Bootstrap(context.Background(), manager, snapshot); err != nil || restored {
+		t.Fatalf("Expected no restore without a snapshot, got %v, %v", restored, err)
+	}
+
+	source, err := NewManager(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	source.UpdateStreamProgress("bucket/logs/", 300, "logs/300.gz", 1024)
+	if err := snapshot.Upload(context.Background(), source.Snapshot()); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	restored, err := Bootstrap(context.Background(), manager, snapshot)
+	if err != nil || !restored {
+		t.Fatalf("Expected the snapshot to be restored, got %v, %v", restored, err)
+	}
+	if cp := manager.GetCheckpoint("bucket/logs/"); cp.Timestamp != 300 || cp.LastFile != "logs/300.gz" {
+		t.Errorf("Expected restored checkpoint 300/logs/300.gz, got %+v", cp)
+	}
+
+	// The restored state was saved, and existing state is never replaced
+	reloaded, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if reloaded.GetLastTimestamp() != 300 {
+		t.Errorf("Expected saved timestamp 300, got %d", reloaded.GetLastTimestamp())
+	}
+	if restored, err := Bootstrap(context.Background(), reloaded, snapshot); err != nil || restored {
+		t.Errorf("Expected existing state to be kept, got %v, %v", restored, err)
+	}
+}
+
+func TestRunSnapshots(t *testing.T) {
+	objects := &fakeObjects{}
+	snapshot := NewS3Snapshot(objects, config.SnapshotConfig{Bucket: "state-bucket", Key: "snapshot.json"})
+	manager, err := NewManager(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	manager.UpdateProgress(100, "logs/100.gz", 10)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		RunSnapshots(manager, snapshot, 10*time.Millisecond, stop)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if puts := objects.putCount(); puts != 1 {
+		t.Errorf("Expected unchanged state to be uploaded once, got %d uploads", puts)
+	}
+
+	manager.UpdateProgress(200, "logs/200.gz", 10)
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected RunSnapshots to return once stopped")
+	}
+
+	st, found, err := snapshot.Download(context.Background())
+	if err != nil || !found {
+		t.Fatalf("Expected an uploaded snapshot, got %v, %v", found, err)
+	}
+	if st.LastProcessedTimestamp != 200 {
+		t.Errorf("Expected the final upload on stop, got timestamp %d", st.LastProcessedTimestamp)
+	}
+}
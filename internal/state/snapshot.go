@@ -0,0 +1,156 @@
+package state
+
+import (
+	"fmt"
+	"maps"
+	"time"
+)
+
+// Snapshotter is implemented by state managers whose complete state can be exported and replaced.
+// The exported document has the format of the state file, so it can be moved between backends.
+type Snapshotter interface {
+	Snapshot() State
+	// Restore replaces the in-memory state; call Save to persist it
+	Restore(s State) error
+}
+
+// FileRecord is one stored per-file record
+type FileRecord struct {
+	Key       string `json:"s3_key"`
+	StreamID  string `json:"stream_id,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Bytes     int64  `json:"bytes"`
+	Status    string `json:"status"`
+	Attempts  int64  `json:"attempts"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// FileLister is implemented by state managers that keep per-file records
+type FileLister interface {
+	// RecentFiles returns up to limit records, most recently updated first
+	RecentFiles(limit int) ([]FileRecord, error)
+}
+
+// clone returns a copy of the state that shares no maps with s
+func (s State) clone() State {
+	s.Offsets = maps.Clone(s.Offsets)
+	s.Streams = maps.Clone(s.Streams)
+	s.Failed = maps.Clone(s.Failed)
+	return s
+}
+
+// Snapshot returns a copy of the current state
+func (m *Manager) Snapshot() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.clone()
+}
+
+// Restore replaces the current state
+func (m *Manager) Restore(s State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = s.clone()
+	m.markDirty()
+	return nil
+}
+
+// Snapshot returns a copy of the current state
+func (m *RedisStateManager) Snapshot() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.clone()
+}
+
+// Restore replaces the current state
+func (m *RedisStateManager) Restore(s State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = s.clone()
+	m.resetEdits()
+	m.markDirty()
+	return nil
+}
+
+// Snapshot returns a copy of the current state
+func (m *KVStateManager) Snapshot() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.clone()
+}
+
+// Restore replaces the current state. The stored version is re-read first, so the next Save
+// overwrites the stored state instead of merging with it (unless another replica writes in between).
+func (m *KVStateManager) Restore(s State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := m.context()
+	defer cancel()
+	_, version, err := m.store.get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read state version from KV store: %w", err)
+	}
+
+	m.state = s.clone()
+	m.version = version
+	m.resetEdits()
+	m.markDirty()
+	return nil
+}
+
+// Snapshot returns the totals and checkpoints derived from the file records
+func (m *SQLStateManager) Snapshot() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.clone()
+}
+
+// Restore records the global and per-stream last files as processed. Totals and checkpoints
+// are derived from the file records, so after a restart totals count restored records only.
+func (m *SQLStateManager) Restore(s State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = s.clone()
+	m.state.Offsets = nil // Not tracked by the SQL backend
+
+	now := time.Now().Unix()
+	restore := func(streamID string, cp Checkpoint) {
+		if cp.LastFile == "" {
+			return
+		}
+		rec := m.record(cp.LastFile)
+		rec.streamID = streamID
+		rec.timestamp = cp.Timestamp
+		rec.status = FileStatusProcessed
+		rec.updated = now
+	}
+	restore("", Checkpoint{Timestamp: s.LastProcessedTimestamp, LastFile: s.LastProcessedFile})
+	for streamID, cp := range s.Streams {
+		restore(streamID, cp)
+	}
+	return nil
+}
+
+// RecentFiles returns the most recently updated file records
+func (m *SQLStateManager) RecentFiles(limit int) ([]FileRecord, error) {
+	query := m.rebind(fmt.Sprintf(
+		"SELECT s3_key, stream_id, timestamp, bytes, status, attempts, updated_at FROM %s WHERE status <> '%s' ORDER BY updated_at DESC, timestamp DESC LIMIT ?",
+		m.table, FileStatusCompacted))
+	rows, err := m.db.QueryContext(m.ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []FileRecord
+	for rows.Next() {
+		var rec FileRecord
+		if err := rows.Scan(&rec.Key, &rec.StreamID, &rec.Timestamp, &rec.Bytes, &rec.Status, &rec.Attempts, &rec.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read file record: %w", err)
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,134 @@
+package state
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestManager_SnapshotRestore(t *testing.T) {
+	source, err := NewManager(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	source.UpdateStreamProgress("bucket/logs/", 200, "logs/200.gz", 100)
+	source.UpdateOffset("logs/300.gz", FileOffset{Lines: 10, Sent: 10, Bytes: 500})
+
+	snapshot := source.Snapshot()
+	snapshot.Streams["bucket/other/"] = Checkpoint{Timestamp: 1}
+	if _, ok := source.GetOffset("logs/300.gz"); !ok || len(source.Snapshot().Streams) != 1 {
+		t.Error("Expected snapshot not to share maps with the manager")
+	}
+
+	// Exported JSON round-trips into another manager
+	data, err := json.Marshal(source.Snapshot())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var imported State
+	if err := json.Unmarshal(data, &imported); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	target, err := NewManager(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if err := target.Restore(imported); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if err := target.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded, err := NewManager(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if cp := reloaded.GetCheckpoint("bucket/logs/"); cp.Timestamp != 200 || cp.LastFile != "logs/200.gz" {
+		t.Errorf("Expected checkpoint 200/logs/200.gz, got %+v", cp)
+	}
+	if offset, ok := reloaded.GetOffset("logs/300.gz"); !ok || offset.Sent != 10 {
+		t.Errorf("Expected imported offset, got %+v", offset)
+	}
+}
+
+func TestKVStateManager_RestoreOverwrites(t *testing.T) {
+	kv := &fakeKV{}
+	server := newFakeConsul(t, kv)
+	defer server.Close()
+	cfg := config.KVConfig{Backend: "consul", Address: server.URL, Key: "s3-streamer/state"}
+
+	manager, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	manager.UpdateProgress(500, "logs/500.gz", 10)
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Importing an older checkpoint replaces the stored one rather than merging with it
+	importer, err := NewKVStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKVStateManager failed: %v", err)
+	}
+	if err := importer.Restore(State{LastProcessedTimestamp: 100, LastProcessedFile: "logs/100.gz"}); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if err := importer.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	value, _ := kv.read()
+	var stored State
+	json.Unmarshal(value, &stored)
+	if stored.LastProcessedTimestamp != 100 || stored.LastProcessedFile != "logs/100.gz" {
+		t.Errorf("Expected imported checkpoint 100/logs/100.gz, got %d/%s", stored.LastProcessedTimestamp, stored.LastProcessedFile)
+	}
+}
+
+func TestSQLStateManager_RestoreAndRecentFiles(t *testing.T) {
+	newFakeDB("restore")
+	cfg := config.SQLConfig{Driver: "statetest", DSN: "restore", Table: "files"}
+	manager, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+
+	err = manager.Restore(State{
+		LastProcessedTimestamp: 300,
+		LastProcessedFile:      "zscaler/300.gz",
+		Streams: map[string]Checkpoint{
+			"bucket/zscaler/":  {Timestamp: 300, LastFile: "zscaler/300.gz"},
+			"bucket/umbrella/": {Timestamp: 200, LastFile: "umbrella/200.gz"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	manager.RecordFailure(400, "zscaler/400.gz")
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	restarted, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	if cp := restarted.GetCheckpoint("bucket/umbrella/"); cp.Timestamp != 200 || cp.LastFile != "umbrella/200.gz" {
+		t.Errorf("Expected restored umbrella checkpoint, got %+v", cp)
+	}
+
+	records, err := restarted.RecentFiles(2)
+	if err != nil {
+		t.Fatalf("RecentFiles failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Key != "zscaler/400.gz" || records[0].Status != FileStatusFailed {
+		t.Errorf("Expected 2 records starting with the failed file, got %+v", records)
+	}
+}
@@ -0,0 +1,418 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// File record statuses
+const (
+	FileStatusProcessed = "processed"
+	FileStatusFailed    = "failed"
+	FileStatusInFlight  = "in_flight" // Started but not finished (see Journal)
+	FileStatusPending   = "pending"   // Queued but not started when the previous run stopped (see Journal)
+	FileStatusRewound   = "rewound"   // Processed, then rewound to be sent again
+	FileStatusCompacted = "compacted" // Summary record holding the totals of compacted records
+)
+
+// FailureRecorder is implemented by state managers that keep per-file records
+// and can track failed attempts in addition to completed files
+type FailureRecorder interface {
+	RecordFailure(timestamp int64, filePath string)
+}
+
+// fileRecord is a pending write for one S3 object
+type fileRecord struct {
+	streamID  string
+	timestamp int64
+	bytes     int64
+	status    string
+	attempts  int64
+	updated   int64
+}
+
+// SQLStateManager stores one record per S3 object (key, timestamp, bytes, status, attempts)
+// in SQLite or PostgreSQL. cmd/s3-streamer registers the database/sql drivers (see
+// config.SQLConfig.DriverName).
+type SQLStateManager struct {
+	db           *sql.DB
+	table        string
+	postgres     bool // PostgreSQL uses $N placeholders instead of ?
+	saveInterval time.Duration
+	state        State
+	pending      map[string]*fileRecord
+	mu           sync.RWMutex
+	saveTracker  // Guarded by mu
+	stopCh       chan struct{}
+	doneCh       chan struct{}
+	ctx          context.Context
+}
+
+// NewSQLStateManager opens the database, creates the table if needed and loads totals
+func NewSQLStateManager(sqlConfig config.SQLConfig, saveInterval time.Duration) (*SQLStateManager, error) {
+	db, err := sql.Open(sqlConfig.DriverName(), sqlConfig.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", sqlConfig.Driver, err)
+	}
+
+	ctx := context.Background()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", sqlConfig.Driver, err)
+	}
+
+	m := &SQLStateManager{
+		db:           db,
+		table:        sqlConfig.Table,
+		postgres:     sqlConfig.DriverName() == "pgx",
+		saveInterval: saveInterval,
+		pending:      make(map[string]*fileRecord),
+		saveTracker:  saveTracker{backend: "sql"},
+		stopCh:       make(chan struct{}),
+		doneCh:       make(chan struct{}),
+		ctx:          ctx,
+	}
+
+	if err := m.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := m.load(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load state from database: %w", err)
+	}
+
+	return m, nil
+}
+
+// Start begins the periodic state persistence
+func (m *SQLStateManager) Start() {
+	go m.periodicSave()
+}
+
+// Stop stops the periodic persistence, saves final state and closes the database
+func (m *SQLStateManager) Stop() {
+	close(m.stopCh)
+	<-m.doneCh
+	if err := m.Save(); err != nil {
+		logging.Component("state").Error("Failed to save state to database on shutdown", "error", err)
+	}
+	m.db.Close()
+}
+
+// GetLastTimestamp returns the last processed timestamp
+func (m *SQLStateManager) GetLastTimestamp() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.LastProcessedTimestamp
+}
+
+// GetLastFile returns the last processed file path
+func (m *SQLStateManager) GetLastFile() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.LastProcessedFile
+}
+
+// UpdateProgress records a file as processed
+func (m *SQLStateManager) UpdateProgress(timestamp int64, filePath string, bytesProcessed int64) {
+	m.UpdateStreamProgress("", timestamp, filePath, bytesProcessed)
+}
+
+// UpdateStreamProgress records a file of one stream as processed
+func (m *SQLStateManager) UpdateStreamProgress(streamID string, timestamp int64, filePath string, bytesProcessed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.advance(streamID, timestamp, filePath, bytesProcessed)
+
+	rec := m.record(filePath)
+	rec.streamID = streamID
+	rec.timestamp = timestamp
+	rec.bytes = bytesProcessed
+	rec.status = FileStatusProcessed
+	rec.attempts++
+	rec.updated = m.state.LastUpdated
+}
+
+// GetCheckpoint returns the scan position of one stream
+func (m *SQLStateManager) GetCheckpoint(streamID string) Checkpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.checkpoint(streamID)
+}
+
+// RecordFailure records a failed attempt at a file without advancing progress
+func (m *SQLStateManager) RecordFailure(timestamp int64, filePath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.record(filePath)
+	rec.timestamp = timestamp
+	if rec.status != FileStatusProcessed {
+		rec.status = FileStatusFailed
+	}
+	rec.attempts++
+	rec.updated = time.Now().Unix()
+}
+
+// record returns the pending write for a file, creating it if needed (caller holds mu)
+func (m *SQLStateManager) record(filePath string) *fileRecord {
+	rec, ok := m.pending[filePath]
+	if !ok {
+		rec = &fileRecord{}
+		m.pending[filePath] = rec
+		m.markDirty()
+	}
+	return rec
+}
+
+// GetStats returns current statistics
+func (m *SQLStateManager) GetStats() (filesProcessed, bytesProcessed int64, lastTimestamp int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.TotalFilesProcessed, m.state.TotalBytesProcessed, m.state.LastProcessedTimestamp
+}
+
+// IsProcessed reports whether the file has a processed record (including unsaved updates)
+func (m *SQLStateManager) IsProcessed(filePath string) (bool, error) {
+	m.mu.RLock()
+	rec, ok := m.pending[filePath]
+	m.mu.RUnlock()
+	if ok && rec.status == FileStatusProcessed {
+		return true, nil
+	}
+
+	var status string
+	query := m.rebind(fmt.Sprintf("SELECT status FROM %s WHERE s3_key = ?", m.table))
+	err := m.db.QueryRowContext(m.ctx, query, filePath).Scan(&status)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query file record: %w", err)
+	}
+	return status == FileStatusProcessed, nil
+}
+
+// Save writes pending file records to the database in a single transaction
+func (m *SQLStateManager) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveLocked()
+}
+
+// saveLocked writes pending file records (caller holds mu)
+func (m *SQLStateManager) saveLocked() (err error) {
+	if len(m.pending) == 0 || m.standby {
+		return nil // No changes to save, or on standby
+	}
+	start := time.Now()
+	defer func() { m.observeSave(start, err) }()
+
+	tx, err := m.db.BeginTx(m.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin state transaction: %w", err)
+	}
+
+	// A processed record is never downgraded to failed by a later failed attempt.
+	// Updates without a stream ID or timestamp keep the stored ones.
+	query := m.rebind(fmt.Sprintf(`INSERT INTO %[1]s (s3_key, stream_id, timestamp, bytes, status, attempts, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (s3_key) DO UPDATE SET
+	stream_id = CASE WHEN excluded.stream_id = '' THEN %[1]s.stream_id ELSE excluded.stream_id END,
+	timestamp = CASE WHEN excluded.timestamp = 0 THEN %[1]s.timestamp ELSE excluded.timestamp END,
+	bytes = CASE WHEN excluded.status = '%[2]s' THEN excluded.bytes ELSE %[1]s.bytes END,
+	status = CASE WHEN %[1]s.status = '%[2]s' THEN %[1]s.status ELSE excluded.status END,
+	attempts = %[1]s.attempts + excluded.attempts,
+	updated_at = excluded.updated_at`, m.table, FileStatusProcessed))
+
+	for key, rec := range m.pending {
+		if _, err := tx.ExecContext(m.ctx, query, key, rec.streamID, rec.timestamp, rec.bytes, rec.status, rec.attempts, rec.updated); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to save file record: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit state transaction: %w", err)
+	}
+
+	m.pending = make(map[string]*fileRecord)
+	m.markClean()
+	return nil
+}
+
+// migrate creates the file record and failure tables if they do not exist, and adds the
+// columns missing from tables created by earlier versions
+func (m *SQLStateManager) migrate() error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	s3_key TEXT PRIMARY KEY,
+	stream_id TEXT NOT NULL DEFAULT '',
+	timestamp BIGINT NOT NULL,
+	bytes BIGINT NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	attempts BIGINT NOT NULL DEFAULT 0,
+	updated_at BIGINT NOT NULL
+)`, m.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_timestamp_idx ON %s (timestamp)", m.table, m.table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	s3_key TEXT PRIMARY KEY,
+	stream_id TEXT NOT NULL DEFAULT '',
+	timestamp BIGINT NOT NULL,
+	size BIGINT NOT NULL DEFAULT 0,
+	attempts BIGINT NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	first_failure BIGINT NOT NULL,
+	last_failure BIGINT NOT NULL,
+	next_retry BIGINT NOT NULL DEFAULT 0,
+	quarantined BOOLEAN NOT NULL DEFAULT FALSE,
+	processing_id TEXT NOT NULL DEFAULT ''
+)`, m.failuresTable()),
+	}
+	for _, stmt := range stmts {
+		if _, err := m.db.ExecContext(m.ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create state table: %w", err)
+		}
+	}
+
+	// Columns added since the tables were introduced. SQLite has no ADD COLUMN IF NOT EXISTS,
+	// so an existing column shows up as a duplicate column error.
+	addColumn := "ADD COLUMN"
+	if m.postgres {
+		addColumn = "ADD COLUMN IF NOT EXISTS"
+	}
+	stmt := fmt.Sprintf("ALTER TABLE %s %s processing_id TEXT NOT NULL DEFAULT ''", m.failuresTable(), addColumn)
+	if _, err := m.db.ExecContext(m.ctx, stmt); err != nil && !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+		return fmt.Errorf("failed to upgrade state table: %w", err)
+	}
+	return nil
+}
+
+// load restores totals and the latest processed file, globally and per stream, from the table
+func (m *SQLStateManager) load() error {
+	var files, bytes, lastTimestamp sql.NullInt64
+	query := m.rebind(fmt.Sprintf("SELECT COUNT(*), SUM(bytes), MAX(timestamp) FROM %s WHERE status = ?", m.table))
+	if err := m.db.QueryRowContext(m.ctx, query, FileStatusProcessed).Scan(&files, &bytes, &lastTimestamp); err != nil {
+		return err
+	}
+
+	m.state = State{
+		LastProcessedTimestamp: lastTimestamp.Int64,
+		TotalFilesProcessed:    files.Int64,
+		TotalBytesProcessed:    bytes.Int64,
+		LastUpdated:            time.Now().Unix(),
+	}
+
+	// Totals of records removed by compaction (the summary record keeps the file count in attempts)
+	var compactedFiles, compactedBytes int64
+	query = m.rebind(fmt.Sprintf("SELECT attempts, bytes FROM %s WHERE s3_key = ?", m.table))
+	switch err := m.db.QueryRowContext(m.ctx, query, compactedKey).Scan(&compactedFiles, &compactedBytes); err {
+	case nil:
+		m.state.TotalFilesProcessed += compactedFiles
+		m.state.TotalBytesProcessed += compactedBytes
+	case sql.ErrNoRows:
+	default:
+		return err
+	}
+	if files.Int64 == 0 {
+		return nil
+	}
+
+	query = m.rebind(fmt.Sprintf("SELECT s3_key FROM %s WHERE status = ? ORDER BY timestamp DESC, s3_key DESC LIMIT 1", m.table))
+	if err := m.db.QueryRowContext(m.ctx, query, FileStatusProcessed).Scan(&m.state.LastProcessedFile); err != nil {
+		return err
+	}
+
+	// Per-stream checkpoints
+	query = m.rebind(fmt.Sprintf("SELECT stream_id, MAX(timestamp) FROM %s WHERE status = ? AND stream_id <> '' GROUP BY stream_id", m.table))
+	rows, err := m.db.QueryContext(m.ctx, query, FileStatusProcessed)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	streams := make(map[string]Checkpoint)
+	for rows.Next() {
+		var streamID string
+		var cp Checkpoint
+		if err := rows.Scan(&streamID, &cp.Timestamp); err != nil {
+			return err
+		}
+		streams[streamID] = cp
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	query = m.rebind(fmt.Sprintf("SELECT s3_key FROM %s WHERE status = ? AND stream_id = ? ORDER BY timestamp DESC, s3_key DESC LIMIT 1", m.table))
+	for streamID, cp := range streams {
+		if err := m.db.QueryRowContext(m.ctx, query, FileStatusProcessed, streamID).Scan(&cp.LastFile); err != nil {
+			return err
+		}
+		streams[streamID] = cp
+	}
+	if len(streams) > 0 {
+		m.state.Streams = streams
+	}
+	return nil
+}
+
+// Reload restores totals and checkpoints from the table; unsaved file records are kept
+func (m *SQLStateManager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		return fmt.Errorf("failed to reload state from database: %w", err)
+	}
+	return nil
+}
+
+// rebind converts ? placeholders to $N for PostgreSQL
+func (m *SQLStateManager) rebind(query string) string {
+	if !m.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// periodicSave saves state at regular intervals
+func (m *SQLStateManager) periodicSave() {
+	defer crash.Recover()
+	ticker := time.NewTicker(m.saveInterval)
+	defer ticker.Stop()
+	defer close(m.doneCh)
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Save(); err != nil {
+				// Log error but don't crash
+				logging.Component("state").Error("Failed to save state to database periodically", "error", err)
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
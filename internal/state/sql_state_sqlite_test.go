@@ -0,0 +1,97 @@
+//go:build cgo
+
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TestSQLStateManager_SQLite runs the backend against a real SQLite database, the driver
+// cmd/s3-streamer registers for driver: sqlite
+func TestSQLStateManager_SQLite(t *testing.T) {
+	cfg := config.SQLConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "state.db"), Table: "s3_streamer_files"}
+	manager, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	manager.Start()
+
+	manager.UpdateStreamProgress("logs-bucket/zscaler/", 100, "zscaler/a.gz", 1000)
+	manager.UpdateStreamProgress("logs-bucket/zscaler/", 300, "zscaler/c.gz", 500)
+	manager.UpdateStreamProgress("logs-bucket/umbrella/", 120, "umbrella/e.gz", 10)
+	manager.RecordFailure(200, "zscaler/b.gz")
+	manager.RecordFailure(100, "zscaler/a.gz") // Does not downgrade a processed record
+	manager.BeginFile(InFlightJob{Key: "zscaler/d.gz", StreamID: "logs-bucket/zscaler/", Timestamp: 400, StartedAt: 50})
+	manager.BeginFile(InFlightJob{Key: "zscaler/f.gz", StreamID: "logs-bucket/zscaler/", Timestamp: 500, StartedAt: 60, Pending: true})
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	for key, want := range map[string]bool{"zscaler/a.gz": true, "zscaler/b.gz": false, "zscaler/d.gz": false, "missing.gz": false} {
+		if processed, err := manager.IsProcessed(key); err != nil || processed != want {
+			t.Errorf("Expected IsProcessed(%s) %v, got %v (%v)", key, want, processed, err)
+		}
+	}
+	jobs, err := manager.InFlight()
+	if err != nil {
+		t.Fatalf("InFlight failed: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Key != "zscaler/d.gz" || jobs[0].Pending || jobs[1].Key != "zscaler/f.gz" || !jobs[1].Pending {
+		t.Errorf("Expected d.gz in flight and f.gz pending, got %+v", jobs)
+	}
+
+	failure := FailedFile{Key: "zscaler/b.gz", Timestamp: 200, Attempts: 1, LastError: "timeout", FirstFailure: 10, LastFailure: 10, NextRetry: 70}
+	if err := manager.PutFailure(failure); err != nil {
+		t.Fatalf("PutFailure failed: %v", err)
+	}
+	failure.Attempts, failure.Quarantined, failure.NextRetry = 2, true, 0
+	if err := manager.PutFailure(failure); err != nil {
+		t.Fatalf("PutFailure failed: %v", err)
+	}
+	if got, ok, err := manager.GetFailure("zscaler/b.gz"); err != nil || !ok || got != failure {
+		t.Errorf("Expected %+v, got %+v (%v, %v)", failure, got, ok, err)
+	}
+	manager.Stop()
+
+	// A restart migrates the existing tables and restores totals, checkpoints and the journal
+	restarted, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed on restart: %v", err)
+	}
+	restarted.Start()
+	defer restarted.Stop()
+	files, bytes, ts := restarted.GetStats()
+	if files != 3 || bytes != 1510 || ts != 300 {
+		t.Errorf("Expected 3 files, 1510 bytes, timestamp 300, got %d, %d, %d", files, bytes, ts)
+	}
+	if cp := restarted.GetCheckpoint("logs-bucket/zscaler/"); cp.Timestamp != 300 || cp.LastFile != "zscaler/c.gz" {
+		t.Errorf("Expected zscaler checkpoint 300/zscaler/c.gz, got %+v", cp)
+	}
+	if jobs, err := restarted.InFlight(); err != nil || len(jobs) != 2 {
+		t.Errorf("Expected 2 journal entries after restart, got %+v (%v)", jobs, err)
+	}
+	if failures, err := restarted.Failures(); err != nil || len(failures) != 1 || !failures[0].Quarantined {
+		t.Errorf("Expected the quarantined failure after restart, got %+v (%v)", failures, err)
+	}
+
+	// Compaction keeps the checkpoint records and the totals of the records it deletes
+	restarted.EndFile("zscaler/d.gz")
+	restarted.EndFile("zscaler/f.gz")
+	if _, err := restarted.Compact(-time.Hour); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if err := restarted.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if files, bytes, _ := restarted.GetStats(); files != 3 || bytes != 1510 {
+		t.Errorf("Expected compaction to keep 3 files and 1510 bytes, got %d, %d", files, bytes)
+	}
+	if cp := restarted.GetCheckpoint("logs-bucket/umbrella/"); cp.Timestamp != 120 || cp.LastFile != "umbrella/e.gz" {
+		t.Errorf("Expected umbrella checkpoint kept by compaction, got %+v", cp)
+	}
+}
@@ -0,0 +1,380 @@
+package state
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+// fakeDB is an in-memory stand-in for the file record table, shared by connections with the same DSN
+type fakeDB struct {
+	mu       sync.Mutex
+	records  map[string]fakeRecord
+	failures map[string][]driver.Value // Rows of the failures table by key
+	queries  []string
+}
+
+type fakeRecord struct {
+	timestamp, bytes, attempts, updated int64
+	status, streamID                    string
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("statetest", fakeDriver{})
+}
+
+func newFakeDB(dsn string) *fakeDB {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	db := &fakeDB{records: map[string]fakeRecord{}, failures: map[string][]driver.Value{}}
+	fakeDBs[dsn] = db
+	return db
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	return &fakeConn{db: fakeDBs[dsn]}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.queries = append(s.db.queries, s.query)
+
+	if strings.Contains(s.query, "_failures (s3_key") && strings.HasPrefix(s.query, "INSERT") {
+		s.db.failures[args[0].(string)] = append([]driver.Value(nil), args...)
+		return driver.RowsAffected(1), nil
+	}
+	if strings.HasPrefix(s.query, "DELETE") && strings.Contains(s.query, "_failures") {
+		delete(s.db.failures, args[0].(string))
+		return driver.RowsAffected(1), nil
+	}
+
+	if strings.HasPrefix(s.query, "UPDATE") {
+		for key, rec := range s.db.records {
+			if rec.status != args[2] || rec.timestamp <= args[3].(int64) {
+				continue
+			}
+			if len(args) > 4 && rec.streamID != args[4] {
+				continue
+			}
+			rec.status = args[0].(string)
+			rec.updated = args[1].(int64)
+			s.db.records[key] = rec
+		}
+	}
+
+	if strings.HasPrefix(s.query, "DELETE") {
+		var deleted int64
+		for key, rec := range s.db.records {
+			if rec.updated < args[0].(int64) && !containsValue(args[1:], key) {
+				delete(s.db.records, key)
+				deleted++
+			}
+		}
+		return driver.RowsAffected(deleted), nil
+	}
+
+	if strings.HasPrefix(s.query, "INSERT") && len(args) == 5 {
+		// Compaction summary: key, bytes, status, files, updated
+		rec := s.db.records[args[0].(string)]
+		rec.bytes += args[1].(int64)
+		rec.status = args[2].(string)
+		rec.attempts += args[3].(int64)
+		rec.updated = args[4].(int64)
+		s.db.records[args[0].(string)] = rec
+		return driver.RowsAffected(1), nil
+	}
+
+	if strings.HasPrefix(s.query, "INSERT") {
+		key := args[0].(string)
+		rec, exists := s.db.records[key]
+		if streamID := args[1].(string); streamID != "" {
+			rec.streamID = streamID
+		}
+		if ts := args[2].(int64); ts != 0 {
+			rec.timestamp = ts
+		}
+		if !exists || args[4].(string) == FileStatusProcessed {
+			rec.bytes = args[3].(int64)
+		}
+		if rec.status != FileStatusProcessed {
+			rec.status = args[4].(string)
+		}
+		rec.attempts += args[5].(int64)
+		rec.updated = args[6].(int64)
+		s.db.records[key] = rec
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.queries = append(s.db.queries, s.query)
+
+	switch {
+	case strings.Contains(s.query, "_failures"):
+		rows := &fakeRows{}
+		for key, row := range s.db.failures {
+			if len(args) == 0 || args[0] == key {
+				rows.rows = append(rows.rows, row)
+			}
+		}
+		sort.Slice(rows.rows, func(i, j int) bool { return rows.rows[i][2].(int64) < rows.rows[j][2].(int64) })
+		return rows, nil
+	case strings.HasPrefix(s.query, "SELECT s3_key, stream_id, timestamp, updated_at"):
+		rows := &fakeRows{}
+		for key, rec := range s.db.records {
+			if containsValue(args, rec.status) {
+				rows.rows = append(rows.rows, []driver.Value{key, rec.streamID, rec.timestamp, rec.updated, rec.status})
+			}
+		}
+		sort.Slice(rows.rows, func(i, j int) bool { return rows.rows[i][2].(int64) < rows.rows[j][2].(int64) })
+		return rows, nil
+	case strings.HasPrefix(s.query, "SELECT s3_key, stream_id"):
+		rows := &fakeRows{}
+		for key, rec := range s.db.records {
+			if rec.status == FileStatusCompacted {
+				continue
+			}
+			rows.rows = append(rows.rows, []driver.Value{key, rec.streamID, rec.timestamp, rec.bytes, rec.status, rec.attempts, rec.updated})
+		}
+		sort.Slice(rows.rows, func(i, j int) bool { return rows.rows[i][2].(int64) > rows.rows[j][2].(int64) })
+		if limit := int(args[0].(int64)); len(rows.rows) > limit {
+			rows.rows = rows.rows[:limit]
+		}
+		return rows, nil
+	case strings.HasPrefix(s.query, "SELECT COUNT") && strings.Contains(s.query, "updated_at <"):
+		var count, sum int64
+		for key, rec := range s.db.records {
+			if rec.updated < args[0].(int64) && rec.status == args[1] && !containsValue(args[2:], key) {
+				count++
+				sum += rec.bytes
+			}
+		}
+		return &fakeRows{rows: [][]driver.Value{{count, sum}}}, nil
+	case strings.HasPrefix(s.query, "SELECT COUNT") && strings.Contains(s.query, "status <>"):
+		var count int64
+		for _, rec := range s.db.records {
+			if rec.status != args[0] {
+				count++
+			}
+		}
+		return &fakeRows{rows: [][]driver.Value{{count}}}, nil
+	case strings.HasPrefix(s.query, "SELECT attempts, bytes"):
+		rec, ok := s.db.records[args[0].(string)]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{rows: [][]driver.Value{{rec.attempts, rec.bytes}}}, nil
+	case strings.HasPrefix(s.query, "SELECT COUNT"):
+		var count, sum, max int64
+		for _, rec := range s.db.records {
+			if rec.status != args[0] {
+				continue
+			}
+			if len(args) > 1 && rec.timestamp <= args[1].(int64) {
+				continue // Rewind window
+			}
+			if len(args) > 2 && rec.streamID != args[2] {
+				continue
+			}
+			count++
+			sum += rec.bytes
+			if rec.timestamp > max {
+				max = rec.timestamp
+			}
+		}
+		if !strings.Contains(s.query, "MAX") {
+			return &fakeRows{rows: [][]driver.Value{{count, sum}}}, nil
+		}
+		return &fakeRows{rows: [][]driver.Value{{count, sum, max}}}, nil
+	case strings.HasPrefix(s.query, "SELECT s3_key"):
+		var last string
+		var lastTS int64
+		for key, rec := range s.db.records {
+			if len(args) > 1 && rec.streamID != args[1] {
+				continue
+			}
+			if rec.status == args[0] && (rec.timestamp > lastTS || (rec.timestamp == lastTS && key > last)) {
+				last, lastTS = key, rec.timestamp
+			}
+		}
+		return &fakeRows{rows: [][]driver.Value{{last}}}, nil
+	case strings.HasPrefix(s.query, "SELECT stream_id"):
+		max := map[string]int64{}
+		for _, rec := range s.db.records {
+			if rec.status == args[0] && rec.streamID != "" && rec.timestamp > max[rec.streamID] {
+				max[rec.streamID] = rec.timestamp
+			}
+		}
+		rows := &fakeRows{}
+		for streamID, ts := range max {
+			rows.rows = append(rows.rows, []driver.Value{streamID, ts})
+		}
+		return rows, nil
+	case strings.HasPrefix(s.query, "SELECT status"):
+		rec, ok := s.db.records[args[0].(string)]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{rows: [][]driver.Value{{rec.status}}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+func containsValue(values []driver.Value, key string) bool {
+	for _, v := range values {
+		if v == key {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeRows struct{ rows [][]driver.Value }
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"status"}
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLStateManager_RoundTrip(t *testing.T) {
+	db := newFakeDB("roundtrip")
+	cfg := config.SQLConfig{Driver: "statetest", DSN: "roundtrip", Table: "s3_streamer_files"}
+
+	manager, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	if !strings.HasPrefix(db.queries[0], "CREATE TABLE IF NOT EXISTS s3_streamer_files") {
+		t.Errorf("Expected table creation first, got %q", db.queries[0])
+	}
+
+	manager.UpdateProgress(100, "logs/a.gz", 1000)
+	manager.RecordFailure(200, "logs/b.gz")
+	manager.UpdateProgress(150, "logs/c.gz", 500)
+
+	if processed, _ := manager.IsProcessed("logs/a.gz"); !processed {
+		t.Error("Expected unsaved processed file to be reported as processed")
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if rec := db.records["logs/b.gz"]; rec.status != FileStatusFailed || rec.attempts != 1 {
+		t.Errorf("Expected failed record with 1 attempt, got %+v", rec)
+	}
+	if processed, _ := manager.IsProcessed("logs/b.gz"); processed {
+		t.Error("Expected failed file not to be reported as processed")
+	}
+	if processed, _ := manager.IsProcessed("logs/missing.gz"); processed {
+		t.Error("Expected unknown file not to be reported as processed")
+	}
+
+	manager.UpdateStreamProgress("logs-bucket/zscaler/", 300, "zscaler/d.gz", 10)
+	manager.UpdateStreamProgress("logs-bucket/umbrella/", 120, "umbrella/e.gz", 10)
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A restart restores totals and stream checkpoints from the records
+	restarted, err := NewSQLStateManager(cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+	files, bytes, ts := restarted.GetStats()
+	if files != 4 || bytes != 1520 || ts != 300 {
+		t.Errorf("Expected 4 files, 1520 bytes, timestamp 300, got %d, %d, %d", files, bytes, ts)
+	}
+	if last := restarted.GetLastFile(); last != "zscaler/d.gz" {
+		t.Errorf("Expected last file zscaler/d.gz, got %s", last)
+	}
+	if cp := restarted.GetCheckpoint("logs-bucket/umbrella/"); cp.Timestamp != 120 || cp.LastFile != "umbrella/e.gz" {
+		t.Errorf("Expected umbrella checkpoint 120/umbrella/e.gz, got %+v", cp)
+	}
+}
+
+func TestSQLStateManager_FailureDoesNotDowngrade(t *testing.T) {
+	db := newFakeDB("downgrade")
+	manager, err := NewSQLStateManager(config.SQLConfig{Driver: "statetest", DSN: "downgrade", Table: "files"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+
+	manager.UpdateProgress(100, "logs/a.gz", 1000)
+	manager.RecordFailure(100, "logs/a.gz")
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if rec := db.records["logs/a.gz"]; rec.status != FileStatusProcessed || rec.attempts != 2 {
+		t.Errorf("Expected processed record with 2 attempts, got %+v", rec)
+	}
+}
+
+func TestSQLStateManager_Rebind(t *testing.T) {
+	m := &SQLStateManager{postgres: true}
+	if got := m.rebind("SELECT a FROM t WHERE b = ? AND c = ?"); got != "SELECT a FROM t WHERE b = $1 AND c = $2" {
+		t.Errorf("Unexpected rebind result %q", got)
+	}
+
+	m.postgres = false
+	if got := m.rebind("WHERE b = ?"); got != "WHERE b = ?" {
+		t.Errorf("Expected SQLite query unchanged, got %q", got)
+	}
+}
+
+func TestNewSQLStateManager_UnknownDriver(t *testing.T) {
+	if _, err := NewSQLStateManager(config.SQLConfig{Driver: "nope", DSN: "x", Table: "t"}, time.Hour); err == nil {
+		t.Error("Expected error for unregistered driver")
+	}
+}
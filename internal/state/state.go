@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
 )
 
@@ -17,6 +18,101 @@ type State struct {
 	TotalFilesProcessed    int64  `json:"total_files_processed"`
 	TotalBytesProcessed    int64  `json:"total_bytes_processed"`
 	LastUpdated            int64  `json:"last_updated"`
+
+	// Incremented by every save; a writer whose last known revision is stale is refused
+	Revision int64 `json:"revision,omitempty"`
+
+	// Files started but not finished (see Journal) and checkpoints within files that were
+	// only partially delivered, keyed by S3 key
+	Offsets map[string]FileOffset `json:"offsets,omitempty"`
+
+	// Independent scan checkpoints keyed by stream ID (bucket/prefix)
+	Streams map[string]Checkpoint `json:"streams,omitempty"`
+
+	// Most recent checkpoint rewinds, oldest first
+	Rewinds []RewindRecord `json:"rewinds,omitempty"`
+
+	// Files whose processing failed, waiting for a retry or quarantined (see RetryTracker), keyed by S3 key
+	Failed map[string]FailedFile `json:"failed,omitempty"`
+}
+
+// Checkpoint is the scan position of one stream
+type Checkpoint struct {
+	Timestamp int64  `json:"timestamp"`
+	LastFile  string `json:"last_file"`
+}
+
+// checkpoint returns the position of a stream. The empty stream ID is the global position;
+// state written before per-stream checkpoints existed is treated as the position of every stream.
+func (s *State) checkpoint(streamID string) Checkpoint {
+	if cp, ok := s.Streams[streamID]; ok {
+		return cp
+	}
+	if streamID == "" || len(s.Streams) == 0 {
+		return Checkpoint{Timestamp: s.LastProcessedTimestamp, LastFile: s.LastProcessedFile}
+	}
+	return Checkpoint{}
+}
+
+// advance records a processed file for a stream and in the global totals
+func (s *State) advance(streamID string, timestamp int64, filePath string, bytesProcessed int64) {
+	if timestamp > s.LastProcessedTimestamp {
+		s.LastProcessedTimestamp = timestamp
+	}
+	s.LastProcessedFile = filePath
+	s.TotalFilesProcessed++
+	s.TotalBytesProcessed += bytesProcessed
+	s.LastUpdated = time.Now().Unix()
+	delete(s.Offsets, filePath)
+
+	if streamID == "" {
+		return
+	}
+	if s.Streams == nil {
+		s.Streams = make(map[string]Checkpoint)
+	}
+	cp := s.Streams[streamID]
+	if timestamp > cp.Timestamp {
+		cp.Timestamp = timestamp
+	}
+	cp.LastFile = filePath
+	s.Streams[streamID] = cp
+}
+
+// FileOffset is a resume point within a file
+type FileOffset struct {
+	Lines      int64 `json:"lines"`                // Lines of the file (including filtered ones) before the resume point
+	Bytes      int64 `json:"bytes"`                // Byte offset of the resume point in the (decompressed) content
+	Sent       int64 `json:"sent"`                 // Lines handed to the sender before the resume point
+	Compressed bool  `json:"compressed"`           // The object is gzipped, so Bytes cannot be used for a ranged GET
+	UpdatedAt  int64 `json:"updated_at,omitempty"` // When the resume point was saved; compaction drops stale offsets
+
+	// Set while the file is in flight (see Journal), so it can be processed again after a crash
+	StreamID  string `json:"stream_id,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	StartedAt int64  `json:"started_at,omitempty"`
+	Pending   bool   `json:"pending,omitempty"` // Queued, not started, when the previous run stopped
+}
+
+// OffsetTracker is implemented by state managers that can checkpoint progress within a file.
+// Offsets are discarded once UpdateProgress records the file as processed.
+type OffsetTracker interface {
+	GetOffset(filePath string) (FileOffset, bool)
+	UpdateOffset(filePath string, offset FileOffset)
+}
+
+// Reloader is implemented by state managers backed by shared storage. Reload replaces the
+// in-memory position with the stored one, picking up checkpoints saved by another replica.
+type Reloader interface {
+	Reload() error
+}
+
+// SharedWriter is implemented by state managers that only let one instance save unless told
+// that several write at once, as with sharding (see RedisStateManager.SetSharedWriters and
+// KVStateManager.SetSharedWriters)
+type SharedWriter interface {
+	SetSharedWriters()
 }
 
 // StateManager interface for state persistence
@@ -26,6 +122,10 @@ type StateManager interface {
 	GetLastTimestamp() int64
 	GetLastFile() string
 	UpdateProgress(timestamp int64, filePath string, bytesProcessed int64)
+	// GetCheckpoint returns the scan position of one stream ("" for the global position)
+	GetCheckpoint(streamID string) Checkpoint
+	// UpdateStreamProgress records a processed file for one stream
+	UpdateStreamProgress(streamID string, timestamp int64, filePath string, bytesProcessed int64)
 	GetStats() (filesProcessed, bytesProcessed int64, lastTimestamp int64)
 	Save() error
 }
@@ -35,8 +135,9 @@ type Manager struct {
 	filePath     string
 	saveInterval time.Duration
 	state        State
+	revision     int64 // Revision of the state file last loaded or written
 	mu           sync.RWMutex
-	dirty        bool
+	saveTracker  // Guarded by mu
 	stopCh       chan struct{}
 	doneCh       chan struct{}
 }
@@ -46,6 +147,7 @@ func NewManager(filePath string, saveInterval time.Duration) (*Manager, error) {
 	m := &Manager{
 		filePath:     filePath,
 		saveInterval: saveInterval,
+		saveTracker:  saveTracker{backend: "file"},
 		stopCh:       make(chan struct{}),
 		doneCh:       make(chan struct{}),
 	}
@@ -92,19 +194,42 @@ func (m *Manager) GetLastFile() string {
 	return m.state.LastProcessedFile
 }
 
-// UpdateProgress updates the processing progress
+// UpdateProgress updates the global processing progress
 func (m *Manager) UpdateProgress(timestamp int64, filePath string, bytesProcessed int64) {
+	m.UpdateStreamProgress("", timestamp, filePath, bytesProcessed)
+}
+
+// UpdateStreamProgress updates the processing progress of one stream
+func (m *Manager) UpdateStreamProgress(streamID string, timestamp int64, filePath string, bytesProcessed int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if timestamp > m.state.LastProcessedTimestamp {
-		m.state.LastProcessedTimestamp = timestamp
-	}
-	m.state.LastProcessedFile = filePath
-	m.state.TotalFilesProcessed++
-	m.state.TotalBytesProcessed += bytesProcessed
-	m.state.LastUpdated = time.Now().Unix()
-	m.dirty = true
+	m.state.advance(streamID, timestamp, filePath, bytesProcessed)
+	m.markDirty()
+}
+
+// GetCheckpoint returns the scan position of one stream
+func (m *Manager) GetCheckpoint(streamID string) Checkpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.checkpoint(streamID)
+}
+
+// GetOffset returns the resume point recorded for a partially delivered file
+func (m *Manager) GetOffset(filePath string) (FileOffset, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	offset, ok := m.state.Offsets[filePath]
+	return offset, ok
+}
+
+// UpdateOffset records how far delivery of a file has progressed
+func (m *Manager) UpdateOffset(filePath string, offset FileOffset) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.setOffset(filePath, offset)
+	m.markDirty()
 }
 
 // GetStats returns current statistics
@@ -115,14 +240,32 @@ func (m *Manager) GetStats() (filesProcessed, bytesProcessed int64, lastTimestam
 }
 
 // Save persists the current state to disk
-func (m *Manager) Save() error {
+func (m *Manager) Save() (err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if !m.dirty {
-		return nil // No changes to save
+		return nil // No changes to save, or on standby
+	}
+	start := time.Now()
+	defer func() { m.observeSave(start, err) }()
+
+	// The lock makes the revision check and the write atomic with respect to other processes
+	unlock, err := lockFile(m.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stored, err := os.ReadFile(m.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := checkRevision(stored, m.revision); err != nil {
+		return err
 	}
 
+	m.state.Revision = m.revision + 1
 	data, err := json.MarshalIndent(m.state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
@@ -138,7 +281,8 @@ func (m *Manager) Save() error {
 		return fmt.Errorf("failed to rename state file: %w", err)
 	}
 
-	m.dirty = false
+	m.revision = m.state.Revision
+	m.markClean()
 	return nil
 }
 
@@ -152,12 +296,14 @@ func (m *Manager) load() error {
 	if err := json.Unmarshal(data, &m.state); err != nil {
 		return fmt.Errorf("failed to unmarshal state: %w", err)
 	}
+	m.revision = m.state.Revision
 
 	return nil
 }
 
 // periodicSave saves state at regular intervals
 func (m *Manager) periodicSave() {
+	defer crash.Recover()
 	ticker := time.NewTicker(m.saveInterval)
 	defer ticker.Stop()
 	defer close(m.doneCh)
@@ -167,7 +313,7 @@ func (m *Manager) periodicSave() {
 		case <-ticker.C:
 			if err := m.Save(); err != nil {
 				// Log error but don't crash
-				logging.GetDefaultLogger().Error("Failed to save state periodically", "error", err)
+				logging.Component("state").Error("Failed to save state periodically", "error", err)
 			}
 		case <-m.stopCh:
 			return
@@ -2,6 +2,7 @@ package state
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -236,6 +237,98 @@ func TestManager_Save(t *testing.T) {
 	}
 }
 
+func TestManager_StreamCheckpoints(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	manager, err := NewManager(filePath, 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	// A fast stream must not move the checkpoint of a stalled one
+	manager.UpdateStreamProgress("bucket/fast/", 2000, "fast/2.gz", 10)
+	manager.UpdateStreamProgress("bucket/slow/", 1000, "slow/1.gz", 10)
+	manager.UpdateStreamProgress("bucket/fast/", 3000, "fast/3.gz", 10)
+
+	if cp := manager.GetCheckpoint("bucket/slow/"); cp.Timestamp != 1000 || cp.LastFile != "slow/1.gz" {
+		t.Errorf("Expected slow checkpoint 1000/slow/1.gz, got %+v", cp)
+	}
+	if cp := manager.GetCheckpoint("bucket/fast/"); cp.Timestamp != 3000 || cp.LastFile != "fast/3.gz" {
+		t.Errorf("Expected fast checkpoint 3000/fast/3.gz, got %+v", cp)
+	}
+	if cp := manager.GetCheckpoint("bucket/new/"); cp.Timestamp != 0 {
+		t.Errorf("Expected empty checkpoint for new stream, got %+v", cp)
+	}
+	if ts := manager.GetLastTimestamp(); ts != 3000 {
+		t.Errorf("Expected global timestamp 3000, got %d", ts)
+	}
+
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	reloaded, err := NewManager(filePath, 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if cp := reloaded.GetCheckpoint("bucket/slow/"); cp.Timestamp != 1000 {
+		t.Errorf("Expected slow checkpoint to survive reload, got %+v", cp)
+	}
+}
+
+func TestManager_LegacyCheckpoint(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	legacy := `{"last_processed_timestamp": 1500, "last_processed_file": "logs/old.gz"}`
+	if err := os.WriteFile(filePath, []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	manager, err := NewManager(filePath, 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	// State from before per-stream checkpoints applies to the stream that wrote it
+	if cp := manager.GetCheckpoint("bucket/logs/"); cp.Timestamp != 1500 || cp.LastFile != "logs/old.gz" {
+		t.Errorf("Expected legacy checkpoint 1500/logs/old.gz, got %+v", cp)
+	}
+}
+
+func TestManager_Offsets(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	manager, err := NewManager(filePath, 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	if _, ok := manager.GetOffset("big.gz"); ok {
+		t.Error("Expected no offset for unknown file")
+	}
+
+	offset := FileOffset{Lines: 5000, Bytes: 1 << 20, Sent: 4000, Compressed: true}
+	manager.UpdateOffset("big.gz", offset)
+	manager.UpdateOffset("other.gz", FileOffset{Lines: 10})
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Offsets survive a restart
+	reloaded, err := NewManager(filePath, 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if got, ok := reloaded.GetOffset("big.gz"); !ok || got != offset {
+		t.Errorf("Expected offset %+v after reload, got %+v", offset, got)
+	}
+
+	// Completing the file discards its offset
+	reloaded.UpdateProgress(100, "big.gz", 1<<30)
+	if _, ok := reloaded.GetOffset("big.gz"); ok {
+		t.Error("Expected offset to be cleared once the file is processed")
+	}
+	if _, ok := reloaded.GetOffset("other.gz"); !ok {
+		t.Error("Expected offsets of other files to be kept")
+	}
+}
+
 func TestManager_StartStop(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "test_startstop.json")
@@ -263,3 +356,75 @@ func TestManager_StartStop(t *testing.T) {
 		t.Fatal("State file was not created by periodic save")
 	}
 }
+
+func TestManager_ConflictingWriters(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	first, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	second, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	first.UpdateProgress(100, "logs/a.gz", 10)
+	if err := first.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// The second instance never saw the first one's write
+	second.UpdateProgress(50, "logs/old.gz", 10)
+	if err := second.Save(); !errors.Is(err, ErrConflictingWriter) {
+		t.Fatalf("Expected ErrConflictingWriter, got %v", err)
+	}
+
+	reloaded, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if ts := reloaded.GetLastTimestamp(); ts != 100 {
+		t.Errorf("Expected the first instance's checkpoint to be kept, got %d", ts)
+	}
+
+	// The first instance keeps writing
+	first.UpdateProgress(200, "logs/b.gz", 10)
+	if err := first.Save(); err != nil {
+		t.Errorf("Expected the last writer to keep saving, got %v", err)
+	}
+}
+
+func TestManager_Standby(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.json")
+	leader, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	standby, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	standby.SetStandby(true)
+
+	leader.UpdateProgress(100, "logs/a.gz", 10)
+	if err := leader.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A replica on standby saves nothing, instead of failing with ErrConflictingWriter
+	standby.UpdateProgress(50, "logs/old.gz", 10)
+	if status := standby.Status(); !status.DirtySince.IsZero() {
+		t.Errorf("Expected no unsaved changes on standby, got %+v", status)
+	}
+	if err := standby.Save(); err != nil {
+		t.Fatalf("Expected no save on standby, got %v", err)
+	}
+
+	reloaded, err := NewManager(filePath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if ts := reloaded.GetLastTimestamp(); ts != 100 {
+		t.Errorf("Expected the leader's checkpoint to be kept, got %d", ts)
+	}
+}
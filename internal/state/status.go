@@ -0,0 +1,219 @@
+package state
+
+import (
+	"time"
+)
+
+// SaveObserver receives the outcome of every save that wrote changes (e.g. to record metrics).
+// It is called with the state manager's lock held and must not call back into the manager.
+type SaveObserver func(backend string, duration time.Duration, err error)
+
+// Status describes how well a state manager keeps its storage up to date
+type Status struct {
+	Backend           string    // file, redis, sql, consul or etcd
+	CheckpointUpdated time.Time // When progress was last recorded (zero if never)
+	DirtySince        time.Time // When the oldest unsaved change was made (zero if everything is saved)
+	LastSave          time.Time // Last successful save (zero if none since start)
+	SaveFailures      int64     // Saves failed in a row
+}
+
+// CheckpointAge returns how long the checkpoint has not advanced
+func (s Status) CheckpointAge(now time.Time) time.Duration {
+	if s.CheckpointUpdated.IsZero() {
+		return 0
+	}
+	return now.Sub(s.CheckpointUpdated)
+}
+
+// DirtyFor returns how long changes have been waiting to be saved
+func (s Status) DirtyFor(now time.Time) time.Duration {
+	if s.DirtySince.IsZero() {
+		return 0
+	}
+	return now.Sub(s.DirtySince)
+}
+
+// Instrumented is implemented by state managers that report save outcomes and their status
+type Instrumented interface {
+	SetSaveObserver(fn SaveObserver)
+	Status() Status
+}
+
+// saveTracker records unsaved changes and save outcomes. It is embedded in the state
+// managers and guarded by their mutex.
+type saveTracker struct {
+	backend    string
+	dirty      bool
+	dirtySince time.Time
+	lastSave   time.Time
+	failures   int64
+	observer   SaveObserver
+	standby    bool // Another replica owns the stored state (see Standby)
+}
+
+// markDirty records an unsaved change; changes made on standby are never saved
+func (t *saveTracker) markDirty() {
+	if !t.dirty && !t.standby {
+		t.dirty = true
+		t.dirtySince = time.Now()
+	}
+}
+
+// markClean records that every change was saved or discarded
+func (t *saveTracker) markClean() {
+	t.dirty = false
+	t.dirtySince = time.Time{}
+}
+
+// setStandby stops or resumes saving, discarding unsaved changes when saving stops
+func (t *saveTracker) setStandby(standby bool) {
+	t.standby = standby
+	if standby {
+		t.markClean()
+	}
+}
+
+// observeSave records the outcome of a save started at start
+func (t *saveTracker) observeSave(start time.Time, err error) {
+	if err == nil {
+		t.lastSave = time.Now()
+		t.failures = 0
+	} else {
+		t.failures++
+	}
+	if t.observer != nil {
+		t.observer(t.backend, time.Since(start), err)
+	}
+}
+
+// status returns the tracked part of the status; lastUpdated is the state's LastUpdated
+func (t *saveTracker) status(lastUpdated int64) Status {
+	s := Status{
+		Backend:      t.backend,
+		DirtySince:   t.dirtySince,
+		LastSave:     t.lastSave,
+		SaveFailures: t.failures,
+	}
+	if lastUpdated > 0 {
+		s.CheckpointUpdated = time.Unix(lastUpdated, 0)
+	}
+	return s
+}
+
+// Standby is implemented by state managers backed by shared storage that several replicas
+// open while only the leader writes it (see leader.Elector). On standby a manager saves
+// nothing, so a replica that does not lead neither overwrites the leader's progress nor
+// fails its saves with ErrConflictingWriter; its in-memory changes are discarded. The next
+// leader reloads the stored state before leaving standby.
+type Standby interface {
+	SetStandby(standby bool)
+}
+
+// ReportStatus passes the status of a state manager to observe every interval until stop is closed
+func ReportStatus(s Instrumented, interval time.Duration, stop <-chan struct{}, observe func(Status)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			observe(s.Status())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SetSaveObserver sets the function receiving save outcomes
+func (m *Manager) SetSaveObserver(fn SaveObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = fn
+}
+
+// Status returns the persistence status
+func (m *Manager) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status(m.state.LastUpdated)
+}
+
+// SetSaveObserver sets the function receiving save outcomes
+func (m *RedisStateManager) SetSaveObserver(fn SaveObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = fn
+}
+
+// Status returns the persistence status
+func (m *RedisStateManager) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status(m.state.LastUpdated)
+}
+
+// SetSaveObserver sets the function receiving save outcomes
+func (m *KVStateManager) SetSaveObserver(fn SaveObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = fn
+}
+
+// Status returns the persistence status
+func (m *KVStateManager) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status(m.state.LastUpdated)
+}
+
+// SetSaveObserver sets the function receiving save outcomes
+func (m *SQLStateManager) SetSaveObserver(fn SaveObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = fn
+}
+
+// Status returns the persistence status
+func (m *SQLStateManager) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status(m.state.LastUpdated)
+}
+
+// SetStandby stops or resumes saving (see Standby)
+func (m *Manager) SetStandby(standby bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setStandby(standby)
+}
+
+// SetStandby stops or resumes saving (see Standby)
+func (m *RedisStateManager) SetStandby(standby bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setStandby(standby)
+	if standby {
+		m.processed = nil
+		m.resetEdits()
+	}
+}
+
+// SetStandby stops or resumes saving (see Standby)
+func (m *KVStateManager) SetStandby(standby bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setStandby(standby)
+	if standby {
+		m.resetEdits()
+	}
+}
+
+// SetStandby stops or resumes saving (see Standby)
+func (m *SQLStateManager) SetStandby(standby bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setStandby(standby)
+	if standby {
+		m.pending = make(map[string]*fileRecord)
+	}
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/config"
+)
+
+func TestManager_Status(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := NewManager(filepath.Join(dir, "state", "state.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	type save struct {
+		backend string
+		err     error
+	}
+	var saves []save
+	manager.SetSaveObserver(func(backend string, duration time.Duration, err error) {
+		saves = append(saves, save{backend, err})
+	})
+
+	if status := manager.Status(); !status.DirtySince.IsZero() || status.Backend != "file" {
+		t.Errorf("Expected a clean file backend, got %+v", status)
+	}
+
+	manager.UpdateProgress(100, "logs/100.gz", 10)
+	status := manager.Status()
+	if status.DirtySince.IsZero() || status.CheckpointUpdated.IsZero() {
+		t.Errorf("Expected unsaved changes and an updated checkpoint, got %+v", status)
+	}
+
+	// The state directory does not exist yet, so the save fails and the changes stay unsaved
+	if err := manager.Save(); err == nil {
+		t.Fatal("Expected save to fail")
+	}
+	if status := manager.Status(); status.SaveFailures != 1 || status.DirtySince.IsZero() {
+		t.Errorf("Expected 1 failure with changes still unsaved, got %+v", status)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "state"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if status := manager.Status(); status.SaveFailures != 0 || !status.DirtySince.IsZero() || status.LastSave.IsZero() {
+		t.Errorf("Expected a clean status after saving, got %+v", status)
+	}
+
+	// A save without changes is not observed
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if len(saves) != 2 || saves[0].err == nil || saves[1].err != nil || saves[1].backend != "file" {
+		t.Errorf("Expected a failed and a successful file save, got %+v", saves)
+	}
+}
+
+func TestSQLStateManager_Status(t *testing.T) {
+	newFakeDB("status")
+	manager, err := NewSQLStateManager(config.SQLConfig{Driver: "statetest", DSN: "status", Table: "s3_streamer_files"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLStateManager failed: %v", err)
+	}
+
+	var observed int
+	manager.SetSaveObserver(func(backend string, duration time.Duration, err error) {
+		if backend == "sql" && err == nil {
+			observed++
+		}
+	})
+
+	manager.RecordFailure(100, "logs/100.gz")
+	if manager.Status().DirtySince.IsZero() {
+		t.Error("Expected a pending record to be reported as unsaved")
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if !manager.Status().DirtySince.IsZero() || observed != 1 {
+		t.Errorf("Expected 1 observed save and no unsaved changes, got %d, %+v", observed, manager.Status())
+	}
+}
+
+func TestStatus_Durations(t *testing.T) {
+	now := time.Now()
+	status := Status{CheckpointUpdated: now.Add(-time.Minute), DirtySince: now.Add(-time.Second)}
+	if status.CheckpointAge(now) != time.Minute || status.DirtyFor(now) != time.Second {
+		t.Errorf("Expected 1m and 1s, got %v and %v", status.CheckpointAge(now), status.DirtyFor(now))
+	}
+	if (Status{}).CheckpointAge(now) != 0 || (Status{}).DirtyFor(now) != 0 {
+		t.Error("Expected zero durations for an empty status")
+	}
+}
@@ -0,0 +1,51 @@
+// Package systemd implements the parts of the sd_notify protocol the streamer uses:
+// readiness, shutdown and watchdog keep-alives. Outside a systemd service with Type=notify
+// (NOTIFY_SOCKET unset) every notification is a no-op.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notification states (see sd_notify(3))
+const (
+	Ready    = "READY=1"    // Initialization finished
+	Stopping = "STOPPING=1" // Shutdown started
+	Watchdog = "WATCHDOG=1" // Keep-alive for WatchdogSec=
+)
+
+// Notify sends state to the service manager. It reports false, without error, when the
+// process was not started with a notification socket.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading "@" names an abstract socket, which the net package handles on Linux
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notification socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify service manager: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the service's WatchdogSec=, or 0 when the watchdog is disabled
+// or meant for another process
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,121 @@
+package systemd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	sent, err := Notify(Ready)
+	if err != nil || !sent {
+		t.Fatalf("Expected the notification to be sent, got %v, %v", sent, err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != Ready {
+		t.Errorf("Expected %q, got %q", Ready, got)
+	}
+}
+
+func TestNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Errorf("Expected a no-op without NOTIFY_SOCKET, got %v, %v", sent, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", strconv.Itoa(os.Getpid()), 30 * time.Second},
+		{"30000000", "1", 0},
+		{"invalid", "", 0},
+		{"0", "", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if got := WatchdogInterval(); got != tt.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: expected %v, got %v", tt.usec, tt.pid, tt.want, got)
+		}
+	}
+}
+
+func TestKeepAlive_WithholdsWhileHung(t *testing.T) {
+	var mu sync.Mutex
+	hung := false
+	pings := 0
+	k := NewKeepAlive(20*time.Millisecond, func(time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if hung {
+			return errors.New("scanner heartbeat is stale")
+		}
+		return nil
+	})
+	k.notify = func(state string) (bool, error) {
+		if state != Watchdog {
+			t.Errorf("Expected %q, got %q", Watchdog, state)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		pings++
+		return true, nil
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		k.Run(stop)
+		close(done)
+	}()
+
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return pings
+	}
+	time.Sleep(50 * time.Millisecond)
+	if count() == 0 {
+		t.Fatal("Expected keep-alives while alive")
+	}
+
+	mu.Lock()
+	hung = true
+	mu.Unlock()
+	time.Sleep(15 * time.Millisecond)
+	before := count()
+	time.Sleep(50 * time.Millisecond)
+	if after := count(); after != before {
+		t.Errorf("Expected no keep-alives while hung, got %d more", after-before)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after stop")
+	}
+}
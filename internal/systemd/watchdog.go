@@ -0,0 +1,53 @@
+package systemd
+
+import (
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// KeepAlive sends watchdog keep-alives while the process is making progress. When alive
+// reports an error, the keep-alives stop and the service manager restarts the service once
+// WatchdogSec= passes without one.
+type KeepAlive struct {
+	interval time.Duration
+	alive    func(now time.Time) error
+	notify   func(state string) (bool, error) // Notify, replaced in tests
+}
+
+// NewKeepAlive creates a keep-alive for a watchdog of the given interval (see
+// WatchdogInterval). alive reports why the process is hung, or nil.
+func NewKeepAlive(interval time.Duration, alive func(now time.Time) error) *KeepAlive {
+	return &KeepAlive{interval: interval, alive: alive, notify: Notify}
+}
+
+// Run pings at half the watchdog interval until stop is closed
+func (k *KeepAlive) Run(stop <-chan struct{}) {
+	logger := logging.Component("systemd")
+	ticker := time.NewTicker(k.interval / 2)
+	defer ticker.Stop()
+
+	hung := false
+	for {
+		if err := k.alive(time.Now()); err != nil {
+			if !hung {
+				logger.Error("Withholding watchdog keep-alives; the service manager will restart the streamer", "error", err)
+				hung = true
+			}
+		} else {
+			if hung {
+				logger.Info("Resumed watchdog keep-alives")
+				hung = false
+			}
+			if _, err := k.notify(Watchdog); err != nil {
+				logger.Warn("Failed to send watchdog keep-alive", "error", err)
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
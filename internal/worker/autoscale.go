@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// AutoscalePolicy bounds and tunes the worker autoscaler
+type AutoscalePolicy struct {
+	MinWorkers        int           // Fewest workers kept running
+	MaxWorkers        int           // Most workers run at once
+	Interval          time.Duration // How often the signals are sampled
+	QueueHighWater    float64       // Job queue fill (0-1) at which a worker is added
+	LagHighWater      time.Duration // Processing lag at which a worker is added
+	BufferHighWater   float64       // HTTP buffer fill (0-1) at which a worker is removed
+	ScaleDownCooldown time.Duration // Minimum time between removing workers
+}
+
+// autoscaleSample is one reading of the signals driving the autoscaler
+type autoscaleSample struct {
+	queueFill  float64       // Fraction of the job queue in use
+	lag        time.Duration // Age of the newest processed file (0 if unknown)
+	bufferFill float64       // Fraction of the HTTP line buffer in use
+}
+
+// decide returns the worker count the sample calls for. Delivery is the bottleneck when the
+// HTTP buffer is filling up, so workers are removed then even if files are waiting: more
+// downloads would only block on the buffer. Otherwise workers are added while files queue
+// up or processing falls behind, and removed once the queue has drained and lag is low.
+func (p AutoscalePolicy) decide(current int, s autoscaleSample, canScaleDown bool) int {
+	target := current
+	switch {
+	case p.BufferHighWater > 0 && s.bufferFill >= p.BufferHighWater:
+		if canScaleDown {
+			target--
+		}
+	case s.queueFill >= p.QueueHighWater || (p.LagHighWater > 0 && s.lag >= p.LagHighWater):
+		target++
+	case s.queueFill == 0 && (p.LagHighWater <= 0 || s.lag < p.LagHighWater/2):
+		if canScaleDown {
+			target--
+		}
+	}
+	return max(p.MinWorkers, min(target, p.MaxWorkers))
+}
+
+// SetAutoscalePolicy lets the pool grow and shrink its workers between the policy's bounds
+// instead of running a fixed number. The pool starts with its configured worker count,
+// clamped to the bounds. Call before Start.
+func (hp *HTTPPool) SetAutoscalePolicy(policy AutoscalePolicy) {
+	if policy.MinWorkers < 1 {
+		policy.MinWorkers = 1
+	}
+	if policy.MaxWorkers < policy.MinWorkers {
+		policy.MaxWorkers = policy.MinWorkers
+	}
+	hp.autoscale = &policy
+	hp.workerCount = max(policy.MinWorkers, min(hp.workerCount, policy.MaxWorkers))
+}
+
+// SetWorkerCount changes the number of workers while the pool runs. Retired workers
+// finish their current file first. With autoscaling, n is clamped to the policy's bounds
+// and the autoscaler carries on from there.
+func (hp *HTTPPool) SetWorkerCount(n int) {
+	if hp.autoscale != nil {
+		n = max(hp.autoscale.MinWorkers, min(n, hp.autoscale.MaxWorkers))
+	}
+	hp.resize(max(n, 1))
+}
+
+// autoscaleLoop samples the signals and resizes the pool until it stops
+func (hp *HTTPPool) autoscaleLoop() {
+	ticker := time.NewTicker(hp.autoscale.Interval)
+	defer ticker.Stop()
+
+	var lastScaleDown time.Time
+	for {
+		select {
+		case <-ticker.C:
+			current := hp.GetWorkerCount()
+			sample := hp.sampleAutoscale()
+			canScaleDown := time.Since(lastScaleDown) >= hp.autoscale.ScaleDownCooldown
+			target := hp.autoscale.decide(current, sample, canScaleDown)
+			if target == current {
+				continue
+			}
+			if target < current {
+				lastScaleDown = time.Now()
+			}
+			logging.Component("worker").Info("Autoscaling workers",
+				"from", current,
+				"to", target,
+				"queue_fill", sample.queueFill,
+				"lag", sample.lag,
+				"buffer_fill", sample.bufferFill)
+			hp.resize(target)
+		case <-hp.stopCh:
+			return
+		}
+	}
+}
+
+// sampleAutoscale reads the job queue, processing lag and HTTP buffer fill
+func (hp *HTTPPool) sampleAutoscale() autoscaleSample {
+	var s autoscaleSample
+	if c := hp.jobQueue.capacity; c > 0 {
+		s.queueFill = float64(hp.jobQueue.depth()) / float64(c)
+	}
+	s.lag = hp.lag()
+	if hp.httpSender != nil {
+		s.bufferFill = hp.httpSender.BufferUtilization()
+	}
+	return s
+}
+
+// lag returns the age of the newest processed file, or 0 if none is known
+func (hp *HTTPPool) lag() time.Duration {
+	if hp.stateManager != nil {
+		if ts := hp.stateManager.GetLastTimestamp(); ts > 0 {
+			return max(0, time.Since(time.Unix(ts, 0)))
+		}
+	}
+	return 0
+}
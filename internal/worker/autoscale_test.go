@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+func TestAutoscalePolicy_Decide(t *testing.T) {
+	policy := AutoscalePolicy{
+		MinWorkers:      2,
+		MaxWorkers:      4,
+		QueueHighWater:  0.5,
+		LagHighWater:    5 * time.Minute,
+		BufferHighWater: 0.8,
+	}
+	tests := []struct {
+		name         string
+		current      int
+		sample       autoscaleSample
+		canScaleDown bool
+		want         int
+	}{
+		{"queue filling", 3, autoscaleSample{queueFill: 0.6}, true, 4},
+		{"lagging", 3, autoscaleSample{queueFill: 0.1, lag: 10 * time.Minute}, true, 4},
+		{"capped at max", 4, autoscaleSample{queueFill: 1}, true, 4},
+		{"buffer full despite queue", 3, autoscaleSample{queueFill: 1, bufferFill: 0.9}, true, 2},
+		{"idle", 3, autoscaleSample{lag: time.Minute}, true, 2},
+		{"idle during cooldown", 3, autoscaleSample{lag: time.Minute}, false, 3},
+		{"floored at min", 2, autoscaleSample{}, true, 2},
+		{"steady", 3, autoscaleSample{queueFill: 0.2, lag: 3 * time.Minute}, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.decide(tt.current, tt.sample, tt.canScaleDown); got != tt.want {
+				t.Errorf("decide() = %d, expected %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShedPolicy_Decide(t *testing.T) {
+	policy := ShedPolicy{HighWater: 0.9, For: 30 * time.Second, LowWater: 0.5}
+	tests := []struct {
+		name         string
+		shedding     bool
+		sample       autoscaleSample
+		saturatedFor time.Duration
+		want         bool
+	}{
+		{"saturated long enough", false, autoscaleSample{queueFill: 1, bufferFill: 0.95}, time.Minute, true},
+		{"saturated briefly", false, autoscaleSample{queueFill: 1, bufferFill: 0.95}, time.Second, false},
+		{"only the queue full", false, autoscaleSample{queueFill: 1, bufferFill: 0.2}, time.Minute, false},
+		{"still draining", true, autoscaleSample{queueFill: 0.6, bufferFill: 0.1}, 0, true},
+		{"drained", true, autoscaleSample{queueFill: 0.4, bufferFill: 0.1}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.decide(tt.shedding, tt.sample, tt.saturatedFor); got != tt.want {
+				t.Errorf("decide() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPPool_Resize(t *testing.T) {
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	pool := NewHTTPPool(&s3.Client{}, &output.HTTPSender{}, stateManager, "test-bucket", 8, 10, nil, nil)
+	pool.SetAutoscalePolicy(AutoscalePolicy{MinWorkers: 1, MaxWorkers: 4, Interval: time.Hour})
+	pool.Start()
+
+	if n := pool.GetWorkerCount(); n != 4 {
+		t.Errorf("Expected the initial count to be clamped to 4, got %d", n)
+	}
+
+	pool.resize(1)
+	if n := pool.GetWorkerCount(); n != 1 {
+		t.Errorf("Expected 1 worker, got %d", n)
+	}
+	pool.resize(3)
+	if n := pool.GetWorkerCount(); n != 3 {
+		t.Errorf("Expected 3 workers, got %d", n)
+	}
+
+	// Stop returns only once every running worker has exited
+	done := make(chan struct{})
+	go func() {
+		pool.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// scanBufferSize is the initial line buffer of a file's scanner; longer lines grow it up to the max line size
+const scanBufferSize = 64 * 1024
+
+// Per-file read buffers, reused across files instead of being allocated for each one
+var (
+	readerPool = sync.Pool{
+		New: func() any { return bufio.NewReaderSize(nil, scanBufferSize) },
+	}
+	scanBufferPool = sync.Pool{
+		New: func() any {
+			buf := make([]byte, 0, scanBufferSize)
+			return &buf
+		},
+	}
+	gzipPool sync.Pool // *gzip.Reader
+)
+
+// getReader returns a pooled buffered reader over r
+func getReader(r io.Reader) *bufio.Reader {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+// putReader returns a reader to the pool, dropping its reference to the source
+func putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readerPool.Put(br)
+}
+
+// isGzip reports whether the buffered content starts with the gzip magic bytes.
+// Objects without them (e.g. plain .json or .csv uploads) are read as they are.
+func isGzip(br *bufio.Reader) bool {
+	magic, _ := br.Peek(2)
+	return len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// getGzipReader returns a pooled gzip reader decompressing r
+func getGzipReader(r io.Reader) (*gzip.Reader, error) {
+	if gz, ok := gzipPool.Get().(*gzip.Reader); ok {
+		if err := gz.Reset(r); err != nil {
+			gzipPool.Put(gz)
+			return nil, err
+		}
+		return gz, nil
+	}
+	return gzip.NewReader(r)
+}
+
+// putGzipReader closes a gzip reader and returns it to the pool
+func putGzipReader(gz *gzip.Reader) {
+	gz.Close()
+	gzipPool.Put(gz)
+}
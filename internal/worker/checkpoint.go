@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// checkpointInterval is how many sent lines apart resume points are sampled
+const checkpointInterval = 1000
+
+// checkpointer turns the sender's delivery watermark into resume points within a file.
+// The reader samples the file position every checkpointInterval sent lines; when
+// delivery passes a sample it is saved as the file's offset.
+type checkpointer struct {
+	tracker state.OffsetTracker
+	key     string
+
+	mu      sync.Mutex
+	samples []state.FileOffset // Pending resume points in increasing Sent order
+	saved   int64              // Sent offset of the last saved resume point
+}
+
+// newCheckpointer creates a checkpointer resuming from start (nil if the state manager cannot track offsets)
+func newCheckpointer(stateManager state.StateManager, key string, start state.FileOffset) *checkpointer {
+	tracker, ok := stateManager.(state.OffsetTracker)
+	if !ok {
+		return nil
+	}
+	return &checkpointer{tracker: tracker, key: key, saved: start.Sent}
+}
+
+// sample records the file position before the line with the given sent offset
+func (c *checkpointer) sample(offset state.FileOffset) {
+	if c == nil || offset.Sent%checkpointInterval != 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if offset.Sent > c.saved {
+		c.samples = append(c.samples, offset)
+	}
+}
+
+// progress saves the latest sampled position that every line before it has been delivered
+func (c *checkpointer) progress(delivered int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for n < len(c.samples) && c.samples[n].Sent <= delivered {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	offset := c.samples[n-1]
+	c.samples = c.samples[n:]
+	c.saved = offset.Sent
+	offset.UpdatedAt = time.Now().Unix()
+	c.tracker.UpdateOffset(c.key, offset)
+}
@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+func TestCheckpointer_SavesDeliveredSamples(t *testing.T) {
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	cp := newCheckpointer(stateManager, "big.gz", state.FileOffset{})
+	for sent := int64(0); sent <= 3000; sent += 500 {
+		cp.sample(state.FileOffset{Lines: sent + 1, Bytes: sent * 10, Sent: sent})
+	}
+
+	// Nothing past the first sample has been delivered yet
+	cp.progress(999)
+	if _, ok := stateManager.GetOffset("big.gz"); ok {
+		t.Error("Expected no offset before delivery reaches a sample")
+	}
+
+	cp.progress(2500)
+	offset, ok := stateManager.GetOffset("big.gz")
+	if !ok || offset.Sent != 2000 || offset.Lines != 2001 || offset.Bytes != 20000 {
+		t.Errorf("Expected resume point at sent line 2000, got %+v", offset)
+	}
+}
+
+func TestCheckpointer_UnsupportedStateManager(t *testing.T) {
+	if cp := newCheckpointer(nil, "big.gz", state.FileOffset{}); cp != nil {
+		t.Error("Expected no checkpointer without an offset tracker")
+	}
+	var cp *checkpointer
+	cp.sample(state.FileOffset{}) // Must be a no-op on nil
+}
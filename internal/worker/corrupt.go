@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	kflate "github.com/klauspost/compress/flate"
+	"github.com/klauspost/pgzip"
+)
+
+// ErrCorruptFile is wrapped by the error of a file whose content cannot be read no matter
+// how often it is retried: an invalid or truncated gzip stream, or a line longer than the
+// scanner accepts. Unless the retry policy says otherwise, such files are quarantined on
+// their first failure.
+var ErrCorruptFile = errors.New("corrupt file")
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// corruption wraps err with ErrCorruptFile if it shows the file's content is corrupt.
+// complete reports whether the whole object was downloaded, which distinguishes a
+// truncated gzip stream from a download cut short.
+func corruption(err error, complete bool) error {
+	var flateErr flate.CorruptInputError
+	var kflateErr kflate.CorruptInputError // Raised through pgzip
+	switch {
+	case errors.Is(err, gzip.ErrHeader),
+		errors.Is(err, gzip.ErrChecksum),
+		errors.Is(err, pgzip.ErrHeader),
+		errors.Is(err, pgzip.ErrChecksum),
+		errors.As(err, &flateErr),
+		errors.As(err, &kflateErr),
+		errors.Is(err, bufio.ErrTooLong),
+		errors.Is(err, io.ErrUnexpectedEOF) && complete:
+		return fmt.Errorf("%w: %w", ErrCorruptFile, err)
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestCorruption(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		complete bool
+		want     bool
+	}{
+		{"gzip header", gzip.ErrHeader, false, true},
+		{"gzip checksum", gzip.ErrChecksum, false, true},
+		{"deflate data", flate.CorruptInputError(12), false, true},
+		{"line too long", fmt.Errorf("read: %w", bufio.ErrTooLong), false, true},
+		{"truncated object", io.ErrUnexpectedEOF, true, true},
+		{"download cut short", io.ErrUnexpectedEOF, false, false},
+		{"network error", errors.New("connection reset by peer"), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := corruption(tt.err, tt.complete)
+			if got := errors.Is(err, ErrCorruptFile); got != tt.want {
+				t.Errorf("Expected corrupt=%v, got %v (%v)", tt.want, got, err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected the cause to be kept, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/pgzip"
+)
+
+const (
+	// decodeBlockSize is the size of the decompressed blocks pgzip decodes ahead
+	decodeBlockSize = 1024 * 1024
+	// readAheadMinSize is the smallest object decompressed with pgzip; for smaller ones its
+	// goroutines and blocks cost more than they save
+	readAheadMinSize = 8 * 1024 * 1024
+)
+
+// openGzip returns a reader decompressing a gzipped object of size bytes. Objects of
+// readAheadMinSize or more are decompressed with klauspost/pgzip when readAhead is above 1:
+// it inflates up to readAhead blocks ahead of the reader in its own goroutine and verifies
+// checksums in another, so a large file's decompression runs on other cores than the
+// scanning and sending of its lines, with klauspost/compress's faster inflate. Other
+// objects fall back to a pooled compress/gzip reader. Closing the reader releases it.
+func openGzip(r io.Reader, size int64, readAhead int) (io.ReadCloser, error) {
+	if readAhead > 1 && size >= readAheadMinSize {
+		gz, err := pgzip.NewReaderN(r, decodeBlockSize, readAhead)
+		if err != nil {
+			return nil, err
+		}
+		return gz, nil
+	}
+	gz, err := getGzipReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return pooledGzip{gz}, nil
+}
+
+// pooledGzip returns its compress/gzip reader to the pool on Close
+type pooledGzip struct {
+	*gzip.Reader
+}
+
+func (g pooledGzip) Close() error {
+	putGzipReader(g.Reader)
+	return nil
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+)
+
+// gzipMembers compresses each part as its own gzip member, as concatenated uploads are
+func gzipMembers(parts ...[]byte) []byte {
+	var compressed bytes.Buffer
+	for _, part := range parts {
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(part)
+		gz.Close()
+	}
+	return compressed.Bytes()
+}
+
+func TestOpenGzip(t *testing.T) {
+	// Several blocks plus a short final one, in two members
+	data := bytes.Repeat([]byte("0123456789abcdef\n"), 3*decodeBlockSize/17+100)
+	compressed := gzipMembers(data[:decodeBlockSize+5], data[decodeBlockSize+5:])
+
+	for _, tc := range []struct {
+		name      string
+		size      int64
+		readAhead int
+		pgzip     bool
+	}{
+		{"pgzip", readAheadMinSize, 2, true},
+		{"small file", readAheadMinSize - 1, 2, false},
+		{"inline", readAheadMinSize, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := openGzip(bytes.NewReader(compressed), tc.size, tc.readAhead)
+			if err != nil {
+				t.Fatalf("openGzip failed: %v", err)
+			}
+			if _, pooled := r.(pooledGzip); pooled == tc.pgzip {
+				t.Errorf("Expected pgzip %v, got %T", tc.pgzip, r)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll failed: %v", err)
+			}
+			r.Close()
+			if !bytes.Equal(got, data) {
+				t.Errorf("Expected %d decompressed bytes, got %d", len(data), len(got))
+			}
+		})
+	}
+}
+
+func TestOpenGzip_Corrupt(t *testing.T) {
+	compressed := gzipMembers(bytes.Repeat([]byte("line\n"), 1000))
+	compressed[len(compressed)-6] ^= 0xff // Checksum
+	for _, readAhead := range []int{1, 4} {
+		r, err := openGzip(bytes.NewReader(compressed), readAheadMinSize, readAhead)
+		if err != nil {
+			t.Fatalf("openGzip failed: %v", err)
+		}
+		_, err = io.ReadAll(r)
+		r.Close()
+		if !errors.Is(corruption(err, true), ErrCorruptFile) {
+			t.Errorf("Expected a corrupt file with read-ahead %d, got %v", readAhead, err)
+		}
+	}
+}
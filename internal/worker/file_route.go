@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+)
+
+// defaultRouteName replaces a placeholder that has no value for a file (no format, or the bucket root)
+const defaultRouteName = "default"
+
+// SetOutputTemplate writes each file's lines to the path made by expanding template, e.g.
+// "/var/log/streamer/{format}.log", so each format or prefix gets its own rotating file.
+// Placeholders: {format} (the log format's name), {bucket} and {prefix} (the file's stream
+// prefix with "/" replaced by "_"); one with no value expands to "default". Every path
+// rotates like the output file, which still receives markers (see InjectMarker). Call before Start.
+func (p *FilePool) SetOutputTemplate(template string) {
+	p.outputTemplate = template
+	p.routed = make(map[string]*outputFile)
+}
+
+// writerFor returns the writer for a file's lines (caller holds writeMutex)
+func (p *FilePool) writerFor(job scanner.FileJob) *outputFile {
+	if p.outputTemplate == "" {
+		return p.fileWriter
+	}
+	path := p.outputPath(job)
+	if path == p.outputFilePath {
+		return p.fileWriter
+	}
+	writer, ok := p.routed[path]
+	if !ok {
+		writer = newRotatingWriter(path, p.maxSizeMB, p.maxBackups)
+		writer.syncBytes = p.syncPolicy.Bytes
+		p.routed[path] = writer
+	}
+	return writer
+}
+
+// outputPath expands the output template for a file
+func (p *FilePool) outputPath(job scanner.FileJob) string {
+	format := defaultRouteName
+	if p.logFormat != nil {
+		format = p.logFormat.Name()
+	}
+	prefix := strings.ReplaceAll(strings.Trim(streamPrefix(job.StreamID), "/"), "/", "_")
+	if prefix == "" {
+		prefix = defaultRouteName
+	}
+	return strings.NewReplacer(
+		"{format}", format,
+		"{bucket}", p.bucket,
+		"{prefix}", prefix,
+	).Replace(p.outputTemplate)
+}
+
+// streamPrefix returns the prefix part of a stream ID ("<bucket>/<prefix>")
+func streamPrefix(streamID string) string {
+	if i := strings.IndexByte(streamID, '/'); i >= 0 {
+		return streamID[i+1:]
+	}
+	return streamID
+}
+
+// closeRouted closes the writers opened for the output template
+func (p *FilePool) closeRouted() {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	for _, writer := range p.routed {
+		writer.Close()
+	}
+}
+
+// rotateRouted rotates the writers opened for the output template (caller holds writeMutex)
+func (p *FilePool) rotateRouted() error {
+	var errs []error
+	for _, writer := range p.routed {
+		errs = append(errs, writer.Rotate())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"os"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// SyncPolicy controls when file output is fsynced to disk. Without one, written lines
+// reach disk whenever the OS flushes its page cache.
+type SyncPolicy struct {
+	Interval time.Duration // Sync written data this often (0 disables)
+	Bytes    int64         // Sync after this many bytes are written to a file (0 disables)
+}
+
+// SetSyncPolicy fsyncs output files on an interval and/or every N bytes, bounding how much
+// written output a host crash can lose. Files are always synced before they are rotated
+// and when the pool stops. Call before Start.
+func (p *FilePool) SetSyncPolicy(policy SyncPolicy) {
+	p.syncPolicy = policy
+	p.fileWriter.syncBytes = policy.Bytes
+}
+
+// syncLoop syncs every output file with unsynced data on the policy interval until the pool stops
+func (p *FilePool) syncLoop() {
+	defer crash.Recover()
+	defer p.syncWG.Done()
+
+	ticker := time.NewTicker(p.syncPolicy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.syncAll()
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// syncAll syncs the output file and every routed file
+func (p *FilePool) syncAll() {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	p.fileWriter.sync()
+	for _, writer := range p.routed {
+		writer.sync()
+	}
+}
+
+// outputFile is a rotating output file that can be fsynced. lumberjack does not expose its
+// file, so outputFile keeps its own handle on the file lumberjack is writing, tracking the
+// file's size to sync it just before lumberjack rotates it and reopen after.
+// Callers serialize access (FilePool.writeMutex).
+type outputFile struct {
+	*lumberjack.Logger
+	syncBytes int64 // Sync after this many unsynced bytes (0 disables)
+
+	handle   *os.File // Opened on the current file at the first sync after (re)opening
+	size     int64    // Bytes in the current file, -1 until known
+	unsynced int64
+}
+
+// newRotatingWriter creates an output file rotating path at maxSizeMB
+func newRotatingWriter(path string, maxSizeMB, maxBackups int) *outputFile {
+	return &outputFile{
+		Logger: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSizeMB,  // megabytes
+			MaxBackups: maxBackups, // keep N old files
+			Compress:   true,       // compress rotated files
+			LocalTime:  true,       // use local time for filenames
+		},
+		size: -1,
+	}
+}
+
+// maxSize mirrors lumberjack's rotation size (100 MB if unset)
+func (f *outputFile) maxSize() int64 {
+	if f.MaxSize == 0 {
+		return 100 * 1024 * 1024
+	}
+	return int64(f.MaxSize) * 1024 * 1024
+}
+
+// Write writes to the current file, syncing it first if lumberjack is about to rotate it
+func (f *outputFile) Write(p []byte) (int, error) {
+	if f.size < 0 {
+		f.size = 0
+		if info, err := os.Stat(f.Filename); err == nil {
+			f.size = info.Size()
+		}
+	}
+	rotates := f.size > 0 && f.size+int64(len(p)) > f.maxSize()
+	if rotates {
+		f.sync()
+		f.closeHandle()
+		f.size = 0
+	}
+
+	n, err := f.Logger.Write(p)
+	f.size += int64(n)
+	f.unsynced += int64(n)
+	if f.syncBytes > 0 && f.unsynced >= f.syncBytes {
+		f.sync()
+	}
+	return n, err
+}
+
+// Rotate syncs the current file and starts a new one
+func (f *outputFile) Rotate() error {
+	f.sync()
+	f.closeHandle()
+	f.size = 0
+	return f.Logger.Rotate()
+}
+
+// Close syncs and closes the current file
+func (f *outputFile) Close() error {
+	f.sync()
+	f.closeHandle()
+	f.size = -1
+	return f.Logger.Close()
+}
+
+// sync flushes the current file's written data to disk, logging any failure
+func (f *outputFile) sync() {
+	if err := f.syncNow(); err != nil {
+		logging.Component("worker").Error("Failed to sync output file", "path", f.Filename, "error", err)
+	}
+}
+
+// syncNow flushes the current file's written data to disk
+func (f *outputFile) syncNow() error {
+	if f.unsynced == 0 {
+		return nil
+	}
+	if f.handle == nil {
+		handle, err := os.OpenFile(f.Filename, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		f.handle = handle
+	}
+	if err := f.handle.Sync(); err != nil {
+		return err
+	}
+	f.unsynced = 0
+	return nil
+}
+
+// closeHandle closes the sync handle once its file is rotated or closed
+func (f *outputFile) closeHandle() {
+	if f.handle != nil {
+		f.handle.Close()
+		f.handle = nil
+	}
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+func TestOutputFile_SyncsEveryNBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f := newRotatingWriter(path, 10, 1)
+	f.syncBytes = 100
+	defer f.Close()
+
+	f.Write(bytes.Repeat([]byte("a"), 60))
+	if f.unsynced != 60 {
+		t.Errorf("Expected 60 unsynced bytes, got %d", f.unsynced)
+	}
+	f.Write(bytes.Repeat([]byte("a"), 60))
+	if f.unsynced != 0 || f.handle == nil {
+		t.Errorf("Expected a sync after 100 bytes, got %d unsynced", f.unsynced)
+	}
+}
+
+func TestOutputFile_SyncsBeforeRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f := newRotatingWriter(path, 1, 1)
+	defer f.Close()
+	chunk := bytes.Repeat([]byte("a"), 600*1024)
+
+	f.Write(chunk)
+	f.sync()
+	before := f.handle
+	f.Write(chunk) // Exceeds 1 MB, so lumberjack rotates first
+	if f.handle != nil || before == nil {
+		t.Fatal("Expected the handle on the rotated file to be closed")
+	}
+	if f.size != int64(len(chunk)) || f.unsynced != int64(len(chunk)) {
+		t.Errorf("Expected only the new file's bytes to be tracked, got size %d, unsynced %d", f.size, f.unsynced)
+	}
+
+	// The next sync opens the file lumberjack is now writing
+	f.sync()
+	current, _ := os.Stat(path)
+	synced, _ := f.handle.Stat()
+	if !os.SameFile(current, synced) {
+		t.Error("Expected the sync handle to be on the current file")
+	}
+}
+
+func TestFilePool_SyncLoop(t *testing.T) {
+	pool := NewFilePool(&s3.Client{}, filepath.Join(t.TempDir(), "out.log"), 10, 1, &state.Manager{}, "test-bucket", 1, 10)
+	pool.SetSyncPolicy(SyncPolicy{Interval: 10 * time.Millisecond})
+	pool.Start()
+	defer pool.Stop()
+
+	pool.writeMutex.Lock()
+	pool.fileWriter.Write([]byte("line\n"))
+	pool.writeMutex.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pool.writeMutex.Lock()
+		unsynced := pool.fileWriter.unsynced
+		pool.writeMutex.Unlock()
+		if unsynced == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the sync loop to sync the output file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
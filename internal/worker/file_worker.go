@@ -1,39 +1,38 @@
 package worker
 
 import (
-	"bufio"
-	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // FilePool manages a pool of workers that write to rotating log files
 type FilePool struct {
-	s3Client       *s3.Client
-	fileWriter     *lumberjack.Logger
+	*SinkPool
+	fileWriter     *outputFile
 	outputFilePath string
-	stateManager   state.StateManager
-	bucket         string
-	workerCount    int
-	jobQueue       chan scanner.FileJob
-	wg             sync.WaitGroup
-	stopCh         chan struct{}
-	filesProcessed atomic.Int64
-	bytesProcessed atomic.Int64
-	errors         atomic.Int64
-	activeWorkers  atomic.Int64 // Track actively processing workers
-	writeMutex     sync.Mutex   // Protect concurrent writes to file
+	maxSizeMB      int
+	maxBackups     int
+	logFormat      formats.LogFormat // nil applies the legacy JSON-array cleanup (see cleanJSONLine)
+	writeMutex     sync.Mutex        // Protect concurrent writes to file
+
+	// Per-format or per-prefix output files (see SetOutputTemplate), guarded by writeMutex
+	outputTemplate string
+	routed         map[string]*outputFile // By path
+
+	syncPolicy SyncPolicy
+	syncWG     sync.WaitGroup
 }
 
 // NewFilePool creates a new file-based worker pool
@@ -47,187 +46,86 @@ func NewFilePool(
 	workerCount int,
 	queueSize int,
 ) *FilePool {
-	// Strip s3:// prefix from bucket name
-	bucket = strings.TrimPrefix(bucket, "s3://")
-
-	// Create lumberjack rotating file writer
-	fileWriter := &lumberjack.Logger{
-		Filename:   outputFilePath,
-		MaxSize:    maxSizeMB,  // megabytes
-		MaxBackups: maxBackups, // keep N old files
-		Compress:   true,       // compress rotated files
-		LocalTime:  true,       // use local time for filenames
+	p := &FilePool{
+		fileWriter:     newRotatingWriter(outputFilePath, maxSizeMB, maxBackups),
+		outputFilePath: outputFilePath,
+		maxSizeMB:      maxSizeMB,
+		maxBackups:     maxBackups,
 	}
+	p.SinkPool = NewSinkPool(s3Client, fileSink{p}, stateManager, bucket, workerCount, queueSize)
+	p.SetTransforms(cleanJSONTransform)
+	return p
+}
 
-	return &FilePool{
-		s3Client:       s3Client,
-		fileWriter:     fileWriter,
-		outputFilePath: outputFilePath,
-		stateManager:   stateManager,
-		bucket:         bucket,
-		workerCount:    workerCount,
-		jobQueue:       make(chan scanner.FileJob, queueSize),
-		stopCh:         make(chan struct{}),
+// SetLogFormat processes each line with the format's ProcessContent, as HTTPPool does,
+// instead of the legacy JSON-array cleanup. Call before Start.
+func (p *FilePool) SetLogFormat(format formats.LogFormat) {
+	p.logFormat = format
+	if format == nil {
+		p.SetTransforms(cleanJSONTransform)
+		return
 	}
+	p.SetTransforms(format.ProcessContent)
 }
 
 // Start starts all workers
 func (p *FilePool) Start() {
-	for i := 0; i < p.workerCount; i++ {
-		p.wg.Add(1)
-		go p.worker(i)
+	p.SinkPool.Start()
+	if p.syncPolicy.Interval > 0 {
+		p.syncWG.Add(1)
+		go p.syncLoop()
 	}
 }
 
-// Stop stops all workers gracefully
+// Stop stops all workers once their current file is done. Files still queued are saved
+// in the in-flight journal for the next start (see RecoverInFlight).
 func (p *FilePool) Stop() {
-	close(p.stopCh)
-	close(p.jobQueue)
-	p.wg.Wait()
+	p.SinkPool.Stop()
+	p.syncWG.Wait()
 	p.fileWriter.Close()
+	p.closeRouted()
 }
 
-// Submit submits a job to the worker pool
-func (p *FilePool) Submit(job scanner.FileJob) bool {
-	select {
-	case p.jobQueue <- job:
-		return true
-	case <-p.stopCh:
-		return false
-	default:
-		// Queue is full
-		return false
-	}
+// fileSink writes each file's lines to the pool's output file, or the one its route selects
+type fileSink struct {
+	pool *FilePool
 }
 
-// GetMetricsCounters returns pointers to the metrics counters
-func (p *FilePool) GetMetricsCounters() (*atomic.Int64, *atomic.Int64, *atomic.Int64) {
-	return &p.filesProcessed, &p.bytesProcessed, &p.errors
-}
+// WriteFile writes a file's content, holding the output for the whole file so files don't interleave
+func (s fileSink) WriteFile(ctx context.Context, job scanner.FileJob, content io.Reader) (int64, error) {
+	s.pool.writeMutex.Lock()
+	defer s.pool.writeMutex.Unlock()
 
-// worker processes jobs from the queue
-func (p *FilePool) worker(id int) {
-	defer p.wg.Done()
-
-	for {
-		select {
-		case job, ok := <-p.jobQueue:
-			if !ok {
-				return // Channel closed
-			}
-			// Track that this worker is actively processing
-			p.activeWorkers.Add(1)
-			if err := p.processJob(job); err != nil {
-				fmt.Printf("Worker %d: Error processing %s: %v\n", id, job.S3Key, err)
-				p.errors.Add(1)
-			} else {
-				p.filesProcessed.Add(1)
-			}
-			// Done processing, decrement active counter
-			p.activeWorkers.Add(-1)
-		case <-p.stopCh:
-			return
-		}
-	}
-}
-
-// processJob downloads, decompresses, and writes file to rotating log
-func (p *FilePool) processJob(job scanner.FileJob) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	// Download from S3
-	result, err := p.s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(p.bucket),
-		Key:    aws.String(job.S3Key),
-	})
+	written, err := io.Copy(s.pool.writerFor(job), content)
 	if err != nil {
-		return fmt.Errorf("failed to get S3 object: %w", err)
-	}
-	defer result.Body.Close()
-
-	// Decompress (all files are gzipped)
-	gzReader, err := gzip.NewReader(result.Body)
-	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
-	}
-	defer gzReader.Close()
-
-	// Process file line by line
-	scanner := bufio.NewScanner(gzReader)
-	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024) // 1MB initial, 10MB max buffer
-
-	var totalBytes int64
-	lineCount := 0
-
-	// Lock for writing to ensure thread safety
-	p.writeMutex.Lock()
-	defer p.writeMutex.Unlock()
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		// Strip leading comma if present (some S3 data has it)
-		if len(line) > 0 && line[0] == ',' {
-			line = line[1:]
-		}
-
-		// Skip array bracket lines (not valid JSONL)
-		trimmed := strings.TrimSpace(string(line))
-		if len(trimmed) == 1 && (trimmed[0] == '[' || trimmed[0] == ']') {
-			continue
-		}
-
-		// Write line to file (preserve JSONL format)
-		n, err := p.fileWriter.Write(line)
-		if err != nil {
-			return fmt.Errorf("failed to write line to file: %w", err)
-		}
-		totalBytes += int64(n)
-
-		// Write newline
-		n, err = p.fileWriter.Write([]byte("\n"))
-		if err != nil {
-			return fmt.Errorf("failed to write newline to file: %w", err)
-		}
-		totalBytes += int64(n)
-
-		lineCount++
+		return written, fmt.Errorf("failed to write to file: %w", err)
 	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to scan file: %w", err)
-	}
-
-	// Update state
-	p.bytesProcessed.Add(totalBytes)
-	p.stateManager.UpdateProgress(job.Timestamp, job.S3Key, totalBytes)
-
-	fmt.Printf("Processed %s: %d lines, %d bytes (written to file)\n", job.S3Key, lineCount, totalBytes)
-
-	return nil
+	return written, nil
 }
 
-// QueueDepth returns the current queue depth
-func (p *FilePool) QueueDepth() int {
-	return len(p.jobQueue)
+// cleanJSONTransform is the FilePool transform without a log format
+func cleanJSONTransform(line []byte, first bool) ([]byte, error) {
+	return cleanJSONLine(line), nil
 }
 
-// WaitForIdle waits for all workers to finish processing (queue empty AND no active workers)
-func (p *FilePool) WaitForIdle() {
-	for {
-		queueDepth := len(p.jobQueue)
-		activeCount := p.activeWorkers.Load()
+// cleanJSONLine turns a line of a pretty-printed JSON array into a JSONL line: the leading
+// comma some S3 data has is stripped, and empty and bracket-only lines are dropped (nil)
+func cleanJSONLine(line []byte) []byte {
+	if len(line) == 0 {
+		return nil
+	}
 
-		if queueDepth == 0 && activeCount == 0 {
-			return
-		}
+	// Strip leading comma if present (some S3 data has it)
+	if line[0] == ',' {
+		line = line[1:]
+	}
 
-		time.Sleep(100 * time.Millisecond)
+	// Skip array bracket lines (not valid JSONL)
+	trimmed := strings.TrimSpace(string(line))
+	if len(trimmed) == 1 && (trimmed[0] == '[' || trimmed[0] == ']') {
+		return nil
 	}
+	return line
 }
 
 // InjectMarker writes a special marker JSON line to the log file for tracking
@@ -244,8 +142,6 @@ func (p *FilePool) InjectMarker(markerID string, injectTime time.Time, markerTyp
 		hostname,
 	)
 
-	fmt.Printf("DEBUG: Marker JSON: %s\n", markerJSON)
-
 	// Lock for writing to ensure thread safety
 	p.writeMutex.Lock()
 	defer p.writeMutex.Unlock()
@@ -255,24 +151,25 @@ func (p *FilePool) InjectMarker(markerID string, injectTime time.Time, markerTyp
 	if err != nil {
 		return fmt.Errorf("failed to write marker to file: %w", err)
 	}
-	fmt.Printf("DEBUG: Wrote %d bytes of marker JSON\n", n)
 
 	// Write newline
 	n2, err := p.fileWriter.Write([]byte("\n"))
 	if err != nil {
 		return fmt.Errorf("failed to write newline after marker: %w", err)
 	}
-	fmt.Printf("DEBUG: Wrote %d bytes of newline, total marker size: %d bytes\n", n2, n+n2)
+	logger := logging.Component("worker")
+	logger.Debug("Injected marker",
+		"marker_id", markerID,
+		"type", markerType,
+		"bytes", n+n2,
+		"path", p.outputFilePath)
 
 	// CRITICAL: Flush to disk so EdgeDelta can immediately see the marker
-	// lumberjack doesn't have a Flush method, but we can sync the file manually
-	if file, err := os.OpenFile(p.outputFilePath, os.O_WRONLY, 0); err == nil {
-		if syncErr := file.Sync(); syncErr != nil {
-			fmt.Printf("DEBUG: Failed to sync file: %v\n", syncErr)
-		} else {
-			fmt.Printf("DEBUG: Synced file to disk\n")
-		}
-		file.Close()
+	if err := p.fileWriter.syncNow(); err != nil {
+		logger.Warn("Failed to sync output file after marker",
+			"marker_id", markerID,
+			"path", p.outputFilePath,
+			"error", err)
 	}
 
 	return nil
@@ -287,10 +184,10 @@ func (p *FilePool) GetCurrentFileSize() (int64, error) {
 	return fileInfo.Size(), nil
 }
 
-// RotateFile manually rotates the log file (closes current, starts new)
+// RotateFile manually rotates the log file and any per-format or per-prefix files (closes current, starts new)
 func (p *FilePool) RotateFile() error {
 	p.writeMutex.Lock()
 	defer p.writeMutex.Unlock()
 
-	return p.fileWriter.Rotate()
+	return errors.Join(p.fileWriter.Rotate(), p.rotateRouted())
 }
@@ -1,10 +1,17 @@
 package worker
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
 )
@@ -38,8 +45,8 @@ func TestNewFilePool(t *testing.T) {
 		t.Errorf("Expected outputFilePath %s, got %s", outputFilePath, pool.outputFilePath)
 	}
 
-	if cap(pool.jobQueue) != queueSize {
-		t.Errorf("Expected queue size %d, got %d", queueSize, cap(pool.jobQueue))
+	if pool.jobQueue.capacity != queueSize {
+		t.Errorf("Expected queue size %d, got %d", queueSize, pool.jobQueue.capacity)
 	}
 
 	if pool.fileWriter == nil {
@@ -100,16 +107,15 @@ func TestFilePool_Submit(t *testing.T) {
 	}
 
 	// Check that job was queued
-	select {
-	case queuedJob := <-pool.jobQueue:
-		if queuedJob.S3Key != job.S3Key {
-			t.Errorf("Expected job key %s, got %s", job.S3Key, queuedJob.S3Key)
-		}
-		if queuedJob.Size != job.Size {
-			t.Errorf("Expected job size %d, got %d", job.Size, queuedJob.Size)
-		}
-	default:
-		t.Error("Job should have been queued")
+	if pool.jobQueue.depth() != 1 {
+		t.Fatal("Job should have been queued")
+	}
+	queuedJob, _ := pool.jobQueue.pop()
+	if queuedJob.S3Key != job.S3Key {
+		t.Errorf("Expected job key %s, got %s", job.S3Key, queuedJob.S3Key)
+	}
+	if queuedJob.Size != job.Size {
+		t.Errorf("Expected job size %d, got %d", job.Size, queuedJob.Size)
 	}
 }
 
@@ -153,3 +159,169 @@ func TestFilePool_GetMetricsCounters(t *testing.T) {
 		t.Errorf("Expected initial errors 0, got %d", errors.Load())
 	}
 }
+
+func TestFilePool_StopSavesQueuedFiles(t *testing.T) {
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	// Not started, so both files are still queued when the pool stops
+	pool := NewFilePool(&s3.Client{}, t.TempDir()+"/out.log", 10, 1, stateManager, "test-bucket", 1, 10)
+	pool.Submit(scanner.FileJob{S3Key: "logs/200", Timestamp: 200, StreamID: "logs"})
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100, StreamID: "logs"})
+	pool.Stop()
+
+	inFlight, err := stateManager.InFlight()
+	if err != nil {
+		t.Fatalf("InFlight failed: %v", err)
+	}
+	if len(inFlight) != 2 {
+		t.Fatalf("Expected 2 saved files, got %+v", inFlight)
+	}
+
+	next := NewFilePool(&s3.Client{}, t.TempDir()+"/out.log", 10, 1, stateManager, "test-bucket", 1, 10)
+	recovered, err := next.RecoverInFlight(0)
+	if err != nil {
+		t.Fatalf("RecoverInFlight failed: %v", err)
+	}
+	if recovered != 2 || next.QueueDepth() != 2 {
+		t.Errorf("Expected 2 files re-enqueued, got %d (depth %d)", recovered, next.QueueDepth())
+	}
+	if job, _ := next.jobQueue.pop(); job.S3Key != "logs/100" || job.StreamID != "logs" {
+		t.Errorf("Expected logs/100 of stream logs first, got %+v", job)
+	}
+}
+
+func TestFilePool_ReadsPlainAndGzippedObjects(t *testing.T) {
+	content := []byte("{\"n\":1}\n{\"n\":2}\n")
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(content)
+	gz.Close()
+
+	for name, object := range map[string][]byte{"plain": content, "gzip": compressed.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			var ranges []string
+			stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+			if err != nil {
+				t.Fatalf("NewManager failed: %v", err)
+			}
+			outPath := t.TempDir() + "/out.log"
+			pool := NewFilePool(newFakeS3(t, object, &ranges), outPath, 10, 1, stateManager, "test-bucket", 1, 10)
+			defer pool.fileWriter.Close()
+
+			if err := pool.processJob(context.Background(), scanner.FileJob{S3Key: "logs/100.json", Timestamp: 100}); err != nil {
+				t.Fatalf("processJob failed: %v", err)
+			}
+			written, _ := os.ReadFile(outPath)
+			if string(written) != string(content) {
+				t.Errorf("Expected %q written, got %q", content, written)
+			}
+		})
+	}
+}
+
+func TestFilePool_AppliesLogFormat(t *testing.T) {
+	object := []byte("timestamp,identity,domain\n2025-10-12 21:41:32,laptop,example.com\n\n")
+	tests := []struct {
+		name   string
+		format formats.LogFormat
+		want   string
+	}{
+		{"csv header skipped", formats.NewCiscoUmbrellaFormat(), "2025-10-12 21:41:32,laptop,example.com\n"},
+		{"legacy cleanup", nil, "timestamp,identity,domain\n2025-10-12 21:41:32,laptop,example.com\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []string
+			stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+			if err != nil {
+				t.Fatalf("NewManager failed: %v", err)
+			}
+			outPath := t.TempDir() + "/out.log"
+			pool := NewFilePool(newFakeS3(t, object, &ranges), outPath, 10, 1, stateManager, "test-bucket", 1, 10)
+			defer pool.fileWriter.Close()
+			pool.SetLogFormat(tt.format)
+
+			if err := pool.processJob(context.Background(), scanner.FileJob{S3Key: "logs/100.csv", Timestamp: 100}); err != nil {
+				t.Fatalf("processJob failed: %v", err)
+			}
+			if written, _ := os.ReadFile(outPath); string(written) != tt.want {
+				t.Errorf("Expected %q written, got %q", tt.want, written)
+			}
+		})
+	}
+}
+
+func TestCleanJSONLine(t *testing.T) {
+	tests := map[string]string{
+		`{"a":1}`:  `{"a":1}`,
+		`,{"a":1}`: `{"a":1}`,
+		"[":        "",
+		" ] ":      "",
+		"":         "",
+	}
+	for in, want := range tests {
+		if got := string(cleanJSONLine([]byte(in))); got != want {
+			t.Errorf("cleanJSONLine(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
+
+func TestFilePool_OutputTemplate(t *testing.T) {
+	var ranges []string
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	dir := t.TempDir()
+	pool := NewFilePool(newFakeS3(t, []byte("{\"n\":1}\n"), &ranges), dir+"/out.log", 10, 1, stateManager, "test-bucket", 1, 10)
+	pool.SetLogFormat(formats.NewZscalerFormat())
+	pool.SetOutputTemplate(dir + "/{format}/{prefix}.log")
+
+	for _, job := range []scanner.FileJob{
+		{S3Key: "web/a/100", Timestamp: 100, StreamID: "test-bucket/web/a/"},
+		{S3Key: "dns/100", Timestamp: 100, StreamID: "test-bucket/dns/"},
+		{S3Key: "200", Timestamp: 200, StreamID: "test-bucket/"},
+	} {
+		if err := pool.processJob(context.Background(), job); err != nil {
+			t.Fatalf("processJob(%s) failed: %v", job.S3Key, err)
+		}
+	}
+	pool.Stop()
+
+	for _, name := range []string{"web_a.log", "dns.log", "default.log"} {
+		written, err := os.ReadFile(dir + "/zscaler/" + name)
+		if err != nil || string(written) != "{\"n\":1}\n" {
+			t.Errorf("Expected one line in %s, got %q (%v)", name, written, err)
+		}
+	}
+	if _, err := os.Stat(dir + "/out.log"); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written to the default output file, got %v", err)
+	}
+}
+
+func TestFilePool_InjectMarker(t *testing.T) {
+	var logs bytes.Buffer
+	logging.InitDefaultLogger(logging.Config{Level: "debug", Format: "json", Writer: &logs})
+	defer logging.InitDefaultLogger(logging.Config{Level: "info", Format: "text"})
+
+	path := t.TempDir() + "/out.log"
+	pool := NewFilePool(&s3.Client{}, path, 10, 1, &state.Manager{}, "test-bucket", 1, 10)
+	if err := pool.InjectMarker("m-1", time.Unix(1700000000, 0), "latency"); err != nil {
+		t.Fatalf("InjectMarker failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if !strings.Contains(string(data), `"marker_id":"m-1","inject_time":1700000000.000000000,"type":"latency"`) {
+		t.Errorf("Expected the marker line in the output file, got %q", data)
+	}
+	if !strings.Contains(logs.String(), `"msg":"Injected marker","component":"worker","marker_id":"m-1","type":"latency"`) {
+		t.Errorf("Expected a structured debug record, got %q", logs.String())
+	}
+}
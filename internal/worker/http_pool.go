@@ -2,45 +2,76 @@ package worker
 
 import (
 	"bufio"
-	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/audit"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/health"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/report"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+	"go.opentelemetry.io/otel/metric"
 )
 
-// HTTPPool processes S3 files and sends lines via HTTP to EdgeDelta
+// HTTPPool processes S3 files and sends lines via HTTP to EdgeDelta. It runs on the SinkPool
+// core with its own per-file handler: a file is done once every line queued for delivery
+// has been acknowledged, not when its worker moves on.
 type HTTPPool struct {
-	s3Client     *s3.Client
-	stateManager state.StateManager
-	httpSender   *output.HTTPSender
-	bucket       string
-	workerCount  int
-	jobQueue     chan scanner.FileJob
-	wg           sync.WaitGroup
-	stopChan     chan struct{}
-	stopped      atomic.Bool
-
-	// Metrics (local counters)
-	filesProcessed atomic.Int64
-	bytesProcessed atomic.Int64
-	errors         atomic.Int64
+	*SinkPool
+	httpSender *output.HTTPSender
+
+	// Decompressed blocks read ahead for large gzipped files (1 decodes inline)
+	decodeReadAhead int
+
+	// Lines longer than maxLineSize bytes are handled per longLines (see SetLineLimit)
+	maxLineSize int
+	longLines   LongLinePolicy
+
+	// Ranged multi-part downloads of large objects (nil when disabled, see SetMultipartDownload)
+	multipart *MultipartPolicy
 
 	// OTLP metrics client
 	metricsClient *metrics.Metrics
+	gauges        metric.Registration // Saturation gauges while started (see observe)
 
-	// Log format for content processing
+	// Log format for content processing (see SetLogFormat)
+	formatMu  sync.RWMutex
 	logFormat formats.LogFormat
+
+	// Releases sharding claims on failed files (nil when sharding is disabled)
+	claims ClaimReleaser
+
+	// Recently processed files (nil when disabled, see SetAuditLog)
+	audit *audit.Log
+
+	// Processing report of each file (nil when disabled, see SetReporter)
+	reporter *report.Reporter
+
+	// Failed-file retries (nil when disabled, see SetRetryPolicy)
+	retry    *RetryPolicy
+	retryMu  sync.Mutex
+	retrying map[string]bool // Files submitted for retry and not finished yet
+
+	// Worker autoscaling (nil when disabled, see SetAutoscalePolicy)
+	autoscale *AutoscalePolicy
+
+	// Load shedding (nil when disabled, see SetShedPolicy)
+	shed     *ShedPolicy
+	shedGate *scanner.PauseGate
+}
+
+// ClaimReleaser gives up an instance's claim on a file so it can be retried (sharding mode)
+type ClaimReleaser interface {
+	Release(key string)
 }
 
 // NewHTTPPool creates a new HTTP worker pool
@@ -54,150 +85,497 @@ func NewHTTPPool(
 	metricsClient *metrics.Metrics,
 	logFormat formats.LogFormat,
 ) *HTTPPool {
-	return &HTTPPool{
-		s3Client:      s3Client,
+	hp := &HTTPPool{
+		SinkPool:      NewSinkPool(s3Client, nil, stateManager, bucket, workerCount, queueSize),
 		httpSender:    httpSender,
-		stateManager:  stateManager,
-		bucket:        bucket,
-		workerCount:   workerCount,
-		jobQueue:      make(chan scanner.FileJob, queueSize),
-		stopChan:      make(chan struct{}),
+		maxLineSize:   DefaultMaxLineSize,
+		longLines:     LongLineFail,
 		metricsClient: metricsClient,
 		logFormat:     logFormat,
 	}
+	hp.handle = hp.handleFile
+	return hp
+}
+
+// SetFileTimeout sets how long one file may take to download and queue its lines.
+// Delivery of the queued lines is bounded by the HTTP sender instead. Call before Start.
+func (hp *HTTPPool) SetFileTimeout(timeout time.Duration) {
+	hp.SinkPool.SetFileTimeout(timeout)
+}
+
+// SetDecodeReadAhead decompresses gzipped files of 8 MiB or more with pgzip, keeping up to
+// n blocks of 1 MiB decoded ahead of the line scanner (see openGzip). Values below 2 decode
+// inline with compress/gzip. Call before Start.
+func (hp *HTTPPool) SetDecodeReadAhead(n int) {
+	hp.decodeReadAhead = n
+}
+
+// SetStrictOrdering processes the files of each stream (prefix) one at a time, in timestamp
+// order, while different streams still run in parallel. The next file of a stream starts
+// only once every line of the previous one has been delivered or the file has failed.
+// Call before Start.
+func (hp *HTTPPool) SetStrictOrdering() {
+	hp.SinkPool.SetStrictOrdering()
+}
+
+// SetClaimReleaser releases the file's claim whenever processing fails. Call before Start.
+func (hp *HTTPPool) SetClaimReleaser(claims ClaimReleaser) {
+	hp.claims = claims
+}
+
+// SetLogFormat changes the log format of files started from now on; files being
+// processed finish with the format they started with
+func (hp *HTTPPool) SetLogFormat(format formats.LogFormat) {
+	hp.formatMu.Lock()
+	defer hp.formatMu.Unlock()
+	hp.logFormat = format
+}
+
+// format returns the current log format
+func (hp *HTTPPool) format() formats.LogFormat {
+	hp.formatMu.RLock()
+	defer hp.formatMu.RUnlock()
+	return hp.logFormat
 }
 
 // Start starts the worker pool
 func (hp *HTTPPool) Start() {
-	for i := 0; i < hp.workerCount; i++ {
-		hp.wg.Add(1)
-		go hp.worker(i)
+	hp.SinkPool.Start()
+	if hp.retry != nil {
+		hp.runLoop(hp.retryLoop)
+	}
+	if hp.autoscale != nil {
+		hp.runLoop(hp.autoscaleLoop)
 	}
+	if hp.shed != nil {
+		hp.runLoop(hp.shedLoop)
+	}
+	hp.observe()
 }
 
-// Stop gracefully stops the worker pool
-func (hp *HTTPPool) Stop() {
-	if hp.stopped.CompareAndSwap(false, true) {
-		close(hp.stopChan)
-		close(hp.jobQueue)
-		hp.wg.Wait()
+// observe reports the queue depth and worker gauges until Stop
+func (hp *HTTPPool) observe() {
+	if hp.metricsClient == nil {
+		return
+	}
+	reg, err := hp.metricsClient.ObserveWorkerPool(hp.bucket, metrics.WorkerPoolStats{
+		QueueDepth:    func() int64 { return int64(hp.jobQueue.depth()) },
+		ActiveWorkers: func() int64 { return int64(hp.GetWorkerCount()) },
+		BusyWorkers:   func() int64 { return int64(hp.jobQueue.running()) },
+	})
+	if err != nil {
+		logging.Component("worker").Warn("Failed to register worker pool gauges", "error", err)
+		return
 	}
+	hp.gauges = reg
 }
 
-// Submit submits a job to the worker pool
-func (hp *HTTPPool) Submit(job scanner.FileJob) bool {
-	select {
-	case hp.jobQueue <- job:
-		return true
-	case <-hp.stopChan:
-		return false
-	default:
-		return false
+// Stop stops the worker pool without waiting for slow downloads: in-flight files are
+// cancelled and, like files still queued, left in the in-flight journal so the next start
+// re-enqueues them (see RecoverInFlight). Lines already queued are delivered by the sender.
+func (hp *HTTPPool) Stop() {
+	if hp.stopped.Load() {
+		return
+	}
+	hp.SinkPool.Stop()
+	if hp.gauges != nil {
+		hp.gauges.Unregister()
 	}
 }
 
-// WaitForIdle waits until all jobs are processed
-func (hp *HTTPPool) WaitForIdle() {
-	for {
-		if len(hp.jobQueue) == 0 {
-			return
+// handleFile is the pool's SinkPool handler: it queues a file's lines for delivery and
+// counts read failures. The file's Ack marks it done in the queue.
+func (hp *HTTPPool) handleFile(id int, job scanner.FileJob) {
+	epoch := hp.epochContext()
+	err := hp.processFile(epoch, job)
+	if err == nil {
+		return // Success is accounted for in completeFile once every line has been delivered
+	}
+	if hp.ctx.Err() != nil || epoch.Err() != nil {
+		hp.interrupt(job)
+		return
+	}
+	logging.Component("worker").Error("Worker failed to process file",
+		"worker_id", id,
+		"s3_key", job.S3Key,
+		"processing_id", job.ProcessingID,
+		"error", err)
+	hp.recordFailure(job, err)
+	if errors.Is(err, ErrCorruptFile) && hp.metricsClient != nil {
+		hp.metricsClient.RecordCorruptFile(context.Background(), hp.dimensions(job))
+	}
+	if errors.Is(err, ErrFileTimeout) {
+		hp.timeouts.Add(1)
+		if hp.metricsClient != nil {
+			hp.metricsClient.RecordFileTimeout(context.Background(), hp.dimensions(job))
+		}
+	} else {
+		hp.errors.Add(1)
+		if hp.metricsClient != nil {
+			hp.metricsClient.RecordFileError(context.Background(), hp.dimensions(job))
 		}
 	}
 }
 
-// worker processes jobs from the queue
-func (hp *HTTPPool) worker(id int) {
-	defer hp.wg.Done()
+// processFile downloads a single S3 file and queues its lines for delivery; Stop or the
+// end of epoch (see Suspend) aborts it.
+// Progress is recorded asynchronously, only after all of the file's batches are accepted.
+func (hp *HTTPPool) processFile(epoch context.Context, job scanner.FileJob) error {
+	startTime := time.Now()
+	if journal, ok := hp.stateManager.(state.Journal); ok {
+		journal.BeginFile(state.InFlightJob{
+			Key:       job.S3Key,
+			StreamID:  job.StreamID,
+			Timestamp: job.Timestamp,
+			Size:      job.Size,
+			StartedAt: startTime.Unix(),
+		})
+	}
 
-	for job := range hp.jobQueue {
-		if err := hp.processFile(job); err != nil {
-			logging.GetDefaultLogger().Error("Worker failed to process file",
-				"worker_id", id,
-				"s3_key", job.S3Key,
-				"error", err)
-			hp.errors.Add(1)
-			if hp.metricsClient != nil {
-				hp.metricsClient.RecordFileError(context.Background())
-			}
-		} else {
-			hp.filesProcessed.Add(1)
-			// State updates happen in main loop after batch completion
+	var (
+		stats   fileStats
+		readErr error
+		ack     *output.Ack
+	)
+	ack = output.NewAck(func(err error) {
+		defer hp.jobQueue.done(job)
+		if readErr != nil {
+			return // Already reported by the worker
 		}
+		stats.destinations = ack.Destinations()
+		hp.completeFile(job, stats, startTime, err)
+	})
+
+	ctx, cancel := fileContext(hp.ctx, hp.fileTimeout)
+	defer cancel()
+	defer context.AfterFunc(epoch, cancel)()
+	stats, readErr = hp.readFile(ctx, job, ack)
+	readErr = timeoutError(ctx, hp.fileTimeout, readErr)
+	if readErr != nil {
+		hp.auditFile(job, stats, startTime, readErr, epoch.Err() != nil)
+		ack.Fail(readErr)
+		return readErr
 	}
+
+	ack.Seal()
+	return nil
 }
 
-// processFile downloads and processes a single S3 file
-func (hp *HTTPPool) processFile(job scanner.FileJob) error {
-	startTime := time.Now()
+// fileStats counts what happened to the lines of a file in one attempt
+type fileStats struct {
+	lines int // Lines read, excluding those delivered before the resume checkpoint
+	bytes int // Bytes of the lines queued
+
+	linesIn      int64            // Lines in the object, including skipped ones
+	linesOut     int64            // Lines queued for delivery
+	bytesIn      int64            // Object bytes downloaded
+	skipped      map[string]int64 // Lines not queued, by reason (see report.Record)
+	destinations map[string]output.DestinationResult
+}
+
+// skip counts n lines not queued for reason
+func (s *fileStats) skip(reason string, n int64) {
+	if n <= 0 {
+		return
+	}
+	if s.skipped == nil {
+		s.skipped = make(map[string]int64)
+	}
+	s.skipped[reason] += n
+}
+
+// readFile downloads, decompresses and queues every line of the file.
+// If the state manager holds a resume point for the file, lines before it are not sent again:
+// plain objects are fetched from the recorded byte offset with a ranged GET, gzipped
+// objects are re-read and the already delivered lines skipped.
+func (hp *HTTPPool) readFile(ctx context.Context, job scanner.FileJob, ack *output.Ack) (stats fileStats, err error) {
+	defer recoverPanic(&err)
+
+	var resume state.FileOffset
+	if tracker, ok := hp.stateManager.(state.OffsetTracker); ok {
+		resume, _ = tracker.GetOffset(job.S3Key)
+	}
+	ranged := resume.Bytes > 0 && !resume.Compressed
 
 	// Download from S3
-	result, err := hp.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: aws.String(hp.bucket),
-		Key:    aws.String(job.S3Key),
-	})
+	var start int64
+	if ranged {
+		start = resume.Bytes
+	}
+	object, err := hp.download(ctx, job, start)
 	if err != nil {
-		return fmt.Errorf("failed to download: %w", err)
+		return stats, fmt.Errorf("failed to download: %w", err)
 	}
-	defer result.Body.Close()
+	defer object.Close()
+	downloaded := &countingReader{r: object}
+	complete := func() bool { return job.Size > 0 && start+downloaded.n >= job.Size }
 
-	// Decompress (all files are gzipped)
-	gzReader, err := gzip.NewReader(result.Body)
-	if err != nil {
-		// Try reading as plain text if gzip fails (unlikely but handle it)
-		return fmt.Errorf("failed to decompress (all files should be gzipped): %w", err)
+	// Decompress gzipped objects (a ranged read is only used for plain ones)
+	body := getReader(downloaded)
+	defer putReader(body)
+	var content io.Reader = body
+	compressed := false
+	if !ranged {
+		if isGzip(body) {
+			gzReader, err := openGzip(body, job.Size, hp.decodeReadAhead)
+			if err != nil {
+				return stats, fmt.Errorf("failed to decompress: %w", corruption(err, complete()))
+			}
+			defer gzReader.Close()
+			content = gzReader
+			compressed = true
+		}
+	}
+
+	// Position of the next line; resumed reads start at the checkpoint
+	position := state.FileOffset{Sent: resume.Sent, Compressed: compressed}
+	if ranged {
+		position.Lines = resume.Lines
+		position.Bytes = resume.Bytes
 	}
-	defer gzReader.Close()
 
-	// Read and send lines
-	scanner := bufio.NewScanner(gzReader)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // 1MB max line size
+	// Read and send lines, counting the bytes each line consumes (including its line ending)
+	scanBuf := scanBufferPool.Get().(*[]byte)
+	defer scanBufferPool.Put(scanBuf)
+	scanner := bufio.NewScanner(content)
+	lines := newLineSplitter(hp.maxLineSize, hp.longLines)
+	scanner.Buffer((*scanBuf)[:0], lines.bufferSize())
+	scanner.Split(lines.split)
+
+	format := hp.format()
+	src := &output.Source{
+		Bucket: hp.bucket,
+		Prefix: streamPrefix(job.StreamID),
+		S3Key:  job.S3Key,
+		Format: format.Name(),
+		Ack:    ack,
 
-	lineCount := 0
-	byteCount := 0
-	isFirstLine := true
+		Timestamp:    job.Timestamp,
+		Replay:       job.Replay,
+		ProcessingID: job.ProcessingID,
+	}
+	src.ResumeAt(resume.Sent)
+	cp := newCheckpointer(hp.stateManager, job.S3Key, resume)
+	if cp != nil {
+		ack.OnProgress(resume.Sent, cp.progress)
+	}
+	if resume.Sent > 0 {
+		logging.Component("worker").Info("Resuming file from checkpoint",
+			"s3_key", job.S3Key,
+			"processing_id", job.ProcessingID,
+			"lines", resume.Lines,
+			"bytes", resume.Bytes,
+			"ranged", ranged)
+	}
 
+	// Count the lines however reading ends; a ranged read counts the lines before its start
+	// as read and skipped
+	defer func() {
+		stats.linesIn = position.Lines
+		stats.linesOut = position.Sent - resume.Sent
+		stats.bytesIn = downloaded.n
+		stats.skip(report.SkipResumed, min(resume.Lines, position.Lines))
+		if hp.longLines == LongLineSkip {
+			stats.linesIn += int64(lines.long)
+			stats.skip(report.SkipLongLine, int64(lines.long))
+		}
+	}()
+
+	done := ctx.Done()
 	for scanner.Scan() {
+		select {
+		case <-done:
+			return stats, ctx.Err()
+		default:
+		}
+
 		line := scanner.Bytes()
-		lineCount++
+		lineStart := position
+		position.Lines++
+		position.Bytes += int64(lines.consumed) // Includes discarded parts of long lines
+		lines.consumed = 0
+
+		// Skip lines delivered before the checkpoint when the object had to be re-read
+		if lineStart.Lines < resume.Lines {
+			continue
+		}
+		stats.lines++
 
 		// Apply format-specific content processing
-		processedLine, err := hp.logFormat.ProcessContent(line, isFirstLine)
+		processedLine, err := format.ProcessContent(line, lineStart.Lines == 0)
 		if err != nil {
-			return fmt.Errorf("failed to process line %d: %w", lineCount, err)
+			return stats, fmt.Errorf("failed to process line %d: %w", lineStart.Lines+1, err)
 		}
-		isFirstLine = false
 
 		// Skip lines that should be filtered out (e.g., headers)
 		if processedLine == nil {
+			stats.skip(report.SkipFiltered, 1)
 			continue
 		}
 
-		byteCount += len(processedLine)
+		stats.bytes += len(processedLine)
 
-		// Send processed line to HTTP sender
-		lineCopy := make([]byte, len(processedLine))
-		copy(lineCopy, processedLine)
-		hp.httpSender.SendLine(lineCopy)
+		// Send processed line to HTTP sender, which copies it into a pooled buffer
+		cp.sample(lineStart)
+		hp.httpSender.SendLineCopy(ctx, src, processedLine)
+		position.Sent++
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to scan: %w", err)
+		return stats, fmt.Errorf("failed to scan: %w", corruption(err, complete()))
 	}
+	if lines.long > 0 {
+		logging.Component("worker").Warn("File has lines longer than the maximum line size",
+			"s3_key", job.S3Key,
+			"processing_id", job.ProcessingID,
+			"lines", lines.long,
+			"max_line_size", hp.maxLineSize,
+			"policy", hp.longLines)
+		if hp.metricsClient != nil {
+			hp.metricsClient.RecordLongLines(context.Background(), hp.dimensions(job), int64(lines.long), string(hp.longLines))
+		}
+	}
+
+	return stats, nil
+}
+
+// dimensions returns the metric dimensions of a file
+func (hp *HTTPPool) dimensions(job scanner.FileJob) metrics.Dimensions {
+	return metrics.Dimensions{Bucket: hp.bucket, Prefix: streamPrefix(job.StreamID), Format: hp.format().Name()}
+}
+
+// completeFile records the outcome of delivering a file's lines
+func (hp *HTTPPool) completeFile(job scanner.FileJob, stats fileStats, startTime time.Time, err error) {
+	hp.auditFile(job, stats, startTime, err, false)
+	if err != nil {
+		logging.Component("worker").Error("Failed to deliver file, progress not advanced",
+			"s3_key", job.S3Key,
+			"processing_id", job.ProcessingID,
+			"lines", stats.lines,
+			"error", err)
+		hp.errors.Add(1)
+		hp.recordFailure(job, err)
+		if hp.metricsClient != nil {
+			hp.metricsClient.RecordFileError(context.Background(), hp.dimensions(job))
+		}
+		return
+	}
+
+	hp.filesProcessed.Add(1)
+	hp.bytesProcessed.Add(int64(stats.bytes))
+	if hp.stateManager != nil {
+		hp.stateManager.UpdateStreamProgress(job.StreamID, job.Timestamp, job.S3Key, int64(stats.bytes))
+	}
+	hp.clearRetry(job.S3Key)
 
-	hp.bytesProcessed.Add(int64(byteCount))
-	logging.GetDefaultLogger().Info("Processed file successfully",
+	logging.Component("worker").Info("Processed file successfully",
 		"s3_key", job.S3Key,
-		"lines", lineCount,
-		"bytes", byteCount,
+		"processing_id", job.ProcessingID,
+		"lines", stats.lines,
+		"bytes", stats.bytes,
 		"destination", "http")
 
 	// Record metrics
 	if hp.metricsClient != nil {
 		latency := time.Since(startTime)
-		hp.metricsClient.RecordFileProcessed(context.Background(), int64(byteCount), latency)
+		hp.metricsClient.RecordFileProcessed(metrics.WithFileKey(context.Background(), job.S3Key), hp.dimensions(job), int64(stats.bytes), latency)
 	}
+}
 
-	return nil
+// auditFile adds a file's outcome to the audit log and reports it. Files that failed after
+// Stop, or after Suspend with suspended set, are reported as interrupted.
+func (hp *HTTPPool) auditFile(job scanner.FileJob, stats fileStats, startTime time.Time, err error, suspended bool) {
+	if hp.audit == nil && hp.reporter == nil {
+		return
+	}
+	duration := time.Since(startTime).Milliseconds()
+	completedAt := time.Now().UTC()
+	result := audit.ResultDelivered
+	switch {
+	case err == nil:
+	case hp.ctx.Err() != nil || suspended:
+		result = audit.ResultInterrupted
+	case errors.Is(err, ErrFileTimeout):
+		result = audit.ResultTimedOut
+	default:
+		result = audit.ResultFailed
+	}
+	var errText string
+	if err != nil {
+		errText = err.Error()
+	}
+
+	if hp.audit != nil {
+		hp.audit.Add(audit.Record{
+			Key:         job.S3Key,
+			StreamID:    job.StreamID,
+			Timestamp:   job.Timestamp,
+			Lines:       stats.lines,
+			Bytes:       stats.bytes,
+			DurationMs:  duration,
+			Result:      result,
+			Error:       errText,
+			CompletedAt: completedAt,
+
+			ProcessingID: job.ProcessingID,
+		})
+	}
+	if hp.reporter != nil {
+		hp.reporter.Report(report.Record{
+			Key:          job.S3Key,
+			StreamID:     job.StreamID,
+			Format:       hp.format().Name(),
+			Timestamp:    job.Timestamp,
+			LinesIn:      stats.linesIn,
+			LinesOut:     stats.linesOut,
+			Skipped:      stats.skipped,
+			BytesIn:      stats.bytesIn,
+			BytesOut:     int64(stats.bytes),
+			DurationMs:   duration,
+			Result:       result,
+			Error:        errText,
+			Destinations: stats.destinations,
+			CompletedAt:  completedAt,
+
+			ProcessingID: job.ProcessingID,
+		})
+	}
+}
+
+// interrupt leaves a file cancelled by Stop to be re-enqueued by the next start instead of
+// recording a failure: its in-flight journal entry is kept. Lines it already queued are
+// still delivered, and its resume checkpoint keeps the next attempt from sending them again.
+// Files Stop finds still queued are saved as pending by the SinkPool worker. A file
+// cancelled by Suspend is left to the new leader the same way.
+func (hp *HTTPPool) interrupt(job scanner.FileJob) {
+	logging.Component("worker").Info("File interrupted by shutdown or step-down, will be re-enqueued",
+		"s3_key", job.S3Key,
+		"processing_id", job.ProcessingID)
+	hp.retryDone(job.S3Key) // A failed file is retried again once this replica leads
+	// Its Ack releases the stream once the queued lines resolve
+}
+
+// Suspend stops processing until Resume (see SinkPool.Suspend). Lines already queued are
+// still delivered by the sender.
+func (hp *HTTPPool) Suspend() {
+	for _, job := range hp.suspend() {
+		hp.retryDone(job.S3Key)
+	}
+}
+
+// recordFailure notes a failed attempt with state managers that track per-file records,
+// ends the file's in-flight journal entry, releases its sharding claim and schedules a retry
+func (hp *HTTPPool) recordFailure(job scanner.FileJob, cause error) {
+	if hp.claims != nil {
+		hp.claims.Release(job.S3Key)
+	}
+	if journal, ok := hp.stateManager.(state.Journal); ok {
+		journal.EndFile(job.S3Key)
+	}
+	if recorder, ok := hp.stateManager.(state.FailureRecorder); ok {
+		recorder.RecordFailure(job.Timestamp, job.S3Key)
+	}
+	hp.scheduleRetry(job, cause)
 }
 
 // GetMetrics returns current metrics
@@ -205,7 +583,36 @@ func (hp *HTTPPool) GetMetrics() (files, bytes, errors int64) {
 	return hp.filesProcessed.Load(), hp.bytesProcessed.Load(), hp.errors.Load()
 }
 
-// GetMetricsCounters returns atomic counters for metrics (for compatibility)
-func (hp *HTTPPool) GetMetricsCounters() (*atomic.Int64, *atomic.Int64, *atomic.Int64) {
-	return &hp.filesProcessed, &hp.bytesProcessed, &hp.errors
+// SetAuditLog records every processed file's outcome in log. Call before Start.
+func (hp *HTTPPool) SetAuditLog(log *audit.Log) {
+	hp.audit = log
+}
+
+// SetReporter reports every processed file's line counts and destinations. Call before Start.
+func (hp *HTTPPool) SetReporter(reporter *report.Reporter) {
+	hp.reporter = reporter
+}
+
+// HealthStats returns the pool's readings for a health.PipelineHealthChecker
+func (hp *HTTPPool) HealthStats() health.PipelineStats {
+	stats := health.PipelineStats{
+		Lag: hp.lag,
+		Counters: func() (files, errors int64) {
+			return hp.filesProcessed.Load(), hp.errors.Load()
+		},
+	}
+	if hp.httpSender != nil {
+		stats.BufferFill = hp.httpSender.BufferUtilization
+	}
+	return stats
+}
+
+// ReadinessStats returns the pool's readings for a health.ReadinessChecker
+func (hp *HTTPPool) ReadinessStats() health.ReadinessStats {
+	stats := health.ReadinessStats{QueueFill: hp.jobQueue.fill, Shedding: hp.shedding}
+	if hp.httpSender != nil {
+		stats.Endpoints = hp.httpSender.HealthyEndpoints
+		stats.BufferFill = hp.httpSender.BufferUtilization
+	}
+	return stats
 }
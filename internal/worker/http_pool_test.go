@@ -1,12 +1,20 @@
 package worker
 
 import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/audit"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/metrics"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/report"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
 )
@@ -35,8 +43,8 @@ func TestNewHTTPPool(t *testing.T) {
 		t.Errorf("Expected workerCount %d, got %d", workerCount, pool.workerCount)
 	}
 
-	if cap(pool.jobQueue) != queueSize {
-		t.Errorf("Expected queue size %d, got %d", queueSize, cap(pool.jobQueue))
+	if pool.jobQueue.capacity != queueSize {
+		t.Errorf("Expected queue size %d, got %d", queueSize, pool.jobQueue.capacity)
 	}
 }
 
@@ -127,15 +135,138 @@ func TestHTTPPool_EnqueueJob(t *testing.T) {
 	}
 
 	// Check that job was queued
-	select {
-	case queuedJob := <-pool.jobQueue:
-		if queuedJob.S3Key != job.S3Key {
-			t.Errorf("Expected job key %s, got %s", job.S3Key, queuedJob.S3Key)
-		}
-		if queuedJob.Size != job.Size {
-			t.Errorf("Expected job size %d, got %d", job.Size, queuedJob.Size)
+	if pool.jobQueue.depth() != 1 {
+		t.Fatal("Job should have been queued")
+	}
+	queuedJob, _ := pool.jobQueue.pop()
+	if queuedJob.S3Key != job.S3Key {
+		t.Errorf("Expected job key %s, got %s", job.S3Key, queuedJob.S3Key)
+	}
+	if queuedJob.Size != job.Size {
+		t.Errorf("Expected job size %d, got %d", job.Size, queuedJob.Size)
+	}
+}
+
+func TestHTTPPool_CompleteFileAdvancesStateOnlyOnDelivery(t *testing.T) {
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	pool := NewHTTPPool(&s3.Client{}, &output.HTTPSender{}, stateManager, "test-bucket", 1, 10, nil, nil)
+	job := scanner.FileJob{S3Key: "failed-key", Timestamp: 200}
+
+	pool.completeFile(job, fileStats{lines: 10, bytes: 100}, time.Now(), errors.New("HTTP 503"))
+	if ts := stateManager.GetLastTimestamp(); ts != 0 {
+		t.Errorf("Expected state not to advance after failed delivery, got timestamp %d", ts)
+	}
+	if _, _, errs := pool.GetMetrics(); errs != 1 {
+		t.Errorf("Expected 1 error, got %d", errs)
+	}
+
+	job = scanner.FileJob{S3Key: "delivered-key", Timestamp: 100}
+	pool.completeFile(job, fileStats{lines: 10, bytes: 100}, time.Now(), nil)
+	if ts := stateManager.GetLastTimestamp(); ts != 100 {
+		t.Errorf("Expected timestamp 100 after delivery, got %d", ts)
+	}
+	if file := stateManager.GetLastFile(); file != "delivered-key" {
+		t.Errorf("Expected last file delivered-key, got %s", file)
+	}
+	if files, bytes, _ := pool.GetMetrics(); files != 1 || bytes != 100 {
+		t.Errorf("Expected 1 file and 100 bytes, got %d files and %d bytes", files, bytes)
+	}
+}
+
+func TestHTTPPool_AuditLog(t *testing.T) {
+	log, _ := audit.NewLog(10, "")
+	pool := NewHTTPPool(&s3.Client{}, &output.HTTPSender{}, nil, "test-bucket", 1, 10, nil, nil)
+	pool.SetAuditLog(log)
+
+	pool.completeFile(scanner.FileJob{S3Key: "failed-key", Timestamp: 200}, fileStats{lines: 10, bytes: 100}, time.Now(), errors.New("HTTP 503"))
+	pool.completeFile(scanner.FileJob{S3Key: "delivered-key", Timestamp: 100}, fileStats{lines: 10, bytes: 100}, time.Now(), nil)
+
+	recent := log.Recent(audit.Query{})
+	if len(recent) != 2 {
+		t.Fatalf("Expected 2 audit records, got %d", len(recent))
+	}
+	if r := recent[0]; r.Key != "delivered-key" || r.Result != audit.ResultDelivered || r.Lines != 10 || r.Bytes != 100 {
+		t.Errorf("Expected delivered-key delivered, got %+v", r)
+	}
+	if r := recent[1]; r.Result != audit.ResultFailed || r.Error != "HTTP 503" {
+		t.Errorf("Expected failed-key failed with its error, got %+v", r)
+	}
+}
+
+func TestHTTPPool_WaitForIdleWaitsForDelivery(t *testing.T) {
+	var ranges []string
+	s3Client := newFakeS3(t, []byte("{\"n\":1}\n{\"n\":2}\n"), &ranges)
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	sender, stop := newCollectingSender(t)
+	defer stop()
+
+	pool := NewHTTPPool(s3Client, sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.Start()
+	defer pool.Stop()
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100})
+	pool.Submit(scanner.FileJob{S3Key: "logs/200", Timestamp: 200})
+
+	if !pool.WaitForIdle(5 * time.Second) {
+		t.Fatal("Expected the pool to become idle")
+	}
+	// Idle only once every line was accepted and progress recorded
+	if files, _, _ := pool.GetMetrics(); files != 2 {
+		t.Errorf("Expected 2 files processed when idle, got %d", files)
+	}
+	if ts := stateManager.GetLastTimestamp(); ts != 200 {
+		t.Errorf("Expected state at timestamp 200 when idle, got %d", ts)
+	}
+}
+
+func TestHTTPPool_Report(t *testing.T) {
+	var ranges []string
+	s3Client := newFakeS3(t, []byte("{\"n\":1}\n{\"n\":2}\n"), &ranges)
+	sender, stop := newCollectingSender(t)
+	defer stop()
+
+	path := filepath.Join(t.TempDir(), "report.jsonl")
+	reporter, err := report.NewReporter(report.Options{Path: path})
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	defer reporter.Close()
+
+	pool := NewHTTPPool(s3Client, sender, nil, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.SetReporter(reporter)
+	pool.Start()
+	defer pool.Stop()
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100, ProcessingID: "4f9c2a1d7e3b8065"})
+	if !pool.WaitForIdle(5 * time.Second) {
+		t.Fatal("Expected the pool to become idle")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var r report.Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Expected one JSON record, got %s", data)
+	}
+	if r.Key != "logs/100" || r.Format != "zscaler" || r.Result != audit.ResultDelivered || r.ProcessingID != "4f9c2a1d7e3b8065" {
+		t.Errorf("Expected logs/100 delivered as zscaler, got %+v", r)
+	}
+	if r.LinesIn != 2 || r.LinesOut != 2 || len(r.Skipped) != 0 || r.BytesIn != 16 || r.BytesOut != 14 {
+		t.Errorf("Expected 2 lines and 16 bytes in, 2 lines and 14 bytes out, got %+v", r)
+	}
+	if len(r.Destinations) != 1 {
+		t.Fatalf("Expected one destination, got %+v", r.Destinations)
+	}
+	for endpoint, d := range r.Destinations {
+		if !strings.HasPrefix(endpoint, "http://") || d.Lines != 2 || d.Failed != 0 {
+			t.Errorf("Expected 2 lines accepted by the endpoint, got %s: %+v", endpoint, d)
 		}
-	default:
-		t.Error("Job should have been queued")
 	}
 }
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+)
+
+// DefaultMaxLineSize is the longest line read from a file unless SetLineLimit is called
+const DefaultMaxLineSize = 1024 * 1024
+
+// LongLinePolicy controls what happens to a line longer than the maximum line size
+type LongLinePolicy string
+
+const (
+	// LongLineFail fails the whole file (it is then quarantined as corrupt, see ErrCorruptFile)
+	LongLineFail LongLinePolicy = "fail"
+	// LongLineTruncate sends the first max bytes of the line and discards the rest
+	LongLineTruncate LongLinePolicy = "truncate"
+	// LongLineSplit sends the line as consecutive lines of at most max bytes
+	LongLineSplit LongLinePolicy = "split"
+	// LongLineSkip discards the line
+	LongLineSkip LongLinePolicy = "skip"
+)
+
+// SetLineLimit sets the longest line read from a file (in bytes, excluding the line ending)
+// and what happens to longer ones. Long lines are counted by the s3_long_lines_total metric.
+// Call before Start.
+func (hp *HTTPPool) SetLineLimit(maxSize int, policy LongLinePolicy) {
+	if maxSize > 0 {
+		hp.maxLineSize = maxSize
+	}
+	hp.longLines = policy
+}
+
+// lineSplitter splits a file into lines like bufio.ScanLines, applying a long-line policy
+type lineSplitter struct {
+	max    int
+	policy LongLinePolicy
+
+	consumed   int  // Bytes advanced since the caller last reset it, including discarded ones
+	discarding bool // Dropping the rest of a truncated or skipped line
+	splitting  bool // Sending the rest of a split line
+	long       int  // Lines that exceeded max
+}
+
+// newLineSplitter returns a splitter for lines of up to max bytes
+func newLineSplitter(max int, policy LongLinePolicy) *lineSplitter {
+	return &lineSplitter{max: max, policy: policy}
+}
+
+// bufferSize is the scanner buffer limit the splitter needs: room for a line of max bytes
+// and its "\r\n", so a longer line is seen by the splitter before the scanner gives up on it
+func (s *lineSplitter) bufferSize() int {
+	return s.max + 2
+}
+
+// split implements bufio.SplitFunc
+func (s *lineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := s.next(data, atEOF)
+	s.consumed += advance
+	return advance, token, err
+}
+
+// next returns the next line, or the next piece of a long one
+func (s *lineSplitter) next(data []byte, atEOF bool) (int, []byte, error) {
+	if s.discarding {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			s.discarding = false
+			return i + 1, nil, nil
+		}
+		if atEOF {
+			s.discarding = false
+		}
+		return len(data), nil, nil
+	}
+
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if err != nil {
+		return advance, token, err
+	}
+	complete := advance > 0
+	if complete && len(token) <= s.max || !complete && len(data) <= s.max+1 {
+		if complete {
+			s.splitting = false
+		}
+		return advance, token, nil
+	}
+
+	// The line is longer than max; data starts with its first max bytes either way
+	if !s.splitting {
+		s.long++
+	}
+	switch s.policy {
+	case LongLineSplit:
+		s.splitting = true
+		return s.max, data[:s.max], nil
+	case LongLineTruncate:
+		if complete {
+			return advance, token[:s.max], nil
+		}
+		s.discarding = true
+		return s.max, data[:s.max], nil
+	case LongLineSkip:
+		if complete {
+			return advance, nil, nil
+		}
+		s.discarding = true
+		return len(data), nil, nil
+	default:
+		return 0, nil, bufio.ErrTooLong
+	}
+}
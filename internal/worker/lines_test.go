@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLineSplitter_Policies(t *testing.T) {
+	input := "short\n" + strings.Repeat("x", 25) + "\r\nok\n" + strings.Repeat("y", 12)
+	tests := []struct {
+		policy LongLinePolicy
+		want   []string
+		long   int
+	}{
+		{LongLineTruncate, []string{"short", "xxxxxxxxxx", "ok", "yyyyyyyyyy"}, 2},
+		{LongLineSplit, []string{"short", "xxxxxxxxxx", "xxxxxxxxxx", "xxxxx", "ok", "yyyyyyyyyy", "yy"}, 2},
+		{LongLineSkip, []string{"short", "ok"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			// Read a byte at a time so long lines are seen before their line ending
+			lines := newLineSplitter(10, tt.policy)
+			scanner := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(input)))
+			scanner.Buffer(make([]byte, 0, 4), lines.bufferSize())
+			scanner.Split(lines.split)
+
+			var got []string
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if lines.long != tt.long {
+				t.Errorf("Expected %d long lines, got %d", tt.long, lines.long)
+			}
+			if lines.consumed != len(input) {
+				t.Errorf("Expected all %d bytes consumed, got %d", len(input), lines.consumed)
+			}
+		})
+	}
+}
+
+func TestLineSplitter_Fail(t *testing.T) {
+	lines := newLineSplitter(10, LongLineFail)
+	scanner := bufio.NewScanner(strings.NewReader("short\n" + strings.Repeat("x", 25) + "\n"))
+	scanner.Buffer(make([]byte, 0, 4), lines.bufferSize())
+	scanner.Split(lines.split)
+	for scanner.Scan() {
+	}
+	if !errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		t.Errorf("Expected ErrTooLong, got %v", scanner.Err())
+	}
+}
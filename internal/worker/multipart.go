@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+)
+
+// ErrObjectChanged is returned when an object is replaced while its parts are being downloaded
+var ErrObjectChanged = errors.New("object changed during multipart download")
+
+// MultipartPolicy controls ranged multi-part downloads of large objects
+type MultipartPolicy struct {
+	Threshold   int64 // Objects with at least this many bytes left to read are downloaded in parts
+	PartSize    int64 // Bytes per ranged GET
+	Concurrency int   // Parts downloaded at once (and buffered ahead of the reader)
+}
+
+// SetMultipartDownload downloads large objects as concurrent ranged GETs reassembled in
+// order, so one file is not limited to a single request's throughput on high-latency links.
+// Up to Concurrency x PartSize bytes are buffered per file. A policy without a threshold,
+// part size or concurrency disables it. Call before Start.
+func (hp *HTTPPool) SetMultipartDownload(policy MultipartPolicy) {
+	if policy.Threshold <= 0 || policy.PartSize <= 0 || policy.Concurrency < 1 {
+		return
+	}
+	hp.multipart = &policy
+}
+
+// download opens the object from byte offset start, in parts if it is large enough
+func (hp *HTTPPool) download(ctx context.Context, job scanner.FileJob, start int64) (io.ReadCloser, error) {
+	if hp.multipart != nil && job.Size-start >= hp.multipart.Threshold {
+		return newMultipartReader(ctx, hp.s3Client, hp.bucket, job.S3Key, start, job.Size, *hp.multipart), nil
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(hp.bucket),
+		Key:    aws.String(job.S3Key),
+	}
+	if start > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", start))
+	}
+	result, err := hp.s3Client.GetObject(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return result.Body, nil
+}
+
+// downloadedPart is the content of one ranged GET
+type downloadedPart struct {
+	data []byte
+	etag string
+	size int64 // Object size reported by the part's Content-Range
+	err  error
+}
+
+// multipartReader reads an object as consecutive ranged GETs run concurrently.
+// Parts are handed to the reader in order; a part is only requested once fewer than
+// Concurrency parts are downloading or waiting to be read.
+type multipartReader struct {
+	cancel context.CancelFunc
+	size   int64 // Object size the parts were planned for
+	parts  []chan downloadedPart
+	slots  chan struct{} // One per part downloading or buffered
+	wg     sync.WaitGroup
+
+	next    int    // Index of the next part to read
+	current []byte // Unread data of the part being read
+	etag    string // ETag of the first part; later parts must match it
+	err     error
+}
+
+// newMultipartReader starts downloading bytes [start, size) of the object in parts
+func newMultipartReader(ctx context.Context, client *s3.Client, bucket, key string, start, size int64, policy MultipartPolicy) *multipartReader {
+	ctx, cancel := context.WithCancel(ctx)
+	count := int((size - start + policy.PartSize - 1) / policy.PartSize)
+	r := &multipartReader{
+		cancel: cancel,
+		size:   size,
+		parts:  make([]chan downloadedPart, count),
+		slots:  make(chan struct{}, policy.Concurrency),
+	}
+	for i := range r.parts {
+		r.parts[i] = make(chan downloadedPart, 1)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for i := range r.parts {
+			select {
+			case r.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			first := start + int64(i)*policy.PartSize
+			last := min(first+policy.PartSize, size) - 1
+			r.wg.Add(1)
+			go func() {
+				defer r.wg.Done()
+				r.parts[i] <- fetchPart(ctx, client, bucket, key, first, last)
+			}()
+		}
+	}()
+	return r
+}
+
+// fetchPart downloads bytes [first, last] of the object
+func fetchPart(ctx context.Context, client *s3.Client, bucket, key string, first, last int64) downloadedPart {
+	result, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+	})
+	if err != nil {
+		return downloadedPart{err: fmt.Errorf("failed to download bytes %d-%d: %w", first, last, err)}
+	}
+	defer result.Body.Close()
+
+	data := make([]byte, last-first+1)
+	if _, err := io.ReadFull(result.Body, data); err != nil {
+		return downloadedPart{err: fmt.Errorf("failed to read bytes %d-%d: %w", first, last, err)}
+	}
+	return downloadedPart{data: data, etag: aws.ToString(result.ETag), size: contentRangeSize(aws.ToString(result.ContentRange))}
+}
+
+// contentRangeSize returns the complete length from a "bytes first-last/size" header (-1 if unknown)
+func contentRangeSize(contentRange string) int64 {
+	i := strings.LastIndexByte(contentRange, '/')
+	if i < 0 {
+		return -1
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// Read implements io.Reader
+func (r *multipartReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.next == len(r.parts) {
+			return 0, io.EOF
+		}
+		part := <-r.parts[r.next]
+		r.next++
+		<-r.slots // Let the next part start downloading
+		switch {
+		case part.err != nil:
+			r.err = part.err
+		case part.size >= 0 && part.size != r.size:
+			r.err = fmt.Errorf("%w (size %d, listed as %d)", ErrObjectChanged, part.size, r.size)
+		case r.next == 1:
+			r.etag = part.etag
+		case part.etag != r.etag:
+			r.err = fmt.Errorf("%w (ETag %s, expected %s)", ErrObjectChanged, part.etag, r.etag)
+		}
+		if r.err == nil {
+			r.current = part.data
+		}
+	}
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Close cancels outstanding part downloads and waits for them to finish
+func (r *multipartReader) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
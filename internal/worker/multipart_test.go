@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newRangedS3 serves object with Range support, counting ranged requests; replaced swaps
+// the object for another one after the given number of requests
+func newRangedS3(t *testing.T, object []byte, replaced []byte, after int64) (*s3.Client, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, etag := object, `"v1"`
+		if replaced != nil && requests.Add(1) > after {
+			content, etag = replaced, `"v2"`
+		} else if replaced == nil {
+			requests.Add(1)
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	}), &requests
+}
+
+func TestMultipartReader(t *testing.T) {
+	object := bytes.Repeat([]byte("0123456789"), 1000) // 10,000 bytes
+	client, requests := newRangedS3(t, object, nil, 0)
+
+	policy := MultipartPolicy{Threshold: 1, PartSize: 1024, Concurrency: 3}
+	r := newMultipartReader(context.Background(), client, "bucket", "key", 100, int64(len(object)), policy)
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, object[100:]) {
+		t.Errorf("Expected %d bytes from offset 100 in order, got %d", len(object)-100, len(got))
+	}
+	if n := requests.Load(); n != 10 {
+		t.Errorf("Expected 10 ranged GETs, got %d", n)
+	}
+}
+
+func TestMultipartReader_ObjectChanged(t *testing.T) {
+	object := bytes.Repeat([]byte("a"), 4096)
+	client, _ := newRangedS3(t, object, bytes.Repeat([]byte("b"), 4096), 1)
+
+	policy := MultipartPolicy{Threshold: 1, PartSize: 1024, Concurrency: 1}
+	r := newMultipartReader(context.Background(), client, "bucket", "key", 0, int64(len(object)), policy)
+	_, err := io.ReadAll(r)
+	r.Close()
+	if !errors.Is(err, ErrObjectChanged) {
+		t.Errorf("Expected ErrObjectChanged, got %v", err)
+	}
+}
+
+func TestMultipartReader_CloseEarly(t *testing.T) {
+	object := make([]byte, 64*1024)
+	client, _ := newRangedS3(t, object, nil, 0)
+
+	policy := MultipartPolicy{Threshold: 1, PartSize: 1024, Concurrency: 2}
+	r := newMultipartReader(context.Background(), client, "bucket", "key", 0, int64(len(object)), policy)
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	// Must cancel the remaining parts rather than download the whole object
+	r.Close()
+}
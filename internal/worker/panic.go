@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+)
+
+// ErrPanic is wrapped by the error of a file whose processing panicked (e.g. in a format's
+// ProcessContent). The panic fails only that file; the worker goes on to the next one.
+var ErrPanic = errors.New("panic while processing file")
+
+// recoverPanic turns a panic in the deferring function into an ErrPanic error in *err.
+// Defer it first, so the function's other deferred cleanup runs before it.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		logging.Component("worker").Error("Recovered from panic while processing file",
+			"panic", r,
+			"stack", string(debug.Stack()))
+		*err = fmt.Errorf("%w: %v", ErrPanic, r)
+	}
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// panickingFormat panics on lines containing "boom"
+type panickingFormat struct {
+	*formats.ZscalerFormat
+}
+
+func (f panickingFormat) ProcessContent(line []byte, isFirstLine bool) ([]byte, error) {
+	if string(line) == "boom" {
+		panic("malformed line")
+	}
+	return f.ZscalerFormat.ProcessContent(line, isFirstLine)
+}
+
+func TestHTTPPool_PanicFailsOnlyTheFile(t *testing.T) {
+	var ranges []string
+	s3Client := newFakeS3(t, []byte("{\"n\":1}\nboom\n{\"n\":2}\n"), &ranges)
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	sender, stop := newCollectingSender(t)
+	defer stop()
+
+	pool := NewHTTPPool(s3Client, sender, stateManager, "test-bucket", 1, 10, nil, panickingFormat{formats.NewZscalerFormat()})
+	pool.Start()
+	defer pool.Stop()
+
+	// The single worker must survive the first file to process the second
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100})
+	pool.Submit(scanner.FileJob{S3Key: "logs/200", Timestamp: 200})
+	if !pool.WaitForIdle(5 * time.Second) {
+		t.Fatal("Expected the pool to become idle after the panics")
+	}
+
+	if _, _, errs := pool.GetMetrics(); errs != 2 {
+		t.Errorf("Expected 2 file errors, got %d", errs)
+	}
+	if ts := stateManager.GetLastTimestamp(); ts != 0 {
+		t.Errorf("Expected state not to advance past a panicked file, got timestamp %d", ts)
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	run := func() (err error) {
+		defer recoverPanic(&err)
+		panic("bad plugin")
+	}
+	if err := run(); !errors.Is(err, ErrPanic) {
+		t.Errorf("Expected ErrPanic, got %v", err)
+	}
+}
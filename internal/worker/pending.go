@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// savePending records files a stopping pool did not process in the in-flight journal as
+// pending, so the next start re-enqueues them even if the checkpoint has moved past their
+// timestamp.
+// It returns how many were saved (0 if the state manager keeps no journal).
+func savePending(stateManager state.StateManager, jobs []scanner.FileJob) int {
+	journal, ok := stateManager.(state.Journal)
+	if !ok || len(jobs) == 0 {
+		return 0
+	}
+	now := time.Now().Unix()
+	for _, job := range jobs {
+		journal.BeginFile(state.InFlightJob{
+			Key:       job.S3Key,
+			StreamID:  job.StreamID,
+			Timestamp: job.Timestamp,
+			Size:      job.Size,
+			StartedAt: now,
+			Pending:   true,
+		})
+	}
+	return len(jobs)
+}
+
+// stopQueue closes a stopping pool's queue and saves the files still in it for the next start
+func stopQueue(queue *jobQueue, stateManager state.StateManager) {
+	jobs := queue.drain()
+	if saved := savePending(stateManager, jobs); saved > 0 {
+		logging.Component("worker").Info("Saved queued files for the next start", "files", saved)
+	} else if len(jobs) > 0 {
+		logging.Component("worker").Warn("Discarded queued files on shutdown; the state backend keeps no in-flight journal",
+			"files", len(jobs))
+	}
+}
+
+// recoverInFlight re-submits the files in the in-flight journal that were started at least
+// staleAfter ago, and the pending files of a previous run whatever their age: no other
+// instance started them. It blocks while the queue is full.
+func recoverInFlight(stateManager state.StateManager, queue *jobQueue, staleAfter time.Duration) (int, error) {
+	journal, ok := stateManager.(state.Journal)
+	if !ok {
+		return 0, nil
+	}
+	entries, err := journal.InFlight()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read in-flight files: %w", err)
+	}
+
+	cutoff := time.Now().Add(-staleAfter).Unix()
+	recovered := 0
+	for _, entry := range entries {
+		if !entry.Pending && entry.StartedAt > cutoff {
+			continue
+		}
+		job := scanner.FileJob{
+			S3Key:     entry.Key,
+			Timestamp: entry.Timestamp,
+			Size:      entry.Size,
+			StreamID:  entry.StreamID,
+		}
+		// Block until a worker has room; the journal can be larger than the queue
+		if !queue.pushWait(job) {
+			return recovered, nil
+		}
+		recovered++
+	}
+
+	if recovered > 0 {
+		logging.Component("worker").Warn("Re-enqueued files left in flight by a previous run",
+			"files", recovered)
+	}
+	return recovered, nil
+}
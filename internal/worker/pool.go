@@ -0,0 +1,465 @@
+package worker
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/crash"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// Pool is implemented by every worker pool: TCPPool, FilePool, HTTPPool, and any SinkPool
+type Pool interface {
+	Start()
+	Stop()
+	Submit(job scanner.FileJob) bool
+	RecoverInFlight(staleAfter time.Duration) (int, error)
+	QueueDepth() int
+	WaitForIdle(timeout time.Duration) bool
+	GetMetricsCounters() (*atomic.Int64, *atomic.Int64, *atomic.Int64)
+	GetTimeouts() int64
+	SetFileTimeout(timeout time.Duration)
+	SetStrictOrdering()
+}
+
+var (
+	_ Pool = (*SinkPool)(nil)
+	_ Pool = (*TCPPool)(nil)
+	_ Pool = (*FilePool)(nil)
+	_ Pool = (*HTTPPool)(nil)
+)
+
+// Source opens the content of a file. Closing it releases the download.
+type Source func(ctx context.Context, job scanner.FileJob) (io.ReadCloser, error)
+
+// Transform rewrites one line of a file (without its line ending); first is set for the
+// file's first line. Returning a nil line drops it.
+type Transform func(line []byte, first bool) ([]byte, error)
+
+// Sink writes the content of one file to an output
+type Sink interface {
+	// WriteFile consumes content and returns how many bytes it wrote
+	WriteFile(ctx context.Context, job scanner.FileJob, content io.Reader) (int64, error)
+}
+
+// maxTransformLine is the longest line a transform is given
+const maxTransformLine = 10 * 1024 * 1024
+
+// SinkPool is the worker core every pool runs on: workers take files from the queue, read
+// them from a Source (S3 by default), pass them through any Transforms, and write them to a
+// Sink. A pool that delivers asynchronously (HTTPPool) replaces that per-file step with its
+// own handler and keeps the queue, workers, shutdown and in-flight journal handling.
+type SinkPool struct {
+	s3Client       *s3.Client
+	stateManager   state.StateManager
+	bucket         string
+	workerCount    int
+	jobQueue       *jobQueue
+	wg             sync.WaitGroup
+	stopCh         chan struct{}
+	stopped        atomic.Bool
+	fileTimeout    time.Duration
+	source         Source
+	transforms     []Transform
+	sink           Sink
+	filesProcessed atomic.Int64
+	bytesProcessed atomic.Int64
+	errors         atomic.Int64
+	timeouts       atomic.Int64
+
+	// Cancelled by Stop once the background loops have exited; handlers that abort
+	// in-flight files on shutdown derive their contexts from it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Cancelled by Suspend to abort the files in flight and replaced by Resume; files are
+	// aborted when the one current when they started is cancelled (guarded by epochMu)
+	epochMu  sync.Mutex
+	epoch    context.Context
+	endEpoch context.CancelFunc
+
+	// Processes one popped file and marks it done in the queue, now or once delivered
+	handle func(id int, job scanner.FileJob)
+
+	// Loops that submit to the queue or resize the pool; Stop waits for them first
+	loops sync.WaitGroup
+
+	scaleMu sync.Mutex
+	workers int // Running workers, less those asked to retire (guarded by scaleMu)
+	nextID  int // ID of the next worker started (guarded by scaleMu)
+}
+
+// NewSinkPool creates a worker pool writing the files of bucket to sink
+func NewSinkPool(
+	s3Client *s3.Client,
+	sink Sink,
+	stateManager state.StateManager,
+	bucket string,
+	workerCount int,
+	queueSize int,
+) *SinkPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &SinkPool{
+		s3Client:     s3Client,
+		stateManager: stateManager,
+		bucket:       strings.TrimPrefix(bucket, "s3://"), // Strip s3:// prefix from bucket name
+		workerCount:  workerCount,
+		jobQueue:     newJobQueue(queueSize),
+		stopCh:       make(chan struct{}),
+		fileTimeout:  DefaultFileTimeout,
+		sink:         sink,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	p.epoch, p.endEpoch = context.WithCancel(context.Background())
+	p.source = p.openObject
+	p.handle = p.writeFile
+	return p
+}
+
+// SetSource replaces the S3 download as the source of file content. Call before Start.
+func (p *SinkPool) SetSource(source Source) {
+	p.source = source
+}
+
+// SetTransforms passes each line of a file through transforms, in order, before it reaches
+// the sink. Without any, content is written as it is read. Call before Start.
+func (p *SinkPool) SetTransforms(transforms ...Transform) {
+	p.transforms = transforms
+}
+
+// SetFileTimeout sets how long one file may take to read and write. Call before Start.
+func (p *SinkPool) SetFileTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		p.fileTimeout = timeout
+	}
+}
+
+// SetStrictOrdering processes the files of each stream (prefix) one at a time, in timestamp
+// order, while different streams still run in parallel. Call before Start.
+func (p *SinkPool) SetStrictOrdering() {
+	p.jobQueue.setStrictOrdering()
+}
+
+// Start starts all workers
+func (p *SinkPool) Start() {
+	p.resize(p.workerCount)
+}
+
+// Stop stops all workers once their current file is done. Files still queued are saved
+// in the in-flight journal for the next start (see RecoverInFlight).
+func (p *SinkPool) Stop() {
+	if !p.stopped.CompareAndSwap(false, true) {
+		return
+	}
+	close(p.stopCh)
+	p.loops.Wait() // They submit to the queue and start workers
+	p.cancel()
+	stopQueue(p.jobQueue, p.stateManager)
+	p.wg.Wait()
+}
+
+// Suspend stops processing until Resume, for a replica that lost its leader lease: files
+// still queued are discarded, files in flight are cancelled without being counted as
+// failed, and Submit rejects files. The new leader picks them up from the shared
+// checkpoint and in-flight journal.
+func (p *SinkPool) Suspend() {
+	p.suspend()
+}
+
+// suspend suspends the pool and returns the files it discarded
+func (p *SinkPool) suspend() []scanner.FileJob {
+	jobs := p.jobQueue.suspend()
+	p.epochMu.Lock()
+	p.endEpoch()
+	p.epochMu.Unlock()
+	if len(jobs) > 0 {
+		logging.Component("worker").Info("Discarded queued files on step-down", "files", len(jobs))
+	}
+	return jobs
+}
+
+// Resume processes files again after Suspend
+func (p *SinkPool) Resume() {
+	p.epochMu.Lock()
+	defer p.epochMu.Unlock()
+	if p.epoch.Err() != nil {
+		p.epoch, p.endEpoch = context.WithCancel(context.Background())
+	}
+	p.jobQueue.resume()
+}
+
+// epochContext returns the context of files started now (see Suspend)
+func (p *SinkPool) epochContext() context.Context {
+	p.epochMu.Lock()
+	defer p.epochMu.Unlock()
+	return p.epoch
+}
+
+// runLoop runs loop in the background until Stop, which waits for it to return. loop
+// must return once stopCh is closed. Call from Start.
+func (p *SinkPool) runLoop(loop func()) {
+	p.loops.Add(1)
+	go func() {
+		defer crash.Recover()
+		defer p.loops.Done()
+		loop()
+	}()
+}
+
+// GetWorkerCount returns the number of workers the pool is running
+func (p *SinkPool) GetWorkerCount() int {
+	p.scaleMu.Lock()
+	defer p.scaleMu.Unlock()
+	return p.workers
+}
+
+// resize starts or retires workers until n are running. Retired workers finish their
+// current file first.
+func (p *SinkPool) resize(n int) {
+	p.scaleMu.Lock()
+	defer p.scaleMu.Unlock()
+
+	for p.workers < n {
+		if !p.jobQueue.withdrawRetire() {
+			p.wg.Add(1)
+			go p.worker(p.nextID)
+			p.nextID++
+		}
+		p.workers++
+	}
+	for p.workers > n {
+		p.jobQueue.retire()
+		p.workers--
+	}
+}
+
+// RecoverInFlight re-submits files a previous run still had queued when it stopped (or
+// started and never finished) and that were started at least staleAfter ago. Call before
+// the first scan.
+func (p *SinkPool) RecoverInFlight(staleAfter time.Duration) (int, error) {
+	return recoverInFlight(p.stateManager, p.jobQueue, staleAfter)
+}
+
+// Submit submits a job to the worker pool
+func (p *SinkPool) Submit(job scanner.FileJob) bool {
+	return p.jobQueue.push(job) // False when the queue is full or stopped
+}
+
+// GetMetricsCounters returns pointers to the metrics counters
+func (p *SinkPool) GetMetricsCounters() (*atomic.Int64, *atomic.Int64, *atomic.Int64) {
+	return &p.filesProcessed, &p.bytesProcessed, &p.errors
+}
+
+// GetTimeouts returns how many files exceeded the per-file timeout (not included in errors)
+func (p *SinkPool) GetTimeouts() int64 {
+	return p.timeouts.Load()
+}
+
+// QueueDepth returns the current queue depth
+func (p *SinkPool) QueueDepth() int {
+	return p.jobQueue.depth()
+}
+
+// WaitForIdle waits until every submitted file has been written. It reports false if
+// timeout (0 for none) expires first.
+func (p *SinkPool) WaitForIdle(timeout time.Duration) bool {
+	return p.jobQueue.waitIdle(timeout)
+}
+
+// worker processes jobs from the queue
+func (p *SinkPool) worker(id int) {
+	defer crash.Recover()
+	defer p.wg.Done()
+
+	for {
+		job, ok := p.jobQueue.pop()
+		if !ok {
+			return // Stopped or scaled down
+		}
+		select {
+		case <-p.stopCh:
+			// Popped as Stop drained the queue; leave it for the next start
+			savePending(p.stateManager, []scanner.FileJob{job})
+			p.jobQueue.done(job)
+			continue
+		default:
+		}
+		p.handle(id, job)
+	}
+}
+
+// writeFile is the default handler: it writes a file to the sink and counts the outcome
+func (p *SinkPool) writeFile(id int, job scanner.FileJob) {
+	defer p.jobQueue.done(job)
+
+	epoch := p.epochContext()
+	if err := p.processJob(epoch, job); err != nil {
+		if epoch.Err() != nil {
+			logging.Component("worker").Info("File interrupted by step-down",
+				"s3_key", job.S3Key,
+				"processing_id", job.ProcessingID)
+			return
+		}
+		logging.Component("worker").Error("Worker failed to process job",
+			"worker_id", id,
+			"s3_key", job.S3Key,
+			"processing_id", job.ProcessingID,
+			"error", err)
+		if journal, ok := p.stateManager.(state.Journal); ok {
+			journal.EndFile(job.S3Key) // In case it was re-enqueued from the journal
+		}
+		if errors.Is(err, ErrFileTimeout) {
+			p.timeouts.Add(1)
+		} else {
+			p.errors.Add(1)
+		}
+		return
+	}
+	p.filesProcessed.Add(1)
+}
+
+// processJob reads a file from the source and writes it, transformed, to the sink.
+// Cancelling parent aborts it.
+func (p *SinkPool) processJob(parent context.Context, job scanner.FileJob) (err error) {
+	defer recoverPanic(&err)
+	ctx, cancel := fileContext(parent, p.fileTimeout)
+	defer cancel()
+	defer func() { err = timeoutError(ctx, p.fileTimeout, err) }()
+
+	content, err := p.source(ctx, job)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	var reader io.Reader = content
+	if len(p.transforms) > 0 {
+		reader = newTransformReader(content, p.transforms)
+	}
+	written, err := p.sink.WriteFile(ctx, job, reader)
+	if err != nil {
+		return err
+	}
+
+	// Update state
+	p.bytesProcessed.Add(written)
+	p.stateManager.UpdateStreamProgress(job.StreamID, job.Timestamp, job.S3Key, written)
+
+	return nil
+}
+
+// openObject is the default Source: it downloads a file from S3, decompressing gzipped objects
+func (p *SinkPool) openObject(ctx context.Context, job scanner.FileJob) (io.ReadCloser, error) {
+	result, err := p.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(job.S3Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get S3 object: %w", err)
+	}
+
+	// Decompress gzipped objects; others are read as they are
+	obj := &object{body: result.Body, reader: getReader(result.Body)}
+	obj.content = obj.reader
+	if isGzip(obj.reader) {
+		gzReader, err := getGzipReader(obj.reader)
+		if err != nil {
+			obj.Close()
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		obj.gzReader = gzReader
+		obj.content = gzReader
+	}
+	return obj, nil
+}
+
+// object is the content of a downloaded S3 object; Close returns its pooled readers
+type object struct {
+	body     io.ReadCloser
+	reader   *bufio.Reader
+	gzReader *gzip.Reader
+	content  io.Reader
+}
+
+func (o *object) Read(b []byte) (int, error) {
+	return o.content.Read(b)
+}
+
+func (o *object) Close() error {
+	if o.gzReader != nil {
+		putGzipReader(o.gzReader)
+	}
+	putReader(o.reader)
+	return o.body.Close()
+}
+
+// transformReader reads content line by line through transforms, yielding each kept line
+// followed by "\n"
+type transformReader struct {
+	scanner    *bufio.Scanner
+	transforms []Transform
+	first      bool
+	pending    []byte
+	err        error
+}
+
+func newTransformReader(content io.Reader, transforms []Transform) *transformReader {
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 64*1024), maxTransformLine)
+	return &transformReader{scanner: scanner, transforms: transforms, first: true}
+}
+
+func (r *transformReader) Read(b []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if !r.scanner.Scan() {
+			r.err = io.EOF
+			if err := r.scanner.Err(); err != nil {
+				r.err = fmt.Errorf("failed to scan file: %w", err)
+			}
+			continue
+		}
+		line, err := r.transform(r.scanner.Bytes())
+		if err != nil {
+			r.err = err
+			continue
+		}
+		if line != nil {
+			r.pending = append(append(r.pending[:0], line...), '\n')
+		}
+	}
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// transform applies every transform to one line, stopping at the first that drops it
+func (r *transformReader) transform(line []byte) ([]byte, error) {
+	first := r.first
+	r.first = false
+	for _, transform := range r.transforms {
+		var err error
+		if line, err = transform(line, first); err != nil {
+			return nil, fmt.Errorf("failed to process line: %w", err)
+		}
+		if line == nil {
+			return nil, nil
+		}
+	}
+	return line, nil
+}
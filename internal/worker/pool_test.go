@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// bufferSink collects everything written to it
+type bufferSink struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *bufferSink) WriteFile(ctx context.Context, job scanner.FileJob, content io.Reader) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return io.Copy(&s.buf, content)
+}
+
+func TestSinkPool_SourceTransformsSink(t *testing.T) {
+	sink := &bufferSink{}
+	pool := NewSinkPool(nil, sink, &state.Manager{}, "s3://test-bucket", 1, 10)
+	pool.SetSource(func(ctx context.Context, job scanner.FileJob) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("header\na\n\nb")), nil
+	})
+	pool.SetTransforms(
+		func(line []byte, first bool) ([]byte, error) {
+			if first {
+				return nil, nil // Drop the header
+			}
+			return line, nil
+		},
+		func(line []byte, first bool) ([]byte, error) {
+			return bytes.ToUpper(line), nil
+		},
+	)
+	if pool.bucket != "test-bucket" {
+		t.Errorf("Expected bucket test-bucket, got %s", pool.bucket)
+	}
+
+	if err := pool.processJob(context.Background(), scanner.FileJob{S3Key: "a.log"}); err != nil {
+		t.Fatalf("processJob failed: %v", err)
+	}
+	if got := sink.buf.String(); got != "A\n\nB\n" {
+		t.Errorf("Expected %q, got %q", "A\n\nB\n", got)
+	}
+	if _, bytes, _ := pool.GetMetricsCounters(); bytes.Load() != 5 {
+		t.Errorf("Expected 5 bytes processed, got %d", bytes.Load())
+	}
+}
+
+func TestSinkPool_CountsFailures(t *testing.T) {
+	pool := NewSinkPool(nil, &bufferSink{}, &state.Manager{}, "test-bucket", 1, 10)
+	pool.SetSource(func(ctx context.Context, job scanner.FileJob) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("a\n")), nil
+	})
+	pool.SetTransforms(func(line []byte, first bool) ([]byte, error) {
+		return nil, errors.New("bad line")
+	})
+	pool.Start()
+	defer pool.Stop()
+
+	pool.Submit(scanner.FileJob{S3Key: "a.log"})
+	if !pool.WaitForIdle(5 * time.Second) {
+		t.Fatal("Expected the pool to become idle")
+	}
+	files, _, errs := pool.GetMetricsCounters()
+	if files.Load() != 0 || errs.Load() != 1 {
+		t.Errorf("Expected 0 files and 1 error, got %d and %d", files.Load(), errs.Load())
+	}
+}
+
+func TestSinkPool_SuspendResume(t *testing.T) {
+	sink := &bufferSink{}
+	pool := NewSinkPool(nil, sink, &state.Manager{}, "test-bucket", 1, 10)
+	started := make(chan struct{})
+	pool.SetSource(func(ctx context.Context, job scanner.FileJob) (io.ReadCloser, error) {
+		if job.S3Key == "slow.log" {
+			close(started)
+			<-ctx.Done() // Until Suspend cancels it
+			return nil, ctx.Err()
+		}
+		return io.NopCloser(strings.NewReader(job.S3Key + "\n")), nil
+	})
+	pool.Start()
+	defer pool.Stop()
+
+	pool.Submit(scanner.FileJob{S3Key: "slow.log", Timestamp: 1})
+	<-started
+	pool.Submit(scanner.FileJob{S3Key: "queued.log", Timestamp: 2})
+	pool.Suspend()
+	if !pool.WaitForIdle(5 * time.Second) {
+		t.Fatal("Expected the suspended pool to become idle")
+	}
+	if pool.Submit(scanner.FileJob{S3Key: "rejected.log"}) {
+		t.Error("Expected a suspended pool to reject files")
+	}
+	files, _, errs := pool.GetMetricsCounters()
+	if files.Load() != 0 || errs.Load() != 0 || sink.buf.Len() != 0 {
+		t.Errorf("Expected nothing processed or failed, got %d files, %d errors, %q", files.Load(), errs.Load(), sink.buf.String())
+	}
+
+	pool.Resume()
+	if !pool.Submit(scanner.FileJob{S3Key: "resumed.log"}) {
+		t.Fatal("Expected a resumed pool to accept files")
+	}
+	if !pool.WaitForIdle(5 * time.Second) {
+		t.Fatal("Expected the pool to become idle")
+	}
+	if got := sink.buf.String(); got != "resumed.log\n" {
+		t.Errorf("Expected only resumed.log written, got %q", got)
+	}
+}
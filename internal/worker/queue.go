@@ -0,0 +1,269 @@
+package worker
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+)
+
+// jobQueue is a bounded queue of files that hands out the oldest file first (by timestamp,
+// then key), so catch-up processing drains old data first even when several prefixes or
+// retries feed the same pool. After close, pop keeps returning queued files until none are left.
+// Every file handed out by pop must be reported with done once it is finished.
+//
+// With strict ordering, each stream is a single lane: pop skips files of a stream that
+// already has one being processed until done is called for it.
+type jobQueue struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	jobs      jobHeap
+	capacity  int
+	closed    bool
+	suspended bool // Rejecting files until resume (see suspend)
+	retiring  int  // Workers asked to stop, see retire
+	active    int  // Files handed out by pop and not yet done
+
+	strict bool
+	busy   map[string]bool // Streams with a file being processed (strict ordering only)
+}
+
+// running returns how many files are handed out and not yet done
+func (q *jobQueue) running() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.active
+}
+
+// newJobQueue creates a queue holding up to capacity files
+func newJobQueue(capacity int) *jobQueue {
+	q := &jobQueue{capacity: capacity}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues a file, reporting false if the queue is full or closed
+func (q *jobQueue) push(job scanner.FileJob) bool {
+	job = withProcessingID(job)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || q.suspended || len(q.jobs) >= q.capacity {
+		return false
+	}
+	heap.Push(&q.jobs, job)
+	q.cond.Broadcast()
+	return true
+}
+
+// withProcessingID gives a job created outside the scanner (a retry, a recovered or
+// triggered file) its processing ID
+func withProcessingID(job scanner.FileJob) scanner.FileJob {
+	if job.ProcessingID == "" {
+		job.ProcessingID = scanner.NewProcessingID()
+	}
+	return job
+}
+
+// pushWait queues a file once there is room, reporting false if the queue is closed or
+// suspended first
+func (q *jobQueue) pushWait(job scanner.FileJob) bool {
+	job = withProcessingID(job)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && !q.suspended && len(q.jobs) >= q.capacity {
+		q.cond.Wait()
+	}
+	if q.closed || q.suspended {
+		return false
+	}
+	heap.Push(&q.jobs, job)
+	q.cond.Broadcast()
+	return true
+}
+
+// setStrictOrdering processes the files of each stream one at a time. Call before any pop.
+func (q *jobQueue) setStrictOrdering() {
+	q.strict = true
+	q.busy = make(map[string]bool)
+}
+
+// pop waits for the oldest queued file (whose stream is free, with strict ordering). It
+// reports false once the queue is closed and empty, or if the calling worker is asked to retire.
+func (q *jobQueue) pop() (scanner.FileJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.next()
+	for i < 0 && q.retiring == 0 && !(q.closed && len(q.jobs) == 0) {
+		q.cond.Wait()
+		i = q.next()
+	}
+	if q.retiring > 0 {
+		q.retiring--
+		return scanner.FileJob{}, false
+	}
+	if i < 0 {
+		return scanner.FileJob{}, false
+	}
+	job := heap.Remove(&q.jobs, i).(scanner.FileJob)
+	q.active++
+	if q.strict {
+		q.busy[job.StreamID] = true
+	}
+	q.cond.Broadcast() // Wake pushWait
+	return job, true
+}
+
+// next returns the heap index of the file to hand out next, or -1 if there is none (caller holds mu)
+func (q *jobQueue) next() int {
+	if len(q.jobs) == 0 {
+		return -1
+	}
+	if !q.strict {
+		return 0
+	}
+	best := -1
+	for i, job := range q.jobs {
+		if !q.busy[job.StreamID] && (best < 0 || q.jobs.Less(i, best)) {
+			best = i
+		}
+	}
+	return best
+}
+
+// done marks a file handed out by pop as finished, freeing its stream's lane with strict ordering
+func (q *jobQueue) done(job scanner.FileJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	if q.strict {
+		delete(q.busy, job.StreamID)
+	}
+	q.cond.Broadcast()
+}
+
+// waitIdle waits until no file is queued or being processed. It reports false if timeout
+// (0 for none) expires first.
+func (q *jobQueue) waitIdle(timeout time.Duration) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	expired := false
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			expired = true
+			q.cond.Broadcast()
+		})
+		defer timer.Stop()
+	}
+	for len(q.jobs) > 0 || q.active > 0 {
+		if expired {
+			return false
+		}
+		q.cond.Wait()
+	}
+	return true
+}
+
+// retire makes the next pop report false, stopping one worker once it is idle
+func (q *jobQueue) retire() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.retiring++
+	q.cond.Broadcast()
+}
+
+// withdrawRetire cancels a retirement no worker has picked up yet, reporting whether there was one
+func (q *jobQueue) withdrawRetire() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.retiring == 0 {
+		return false
+	}
+	q.retiring--
+	return true
+}
+
+// close stops accepting files and wakes every waiting worker and producer
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// suspend rejects files until resume and removes every queued file, returning them oldest
+// first. Files already handed out by pop are not affected.
+func (q *jobQueue) suspend() []scanner.FileJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.suspended = true
+	jobs := make([]scanner.FileJob, 0, len(q.jobs))
+	for len(q.jobs) > 0 {
+		jobs = append(jobs, heap.Pop(&q.jobs).(scanner.FileJob))
+	}
+	q.cond.Broadcast()
+	return jobs
+}
+
+// resume accepts files again after suspend
+func (q *jobQueue) resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.suspended = false
+}
+
+// drain closes the queue and removes every queued file, returning them oldest first.
+// Waiting workers wake and stop.
+func (q *jobQueue) drain() []scanner.FileJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	jobs := make([]scanner.FileJob, 0, len(q.jobs))
+	for len(q.jobs) > 0 {
+		jobs = append(jobs, heap.Pop(&q.jobs).(scanner.FileJob))
+	}
+	q.cond.Broadcast()
+	return jobs
+}
+
+// depth returns the number of queued files
+func (q *jobQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// fill returns the fraction of the queue's capacity in use
+func (q *jobQueue) fill() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.capacity == 0 {
+		return 0
+	}
+	return float64(len(q.jobs)) / float64(q.capacity)
+}
+
+// jobHeap orders files by timestamp, then key (container/heap)
+type jobHeap []scanner.FileJob
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].Timestamp != h[j].Timestamp {
+		return h[i].Timestamp < h[j].Timestamp
+	}
+	return h[i].S3Key < h[j].S3Key
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x any) { *h = append(*h, x.(scanner.FileJob)) }
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	job := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return job
+}
@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+)
+
+func TestJobQueue_OldestFirst(t *testing.T) {
+	q := newJobQueue(10)
+	// Two prefixes interleaved, plus a retry of an old file submitted last
+	for _, job := range []scanner.FileJob{
+		{S3Key: "a/300", Timestamp: 300},
+		{S3Key: "b/100", Timestamp: 100},
+		{S3Key: "a/200", Timestamp: 200},
+		{S3Key: "b/200", Timestamp: 200},
+		{S3Key: "a/050", Timestamp: 50},
+	} {
+		if !q.push(job) {
+			t.Fatalf("push(%s) failed", job.S3Key)
+		}
+	}
+
+	want := []string{"a/050", "b/100", "a/200", "b/200", "a/300"}
+	for _, key := range want {
+		job, ok := q.pop()
+		if !ok || job.S3Key != key {
+			t.Errorf("Expected %s, got %s (ok=%v)", key, job.S3Key, ok)
+		}
+	}
+}
+
+func TestJobQueue_Capacity(t *testing.T) {
+	q := newJobQueue(1)
+	if !q.push(scanner.FileJob{S3Key: "a", Timestamp: 2}) {
+		t.Fatal("Expected the first push to succeed")
+	}
+	if q.push(scanner.FileJob{S3Key: "b", Timestamp: 1}) {
+		t.Error("Expected push to fail on a full queue")
+	}
+
+	pushed := make(chan bool)
+	go func() { pushed <- q.pushWait(scanner.FileJob{S3Key: "b", Timestamp: 1}) }()
+	select {
+	case <-pushed:
+		t.Fatal("Expected pushWait to block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if job, _ := q.pop(); job.S3Key != "a" {
+		t.Errorf("Expected a, got %s", job.S3Key)
+	}
+	if !<-pushed {
+		t.Error("Expected pushWait to succeed once there was room")
+	}
+}
+
+func TestJobQueue_ProcessingID(t *testing.T) {
+	q := newJobQueue(2)
+	q.push(scanner.FileJob{S3Key: "listed", Timestamp: 1, ProcessingID: "from-scanner"})
+	q.push(scanner.FileJob{S3Key: "retried", Timestamp: 2})
+
+	if job, _ := q.pop(); job.ProcessingID != "from-scanner" {
+		t.Errorf("Expected the scanner's processing ID to be kept, got %q", job.ProcessingID)
+	}
+	if job, _ := q.pop(); len(job.ProcessingID) != 16 {
+		t.Errorf("Expected a processing ID for a job without one, got %q", job.ProcessingID)
+	}
+}
+
+func TestJobQueue_CloseAndRetire(t *testing.T) {
+	q := newJobQueue(10)
+	q.push(scanner.FileJob{S3Key: "a", Timestamp: 1})
+
+	q.retire()
+	if _, ok := q.pop(); ok {
+		t.Error("Expected a retiring worker to stop")
+	}
+	q.retire()
+	if !q.withdrawRetire() || q.withdrawRetire() {
+		t.Error("Expected exactly one retirement to withdraw")
+	}
+
+	q.close()
+	if q.push(scanner.FileJob{S3Key: "b"}) || q.pushWait(scanner.FileJob{S3Key: "b"}) {
+		t.Error("Expected push to fail once closed")
+	}
+	if job, ok := q.pop(); !ok || job.S3Key != "a" {
+		t.Errorf("Expected queued files to drain after close, got %s (ok=%v)", job.S3Key, ok)
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("Expected pop to stop once closed and empty")
+	}
+}
+
+func TestJobQueue_StrictOrdering(t *testing.T) {
+	q := newJobQueue(10)
+	q.setStrictOrdering()
+	for _, job := range []scanner.FileJob{
+		{S3Key: "a/100", Timestamp: 100, StreamID: "a"},
+		{S3Key: "a/200", Timestamp: 200, StreamID: "a"},
+		{S3Key: "b/300", Timestamp: 300, StreamID: "b"},
+	} {
+		q.push(job)
+	}
+
+	first, _ := q.pop()
+	second, _ := q.pop()
+	if first.S3Key != "a/100" || second.S3Key != "b/300" {
+		t.Fatalf("Expected a/100 then b/300 (stream a busy), got %s and %s", first.S3Key, second.S3Key)
+	}
+
+	popped := make(chan scanner.FileJob)
+	go func() {
+		job, _ := q.pop()
+		popped <- job
+	}()
+	select {
+	case job := <-popped:
+		t.Fatalf("Expected a/200 to wait for a/100, got %s", job.S3Key)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.done(first)
+	if job := <-popped; job.S3Key != "a/200" {
+		t.Errorf("Expected a/200 once a/100 was done, got %s", job.S3Key)
+	}
+}
+
+func TestJobQueue_Drain(t *testing.T) {
+	q := newJobQueue(10)
+	q.push(scanner.FileJob{S3Key: "b", Timestamp: 2})
+	q.push(scanner.FileJob{S3Key: "a", Timestamp: 1})
+
+	jobs := q.drain()
+	if len(jobs) != 2 || jobs[0].S3Key != "a" || jobs[1].S3Key != "b" {
+		t.Errorf("Expected a and b oldest first, got %+v", jobs)
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("Expected pop to stop once drained")
+	}
+	if q.push(scanner.FileJob{S3Key: "c"}) {
+		t.Error("Expected push to fail once drained")
+	}
+}
+
+func TestJobQueue_WaitIdle(t *testing.T) {
+	q := newJobQueue(10)
+	if !q.waitIdle(0) {
+		t.Error("Expected an empty queue to be idle")
+	}
+
+	q.push(scanner.FileJob{S3Key: "a", Timestamp: 1})
+	if q.waitIdle(20 * time.Millisecond) {
+		t.Error("Expected a queued file to keep the queue busy")
+	}
+	job, _ := q.pop()
+	if q.waitIdle(20 * time.Millisecond) {
+		t.Error("Expected a file being processed to keep the queue busy")
+	}
+
+	idle := make(chan bool)
+	go func() { idle <- q.waitIdle(0) }()
+	q.done(job)
+	select {
+	case ok := <-idle:
+		if !ok {
+			t.Error("Expected waitIdle without a timeout to report idle")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected waitIdle to return once the file was done")
+	}
+}
@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/output"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/report"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// newFakeS3 serves one object, honouring "bytes=N-" ranges, and records the Range header
+func newFakeS3(t *testing.T, object []byte, ranges *[]string) *s3.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		*ranges = append(*ranges, rng)
+		if rng == "" {
+			w.Write(object)
+			return
+		}
+		start, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		if err != nil {
+			t.Errorf("Unexpected Range header %q", rng)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(object)-1, len(object)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(object[start:])
+	}))
+	t.Cleanup(server.Close)
+
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+}
+
+// newCollectingSender returns a started sender and a function that stops it and returns every received line
+func newCollectingSender(t *testing.T) (*output.HTTPSender, func() []string) {
+	var mu sync.Mutex
+	var lines []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")...)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	sender := output.NewHTTPSender(
+		[]string{server.URL},
+		500, 1024*1024, 10*time.Millisecond, 1, 10000,
+		5*time.Second, 10, 90*time.Second,
+		10*time.Second, 10*time.Second, time.Second,
+		nil,
+	)
+	sender.Start()
+	return sender, func() []string {
+		sender.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		return lines
+	}
+}
+
+func TestHTTPPool_ReadFileResumesFromOffset(t *testing.T) {
+	var content bytes.Buffer
+	var resumeBytes int64
+	for i := 0; i < 3500; i++ {
+		if i == 2000 {
+			resumeBytes = int64(content.Len())
+		}
+		fmt.Fprintf(&content, "{\"n\":%d}\n", i)
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(content.Bytes())
+	gz.Close()
+
+	tests := []struct {
+		name      string
+		object    []byte
+		offset    state.FileOffset
+		wantRange string
+	}{
+		{"plain ranged", content.Bytes(), state.FileOffset{Lines: 2000, Bytes: resumeBytes, Sent: 2000}, fmt.Sprintf("bytes=%d-", resumeBytes)},
+		{"gzip skip", compressed.Bytes(), state.FileOffset{Lines: 2000, Bytes: resumeBytes, Sent: 2000, Compressed: true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+			if err != nil {
+				t.Fatalf("NewManager failed: %v", err)
+			}
+			stateManager.UpdateOffset("logs/big", tt.offset)
+
+			var ranges []string
+			sender, stop := newCollectingSender(t)
+			pool := NewHTTPPool(newFakeS3(t, tt.object, &ranges), sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+
+			done := make(chan error, 1)
+			ack := output.NewAck(func(err error) { done <- err })
+			stats, err := pool.readFile(context.Background(), scanner.FileJob{S3Key: "logs/big"}, ack)
+			if err != nil {
+				t.Fatalf("readFile failed: %v", err)
+			}
+			ack.Seal()
+			if err := <-done; err != nil {
+				t.Fatalf("Delivery failed: %v", err)
+			}
+			lines := stop()
+
+			if len(ranges) != 1 || ranges[0] != tt.wantRange {
+				t.Errorf("Expected Range %q, got %v", tt.wantRange, ranges)
+			}
+			if stats.lines != 1500 || len(lines) != 1500 {
+				t.Fatalf("Expected 1500 lines read and sent, got %d and %d", stats.lines, len(lines))
+			}
+			if stats.linesIn != 3500 || stats.linesOut != 1500 || stats.skipped[report.SkipResumed] != 2000 {
+				t.Errorf("Expected 3500 lines in, 1500 out and 2000 skipped as resumed, got %+v", stats)
+			}
+			if lines[0] != `{"n":2000}` {
+				t.Errorf("Expected first sent line to be line 2000, got %s", lines[0])
+			}
+			// Resume points past the old checkpoint were recorded as delivery progressed
+			if offset, _ := stateManager.GetOffset("logs/big"); offset.Sent != 3000 || offset.Lines != 3000 {
+				t.Errorf("Expected resume point at line 3000, got %+v", offset)
+			}
+		})
+	}
+}
+
+func TestHTTPPool_RecoverInFlight(t *testing.T) {
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	// Left in flight by a crashed run after the checkpoint moved past it
+	stateManager.BeginFile(state.InFlightJob{Key: "logs/100", StreamID: "bucket/logs/", Timestamp: 100, StartedAt: time.Now().Add(-time.Hour).Unix()})
+	stateManager.UpdateStreamProgress("bucket/logs/", 200, "logs/200", 10)
+	// Started recently, possibly by another instance
+	stateManager.BeginFile(state.InFlightJob{Key: "logs/150", StreamID: "bucket/logs/", Timestamp: 150, StartedAt: time.Now().Unix()})
+	// Still queued when the previous run stopped just now
+	savePending(stateManager, []scanner.FileJob{{S3Key: "logs/120", StreamID: "bucket/logs/", Timestamp: 120}})
+
+	var ranges []string
+	sender, stop := newCollectingSender(t)
+	pool := NewHTTPPool(newFakeS3(t, []byte("{\"n\":1}\n{\"n\":2}\n"), &ranges), sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.Start()
+	defer pool.Stop()
+
+	recovered, err := pool.RecoverInFlight(10 * time.Minute)
+	if err != nil {
+		t.Fatalf("RecoverInFlight failed: %v", err)
+	}
+	if recovered != 2 {
+		t.Fatalf("Expected the stale and the pending file recovered, got %d", recovered)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jobs, _ := stateManager.InFlight()
+		if len(jobs) == 1 && jobs[0].Key == "logs/150" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected only logs/150 to stay in flight, got %+v", jobs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lines := stop(); len(lines) != 4 {
+		t.Errorf("Expected the recovered files' 4 lines to be sent, got %d", len(lines))
+	}
+	if cp := stateManager.GetCheckpoint("bucket/logs/"); cp.Timestamp != 200 {
+		t.Errorf("Expected the checkpoint to stay at 200, got %d", cp.Timestamp)
+	}
+}
@@ -0,0 +1,183 @@
+package worker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// maxRetryCheckInterval bounds how often due retries are looked up
+const maxRetryCheckInterval = 10 * time.Second
+
+// RetryPolicy controls how files whose processing failed are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts (including the first) before a file is quarantined
+	Backoff     time.Duration // Delay before the first retry, doubled per attempt
+	MaxBackoff  time.Duration // Upper bound on the retry delay
+
+	// RetryCorrupt retries corrupt files (see ErrCorruptFile) like any other failure instead
+	// of quarantining them on their first failure
+	RetryCorrupt bool
+}
+
+// delay returns the wait after the given number of failed attempts
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+// SetRetryPolicy retries failed files with exponential backoff and quarantines them once
+// their attempts are used up. Attempts are tracked in state, so it has no effect unless the
+// state manager is a state.RetryTracker. A policy with MaxAttempts below 1 disables retries.
+// Call before Start.
+func (hp *HTTPPool) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		return
+	}
+	if _, ok := hp.stateManager.(state.RetryTracker); !ok {
+		logging.Component("worker").Warn("State backend cannot track failed files, retries disabled")
+		return
+	}
+	hp.retry = &policy
+	hp.retrying = make(map[string]bool)
+}
+
+// retryLoop re-submits failed files whose next attempt is due until the pool stops
+func (hp *HTTPPool) retryLoop() {
+
+	ticker := time.NewTicker(min(hp.retry.Backoff, maxRetryCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hp.submitDueRetries()
+		case <-hp.stopCh:
+			return
+		}
+	}
+}
+
+// submitDueRetries submits every failed file whose next attempt is due and that is not already queued
+func (hp *HTTPPool) submitDueRetries() {
+	tracker := hp.stateManager.(state.RetryTracker)
+	files, err := tracker.Failures()
+	if err != nil {
+		logging.Component("worker").Error("Failed to list failed files for retry", "error", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, f := range files {
+		if f.Quarantined || f.NextRetry > now || !hp.markRetrying(f.Key) {
+			continue
+		}
+		job := scanner.FileJob{S3Key: f.Key, Timestamp: f.Timestamp, Size: f.Size, StreamID: f.StreamID}
+		if !hp.Submit(job) {
+			hp.retryDone(f.Key)
+			return // Queue full; the next check tries again
+		}
+		logging.Component("worker").Info("Retrying failed file",
+			"s3_key", f.Key,
+			"attempt", f.Attempts+1)
+	}
+}
+
+// markRetrying records a file as submitted for retry, reporting false if it already is
+func (hp *HTTPPool) markRetrying(key string) bool {
+	hp.retryMu.Lock()
+	defer hp.retryMu.Unlock()
+	if hp.retrying[key] {
+		return false
+	}
+	hp.retrying[key] = true
+	return true
+}
+
+// retryDone ends a retry, reporting whether the file was submitted for retry
+func (hp *HTTPPool) retryDone(key string) bool {
+	hp.retryMu.Lock()
+	defer hp.retryMu.Unlock()
+	retrying := hp.retrying[key]
+	delete(hp.retrying, key)
+	return retrying
+}
+
+// scheduleRetry counts a failed attempt of a file and schedules its next attempt,
+// or quarantines it once the attempts are used up
+func (hp *HTTPPool) scheduleRetry(job scanner.FileJob, cause error) {
+	if hp.retry == nil {
+		return
+	}
+	hp.retryDone(job.S3Key)
+
+	tracker := hp.stateManager.(state.RetryTracker)
+	f, found, err := tracker.GetFailure(job.S3Key)
+	if err != nil {
+		logging.Component("worker").Error("Failed to read failed file entry", "s3_key", job.S3Key, "processing_id", job.ProcessingID, "error", err)
+		return
+	}
+
+	now := time.Now()
+	if !found {
+		f = state.FailedFile{
+			Key:          job.S3Key,
+			StreamID:     job.StreamID,
+			Timestamp:    job.Timestamp,
+			Size:         job.Size,
+			FirstFailure: now.Unix(),
+		}
+	}
+	f.Attempts++
+	f.LastFailure = now.Unix()
+	f.ProcessingID = job.ProcessingID
+	if cause != nil {
+		f.LastError = cause.Error()
+	}
+
+	switch {
+	case errors.Is(cause, ErrCorruptFile) && !hp.retry.RetryCorrupt:
+		f.Quarantined = true
+		f.NextRetry = 0
+		logging.Component("worker").Warn("Corrupt file quarantined without retry",
+			"s3_key", job.S3Key,
+			"processing_id", job.ProcessingID,
+			"error", f.LastError)
+	case f.Attempts >= hp.retry.MaxAttempts:
+		f.Quarantined = true
+		f.NextRetry = 0
+		logging.Component("worker").Warn("File quarantined after repeated failures",
+			"s3_key", job.S3Key,
+			"processing_id", job.ProcessingID,
+			"attempts", f.Attempts,
+			"error", f.LastError)
+	default:
+		delay := hp.retry.delay(f.Attempts)
+		f.NextRetry = now.Add(delay).Unix()
+		logging.Component("worker").Info("Scheduled retry of failed file",
+			"s3_key", job.S3Key,
+			"processing_id", job.ProcessingID,
+			"attempts", f.Attempts,
+			"retry_in", delay)
+	}
+
+	if err := tracker.PutFailure(f); err != nil {
+		logging.Component("worker").Error("Failed to record failed file", "s3_key", job.S3Key, "processing_id", job.ProcessingID, "error", err)
+	}
+}
+
+// clearRetry removes the failure entry of a retried file that has now been processed
+func (hp *HTTPPool) clearRetry(key string) {
+	if hp.retry == nil || !hp.retryDone(key) {
+		return
+	}
+	if err := hp.stateManager.(state.RetryTracker).ClearFailure(key); err != nil {
+		logging.Component("worker").Error("Failed to clear failed file entry", "s3_key", key, "error", err)
+	}
+}
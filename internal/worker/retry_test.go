@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+// newFlakyS3 serves the object after failing the first failures requests with 403
+func newFlakyS3(t *testing.T, object []byte, failures int64) *s3.Client {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write(object)
+	}))
+	t.Cleanup(server.Close)
+
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Minute, MaxBackoff: 5 * time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{10, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.delay(tt.attempts); got != tt.want {
+			t.Errorf("delay(%d) = %v, expected %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPPool_RetryFailedFile(t *testing.T) {
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	sender, stop := newCollectingSender(t)
+	pool := NewHTTPPool(newFlakyS3(t, []byte("{\"n\":1}\n{\"n\":2}\n"), 2), sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: time.Second})
+	pool.Start()
+	defer pool.Stop()
+
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100, StreamID: "bucket/logs/"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stateManager.GetCheckpoint("bucket/logs/").Timestamp != 100 {
+		if time.Now().After(deadline) {
+			failures, _ := stateManager.Failures()
+			t.Fatalf("Expected the file to be processed on retry, failures: %+v", failures)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if failures, _ := stateManager.Failures(); len(failures) != 0 {
+		t.Errorf("Expected the failure entry to be cleared, got %+v", failures)
+	}
+	if lines := stop(); len(lines) != 2 {
+		t.Errorf("Expected 2 lines to be sent, got %d", len(lines))
+	}
+}
+
+func TestHTTPPool_QuarantineAfterMaxAttempts(t *testing.T) {
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	sender, stop := newCollectingSender(t)
+	defer stop()
+	pool := NewHTTPPool(newFlakyS3(t, nil, 100), sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond, MaxBackoff: time.Second})
+	pool.Start()
+	defer pool.Stop()
+
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100, Size: 42, StreamID: "bucket/logs/"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f, found, _ := stateManager.GetFailure("logs/100")
+		if found && f.Quarantined {
+			if f.Attempts != 3 || f.LastError == "" || f.Size != 42 || f.FirstFailure == 0 || f.NextRetry != 0 || f.ProcessingID == "" {
+				t.Errorf("Unexpected quarantine entry %+v", f)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the file to be quarantined, got %+v", f)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Quarantined files are not retried
+	time.Sleep(50 * time.Millisecond)
+	if f, _, _ := stateManager.GetFailure("logs/100"); f.Attempts != 3 {
+		t.Errorf("Expected no further attempts, got %d", f.Attempts)
+	}
+}
+
+func TestHTTPPool_QuarantineCorruptFile(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("{\"n\":1}\n{\"n\":2}\n"))
+	gz.Close()
+	truncated := compressed.Bytes()[:compressed.Len()-10]
+
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	sender, stop := newCollectingSender(t)
+	defer stop()
+	var ranges []string
+	pool := NewHTTPPool(newFakeS3(t, truncated, &ranges), sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: time.Second})
+	pool.Start()
+	defer pool.Stop()
+
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100, Size: int64(len(truncated)), StreamID: "bucket/logs/"})
+	if !pool.WaitForIdle(5 * time.Second) {
+		t.Fatal("Expected the pool to become idle")
+	}
+
+	f, found, _ := stateManager.GetFailure("logs/100")
+	if !found || !f.Quarantined || f.Attempts != 1 {
+		t.Errorf("Expected the corrupt file to be quarantined after 1 attempt, got %+v", f)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(ranges) != 1 {
+		t.Errorf("Expected no retry of the corrupt file, got %d downloads", len(ranges))
+	}
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/logging"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+)
+
+// shedInterval is how often the shedder samples the queue and buffer
+const shedInterval = time.Second
+
+// ShedPolicy pauses scanning while the pool is saturated, so files wait in S3 instead of
+// piling up behind a full job queue and line buffer
+type ShedPolicy struct {
+	HighWater float64       // Job queue and line buffer fill (0-1) at which shedding starts...
+	For       time.Duration // ...once both have stayed there this long
+	LowWater  float64       // Shedding stops once both are below this fill
+}
+
+// decide returns whether to shed given the sample and how long both fills have been at the
+// high-water mark (0 if they are not)
+func (p ShedPolicy) decide(shedding bool, s autoscaleSample, saturatedFor time.Duration) bool {
+	if shedding {
+		return s.queueFill >= p.LowWater || s.bufferFill >= p.LowWater
+	}
+	return s.queueFill >= p.HighWater && s.bufferFill >= p.HighWater && saturatedFor >= p.For
+}
+
+// SetShedPolicy sheds load through gate, the pause gate shared with the scanners. Call before Start.
+func (hp *HTTPPool) SetShedPolicy(policy ShedPolicy, gate *scanner.PauseGate) {
+	hp.shed = &policy
+	hp.shedGate = gate
+}
+
+// shedLoop samples the queue and buffer and sheds load until the pool stops
+func (hp *HTTPPool) shedLoop() {
+	defer hp.shedGate.SetShedding(false)
+
+	ticker := time.NewTicker(shedInterval)
+	defer ticker.Stop()
+
+	var saturatedSince time.Time
+	shedding := false
+	for {
+		select {
+		case now := <-ticker.C:
+			sample := hp.sampleAutoscale()
+			var saturatedFor time.Duration
+			if sample.queueFill >= hp.shed.HighWater && sample.bufferFill >= hp.shed.HighWater {
+				if saturatedSince.IsZero() {
+					saturatedSince = now
+				}
+				saturatedFor = now.Sub(saturatedSince)
+			} else {
+				saturatedSince = time.Time{}
+			}
+
+			next := hp.shed.decide(shedding, sample, saturatedFor)
+			if next == shedding {
+				continue
+			}
+			shedding = next
+			hp.shedGate.SetShedding(shedding)
+			if shedding {
+				logging.Component("worker").Warn("Shedding load: scanning paused until the queue and buffer drain",
+					"queue_fill", sample.queueFill,
+					"buffer_fill", sample.bufferFill,
+					"saturated_for", saturatedFor.Round(time.Second))
+			} else {
+				logging.Component("worker").Info("Stopped shedding load: scanning resumed",
+					"queue_fill", sample.queueFill,
+					"buffer_fill", sample.bufferFill)
+			}
+		case <-hp.stopCh:
+			return
+		}
+	}
+}
+
+// shedding reports whether the pool is shedding load
+func (hp *HTTPPool) shedding() bool {
+	return hp.shedGate != nil && hp.shedGate.Status().Shedding
+}
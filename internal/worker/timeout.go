@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultFileTimeout bounds the processing of one file unless SetFileTimeout is called
+const DefaultFileTimeout = 5 * time.Minute
+
+// ErrFileTimeout is wrapped by the error of a file whose processing exceeded the per-file timeout.
+// Timed-out files are counted separately from other errors.
+var ErrFileTimeout = errors.New("file processing timed out")
+
+// fileContext returns the context bounding the processing of one file, derived from parent
+func fileContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, timeout)
+}
+
+// timeoutError reports err as ErrFileTimeout if the file's context expired before it occurred
+func timeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %v: %v", ErrFileTimeout, timeout, err)
+	}
+	return err
+}
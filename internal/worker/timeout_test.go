@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/formats"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/scanner"
+	"github.com/edgedelta/s3-edgedelta-streamer/internal/state"
+)
+
+func TestHTTPPool_FileTimeout(t *testing.T) {
+	// The object never arrives within the pool's file timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	s3Client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	sender, stop := newCollectingSender(t)
+	defer stop()
+
+	pool := NewHTTPPool(s3Client, sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.SetFileTimeout(50 * time.Millisecond)
+	pool.Start()
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100})
+	// Stop cancels rather than times out in-flight files, so wait for the timeout first
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.GetTimeouts() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	pool.Stop()
+
+	if timeouts := pool.GetTimeouts(); timeouts != 1 {
+		t.Errorf("Expected 1 timeout, got %d", timeouts)
+	}
+	if _, _, errs := pool.GetMetrics(); errs != 0 {
+		t.Errorf("Expected timeouts not to count as errors, got %d", errs)
+	}
+	if ts := stateManager.GetLastTimestamp(); ts != 0 {
+		t.Errorf("Expected state not to advance after a timeout, got timestamp %d", ts)
+	}
+}
+
+func TestHTTPPool_StopCancelsDownloads(t *testing.T) {
+	// The object would take far longer than the test to arrive
+	requested := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+	}))
+	defer server.Close()
+	s3Client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	stateManager, err := state.NewManager(t.TempDir()+"/state.json", time.Minute)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	sender, stop := newCollectingSender(t)
+	defer stop()
+
+	pool := NewHTTPPool(s3Client, sender, stateManager, "test-bucket", 1, 10, nil, formats.NewZscalerFormat())
+	pool.Start()
+	pool.Submit(scanner.FileJob{S3Key: "logs/100", Timestamp: 100})
+	pool.Submit(scanner.FileJob{S3Key: "logs/200", Timestamp: 200})
+	<-requested
+
+	start := time.Now()
+	pool.Stop()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Stop to cancel the download promptly, took %v", elapsed)
+	}
+
+	if _, _, errs := pool.GetMetrics(); errs != 0 {
+		t.Errorf("Expected a cancelled file not to count as an error, got %d", errs)
+	}
+	// Both the cancelled and the never-started file are left for the next start
+	inFlight, err := stateManager.InFlight()
+	if err != nil {
+		t.Fatalf("InFlight failed: %v", err)
+	}
+	if len(inFlight) != 2 || inFlight[0].Key != "logs/100" || inFlight[1].Key != "logs/200" {
+		t.Errorf("Expected logs/100 and logs/200 in flight, got %+v", inFlight)
+	}
+}
+
+func TestSetFileTimeout_IgnoresNonPositive(t *testing.T) {
+	pool := NewFilePool(&s3.Client{}, t.TempDir()+"/out.log", 10, 1, &state.Manager{}, "test-bucket", 1, 10)
+	pool.SetFileTimeout(0)
+	if pool.fileTimeout != DefaultFileTimeout {
+		t.Errorf("Expected default timeout %v, got %v", DefaultFileTimeout, pool.fileTimeout)
+	}
+	pool.SetFileTimeout(time.Minute)
+	if pool.fileTimeout != time.Minute {
+		t.Errorf("Expected timeout 1m, got %v", pool.fileTimeout)
+	}
+}
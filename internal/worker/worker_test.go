@@ -10,7 +10,7 @@ import (
 	"github.com/edgedelta/s3-edgedelta-streamer/internal/tcppool"
 )
 
-func TestNewPool(t *testing.T) {
+func TestNewTCPPool(t *testing.T) {
 	// Create mock dependencies
 	s3Client := &s3.Client{}
 	tcpPool := &tcppool.Pool{}
@@ -19,10 +19,10 @@ func TestNewPool(t *testing.T) {
 	workerCount := 4
 	queueSize := 25
 
-	pool := NewPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
+	pool := NewTCPPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
 
 	if pool == nil {
-		t.Fatal("NewPool returned nil")
+		t.Fatal("NewTCPPool returned nil")
 	}
 
 	// Bucket should have s3:// prefix stripped
@@ -35,8 +35,8 @@ func TestNewPool(t *testing.T) {
 		t.Errorf("Expected workerCount %d, got %d", workerCount, pool.workerCount)
 	}
 
-	if cap(pool.jobQueue) != queueSize {
-		t.Errorf("Expected queue size %d, got %d", queueSize, cap(pool.jobQueue))
+	if pool.jobQueue.capacity != queueSize {
+		t.Errorf("Expected queue size %d, got %d", queueSize, pool.jobQueue.capacity)
 	}
 
 	if pool.s3Client != s3Client {
@@ -61,7 +61,7 @@ func TestPool_StartStop(t *testing.T) {
 	workerCount := 2
 	queueSize := 10
 
-	pool := NewPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
+	pool := NewTCPPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
 
 	// Start the pool
 	pool.Start()
@@ -85,7 +85,7 @@ func TestPool_Submit(t *testing.T) {
 	workerCount := 2
 	queueSize := 10
 
-	pool := NewPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
+	pool := NewTCPPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
 
 	job := scanner.FileJob{
 		S3Key:     "test-key",
@@ -101,16 +101,15 @@ func TestPool_Submit(t *testing.T) {
 	}
 
 	// Check that job was queued
-	select {
-	case queuedJob := <-pool.jobQueue:
-		if queuedJob.S3Key != job.S3Key {
-			t.Errorf("Expected job key %s, got %s", job.S3Key, queuedJob.S3Key)
-		}
-		if queuedJob.Size != job.Size {
-			t.Errorf("Expected job size %d, got %d", job.Size, queuedJob.Size)
-		}
-	default:
-		t.Error("Job should have been queued")
+	if pool.jobQueue.depth() != 1 {
+		t.Fatal("Job should have been queued")
+	}
+	queuedJob, _ := pool.jobQueue.pop()
+	if queuedJob.S3Key != job.S3Key {
+		t.Errorf("Expected job key %s, got %s", job.S3Key, queuedJob.S3Key)
+	}
+	if queuedJob.Size != job.Size {
+		t.Errorf("Expected job size %d, got %d", job.Size, queuedJob.Size)
 	}
 }
 
@@ -123,7 +122,7 @@ func TestPool_GetMetricsCounters(t *testing.T) {
 	workerCount := 2
 	queueSize := 10
 
-	pool := NewPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
+	pool := NewTCPPool(s3Client, tcpPool, stateManager, bucket, workerCount, queueSize)
 
 	filesProcessed, bytesProcessed, errors := pool.GetMetricsCounters()
 